@@ -41,6 +41,7 @@ import (
 	"github.com/dgraph-io/dgraph/edgraph"
 	"github.com/dgraph-io/dgraph/ee/enc"
 	"github.com/dgraph-io/dgraph/graphql/admin"
+	gqlSchema "github.com/dgraph-io/dgraph/graphql/schema"
 	"github.com/dgraph-io/dgraph/posting"
 	"github.com/dgraph-io/dgraph/schema"
 	"github.com/dgraph-io/dgraph/tok"
@@ -197,6 +198,11 @@ they form a Raft group and provide synchronous replication.
 	flag.Bool("ludicrous_mode", false, "Run alpha in ludicrous mode")
 	flag.Bool("graphql_extensions", true, "Set to false if extensions not required in GraphQL response body")
 	flag.Duration("graphql_poll_interval", time.Second, "polling interval for graphql subscription.")
+	flag.Int("graphql_max_depth", 0,
+		"maximum depth of the selection sets of a GraphQL operation, 0 for no limit.")
+	flag.Int("graphql_batch_parallelism", 8,
+		"maximum number of requests of a batch of GraphQL requests worked on at a time, "+
+			"0 for no limit.")
 }
 
 func setupCustomTokenizers() {
@@ -205,7 +211,11 @@ func setupCustomTokenizers() {
 		return
 	}
 	for _, soFile := range strings.Split(customTokenizers, ",") {
-		tok.LoadCustomTokenizer(soFile)
+		t := tok.LoadCustomTokenizer(soFile)
+		// Tokenizers for types that GraphQL doesn't have are still usable from DQL.
+		if err := gqlSchema.RegisterSearchTokenizer(t.Name(), t.Type()); err != nil {
+			glog.Infof("Custom tokenizer %s can't be used in GraphQL @search: %v", t.Name(), err)
+		}
 	}
 }
 
@@ -637,6 +647,8 @@ func run() {
 	x.Config.NormalizeNodeLimit = cast.ToInt(Alpha.Conf.GetString("normalize_node_limit"))
 	x.Config.PollInterval = Alpha.Conf.GetDuration("graphql_poll_interval")
 	x.Config.GraphqlExtension = Alpha.Conf.GetBool("graphql_extensions")
+	x.Config.GraphqlMaxDepth = Alpha.Conf.GetInt("graphql_max_depth")
+	x.Config.GraphqlBatchParallelism = Alpha.Conf.GetInt("graphql_batch_parallelism")
 
 	x.PrintVersion()
 	glog.Infof("x.Config: %+v", x.Config)
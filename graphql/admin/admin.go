@@ -72,6 +72,32 @@ const (
 		This is the schema that is being served by Dgraph at /graphql.
 		"""
 		generatedSchema: String!
+
+		"""
+		The limits on requests set by the '# Dgraph.Limits' comment of the 'schema' field.
+		"""
+		limits: SchemaLimits
+	}
+
+	"""
+	Limits on the requests that Dgraph serves at /graphql.  A limit that isn't set is null.
+	"""
+	type SchemaLimits {
+
+		"""
+		The most nodes that a mutation can add or link to, counting nested objects.
+		"""
+		maxMutationNodes: Int
+
+		"""
+		The most bytes of mutation JSON that a mutation can send to Dgraph.
+		"""
+		maxRequestBytes: Int
+
+		"""
+		How deep @custom requests to dgraph://self can be nested.  It's 3 if it isn't set.
+		"""
+		maxLoopbackDepth: Int
 	}
 
 	"""
@@ -196,6 +222,40 @@ const (
 		schema: String!
 	}
 
+	type NormalizeGQLSchemaPayload {
+		normalized: String
+		warnings: [String]
+	}
+
+	type MigrationPlan {
+		suggestions: [MigrationSuggestion]
+		dataMigrations: [DataMigration]
+		ambiguities: [String]
+	}
+
+	type MigrationSuggestion {
+		type: String
+		field: String
+		annotation: String
+		reason: String
+	}
+
+	type DataMigration {
+		predicates: [String]
+		reason: String
+	}
+
+	type CheckOperationsPayload {
+		breaks: [OperationBreak]
+	}
+
+	type OperationBreak {
+		operationName: String
+		kind: String
+		path: String
+		message: String
+	}
+
 	input ExportInput {
 		format: String
 	}
@@ -248,6 +308,14 @@ const (
 		state: MembershipState
 		config: Config
 
+		"""
+		Compare two input schemas and return the @dgraph annotations that keep the new one
+		stored in the types and predicates of the old one, and the changes that need their data
+		migrated.  Renames that can't be told apart are reported, rather than guessed at.  This
+		doesn't change the schema that the Dgraph cluster serves.
+		"""
+		migrationPlan(oldSchema: String!, newSchema: String!): MigrationPlan
+
 		` + adminQueries + `
 	}
 
@@ -259,6 +327,19 @@ const (
 		"""
 		updateGQLSchema(input: UpdateGQLSchemaInput!) : UpdateGQLSchemaPayload
 
+		"""
+		Check that the input schema is valid and return it in a canonical format.  This doesn't
+		change the schema that the Dgraph cluster serves.
+		"""
+		normalizeGQLSchema(schema: String!): NormalizeGQLSchemaPayload
+
+		"""
+		Check the operations, a JSON array of {name, query, variables} objects, against the input
+		schema and return the ways each of them would break if that schema were served.  The
+		operations aren't run, and the schema that the Dgraph cluster serves isn't changed.
+		"""
+		checkOperations(schema: String!, operations: String!): CheckOperationsPayload
+
 		"""
 		Starts an export of all data in the cluster.  Export format should be 'rdf' (the default
 		if no format is given), or 'json'.
@@ -305,7 +386,8 @@ var (
 		"config":      commonAdminQueryMWs,
 		"listBackups": commonAdminQueryMWs,
 		// not applying ip whitelisting to keep it in sync with /alter
-		"getGQLSchema": {resolve.GuardianAuthMW4Query},
+		"getGQLSchema":  {resolve.GuardianAuthMW4Query},
+		"migrationPlan": {resolve.GuardianAuthMW4Query},
 		// for queries and mutations related to User/Group, dgraph handles Guardian auth,
 		// so no need to apply GuardianAuth Middleware
 		"queryGroup":     {resolve.IpWhitelistingMW4Query},
@@ -322,6 +404,9 @@ var (
 		"login":    {resolve.IpWhitelistingMW4Mutation},
 		"restore":  commonAdminMutationMWs,
 		"shutdown": commonAdminMutationMWs,
+		// not applying ip whitelisting to keep it in sync with updateGQLSchema
+		"normalizeGQLSchema": {resolve.GuardianAuthMW4Mutation},
+		"checkOperations":    {resolve.GuardianAuthMW4Mutation},
 		// not applying ip whitelisting to keep it in sync with /alter
 		"updateGQLSchema": {resolve.GuardianAuthMW4Mutation},
 		// for queries and mutations related to User/Group, dgraph handles Guardian auth,
@@ -373,11 +458,12 @@ func NewServers(withIntrospection bool, globalEpoch *uint64, closer *y.Closer) (
 	mainServer := web.NewServer(globalEpoch, resolvers)
 
 	fns := &resolve.ResolverFns{
-		Qrw: resolve.NewQueryRewriter(),
-		Arw: resolve.NewAddRewriter,
-		Urw: resolve.NewUpdateRewriter,
-		Drw: resolve.NewDeleteRewriter(),
-		Ex:  resolve.NewDgraphExecutor(),
+		Qrw:  resolve.NewQueryRewriter(),
+		Arw:  resolve.NewAddRewriter,
+		Urw:  resolve.NewUpdateRewriter,
+		Uprw: resolve.NewUpsertRewriter,
+		Drw:  resolve.NewDeleteRewriter(),
+		Ex:   resolve.NewDgraphExecutor(),
 	}
 	adminResolvers := newAdminResolver(mainServer, fns, withIntrospection, globalEpoch, closer)
 	adminServer := web.NewServer(globalEpoch, adminResolvers)
@@ -476,6 +562,9 @@ func newAdminResolverFactory() resolve.ResolverFactory {
 		"login":    resolveLogin,
 		"restore":  resolveRestore,
 		"shutdown": resolveShutdown,
+
+		"normalizeGQLSchema": resolveNormalizeSchema,
+		"checkOperations":    resolveCheckOperations,
 	}
 
 	rf := resolverFactoryWithErrorMsg(errResolverNotFound).
@@ -493,6 +582,9 @@ func newAdminResolverFactory() resolve.ResolverFactory {
 		WithQueryResolver("listBackups", func(q schema.Query) resolve.QueryResolver {
 			return resolve.QueryResolverFunc(resolveListBackups)
 		}).
+		WithQueryResolver("migrationPlan", func(q schema.Query) resolve.QueryResolver {
+			return resolve.QueryResolverFunc(resolveMigrationPlan)
+		}).
 		WithMutationResolver("updateGQLSchema", func(m schema.Mutation) resolve.MutationResolver {
 			return resolve.MutationResolverFunc(
 				func(ctx context.Context, m schema.Mutation) (*resolve.Resolved, bool) {
@@ -621,10 +713,11 @@ func generateGQLSchema(sch *gqlSchema) (*schema.Schema, error) {
 	schHandler.DisableSubscription()
 
 	sch.GeneratedSchema = schHandler.GQLSchema()
-	generatedSchema, err := schema.FromString(sch.GeneratedSchema)
+	generatedSchema, err := schema.FromHandler(context.Background(), schHandler)
 	if err != nil {
 		return nil, err
 	}
+	generatedSchema.Freeze()
 
 	return &generatedSchema, nil
 }
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/dgraph-io/dgraph/graphql/resolve"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+func resolveCheckOperations(ctx context.Context, m schema.Mutation) (*resolve.Resolved, bool) {
+	glog.Info("Got checkOperations request through GraphQL admin API")
+
+	input, _ := m.ArgValue("schema").(string)
+	// The proposed schema is only checked.  It's never set in the server's Registry, so its
+	// # Dgraph.Authorization doesn't change how requests to the cluster are authorized.
+	handler, err := schema.NewHandlerCtx(ctx, input)
+	if err != nil {
+		return resolve.EmptyResult(m, err), false
+	}
+	sch, err := schema.FromHandler(ctx, handler)
+	if err != nil {
+		return resolve.EmptyResult(m, err), false
+	}
+
+	// The variables are decoded the way the server decodes those of a request, with numbers
+	// as json.Number, so they are validated the same.
+	operations, _ := m.ArgValue("operations").(string)
+	d := json.NewDecoder(bytes.NewBufferString(operations))
+	d.UseNumber()
+	var saved []schema.SavedOperation
+	if err := d.Decode(&saved); err != nil {
+		return resolve.EmptyResult(m, errors.Wrap(err,
+			"operations must be a JSON array of {name, query, variables} objects")), false
+	}
+
+	breaks := make([]interface{}, 0)
+	for _, report := range schema.CheckOperations(sch, saved) {
+		breaks = append(breaks, map[string]interface{}{
+			"operationName": report.OperationName,
+			"kind":          string(report.Kind),
+			"path":          report.Path,
+			"message":       report.Message,
+		})
+	}
+
+	return &resolve.Resolved{
+		Data:  map[string]interface{}{m.Name(): map[string]interface{}{"breaks": breaks}},
+		Field: m,
+	}, true
+}
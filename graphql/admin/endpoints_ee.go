@@ -363,9 +363,9 @@ const adminTypes = `
 
 	input GroupFilter {
 		name: StringHashFilter
-		and: UserFilter
-		or: UserFilter
-		not: UserFilter
+		and: GroupFilter
+		or: GroupFilter
+		not: GroupFilter
 	}
 
 	input SetGroupPatch {
@@ -447,8 +447,8 @@ const adminMutations = `
 	"""
 	updateGroup(input: UpdateGroupInput!): AddGroupPayload
 
-	deleteGroup(filter: GroupFilter!): DeleteGroupPayload
-	deleteUser(filter: UserFilter!): DeleteUserPayload`
+	deleteGroup(filter: GroupFilter!, allowAll: Boolean): DeleteGroupPayload
+	deleteUser(filter: UserFilter!, allowAll: Boolean): DeleteUserPayload`
 
 const adminQueries = `
 	getUser(name: String!): User
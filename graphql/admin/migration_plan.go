@@ -0,0 +1,51 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dgraph-io/dgraph/graphql/resolve"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/golang/glog"
+)
+
+func resolveMigrationPlan(ctx context.Context, q schema.Query) *resolve.Resolved {
+	glog.Info("Got migrationPlan request through GraphQL admin API")
+
+	oldSchema, _ := q.ArgValue("oldSchema").(string)
+	newSchema, _ := q.ArgValue("newSchema").(string)
+	plan, err := schema.PlanMigration(ctx, oldSchema, newSchema)
+	if err != nil {
+		return resolve.EmptyResult(q, err)
+	}
+
+	b, err := json.Marshal(plan)
+	if err != nil {
+		return resolve.EmptyResult(q, err)
+	}
+	var result map[string]interface{}
+	if err = json.Unmarshal(b, &result); err != nil {
+		return resolve.EmptyResult(q, err)
+	}
+
+	return &resolve.Resolved{
+		Data:  map[string]interface{}{q.Name(): result},
+		Field: q,
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"context"
+
+	"github.com/dgraph-io/dgraph/graphql/resolve"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/golang/glog"
+)
+
+func resolveNormalizeSchema(ctx context.Context, m schema.Mutation) (*resolve.Resolved, bool) {
+	glog.Info("Got normalizeGQLSchema request through GraphQL admin API")
+
+	input, _ := m.ArgValue("schema").(string)
+	normalized, warnings, err := schema.NormalizeSchema(input)
+	if err != nil {
+		return resolve.EmptyResult(m, err), false
+	}
+
+	warningList := make([]interface{}, 0, len(warnings))
+	for _, w := range warnings {
+		warningList = append(warningList, w)
+	}
+
+	return &resolve.Resolved{
+		Data: map[string]interface{}{
+			m.Name(): map[string]interface{}{
+				"normalized": normalized,
+				"warnings":   warningList,
+			}},
+		Field: m,
+	}, true
+}
@@ -72,7 +72,7 @@ func (asr *updateSchemaResolver) Rewrite(
 		return nil, err
 	}
 
-	schHandler, err := schema.NewHandler(input.Set.Schema)
+	schHandler, err := schema.NewHandlerCtx(ctx, input.Set.Schema)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +80,7 @@ func (asr *updateSchemaResolver) Rewrite(
 	schHandler.DisableSubscription()
 
 	asr.generatedSchema = schHandler.GQLSchema()
-	_, err = schema.FromString(asr.generatedSchema)
+	_, err = schema.FromStringCtx(ctx, asr.generatedSchema)
 	if err != nil {
 		return nil, err
 	}
@@ -181,6 +181,11 @@ func doQuery(gql *gqlSchema, field schema.Field) ([]byte, error) {
 			val, err = json.Marshal(gql.Schema)
 		case "generatedSchema":
 			val, err = json.Marshal(gql.GeneratedSchema)
+		case "limits":
+			var limits schema.Limits
+			if limits, err = schema.ParseLimits(gql.Schema); err == nil {
+				val, err = json.Marshal(limits)
+			}
 		}
 		x.Check2(val, err)
 
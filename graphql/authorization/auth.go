@@ -38,18 +38,26 @@ const (
 	AuthJwtCtxKey = ctxKey("authorizationJwt")
 	RSA256        = "RS256"
 	HMAC256       = "HS256"
-)
 
-var (
-	metainfo AuthMeta
+	// authHeaderCtxKeyPrefix prefixes the grpc context metadata keys of the allowed headers.
+	authHeaderCtxKeyPrefix = "authorizationheader-"
+	// httpVariablePrefix prefixes the names of the auth variables for the allowed headers.
+	httpVariablePrefix = "http_"
 )
 
+// headerNameRegex matches the header names that can be allowed as header claims.  They have no
+// '_', so that the names of their auth variables can't clash.
+var headerNameRegex = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
 type AuthMeta struct {
-	PublicKey    string
-	RSAPublicKey *rsa.PublicKey
+	PublicKey    string         `json:"VerificationKey"`
+	RSAPublicKey *rsa.PublicKey `json:"-"`
 	Header       string
 	Namespace    string
 	Algo         string
+	// AllowedHeaderClaims are the request headers whose values auth rules can use, like JWT
+	// claims, as $http.<header> variables.  Any other header is never seen by auth rules.
+	AllowedHeaderClaims []string `json:"allowedHeaderClaims"`
 }
 
 func Parse(schema string) (AuthMeta, error) {
@@ -60,6 +68,16 @@ func Parse(schema string) (AuthMeta, error) {
 	}
 	authInfo := schema[authInfoIdx:]
 
+	// The authorization information can also be given as JSON, which is the only way to give
+	// the allowed header claims.
+	// Example: # Dgraph.Authorization {"VerificationKey":"secretkey","Header":"X-Test-Auth",
+	// "Namespace":"https://xyz.io/jwt/claims","Algo":"HS256","allowedHeaderClaims":["X-Org-Id"]}
+	// (all on one line).
+	jsonInfo := strings.TrimSpace(strings.TrimPrefix(authInfo, "# Dgraph.Authorization"))
+	if strings.HasPrefix(jsonInfo, "{") {
+		return parseJSON(jsonInfo)
+	}
+
 	// This regex matches authorization information present in the last line of the schema.
 	// Format: # Dgraph.Authorization <HTTP header> <Claim namespace> <Algorithm> "<verification key>"
 	// Example: # Dgraph.Authorization X-Test-Auth https://xyz.io/jwt/claims HS256 "secretkey"
@@ -83,44 +101,164 @@ func Parse(schema string) (AuthMeta, error) {
 	meta.Namespace = authInfo[idx[0][6]:idx[0][7]]
 	meta.Algo = authInfo[idx[0][8]:idx[0][9]]
 	meta.PublicKey = authInfo[idx[0][10]:idx[0][11]]
-	if meta.Algo == HMAC256 {
-		return meta, nil
+	return meta, validateAlgo(meta.Algo)
+}
+
+func parseJSON(authInfo string) (AuthMeta, error) {
+	var meta AuthMeta
+	if idx := strings.IndexByte(authInfo, '\n'); idx != -1 {
+		authInfo = authInfo[:idx]
+	}
+	if err := json.Unmarshal([]byte(authInfo), &meta); err != nil {
+		return meta, errors.Errorf("error while parsing jwt authorization info: %v", err)
 	}
 
-	if meta.Algo != RSA256 {
-		return meta, errors.Errorf(
-			"invalid jwt algorithm: found %s, but supported options are HS256 or RS256", meta.Algo)
+	for name, val := range map[string]string{
+		"VerificationKey": meta.PublicKey,
+		"Header":          meta.Header,
+		"Namespace":       meta.Namespace,
+		"Algo":            meta.Algo,
+	} {
+		if val == "" {
+			return meta, errors.Errorf("error while parsing jwt authorization info: "+
+				"%s is required", name)
+		}
 	}
-	return meta, nil
+
+	for i, header := range meta.AllowedHeaderClaims {
+		if !headerNameRegex.MatchString(header) {
+			return meta, errors.Errorf("error while parsing jwt authorization info: `%s` "+
+				"in allowedHeaderClaims isn't a valid header name, it can only have letters, "+
+				"digits and '-'", header)
+		}
+		// Header names are case insensitive, so they are matched in their canonical form.
+		meta.AllowedHeaderClaims[i] = http.CanonicalHeaderKey(header)
+	}
+
+	return meta, validateAlgo(meta.Algo)
 }
 
-func ParseAuthMeta(schema string) error {
-	var err error
-	metainfo, err = Parse(schema)
-	if err != nil {
-		return err
+func validateAlgo(algo string) error {
+	if algo != HMAC256 && algo != RSA256 {
+		return errors.Errorf(
+			"invalid jwt algorithm: found %s, but supported options are HS256 or RS256", algo)
 	}
+	return nil
+}
 
-	if metainfo.Algo != RSA256 {
-		return err
+// NewAuthMeta parses the authorization information in schema, including the RSA public key
+// that tokens are verified with if the algorithm is RS256.  A request only uses the result once
+// it's attached to the request's context with AttachAuthMeta.
+func NewAuthMeta(schema string) (*AuthMeta, error) {
+	meta, err := Parse(schema)
+	if err != nil || meta.Algo != RSA256 {
+		return &meta, err
 	}
 
 	// The jwt library internally uses `bytes.IndexByte(data, '\n')` to fetch new line and fails
 	// if we have newline "\n" as ASCII value {92,110} instead of the actual ASCII value of 10.
 	// To fix this we replace "\n" with new line's ASCII value.
-	bytekey := bytes.ReplaceAll([]byte(metainfo.PublicKey), []byte{92, 110}, []byte{10})
+	bytekey := bytes.ReplaceAll([]byte(meta.PublicKey), []byte{92, 110}, []byte{10})
 
-	metainfo.RSAPublicKey, err = jwt.ParseRSAPublicKeyFromPEM(bytekey)
-	return err
+	meta.RSAPublicKey, err = jwt.ParseRSAPublicKeyFromPEM(bytekey)
+	return &meta, err
 }
 
-func GetHeader() string {
-	return metainfo.Header
+// authMetaCtxKey is the key of the authorization that AttachAuthMeta adds to a context.
+type authMetaCtxKey struct{}
+
+// AttachAuthMeta returns a context in which requests are authorized with meta.  It's how a
+// request for a namespace gets that namespace's JWT header, verification key and allowed header
+// claims.  There's no authorization that requests fall back to: in a context without one, no
+// JWT is accepted and no header is allowed as a claim.
+func AttachAuthMeta(ctx context.Context, meta *AuthMeta) context.Context {
+	if meta == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, authMetaCtxKey{}, meta)
 }
 
-// AttachAuthorizationJwt adds any incoming JWT authorization data into the grpc context metadata.
+// authMetaFrom returns the authorization that requests in ctx are authorized with.
+func authMetaFrom(ctx context.Context) *AuthMeta {
+	if meta, ok := ctx.Value(authMetaCtxKey{}).(*AuthMeta); ok {
+		return meta
+	}
+	return &AuthMeta{}
+}
+
+// GetAuthMeta returns the authorization that requests in ctx are authorized with, or nil if
+// there's none, in a form that AttachAuthMeta can attach to another context.
+func GetAuthMeta(ctx context.Context) *AuthMeta {
+	meta, _ := ctx.Value(authMetaCtxKey{}).(*AuthMeta)
+	return meta
+}
+
+// HeaderFrom returns the header that requests in ctx send their JWT in.
+func HeaderFrom(ctx context.Context) string {
+	return authMetaFrom(ctx).Header
+}
+
+// HTTPVariable returns the name of the auth variable for the value of request header, which auth
+// rules refer to as $http.<header>.  Header names are case insensitive, so all the ways of
+// writing header give the same variable.
+func HTTPVariable(header string) string {
+	return httpVariablePrefix + strings.ReplaceAll(http.CanonicalHeaderKey(header), "-", "_")
+}
+
+// AttachAuthorizationJwt adds any incoming JWT authorization data, and the values of the
+// allowed header claims, into the grpc context metadata.
 func AttachAuthorizationJwt(ctx context.Context, r *http.Request) context.Context {
-	authorizationJwt := r.Header.Get(metainfo.Header)
+	return AttachAllowedHeaders(AttachJwt(ctx, r.Header.Get(HeaderFrom(ctx))), r.Header)
+}
+
+// AttachAllowedHeaders adds the values in header of the allowed header claims into the grpc
+// context metadata.  Headers that aren't allowed are left out, so they can't influence auth.
+func AttachAllowedHeaders(ctx context.Context, header http.Header) context.Context {
+	var md metadata.MD
+	for _, name := range authMetaFrom(ctx).AllowedHeaderClaims {
+		val := header.Get(name)
+		if val == "" {
+			continue
+		}
+		if md == nil {
+			var ok bool
+			if md, ok = metadata.FromIncomingContext(ctx); !ok {
+				md = metadata.New(nil)
+			}
+		}
+		md.Set(authHeaderCtxKeyPrefix+name, val)
+	}
+
+	if md == nil {
+		return ctx
+	}
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+// GetAllowedHeaders returns the values of the allowed header claims in the grpc context metadata
+// of ctx, in a form that AttachAllowedHeaders can attach to another context.
+func GetAllowedHeaders(ctx context.Context) http.Header {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var header http.Header
+	for _, name := range authMetaFrom(ctx).AllowedHeaderClaims {
+		if val := md.Get(authHeaderCtxKeyPrefix + name); len(val) > 0 {
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set(name, val[0])
+		}
+	}
+	return header
+}
+
+// AttachJwt adds the JWT authorization data authorizationJwt into the grpc context metadata.
+// It's for JWTs that don't come in the header of a request, like the one in the connection_init
+// payload of a websocket.
+func AttachJwt(ctx context.Context, authorizationJwt string) context.Context {
 	if authorizationJwt == "" {
 		return ctx
 	}
@@ -138,6 +276,9 @@ func AttachAuthorizationJwt(ctx context.Context, r *http.Request) context.Contex
 type CustomClaims struct {
 	AuthVariables map[string]interface{}
 	jwt.StandardClaims
+
+	// namespace is the claim that the auth variables are in.
+	namespace string
 }
 
 func (c *CustomClaims) UnmarshalJSON(data []byte) error {
@@ -152,7 +293,7 @@ func (c *CustomClaims) UnmarshalJSON(data []byte) error {
 	}
 
 	// Unmarshal the auth variables for a particular namespace.
-	if authValue, ok := result[metainfo.Namespace]; ok {
+	if authValue, ok := result[c.namespace]; ok {
 		if authJson, ok := authValue.(string); ok {
 			if err := json.Unmarshal([]byte(authJson), &c.AuthVariables); err != nil {
 				return err
@@ -164,42 +305,122 @@ func (c *CustomClaims) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// GetJwt returns the JWT authorization data in the grpc context metadata of ctx, or "" if
+// there isn't any.
+func GetJwt(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	jwtToken := md.Get(string(AuthJwtCtxKey))
+	if len(jwtToken) == 0 {
+		return ""
+	}
+	return jwtToken[0]
+}
+
+// authVariablesCtxKey is the key of the auth variables that AttachAuthVariables adds to a
+// context.
+type authVariablesCtxKey struct{}
+
+// AttachAuthVariables returns a context in which ExtractAuthVariables gives vars, rather than
+// verifying the JWT again.  It's for requests made in process on behalf of one whose auth
+// variables were already extracted.
+func AttachAuthVariables(ctx context.Context, vars map[string]interface{}) context.Context {
+	return context.WithValue(ctx, authVariablesCtxKey{}, vars)
+}
+
 func ExtractAuthVariables(ctx context.Context) (map[string]interface{}, error) {
+	if vars, ok := ctx.Value(authVariablesCtxKey{}).(map[string]interface{}); ok {
+		return vars, nil
+	}
+
 	// Extract the jwt and unmarshal the jwt to get the auth variables.
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		return nil, nil
 	}
 
+	var authVariables map[string]interface{}
 	jwtToken := md.Get(string(AuthJwtCtxKey))
-	if len(jwtToken) == 0 {
-		return nil, nil
-	} else if len(jwtToken) > 1 {
+	if len(jwtToken) > 1 {
 		return nil, fmt.Errorf("invalid jwt auth token")
+	} else if len(jwtToken) == 1 {
+		var err error
+		if authVariables, err = validateToken(authMetaFrom(ctx), jwtToken[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	// The allowed headers are auth variables alongside the claims.  A header that wasn't sent
+	// is left out, just like a claim that isn't in the JWT.
+	for name, val := range GetAllowedHeaders(ctx) {
+		if authVariables == nil {
+			authVariables = make(map[string]interface{})
+		}
+		authVariables[HTTPVariable(name)] = val[0]
+	}
+	return authVariables, nil
+}
+
+// ExtractClaim returns the value of the claim name in the JWT of ctx, once the JWT is verified.
+// The claims in the namespace, which are the auth variables, are looked in first, and then the
+// registered claims, like sub and iss.  It returns nil if there's no JWT or it doesn't have the
+// claim.
+func ExtractClaim(ctx context.Context, name string) (interface{}, error) {
+	jwtStr := GetJwt(ctx)
+	if jwtStr == "" {
+		return nil, nil
+	}
+	claims, err := parseClaims(authMetaFrom(ctx), jwtStr)
+	if err != nil {
+		return nil, err
 	}
-	return validateToken(jwtToken[0])
+	if val, ok := claims.AuthVariables[name]; ok {
+		return val, nil
+	}
+
+	b, err := json.Marshal(claims.StandardClaims)
+	if err != nil {
+		return nil, err
+	}
+	var registered map[string]interface{}
+	if err := json.Unmarshal(b, &registered); err != nil {
+		return nil, err
+	}
+	return registered[name], nil
 }
 
-func validateToken(jwtStr string) (map[string]interface{}, error) {
-	if metainfo.Algo == "" {
+func validateToken(meta *AuthMeta, jwtStr string) (map[string]interface{}, error) {
+	claims, err := parseClaims(meta, jwtStr)
+	if err != nil {
+		return nil, err
+	}
+	return claims.AuthVariables, nil
+}
+
+// parseClaims returns the claims of jwtStr, once it's verified that the JWT is signed with the
+// key of meta and hasn't expired.
+func parseClaims(meta *AuthMeta, jwtStr string) (*CustomClaims, error) {
+	if meta.Algo == "" {
 		return nil, fmt.Errorf(
 			"jwt token cannot be validated because verification algorithm is not set")
 	}
 
-	token, err :=
-		jwt.ParseWithClaims(jwtStr, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.ParseWithClaims(jwtStr, &CustomClaims{namespace: meta.Namespace},
+		func(token *jwt.Token) (interface{}, error) {
 			algo, _ := token.Header["alg"].(string)
-			if algo != metainfo.Algo {
+			if algo != meta.Algo {
 				return nil, errors.Errorf("unexpected signing method: Expected %s Found %s",
-					metainfo.Algo, algo)
+					meta.Algo, algo)
 			}
 			if algo == HMAC256 {
 				if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
-					return []byte(metainfo.PublicKey), nil
+					return []byte(meta.PublicKey), nil
 				}
 			} else if algo == RSA256 {
 				if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
-					return metainfo.RSAPublicKey, nil
+					return meta.RSAPublicKey, nil
 				}
 			}
 			return nil, errors.Errorf("couldn't parse signing method from token header: %s", algo)
@@ -221,5 +442,5 @@ func validateToken(jwtStr string) (map[string]interface{}, error) {
 		return nil, errors.Errorf("Token is expired") // the same error msg that's used inside jwt-go
 	}
 
-	return claims.AuthVariables, nil
+	return claims, nil
 }
@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	"github.com/dgraph-io/dgraph/gql"
+	"github.com/dgraph-io/dgraph/protos/pb"
 	"github.com/dgraph-io/dgraph/x"
 )
 
@@ -51,7 +52,16 @@ func writeQuery(b *strings.Builder, query *gql.GraphQuery, prefix string) {
 		x.Check2(b.WriteString(query.Alias))
 		x.Check2(b.WriteString(" : "))
 	}
+	// A count query, like count(Author.posts @filter(...)), counts the edges that pass its
+	// filter, so the filter goes inside the count.
+	if query.IsCount {
+		x.Check2(b.WriteString("count("))
+	}
 	x.Check2(b.WriteString(query.Attr))
+	if len(query.Langs) != 0 {
+		x.Check2(b.WriteRune('@'))
+		x.Check2(b.WriteString(strings.Join(query.Langs, ":")))
+	}
 
 	if query.Func != nil {
 		writeRoot(b, query)
@@ -62,6 +72,15 @@ func writeQuery(b *strings.Builder, query *gql.GraphQuery, prefix string) {
 		writeFilter(b, query.Filter)
 		x.Check2(b.WriteRune(')'))
 	}
+	if query.IsCount {
+		x.Check2(b.WriteRune(')'))
+	}
+
+	if query.Facets != nil {
+		x.Check2(b.WriteString(" @facets("))
+		writeFacets(b, query.Facets)
+		x.Check2(b.WriteRune(')'))
+	}
 
 	if query.Func == nil && hasOrderOrPage(query) {
 		x.Check2(b.WriteString(" ("))
@@ -75,6 +94,17 @@ func writeQuery(b *strings.Builder, query *gql.GraphQuery, prefix string) {
 		}
 	}
 
+	if query.IsGroupby {
+		x.Check2(b.WriteString(" @groupby("))
+		for i, attr := range query.GroupbyAttrs {
+			if i != 0 {
+				x.Check2(b.WriteString(", "))
+			}
+			x.Check2(b.WriteString(attr.Attr))
+		}
+		x.Check2(b.WriteRune(')'))
+	}
+
 	switch {
 	case len(query.Children) > 0:
 		prefixAdd := ""
@@ -139,6 +169,19 @@ func writeRoot(b *strings.Builder, q *gql.GraphQuery) {
 	x.Check2(b.WriteRune(')'))
 }
 
+func writeFacets(b *strings.Builder, facets *pb.FacetParams) {
+	for i, param := range facets.Param {
+		if i > 0 {
+			x.Check2(b.WriteString(", "))
+		}
+		if param.Alias != "" {
+			x.Check2(b.WriteString(param.Alias))
+			x.Check2(b.WriteString(": "))
+		}
+		x.Check2(b.WriteString(param.Key))
+	}
+}
+
 func writeFilterFunction(b *strings.Builder, f *gql.Function) {
 	if f == nil {
 		return
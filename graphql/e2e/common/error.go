@@ -231,11 +231,12 @@ func panicCatcher(t *testing.T) {
 	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
 
 	fns := &resolve.ResolverFns{
-		Qrw: resolve.NewQueryRewriter(),
-		Arw: resolve.NewAddRewriter,
-		Urw: resolve.NewUpdateRewriter,
-		Drw: resolve.NewDeleteRewriter(),
-		Ex:  &panicClient{}}
+		Qrw:  resolve.NewQueryRewriter(),
+		Arw:  resolve.NewAddRewriter,
+		Urw:  resolve.NewUpdateRewriter,
+		Uprw: resolve.NewUpsertRewriter,
+		Drw:  resolve.NewDeleteRewriter(),
+		Ex:   &panicClient{}}
 
 	resolverFactory := resolve.NewResolverFactory(nil, nil).
 		WithConventionResolvers(gqlSchema, fns)
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/dgraph-io/dgraph/graphql/test"
+	"github.com/dgraph-io/dgraph/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that the audit fields are set by the mutation rewriters, from the JWT and the server
+// clock, and that clients can't set them.
+func TestAuditFields(t *testing.T) {
+	sch, err := testutil.AppendAuthInfo([]byte(`
+	type Note {
+		id: ID!
+		text: String!
+		author: String! @createdBy(claim: "sub")
+		createdAt: DateTime! @createdAt
+		updatedAt: DateTime @updatedAt
+		comments: [Comment]
+	}
+
+	type Comment {
+		id: ID!
+		text: String!
+		by: String @createdBy(claim: "USER")
+		createdAt: DateTime @createdAt
+		updatedAt: DateTime @updatedAt
+	}
+	`), authorization.HMAC256, "")
+	require.NoError(t, err)
+
+	authMeta, err := authorization.Parse(string(sch))
+	require.NoError(t, err)
+	gqlSchema := test.LoadSchemaFromString(t, string(sch))
+
+	defer func(now func() time.Time) { auditNow = now }(auditNow)
+	auditNow = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	claims := func(t *testing.T, sub string) context.Context {
+		metaInfo := &testutil.AuthMeta{
+			PublicKey: authMeta.PublicKey,
+			Namespace: authMeta.Namespace,
+			Algo:      authMeta.Algo,
+			AuthVars:  map[string]interface{}{"USER": "user1"},
+			Subject:   sub,
+		}
+		ctx, err := metaInfo.AddClaimsToContext(context.Background())
+		require.NoError(t, err)
+		return ctx
+	}
+
+	tcases := map[string]struct {
+		gqlMutation string
+		rewriter    func() MutationRewriter
+		sub         string
+		setJSON     []string
+		err         string
+	}{
+		"add sets every audit field": {
+			gqlMutation: `mutation {
+				addNote(input: [{text: "A note"}]) { numUids }
+			}`,
+			rewriter: NewAddRewriter,
+			sub:      "alice",
+			setJSON: []string{`{
+				"uid": "_:Note1",
+				"dgraph.type": ["Note"],
+				"Note.text": "A note",
+				"Note.author": "alice",
+				"Note.createdAt": "2020-01-01T00:00:00Z",
+				"Note.updatedAt": "2020-01-01T00:00:00Z"
+			}`},
+		},
+		"deep add sets the audit fields of the nested nodes": {
+			gqlMutation: `mutation {
+				addNote(input: [{text: "A note", comments: [{text: "A comment"}]}]) { numUids }
+			}`,
+			rewriter: NewAddRewriter,
+			sub:      "alice",
+			setJSON: []string{`{
+				"uid": "_:Note1",
+				"dgraph.type": ["Note"],
+				"Note.text": "A note",
+				"Note.author": "alice",
+				"Note.createdAt": "2020-01-01T00:00:00Z",
+				"Note.updatedAt": "2020-01-01T00:00:00Z",
+				"Note.comments": [{
+					"uid": "_:Comment2",
+					"dgraph.type": ["Comment"],
+					"Comment.text": "A comment",
+					"Comment.by": "user1",
+					"Comment.createdAt": "2020-01-01T00:00:00Z",
+					"Comment.updatedAt": "2020-01-01T00:00:00Z"
+				}]
+			}`},
+		},
+		"update only sets updatedAt": {
+			gqlMutation: `mutation {
+				updateNote(input: {filter: {id: ["0x1"]}, set: {text: "Changed"}}) { numUids }
+			}`,
+			rewriter: NewUpdateRewriter,
+			sub:      "bob",
+			setJSON: []string{`{
+				"uid": "uid(x)",
+				"Note.text": "Changed",
+				"Note.updatedAt": "2020-01-01T00:00:00Z"
+			}`},
+		},
+		"update that only removes sets updatedAt": {
+			gqlMutation: `mutation {
+				updateNote(input: {filter: {id: ["0x1"]}, remove: {comments: [{id: "0x2"}]}}) {
+					numUids
+				}
+			}`,
+			rewriter: NewUpdateRewriter,
+			sub:      "bob",
+			setJSON: []string{`{
+				"uid": "uid(x)",
+				"Note.updatedAt": "2020-01-01T00:00:00Z"
+			}`, ""},
+		},
+		"deep add in an update sets every audit field of the new nodes": {
+			gqlMutation: `mutation {
+				updateNote(input: {filter: {id: ["0x1"]}, set: {comments: [{text: "Reply"}]}}) {
+					numUids
+				}
+			}`,
+			rewriter: NewUpdateRewriter,
+			sub:      "bob",
+			setJSON: []string{`{
+				"uid": "uid(x)",
+				"Note.updatedAt": "2020-01-01T00:00:00Z",
+				"Note.comments": [{
+					"uid": "_:Comment2",
+					"dgraph.type": ["Comment"],
+					"Comment.text": "Reply",
+					"Comment.by": "user1",
+					"Comment.createdAt": "2020-01-01T00:00:00Z",
+					"Comment.updatedAt": "2020-01-01T00:00:00Z"
+				}]
+			}`},
+		},
+		"missing claim of a non-null field fails the mutation": {
+			gqlMutation: `mutation {
+				addNote(input: [{text: "A note"}]) { numUids }
+			}`,
+			rewriter: NewAddRewriter,
+			err: "authorization failed: Note.author is set from the sub claim, but the JWT " +
+				"doesn't have it",
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			op, err := gqlSchema.Operation(&schema.Request{Query: tcase.gqlMutation})
+			require.NoError(t, err)
+			mut := test.GetMutation(t, op)
+
+			upserts, err := tcase.rewriter().Rewrite(claims(t, tcase.sub), mut)
+			if tcase.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tcase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, upserts, 1)
+			require.Len(t, upserts[0].Mutations, len(tcase.setJSON))
+			for i, setJSON := range tcase.setJSON {
+				if setJSON == "" {
+					require.Empty(t, upserts[0].Mutations[i].SetJson)
+					continue
+				}
+				require.JSONEq(t, setJSON, string(upserts[0].Mutations[i].SetJson))
+			}
+		})
+	}
+
+	t.Run("clients can't set audit fields", func(t *testing.T) {
+		_, err := gqlSchema.Operation(&schema.Request{Query: `mutation {
+			addNote(input: [{text: "A note", author: "mallory"}]) { numUids }
+		}`})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `Field "author" is not defined by type AddNoteInput`)
+	})
+}
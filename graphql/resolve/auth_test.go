@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
 	"strconv"
 	"strings"
 	"testing"
@@ -33,6 +34,7 @@ import (
 	"github.com/dgraph-io/dgraph/graphql/test"
 	"github.com/dgraph-io/dgraph/testutil"
 	"github.com/dgraph-io/dgraph/x"
+	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/require"
 	_ "github.com/vektah/gqlparser/v2/validator/rules" // make gql validator init() all rules
 	"gopkg.in/yaml.v2"
@@ -160,13 +162,14 @@ func TestStringCustomClaim(t *testing.T) {
 	authSchema, err := testutil.AppendAuthInfo(sch, authorization.HMAC256, "")
 	require.NoError(t, err)
 
-	test.LoadSchemaFromString(t, string(authSchema))
+	gqlSchema := test.LoadSchemaFromString(t, string(authSchema))
 
 	// Token with string custom claim
 	// "https://xyz.io/jwt/claims": "{\"USER\": \"50950b40-262f-4b26-88a7-cbbb780b2176\", \"ROLE\": \"ADMIN\"}",
 	token := "eyJraWQiOiIyRWplN2tIRklLZS92MFRVT3JRYlVJWWJxSWNNUHZ2TFBjM3RSQ25EclBBPSIsImFsZyI6IkhTMjU2In0.eyJzdWIiOiI1MDk1MGI0MC0yNjJmLTRiMjYtODhhNy1jYmJiNzgwYjIxNzYiLCJjb2duaXRvOmdyb3VwcyI6WyJBRE1JTiJdLCJlbWFpbF92ZXJpZmllZCI6dHJ1ZSwiaXNzIjoiaHR0cHM6Ly9jb2duaXRvLWlkcC5hcC1zb3V0aGVhc3QtMi5hbWF6b25hd3MuY29tL2FwLXNvdXRoZWFzdC0yX0dmbWVIZEZ6NCIsImNvZ25pdG86dXNlcm5hbWUiOiI1MDk1MGI0MC0yNjJmLTRiMjYtODhhNy1jYmJiNzgwYjIxNzYiLCJodHRwczovL3h5ei5pby9qd3QvY2xhaW1zIjoie1wiVVNFUlwiOiBcIjUwOTUwYjQwLTI2MmYtNGIyNi04OGE3LWNiYmI3ODBiMjE3NlwiLCBcIlJPTEVcIjogXCJBRE1JTlwifSIsImF1ZCI6IjYzZG8wcTE2bjZlYmpna3VtdTA1a2tlaWFuIiwiZXZlbnRfaWQiOiIzMWM5ZDY4NC0xZDQ1LTQ2ZjctOGMyYi1jYzI3YjFmNmYwMWIiLCJ0b2tlbl91c2UiOiJpZCIsImF1dGhfdGltZSI6MTU5MDMzMzM1NiwibmFtZSI6IkRhdmlkIFBlZWsiLCJleHAiOjk1OTAzNzYwMzIsImlhdCI6MTU5MDM3MjQzMiwiZW1haWwiOiJkYXZpZEB0eXBlam9pbi5jb20ifQ.whgQ9QVMOa0jFYBKhCytlm25-dJiIxcfUFligjav0K0"
 	md := metadata.New(map[string]string{"authorizationJwt": token})
 	ctx := metadata.NewIncomingContext(context.Background(), md)
+	ctx = authorization.AttachAuthMeta(ctx, gqlSchema.AuthMeta())
 
 	authVar, err := authorization.ExtractAuthVariables(ctx)
 	require.NoError(t, err)
@@ -605,3 +608,256 @@ func TestAuthQueryRewriting(t *testing.T) {
 		})
 	}
 }
+
+// Tests that a field with an @auth rule is left out of the Dgraph query when the JWT doesn't
+// satisfy the rule, and that it then completes as null, whatever Dgraph returns for it.
+func TestFieldAuth(t *testing.T) {
+	sch, err := testutil.AppendAuthInfo([]byte(`
+	type Employee {
+		id: ID!
+		name: String! @search(by: [hash])
+		salary: Float @auth(query: { rule: "{ $ROLE: { eq: \"HR\" } }" })
+		ssn: String! @auth(query: { rule: "{ $ROLE: { eq: \"HR\" } }" })
+	}
+	`), authorization.HMAC256, "")
+	require.NoError(t, err)
+
+	authMeta, err := authorization.Parse(string(sch))
+	require.NoError(t, err)
+	metaInfo := &testutil.AuthMeta{
+		PublicKey: authMeta.PublicKey,
+		Namespace: authMeta.Namespace,
+		Algo:      authMeta.Algo,
+	}
+	claimsFor := func(t *testing.T, role string) context.Context {
+		metaInfo.AuthVars = map[string]interface{}{"ROLE": role}
+		ctx, err := metaInfo.AddClaimsToContext(context.Background())
+		require.NoError(t, err)
+		return ctx
+	}
+
+	gqlSchema := test.LoadSchemaFromString(t, string(sch))
+	strictSchema := test.LoadSchemaFromString(t, "# Dgraph.StrictFieldAuth\n"+string(sch))
+	require.False(t, gqlSchema.StrictFieldAuth())
+	require.True(t, strictSchema.StrictFieldAuth())
+
+	rewriting := map[string]struct {
+		role     string
+		gqlQuery string
+		dgQuery  string
+	}{
+		"hidden field isn't queried": {
+			role:     "USER",
+			gqlQuery: `query { queryEmployee { name salary } }`,
+			dgQuery: `query {
+  queryEmployee(func: type(Employee)) {
+    name : Employee.name
+    dgraph.uid : uid
+  }
+}`,
+		},
+		"field is queried when the rule is satisfied": {
+			role:     "HR",
+			gqlQuery: `query { queryEmployee { name salary } }`,
+			dgQuery: `query {
+  queryEmployee(func: type(Employee)) {
+    name : Employee.name
+    salary : Employee.salary
+    dgraph.uid : uid
+  }
+}`,
+		},
+		"only the uid is queried when every field is hidden": {
+			role:     "USER",
+			gqlQuery: `query { queryEmployee { salary } }`,
+			dgQuery: `query {
+  queryEmployee(func: type(Employee)) {
+    dgraph.uid : uid
+  }
+}`,
+		},
+	}
+	for name, tcase := range rewriting {
+		t.Run(name, func(t *testing.T) {
+			op, err := gqlSchema.Operation(&schema.Request{Query: tcase.gqlQuery})
+			require.NoError(t, err)
+			gqlQuery := test.GetQuery(t, op)
+
+			dgQuery, err := NewQueryRewriter().Rewrite(claimsFor(t, tcase.role), gqlQuery)
+			require.NoError(t, err)
+			require.Equal(t, tcase.dgQuery, dgraph.AsString(dgQuery))
+		})
+	}
+
+	salaryQuery := `query {
+		getEmployee(id: "0x1") {
+			name
+			salary
+		}
+	}`
+	ssnQuery := `query {
+		getEmployee(id: "0x1") {
+			name
+			ssn
+		}
+	}`
+	// Dgraph wouldn't return the hidden fields, but even if it did, they aren't given out.
+	dgResponse := `{ "getEmployee": [ { "name": "Alice", "salary": 100.5, "ssn": "123" } ] }`
+
+	resolving := map[string]struct {
+		role     string
+		strict   bool
+		gqlQuery string
+		expected string
+		errors   x.GqlErrorList
+	}{
+		"hidden nullable field is null": {
+			role:     "USER",
+			gqlQuery: salaryQuery,
+			expected: `{ "getEmployee": { "name": "Alice", "salary": null } }`,
+		},
+		"field is completed when the rule is satisfied": {
+			role:     "HR",
+			gqlQuery: salaryQuery,
+			expected: `{ "getEmployee": { "name": "Alice", "salary": 100.5 } }`,
+		},
+		"hidden nullable field is null with an error when strict": {
+			role:     "USER",
+			strict:   true,
+			gqlQuery: salaryQuery,
+			expected: `{ "getEmployee": { "name": "Alice", "salary": null } }`,
+			errors: x.GqlErrorList{&x.GqlError{
+				Message: "Field 'salary' (type Float) is hidden by its @auth rule, " +
+					"the JWT doesn't satisfy it.",
+				Locations: []x.Location{{Line: 4, Column: 4}},
+				Path:      []interface{}{"getEmployee", "salary"}}},
+		},
+		"hidden non-nullable field triggers error propagation": {
+			role:     "USER",
+			gqlQuery: ssnQuery,
+			expected: `{ "getEmployee": null }`,
+			errors: x.GqlErrorList{&x.GqlError{
+				Message: "Field 'ssn' (type String!) is hidden by its @auth rule, " +
+					"the JWT doesn't satisfy it.",
+				Locations: []x.Location{{Line: 4, Column: 4}},
+				Path:      []interface{}{"getEmployee", "ssn"}}},
+		},
+	}
+	for name, tcase := range resolving {
+		t.Run(name, func(t *testing.T) {
+			sch := gqlSchema
+			if tcase.strict {
+				sch = strictSchema
+			}
+			resolver := New(sch,
+				NewResolverFactory(nil, nil).WithConventionResolvers(sch, &ResolverFns{
+					Qrw: NewQueryRewriter(),
+					Ex:  &executor{resp: dgResponse},
+				}))
+
+			resp := resolver.Resolve(claimsFor(t, tcase.role),
+				&schema.Request{Query: tcase.gqlQuery})
+
+			if diff := cmp.Diff(tcase.errors, resp.Errors); diff != "" {
+				t.Errorf("errors mismatch (-want +got):\n%s", diff)
+			}
+			require.JSONEq(t, tcase.expected, resp.Data.String())
+		})
+	}
+}
+
+// Tests that auth rules can use the allowed header claims of a request as $http variables, and
+// that the other headers of the request are never seen by them.
+func TestHTTPVariablesInAuthRules(t *testing.T) {
+	sch := `
+	type Org @auth(query: { rule: "{ $http.X-Org-Id: { eq: \"acme\" } }" }) {
+		id: ID!
+		name: String!
+	}
+
+	type Project @auth(query: { rule: """
+		query($http.x-org-id: String!) {
+			queryProject(filter: { org: { eq: $http.x-org-id } }) { __typename }
+		}""" }) {
+		id: ID!
+		name: String!
+		org: String! @search(by: [hash])
+	}
+
+	type Secret @auth(query: { rule: "{ $http.X-Role: { eq: \"admin\" } }" }) {
+		id: ID!
+		name: String!
+	}
+
+	# Dgraph.Authorization {"VerificationKey":"secretkey","Header":"X-Test-Auth","Namespace":"https://xyz.io/jwt/claims","Algo":"HS256","allowedHeaderClaims":["x-org-id"]}
+	`
+	gqlSchema := test.LoadSchemaFromString(t, sch)
+	require.Equal(t, []string{"X-Org-Id"}, gqlSchema.AuthMeta().AllowedHeaderClaims)
+
+	tcases := map[string]struct {
+		headers  map[string]string
+		gqlQuery string
+		dgQuery  string
+	}{
+		"rbac rule satisfied by a header": {
+			headers:  map[string]string{"x-org-id": "acme"},
+			gqlQuery: `query { queryOrg { name } }`,
+			dgQuery: `query {
+  queryOrg(func: type(Org)) {
+    name : Org.name
+    dgraph.uid : uid
+  }
+}`,
+		},
+		"rbac rule not satisfied by a header": {
+			headers:  map[string]string{"X-Org-Id": "other"},
+			gqlQuery: `query { queryOrg { name } }`,
+			dgQuery: `query {
+  queryOrg()
+}`,
+		},
+		"graph rule uses a header": {
+			headers:  map[string]string{"X-Org-Id": "other"},
+			gqlQuery: `query { queryProject { name } }`,
+			dgQuery: `query {
+  queryProject(func: uid(Project1)) @filter(uid(Project2)) {
+    name : Project.name
+    dgraph.uid : uid
+  }
+  Project1 as var(func: type(Project))
+  Project2 as var(func: uid(Project1)) @filter(eq(Project.org, "other")) @cascade
+}`,
+		},
+		"missing header is like a missing claim": {
+			gqlQuery: `query { queryProject { name } }`,
+			dgQuery: `query {
+  queryProject()
+}`,
+		},
+		"header that isn't allowed is ignored": {
+			headers:  map[string]string{"X-Role": "admin"},
+			gqlQuery: `query { querySecret { name } }`,
+			dgQuery: `query {
+  querySecret()
+}`,
+		},
+	}
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			r := &http.Request{Header: make(http.Header)}
+			for k, v := range tcase.headers {
+				r.Header.Set(k, v)
+			}
+			ctx := authorization.AttachAuthMeta(context.Background(), gqlSchema.AuthMeta())
+			ctx = authorization.AttachAuthorizationJwt(ctx, r)
+
+			op, err := gqlSchema.Operation(&schema.Request{Query: tcase.gqlQuery})
+			require.NoError(t, err)
+			gqlQuery := test.GetQuery(t, op)
+
+			dgQuery, err := NewQueryRewriter().Rewrite(ctx, gqlQuery)
+			require.NoError(t, err)
+			require.Equal(t, tcase.dgQuery, dgraph.AsString(dgQuery))
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/dgraph/graphql/test"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that @custom requests to dgraph://self are resolved by the same GraphQL API, including
+// a loopback request for a query that itself makes a loopback request.
+func TestLoopbackCustomQueries(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+	}
+
+	type Query {
+		author(id: ID!): Author @custom(http: {
+			url: "dgraph://self",
+			method: "POST",
+			graphql: "query($id: ID!) { getAuthor(id: $id) }"
+		})
+		authorOfAuthor(id: ID!): Author @custom(http: {
+			url: "dgraph://self",
+			method: "POST",
+			graphql: "query($id: ID!) { author(id: $id) }"
+		})
+	}`
+	query := `query { authorOfAuthor(id: "0x1") { name } }`
+	ex := &executor{resp: `{ "getAuthor": [ { "name": "A.N. Author" } ] }`}
+
+	t.Run("nested loopback requests", func(t *testing.T) {
+		resp := resolveWithClient(test.LoadSchemaFromString(t, sch), query, nil, ex)
+		require.Nil(t, resp.Errors)
+		require.JSONEq(t, `{ "authorOfAuthor": { "name": "A.N. Author" } }`,
+			resp.Data.String())
+	})
+
+	t.Run("nesting deeper than maxLoopbackDepth", func(t *testing.T) {
+		limited := test.LoadSchemaFromString(t, "# Dgraph.Limits {\"maxLoopbackDepth\": 1}\n"+sch)
+		resp := resolveWithClient(limited, query, nil, ex)
+		require.Error(t, resp.Errors)
+		require.Contains(t, resp.Errors.Error(),
+			"loopback requests can't be nested more than 1 deep")
+		require.JSONEq(t, `{ "authorOfAuthor": null }`, resp.Data.String())
+	})
+}
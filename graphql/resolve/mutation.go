@@ -191,7 +191,7 @@ func (mr *dgraphResolver) Resolve(ctx context.Context, m schema.Mutation) (*Reso
 
 func getNumUids(m schema.Mutation, a map[string]string, r map[string]interface{}) int {
 	switch m.MutationType() {
-	case schema.AddMutation:
+	case schema.AddMutation, schema.UpsertMutation:
 		return len(a)
 	default:
 		mutated := extractMutated(r, m.Name())
@@ -298,6 +298,22 @@ func (mr *dgraphResolver) rewriteAndExecute(ctx context.Context,
 	}
 	commit = true
 
+	numUids := getNumUids(mutation, mutResp.Uids, result)
+
+	// Nothing but the mutation's metadata is asked for, so that's the whole payload and the
+	// query for the mutated nodes isn't run.  The mutation was committed, and has the errors,
+	// as if the nodes were asked for.  Anything else in the payload, like msg for a delete, is
+	// added by the result completion.
+	if mutation.SelectsOnlyMutationMetadata() {
+		return &Resolved{
+			Data: map[string]interface{}{
+				mutation.Name(): map[string]interface{}{schema.NumUid: numUids}},
+			Field:      mutation,
+			Err:        errs,
+			Extensions: ext,
+		}, resolverSucceeded
+	}
+
 	queryTimer := newtimer(ctx, &dgraphQueryDuration.OffsetDuration)
 	queryTimer.Start()
 	qryResp, err := mr.executor.Execute(ctx, &dgoapi.Request{Query: dgraph.AsString(dgQuery),
@@ -308,7 +324,6 @@ func (mr *dgraphResolver) rewriteAndExecute(ctx context.Context,
 		"couldn't rewrite query for mutation %s", mutation.Name()))
 
 	ext.TouchedUids += qryResp.GetMetrics().GetNumUids()[touchedUidsKey]
-	numUids := getNumUids(mutation, mutResp.Uids, result)
 
 	resolved := completeDgraphResult(ctx, mutation.QueryField(), qryResp.GetJson(), errs)
 	if resolved.Data == nil && resolved.Err != nil {
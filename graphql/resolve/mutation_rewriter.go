@@ -24,11 +24,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
 	"github.com/dgraph-io/dgraph/gql"
 	"github.com/dgraph-io/dgraph/graphql/authorization"
 	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/dgraph-io/dgraph/types"
 	"github.com/dgraph-io/dgraph/x"
 
 	"github.com/pkg/errors"
@@ -41,7 +43,8 @@ const (
 )
 
 type AddRewriter struct {
-	frags [][]*mutationFragment
+	frags  [][]*mutationFragment
+	upsert bool
 }
 type UpdateRewriter struct {
 	setFrags []*mutationFragment
@@ -78,6 +81,15 @@ type xidMetadata struct {
 	seenAtTopLevel map[string]bool
 	// queryExists tells whether the query part in upsert has already been created for xidVariable
 	queryExists map[string]bool
+	// deepUpdate tells whether references to existing nodes that also carry other fields should
+	// update those fields on the referenced node
+	deepUpdate bool
+	// upsert tells whether a top level node whose xid is already in use is updated, rather than
+	// failing the mutation
+	upsert bool
+	// compositeKeys tells which values of the composite keys of each type the new nodes of the
+	// mutation have
+	compositeKeys map[string]bool
 }
 
 // A mutationBuilder can build a json mutation []byte from a mutationFragment
@@ -133,6 +145,11 @@ func NewAddRewriter() MutationRewriter {
 	return &AddRewriter{}
 }
 
+// NewUpsertRewriter returns new MutationRewriter for upsert mutations.
+func NewUpsertRewriter() MutationRewriter {
+	return &AddRewriter{upsert: true}
+}
+
 // NewUpdateRewriter returns new MutationRewriter for add & update mutations.
 func NewUpdateRewriter() MutationRewriter {
 	return &UpdateRewriter{}
@@ -149,6 +166,7 @@ func newXidMetadata() *xidMetadata {
 		variableObjMap: make(map[string]interface{}),
 		seenAtTopLevel: make(map[string]bool),
 		queryExists:    make(map[string]bool),
+		compositeKeys:  make(map[string]bool),
 	}
 }
 
@@ -229,12 +247,23 @@ func newXidMetadata() *xidMetadata {
 //   } ],
 //   "Author.friends":[ {"uid":"0x123"} ],
 // }
+//
+// An upsert mutation is rewritten the same way, and then each input gets a copy of its
+// mutations that update the node with its @id value, if there is one.  See rewriteUpsertObject.
 func (mrw *AddRewriter) Rewrite(ctx context.Context, m schema.Mutation) ([]*UpsertMutation, error) {
+	ctx = withAuthMeta(ctx, m.Operation())
 	mutatedType := m.MutatedType()
 	val, _ := m.ArgValue(schema.InputArgName).([]interface{})
+	if err := checkNotExpired(m, val); err != nil {
+		return nil, err
+	}
+	if err := checkMutationNodes(m, len(val), val); err != nil {
+		return nil, err
+	}
 
 	varGen := NewVariableGenerator()
 	xidMd := newXidMetadata()
+	xidMd.upsert = mrw.upsert
 	var errs error
 
 	mutationsAllSec := []*dgoapi.Mutation{}
@@ -269,9 +298,16 @@ func (mrw *AddRewriter) Rewrite(ctx context.Context, m schema.Mutation) ([]*Upse
 		return mutationsAll
 	}
 
-	for _, i := range val {
+	for idx, i := range val {
 		obj := i.(map[string]interface{})
-		frag := rewriteObject(ctx, mutatedType, nil, "", varGen, true, obj, 0, xidMd)
+		var frag *mutationRes
+		if mrw.upsert {
+			frag = rewriteUpsertObject(ctx, mutatedType, varGen, obj,
+				fmt.Sprintf("input[%d]", idx), xidMd)
+		} else {
+			frag = rewriteObject(ctx, mutatedType, nil, "", varGen, true, obj,
+				fmt.Sprintf("input[%d]", idx), 0, xidMd)
+		}
 		mrw.frags = append(mrw.frags, frag.secondPass)
 
 		mutationsAll = buildMutations(mutationsAll, queries, frag.firstPass)
@@ -310,6 +346,9 @@ func (mrw *AddRewriter) Rewrite(ctx context.Context, m schema.Mutation) ([]*Upse
 		})
 	}
 
+	if err := checkMutationBytes(m, result); err != nil {
+		return nil, err
+	}
 	return result, errs
 }
 
@@ -320,6 +359,7 @@ func (mrw *AddRewriter) FromMutationResult(
 	assigned map[string]string,
 	result map[string]interface{}) (*gql.GraphQuery, error) {
 
+	ctx = withAuthMeta(ctx, mutation.Operation())
 	var errs error
 
 	uids := make([]uint64, 0)
@@ -334,6 +374,10 @@ func (mrw *AddRewriter) FromMutationResult(
 		node := strings.TrimPrefix(frag[0].
 			fragment.(map[string]interface{})["uid"].(string), "_:")
 		val, ok := assigned[node]
+		if !ok && mrw.upsert {
+			// The upsert didn't add the node, so it updated the one that has its @id value.
+			val, ok = queriedUID(result, strings.TrimSuffix(strings.TrimPrefix(node, "uid("), ")"))
+		}
 		if !ok {
 			continue
 		}
@@ -348,10 +392,9 @@ func (mrw *AddRewriter) FromMutationResult(
 		uids = append(uids, uid)
 	}
 
-	if len(assigned) == 0 && errs == nil {
+	if len(assigned) == 0 && errs == nil && !mrw.upsert {
 		errs = schema.AsGQLErrors(errors.Errorf("no new node was created"))
 	}
-
 	authVariables, err := authorization.ExtractAuthVariables(ctx)
 	if err != nil {
 		return nil, err
@@ -390,6 +433,7 @@ func (urw *UpdateRewriter) Rewrite(
 	ctx context.Context,
 	m schema.Mutation) ([]*UpsertMutation, error) {
 
+	ctx = withAuthMeta(ctx, m.Operation())
 	mutatedType := m.MutatedType()
 
 	inp := m.ArgValue(schema.InputArgName).(map[string]interface{})
@@ -399,6 +443,18 @@ func (urw *UpdateRewriter) Rewrite(
 	if setArg == nil && delArg == nil {
 		return nil, nil
 	}
+	if err := checkNotExpired(m, []interface{}{setArg}); err != nil {
+		return nil, err
+	}
+	// The nodes that the filter finds are updated, not added or linked to, so they aren't
+	// counted.
+	if err := checkMutationNodes(m, 0, []interface{}{setArg, delArg}); err != nil {
+		return nil, err
+	}
+	// Removing values still updates the nodes, so their @updatedAt fields are set.
+	if setArg == nil && hasUpdatedAt(mutatedType) {
+		setArg = map[string]interface{}{}
+	}
 
 	varGen := NewVariableGenerator()
 
@@ -416,6 +472,7 @@ func (urw *UpdateRewriter) Rewrite(
 	srcUID := MutationQueryVarUID
 
 	xidMd := newXidMetadata()
+	xidMd.deepUpdate, _ = inp["deepUpdate"].(bool)
 	var errs error
 
 	buildMutation := func(setFrag, delFrag []*mutationFragment) *UpsertMutation {
@@ -486,7 +543,7 @@ func (urw *UpdateRewriter) Rewrite(
 
 	if setArg != nil {
 		setFrag := rewriteObject(ctx, mutatedType, nil, srcUID, varGen, true,
-			setArg.(map[string]interface{}), 0, xidMd)
+			setArg.(map[string]interface{}), "set", 0, xidMd)
 
 		setFragF = setFrag.firstPass
 		setFragS = setFrag.secondPass
@@ -494,7 +551,7 @@ func (urw *UpdateRewriter) Rewrite(
 
 	if delArg != nil {
 		delFrag := rewriteObject(ctx, mutatedType, nil, srcUID, varGen, false,
-			delArg.(map[string]interface{}), 0, xidMd)
+			delArg.(map[string]interface{}), "remove", 0, xidMd)
 		delFragF = delFrag.firstPass
 		delFragS = delFrag.secondPass
 	}
@@ -511,6 +568,9 @@ func (urw *UpdateRewriter) Rewrite(
 		result = append(result, secondPass)
 	}
 
+	if err := checkMutationBytes(m, result); err != nil {
+		return nil, err
+	}
 	return result, schema.GQLWrapf(errs, "failed to rewrite mutation payload")
 }
 
@@ -521,6 +581,7 @@ func (urw *UpdateRewriter) FromMutationResult(
 	assigned map[string]string,
 	result map[string]interface{}) (*gql.GraphQuery, error) {
 
+	ctx = withAuthMeta(ctx, mutation.Operation())
 	err := checkResult(urw.setFrags, result)
 	if err != nil {
 		return nil, err
@@ -529,7 +590,6 @@ func (urw *UpdateRewriter) FromMutationResult(
 	if err != nil {
 		return nil, err
 	}
-
 	mutated := extractMutated(result, mutation.Name())
 
 	var uids []uint64
@@ -604,6 +664,199 @@ func checkResult(frags []*mutationFragment, result map[string]interface{}) error
 	return err
 }
 
+// checkNotExpired returns an error if any of objs, the input objects of m, or the objects nested
+// anywhere in them, sets the @ttl field of its type to a time that has already passed, unless m
+// has allowExpired: true.
+func checkNotExpired(m schema.Mutation, objs []interface{}) error {
+	if allowExpired, _ := m.ArgValue("allowExpired").(bool); allowExpired {
+		return nil
+	}
+
+	now := ttlNow()
+	for _, obj := range objs {
+		if obj, ok := obj.(map[string]interface{}); ok {
+			if err := checkObjectNotExpired(m.MutatedType(), obj, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkObjectNotExpired returns an error if obj, an input object for typ, or the objects nested
+// in it, like countNestedNodes walks them, sets the @ttl field of its type to a time before now.
+func checkObjectNotExpired(typ schema.Type, obj map[string]interface{}, now time.Time) error {
+	if ttlField := typ.TTLField(); ttlField != nil {
+		if val, ok := obj[ttlField.Name()].(string); ok {
+			// A value that isn't a valid DateTime is rejected when it's stored.
+			t, err := types.ParseTime(val)
+			if err == nil && t.Before(now) {
+				return errors.Errorf("%s %s is in the past, so the %s would have already "+
+					"expired; pass allowExpired: true", ttlField.Name(), val, typ.Name())
+			}
+		}
+	}
+
+	for field, val := range obj {
+		switch val := val.(type) {
+		case map[string]interface{}:
+			if err := checkObjectNotExpired(typ.Field(field).Type(), val, now); err != nil {
+				return err
+			}
+		case []interface{}:
+			fieldDef := typ.Field(field)
+			if fieldDef.HasLangDirective() {
+				continue
+			}
+			for _, v := range val {
+				if v, ok := v.(map[string]interface{}); ok {
+					if err := checkObjectNotExpired(fieldDef.Type(), v, now); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkMutationNodes returns an error if m adds or links to more nodes than the schema's
+// maxMutationNodes allows.  That's the top nodes, plus the nodes of the objects nested
+// anywhere in objs, the input objects of m.  It's checked before m is rewritten, so that
+// a huge mutation is turned away without doing the work of rewriting it.
+func checkMutationNodes(m schema.Mutation, top int, objs []interface{}) error {
+	limit := m.Operation().Schema().Limits().MaxMutationNodes
+	if limit == 0 {
+		return nil
+	}
+
+	nodes := top
+	for _, obj := range objs {
+		if obj, ok := obj.(map[string]interface{}); ok {
+			nodes += countNestedNodes(m.MutatedType(), obj)
+		}
+	}
+	if nodes > limit {
+		return x.GqlErrorf("mutation %s adds or links to %d nodes, but the schema limits a "+
+			"mutation to %d nodes with maxMutationNodes", m.Name(), nodes, limit)
+	}
+	return nil
+}
+
+// countNestedNodes returns how many nodes the objects nested in obj, an input object for typ,
+// add or link to.  The values of a @lang field are objects too, but they aren't nodes.
+func countNestedNodes(typ schema.Type, obj map[string]interface{}) int {
+	nodes := 0
+	for field, val := range obj {
+		switch val := val.(type) {
+		case map[string]interface{}:
+			nodes += 1 + countNestedNodes(typ.Field(field).Type(), val)
+		case []interface{}:
+			fieldDef := typ.Field(field)
+			if fieldDef.HasLangDirective() {
+				continue
+			}
+			for _, v := range val {
+				if v, ok := v.(map[string]interface{}); ok {
+					nodes += 1 + countNestedNodes(fieldDef.Type(), v)
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// checkMutationBytes returns an error if the Dgraph mutations that m is rewritten into, upserts,
+// are more bytes of JSON than the schema's maxRequestBytes allows.
+func checkMutationBytes(m schema.Mutation, upserts []*UpsertMutation) error {
+	limit := m.Operation().Schema().Limits().MaxRequestBytes
+	if limit == 0 {
+		return nil
+	}
+
+	size := 0
+	for _, upsert := range upserts {
+		for _, mut := range upsert.Mutations {
+			size += len(mut.SetJson) + len(mut.DeleteJson)
+		}
+	}
+	if size > limit {
+		return x.GqlErrorf("mutation %s sends %d bytes of mutations to Dgraph, but the schema "+
+			"limits a mutation to %d bytes with maxRequestBytes", m.Name(), size, limit)
+	}
+	return nil
+}
+
+// hasUpdatedAt returns true if typ has an @updatedAt field.
+func hasUpdatedAt(typ schema.Type) bool {
+	for _, fld := range typ.AuditFields() {
+		if kind, _ := fld.Audit(); kind == schema.UpdatedAt {
+			return true
+		}
+	}
+	return false
+}
+
+// auditNow is the time that @createdAt and @updatedAt fields are set to.  Tests replace it to get
+// predictable mutations.
+var auditNow = time.Now
+
+// addAuditValues sets the audit fields of typ in obj, the Dgraph JSON of a node that's being
+// added, or updated if adding is false.  An added node gets all of them, but an updated node
+// only gets its @updatedAt fields, so that who created it and when can't change.  A @createdBy
+// field is set from a claim of the verified JWT; it's an authorization error for the claim to be
+// missing if the field is non-null.
+func addAuditValues(ctx context.Context, typ schema.Type, obj map[string]interface{},
+	adding bool) error {
+
+	now := auditNow().UTC().Format(time.RFC3339)
+	for _, fld := range typ.AuditFields() {
+		kind, claim := fld.Audit()
+		if !adding && kind != schema.UpdatedAt {
+			continue
+		}
+
+		pred := typ.DgraphPredicate(fld.Name())
+		if strings.HasPrefix(pred, "<") && strings.HasSuffix(pred, ">") {
+			pred = pred[1 : len(pred)-1]
+		}
+		if kind != schema.CreatedBy {
+			obj[pred] = now
+			continue
+		}
+
+		val, err := authorization.ExtractClaim(ctx, claim)
+		if err != nil {
+			return schema.GQLWrapf(err, "authorization failed")
+		}
+		switch val := val.(type) {
+		case nil:
+			if !fld.Type().Nullable() {
+				return x.GqlErrorf("authorization failed: %s.%s is set from the %s claim, "+
+					"but the JWT doesn't have it", typ.Name(), fld.Name(), claim)
+			}
+		case string:
+			obj[pred] = val
+		default:
+			return x.GqlErrorf("authorization failed: %s.%s is set from the %s claim, "+
+				"but it isn't a string", typ.Name(), fld.Name(), claim)
+		}
+	}
+	return nil
+}
+
+// addDefaultValues sets the @default fields of typ that obj, the input for a node that's being
+// added, doesn't have a value for in newObj, the node's Dgraph JSON.
+func addDefaultValues(typ schema.Type, obj, newObj map[string]interface{}) {
+	for _, fld := range typ.DefaultFields() {
+		if obj[fld.Name()] != nil {
+			continue
+		}
+		pred := strings.Trim(typ.DgraphPredicate(fld.Name()), "<>")
+		newObj[pred] = fld.Default()
+	}
+}
+
 func extractFilter(m schema.Mutation) map[string]interface{} {
 	var filter map[string]interface{}
 	mutationType := m.MutationType()
@@ -626,13 +879,13 @@ func RewriteUpsertQueryFromMutation(m schema.Mutation, authRw *authRewriter) *gq
 	}
 
 	if m.MutatedType().InterfaceImplHasAuthRules() {
-		dgQuery.Attr = m.ResponseName() + "()"
+		dgQuery.Attr = m.Name() + "()"
 		return dgQuery
 	}
 
 	rbac := authRw.evaluateStaticRules(m.MutatedType())
 	if rbac == schema.Negative {
-		dgQuery.Attr = m.ResponseName() + "()"
+		dgQuery.Attr = m.Name() + "()"
 		return dgQuery
 	}
 	// Add uid child to the upsert query, so that we can get the list of nodes upserted.
@@ -644,7 +897,7 @@ func RewriteUpsertQueryFromMutation(m schema.Mutation, authRw *authRewriter) *gq
 	if ids := idFilter(m, m.MutatedType().IDField()); ids != nil {
 		addUIDFunc(dgQuery, ids)
 	} else {
-		addTypeFunc(dgQuery, m.MutatedType().DgraphName())
+		addTypeFunc(dgQuery, m.MutatedType())
 	}
 
 	filter := extractFilter(m)
@@ -657,41 +910,34 @@ func RewriteUpsertQueryFromMutation(m schema.Mutation, authRw *authRewriter) *gq
 	return dgQuery
 }
 
-func (drw *deleteRewriter) Rewrite(
-	ctx context.Context,
-	m schema.Mutation) ([]*UpsertMutation, error) {
-
-	if m.MutationType() != schema.DeleteMutation {
-		return nil, errors.Errorf(
-			"(internal error) call to build delete mutation for %s mutation type",
-			m.MutationType())
-	}
-
-	varGen := NewVariableGenerator()
-
-	authVariables, err := authorization.ExtractAuthVariables(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	authRw := &authRewriter{
-		authVariables: authVariables,
-		varGen:        varGen,
-		selector:      deleteAuthSelector,
-	}
-
-	dgQry := RewriteUpsertQueryFromMutation(m, authRw)
-	qry := dgQry
-	if qry.Attr == "" {
-		// Auth queries must have been added to the query, first query is the actual delete
-		qry = dgQry.Children[0]
+// isEmptyFilter returns true if filter doesn't restrict the nodes it matches at all, so that a
+// delete with it would delete every node of the type.  That's the case for {}, and also for
+// degenerate compositions, like { and: {} } or { or: {}, not: {} }, that buildFilter doesn't
+// turn into any Dgraph filter.
+func isEmptyFilter(filter map[string]interface{}) bool {
+	for key, val := range filter {
+		switch key {
+		case "and", "or", "not":
+			if f, _ := val.(map[string]interface{}); !isEmptyFilter(f) {
+				return false
+			}
+		default:
+			if f, ok := val.(map[string]interface{}); val != nil && (!ok || len(f) > 0) {
+				return false
+			}
+		}
 	}
+	return true
+}
 
-	deletes := []interface{}{map[string]interface{}{"uid": "uid(x)"}}
+// deleteInverseEdges returns the deletes of the edges into the nodes of typ that qry finds as x,
+// which are being deleted, from the nodes they link to with @hasInverse or reverse edges.  It
+// adds the queries for those nodes to qry.
+func deleteInverseEdges(qry *gql.GraphQuery, typ schema.Type,
+	varGen *VariableGenerator) []interface{} {
 
-	// we need to delete this node with ^^ and then any reference we know about
-	// (via @hasInverse) into this node.
-	for _, fld := range m.MutatedType().Fields() {
+	var deletes []interface{}
+	for _, fld := range typ.Fields() {
 		invField := fld.Inverse()
 		if invField == nil {
 			// This field be a reverse edge, in that case we need to delete the incoming connections
@@ -723,6 +969,52 @@ func (drw *deleteRewriter) Rewrite(
 					delFldName: []interface{}{del}})
 		}
 	}
+	return deletes
+}
+
+func (drw *deleteRewriter) Rewrite(
+	ctx context.Context,
+	m schema.Mutation) ([]*UpsertMutation, error) {
+
+	ctx = withAuthMeta(ctx, m.Operation())
+
+	if m.MutationType() != schema.DeleteMutation {
+		return nil, errors.Errorf(
+			"(internal error) call to build delete mutation for %s mutation type",
+			m.MutationType())
+	}
+
+	if allowAll, _ := m.ArgValue("allowAll").(bool); !allowAll &&
+		isEmptyFilter(extractFilter(m)) {
+		return nil, errors.Errorf("refusing to delete all nodes of type %s; pass allowAll: true",
+			m.MutatedType().Name())
+	}
+
+	varGen := NewVariableGenerator()
+
+	authVariables, err := authorization.ExtractAuthVariables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	authRw := &authRewriter{
+		authVariables: authVariables,
+		varGen:        varGen,
+		selector:      deleteAuthSelector,
+	}
+
+	dgQry := RewriteUpsertQueryFromMutation(m, authRw)
+	qry := dgQry
+	if qry.Attr == "" {
+		// Auth queries must have been added to the query, first query is the actual delete
+		qry = dgQry.Children[0]
+	}
+
+	deletes := []interface{}{map[string]interface{}{"uid": "uid(x)"}}
+
+	// we need to delete this node with ^^ and then any reference we know about
+	// (via @hasInverse) into this node.
+	deletes = append(deletes, deleteInverseEdges(qry, m.MutatedType(), varGen)...)
 
 	b, err := json.Marshal(deletes)
 
@@ -868,6 +1160,9 @@ type mutationRes struct {
 // building mutations recursively in the secondPass. Whenever we encounter an XID object,
 // we push it to firstPass. We need to make sure that the XID doesn't refer hasInverse links
 // to secondPass, and then to make those links ourselves.
+//
+// path is where obj sits in the mutation input, e.g. set.posts[0], and is used to report
+// errors against nested objects.
 func rewriteObject(
 	ctx context.Context,
 	typ schema.Type,
@@ -876,21 +1171,34 @@ func rewriteObject(
 	varGen *VariableGenerator,
 	withAdditionalDeletes bool,
 	obj map[string]interface{},
+	path string,
 	deepXID int,
 	xidMetadata *xidMetadata) *mutationRes {
 
 	atTopLevel := srcField == nil
 	topLevelAdd := srcUID == ""
 
+	if !atTopLevel {
+		if err := checkReference(typ, obj, path, withAdditionalDeletes); err != nil {
+			errFrag := newFragment(nil)
+			errFrag.err = err
+			return &mutationRes{secondPass: []*mutationFragment{errFrag}}
+		}
+	}
+
 	variable := varGen.Next(typ, "", "")
 
 	id := typ.IDField()
 	if id != nil {
 		if idVal, ok := obj[id.Name()]; ok {
 			if idVal != nil {
-				return &mutationRes{secondPass: []*mutationFragment{
-					asIDReference(ctx, idVal, srcField, srcUID, variable,
-						withAdditionalDeletes, varGen)}}
+				ref := asIDReference(ctx, idVal, srcField, srcUID, variable,
+					withAdditionalDeletes, varGen)
+				if xidMetadata.deepUpdate && withAdditionalDeletes {
+					return deepUpdateReference(ctx, typ, ref, variable, path, varGen,
+						referencePatch(typ, srcField, obj, false), xidMetadata)
+				}
+				return &mutationRes{secondPass: []*mutationFragment{ref}}
 			}
 			delete(obj, id.Name())
 		}
@@ -944,6 +1252,17 @@ func rewriteObject(
 		deepXID += 1
 	}
 
+	// With deepUpdate, an existing node referenced by its XID also gets the scalar fields
+	// in obj.  Its nested objects are already rewritten as part of adding the node if it
+	// doesn't exist, so only an object seen for the first time is patched.
+	patchXIDReference := func(ref *mutationFragment) *mutationFragment {
+		if !xidMetadata.deepUpdate || !withAdditionalDeletes || !xidEncounteredFirstTime {
+			return ref
+		}
+		return deepUpdateReference(ctx, typ, ref, variable, path, varGen,
+			referencePatch(typ, srcField, obj, true), xidMetadata).secondPass[0]
+	}
+
 	var parentFrags []*mutationFragment
 
 	if !atTopLevel { // top level is never a reference - it's adding/updating
@@ -985,7 +1304,11 @@ func rewriteObject(
 		if err := typ.EnsureNonNulls(obj, exclude); err != nil {
 			// This object is either an invalid deep mutation or it's an xid reference
 			// and asXIDReference must to apply or it's an error.
-			return &mutationRes{secondPass: invalidObjectFragment(err, xidFrag, variable, xidString)}
+			frags := invalidObjectFragment(err, xidFrag, variable, xidString)
+			if xidFrag != nil {
+				frags[0] = patchXIDReference(frags[0])
+			}
+			return &mutationRes{secondPass: frags}
 		}
 	}
 
@@ -1002,9 +1325,23 @@ func rewriteObject(
 	var myUID string
 	newObj := make(map[string]interface{}, len(obj))
 
+	// The audit values are set, not removed, so they only go in the set JSON.
+	if withAdditionalDeletes {
+		if err := addAuditValues(ctx, typ, newObj, !atTopLevel || topLevelAdd); err != nil {
+			errFrag := newFragment(nil)
+			errFrag.err = err
+			return &mutationRes{secondPass: []*mutationFragment{errFrag}}
+		}
+	}
+
 	if !atTopLevel || topLevelAdd {
+		if withAdditionalDeletes {
+			addDefaultValues(typ, obj, newObj)
+		}
+
 		dgraphTypes := []string{typ.DgraphName()}
 		dgraphTypes = append(dgraphTypes, typ.Interfaces()...)
+		dgraphTypes = append(dgraphTypes, typ.Unions()...)
 		newObj["dgraph.type"] = dgraphTypes
 		myUID = fmt.Sprintf("_:%s", variable)
 
@@ -1031,17 +1368,26 @@ func rewriteObject(
 			xidMetadata.queryExists[variable] = true
 		}
 		frag.conditions = []string{fmt.Sprintf("eq(len(%s), 0)", variable)}
-		frag.check = checkQueryResult(variable,
-			x.GqlErrorf("id %s already exists for type %s", xidString, typ.Name()),
-			nil)
+		// An upsert updates a top level node whose xid is in use, see rewriteUpsertObject.
+		if !atTopLevel || !xidMetadata.upsert {
+			frag.check = checkQueryResult(variable,
+				x.GqlErrorf("id %s already exists for type %s", xidString, typ.Name()),
+				nil)
+		}
+	}
+
+	if (!atTopLevel || topLevelAdd) && (xidString == "" || xidEncounteredFirstTime) {
+		if err := addCompositeKeyChecks(frag, typ, obj, varGen, xidMetadata); err != nil {
+			errFrag := newFragment(nil)
+			errFrag.err = err
+			return &mutationRes{secondPass: []*mutationFragment{errFrag}}
+		}
 	}
 
 	if xid != nil && !atTopLevel {
 		if deepXID <= 2 { // elements in firstPass or not
 			// duplicate query in elements >= 2, as the pair firstPass element would already have the same query.
-			frag.queries = []*gql.GraphQuery{
-				xidQuery(variable, xidString, xid.Name(), typ),
-			}
+			frag.queries = append(frag.queries, xidQuery(variable, xidString, xid.Name(), typ))
 		} else {
 			// We need to link the parent to the element we are just creating
 			res := make(map[string]interface{}, 1)
@@ -1080,6 +1426,32 @@ func rewriteObject(
 				fieldName = fieldName[1 : len(fieldName)-1]
 			}
 
+			// A @lang field is given as a list of (value, lang) pairs, e.g.
+			// { "name": [ { "value": "Cheese", "lang": "en" }, { "value": "Fromage", "lang": "fr" } ] }
+			// and each value is stored in the language tagged predicate: "Product.name@fr".
+			if pairs, ok := val.([]interface{}); ok && fieldDef.HasLangDirective() {
+				for _, p := range pairs {
+					pair, _ := p.(map[string]interface{})
+					pred := fieldName
+					if lang, _ := pair["lang"].(string); lang != "" {
+						pred = fieldName + "@" + lang
+					}
+					results.secondPass = squashFragments(squashIntoObject(pred),
+						results.secondPass, []*mutationFragment{newFragment(pair["value"])})
+				}
+				continue
+			}
+
+			// A Polygon is given as its coordinates, e.g.
+			// { "region": [ [ [ 1.5, 2.5 ], [ 3.5, 4.5 ], [ 1.5, 2.5 ] ] ] }
+			// and stored in the geo predicate as GeoJSON.
+			if coords, ok := val.([]interface{}); ok &&
+				fieldDef.Type().Name() == schema.PolygonType {
+				results.secondPass = squashFragments(squashIntoObject(fieldName),
+					results.secondPass, []*mutationFragment{newFragment(geoJSONPolygon(coords))})
+				continue
+			}
+
 			switch val := val.(type) {
 			case map[string]interface{}:
 				// This field is another GraphQL object, which could either be linking to an
@@ -1091,7 +1463,7 @@ func rewriteObject(
 				//          like here ^^
 				frags =
 					rewriteObject(ctx, fieldDef.Type(), fieldDef, myUID, varGen,
-						withAdditionalDeletes, val, deepXID, xidMetadata)
+						withAdditionalDeletes, val, path+"."+field, deepXID, xidMetadata)
 
 			case []interface{}:
 				// This field is either:
@@ -1107,7 +1479,7 @@ func rewriteObject(
 				//            like here ^^
 				frags =
 					rewriteList(ctx, fieldDef.Type(), fieldDef, myUID, varGen,
-						withAdditionalDeletes, val, deepXID, xidMetadata)
+						withAdditionalDeletes, val, path+"."+field, deepXID, xidMetadata)
 			default:
 				// This field is either:
 				// 1) a scalar value: e.g.
@@ -1145,6 +1517,10 @@ func rewriteObject(
 	// parentFrags are reverse links to parents. only applicable for when deepXID > 2
 	results.firstPass = appendFragments(results.firstPass, parentFrags)
 
+	if xidFrag != nil {
+		xidFrag = patchXIDReference(xidFrag)
+	}
+
 	// xidFrag contains the mutation to update object if it is present.
 	// add it to secondPass if deepXID <= 2, otherwise firstPass for relevant hasInverse links.
 	if xidFrag != nil && deepXID > 2 {
@@ -1161,6 +1537,176 @@ func rewriteObject(
 	return results
 }
 
+// rewriteUpsertObject rewrites obj, an input of an upsert mutation, to the fragments that add
+// it if its xid isn't in use, as rewriteObject does for an add, followed by copies of them that
+// update the node that has the xid otherwise.  For example, with `username: String! @id`,
+// { username: "alice", name: "Alice" } is added with
+//
+// "@if(eq(len(User1), 0))"
+// { "uid": "_:User1", "dgraph.type": ["User"], "User.username": "alice", "User.name": "Alice" }
+//
+// and updated with
+//
+// "@if(eq(len(User1), 1))"
+// { "uid": "uid(User1)", "User.username": "alice", "User.name": "Alice" }
+//
+// An update doesn't set the type, or the audit fields that are only set when a node is added.
+// If obj doesn't have all the fields a new node needs, only the update is rewritten, and it's
+// an error for the xid not to be in use.
+func rewriteUpsertObject(
+	ctx context.Context,
+	typ schema.Type,
+	varGen *VariableGenerator,
+	obj map[string]interface{},
+	path string,
+	xidMetadata *xidMetadata) *mutationRes {
+
+	addErr := typ.EnsureNonNulls(obj, "")
+	res := rewriteObject(ctx, typ, nil, "", varGen, true, obj, path, 0, xidMetadata)
+
+	xidString, _ := obj[typ.XIDField().Name()].(string)
+	if xidString == "" {
+		return res
+	}
+	for _, frag := range res.secondPass {
+		if frag.err != nil {
+			return res
+		}
+	}
+
+	variable := varGen.Next(typ, typ.XIDField().Name(), xidString)
+	added := fmt.Sprintf("_:%s", variable)
+	absent := fmt.Sprintf("eq(len(%s), 0)", variable)
+
+	updates := make([]*mutationFragment, 0, len(res.secondPass))
+	for _, frag := range res.secondPass {
+		upd := newFragment(replaceUID(frag.fragment, added, fmt.Sprintf("uid(%s)", variable)))
+		upd.check = frag.check
+		if frag.deletes != nil {
+			upd.deletes = replaceUID(frag.deletes, added,
+				fmt.Sprintf("uid(%s)", variable)).([]interface{})
+		}
+		for _, cond := range frag.conditions {
+			if cond == absent {
+				cond = fmt.Sprintf("eq(len(%s), 1)", variable)
+			}
+			upd.conditions = append(upd.conditions, cond)
+		}
+
+		node := upd.fragment.(map[string]interface{})
+		delete(node, "dgraph.type")
+		for _, fld := range typ.AuditFields() {
+			if kind, _ := fld.Audit(); kind != schema.UpdatedAt {
+				delete(node, strings.Trim(typ.DgraphPredicate(fld.Name()), "<>"))
+			}
+		}
+		// The defaults are only for a node that's added, not the fields an update leaves out.
+		for _, fld := range typ.DefaultFields() {
+			if obj[fld.Name()] == nil {
+				delete(node, strings.Trim(typ.DgraphPredicate(fld.Name()), "<>"))
+			}
+		}
+		updates = append(updates, upd)
+	}
+
+	if addErr == nil {
+		res.secondPass = appendFragments(res.secondPass, updates)
+		return res
+	}
+
+	// Only the updates are left, so the first of them collects the queries and the new nodes,
+	// but the node that's updated isn't new.
+	updates[0].queries = res.secondPass[0].queries
+	copyTypeMap(res.secondPass[0].newNodes, updates[0].newNodes)
+	delete(updates[0].newNodes, variable)
+
+	notFound := checkQueryResult(variable, nil, schema.GQLWrapf(addErr,
+		"xid \"%s\" doesn't exist and input object not well formed", xidString))
+	for _, upd := range updates {
+		upd.check = func(chk resultChecker) resultChecker {
+			return func(m map[string]interface{}) error {
+				return schema.AppendGQLErrs(notFound(m), chk(m))
+			}
+		}(upd.check)
+	}
+	res.secondPass = updates
+	return res
+}
+
+// replaceUID returns a copy of v, a mutation fragment or a part of one, in which every uid that
+// is from is to instead.
+func replaceUID(v interface{}, from, to string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		cpy := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if k == "uid" && val == from {
+				cpy[k] = to
+				continue
+			}
+			cpy[k] = replaceUID(val, from, to)
+		}
+		return cpy
+	case []interface{}:
+		cpy := make([]interface{}, len(v))
+		for i, val := range v {
+			cpy[i] = replaceUID(val, from, to)
+		}
+		return cpy
+	default:
+		return v
+	}
+}
+
+// queriedUID returns the uid of the node that the query variable found in result, the result
+// of an upsert's query.
+func queriedUID(result map[string]interface{}, variable string) (string, bool) {
+	nodes, _ := result[variable].([]interface{})
+	if len(nodes) != 1 {
+		return "", false
+	}
+	node, _ := nodes[0].(map[string]interface{})
+	uid, ok := node["uid"].(string)
+	return uid, ok
+}
+
+// checkReference checks that obj, given at path in the mutation input for a field of type typ,
+// identifies the node it refers to by exactly one of the ID or the @id field of typ, or, when
+// adding, gives some data for a new node.  An object with both would silently use the ID, and
+// an empty object would add an empty node.
+func checkReference(
+	typ schema.Type,
+	obj map[string]interface{},
+	path string,
+	withAdditionalDeletes bool) error {
+
+	var idNames []string
+	given := 0
+	for _, fld := range []schema.FieldDefinition{typ.IDField(), typ.XIDField()} {
+		if fld == nil {
+			continue
+		}
+		idNames = append(idNames, fld.Name())
+		if obj[fld.Name()] != nil {
+			given++
+		}
+	}
+
+	switch {
+	case given > 1:
+		return errors.Errorf("%s can't have both %s, give just one of them to reference an "+
+			"existing %s", path, strings.Join(idNames, " and "), typ.Name())
+	case len(obj) == 0 && withAdditionalDeletes:
+		if len(idNames) == 0 {
+			return errors.Errorf("%s is empty, give the fields of a new %s to add it", path,
+				typ.Name())
+		}
+		return errors.Errorf("%s is empty, give %s to reference an existing %s, or the fields "+
+			"of a new %s to add it", path, strings.Join(idNames, " or "), typ.Name(), typ.Name())
+	}
+	return nil
+}
+
 func invalidObjectFragment(
 	err error,
 	xidFrag *mutationFragment,
@@ -1304,6 +1850,139 @@ func asXIDReference(
 	return frag
 }
 
+// deepUpdateReference adds patch to ref, the fragment that links to an existing node in
+// refVar, so that a deepUpdate also sets those fields on the referenced node.  E.g. with
+// deepUpdate, updating an author with
+// { "posts": [ { "postID": "0x9", "title": "new" } ] }
+// links post 0x9 (see asIDReference) and also sets its title
+// { "uid": "0x9", "Post.title": "new", "Post.author": { "uid": "uid(x)" } }
+//
+// The patch is rewritten just like the set patch of an update, so any references in it
+// are deep updated in turn.  The referenced node must pass the update auth rules of typ.
+func deepUpdateReference(
+	ctx context.Context,
+	typ schema.Type,
+	ref *mutationFragment,
+	refVar, path string,
+	varGen *VariableGenerator,
+	patch map[string]interface{},
+	xidMetadata *xidMetadata) *mutationRes {
+
+	refUID, _ := ref.fragment.(map[string]interface{})["uid"].(string)
+	if ref.err != nil || refUID == "" || len(patch) == 0 {
+		return &mutationRes{secondPass: []*mutationFragment{ref}}
+	}
+
+	addUpdateAuth(ctx, ref, typ, refVar, path, varGen)
+
+	res := rewriteObject(ctx, typ, nil, refUID, varGen, true, patch, path, 0, xidMetadata)
+	res.secondPass = squashFragments(squashIntoReference, []*mutationFragment{ref}, res.secondPass)
+	return res
+}
+
+// referencePatch returns the fields of obj that a deepUpdate sets on the node obj refers
+// to.  That's everything but the ID and XID, which identify the node, and the inverse of
+// srcField, which the reference itself links.  If scalarsOnly is set, fields holding
+// objects are also left out.
+func referencePatch(
+	typ schema.Type,
+	srcField schema.FieldDefinition,
+	obj map[string]interface{},
+	scalarsOnly bool) map[string]interface{} {
+
+	skip := make(map[string]bool, 3)
+	if id := typ.IDField(); id != nil {
+		skip[id.Name()] = true
+	}
+	if xid := typ.XIDField(); xid != nil {
+		skip[xid.Name()] = true
+	}
+	if invField := srcField.Inverse(); invField != nil {
+		skip[invField.Name()] = true
+	}
+
+	patch := make(map[string]interface{}, len(obj))
+	for field, val := range obj {
+		if skip[field] {
+			continue
+		}
+		if scalarsOnly {
+			switch val := val.(type) {
+			case map[string]interface{}:
+				continue
+			case []interface{}:
+				if len(val) > 0 {
+					if _, ok := val[0].(map[string]interface{}); ok {
+						continue
+					}
+				}
+			}
+		}
+		patch[field] = val
+	}
+	return patch
+}
+
+// addUpdateAuth adds the update auth rules of typ, for the node in refVar, to frag.  If
+// that node exists but can't be updated, frag's check fails with an error naming path,
+// the place of the node in the mutation input.
+func addUpdateAuth(
+	ctx context.Context,
+	frag *mutationFragment,
+	typ schema.Type,
+	refVar, path string,
+	varGen *VariableGenerator) {
+
+	authVariables, err := authorization.ExtractAuthVariables(ctx)
+	if err != nil {
+		frag.check =
+			checkQueryResult("auth.failed", nil, schema.GQLWrapf(err, "authorization failed"))
+		return
+	}
+	newRw := &authRewriter{
+		authVariables: authVariables,
+		varGen:        varGen,
+		varName:       refVar,
+		selector:      updateAuthSelector,
+	}
+
+	switch newRw.evaluateStaticRules(typ) {
+	case schema.Positive:
+		return
+	case schema.Uncertain:
+		authQueries, authFilter := newRw.rewriteAuthQueries(typ)
+		if len(authQueries) == 0 {
+			// there's no auth to add for this type
+			return
+		}
+
+		// The query for refVar is already added by asIDReference/asXIDReference, so we just
+		// need the auth query to check its length against.
+		//
+		// Post3.auth(func: uid(Post3)) @filter(...auth filter...)
+		frag.queries = append(frag.queries,
+			&gql.GraphQuery{
+				Attr: refVar + ".auth",
+				Func: &gql.Function{
+					Name: "uid",
+					Args: []gql.Arg{{Value: refVar}}},
+				Filter:   authFilter,
+				Children: []*gql.GraphQuery{{Attr: "uid"}}})
+		frag.queries = append(frag.queries, authQueries...)
+	}
+
+	// With no auth query for refVar, authCheck fails for any existing node, which is what
+	// a Negative static rule needs.
+	chk := frag.check
+	authChk := authCheck(func(m map[string]interface{}) error { return nil }, refVar)
+	frag.check = func(m map[string]interface{}) error {
+		if authChk(m) != nil {
+			return x.GqlErrorf("authorization failed for deep update of %s", path)
+		}
+		return chk(m)
+	}
+}
+
 // addAdditionalDeletes creates any additional deletes that are needed when a reference changes.
 // E.g. if we have
 // type Post { ... author: Author @hasInverse(field: posts) ... }
@@ -1554,6 +2233,97 @@ func addInverseLink(obj map[string]interface{}, srcField schema.FieldDefinition,
 	}
 }
 
+// addCompositeKeyChecks makes frag, which adds a new node of typ for obj, fail if a node of typ
+// with the same values for the fields of one of its composite keys already exists, in the same
+// way as a node with an XID that's in use can't be added.  It returns an error if another new
+// node in the mutation has the same values for a composite key.
+func addCompositeKeyChecks(
+	frag *mutationFragment,
+	typ schema.Type,
+	obj map[string]interface{},
+	varGen *VariableGenerator,
+	xidMetadata *xidMetadata) error {
+
+	keys := typ.CompositeKeys()
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		vals := make([]string, 0, len(keys[name]))
+		for _, fd := range keys[name] {
+			if val, ok := obj[fd.Name()].(string); ok {
+				vals = append(vals, val)
+			}
+		}
+		if len(vals) != len(keys[name]) {
+			// A new node without all the fields of the key fails its non-null checks.
+			continue
+		}
+
+		seen := typ.Name() + "." + name + "." + strings.Join(vals, ".")
+		if xidMetadata.compositeKeys[seen] {
+			return errors.Errorf("duplicate composite key %s found: %s", name,
+				strings.Join(vals, ", "))
+		}
+		xidMetadata.compositeKeys[seen] = true
+
+		variable := varGen.Next(typ, "", "")
+		frag.queries = append(frag.queries, compositeKeyQuery(variable, typ, keys[name], vals))
+		frag.conditions = append(frag.conditions, fmt.Sprintf("eq(len(%s), 0)", variable))
+		chk := frag.check
+		keyChk := checkQueryResult(variable,
+			x.GqlErrorf("composite key %s (%s) already exists for type %s", name,
+				strings.Join(vals, ", "), typ.Name()),
+			nil)
+		frag.check = func(m map[string]interface{}) error {
+			if err := keyChk(m); err != nil {
+				return err
+			}
+			return chk(m)
+		}
+	}
+	return nil
+}
+
+// compositeKeyQuery finds the node of typ whose fields in key have the values vals, and stores
+// its uid in variable.
+func compositeKeyQuery(variable string, typ schema.Type, key []schema.FieldDefinition,
+	vals []string) *gql.GraphQuery {
+
+	qry := &gql.GraphQuery{
+		Var:      variable,
+		Attr:     variable,
+		Children: []*gql.GraphQuery{{Attr: "uid"}},
+	}
+	for i, fd := range key {
+		fn := &gql.Function{
+			Name: "eq",
+			Args: []gql.Arg{
+				{Value: typ.DgraphPredicate(fd.Name())},
+				{Value: maybeQuoteArg("eq", vals[i])},
+			},
+		}
+		if i == 0 {
+			qry.Func = fn
+			continue
+		}
+		thisFilter := &gql.FilterTree{Func: fn}
+		if qry.Filter == nil {
+			qry.Filter = thisFilter
+		} else {
+			qry.Filter = &gql.FilterTree{
+				Op:    "and",
+				Child: []*gql.FilterTree{qry.Filter, thisFilter},
+			}
+		}
+	}
+	addTypeFilter(qry, typ)
+	return qry
+}
+
 func xidQuery(xidVariable, xidString, xidPredicate string, typ schema.Type) *gql.GraphQuery {
 	qry := &gql.GraphQuery{
 		Var:  xidVariable,
@@ -1579,6 +2349,7 @@ func rewriteList(
 	varGen *VariableGenerator,
 	withAdditionalDeletes bool,
 	objects []interface{},
+	path string,
 	deepXID int,
 	xidMetadata *xidMetadata) *mutationRes {
 
@@ -1586,10 +2357,11 @@ func rewriteList(
 	result.secondPass = []*mutationFragment{newFragment(make([]interface{}, 0))}
 	foundSecondPass := false
 
-	for _, obj := range objects {
+	for i, obj := range objects {
 		switch obj := obj.(type) {
 		case map[string]interface{}:
-			frag := rewriteObject(ctx, typ, srcField, srcUID, varGen, withAdditionalDeletes, obj, deepXID, xidMetadata)
+			frag := rewriteObject(ctx, typ, srcField, srcUID, varGen, withAdditionalDeletes, obj,
+				fmt.Sprintf("%s[%d]", path, i), deepXID, xidMetadata)
 			if len(frag.secondPass) != 0 {
 				foundSecondPass = true
 			}
@@ -1611,6 +2383,11 @@ func rewriteList(
 	return result
 }
 
+// geoJSONPolygon returns the GeoJSON for the Polygon with coordinates coords.
+func geoJSONPolygon(coords []interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "Polygon", "coordinates": coords}
+}
+
 func newFragment(f interface{}) *mutationFragment {
 	return &mutationFragment{
 		fragment: f,
@@ -1647,6 +2424,26 @@ func squashIntoObject(label string) func(interface{}, interface{}, bool) interfa
 	}
 }
 
+// squashIntoReference merges the fields of v, a patch for an existing node, into object,
+// the fragment referencing that node.
+func squashIntoReference(object, v interface{}, makeCopy bool) interface{} {
+	asObject := object.(map[string]interface{})
+	patch := v.(map[string]interface{})
+	if makeCopy {
+		cpy := make(map[string]interface{}, len(asObject)+len(patch))
+		for k, v := range asObject {
+			cpy[k] = v
+		}
+		asObject = cpy
+	}
+	for k, v := range patch {
+		if k != "uid" {
+			asObject[k] = v
+		}
+	}
+	return asObject
+}
+
 func appendFragments(left, right []*mutationFragment) []*mutationFragment {
 	if len(left) == 0 {
 		return right
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
 	"github.com/dgraph-io/dgraph/testutil"
@@ -75,6 +76,11 @@ func TestMutationRewriting(t *testing.T) {
 	t.Run("Delete Mutation Rewriting", func(t *testing.T) {
 		mutationRewriting(t, "delete_mutation_test.yaml", NewDeleteRewriter)
 	})
+	t.Run("Upsert Mutation Rewriting", func(t *testing.T) {
+		defer func(now func() time.Time) { auditNow = now }(auditNow)
+		auditNow = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+		mutationRewriting(t, "upsert_mutation_test.yaml", NewUpsertRewriter)
+	})
 }
 
 func mutationValidation(t *testing.T, file string, rewriterFactory func() MutationRewriter) {
@@ -286,6 +292,85 @@ func TestMutationQueryRewriting(t *testing.T) {
 	}
 }
 
+// Tests that the payload of an upsert mutation is queried from the uid of the node it added,
+// or else the uid of the node that has the @id value, which it updated.
+func TestUpsertMutationQueryRewriting(t *testing.T) {
+	complete := `upsertCustomer(input: [{username: "alice", name: "Alice"}])`
+	partial := `upsertCustomer(input: [{username: "alice", tier: "gold"}])`
+	queried := map[string]interface{}{
+		"Customer2": []interface{}{map[string]interface{}{"uid": "0x5"}}}
+
+	tcases := map[string]struct {
+		mut      string
+		assigned map[string]string
+		result   map[string]interface{}
+		dgQuery  string
+		err      string
+	}{
+		"added": {
+			mut:      complete,
+			assigned: map[string]string{"Customer2": "0x4"},
+			result:   map[string]interface{}{"Customer2": []interface{}{}},
+			dgQuery: `query {
+  customer(func: uid(0x4)) {
+    username : Customer.username
+    dgraph.uid : uid
+  }
+}`,
+		},
+		"updated": {
+			mut:    complete,
+			result: queried,
+			dgQuery: `query {
+  customer(func: uid(0x5)) {
+    username : Customer.username
+    dgraph.uid : uid
+  }
+}`,
+		},
+		"updated without the fields to add": {
+			mut:    partial,
+			result: queried,
+			dgQuery: `query {
+  customer(func: uid(0x5)) {
+    username : Customer.username
+    dgraph.uid : uid
+  }
+}`,
+		},
+		"not found without the fields to add": {
+			mut:    partial,
+			result: map[string]interface{}{"Customer2": []interface{}{}},
+			err: `xid "alice" doesn't exist and input object not well formed because ` +
+				`type Customer requires a value for field name, but no value present`,
+		},
+	}
+
+	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			op, err := gqlSchema.Operation(&schema.Request{
+				Query: fmt.Sprintf(`mutation { %s { customer { username } } }`, tcase.mut)})
+			require.NoError(t, err)
+			mut := test.GetMutation(t, op)
+			rewriter := NewUpsertRewriter()
+			_, err = rewriter.Rewrite(context.Background(), mut)
+			require.NoError(t, err)
+
+			dgQuery, err := rewriter.FromMutationResult(
+				context.Background(), mut, tcase.assigned, tcase.result)
+
+			if tcase.err != "" {
+				require.EqualError(t, err, tcase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tcase.dgQuery, dgraph.AsString(dgQuery))
+		})
+	}
+}
+
 func TestCustomHTTPMutation(t *testing.T) {
 	b, err := ioutil.ReadFile("custom_mutation_test.yaml")
 	require.NoError(t, err, "Unable to read test file")
@@ -328,3 +413,83 @@ func TestCustomHTTPMutation(t *testing.T) {
 		})
 	}
 }
+
+// Tests that mutations over the limits set by # Dgraph.Limits are turned away, counting the
+// nodes in nested objects and lists.
+func TestMutationLimits(t *testing.T) {
+	b, err := ioutil.ReadFile("schema.graphql")
+	require.NoError(t, err, "Unable to read schema file")
+	gqlSchema := test.LoadSchemaFromString(t,
+		`# Dgraph.Limits {"maxMutationNodes": 3, "maxRequestBytes": 400}`+"\n"+string(b))
+
+	tcases := map[string]struct {
+		gqlMutation string
+		rewriter    func() MutationRewriter
+		err         string
+	}{
+		"add within the limits": {
+			gqlMutation: `mutation {
+				addAuthor(input: [{name: "A", posts: [{title: "P1"}, {title: "P2"}]}]) {
+					numUids
+				}
+			}`,
+			rewriter: NewAddRewriter,
+		},
+		"add with too many nested nodes": {
+			gqlMutation: `mutation {
+				addAuthor(input: [{name: "A", country: {name: "C"},
+					posts: [{title: "P1"}, {title: "P2"}]}]) {
+					numUids
+				}
+			}`,
+			rewriter: NewAddRewriter,
+			err: "mutation addAuthor adds or links to 4 nodes, but the schema limits a " +
+				"mutation to 3 nodes with maxMutationNodes",
+		},
+		"add with too many nodes in the input list": {
+			gqlMutation: `mutation {
+				addAuthor(input: [{name: "A"}, {name: "B"}, {name: "C"}, {name: "D"}]) {
+					numUids
+				}
+			}`,
+			rewriter: NewAddRewriter,
+			err:      "adds or links to 4 nodes",
+		},
+		"update with too many linked nodes": {
+			gqlMutation: `mutation {
+				updateAuthor(input: {filter: {id: ["0x1"]},
+					set: {posts: [{postID: "0x2"}, {postID: "0x3"}]},
+					remove: {posts: [{postID: "0x4"}, {postID: "0x5"}]}}) {
+					numUids
+				}
+			}`,
+			rewriter: NewUpdateRewriter,
+			err:      "adds or links to 4 nodes",
+		},
+		"add with too many bytes": {
+			gqlMutation: `mutation {
+				addAuthor(input: [{name: "` + strings.Repeat("A", 400) + `"}]) {
+					numUids
+				}
+			}`,
+			rewriter: NewAddRewriter,
+			err:      "but the schema limits a mutation to 400 bytes with maxRequestBytes",
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			op, err := gqlSchema.Operation(&schema.Request{Query: tcase.gqlMutation})
+			require.NoError(t, err)
+			mut := test.GetMutation(t, op)
+
+			_, err = tcase.rewriter().Rewrite(context.Background(), mut)
+			if tcase.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tcase.err)
+		})
+	}
+}
@@ -19,8 +19,10 @@ package resolve
 import (
 	"context"
 	"encoding/json"
+	"sync"
 
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 	otrace "go.opencensus.io/trace"
 
 	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
@@ -57,6 +59,23 @@ func NewQueryResolver(qr QueryRewriter, ex DgraphExecutor, rc ResultCompleter) Q
 	return &queryResolver{queryRewriter: qr, executor: ex, resultCompleter: rc}
 }
 
+// NewNodeQueryResolver creates a resolver for Relay's node query.  The node is resolved by
+// getResolver as the get query of the type its ID is of, so it's found with that type's auth
+// rules.
+func NewNodeQueryResolver(getResolver QueryResolver) QueryResolver {
+	return QueryResolverFunc(func(ctx context.Context, query schema.Query) *Resolved {
+		get, err := query.NodeGetQuery()
+		if err != nil {
+			return &Resolved{
+				Data:  map[string]interface{}{query.Name(): nil},
+				Field: query,
+				Err:   err,
+			}
+		}
+		return getResolver.Resolve(ctx, get)
+	})
+}
+
 // a queryResolver can resolve a single GraphQL query field.
 type queryResolver struct {
 	queryRewriter   QueryRewriter
@@ -111,30 +130,170 @@ func (qr *queryResolver) rewriteAndExecute(ctx context.Context, query schema.Que
 		}
 	}
 
-	dgQuery, err := qr.queryRewriter.Rewrite(ctx, query)
-	if err != nil {
-		return emptyResult(schema.GQLWrapf(err, "couldn't rewrite query %s",
-			query.ResponseName()))
+	req := &dgoapi.Request{ReadOnly: true, BestEffort: query.Operation().BestEffort()}
+	if dqlConf, ok := query.CustomDQLConfig(); ok {
+		// @custom(dql: ...) gives the Dgraph query, so there's nothing to rewrite.
+		req.Query = dqlConf.Query
+		vars, err := dqlVars(query, dqlConf.Vars)
+		if err != nil {
+			return emptyResult(schema.GQLWrapf(err, "couldn't build the variables of %s",
+				query.ResponseName()))
+		}
+		req.Vars = vars
+	} else {
+		dgQuery, err := qr.queryRewriter.Rewrite(ctx, query)
+		if err != nil {
+			return emptyResult(schema.GQLWrapf(err, "couldn't rewrite query %s",
+				query.ResponseName()))
+		}
+		req.Query = dgraph.AsString(dgQuery)
 	}
 
 	queryTimer := newtimer(ctx, &dgraphQueryDuration.OffsetDuration)
 	queryTimer.Start()
-	resp, err := qr.executor.Execute(ctx, &dgoapi.Request{Query: dgraph.AsString(dgQuery),
-		ReadOnly: true})
+	// A best effort query reads at whatever timestamp its alpha has, so it can't share one.
+	ts, _ := ctx.Value(readTsKey).(*readTs)
+	if req.BestEffort {
+		ts = nil
+	}
+	req.StartTs = ts.get()
+	resp, err := qr.executor.Execute(ctx, req)
 	queryTimer.Stop()
 
 	if err != nil {
 		glog.Infof("Dgraph query execution failed : %s", err)
 		return emptyResult(schema.GQLWrapf(err, "Dgraph query failed"))
 	}
+	ts.set(resp.GetTxn().GetStartTs())
 
 	ext.TouchedUids = resp.GetMetrics().GetNumUids()[touchedUidsKey]
-	resolved := completeDgraphResult(ctx, query, resp.GetJson(), err)
+	dgResult := resp.GetJson()
+	switch query.QueryType() {
+	case schema.PageQuery:
+		dgResult, err = pageResult(query, dgResult)
+	case schema.GroupByQuery:
+		dgResult, err = groupResult(query, dgResult)
+	}
+	if err != nil {
+		return emptyResult(schema.GQLWrapf(err, "couldn't process the result of %s",
+			query.ResponseName()))
+	}
+	resolved := completeDgraphResult(ctx, query, dgResult, err)
 	resolved.Extensions = ext
 
 	return resolved
 }
 
+// dqlVars returns the values of the DQL variables names of a @custom(dql: ...) query, which are
+// the values of the arguments of query with the same names.  DQL variables are strings, so
+// values of other types are given as JSON.  Arguments without a value are left out, so that
+// the DQL query's defaults apply.
+func dqlVars(query schema.Query, names []string) (map[string]string, error) {
+	vars := make(map[string]string, len(names))
+	for _, name := range names {
+		val := query.ArgValue(name)
+		if val == nil {
+			continue
+		}
+		if str, ok := val.(string); ok {
+			vars["$"+name] = str
+			continue
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't marshal the value of $%s", name)
+		}
+		vars["$"+name] = string(b)
+	}
+	return vars, nil
+}
+
+// A readTs is the timestamp that the queries of a batch read at.  It's the timestamp of the
+// first of them that Dgraph answers, so the ones that start after that all see the same data.
+type readTs struct {
+	mu sync.Mutex
+	ts uint64
+}
+
+// get returns the timestamp to read at, or 0 if there isn't one yet, or ts is nil.
+func (ts *readTs) get() uint64 {
+	if ts == nil {
+		return 0
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.ts
+}
+
+// set makes startTs the timestamp to read at, unless there already is one.
+func (ts *readTs) set(startTs uint64) {
+	if ts == nil {
+		return
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.ts == 0 {
+		ts.ts = startTs
+	}
+}
+
+// pageResult builds the result of a page query from the results of its two Dgraph queries, so
+//
+// { "queryPost": [ ...nodes... ], "pagePost": [ { "count": 42 } ] }
+//
+// becomes
+//
+// { "pagePost": [ { "nodes": [ ...nodes... ], "totalCount": 42 } ] }
+func pageResult(query schema.Query, dgResult []byte) ([]byte, error) {
+	var res map[string]interface{}
+	if len(dgResult) > 0 {
+		if err := json.Unmarshal(dgResult, &res); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal Dgraph query result")
+		}
+	}
+
+	var total interface{} = 0
+	if counts, ok := res[query.Name()].([]interface{}); ok && len(counts) > 0 {
+		if count, ok := counts[0].(map[string]interface{}); ok && count["count"] != nil {
+			total = count["count"]
+		}
+	}
+
+	page := map[string]interface{}{
+		schema.PageTotalCount: total,
+		schema.PageNodes:      res[query.NodesQuery().Name()],
+	}
+	return json.Marshal(map[string]interface{}{query.Name(): []interface{}{page}})
+}
+
+// groupResult turns the result of a group query, which Dgraph gives as
+//
+// {"groupAuthorByReputation": [{"@groupby": [{"Author.reputation": 4.5, "count": 2}]}]}
+//
+// into the groups that the GraphQL query asks for, like
+//
+// {"groupAuthorByReputation": [{"reputation": 4.5, "count": 2}]}
+func groupResult(query schema.Query, dgResult []byte) ([]byte, error) {
+	var res map[string][]map[string][]map[string]interface{}
+	if len(dgResult) > 0 {
+		if err := json.Unmarshal(dgResult, &res); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal Dgraph query result")
+		}
+	}
+
+	_, by := query.GroupedQuery()
+	groups := make([]interface{}, 0)
+	for _, r := range res[query.Name()] {
+		for _, group := range r["@groupby"] {
+			groups = append(groups, map[string]interface{}{
+				by.Name():             group[by.DgraphPredicate()],
+				schema.AggregateCount: group[schema.AggregateCount],
+			})
+		}
+	}
+	return json.Marshal(map[string]interface{}{query.Name(): groups})
+}
+
 func resolveIntrospection(ctx context.Context, q schema.Query) *Resolved {
 	data, err := schema.Introspect(q)
 
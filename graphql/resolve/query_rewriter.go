@@ -18,9 +18,13 @@ package resolve
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/dgraph-io/dgraph/gql"
 	"github.com/dgraph-io/dgraph/graphql/authorization"
@@ -49,6 +53,7 @@ func (qr *queryRewriter) Rewrite(
 	ctx context.Context,
 	gqlQuery schema.Query) (*gql.GraphQuery, error) {
 
+	ctx = withAuthMeta(ctx, gqlQuery.Operation())
 	authVariables, err := authorization.ExtractAuthVariables(ctx)
 	if err != nil {
 		return nil, err
@@ -60,8 +65,10 @@ func (qr *queryRewriter) Rewrite(
 		selector:      queryAuthSelector,
 	}
 
+	// Blocks that can't find anything are named after the query, and never its alias, so that
+	// no alias ends up in the Dgraph query.
 	if gqlQuery.Type().InterfaceImplHasAuthRules() {
-		return &gql.GraphQuery{Attr: gqlQuery.ResponseName() + "()"}, nil
+		return &gql.GraphQuery{Attr: gqlQuery.Name() + "()"}, nil
 	}
 
 	switch gqlQuery.QueryType() {
@@ -76,6 +83,10 @@ func (qr *queryRewriter) Rewrite(
 		// way up when the query first comes in.  All other possible problems with
 		// the query are caught by validation.
 		// ATM, I'm not sure how to hook into the GraphQL validator to get that to happen
+		if key := gqlQuery.CompositeKey(); key != nil {
+			return rewriteAsCompositeGet(gqlQuery, key, authRw), nil
+		}
+
 		xid, uid, err := gqlQuery.IDArgValue()
 		if err != nil {
 			return nil, err
@@ -88,6 +99,10 @@ func (qr *queryRewriter) Rewrite(
 		return rewriteAsQuery(gqlQuery, authRw), nil
 	case schema.PasswordQuery:
 		return passwordQuery(gqlQuery, authRw)
+	case schema.PageQuery:
+		return rewriteAsPageQuery(gqlQuery, authRw), nil
+	case schema.GroupByQuery:
+		return rewriteAsGroupQuery(gqlQuery, authRw), nil
 	default:
 		return nil, errors.Errorf("unimplemented query type %s", gqlQuery.QueryType())
 	}
@@ -216,6 +231,8 @@ func rewriteAsQueryByIds(field schema.Field, uids []uint64, authRw *authRewriter
 	}
 
 	addArgumentsToField(dgQuery, field)
+	addTTLFilter(dgQuery, field.Type())
+	addSoftDeleteFilter(dgQuery, field.Type(), field)
 	selectionAuth := addSelectionSetFrom(dgQuery, field, authRw)
 	addUID(dgQuery)
 	addCascadeDirective(dgQuery, field)
@@ -274,7 +291,7 @@ func rewriteAsGet(
 	var dgQuery *gql.GraphQuery
 	rbac := auth.evaluateStaticRules(field.Type())
 	if rbac == schema.Negative {
-		return &gql.GraphQuery{Attr: field.ResponseName() + "()"}
+		return &gql.GraphQuery{Attr: field.Name() + "()"}
 	}
 
 	if xid == nil {
@@ -316,6 +333,67 @@ func rewriteAsGet(
 	selectionAuth := addSelectionSetFrom(dgQuery, field, auth)
 	addUID(dgQuery)
 	addTypeFilter(dgQuery, field.Type())
+	addTTLFilter(dgQuery, field.Type())
+	addSoftDeleteFilter(dgQuery, field.Type(), field)
+	addCascadeDirective(dgQuery, field)
+
+	if rbac == schema.Uncertain {
+		dgQuery = auth.addAuthQueries(field.Type(), dgQuery)
+	}
+
+	if len(selectionAuth) > 0 {
+		dgQuery = &gql.GraphQuery{Children: append([]*gql.GraphQuery{dgQuery}, selectionAuth...)}
+	}
+
+	return dgQuery
+}
+
+// rewriteAsCompositeGet rewrites a get query by composite key, like
+// getMemberByOrgKey(org: "dgraph", key: "alice"), into a Dgraph query that finds the node by
+// the first field of the key and filters it by the rest.
+func rewriteAsCompositeGet(
+	field schema.Query,
+	key []schema.FieldDefinition,
+	auth *authRewriter) *gql.GraphQuery {
+
+	rbac := auth.evaluateStaticRules(field.Type())
+	if rbac == schema.Negative {
+		return &gql.GraphQuery{Attr: field.Name() + "()"}
+	}
+
+	eqFuncs := make([]*gql.Function, 0, len(key))
+	for _, fd := range key {
+		val, _ := field.ArgValue(fd.Name()).(string)
+		eqFuncs = append(eqFuncs, &gql.Function{
+			Name: "eq",
+			Args: []gql.Arg{
+				{Value: field.Type().DgraphPredicate(fd.Name())},
+				{Value: maybeQuoteArg("eq", val)},
+			},
+		})
+	}
+
+	dgQuery := &gql.GraphQuery{
+		Attr: field.Name(),
+		Func: eqFuncs[0],
+	}
+	for _, fn := range eqFuncs[1:] {
+		thisFilter := &gql.FilterTree{Func: fn}
+		if dgQuery.Filter == nil {
+			dgQuery.Filter = thisFilter
+		} else {
+			dgQuery.Filter = &gql.FilterTree{
+				Op:    "and",
+				Child: []*gql.FilterTree{dgQuery.Filter, thisFilter},
+			}
+		}
+	}
+
+	selectionAuth := addSelectionSetFrom(dgQuery, field, auth)
+	addUID(dgQuery)
+	addTypeFilter(dgQuery, field.Type())
+	addTTLFilter(dgQuery, field.Type())
+	addSoftDeleteFilter(dgQuery, field.Type(), field)
 	addCascadeDirective(dgQuery, field)
 
 	if rbac == schema.Uncertain {
@@ -357,10 +435,14 @@ func rewriteAsQuery(field schema.Field, authRw *authRewriter) *gql.GraphQuery {
 	} else if ids := idFilter(field, field.Type().IDField()); ids != nil {
 		addUIDFunc(dgQuery, ids)
 	} else {
-		addTypeFunc(dgQuery, field.Type().DgraphName())
+		addTypeFunc(dgQuery, field.Type())
 	}
 
 	addArgumentsToField(dgQuery, field)
+	if !authRw.writingAuth() {
+		addTTLFilter(dgQuery, field.Type())
+		addSoftDeleteFilter(dgQuery, field.Type(), field)
+	}
 	selectionAuth := addSelectionSetFrom(dgQuery, field, authRw)
 	addUID(dgQuery)
 	addCascadeDirective(dgQuery, field)
@@ -376,6 +458,129 @@ func rewriteAsQuery(field schema.Field, authRw *authRewriter) *gql.GraphQuery {
 	return dgQuery
 }
 
+// rewriteAsPageQuery rewrites a page query into a query for the nodes and a query that counts
+// all the nodes matching the filter.  Both start from the same variable, so the count has the
+// same filter and auth as the nodes, but not the order and pagination.  So
+//
+// pagePost(filter: ..., first: 10) { nodes { title } totalCount }
+//
+// becomes
+//
+// queryPost(func: uid(Post1), first: 10) { title : Post.title ... }
+// Post1 as var(func: type(Post)) @filter(...)
+// pagePost(func: uid(Post1)) { count(uid) }
+func rewriteAsPageQuery(field schema.Query, authRw *authRewriter) *gql.GraphQuery {
+	nodes := field.NodesQuery()
+	if nodes.Type().InterfaceImplHasAuthRules() {
+		return &gql.GraphQuery{Attr: nodes.Name() + "()"}
+	}
+
+	dgQuery := rewriteAsQuery(nodes, authRw)
+
+	// The query for the nodes is always the first one, it might be wrapped along with the
+	// auth queries.
+	nodesQry := dgQuery
+	for nodesQry.Attr == "" && len(nodesQry.Children) > 0 {
+		nodesQry = nodesQry.Children[0]
+	}
+	if nodesQry.Func == nil {
+		// The auth rules resulted in nothing being allowed, so there's nothing to count.
+		return dgQuery
+	}
+
+	varName := authRw.varName
+	if !isUIDVarFunc(nodesQry.Func, varName) {
+		// There were no auth queries, so there's no variable yet that the query starts from.
+		if varName == "" {
+			varName = authRw.varGen.Next(nodes.Type(), "", "")
+		}
+		varQry := &gql.GraphQuery{
+			Var:    varName,
+			Attr:   "var",
+			Func:   nodesQry.Func,
+			Filter: nodesQry.Filter,
+		}
+		nodesQry.Func = &gql.Function{
+			Name: "uid",
+			Args: []gql.Arg{{Value: varName}},
+		}
+		nodesQry.Filter = nil
+		dgQuery = &gql.GraphQuery{Children: []*gql.GraphQuery{dgQuery, varQry}}
+	}
+
+	countQry := &gql.GraphQuery{
+		Attr:     field.Name(),
+		Func:     &gql.Function{Name: "uid", Args: []gql.Arg{{Value: varName}}},
+		Filter:   nodesQry.Filter,
+		Children: []*gql.GraphQuery{{Attr: "count(uid)"}},
+	}
+
+	blocks := []*gql.GraphQuery{dgQuery}
+	if len(nodesQry.Children) == 0 {
+		// Only totalCount was asked for, so there's no need to query the nodes.
+		blocks = withoutBlock(dgQuery, nodesQry)
+	}
+
+	return &gql.GraphQuery{Children: append(blocks, countQry)}
+}
+
+// withoutBlock returns the blocks of dgQuery, which might be wrapped along with other blocks,
+// leaving out block.
+func withoutBlock(dgQuery, block *gql.GraphQuery) []*gql.GraphQuery {
+	if dgQuery == block {
+		return nil
+	}
+	if dgQuery.Attr != "" {
+		return []*gql.GraphQuery{dgQuery}
+	}
+	var blocks []*gql.GraphQuery
+	for _, child := range dgQuery.Children {
+		blocks = append(blocks, withoutBlock(child, block)...)
+	}
+	return blocks
+}
+
+// rewriteAsGroupQuery rewrites a group query into a query for the nodes that's grouped by
+// the field's predicate and counts the nodes in each group.  So
+//
+// groupAuthorByReputation(filter: ...) { reputation count }
+//
+// becomes
+//
+// groupAuthorByReputation(func: type(Author)) @filter(...) @groupby(Author.reputation) {
+//   count(uid)
+// }
+func rewriteAsGroupQuery(field schema.Query, authRw *authRewriter) *gql.GraphQuery {
+	nodes, by := field.GroupedQuery()
+	if nodes.Type().InterfaceImplHasAuthRules() {
+		return &gql.GraphQuery{Attr: field.Name() + "()"}
+	}
+
+	dgQuery := rewriteAsQuery(nodes, authRw)
+
+	// The query for the nodes is always the first one, it might be wrapped along with the
+	// auth queries.
+	nodesQry := dgQuery
+	for nodesQry.Attr == "" && len(nodesQry.Children) > 0 {
+		nodesQry = nodesQry.Children[0]
+	}
+	if nodesQry.Func == nil {
+		// The auth rules resulted in nothing being allowed, so there's nothing to group.
+		return &gql.GraphQuery{Attr: field.Name() + "()"}
+	}
+
+	nodesQry.Attr = field.Name()
+	nodesQry.IsGroupby = true
+	nodesQry.GroupbyAttrs = []gql.GroupByAttr{{Attr: by.DgraphPredicate()}}
+	nodesQry.Children = []*gql.GraphQuery{{Attr: "count(uid)"}}
+	return dgQuery
+}
+
+func isUIDVarFunc(f *gql.Function, varName string) bool {
+	return varName != "" && f.Name == "uid" && len(f.UID) == 0 && len(f.Args) == 1 &&
+		f.Args[0].Value == varName
+}
+
 func (authRw *authRewriter) writingAuth() bool {
 	return authRw != nil && authRw.isWritingAuth
 
@@ -472,6 +677,22 @@ func (authRw *authRewriter) evaluateStaticRules(typ schema.Type) schema.RuleResu
 	return rn.EvaluateStatic(authRw.authVariables)
 }
 
+// fieldDenied returns true if the query rule of a field's @auth is false for the JWT.  Rules
+// on fields are RBAC rules, so they never need a query to decide.
+func (authRw *authRewriter) fieldDenied(rules *schema.AuthContainer) bool {
+	if authRw == nil || authRw.isWritingAuth {
+		return false
+	}
+	return fieldAuthDenied(rules, authRw.authVariables)
+}
+
+func fieldAuthDenied(rules *schema.AuthContainer, authVariables map[string]interface{}) bool {
+	if rules == nil || rules.Query == nil {
+		return false
+	}
+	return rules.Query.EvaluateStatic(authVariables) != schema.Positive
+}
+
 func (authRw *authRewriter) rewriteRuleNode(
 	typ schema.Type,
 	rn *schema.RuleNode) ([]*gql.GraphQuery, *gql.FilterTree) {
@@ -556,14 +777,87 @@ func (authRw *authRewriter) rewriteRuleNode(
 	return nil, nil
 }
 
+// addTypeFilter filters q down to the nodes of typ.  If typ has more than one Dgraph type, see
+// DgraphTypes, that's the nodes with any of them.
 func addTypeFilter(q *gql.GraphQuery, typ schema.Type) {
+	var typeFilters []*gql.FilterTree
+	for _, dgType := range typ.DgraphTypes() {
+		typeFilters = append(typeFilters, &gql.FilterTree{
+			Func: &gql.Function{
+				Name: "type",
+				Args: []gql.Arg{{Value: dgType}},
+			},
+		})
+	}
+	thisFilter := typeFilters[0]
+	if len(typeFilters) > 1 {
+		thisFilter = &gql.FilterTree{Op: "or", Child: typeFilters}
+	}
+
+	if q.Filter == nil {
+		q.Filter = thisFilter
+	} else {
+		q.Filter = &gql.FilterTree{
+			Op:    "and",
+			Child: []*gql.FilterTree{q.Filter, thisFilter},
+		}
+	}
+}
+
+// ttlNow is the time that the @ttl filters compare against.  Tests replace it to get
+// predictable queries.
+var ttlNow = time.Now
+
+// addTTLFilter filters q down to the nodes of typ that haven't expired, if typ has @ttl, e.g.
+// @filter(ge(Session.expiresAt, "2020-01-01T00:00:00Z")) for a Session with
+// @ttl(field: "expiresAt").  If the field is nullable, the nodes that don't have a value for it
+// never expire, so they are kept too, e.g.
+// @filter((NOT (has(Invite.expiresAt)) OR ge(Invite.expiresAt, "2020-01-01T00:00:00Z"))).
+func addTTLFilter(q *gql.GraphQuery, typ schema.Type) {
+	ttlField := typ.TTLField()
+	if ttlField == nil {
+		return
+	}
+
+	pred := typ.DgraphPredicate(ttlField.Name())
 	thisFilter := &gql.FilterTree{
 		Func: &gql.Function{
-			Name: "type",
-			Args: []gql.Arg{{Value: typ.DgraphName()}},
+			Name: "ge",
+			Args: []gql.Arg{
+				{Value: pred},
+				{Value: maybeQuoteArg("ge", ttlNow().UTC().Format(time.RFC3339))},
+			},
 		},
 	}
+	if ttlField.Type().Nullable() {
+		thisFilter = &gql.FilterTree{
+			Op:    "or",
+			Child: []*gql.FilterTree{buildPresenceFilter(pred, "hasNot", true), thisFilter},
+		}
+	}
+	if q.Filter == nil {
+		q.Filter = thisFilter
+	} else {
+		q.Filter = &gql.FilterTree{
+			Op:    "and",
+			Child: []*gql.FilterTree{q.Filter, thisFilter},
+		}
+	}
+}
+
+// addSoftDeleteFilter filters q, the nodes of typ that field finds, down to those that haven't
+// been soft deleted, if typ has @softDelete and field doesn't have includeDeleted: true, e.g.
+// @filter(NOT has(Post.deletedAt)) for a Post with @softDelete(field: "deletedAt").
+func addSoftDeleteFilter(q *gql.GraphQuery, typ schema.Type, field schema.Field) {
+	deletedField := typ.SoftDeleteField()
+	if deletedField == nil {
+		return
+	}
+	if includeDeleted, _ := field.ArgValue("includeDeleted").(bool); includeDeleted {
+		return
+	}
 
+	thisFilter := buildPresenceFilter(typ.DgraphPredicate(deletedField.Name()), "hasNot", true)
 	if q.Filter == nil {
 		q.Filter = thisFilter
 	} else {
@@ -581,12 +875,30 @@ func addUIDFunc(q *gql.GraphQuery, uids []uint64) {
 	}
 }
 
-func addTypeFunc(q *gql.GraphQuery, typ string) {
-	q.Func = &gql.Function{
-		Name: "type",
-		Args: []gql.Arg{{Value: typ}},
+// addTypeFunc makes q start from the nodes of typ.  Dgraph's type() only takes one type, so if
+// typ has more than one Dgraph type, see DgraphTypes, q starts from the nodes with any of them
+// in dgraph.type instead.
+func addTypeFunc(q *gql.GraphQuery, typ schema.Type) {
+	dgTypes := typ.DgraphTypes()
+	if len(dgTypes) == 1 {
+		q.Func = &gql.Function{
+			Name: "type",
+			Args: []gql.Arg{{Value: dgTypes[0]}},
+		}
+		return
 	}
 
+	quoted := make([]string, 0, len(dgTypes))
+	for _, dgType := range dgTypes {
+		quoted = append(quoted, strconv.Quote(dgType))
+	}
+	q.Func = &gql.Function{
+		Name: "eq",
+		Args: []gql.Arg{
+			{Value: "dgraph.type"},
+			{Value: "[" + strings.Join(quoted, ", ") + "]"},
+		},
+	}
 }
 
 // addSelectionSetFrom adds all the selections from field into q, and returns a list
@@ -623,14 +935,18 @@ func addSelectionSetFrom(
 
 	// These fields might not have been requested by the user directly as part of the query but
 	// are required in the body template for other fields requested within the query. We must
-	// fetch them from Dgraph.
-	requiredFields := make(map[string]bool)
+	// fetch them from Dgraph.  They are looked up in the type that the custom field is selected
+	// on, which for a fragment is the concrete type, rather than the interface that field is.
+	requiredFields := make(map[string]schema.Type)
 	addedFields := make(map[string]bool)
+	hidden := false
 	for _, f := range field.SelectionSet() {
 		hasCustom, rf := f.HasCustomDirective()
 		if hasCustom {
 			for k := range rf {
-				requiredFields[k] = true
+				if _, ok := requiredFields[k]; !ok {
+					requiredFields[k] = f.ObjectType()
+				}
 			}
 			// This field is resolved through a custom directive so its selection set doesn't need
 			// to be part of query rewriting.
@@ -642,6 +958,26 @@ func addSelectionSetFrom(
 		if f.Skip() || !f.Include() || f.Name() == schema.Typename {
 			continue
 		}
+		// A field that the JWT isn't authorized to see isn't queried, and completes as null.
+		if auth.fieldDenied(f.AuthRules()) {
+			hidden = true
+			continue
+		}
+		// A facet field is read from the edge that q follows to the node, rather than from a
+		// child of q.  A top-level query has no edge to the node, so the field completes as null.
+		if facet := f.ObjectType().DgraphFacet(f.Name()); facet != "" {
+			addFacet(q, facet, f.Name())
+			addedFields[f.Name()] = true
+			continue
+		}
+		// An aggregate field isn't a predicate, it's computed from the nodes of the list field
+		// that it aggregates.  The list can be a field of just the type a fragment is on.
+		if list := f.AggregatedField(); list != "" {
+			authQueries = append(authQueries,
+				addAggregateField(q, f.ObjectType(), list, f, auth)...)
+			addedFields[f.Name()] = true
+			continue
+		}
 
 		child := &gql.GraphQuery{}
 
@@ -655,9 +991,14 @@ func addSelectionSetFrom(
 
 		filter, _ := f.ArgValue("filter").(map[string]interface{})
 		addFilter(child, f.Type(), filter)
+		if !auth.writingAuth() {
+			addTTLFilter(child, f.Type())
+			addSoftDeleteFilter(child, f.Type(), f)
+		}
 		addOrder(child, f)
 		addPagination(child, f)
 		addCascadeDirective(child, f)
+		addLanguages(child, f)
 		rbac := auth.evaluateStaticRules(f.Type())
 
 		selectionAuth := addSelectionSetFrom(child, f, auth)
@@ -686,6 +1027,15 @@ func addSelectionSetFrom(
 		}
 	}
 
+	// If every field asked for is hidden, or is a facet, the uid still tells which nodes there
+	// are, so that the hidden fields complete as null, and the facets are read, for each of them.
+	if (hidden || q.Facets != nil) && len(q.Children) == 0 {
+		q.Children = append(q.Children, &gql.GraphQuery{
+			Attr:  "uid",
+			Alias: "dgraph.uid",
+		})
+	}
+
 	// Sort the required fields before adding them to q.Children so that the query produced after
 	// rewriting has a predictable order.
 	rfset := make([]string, 0, len(requiredFields))
@@ -697,15 +1047,24 @@ func addSelectionSetFrom(
 	// Add fields required by other custom fields which haven't already been added as a
 	// child to be fetched from Dgraph.
 	for _, fname := range rfset {
+		typ := requiredFields[fname]
+		if typeAuth := typ.AuthRules(); typeAuth != nil &&
+			auth.fieldDenied(typeAuth.Fields[fname]) {
+			continue
+		}
 		if _, ok := addedFields[fname]; !ok {
-			f := field.Type().Field(fname)
+			if facet := typ.DgraphFacet(fname); facet != "" {
+				addFacet(q, facet, fname)
+				continue
+			}
+			f := typ.Field(fname)
 			child := &gql.GraphQuery{}
 			child.Alias = f.Name()
 
 			if f.Type().Name() == schema.IDType {
 				child.Attr = "uid"
 			} else {
-				child.Attr = field.Type().DgraphPredicate(fname)
+				child.Attr = typ.DgraphPredicate(fname)
 			}
 			q.Children = append(q.Children, child)
 		}
@@ -714,6 +1073,122 @@ func addSelectionSetFrom(
 	return authQueries
 }
 
+// addAggregateField adds to q the queries that f, an aggregate of the nodes of the field list of
+// typ, is computed from for each node q finds.  The count counts the edges to the nodes, and the
+// other aggregates are computed from variables that the values of the nodes are read into.  f
+// has a filter of its own, separate from that of list, and the query rules of the nodes' type
+// apply just as they do to the list.  For Author.postsAggregate(filter: ...) { count scoreAvg }
+// that's like
+//
+//   postsAggregate : Author.posts @filter(...) {
+//     Post3 as Post.score
+//   }
+//   postsAggregate.count : count(Author.posts @filter(...))
+//   postsAggregate.scoreAvg : avg(val(Post3))
+//
+// completeAggregateFields puts the results together into the value of f.
+func addAggregateField(
+	q *gql.GraphQuery,
+	typ schema.Type,
+	list string,
+	f schema.Field,
+	auth *authRewriter) []*gql.GraphQuery {
+
+	nodesType := typ.Field(list).Type()
+	rbac := auth.evaluateStaticRules(nodesType)
+	if rbac == schema.Negative {
+		// None of the nodes can be seen, so there's nothing to aggregate.
+		return nil
+	}
+
+	nodes := &gql.GraphQuery{Alias: f.Name(), Attr: typ.DgraphPredicate(list)}
+	filter, _ := f.ArgValue("filter").(map[string]interface{})
+	addFilter(nodes, nodesType, filter)
+	if !auth.writingAuth() {
+		addTTLFilter(nodes, nodesType)
+		addSoftDeleteFilter(nodes, nodesType, f)
+	}
+
+	var authQueries []*gql.GraphQuery
+	if rbac == schema.Uncertain {
+		var authFilter *gql.FilterTree
+		authQueries, authFilter = auth.rewriteAuthQueries(nodesType)
+		if authFilter != nil {
+			if nodes.Filter == nil {
+				nodes.Filter = authFilter
+			} else {
+				nodes.Filter = &gql.FilterTree{
+					Op:    "and",
+					Child: []*gql.FilterTree{nodes.Filter, authFilter},
+				}
+			}
+		}
+	}
+
+	// The values of a field are read into one variable, however many aggregates use them.  The
+	// variables are defined before they are used.
+	vars := make(map[string]string)
+	var aggregates []*gql.GraphQuery
+	nodesAuth := nodesType.AuthRules()
+	for _, sel := range f.SelectionSet() {
+		if sel.Skip() || !sel.Include() {
+			continue
+		}
+		fld, fn := schema.AggregateOf(sel.Name())
+		if fld != "" && nodesAuth != nil && auth.fieldDenied(nodesAuth.Fields[fld]) {
+			// The values of a field the JWT can't see can't be aggregated either, so the
+			// aggregate completes as null.
+			continue
+		}
+		switch {
+		case fn == "count":
+			aggregates = append(aggregates, &gql.GraphQuery{
+				Alias:   aggregateAlias(f, sel),
+				Attr:    nodes.Attr,
+				IsCount: true,
+				Filter:  nodes.Filter,
+			})
+		case fn != "":
+			v, ok := vars[fld]
+			if !ok {
+				v = auth.varGen.Next(nodesType, "", "")
+				vars[fld] = v
+				nodes.Children = append(nodes.Children, &gql.GraphQuery{
+					Var:  v,
+					Attr: nodesType.DgraphPredicate(fld),
+				})
+			}
+			aggregates = append(aggregates, &gql.GraphQuery{
+				Alias: aggregateAlias(f, sel),
+				Attr:  fmt.Sprintf("%s(val(%s))", fn, v),
+			})
+		}
+	}
+	if len(nodes.Children) > 0 {
+		q.Children = append(q.Children, nodes)
+	}
+	q.Children = append(q.Children, aggregates...)
+	return authQueries
+}
+
+// aggregateAlias is what the aggregate sel of the aggregate field f is queried as.  Dgraph
+// returns it alongside the other fields of the node, rather than inside f.
+func aggregateAlias(f, sel schema.Field) string {
+	return f.Name() + "." + sel.Name()
+}
+
+// addFacet adds the facet, aliased as alias, to the facets that q reads from the edge it
+// follows.  It does nothing if q is a top-level query, because that doesn't follow an edge.
+func addFacet(q *gql.GraphQuery, facet, alias string) {
+	if q.Func != nil {
+		return
+	}
+	if q.Facets == nil {
+		q.Facets = &pb.FacetParams{}
+	}
+	q.Facets.Param = append(q.Facets.Param, &pb.FacetParam{Key: facet, Alias: alias})
+}
+
 func addOrder(q *gql.GraphQuery, field schema.Field) {
 	orderArg := field.ArgValue("order")
 	order, ok := orderArg.(map[string]interface{})
@@ -752,6 +1227,21 @@ func addCascadeDirective(q *gql.GraphQuery, field schema.Field) {
 	q.Cascade = field.Cascade()
 }
 
+// addLanguages adds the language tags from the lang argument of a @lang field, so
+// that `name(lang: ["en", "fr"])` is queried as `name@en:fr`.
+func addLanguages(q *gql.GraphQuery, field schema.Field) {
+	switch lang := field.ArgValue("lang").(type) {
+	case string:
+		q.Langs = []string{lang}
+	case []interface{}:
+		for _, l := range lang {
+			if s, ok := l.(string); ok {
+				q.Langs = append(q.Langs, s)
+			}
+		}
+	}
+}
+
 func convertIDs(idsSlice []interface{}) []uint64 {
 	ids := make([]uint64, 0, len(idsSlice))
 	for _, id := range idsSlice {
@@ -848,7 +1338,12 @@ func buildFilter(typ schema.Type, filter map[string]interface{}) *gql.FilterTree
 	// Each key in filter is either "and", "or", "not" or the field name it
 	// applies to such as "title" in: `title: { anyofterms: "GraphQL" }``
 	for _, field := range keys {
-		switch field {
+		op := field
+		if typ.DgraphPredicate(field) != "" {
+			// A field of the type that's called and, or or not is filtered on like any other.
+			op = ""
+		}
+		switch op {
 
 		// In 'and', 'or' and 'not' cases, filter[field] must be a map[string]interface{}
 		// or it would have failed GraphQL validation - e.g. 'filter: { and: 10 }'
@@ -888,6 +1383,56 @@ func buildFilter(typ schema.Type, filter map[string]interface{}) *gql.FilterTree
 				// OR
 				// numLikes: { le: 10 } -> le(Post.numLikes, 10)
 				fn, val := first(dgFunc)
+				if fn == "between" {
+					// reputation: { between: { min: 2.5, max: 5.0 } }
+					// -> ge(Author.reputation, 2.5) AND le(Author.reputation, 5.0)
+					ands = append(ands, buildBetweenFilter(typ.DgraphPredicate(field),
+						val.(map[string]interface{}))...)
+					continue
+				}
+				if fn == "phrase" {
+					// title: { phrase: "graph database" }
+					// -> allofterms(Post.title, "graph database") AND
+					//    regexp(Post.title, /(^|\W)graph\W+database(\W|$)/i)
+					ands = append(ands, buildPhraseFilter(typ.DgraphPredicate(field),
+						val.(string))...)
+					continue
+				}
+				if fn == "anyofregexp" {
+					// name: { anyofregexp: ["/^A.*/", "/^B.*/"] }
+					// -> (regexp(Author.name, /^A.*/) OR regexp(Author.name, /^B.*/))
+					if ft := buildAnyOfRegExpFilter(typ.DgraphPredicate(field),
+						val); ft != nil {
+						ands = append(ands, ft)
+					}
+					continue
+				}
+				if fn == "in" {
+					// postType: { in: [Fact, Question] }
+					// -> eq(Post.postType, ["Fact", "Question"])
+					if ft := buildInFilter(typ.DgraphPredicate(field), val); ft != nil {
+						ands = append(ands, ft)
+					}
+					continue
+				}
+				if fn == "contains" || fn == "intersects" || fn == "within" {
+					// region: { contains: [ 1.5, 2.5 ] }
+					// -> contains(Area.region, [1.5,2.5])
+					if ft := buildGeoFilter(typ.DgraphPredicate(field), fn, val); ft != nil {
+						ands = append(ands, ft)
+					}
+					continue
+				}
+				if fn == "has" || fn == "hasNot" {
+					// name: { has: true } -> has(Author.name)
+					// OR
+					// name: { hasNot: true } -> NOT has(Author.name)
+					if ft := buildPresenceFilter(typ.DgraphPredicate(field), fn,
+						val); ft != nil {
+						ands = append(ands, ft)
+					}
+					continue
+				}
 				ands = append(ands, &gql.FilterTree{
 					Func: &gql.Function{
 						Name: fn,
@@ -944,6 +1489,155 @@ func buildFilter(typ schema.Type, filter map[string]interface{}) *gql.FilterTree
 	}
 }
 
+// buildBetweenFilter builds the filters for an inclusive range on pred.  Dgraph doesn't have
+// a between function, so the range is a ge and a le on the same predicate, which can both be
+// answered from the predicate's index.
+func buildBetweenFilter(pred string, rng map[string]interface{}) []*gql.FilterTree {
+	return []*gql.FilterTree{
+		{
+			Func: &gql.Function{
+				Name: "ge",
+				Args: []gql.Arg{{Value: pred}, {Value: maybeQuoteArg("ge", rng["min"])}},
+			},
+		},
+		{
+			Func: &gql.Function{
+				Name: "le",
+				Args: []gql.Arg{{Value: pred}, {Value: maybeQuoteArg("le", rng["max"])}},
+			},
+		},
+	}
+}
+
+// buildPhraseFilter builds the filters for matching the terms of phrase in the same order and
+// next to each other in pred.  The term index only finds the values having all the terms, so
+// the order is then checked with a regexp over those values.
+func buildPhraseFilter(pred, phrase string) []*gql.FilterTree {
+	filters := []*gql.FilterTree{
+		{
+			Func: &gql.Function{
+				Name: "allofterms",
+				Args: []gql.Arg{{Value: pred}, {Value: maybeQuoteArg("allofterms", phrase)}},
+			},
+		},
+	}
+
+	terms := strings.FieldsFunc(phrase, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) < 2 {
+		// there is no order to check for a single term
+		return filters
+	}
+	return append(filters, &gql.FilterTree{
+		Func: &gql.Function{
+			Name: "regexp",
+			Args: []gql.Arg{
+				{Value: pred},
+				{Value: fmt.Sprintf(`/(^|\W)%s(\W|$)/i`, strings.Join(terms, `\W+`))},
+			},
+		},
+	})
+}
+
+// buildAnyOfRegExpFilter builds an OR of a regexp function for each pattern in patterns.  It
+// returns nil if there are no patterns, so an empty list doesn't filter anything out.
+func buildAnyOfRegExpFilter(pred string, patterns interface{}) *gql.FilterTree {
+	var list []interface{}
+	switch p := patterns.(type) {
+	case []interface{}:
+		list = p
+	case string:
+		// A single pattern is accepted for a list, as a list of one.
+		list = []interface{}{p}
+	}
+
+	ors := make([]*gql.FilterTree, 0, len(list))
+	for _, pattern := range list {
+		ors = append(ors, &gql.FilterTree{
+			Func: &gql.Function{
+				Name: "regexp",
+				Args: []gql.Arg{{Value: pred}, {Value: maybeQuoteArg("regexp", pattern)}},
+			},
+		})
+	}
+
+	switch len(ors) {
+	case 0:
+		return nil
+	case 1:
+		return ors[0]
+	default:
+		return &gql.FilterTree{Op: "or", Child: ors}
+	}
+}
+
+// buildInFilter builds the filter for an enum field on pred being any of vals.  Dgraph's eq
+// takes a list of values, so that's a single eq.
+func buildInFilter(pred string, vals interface{}) *gql.FilterTree {
+	var list []interface{}
+	switch v := vals.(type) {
+	case []interface{}:
+		list = v
+	case string:
+		// A single value is accepted for a list, as a list of one.
+		list = []interface{}{v}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, 0, len(list))
+	for _, val := range list {
+		quoted = append(quoted, maybeQuoteArg("eq", val))
+	}
+	return &gql.FilterTree{
+		Func: &gql.Function{
+			Name: "eq",
+			Args: []gql.Arg{{Value: pred}, {Value: "[" + strings.Join(quoted, ", ") + "]"}},
+		},
+	}
+}
+
+// buildGeoFilter builds the filter for fn, one of Dgraph's geo functions, on pred.  val is a
+// point or a Polygon's coordinates, which Dgraph takes as they are, in JSON.
+func buildGeoFilter(pred, fn string, val interface{}) *gql.FilterTree {
+	if val == nil {
+		return nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil
+	}
+	return &gql.FilterTree{
+		Func: &gql.Function{
+			Name: fn,
+			Args: []gql.Arg{{Value: pred}, {Value: string(b)}},
+		},
+	}
+}
+
+// buildPresenceFilter builds the filter for fn, which is either has or hasNot, on pred.  A
+// false value asks for the opposite, so hasNot: false is the same as has: true.  It returns nil
+// for a null value, which doesn't filter anything out.
+func buildPresenceFilter(pred, fn string, val interface{}) *gql.FilterTree {
+	present, ok := val.(bool)
+	if !ok {
+		return nil
+	}
+
+	has := &gql.FilterTree{
+		Func: &gql.Function{
+			Name: "has",
+			Args: []gql.Arg{{Value: pred}},
+		},
+	}
+	if present == (fn == "has") {
+		return has
+	}
+	return &gql.FilterTree{Op: "not", Child: []*gql.FilterTree{has}}
+}
+
 func maybeQuoteArg(fn string, arg interface{}) string {
 	switch arg := arg.(type) {
 	case string: // dateTime also parsed as string
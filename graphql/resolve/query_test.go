@@ -22,19 +22,29 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dgraph-io/dgraph/graphql/dgraph"
 	"github.com/dgraph-io/dgraph/graphql/schema"
 	"github.com/dgraph-io/dgraph/graphql/test"
 	"github.com/dgraph-io/dgraph/testutil"
+	"github.com/dgraph-io/dgraph/x"
 	"github.com/stretchr/testify/require"
 	_ "github.com/vektah/gqlparser/v2/validator/rules" // make gql validator init() all rules
+	otrace "go.opencensus.io/trace"
 	"gopkg.in/yaml.v2"
 )
 
 // Tests showing that the query rewriter produces the expected Dgraph queries
 
+func init() {
+	// The @ttl filters compare against the time of the rewrite, so it's fixed for the rewritten
+	// queries to be the same on every run.
+	ttlNow = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+}
+
 type QueryRewritingCase struct {
 	Name      string
 	GQLQuery  string
@@ -72,6 +82,166 @@ func TestQueryRewriting(t *testing.T) {
 	}
 }
 
+// Tests that the generated input types given as variables are coerced into the same arguments
+// as when they are given as literals, so both are rewritten the same.
+func TestInputVariablesRewriting(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
+
+	tcases := map[string]struct {
+		literal   string
+		withVars  string
+		variables string
+		rewriter  func() MutationRewriter
+	}{
+		"nested and, or and not filters": {
+			literal: `query {
+				queryPost(filter: {
+					title: {anyofterms: "GraphQL"},
+					or: {
+						numLikes: {ge: 10},
+						and: {isPublished: true, not: {postType: {eq: Question}}}
+					}
+				}) { title }
+			}`,
+			withVars: `query ($filter: PostFilter) { queryPost(filter: $filter) { title } }`,
+			variables: `{"filter": {
+				"title": {"anyofterms": "GraphQL"},
+				"or": {
+					"numLikes": {"ge": 10},
+					"and": {"isPublished": true, "not": {"postType": {"eq": "Question"}}}
+				}
+			}}`,
+		},
+		"single ID given for a list of IDs": {
+			literal:   `query { queryPost(filter: {postID: ["0x1"]}) { title } }`,
+			withVars:  `query ($filter: PostFilter) { queryPost(filter: $filter) { title } }`,
+			variables: `{"filter": {"postID": "0x1"}}`,
+		},
+		"order": {
+			literal: `query {
+				queryPost(order: {desc: numLikes, then: {asc: title}}, first: 2) { title }
+			}`,
+			withVars: `query ($order: PostOrder, $first: Int) {
+				queryPost(order: $order, first: $first) { title }
+			}`,
+			variables: `{"order": {"desc": "numLikes", "then": {"asc": "title"}}, "first": 2}`,
+		},
+		"patch": {
+			literal: `mutation {
+				updatePost(input: {
+					filter: {postID: ["0x1"], not: {numLikes: {lt: 3}}},
+					set: {text: "updated", numLikes: 4, tags: ["a"]},
+					remove: {postType: [Fact]}
+				}) { numUids }
+			}`,
+			withVars: `mutation ($input: UpdatePostInput!) { updatePost(input: $input) { numUids } }`,
+			variables: `{"input": {
+				"filter": {"postID": "0x1", "not": {"numLikes": {"lt": 3}}},
+				"set": {"text": "updated", "numLikes": 4, "tags": "a"},
+				"remove": {"postType": "Fact"}
+			}}`,
+			rewriter: NewUpdateRewriter,
+		},
+		"refs": {
+			literal: `mutation {
+				addPost(input: [{title: "A post", numLikes: 1, author: {id: "0x2"}}]) { numUids }
+			}`,
+			withVars:  `mutation ($post: [AddPostInput!]!) { addPost(input: $post) { numUids } }`,
+			variables: `{"post": {"title": "A post", "numLikes": 1, "author": {"id": "0x2"}}}`,
+			rewriter:  NewAddRewriter,
+		},
+	}
+
+	rewrite := func(t *testing.T, query string, vars map[string]interface{},
+		rewriter func() MutationRewriter) string {
+
+		op, err := gqlSchema.Operation(&schema.Request{Query: query, Variables: vars})
+		require.NoError(t, err)
+		if rewriter == nil {
+			dgQuery, err := NewQueryRewriter().Rewrite(context.Background(), test.GetQuery(t, op))
+			require.NoError(t, err)
+			return dgraph.AsString(dgQuery)
+		}
+		upserts, err := rewriter().Rewrite(context.Background(), test.GetMutation(t, op))
+		require.NoError(t, err)
+		var rewritten string
+		for _, upsert := range upserts {
+			rewritten += dgraph.AsString(upsert.Query)
+			for _, mut := range upsert.Mutations {
+				rewritten += mut.Cond + string(mut.SetJson) + string(mut.DeleteJson)
+			}
+		}
+		return rewritten
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			// Variables are decoded the way the server decodes them, with numbers as json.Number.
+			d := json.NewDecoder(bytes.NewBufferString(tcase.variables))
+			d.UseNumber()
+			var vars map[string]interface{}
+			require.NoError(t, d.Decode(&vars))
+
+			require.Equal(t, rewrite(t, tcase.literal, nil, tcase.rewriter),
+				rewrite(t, tcase.withVars, vars, tcase.rewriter))
+		})
+	}
+
+	t.Run("invalid variables are rejected", func(t *testing.T) {
+		for _, invalid := range []struct{ variables, err string }{
+			{`{"filter": {"or": {"not": {"numLikes": {"ge": 1}, "likes": 1}}}}`, "likes"},
+			{`{"filter": {"and": {"postType": {"eq": "Rumour"}}}}`, "Rumour"},
+		} {
+			var vars map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(invalid.variables), &vars))
+			_, err := gqlSchema.Operation(&schema.Request{
+				Query:     `query ($filter: PostFilter) { queryPost(filter: $filter) { title } }`,
+				Variables: vars,
+			})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), invalid.err)
+		}
+	})
+}
+
+// Tests that the fields in fragments on the implementations of an interface, nested inside
+// the payload of a mutation, are looked up in the type the fragment is on, just as they are in
+// queries.
+func TestNestedFragmentPredicatesInMutationPayload(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
+
+	op, err := gqlSchema.Operation(&schema.Request{Query: `mutation {
+		updateSquadron(input: {filter: {id: ["0x1"]}, set: {name: "S"}}) {
+			squadron {
+				pilots {
+					... on HumanPilot { rank starshipsAggregate { count } }
+				}
+			}
+		}
+	}`})
+	require.NoError(t, err)
+	mut := test.GetMutation(t, op)
+	rewriter := NewUpdateRewriter()
+	_, err = rewriter.Rewrite(context.Background(), mut)
+	require.NoError(t, err)
+
+	dgQuery, err := rewriter.FromMutationResult(context.Background(), mut, nil,
+		map[string]interface{}{
+			"updateSquadron": []interface{}{map[string]interface{}{"uid": "0x1"}}})
+	require.NoError(t, err)
+	require.Equal(t, `query {
+  squadron(func: uid(0x1)) {
+    pilots : Squadron.pilots {
+      dgraph.type
+      starshipsAggregate.count : count(human.starships)
+      id : uid
+      totalCredits : credits
+    }
+    dgraph.uid : uid
+  }
+}`, dgraph.AsString(dgQuery))
+}
+
 type HTTPRewritingCase struct {
 	Name             string
 	GQLQuery         string
@@ -164,3 +334,270 @@ func TestCustomHTTPQuery(t *testing.T) {
 		})
 	}
 }
+
+type spanRecorder struct {
+	spans []*otrace.SpanData
+}
+
+func (sr *spanRecorder) ExportSpan(sd *otrace.SpanData) {
+	sr.spans = append(sr.spans, sd)
+}
+
+func TestCustomHTTPQueryPropagatesTrace(t *testing.T) {
+	sch, err := ioutil.ReadFile("schema.graphql")
+	require.NoError(t, err)
+
+	query := `query {
+		myFavoriteMovies(id: "0x1", name: "Michael", num: null) { id name }
+	}`
+
+	tests := map[string]struct {
+		schema    string
+		propagate bool
+	}{
+		"trace headers are sent by default": {
+			schema:    string(sch),
+			propagate: true,
+		},
+		"trace headers aren't sent when the schema opts out": {
+			schema: "# Dgraph.NoTracePropagation\n" + string(sch),
+		},
+	}
+
+	for name, tcase := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := &spanRecorder{}
+			otrace.RegisterExporter(rec)
+			defer otrace.UnregisterExporter(rec)
+
+			gqlSchema := test.LoadSchemaFromString(t, tcase.schema)
+			op, err := gqlSchema.Operation(&schema.Request{Query: query})
+			require.NoError(t, err)
+			gqlQuery := test.GetQuery(t, op)
+
+			ctx, parent := otrace.StartSpan(context.Background(), "parent",
+				otrace.WithSampler(otrace.AlwaysSample()))
+			var header http.Header
+			client := NewTestClient(func(req *http.Request) *http.Response {
+				header = req.Header
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewBufferString(`[]`)),
+					Header:     make(http.Header),
+				}
+			})
+			resolver := NewHTTPQueryResolver(client, StdQueryCompletion())
+			resolver.Resolve(ctx, gqlQuery)
+			parent.End()
+
+			traceID := parent.SpanContext().TraceID.String()
+			if tcase.propagate {
+				require.Contains(t, header.Get("traceparent"), traceID)
+			} else {
+				require.Empty(t, header.Get("traceparent"))
+			}
+
+			var remote *otrace.SpanData
+			for _, sd := range rec.spans {
+				if sd.Name == "Query.myFavoriteMovies" {
+					remote = sd
+				}
+			}
+			require.NotNil(t, remote)
+			require.Equal(t, otrace.SpanKindClient, remote.SpanKind)
+			require.Equal(t, parent.SpanContext().SpanID, remote.ParentSpanID)
+			require.Equal(t, "myapi.com", remote.Attributes["http.host"])
+			require.Equal(t, "GET", remote.Attributes["http.method"])
+			require.Equal(t, int64(200), remote.Attributes["http.status_code"])
+		})
+	}
+}
+
+// Tests that the Content-Type of a request to a @custom endpoint is the one in the field's
+// FieldHTTPConfig, and that a request without a body has none.
+func TestCustomHTTPQuerySendsContentType(t *testing.T) {
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		_, _ = w.Write([]byte(`{"name": "India"}`))
+	}))
+	defer srv.Close()
+
+	gqlSchema := test.LoadSchemaFromString(t, `
+	type Country @remote {
+		name: String
+	}
+
+	type Query {
+		postCountry(code: String!): Country @custom(http: {
+			url: "`+srv.URL+`",
+			method: "POST",
+			body: "{ code: $code }",
+			forwardHeaders: ["Content-Type"]
+		})
+		getCountry(code: String!): Country @custom(http: {
+			url: "`+srv.URL+`/$code",
+			method: "GET"
+		})
+	}`)
+
+	tcases := map[string]struct {
+		field       string
+		contentType string
+	}{
+		"request with a body": {
+			field:       "postCountry",
+			contentType: "application/json",
+		},
+		"request without a body": {
+			field: "getCountry",
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			contentType = ""
+			op, err := gqlSchema.Operation(&schema.Request{
+				Query:  `query { ` + tcase.field + `(code: "IN") { name } }`,
+				Header: http.Header{"Content-Type": []string{"text/plain"}},
+			})
+			require.NoError(t, err)
+			gqlQuery := test.GetQuery(t, op)
+
+			fconfs, err := gqlQuery.CustomHTTPConfig(nil)
+			require.NoError(t, err)
+			require.Len(t, fconfs, 1)
+			require.Equal(t, tcase.contentType, fconfs[0].ContentType)
+
+			resolver := NewHTTPQueryResolver(newHTTPClient(), StdQueryCompletion())
+			resolved := resolver.Resolve(context.Background(), gqlQuery)
+			require.Nil(t, resolved.Err)
+			require.Equal(t, tcase.contentType, contentType)
+		})
+	}
+}
+
+func TestCustomHTTPQueryErrorHandling(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name": "India"}`))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/invalid", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"error": {"message": "no country with that code"}}`))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	gqlSchema := test.LoadSchemaFromString(t, `
+	type Country @remote {
+		name: String
+	}
+
+	type Query {
+		country(path: String!): Country @custom(http: {
+			url: "`+srv.URL+`/$path",
+			method: "GET",
+			errorHandling: {nullOn: [404], messagePath: "error.message", propagateStatus: true}
+		})
+		plainCountry(path: String!): Country @custom(http: {
+			url: "`+srv.URL+`/$path",
+			method: "GET"
+		})
+	}`)
+
+	tcases := map[string]struct {
+		field  string
+		path   string
+		data   string
+		err    string
+		status int
+	}{
+		"2xx status gives the result": {
+			field: "country",
+			path:  "ok",
+			data:  `{"country": {"name": "India"}}`,
+		},
+		"redirect is followed": {
+			field: "country",
+			path:  "moved",
+			data:  `{"country": {"name": "India"}}`,
+		},
+		"too many redirects is an error with the redirect's status": {
+			field:  "country",
+			path:   "loop",
+			data:   `{"country": null}`,
+			err:    "Found",
+			status: http.StatusFound,
+		},
+		"status in nullOn gives null without an error": {
+			field: "country",
+			path:  "missing",
+			data:  `{"country": null}`,
+		},
+		"error message is taken from the response": {
+			field:  "country",
+			path:   "invalid",
+			data:   `{"country": null}`,
+			err:    "no country with that code",
+			status: http.StatusUnprocessableEntity,
+		},
+		"error message falls back on the status text": {
+			field:  "country",
+			path:   "broken",
+			data:   `{"country": null}`,
+			err:    "Internal Server Error",
+			status: http.StatusInternalServerError,
+		},
+		"without errorHandling any status that isn't 2xx is an external request error": {
+			field: "plainCountry",
+			path:  "missing",
+			data:  `{"plainCountry": null}`,
+			err: "Evaluation of custom field failed because external request returned an " +
+				"error: unexpected status code: 404 for field: plainCountry within type: Query.",
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			op, err := gqlSchema.Operation(&schema.Request{
+				Query: `query { ` + tcase.field + `(path: "` + tcase.path + `") { name } }`,
+			})
+			require.NoError(t, err)
+			gqlQuery := test.GetQuery(t, op)
+
+			resolver := NewHTTPQueryResolver(newHTTPClient(), StdQueryCompletion())
+			resolved := resolver.Resolve(context.Background(), gqlQuery)
+			b, err := json.Marshal(resolved.Data)
+			require.NoError(t, err)
+			require.JSONEq(t, tcase.data, string(b))
+
+			if tcase.err == "" {
+				require.Nil(t, resolved.Err)
+				return
+			}
+			gqlErrs, ok := resolved.Err.(x.GqlErrorList)
+			require.True(t, ok)
+			require.Len(t, gqlErrs, 1)
+			require.Equal(t, tcase.err, gqlErrs[0].Message)
+			if tcase.status == 0 {
+				require.Nil(t, gqlErrs[0].Extensions)
+			} else {
+				require.Equal(t, map[string]interface{}{"status": tcase.status},
+					gqlErrs[0].Extensions)
+			}
+		})
+	}
+}
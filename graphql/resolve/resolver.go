@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math"
@@ -27,9 +28,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/dgraph/edgraph"
+	"github.com/dgraph-io/dgraph/graphql/authorization"
 	"github.com/dgraph-io/dgraph/graphql/dgraph"
 	"github.com/dgraph-io/dgraph/types"
 
@@ -37,6 +40,9 @@ import (
 	"github.com/dgraph-io/dgraph/graphql/api"
 	"github.com/dgraph-io/dgraph/x"
 	"github.com/pkg/errors"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	ostats "go.opencensus.io/stats"
 	"go.opencensus.io/trace"
 	otrace "go.opencensus.io/trace"
 
@@ -48,9 +54,25 @@ import (
 type resolveCtxKey string
 
 const (
-	methodResolve = "RequestResolver.Resolve"
+	methodResolve      = "RequestResolver.Resolve"
+	methodResolveBatch = "RequestResolver.ResolveBatch"
 
 	resolveStartTime resolveCtxKey = "resolveStartTime"
+	// loopbackKey is the key of the *loopback that loopback requests are resolved with.
+	loopbackKey resolveCtxKey = "loopback"
+	// subscriptionKey is the key of the *SubscriptionState that subscribeT fields are
+	// resolved against.
+	subscriptionKey resolveCtxKey = "subscription"
+	// readTsKey is the key of the *readTs that the queries of a batch read at.
+	readTsKey resolveCtxKey = "readTs"
+
+	// defaultMaxLoopbackDepth is how deep loopback requests can be nested, if the schema's
+	// limits don't say.
+	defaultMaxLoopbackDepth = 3
+
+	// maxRedirects is how many redirects a request to a remote endpoint follows.  After that,
+	// the redirect is the response, so it's resolved like any other status that isn't 2xx.
+	maxRedirects = 10
 
 	resolverFailed    = false
 	resolverSucceeded = true
@@ -143,11 +165,12 @@ type resolverFactory struct {
 
 // ResolverFns is a convenience struct for passing blocks of rewriters and executors.
 type ResolverFns struct {
-	Qrw QueryRewriter
-	Arw func() MutationRewriter
-	Urw func() MutationRewriter
-	Drw MutationRewriter
-	Ex  DgraphExecutor
+	Qrw  QueryRewriter
+	Arw  func() MutationRewriter
+	Urw  func() MutationRewriter
+	Uprw func() MutationRewriter
+	Drw  MutationRewriter
+	Ex   DgraphExecutor
 }
 
 // dgraphExecutor is an implementation of both QueryExecutor and MutationExecutor
@@ -243,18 +266,31 @@ func (rf *resolverFactory) WithConventionResolvers(
 
 	queries := append(s.Queries(schema.GetQuery), s.Queries(schema.FilterQuery)...)
 	queries = append(queries, s.Queries(schema.PasswordQuery)...)
+	queries = append(queries, s.Queries(schema.PageQuery)...)
+	queries = append(queries, s.Queries(schema.GroupByQuery)...)
+	queries = append(queries, s.Queries(schema.DQLQuery)...)
 	for _, q := range queries {
 		rf.WithQueryResolver(q, func(q schema.Query) QueryResolver {
 			return NewQueryResolver(fns.Qrw, fns.Ex, StdQueryCompletion())
 		})
 	}
 
+	for _, q := range s.Queries(schema.NodeQuery) {
+		rf.WithQueryResolver(q, func(q schema.Query) QueryResolver {
+			return NewNodeQueryResolver(NewQueryResolver(fns.Qrw, fns.Ex, StdQueryCompletion()))
+		})
+	}
+
+	for _, q := range s.Queries(schema.SubscribeQuery) {
+		rf.WithQueryResolver(q, func(q schema.Query) QueryResolver {
+			return NewSubscribeQueryResolver(NewQueryResolver(fns.Qrw, fns.Ex,
+				StdQueryCompletion()))
+		})
+	}
+
 	for _, q := range s.Queries(schema.HTTPQuery) {
 		rf.WithQueryResolver(q, func(q schema.Query) QueryResolver {
-			return NewHTTPQueryResolver(&http.Client{
-				// TODO - This can be part of a config later.
-				Timeout: time.Minute,
-			}, StdQueryCompletion())
+			return NewHTTPQueryResolver(newHTTPClient(), StdQueryCompletion())
 		})
 	}
 
@@ -264,6 +300,12 @@ func (rf *resolverFactory) WithConventionResolvers(
 		})
 	}
 
+	for _, m := range s.Mutations(schema.UpsertMutation) {
+		rf.WithMutationResolver(m, func(m schema.Mutation) MutationResolver {
+			return NewDgraphResolver(fns.Uprw(), fns.Ex, StdMutationCompletion(m.Name()))
+		})
+	}
+
 	for _, m := range s.Mutations(schema.UpdateMutation) {
 		rf.WithMutationResolver(m, func(m schema.Mutation) MutationResolver {
 			return NewDgraphResolver(fns.Urw(), fns.Ex, StdMutationCompletion(m.Name()))
@@ -278,10 +320,7 @@ func (rf *resolverFactory) WithConventionResolvers(
 
 	for _, m := range s.Mutations(schema.HTTPMutation) {
 		rf.WithMutationResolver(m, func(m schema.Mutation) MutationResolver {
-			return NewHTTPMutationResolver(&http.Client{
-				// TODO - This can be part of a config later.
-				Timeout: time.Minute,
-			}, StdQueryCompletion())
+			return NewHTTPMutationResolver(newHTTPClient(), StdQueryCompletion())
 		})
 	}
 
@@ -364,6 +403,23 @@ func New(s schema.Schema, resolverFactory ResolverFactory) *RequestResolver {
 	}
 }
 
+// withAuthMeta returns ctx in which the request of op is authorized with the
+// # Dgraph.Authorization of the schema op was built against.  Each namespace's schema has its
+// own, so requests for one namespace are never authorized with another's.  If the schema has no
+// authorization, no JWT is accepted.
+func withAuthMeta(ctx context.Context, op schema.Operation) context.Context {
+	meta := op.Schema().AuthMeta()
+	if meta == nil {
+		meta = &authorization.AuthMeta{}
+	}
+	return authorization.AttachAuthMeta(ctx, meta)
+}
+
+// Schema returns the schema that r resolves requests against.
+func (r *RequestResolver) Schema() schema.Schema {
+	return r.schema
+}
+
 // Resolve processes r.GqlReq and returns a GraphQL response.
 // r.GqlReq should be set with a request before Resolve is called
 // and a schema and backend Dgraph should have been added.
@@ -384,6 +440,98 @@ func (r *RequestResolver) Resolve(ctx context.Context, gqlReq *schema.Request) *
 	}
 
 	startTime := time.Now()
+	op, err := r.schema.Operation(gqlReq)
+	return r.resolveOperation(ctx, startTime, gqlReq, op, err)
+}
+
+// ResolveBatch resolves a batch of requests, like those that Apollo's batch link sends in one
+// HTTP call, and returns their responses in the same order.  Each request is resolved as it
+// would be on its own, so an error in one doesn't affect the others, except that:
+//  - the operations are built concurrently, at most x.Config.GraphqlBatchParallelism at a
+//    time, or all at once if that's 0;
+//  - the queries between two mutations are resolved concurrently, with the same limit, and
+//    read at the same timestamp where they can;
+//  - a mutation is resolved after the requests before it, and before those after it.
+func (r *RequestResolver) ResolveBatch(ctx context.Context,
+	gqlReqs []*schema.Request) []*schema.Response {
+
+	ctx, span := otrace.StartSpan(ctx, methodResolveBatch)
+	defer span.End()
+	span.AddAttributes(otrace.Int64Attribute("batch_size", int64(len(gqlReqs))))
+	ostats.Record(ctx, x.GraphqlBatchSize.M(int64(len(gqlReqs))))
+
+	resps := make([]*schema.Response, len(gqlReqs))
+	if r == nil || r.schema == nil {
+		for i, gqlReq := range gqlReqs {
+			resps[i] = r.Resolve(ctx, gqlReq)
+		}
+		return resps
+	}
+
+	startTimes := make([]time.Time, len(gqlReqs))
+	ops := make([]schema.Operation, len(gqlReqs))
+	errs := make([]error, len(gqlReqs))
+	inParallel(len(gqlReqs), func(i int) {
+		defer api.PanicHandler(func(err error) { errs[i] = err })
+		startTimes[i] = time.Now()
+		ops[i], errs[i] = r.schema.Operation(gqlReqs[i])
+	})
+
+	resolveAt := func(ctx context.Context, i int) {
+		defer api.PanicHandler(func(err error) { resps[i] = schema.ErrorResponse(err) })
+		stop := x.SpanTimer(span, methodResolve)
+		defer stop()
+		resps[i] = r.resolveOperation(ctx, startTimes[i], gqlReqs[i], ops[i], errs[i])
+	}
+	isMutation := func(i int) bool { return errs[i] == nil && ops[i].IsMutation() }
+	for start := 0; start < len(gqlReqs); {
+		if isMutation(start) {
+			resolveAt(ctx, start)
+			start++
+			continue
+		}
+		end := start
+		for end < len(gqlReqs) && !isMutation(end) {
+			end++
+		}
+		// The queries after a mutation must see it, so they don't share the timestamp of the
+		// queries before it.
+		queryCtx := context.WithValue(ctx, readTsKey, &readTs{})
+		first := start
+		inParallel(end-start, func(i int) { resolveAt(queryCtx, first+i) })
+		start = end
+	}
+	return resps
+}
+
+// inParallel calls f(i) for each 0 <= i < n, with at most x.Config.GraphqlBatchParallelism
+// calls running at a time, or all of them if that's 0, and waits for them all to return.
+func inParallel(n int, f func(i int)) {
+	limit := x.Config.GraphqlBatchParallelism
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// resolveOperation resolves op, the operation that was built from gqlReq, or returns the
+// error it failed to build with.  startTime is when resolving gqlReq started.
+func (r *RequestResolver) resolveOperation(ctx context.Context, startTime time.Time,
+	gqlReq *schema.Request, op schema.Operation, err error) *schema.Response {
+
 	resp := &schema.Response{
 		Extensions: &schema.Extensions{
 			Tracing: &schema.Trace{
@@ -398,11 +546,20 @@ func (r *RequestResolver) Resolve(ctx context.Context, gqlReq *schema.Request) *
 		resp.Extensions.Tracing.Duration = endTime.Sub(startTime).Nanoseconds()
 	}()
 	ctx = context.WithValue(ctx, resolveStartTime, startTime)
+	// A loopback request is resolved within the request that made it, which already says
+	// how deep it is.
+	if ctx.Value(loopbackKey) == nil {
+		ctx = context.WithValue(ctx, loopbackKey, &loopback{resolver: r})
+	}
 
-	op, err := r.schema.Operation(gqlReq)
 	if err != nil {
 		return schema.ErrorResponse(err)
 	}
+	// The JWT of the request is verified with the authorization of the schema it's for.
+	ctx = withAuthMeta(ctx, op)
+	if warnings := op.Warnings(); len(warnings) != 0 {
+		resp.Extensions.Warnings = schema.AsGQLErrors(warnings)
+	}
 
 	if glog.V(3) {
 		// don't log the introspection queries they are sent too frequently
@@ -730,11 +887,20 @@ func completeDgraphResult(
 		// case
 	}
 
-	err = resolveCustomFields(field.SelectionSet(), valToComplete[field.Name()])
+	completeAggregateFields(field.SelectionSet(), valToComplete[field.Name()])
+
+	err = resolveCustomFields(ctx, field.SelectionSet(), valToComplete[field.Name()])
 	if err != nil {
 		errs = append(errs, schema.AsGQLErrors(err)...)
 	}
 
+	if hasFieldAuthRules(field.SelectionSet()) {
+		// An invalid JWT would have already failed the query rewriting, and without claims no
+		// field rule can pass anyway.
+		authVariables, _ := authorization.ExtractAuthVariables(ctx)
+		hideFieldsDeniedByAuth(field.SelectionSet(), valToComplete[field.Name()], authVariables)
+	}
+
 	return &Resolved{
 		Data:  valToComplete,
 		Field: field,
@@ -742,19 +908,6 @@ func completeDgraphResult(
 	}
 }
 
-func copyTemplate(input interface{}) (interface{}, error) {
-	b, err := json.Marshal(input)
-	if err != nil {
-		return nil, errors.Wrapf(err, "while marshaling map input: %+v", input)
-	}
-
-	var result interface{}
-	if err := json.Unmarshal(b, &result); err != nil {
-		return nil, errors.Wrapf(err, "while unmarshalling into map: %s", b)
-	}
-	return result, nil
-}
-
 func keyNotFoundError(f schema.Field, key string) *x.GqlError {
 	return x.GqlErrorf("Evaluation of custom field failed because key: %s "+
 		"could not be found in the JSON response returned by external request "+
@@ -775,6 +928,12 @@ func jsonUnmarshalError(err error, f schema.Field) *x.GqlError {
 		f.Location())
 }
 
+func resultPathError(err error, f schema.Field) *x.GqlError {
+	return x.GqlErrorf("Evaluation of custom field failed because the result couldn't be found"+
+		" in the response of external request: %s for field: %s within type: %s.", err, f.Name(),
+		f.GetObjectName()).WithLocations(f.Location())
+}
+
 func externalRequestError(err error, f schema.Field) *x.GqlError {
 	return x.GqlErrorf("Evaluation of custom field failed because external request"+
 		" returned an error: %s for field: %s within type: %s.", err, f.Name(),
@@ -791,24 +950,52 @@ type graphqlResp struct {
 	Errors x.GqlErrorList         `json:"errors,omitempty"`
 }
 
-func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, errCh chan error) {
+func resolveCustomField(ctx context.Context, f schema.Field, vals []interface{},
+	mu *sync.RWMutex, errCh chan error) {
 	defer api.PanicHandler(func(err error) {
 		errCh <- internalServerError(err, f)
 	})
 
-	fconf, err := f.CustomHTTPConfig()
+	fconfs, err := f.CustomHTTPConfig(nil)
 	if err != nil {
 		errCh <- err
 		return
 	}
 
+	// The configs are a fallback chain, so the next one is only tried if remote requests made
+	// with the ones before it failed.
+	for i, fconf := range fconfs {
+		requestFailed, err := resolveCustomFieldWith(ctx, f, fconf, vals, mu)
+		if requestFailed && i < len(fconfs)-1 {
+			continue
+		}
+		errCh <- err
+		return
+	}
+}
+
+// resolveCustomFieldWith resolves f for vals with the remote requests given by fconf.  It returns
+// whether any of those requests failed, along with the errors from resolving f.
+func resolveCustomFieldWith(ctx context.Context, f schema.Field, fconf schema.FieldHTTPConfig,
+	vals []interface{}, mu *sync.RWMutex) (bool, error) {
+	var err error
+	var claims map[string]interface{}
+	if len(fconf.RequiredClaims) > 0 {
+		if claims, err = authorization.ExtractAuthVariables(ctx); err != nil {
+			return false, x.GqlErrorf("Evaluation of custom field failed because the claims "+
+				"used in its body couldn't be read from the JWT: %s for field: %s within type: "+
+				"%s.", err, f.Name(), f.GetObjectName()).WithLocations(f.Location())
+		}
+	}
+
 	// Here we build the input for resolving the fields which is sent as the body for the request.
 	inputs := make([]interface{}, len(vals))
 
 	graphql := fconf.RemoteGqlQueryName != ""
 	// For GraphQL requests, we substitute arguments in the GraphQL query/mutation to make to
-	// the remote endpoint using the values of other fields obtained from Dgraph.
-	if graphql {
+	// the remote endpoint using the values of other fields obtained from Dgraph. If a template was
+	// given for the variables, then they are built by substituting those values in the template.
+	if graphql && fconf.VariablesTemplate == nil {
 		requiredArgs := fconf.RequiredArgs
 		for i := 0; i < len(inputs); i++ {
 			vars := make(map[string]interface{})
@@ -825,23 +1012,21 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 			inputs[i] = vars
 		}
 	} else {
+		template := fconf.Template
+		if graphql {
+			template = fconf.VariablesTemplate
+		}
 		for i := 0; i < len(inputs); i++ {
-			if fconf.Template == nil {
+			if template == nil {
 				continue
 			}
-			temp, err := copyTemplate(*fconf.Template)
-			if err != nil {
-				errCh <- err
-				return
-			}
-
 			mu.RLock()
-			if err := schema.SubstituteVarsInBody(&temp, vals[i].(map[string]interface{})); err != nil {
-				errCh <- x.GqlErrorf("Evaluation of custom field failed while substituting "+
+			temp, err := schema.ApplyTemplate(*template, vals[i].(map[string]interface{}), claims)
+			if err != nil {
+				mu.RUnlock()
+				return false, x.GqlErrorf("Evaluation of custom field failed while substituting "+
 					"variables into body for remote endpoint with an error: %s for field: %s "+
 					"within type: %s.", err, f.Name(), f.GetObjectName()).WithLocations(f.Location())
-				mu.RUnlock()
-				return
 			}
 			mu.RUnlock()
 			inputs[i] = temp
@@ -861,47 +1046,83 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 
 		b, err := json.Marshal(requestInput)
 		if err != nil {
-			errCh <- x.GqlErrorList{jsonMarshalError(err, f, inputs)}
-			return
+			return false, x.GqlErrorList{jsonMarshalError(err, f, inputs)}
 		}
 
-		b, err = makeRequest(nil, fconf.Method, fconf.URL, string(b), fconf.ForwardHeaders)
+		// Variables in headers can't be used in BATCH mode, so only the header templates which
+		// use nothing but secrets are resolved here.
+		headers := fconf.ResolvedHeaders(nil)
+		// All the values go in one request, so its span records how many there were, and
+		// links back to the span of the resolver that's waiting on them.
+		parent := otrace.FromContext(ctx)
+		reqCtx, span := startRemoteSpan(ctx, f)
+		span.AddAttributes(otrace.Int64Attribute("batch_size", int64(len(inputs))))
+		if parent != nil {
+			span.AddLink(otrace.Link{
+				TraceID: parent.SpanContext().TraceID,
+				SpanID:  parent.SpanContext().SpanID,
+				Type:    otrace.LinkTypeParent,
+			})
+		}
+		if fconf.Loopback {
+			b, err = resolveLoopback(reqCtx, string(b))
+		} else {
+			b, err = makeRequest(reqCtx, nil, fconf.Method, fconf.URL, string(b),
+				fconf.ContentType, headers, propagateTrace(ctx, f))
+		}
+		span.End()
 		if err != nil {
-			errCh <- x.GqlErrorList{externalRequestError(err, f)}
-			return
+			if gqlErr := httpRequestError(err, fconf.ErrorHandling, f); gqlErr != nil {
+				return true, x.GqlErrorList{gqlErr}
+			}
+			// The field is null for all the values.
+			return false, nil
 		}
 
 		// To collect errors from remote GraphQL endpoint and those encountered during execution.
 		var errs error
-		var result []interface{}
+		var response interface{}
 		if graphql {
 			resp := &graphqlResp{}
 			err = json.Unmarshal(b, resp)
 			if err != nil {
-				errCh <- x.GqlErrorList{jsonUnmarshalError(err, f)}
-				return
+				return false, x.GqlErrorList{jsonUnmarshalError(err, f)}
 			}
 
 			if len(resp.Errors) > 0 {
 				errs = schema.AppendGQLErrs(errs, resp.Errors)
 			}
-			var ok bool
-			result, ok = resp.Data[fconf.RemoteGqlQueryName].([]interface{})
-			if !ok {
-				errCh <- schema.AppendGQLErrs(errs, keyNotFoundError(f, fconf.RemoteGqlQueryName))
-				return
+			response = resp.Data[fconf.RemoteGqlQueryName]
+		} else if err := json.Unmarshal(b, &response); err != nil {
+			return false, x.GqlErrorList{jsonUnmarshalError(err, f)}
+		}
+
+		response, pathErr := schema.ApplyResultPath(fconf.ResultPath, response)
+		if pathErr != nil {
+			errs = schema.AppendGQLErrs(errs, resultPathError(pathErr, f))
+			if fconf.StrictPath {
+				return false, errs
 			}
-		} else if err := json.Unmarshal(b, &result); err != nil {
-			errCh <- x.GqlErrorList{jsonUnmarshalError(err, f)}
-			return
+		}
+		result, ok := response.([]interface{})
+		switch {
+		case ok:
+		case pathErr != nil:
+			// There's nothing at the path, so the field is null for all the values.
+			result = make([]interface{}, len(vals))
+		case graphql:
+			return false, schema.AppendGQLErrs(errs,
+				keyNotFoundError(f, fconf.RemoteGqlQueryName))
+		default:
+			return false, x.GqlErrorList{jsonUnmarshalError(
+				errors.New("expected a list of results in BATCH mode"), f)}
 		}
 
 		if len(result) != len(vals) {
 			gqlErr := x.GqlErrorf("Evaluation of custom field failed because expected result of "+
 				"external request to be of size %v, got: %v for field: %s within type: %s.",
 				len(vals), len(result), f.Name(), f.GetObjectName()).WithLocations(f.Location())
-			errCh <- schema.AppendGQLErrs(errs, gqlErr)
-			return
+			return false, schema.AppendGQLErrs(errs, gqlErr)
 		}
 
 		// Here we walk through all the objects in the array and substitute the value
@@ -912,12 +1133,12 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 			vals[idx] = val
 		}
 		mu.Unlock()
-		errCh <- errs
-		return
+		return false, errs
 	}
 
 	// This is single mode, make calls concurrently for each input and fill in the results.
 	errChan := make(chan error, len(inputs))
+	var requestFailed int32
 	for i := 0; i < len(inputs); i++ {
 		go func(idx int, input interface{}) {
 			defer api.PanicHandler(
@@ -939,6 +1160,12 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 				return
 			}
 
+			// The variables used in headers are substituted using the values of the fields
+			// for this input.
+			mu.RLock()
+			headers := fconf.ResolvedHeaders(vals[idx].(map[string]interface{}))
+			mu.RUnlock()
+
 			if !graphql {
 				// For REST requests, we'll have to substitute the variables used in the URL.
 				mu.RLock()
@@ -956,9 +1183,23 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 				mu.RUnlock()
 			}
 
-			b, err = makeRequest(nil, fconf.Method, fconf.URL, string(b), fconf.ForwardHeaders)
+			reqCtx, span := startRemoteSpan(ctx, f)
+			if fconf.Loopback {
+				b, err = resolveLoopback(reqCtx, string(b))
+			} else {
+				b, err = makeRequest(reqCtx, nil, fconf.Method, fconf.URL, string(b),
+					fconf.ContentType, headers, propagateTrace(ctx, f))
+			}
+			span.End()
 			if err != nil {
-				errChan <- x.GqlErrorList{externalRequestError(err, f)}
+				gqlErr := httpRequestError(err, fconf.ErrorHandling, f)
+				if gqlErr == nil {
+					// The field is null for this value.
+					errChan <- nil
+					return
+				}
+				atomic.StoreInt32(&requestFailed, 1)
+				errChan <- x.GqlErrorList{gqlErr}
 				return
 			}
 
@@ -987,6 +1228,15 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 				return
 			}
 
+			result, err = schema.ApplyResultPath(fconf.ResultPath, result)
+			if err != nil {
+				errs = schema.AppendGQLErrs(errs, resultPathError(err, f))
+				if fconf.StrictPath {
+					errChan <- errs
+					return
+				}
+			}
+
 			mu.Lock()
 			val, ok := vals[idx].(map[string]interface{})
 			if ok {
@@ -1006,7 +1256,7 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 		}
 	}
 
-	errCh <- errs
+	return atomic.LoadInt32(&requestFailed) == 1, errs
 }
 
 // resolveNestedFields resolves fields which themselves don't have the @custom directive but their
@@ -1020,8 +1270,8 @@ func resolveCustomField(f schema.Field, vals []interface{}, mu *sync.RWMutex, er
 // }
 // In the example above, resolveNestedFields would be called on classes field and vals would be the
 // list of all users.
-func resolveNestedFields(f schema.Field, vals []interface{}, mu *sync.RWMutex,
-	errCh chan error) {
+func resolveNestedFields(ctx context.Context, f schema.Field, vals []interface{},
+	mu *sync.RWMutex, errCh chan error) {
 	defer api.PanicHandler(func(err error) {
 		errCh <- internalServerError(err, f)
 	})
@@ -1099,7 +1349,7 @@ func resolveNestedFields(f schema.Field, vals []interface{}, mu *sync.RWMutex,
 	}
 	mu.RUnlock()
 
-	if err := resolveCustomFields(f.SelectionSet(), input); err != nil {
+	if err := resolveCustomFields(ctx, f.SelectionSet(), input); err != nil {
 		errCh <- err
 		return
 	}
@@ -1163,7 +1413,7 @@ func resolveNestedFields(f schema.Field, vals []interface{}, mu *sync.RWMutex,
 // work.
 // TODO - We can be smarter about this and know before processing the query if we should be making
 // this recursive call upfront.
-func resolveCustomFields(fields []schema.Field, data interface{}) error {
+func resolveCustomFields(ctx context.Context, fields []schema.Field, data interface{}) error {
 	if data == nil {
 		return nil
 	}
@@ -1194,9 +1444,9 @@ func resolveCustomFields(fields []schema.Field, data interface{}) error {
 		numRoutines++
 		hasCustomDirective, _ := f.HasCustomDirective()
 		if !hasCustomDirective {
-			go resolveNestedFields(f, vals, mu, errCh)
+			go resolveNestedFields(ctx, f, vals, mu, errCh)
 		} else {
-			go resolveCustomField(f, vals, mu, errCh)
+			go resolveCustomField(ctx, f, vals, mu, errCh)
 		}
 	}
 
@@ -1210,6 +1460,107 @@ func resolveCustomFields(fields []schema.Field, data interface{}) error {
 	return errs
 }
 
+// hiddenByAuth stands in the result for a field whose @auth rule is false for the JWT.  The
+// field wasn't queried from Dgraph, and completes as null, or with an error if the schema has a
+// Dgraph.StrictFieldAuth comment.
+type hiddenByAuth struct{}
+
+func hasFieldAuthRules(fields []schema.Field) bool {
+	for _, f := range fields {
+		if f.AuthRules() != nil || hasFieldAuthRules(f.SelectionSet()) {
+			return true
+		}
+	}
+	return false
+}
+
+// hideFieldsDeniedByAuth sets the fields in data whose @auth rule is false for authVariables
+// to hiddenByAuth, whatever else might be in data for them.
+func hideFieldsDeniedByAuth(fields []schema.Field, data interface{},
+	authVariables map[string]interface{}) {
+	var vals []interface{}
+	switch v := data.(type) {
+	case []interface{}:
+		vals = v
+	case map[string]interface{}:
+		vals = []interface{}{v}
+	default:
+		return
+	}
+
+	for _, f := range fields {
+		if f.Skip() || !f.Include() {
+			continue
+		}
+
+		denied := fieldAuthDenied(f.AuthRules(), authVariables)
+		for _, val := range vals {
+			obj, ok := val.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if denied {
+				obj[f.Name()] = hiddenByAuth{}
+			} else {
+				hideFieldsDeniedByAuth(f.SelectionSet(), obj[f.Name()], authVariables)
+			}
+		}
+	}
+}
+
+// completeAggregateFields puts together the value of each aggregate field in data from the
+// aggregates that addAggregateField queried for it, which Dgraph returns alongside the other
+// fields of the node, e.g.
+//
+//   "postsAggregate.count": 2, "postsAggregate.scoreAvg": 4.5  --->
+//   "postsAggregate": { "count": 2, "scoreAvg": 4.5 }
+//
+// A node without any of the nodes that are aggregated has a count of 0, and null for the rest.
+func completeAggregateFields(fields []schema.Field, data interface{}) {
+	var vals []interface{}
+	switch v := data.(type) {
+	case []interface{}:
+		vals = v
+	case map[string]interface{}:
+		vals = []interface{}{v}
+	default:
+		return
+	}
+
+	for _, f := range fields {
+		if f.Skip() || !f.Include() {
+			continue
+		}
+
+		aggregate := f.AggregatedField() != ""
+		for _, val := range vals {
+			obj, ok := val.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if !aggregate {
+				completeAggregateFields(f.SelectionSet(), obj[f.Name()])
+				continue
+			}
+
+			res := make(map[string]interface{})
+			for _, sel := range f.SelectionSet() {
+				if sel.Name() == schema.Typename {
+					res[sel.Name()] = f.Type().Name()
+					continue
+				}
+				alias := aggregateAlias(f, sel)
+				res[sel.Name()] = obj[alias]
+				delete(obj, alias)
+				if _, fn := schema.AggregateOf(sel.Name()); fn == "count" && res[sel.Name()] == nil {
+					res[sel.Name()] = 0
+				}
+			}
+			obj[f.Name()] = res
+		}
+	}
+}
+
 // completeObject builds a json GraphQL result object for the current query level.
 // It returns a bracketed json object like { f1:..., f2:..., ... }.
 //
@@ -1295,12 +1646,15 @@ func completeObject(
 				val = f.GetObjectName()
 			}
 		}
+		if uid, isUID := val.(string); isUID && f.Type().Name() == schema.IDType {
+			val = f.RelayID(uid, dgraphTypes)
+		}
 
 		// Check that we should check that data should be of list type when we expect
 		// f.Type().ListType() to be non-nil.
 		if val != nil && f.Type().ListType() != nil {
 			switch val.(type) {
-			case []interface{}, []map[string]interface{}:
+			case []interface{}, []map[string]interface{}, hiddenByAuth:
 			default:
 				// We were expecting a list but got a value which wasn't a list. Lets return an
 				// error.
@@ -1335,7 +1689,36 @@ func completeValue(
 	val interface{}) ([]byte, x.GqlErrorList) {
 
 	switch val := val.(type) {
+	case hiddenByAuth:
+		if field.Type().Nullable() && !field.Operation().Schema().StrictFieldAuth() {
+			return []byte("null"), nil
+		}
+
+		// Without a value, a non-nullable field has to trigger error propagation.
+		gqlErr := x.GqlErrorf(
+			"Field '%s' (type %s) is hidden by its @auth rule, the JWT doesn't satisfy it.",
+			field.Name(), field.Type()).WithLocations(field.Location())
+		gqlErr.Path = copyPath(path)
+		return nil, x.GqlErrorList{gqlErr}
+	case deletedNode:
+		var flds []schema.Field
+		for _, f := range field.SelectionSet() {
+			if _, ok := val[f.Name()]; ok || f.Name() == schema.Typename {
+				flds = append(flds, f)
+			}
+		}
+		return completeObject(path, flds, val)
 	case map[string]interface{}:
+		if field.Type().Name() == schema.PolygonType {
+			// Dgraph gives geo values as GeoJSON, and a Polygon is just its coordinates.
+			// Any other geo value, like a point added with DQL, isn't a Polygon.
+			if coords, ok := val["coordinates"].([]interface{}); ok && val["type"] == "Polygon" {
+				if b, err := json.Marshal(coords); err == nil {
+					return b, nil
+				}
+			}
+			return completeValue(path, field, nil)
+		}
 		switch field.Type().Name() {
 		case "String", "ID", "Boolean", "Float", "Int", "DateTime":
 			return nil, x.GqlErrorList{&x.GqlError{
@@ -1377,8 +1760,12 @@ func completeValue(
 				// Doesn't seem right to add null and cause error propagation.
 				//
 				// Seems best if we pick [], rather than null, as the list value if
-				// there's nothing in the Dgraph result.
-				return []byte("[]"), nil
+				// there's nothing in the Dgraph result.  A schema can still opt out of
+				// that with a Dgraph.EmptyListsAsNull comment, and then the list is
+				// completed like any other missing value.
+				if !field.Operation().Schema().EmptyListsAsNull() {
+					return []byte("[]"), nil
+				}
 			}
 
 			if field.Type().Nullable() {
@@ -1563,17 +1950,19 @@ func coerceScalar(val interface{}, field schema.Field, path []interface{}) (inte
 		}
 		switch v := val.(type) {
 		case string:
-			// Lets check that the enum value is valid.
-			valid := false
-			for _, ev := range enumValues {
-				if ev == v {
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				return nil, valueCoercionError(val)
+			// Lets check that the enum value is valid.  Dgraph stores enums as strings, so
+			// the data can hold values that aren't, or are no longer, in the enum.
+			ev, ok := field.EnumValue(v)
+			if !ok {
+				gqlErr := x.GqlErrorf(
+					"Value '%s' stored in Dgraph predicate %s isn't a value of enum %s.  "+
+						"Resolved as null (which may trigger GraphQL error propagation)",
+					v, field.DgraphPredicate(), field.Type().Name()).
+					WithLocations(field.Location())
+				gqlErr.Path = copyPath(path)
+				return nil, x.GqlErrorList{gqlErr}
 			}
+			val = ev
 		default:
 			return nil, valueCoercionError(v)
 		}
@@ -1726,8 +2115,25 @@ func (hr *httpResolver) Resolve(ctx context.Context, field schema.Field) *Resolv
 	return resolved
 }
 
-func makeRequest(client *http.Client, method, url, body string,
-	header http.Header) ([]byte, error) {
+// startRemoteSpan starts the client span for a call to the remote endpoint of f.  The span is
+// named after the field, e.g. Query.myCustomField.
+func startRemoteSpan(ctx context.Context, f schema.Field) (context.Context, *otrace.Span) {
+	return otrace.StartSpan(ctx, f.GetObjectName()+"."+f.Name(),
+		otrace.WithSpanKind(otrace.SpanKindClient))
+}
+
+// propagateTrace returns true if ctx is part of a trace and the schema of f hasn't opted out
+// of sending trace headers to remote endpoints.
+func propagateTrace(ctx context.Context, f schema.Field) bool {
+	return otrace.FromContext(ctx) != nil && !f.Operation().Schema().NoTracePropagation()
+}
+
+// makeRequest makes a request to a remote endpoint.  The span in ctx records the host, method
+// and status code of the request, and if propagateTrace is set, it's sent to the remote
+// endpoint in the W3C traceparent and tracestate headers.  A request with a body is sent with
+// contentType as its Content-Type, rather than any Content-Type in header.
+func makeRequest(ctx context.Context, client *http.Client, method, url, body, contentType string,
+	header http.Header, propagateTrace bool) ([]byte, error) {
 	var reqBody io.Reader
 	if body == "" || body == "null" {
 		reqBody = http.NoBody
@@ -1739,28 +2145,146 @@ func makeRequest(client *http.Client, method, url, body string,
 	if err != nil {
 		return nil, err
 	}
-	req.Header = header
+	// header can be shared by many requests, so the trace headers are added to a copy of it.
+	req.Header = make(http.Header, len(header))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if reqBody != http.NoBody && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	span := otrace.FromContext(ctx)
+	span.AddAttributes(
+		otrace.StringAttribute(ochttp.HostAttribute, req.URL.Host),
+		otrace.StringAttribute(ochttp.MethodAttribute, method))
+	if span != nil && propagateTrace {
+		(&tracecontext.HTTPFormat{}).SpanContextToRequest(span.SpanContext(), req)
+	}
 
 	// TODO - Needs to be fixed, we shouldn't be initiating a new HTTP client everytime.
 	if client == nil {
-		client = &http.Client{
-			Timeout: time.Minute,
-		}
+		client = newHTTPClient()
 	}
 	resp, err := client.Do(req)
 	if err != nil {
+		span.SetStatus(otrace.Status{Code: otrace.StatusCodeUnavailable, Message: err.Error()})
 		return nil, err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, errors.Errorf("unexpected status code: %v", resp.StatusCode)
-	}
-
+	span.AddAttributes(otrace.Int64Attribute(ochttp.StatusCodeAttribute, int64(resp.StatusCode)))
+	span.SetStatus(ochttp.TraceStatus(resp.StatusCode, resp.Status))
 	defer resp.Body.Close()
 
 	b, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &httpStatusError{status: resp.StatusCode, body: b}
+	}
 	return b, err
 }
 
+// newHTTPClient returns a client for making requests to remote endpoints.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		// TODO - This can be part of a config later.
+		Timeout: time.Minute,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// An httpStatusError is the error for a response from a remote endpoint whose status isn't 2xx.
+type httpStatusError struct {
+	status int
+	body   []byte
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %v", e.status)
+}
+
+// httpRequestError returns the error for f, when its request to a remote endpoint failed with
+// err.  A response whose status isn't 2xx is resolved as eh, the errorHandling of f's @custom,
+// says, so nil is returned if f is null without an error.
+func httpRequestError(err error, eh *schema.HTTPErrorHandling, f schema.Field) *x.GqlError {
+	se, ok := err.(*httpStatusError)
+	if eh == nil || !ok {
+		return externalRequestError(err, f)
+	}
+	for _, status := range eh.NullOn {
+		if status == se.status {
+			return nil
+		}
+	}
+
+	msg := http.StatusText(se.status)
+	if eh.MessagePath != "" {
+		var body interface{}
+		if json.Unmarshal(se.body, &body) == nil {
+			m, _ := schema.ApplyResultPath(eh.MessagePath, body)
+			if m, ok := m.(string); ok && m != "" {
+				msg = m
+			}
+		}
+	}
+	if msg == "" {
+		msg = se.Error()
+	}
+	gqlErr := x.GqlErrorf("%s", msg).WithLocations(f.Location())
+	if eh.PropagateStatus {
+		gqlErr.Extensions = map[string]interface{}{"status": se.status}
+	}
+	return gqlErr
+}
+
+// A loopback is what the loopback requests made while resolving a request are resolved with:
+// the RequestResolver that's resolving that request, and how many loopback requests deep the
+// request is.
+type loopback struct {
+	resolver *RequestResolver
+	depth    int
+}
+
+// resolveLoopback resolves body, the GraphQL request of a @custom field whose url is
+// schema.LoopbackURL, with the RequestResolver of the request being resolved in ctx.  It returns
+// the response as it would have come over HTTP.  The request is made with the auth variables
+// of the request in ctx, so the JWT isn't verified again.  A loopback request can make more of
+// them, so how deep they are nested is limited.
+func resolveLoopback(ctx context.Context, body string) ([]byte, error) {
+	lb, _ := ctx.Value(loopbackKey).(*loopback)
+	if lb == nil {
+		return nil, errors.New("loopback requests can only be made while resolving a request")
+	}
+	maxDepth := lb.resolver.schema.Limits().MaxLoopbackDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxLoopbackDepth
+	}
+	if lb.depth >= maxDepth {
+		return nil, errors.Errorf("loopback requests can't be nested more than %d deep, "+
+			"that's set by maxLoopbackDepth in the schema's limits", maxDepth)
+	}
+
+	req := &schema.Request{}
+	if err := json.Unmarshal([]byte(body), req); err != nil {
+		return nil, err
+	}
+	authVars, err := authorization.ExtractAuthVariables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = authorization.AttachAuthVariables(ctx, authVars)
+	ctx = context.WithValue(ctx, loopbackKey, &loopback{resolver: lb.resolver, depth: lb.depth + 1})
+
+	var buf bytes.Buffer
+	if _, err := lb.resolver.Resolve(ctx, req).WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (hr *httpResolver) rewriteAndExecute(ctx context.Context, field schema.Field) *Resolved {
 	emptyResult := func(err error) *Resolved {
 		return &Resolved{
@@ -1770,22 +2294,55 @@ func (hr *httpResolver) rewriteAndExecute(ctx context.Context, field schema.Fiel
 		}
 	}
 
-	hrc, err := field.CustomHTTPConfig()
+	// Reading the claims verifies the JWT, so that's only done for a body that uses them.
+	var claims map[string]interface{}
+	var err error
+	if field.CustomHTTPUsesClaims() {
+		if claims, err = authorization.ExtractAuthVariables(ctx); err != nil {
+			return emptyResult(err)
+		}
+	}
+
+	hrcs, err := field.CustomHTTPConfig(claims)
 	if err != nil {
 		return emptyResult(err)
 	}
 
-	var body string
-	if hrc.Template != nil {
-		b, err := json.Marshal(*hrc.Template)
-		if err != nil {
-			return emptyResult(jsonMarshalError(err, field, *hrc.Template))
+	// The configs are a fallback chain, so the next one is only tried if the request made with
+	// the ones before it failed.
+	var hrc schema.FieldHTTPConfig
+	var b []byte
+	for _, hrc = range hrcs {
+		var body string
+		if hrc.Template != nil {
+			b, err := json.Marshal(*hrc.Template)
+			if err != nil {
+				return emptyResult(jsonMarshalError(err, field, *hrc.Template))
+			}
+			body = string(b)
+		}
+		reqCtx, span := startRemoteSpan(ctx, field)
+		if hrc.Loopback {
+			b, err = resolveLoopback(reqCtx, body)
+		} else {
+			b, err = makeRequest(reqCtx, hr.Client, hrc.Method, hrc.URL, body, hrc.ContentType,
+				hrc.ForwardHeaders, propagateTrace(ctx, field))
+		}
+		span.End()
+		if err == nil {
+			break
+		}
+		if httpRequestError(err, hrc.ErrorHandling, field) == nil {
+			// The status of the response is one that the field is null for, so there's no
+			// request to fall back on.
+			return &Resolved{
+				Data:  map[string]interface{}{field.Name(): nil},
+				Field: field,
+			}
 		}
-		body = string(b)
 	}
-	b, err := makeRequest(hr.Client, hrc.Method, hrc.URL, body, hrc.ForwardHeaders)
 	if err != nil {
-		return emptyResult(externalRequestError(err, field))
+		return emptyResult(httpRequestError(err, hrc.ErrorHandling, field))
 	}
 
 	// this means it had body and not graphql, so just unmarshal it and return
@@ -1794,9 +2351,18 @@ func (hr *httpResolver) rewriteAndExecute(ctx context.Context, field schema.Fiel
 		if err := json.Unmarshal(b, &result); err != nil {
 			return emptyResult(jsonUnmarshalError(err, field))
 		}
+		var errs x.GqlErrorList
+		result, err = schema.ApplyResultPath(hrc.ResultPath, result)
+		if err != nil {
+			errs = append(errs, resultPathError(err, field))
+			if hrc.StrictPath {
+				return emptyResult(errs)
+			}
+		}
 		return &Resolved{
 			Data:  map[string]interface{}{field.Name(): result},
 			Field: field,
+			Err:   errs,
 		}
 	}
 
@@ -1815,6 +2381,13 @@ func (hr *httpResolver) rewriteAndExecute(ctx context.Context, field schema.Fiel
 	if !ok {
 		return emptyResult(resp.Errors)
 	}
+	data, err = schema.ApplyResultPath(hrc.ResultPath, data)
+	if err != nil {
+		resp.Errors = append(resp.Errors, resultPathError(err, field))
+		if hrc.StrictPath {
+			return emptyResult(resp.Errors)
+		}
+	}
 
 	return &Resolved{
 		Data:  map[string]interface{}{field.Name(): data},
@@ -294,6 +294,105 @@ func TestUpdateMutationUsesErrorPropagation(t *testing.T) {
 	}
 }
 
+// Missing lists are completed as [] by default, but a schema can opt out of that, and then
+// they complete as null, or trigger error propagation if the list is non-nullable.
+func TestEmptyListCompletion(t *testing.T) {
+	authorQuery := `query {
+		getAuthor(id: "0x1") {
+			postsNullable { title }
+			postsRequired { title }
+		}
+	}`
+
+	nullableListQuery := `query {
+		getAuthor(id: "0x1") {
+			postsNullable { title }
+			posts: postsElmntRequired { title }
+		}
+	}`
+
+	addPostMutation := `mutation {
+		addPost(input: [{title: "A Post", text: "Some text", author: {id: "0x1"}}]) {
+			post { title }
+		}
+	}`
+
+	tests := map[string]struct {
+		explanation      string
+		emptyListsAsNull bool
+		gqlQuery         string
+		queryResponse    string
+		expected         string
+		errors           x.GqlErrorList
+	}{
+		"Missing lists become [] by default": {
+			explanation:   "Without the opt-out, both nullable and non-nullable lists become []",
+			gqlQuery:      authorQuery,
+			queryResponse: `{ "getAuthor": [ { "uid": "0x1" } ] }`,
+			expected:      `{ "getAuthor": { "postsNullable": [], "postsRequired": [] } }`,
+		},
+		"Missing nullable lists become null when opted out": {
+			explanation:      "With the opt-out, a missing nullable list is just null",
+			emptyListsAsNull: true,
+			gqlQuery:         nullableListQuery,
+			queryResponse:    `{ "getAuthor": [ { "uid": "0x1" } ] }`,
+			expected:         `{ "getAuthor": { "postsNullable": null, "posts": null } }`,
+		},
+		"Missing non-nullable list triggers error propagation when opted out": {
+			explanation: "With the opt-out, a missing [Post!]! can't be null, so the " +
+				"error propagates to the nullable getAuthor",
+			emptyListsAsNull: true,
+			gqlQuery:         authorQuery,
+			queryResponse:    `{ "getAuthor": [ { "uid": "0x1" } ] }`,
+			expected:         `{ "getAuthor": null }`,
+			errors: x.GqlErrorList{&x.GqlError{
+				Message: `Non-nullable field 'postsRequired' (type [Post!]!) ` +
+					`was not present in result from Dgraph.  GraphQL error propagation triggered.`,
+				Locations: []x.Location{{Line: 4, Column: 4}},
+				Path:      []interface{}{"getAuthor", "postsRequired"}}},
+		},
+		"Missing list in a mutation payload becomes [] by default": {
+			explanation:   "The list in a payload type is completed like any other list",
+			gqlQuery:      addPostMutation,
+			queryResponse: `{ }`,
+			expected:      `{ "addPost": { "post": [] } }`,
+		},
+		"Missing list in a mutation payload becomes null when opted out": {
+			explanation:      "With the opt-out, the nullable list in the payload is null",
+			emptyListsAsNull: true,
+			gqlQuery:         addPostMutation,
+			queryResponse:    `{ }`,
+			expected:         `{ "addPost": { "post": null } }`,
+		},
+	}
+
+	gqlSchema := test.LoadSchemaFromString(t, testGQLSchema)
+	optOutSchema := test.LoadSchemaFromString(t, "# Dgraph.EmptyListsAsNull\n"+testGQLSchema)
+
+	for name, tcase := range tests {
+		t.Run(name, func(t *testing.T) {
+			sch := gqlSchema
+			if tcase.emptyListsAsNull {
+				sch = optOutSchema
+			}
+			require.Equal(t, tcase.emptyListsAsNull, sch.EmptyListsAsNull())
+
+			resp := resolveWithClient(sch, tcase.gqlQuery, nil,
+				&executor{
+					resp:     tcase.queryResponse,
+					assigned: map[string]string{"Post1": "0x2"},
+					result: map[string]interface{}{
+						"Author2": []interface{}{map[string]string{"uid": "0x1"}}},
+				})
+
+			if diff := cmp.Diff(tcase.errors, resp.Errors); diff != "" {
+				t.Errorf("errors mismatch (-want +got):\n%s", diff)
+			}
+			require.JSONEq(t, tcase.expected, resp.Data.String(), tcase.explanation)
+		})
+	}
+}
+
 // TestManyMutationsWithError : Multiple mutations run serially (queries would
 // run in parallel) and, in GraphQL, if an error is encountered in a request with
 // multiple mutations, the mutations following the error are not run.  The mutations
@@ -399,6 +498,83 @@ func TestManyMutationsWithError(t *testing.T) {
 	}
 }
 
+func TestMutationWithOnlyNumUidsDoesNotQuery(t *testing.T) {
+	mutation := `mutation {
+		addPost(input: [{title: "A Post", text: "Some text", author: {id: "0x1"}}]) {
+			numUids
+		}
+	}`
+
+	gqlSchema := test.LoadSchemaFromString(t, testGQLSchema)
+	resp := resolveWithClient(gqlSchema, mutation, nil,
+		&executor{
+			assigned: map[string]string{"Post1": "0x2"},
+			result: map[string]interface{}{
+				"Author2": []interface{}{map[string]string{"uid": "0x1"}}},
+			// any query for the new post would fail
+			failQuery: 1,
+		})
+
+	require.Nil(t, resp.Errors)
+	require.JSONEq(t, `{ "addPost": { "numUids": 1 } }`, resp.Data.String())
+}
+
+func TestMutationWithOnlyNumUidsHasTheErrorsOfTheMutation(t *testing.T) {
+	mutation := `mutation {
+		addPost(input: [{title: "A Post", text: "Some text", author: {id: "0x1"}}]) {
+			numUids
+		}
+	}`
+
+	gqlSchema := test.LoadSchemaFromString(t, testGQLSchema)
+	resp := resolveWithClient(gqlSchema, mutation, nil,
+		&executor{
+			result: map[string]interface{}{
+				"Author2": []interface{}{map[string]string{"uid": "0x1"}}},
+			failQuery: 1,
+		})
+
+	// The mutation is committed, and reported, just like one that asks for the new post.
+	require.Len(t, resp.Errors, 1)
+	require.Contains(t, resp.Errors[0].Message, "no new node was created")
+	require.JSONEq(t, `{ "addPost": { "numUids": 0 } }`, resp.Data.String())
+}
+
+func TestRelayIDs(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromString(t, "# Dgraph.RelayIDs\n"+testGQLSchema)
+	postID := schema.EncodeRelayID("Post", "0x2")
+	authorID := schema.EncodeRelayID("Author", "0x1")
+
+	t.Run("node query", func(t *testing.T) {
+		resp := resolve(gqlSchema, `query {
+			node(id: "`+postID+`") {
+				id
+				... on Post { title author { id } }
+				... on Author { name }
+			}
+		}`, `{ "getPost": [ { "id": "0x2", "title": "A Post", "author": { "id": "0x1" } } ] }`)
+
+		require.Nil(t, resp.Errors)
+		require.JSONEq(t, `{ "node": { "id": "`+postID+`", "title": "A Post",
+			"author": { "id": "`+authorID+`" } } }`, resp.Data.String())
+	})
+
+	t.Run("uid instead of ID", func(t *testing.T) {
+		resp := resolve(gqlSchema, `query { getPost(id: "0x2") { id } }`, `{}`)
+
+		require.Len(t, resp.Errors, 1)
+		require.Contains(t, resp.Errors[0].Message, "ID 0x2 is a uid")
+	})
+
+	t.Run("ID of another type", func(t *testing.T) {
+		resp := resolve(gqlSchema, `query { getPost(id: "`+authorID+`") { id } }`, `{}`)
+
+		require.Len(t, resp.Errors, 1)
+		require.Contains(t, resp.Errors[0].Message,
+			"is of type Author, but an ID of type Post is expected")
+	})
+}
+
 func resolve(gqlSchema schema.Schema, gqlQuery string, dgResponse string) *schema.Response {
 	return resolveWithClient(gqlSchema, gqlQuery, nil, &executor{resp: dgResponse})
 }
@@ -17,8 +17,13 @@
 package resolve
 
 import (
+	"context"
+	"net/http"
+	"sync"
 	"testing"
 
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+	"github.com/dgraph-io/dgraph/graphql/schema"
 	"github.com/dgraph-io/dgraph/graphql/test"
 	"github.com/dgraph-io/dgraph/x"
 	"github.com/google/go-cmp/cmp"
@@ -147,7 +152,9 @@ func TestValueCoercion(t *testing.T) {
 			GQLQuery: `query { getPost(postID: "0x1") { postType } }`,
 			Response: `{ "getPost": { "postType": ["Random"] }}`,
 			Errors: x.GqlErrorList{{
-				Message:   "Error coercing value 'Random' for field 'postType' to type PostType.",
+				Message: "Value 'Random' stored in Dgraph predicate Post.postType isn't a value " +
+					"of enum PostType.  Resolved as null (which may trigger GraphQL error " +
+					"propagation)",
 				Locations: []x.Location{x.Location{Line: 1, Column: 34}},
 				Path:      []interface{}{"getPost", "postType", 0},
 			}},
@@ -156,6 +163,32 @@ func TestValueCoercion(t *testing.T) {
 			GQLQuery: `query { getPost(postID: "0x1") { postType } }`,
 			Response: `{ "getPost": { "postType": ["Question"] }}`,
 			Expected: `{ "getPost": { "postType": ["Question"] }}`},
+		{Name: "enum value isn't matched ignoring case by default",
+			GQLQuery: `query { getPost(postID: "0x1") { postType } }`,
+			Response: `{ "getPost": { "postType": ["question"] }}`,
+			Errors: x.GqlErrorList{{
+				Message: "Value 'question' stored in Dgraph predicate Post.postType isn't a " +
+					"value of enum PostType.  Resolved as null (which may trigger GraphQL error " +
+					"propagation)",
+				Locations: []x.Location{x.Location{Line: 1, Column: 34}},
+				Path:      []interface{}{"getPost", "postType", 0},
+			}},
+			Expected: `{ "getPost": { "postType": [null] }}`},
+		{Name: "case insensitive enum value should be coerced to the declared value",
+			GQLQuery: `query { getMember(id: "0x1") { status } }`,
+			Response: `{ "getMember": { "status": "archived" }}`,
+			Expected: `{ "getMember": { "status": "ARCHIVED" }}`},
+		{Name: "case insensitive enum value should raise error if it isn't in the enum",
+			GQLQuery: `query { getMember(id: "0x1") { status } }`,
+			Response: `{ "getMember": { "status": "DELETED" }}`,
+			Errors: x.GqlErrorList{{
+				Message: "Value 'DELETED' stored in Dgraph predicate Member.status isn't a value " +
+					"of enum MemberStatus.  Resolved as null (which may trigger GraphQL error " +
+					"propagation)",
+				Locations: []x.Location{x.Location{Line: 1, Column: 32}},
+				Path:      []interface{}{"getMember", "status"},
+			}},
+			Expected: `{ "getMember": { "status": null }}`},
 
 		// test int/float/string can be coerced to Boolean
 		{Name: "int value should be coerced to bool",
@@ -350,6 +383,56 @@ func TestQueryAlias(t *testing.T) {
 	}
 }
 
+func TestAggregateFieldCompletion(t *testing.T) {
+	tests := []QueryCase{
+		{Name: "aggregates are put together for each parent",
+			GQLQuery: `query {
+				queryAuthor {
+					name
+					postsAggregate { count numLikesAvg titleMin }
+				}
+			}`,
+			Response: `{ "queryAuthor": [
+				{ "name": "A.N. Author",
+					"postsAggregate": [{ "Post.numLikes": 2 }, { "Post.numLikes": 5 }],
+					"postsAggregate.count": 2,
+					"postsAggregate.numLikesAvg": 3.5,
+					"postsAggregate.titleMin": "A Post" },
+				{ "name": "Another Author", "postsAggregate.count": 0 } ] }`,
+			Expected: `{ "queryAuthor": [
+				{ "name": "A.N. Author",
+					"postsAggregate": { "count": 2, "numLikesAvg": 3.5, "titleMin": "A Post" } },
+				{ "name": "Another Author",
+					"postsAggregate": { "count": 0, "numLikesAvg": null, "titleMin": null } } ] }`},
+		{Name: "missing count is 0",
+			GQLQuery: `query { getAuthor(id: "0x1") { postsAggregate { count } } }`,
+			Response: `{ "getAuthor": [ { "dgraph.uid": "0x1" } ] }`,
+			Expected: `{ "getAuthor": { "postsAggregate": { "count": 0 } } }`},
+		{Name: "aggregate of a nested list",
+			GQLQuery: `query {
+				getPost(postID: "0x1") { category { postsAggregate { count } } }
+			}`,
+			Response: `{ "getPost": [ { "category": { "postsAggregate.count": 3 } } ] }`,
+			Expected: `{ "getPost": { "category": { "postsAggregate": { "count": 3 } } } }`},
+		{Name: "typename of an aggregate",
+			GQLQuery: `query { getAuthor(id: "0x1") { postsAggregate { __typename count } } }`,
+			Response: `{ "getAuthor": [ { "postsAggregate.count": 1 } ] }`,
+			Expected: `{ "getAuthor": {
+				"postsAggregate": { "__typename": "PostAggregateResult", "count": 1 } } }`},
+	}
+
+	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			resp := resolve(gqlSchema, test.GQLQuery, test.Response)
+
+			require.Nil(t, resp.Errors)
+			require.JSONEq(t, test.Expected, resp.Data.String())
+		})
+	}
+}
+
 func TestMutationAlias(t *testing.T) {
 
 	tests := map[string]struct {
@@ -485,3 +568,226 @@ func TestResponseOrder(t *testing.T) {
 		})
 	}
 }
+
+// requestRecorder is an executor that remembers the requests it was asked to run.
+type requestRecorder struct {
+	executor
+	requests []*dgoapi.Request
+}
+
+func (rr *requestRecorder) Execute(
+	ctx context.Context, req *dgoapi.Request) (*dgoapi.Response, error) {
+	rr.requests = append(rr.requests, req)
+	return rr.executor.Execute(ctx, req)
+}
+
+func TestBestEffortReadOnlyRequests(t *testing.T) {
+	query := `query { getAuthor(id: "0x1") { name } }`
+	mutation := `mutation {
+		addPost(input: [{title: "A Post", author: {id: "0x1"}}]) { post { title } }
+	}`
+
+	tests := map[string]struct {
+		gqlQuery   string
+		header     string
+		bestEffort bool
+		expected   string
+		errors     x.GqlErrorList
+	}{
+		"Queries are linearizable by default": {
+			gqlQuery: query,
+			expected: `{"getAuthor": {"name": "A.N. Author"}}`,
+		},
+		"Best-effort header makes queries best-effort": {
+			gqlQuery:   query,
+			header:     "best-effort",
+			bestEffort: true,
+			expected:   `{"getAuthor": {"name": "A.N. Author"}}`,
+		},
+		"Best-effort header rejects mutations": {
+			gqlQuery: mutation,
+			header:   "best-effort",
+			errors: x.GqlErrorList{
+				{Message: "Mutations can't be run in a best-effort read-only request."}},
+		},
+		"Unsupported header value is rejected": {
+			gqlQuery: query,
+			header:   "stale",
+			errors: x.GqlErrorList{
+				{Message: "Unsupported value stale for header X-Dgraph-ReadOnly, " +
+					"the only supported value is best-effort."}},
+		},
+	}
+
+	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
+
+	for name, tcase := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := &requestRecorder{executor: executor{
+				resp: `{ "getAuthor": [ { "name": "A.N. Author" } ] }`}}
+			resolver := New(
+				gqlSchema,
+				NewResolverFactory(nil, nil).WithConventionResolvers(gqlSchema, &ResolverFns{
+					Qrw: NewQueryRewriter(),
+					Arw: NewAddRewriter,
+					Urw: NewUpdateRewriter,
+					Ex:  rec,
+				}))
+
+			header := http.Header{}
+			if tcase.header != "" {
+				header.Set("X-Dgraph-ReadOnly", tcase.header)
+			}
+			resp := resolver.Resolve(context.Background(),
+				&schema.Request{Query: tcase.gqlQuery, Header: header})
+
+			if diff := cmp.Diff(tcase.errors, resp.Errors); diff != "" {
+				t.Errorf("errors mismatch (-want +got):\n%s", diff)
+			}
+			if tcase.errors != nil {
+				require.Empty(t, resp.Data.String())
+				require.Empty(t, rec.requests)
+				return
+			}
+
+			require.JSONEq(t, tcase.expected, resp.Data.String())
+			require.Len(t, rec.requests, 1)
+			require.True(t, rec.requests[0].ReadOnly)
+			require.Equal(t, tcase.bestEffort, rec.requests[0].BestEffort)
+		})
+	}
+}
+
+func TestCustomDQLQuery(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromString(t, `
+	type Author {
+		id: ID!
+		name: String! @search(by: [hash])
+		reputation: Float
+	}
+
+	type Query {
+		authorsByName(name: String!, minRep: Float): [Author] @custom(dql: """
+		query q($name: string, $minRep: float) {
+			authorsByName(func: eq(Author.name, $name)) @filter(ge(Author.reputation, $minRep)) {
+				name: Author.name
+				reputation: Author.reputation
+			}
+		}""")
+	}`)
+
+	rec := &requestRecorder{executor: executor{
+		resp: `{ "authorsByName": [ { "name": "A.N. Author", "reputation": 4.5 } ] }`}}
+	resolver := New(
+		gqlSchema,
+		NewResolverFactory(nil, nil).WithConventionResolvers(gqlSchema, &ResolverFns{
+			Qrw: NewQueryRewriter(),
+			Arw: NewAddRewriter,
+			Urw: NewUpdateRewriter,
+			Ex:  rec,
+		}))
+
+	resp := resolver.Resolve(context.Background(), &schema.Request{
+		Query: `query { authorsByName(name: "A.N. Author", minRep: 4) { name reputation } }`})
+
+	require.Nil(t, resp.Errors)
+	require.JSONEq(t, `{"authorsByName": [{"name": "A.N. Author", "reputation": 4.5}]}`,
+		resp.Data.String())
+	require.Len(t, rec.requests, 1)
+	require.Contains(t, rec.requests[0].Query, "authorsByName(func: eq(Author.name, $name))")
+	require.Equal(t, map[string]string{"$name": "A.N. Author", "$minRep": "4"},
+		rec.requests[0].Vars)
+	require.True(t, rec.requests[0].ReadOnly)
+}
+
+// batchExecutor is an executor that can be shared by the requests of a batch.  It remembers the
+// requests in the order they ran, and gives each query that doesn't have a timestamp the next
+// one.
+type batchExecutor struct {
+	executor
+	mu       sync.Mutex
+	ts       uint64
+	requests []*dgoapi.Request
+}
+
+func (be *batchExecutor) Execute(
+	ctx context.Context, req *dgoapi.Request) (*dgoapi.Response, error) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+
+	be.requests = append(be.requests, req)
+	if req.ReadOnly && req.StartTs == 0 {
+		be.ts++
+		req.StartTs = be.ts
+	}
+	resp, err := be.executor.Execute(ctx, req)
+	if resp != nil {
+		resp.Txn = &dgoapi.TxnContext{StartTs: req.StartTs}
+	}
+	return resp, err
+}
+
+func TestResolveBatch(t *testing.T) {
+	defer func(parallelism int) {
+		x.Config.GraphqlBatchParallelism = parallelism
+	}(x.Config.GraphqlBatchParallelism)
+	// One at a time, so it's known which query gets a timestamp first.
+	x.Config.GraphqlBatchParallelism = 1
+
+	query := `query { getAuthor(id: "0x1") { name } }`
+	gqlReqs := []*schema.Request{
+		{Query: query},
+		{Query: `query { getAuthor(id: "0x1") { nope } }`},
+		{Query: query},
+		{Query: `mutation {
+			addPost(input: [{title: "A Post", author: {id: "0x1"}}]) { numUids }
+		}`},
+		{Query: query},
+	}
+
+	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
+	ex := &batchExecutor{executor: executor{
+		resp:     `{ "getAuthor": [ { "name": "A.N. Author" } ] }`,
+		assigned: map[string]string{"Post1": "0x2"},
+		result: map[string]interface{}{
+			"Author2": []interface{}{map[string]string{"uid": "0x1"}}},
+	}}
+	resolver := New(
+		gqlSchema,
+		NewResolverFactory(nil, nil).WithConventionResolvers(gqlSchema, &ResolverFns{
+			Qrw: NewQueryRewriter(),
+			Arw: NewAddRewriter,
+			Urw: NewUpdateRewriter,
+			Ex:  ex,
+		}))
+
+	resps := resolver.ResolveBatch(context.Background(), gqlReqs)
+	require.Len(t, resps, len(gqlReqs))
+
+	author := `{"getAuthor": {"name": "A.N. Author"}}`
+	for _, i := range []int{0, 2, 4} {
+		require.Nil(t, resps[i].Errors)
+		require.JSONEq(t, author, resps[i].Data.String())
+	}
+	require.Len(t, resps[1].Errors, 1)
+	require.Contains(t, resps[1].Errors[0].Message,
+		`Cannot query field "nope" on type "Author".`)
+	require.Nil(t, resps[3].Errors)
+	require.JSONEq(t, `{"addPost": {"numUids": 1}}`, resps[3].Data.String())
+
+	// The queries before the mutation read at the same timestamp, and the one after it reads
+	// at a new one, so it sees the mutation.
+	var startTs []uint64
+	mutationAt := -1
+	for i, req := range ex.requests {
+		if len(req.Mutations) > 0 {
+			mutationAt = i
+			continue
+		}
+		if req.ReadOnly {
+			startTs = append(startTs, req.StartTs)
+		}
+	}
+	require.Equal(t, []uint64{1, 1, 2}, startTs)
+	require.Equal(t, 2, mutationAt)
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resolve
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/dgraph/graphql/schema"
+)
+
+// A SubscriptionState is what a subscription remembers between the times it's resolved: the
+// nodes that each of its subscribeT fields found, by their IDs.  Resolving a subscribeT field
+// with a state gives the events since the state was last resolved, so the first time, every
+// node is added.
+type SubscriptionState struct {
+	mu        sync.Mutex
+	snapshots map[string]*nodeSnapshot
+	events    map[string]int
+}
+
+// a nodeSnapshot is the nodes that a subscribeT field found, in the order it found them.
+type nodeSnapshot struct {
+	ids   []string
+	nodes map[string]map[string]interface{}
+}
+
+// deletedNode stands in the result for the node of a DELETE event.  Only the node's ID fields
+// are known, so only those are completed.
+type deletedNode map[string]interface{}
+
+// NewSubscriptionState returns the state of a subscription that hasn't been resolved yet.
+func NewSubscriptionState() *SubscriptionState {
+	return &SubscriptionState{
+		snapshots: make(map[string]*nodeSnapshot),
+		events:    make(map[string]int),
+	}
+}
+
+// WithSubscriptionState returns a context in which subscribeT fields are resolved against st.
+func WithSubscriptionState(ctx context.Context, st *SubscriptionState) context.Context {
+	return context.WithValue(ctx, subscriptionKey, st)
+}
+
+// HasEvents returns true if st has been resolved for subscribeT fields, so the results of the
+// subscription are events, rather than all the nodes.
+func (st *SubscriptionState) HasEvents() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.events) > 0
+}
+
+// Events returns how many events the subscribeT fields had the last time st was resolved.
+func (st *SubscriptionState) Events() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := 0
+	for _, events := range st.events {
+		n += events
+	}
+	return n
+}
+
+// NewSubscribeQueryResolver creates a resolver for subscribeT subscriptions.  The nodes are found
+// by nodesResolver, as T's filter query, and the result is the events for the nodes that were
+// added, updated or deleted since the subscription's state was last resolved.
+func NewSubscribeQueryResolver(nodesResolver QueryResolver) QueryResolver {
+	return QueryResolverFunc(func(ctx context.Context, query schema.Query) *Resolved {
+		nodesQry := query.SubscribedQuery()
+		resolved := nodesResolver.Resolve(ctx, nodesQry)
+		resolved.Field = query
+
+		data, _ := resolved.Data.(map[string]interface{})
+		nodes, _ := data[nodesQry.Name()].([]interface{})
+		if nodes == nil && resolved.Err != nil {
+			// Nothing is known about the nodes, so nothing can be said about what happened
+			// to them, and the state is left as it was.
+			resolved.Data = map[string]interface{}{query.Name(): nil}
+			return resolved
+		}
+
+		st, ok := ctx.Value(subscriptionKey).(*SubscriptionState)
+		if !ok {
+			st = NewSubscriptionState()
+		}
+		var idFields []string
+		for _, id := range []schema.FieldDefinition{nodesQry.Type().IDField(),
+			nodesQry.Type().XIDField()} {
+			if id != nil {
+				idFields = append(idFields, id.Name())
+			}
+		}
+		fields := make(map[string]bool)
+		for _, f := range nodesQry.SelectionSet() {
+			fields[f.Name()] = true
+		}
+		resolved.Data = map[string]interface{}{
+			query.Name(): st.diff(query.ResponseName(), idFields, fields, nodes),
+		}
+		return resolved
+	})
+}
+
+// diff returns the events for the nodes that the subscribeT field name found, compared to what
+// it found the last time, and remembers nodes for the next time.  The events for added and
+// updated nodes come in the order of nodes, then those for deleted nodes.  fields are the names
+// of the fields of the nodes that were queried.
+func (st *SubscriptionState) diff(name string, idFields []string, fields map[string]bool,
+	nodes []interface{}) []interface{} {
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	prev := st.snapshots[name]
+	if prev == nil {
+		prev = &nodeSnapshot{}
+	}
+	next := &nodeSnapshot{nodes: make(map[string]map[string]interface{}, len(nodes))}
+
+	events := make([]interface{}, 0)
+	for _, n := range nodes {
+		node, ok := n.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id := nodeID(node, idFields)
+		if _, seen := next.nodes[id]; id == "" || seen {
+			continue
+		}
+		next.ids = append(next.ids, id)
+		next.nodes[id] = node
+
+		old, ok := prev.nodes[id]
+		if !ok {
+			events = append(events, subscriptionEvent(schema.SubscriptionAdd,
+				changedFields(nil, node, fields), node))
+			continue
+		}
+		if changed := changedFields(old, node, fields); len(changed) > 0 {
+			events = append(events, subscriptionEvent(schema.SubscriptionUpdate, changed, node))
+		}
+	}
+	for _, id := range prev.ids {
+		if _, ok := next.nodes[id]; ok {
+			continue
+		}
+		deleted := make(deletedNode, len(idFields)+1)
+		for _, f := range append(idFields, "dgraph.type") {
+			if val, ok := prev.nodes[id][f]; ok {
+				deleted[f] = val
+			}
+		}
+		events = append(events, subscriptionEvent(schema.SubscriptionDelete,
+			make([]interface{}, 0), deleted))
+	}
+
+	st.snapshots[name] = next
+	st.events[name] = len(events)
+	return events
+}
+
+func subscriptionEvent(event string, changed []interface{},
+	node interface{}) map[string]interface{} {
+
+	return map[string]interface{}{
+		schema.SubscriptionEvent:   event,
+		schema.SubscriptionChanged: changed,
+		schema.SubscriptionNode:    node,
+	}
+}
+
+// nodeID returns the key that node is told apart from the others by, that's the values of its
+// ID fields.  It's "" if node doesn't have any of them.
+func nodeID(node map[string]interface{}, idFields []string) string {
+	vals := make([]interface{}, 0, len(idFields))
+	found := false
+	for _, f := range idFields {
+		vals = append(vals, node[f])
+		found = found || node[f] != nil
+	}
+	if !found {
+		return ""
+	}
+	b, err := json.Marshal(vals)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// changedFields returns the names of the fields that are different in node than in old, in
+// order.  The nodes are keyed by what their predicates were queried as, that's the names of their
+// fields, not the aliases they are selected with.  Keys that aren't for any of fields, like
+// dgraph.type, aren't changes to the node's fields.
+func changedFields(old, node map[string]interface{}, fields map[string]bool) []interface{} {
+	var names []string
+	for f, val := range node {
+		if !fields[f] {
+			continue
+		}
+		if oldVal, ok := old[f]; !ok || !reflect.DeepEqual(oldVal, val) {
+			names = append(names, f)
+		}
+	}
+	for f := range old {
+		if _, ok := node[f]; !ok && fields[f] {
+			names = append(names, f)
+		}
+	}
+	sort.Strings(names)
+
+	changed := make([]interface{}, 0, len(names))
+	for _, f := range names {
+		changed = append(changed, f)
+	}
+	return changed
+}
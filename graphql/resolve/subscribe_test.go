@@ -0,0 +1,148 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resolve
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/dgraph-io/dgraph/graphql/test"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that a subscribeT subscription sends, each time it's resolved, the events for the
+// nodes that were added, updated and deleted since the last time.
+func TestSubscribeQueryEvents(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromString(t, `
+	type Author {
+		id: ID!
+		name: String! @search(by: [hash])
+		dob: DateTime
+	}`)
+
+	ex := &executor{}
+	resolver := New(gqlSchema, NewResolverFactory(nil, nil).WithConventionResolvers(gqlSchema,
+		&ResolverFns{Qrw: NewQueryRewriter(), Ex: ex}))
+	state := NewSubscriptionState()
+	req := &schema.Request{Query: `subscription {
+		subscribeAuthor(filter: { name: { eq: "A" } }) {
+			event
+			changedFields
+			node { id name }
+		}
+	}`}
+
+	polls := []struct {
+		name     string
+		dgResp   string
+		expected string
+	}{
+		{
+			name: "every node is added at first",
+			dgResp: `{ "queryAuthor": [
+				{ "id": "0x1", "name": "A" },
+				{ "id": "0x2", "name": "B" }
+			] }`,
+			expected: `{ "subscribeAuthor": [
+				{ "event": "ADD", "changedFields": ["id", "name"],
+					"node": { "id": "0x1", "name": "A" } },
+				{ "event": "ADD", "changedFields": ["id", "name"],
+					"node": { "id": "0x2", "name": "B" } }
+			] }`,
+		},
+		{
+			name: "updates, adds and deletes",
+			dgResp: `{ "queryAuthor": [
+				{ "id": "0x1", "name": "A2" },
+				{ "id": "0x3", "name": "C" }
+			] }`,
+			expected: `{ "subscribeAuthor": [
+				{ "event": "UPDATE", "changedFields": ["name"],
+					"node": { "id": "0x1", "name": "A2" } },
+				{ "event": "ADD", "changedFields": ["id", "name"],
+					"node": { "id": "0x3", "name": "C" } },
+				{ "event": "DELETE", "changedFields": [], "node": { "id": "0x2" } }
+			] }`,
+		},
+		{
+			name: "no change has no events",
+			dgResp: `{ "queryAuthor": [
+				{ "id": "0x1", "name": "A2" },
+				{ "id": "0x3", "name": "C" }
+			] }`,
+			expected: `{ "subscribeAuthor": [] }`,
+		},
+	}
+
+	for _, poll := range polls {
+		ex.resp = poll.dgResp
+		resp := resolver.Resolve(WithSubscriptionState(context.Background(), state), req)
+
+		require.Nil(t, resp.Errors, poll.name)
+		require.JSONEq(t, poll.expected, resp.Data.String(), poll.name)
+		require.True(t, state.HasEvents(), poll.name)
+	}
+	require.Equal(t, 0, state.Events())
+}
+
+// Tests that changedFields are the names of the fields that changed, whatever their aliases, and
+// that what else Dgraph returns for the nodes isn't a changed field.
+func TestSubscribeQueryChangedFieldNames(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromString(t, `
+	type Author {
+		id: ID!
+		name: String! @search(by: [hash])
+		posts: [Post]
+	}
+
+	type Post {
+		id: ID!
+		title: String!
+	}`)
+
+	ex := &executor{}
+	resolver := New(gqlSchema, NewResolverFactory(nil, nil).WithConventionResolvers(gqlSchema,
+		&ResolverFns{Qrw: NewQueryRewriter(), Ex: ex}))
+	state := NewSubscriptionState()
+	req := &schema.Request{Query: `subscription {
+		subscribeAuthor {
+			changedFields
+			node { id n: name postsAggregate { count } }
+		}
+	}`}
+
+	ex.resp = `{ "queryAuthor": [
+		{ "id": "0x1", "name": "A", "postsAggregate.count": 1, "dgraph.type": ["Author"] }
+	] }`
+	resp := resolver.Resolve(WithSubscriptionState(context.Background(), state), req)
+	require.Nil(t, resp.Errors)
+	require.JSONEq(t, `{ "subscribeAuthor": [ {
+		"changedFields": ["id", "name", "postsAggregate"],
+		"node": { "id": "0x1", "n": "A", "postsAggregate": { "count": 1 } }
+	} ] }`, resp.Data.String())
+
+	ex.resp = `{ "queryAuthor": [
+		{ "id": "0x1", "name": "A2", "postsAggregate.count": 2, "dgraph.type": ["Author"] }
+	] }`
+	resp = resolver.Resolve(WithSubscriptionState(context.Background(), state), req)
+	require.Nil(t, resp.Errors)
+	require.JSONEq(t, `{ "subscribeAuthor": [ {
+		"changedFields": ["name", "postsAggregate"],
+		"node": { "id": "0x1", "n": "A2", "postsAggregate": { "count": 2 } }
+	} ] }`, resp.Data.String())
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resolve
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+	"github.com/dgraph-io/dgraph/gql"
+	"github.com/dgraph-io/dgraph/graphql/dgraph"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// A TTLSweeper deletes the expired nodes of the types with @ttl.  Queries never return expired
+// nodes, so sweeping is only needed to stop them piling up in Dgraph.  Nothing runs a sweeper
+// by default, it's up to the server to run one if it wants expired nodes cleaned up.
+type TTLSweeper struct {
+	executor  DgraphExecutor
+	batchSize int
+}
+
+// NewTTLSweeper returns a TTLSweeper that deletes expired nodes through executor, at most
+// batchSize nodes per Dgraph request.
+func NewTTLSweeper(executor DgraphExecutor, batchSize int) *TTLSweeper {
+	return &TTLSweeper{executor: executor, batchSize: batchSize}
+}
+
+// Run sweeps every interval until ctx is done.  It calls sch before each sweep, so that the
+// sweeps follow schema updates; sch can return nil if there's no schema yet.
+func (ts *TTLSweeper) Run(ctx context.Context, interval time.Duration,
+	sch func() schema.Schema) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s := sch()
+			if s == nil {
+				continue
+			}
+			if _, err := ts.Sweep(ctx, s); err != nil {
+				glog.Errorf("Deleting expired nodes failed: %s", err)
+			}
+		}
+	}
+}
+
+// Sweep deletes the nodes that have expired in each type of sch with @ttl, and returns how
+// many it deleted.
+func (ts *TTLSweeper) Sweep(ctx context.Context, sch schema.Schema) (int, error) {
+	now := ttlNow()
+	deleted := 0
+	for _, typ := range sch.TTLTypes() {
+		for {
+			n, err := ts.sweepBatch(ctx, typ, now)
+			deleted += n
+			if err != nil {
+				return deleted, errors.Wrapf(err, "while deleting expired %s nodes", typ.Name())
+			}
+			if n == 0 || n < ts.batchSize {
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// sweepBatch deletes up to batchSize nodes of typ that had expired at now, with an upsert like
+//
+// query {
+//   x as expiredSession(func: type(Session), first: 100)
+//     @filter(lt(Session.expiresAt, "2020-01-01T00:00:00Z")) {
+//     uid
+//     Device1 as Session.device
+//   }
+// }
+// delete {
+//   uid(x) * * .
+//   uid(Device1) <Device.sessions> uid(x) .
+// }
+//
+// Like deleteT, it also deletes the edges into the expired nodes from the nodes they link to
+// with @hasInverse or reverse edges, so that those aren't left linking to nothing.
+func (ts *TTLSweeper) sweepBatch(ctx context.Context, typ schema.Type, now time.Time) (
+	int, error) {
+
+	qryName := "expired" + typ.Name()
+	dgQuery := &gql.GraphQuery{
+		Var:  MutationQueryVar,
+		Attr: qryName,
+		Args: map[string]string{"first": strconv.Itoa(ts.batchSize)},
+		Filter: &gql.FilterTree{
+			Func: &gql.Function{
+				Name: "lt",
+				Args: []gql.Arg{
+					{Value: typ.DgraphPredicate(typ.TTLField().Name())},
+					{Value: maybeQuoteArg("lt", now.UTC().Format(time.RFC3339))},
+				},
+			},
+		},
+		Children: []*gql.GraphQuery{{Attr: "uid"}},
+	}
+	addTypeFunc(dgQuery, typ)
+
+	deletes, err := json.Marshal(append(
+		[]interface{}{map[string]interface{}{"uid": MutationQueryVarUID}},
+		deleteInverseEdges(dgQuery, typ, NewVariableGenerator())...))
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := ts.executor.Execute(ctx, &dgoapi.Request{
+		Query:     dgraph.AsString(dgQuery),
+		Mutations: []*dgoapi.Mutation{{DeleteJson: deletes}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var result map[string][]interface{}
+	if len(resp.GetJson()) != 0 {
+		if err := json.Unmarshal(resp.GetJson(), &result); err != nil {
+			return 0, errors.Wrap(err, "couldn't unmarshal response from Dgraph")
+		}
+	}
+	return len(result[qryName]), ts.executor.CommitOrAbort(ctx, resp.GetTxn())
+}
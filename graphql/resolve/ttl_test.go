@@ -0,0 +1,103 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resolve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+	"github.com/dgraph-io/dgraph/graphql/dgraph"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/dgraph-io/dgraph/graphql/test"
+	"github.com/stretchr/testify/require"
+)
+
+// sweepExecutor answers each sweep request with the next number of expired nodes in expired.
+type sweepExecutor struct {
+	expired   []int
+	requests  []*dgoapi.Request
+	committed int
+}
+
+func (ex *sweepExecutor) Execute(ctx context.Context, req *dgoapi.Request) (
+	*dgoapi.Response, error) {
+
+	n := ex.expired[len(ex.requests)]
+	ex.requests = append(ex.requests, req)
+
+	nodes := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		nodes = append(nodes, map[string]interface{}{"uid": fmt.Sprintf("0x%x", i+1)})
+	}
+	b, err := json.Marshal(map[string]interface{}{"expiredSession": nodes})
+	if err != nil {
+		return nil, err
+	}
+	return &dgoapi.Response{Json: b, Txn: &dgoapi.TxnContext{}}, nil
+}
+
+func (ex *sweepExecutor) CommitOrAbort(ctx context.Context, tc *dgoapi.TxnContext) error {
+	ex.committed++
+	return nil
+}
+
+func TestTTLSweeperDeletesInBatches(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromFile(t, "schema.graphql")
+	ex := &sweepExecutor{expired: []int{2, 2, 1}}
+
+	deleted, err := NewTTLSweeper(ex, 2).Sweep(context.Background(), gqlSchema)
+	require.NoError(t, err)
+	require.Equal(t, 5, deleted)
+	require.Len(t, ex.requests, 3)
+	require.Equal(t, 3, ex.committed)
+
+	require.Equal(t, `query {
+  x as expiredSession(func: type(Session), first: 2) @filter(lt(Expiring.expiresAt, "2020-01-01T00:00:00Z")) {
+    uid
+    Device1 as Session.device
+  }
+}`, ex.requests[0].Query)
+	require.Len(t, ex.requests[0].Mutations, 1)
+	// The edges from the devices of the expired sessions to them are deleted too.
+	require.JSONEq(t, `[
+		{"uid": "uid(x)"},
+		{"uid": "uid(Device1)", "Device.sessions": [{"uid": "uid(x)"}]}
+	]`, string(ex.requests[0].Mutations[0].DeleteJson))
+}
+
+func TestTTLFilterKeepsNodesWithoutTTL(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromString(t, `
+	type Invite @ttl(field: "expiresAt") {
+		id: ID!
+		email: String!
+		expiresAt: DateTime
+	}`)
+	op, err := gqlSchema.Operation(&schema.Request{Query: `query { queryInvite { email } }`})
+	require.NoError(t, err)
+
+	dgQuery, err := NewQueryRewriter().Rewrite(context.Background(), test.GetQuery(t, op))
+	require.NoError(t, err)
+	require.Equal(t, `query {
+  queryInvite(func: type(Invite)) @filter((NOT (has(Invite.expiresAt)) OR ge(Invite.expiresAt, "2020-01-01T00:00:00Z"))) {
+    email : Invite.email
+    dgraph.uid : uid
+  }
+}`, dgraph.AsString(dgQuery))
+}
@@ -17,9 +17,13 @@
 package schema
 
 import (
+	"context"
 	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/dgraph-io/dgraph/x"
 	"github.com/vektah/gqlparser/v2/ast"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 	"github.com/vektah/gqlparser/v2/parser"
@@ -28,8 +32,25 @@ import (
 
 const (
 	RBACQueryPrefix = "{"
+
+	authRuleComment = "# Dgraph.AuthRule"
+	authRuleRef     = "ruleRef"
 )
 
+// namedAuthRule is an auth rule that's defined once in a schema comment like
+//
+// # Dgraph.AuthRule isOwner """query($USER: String!) { ... }"""
+//
+// and can then be used in any @auth directive as `{ ruleRef: "isOwner" }`.
+type namedAuthRule struct {
+	rule string
+	line int
+}
+
+// httpVariableRegex matches the $http.<header> variables in a rule.  They aren't valid GraphQL
+// variables, so they are renamed to authorization.HTTPVariable(header) before the rule is parsed.
+var httpVariableRegex = regexp.MustCompile(`\$http\.([A-Za-z0-9-]+)`)
+
 type RBACQuery struct {
 	Variable string
 	Operator string
@@ -45,6 +66,44 @@ type RuleNode struct {
 	Variables ast.VariableDefinitionList
 }
 
+// A RuleOp is what a RuleNode is, either a combinator of the nodes under it or a rule.
+type RuleOp string
+
+const (
+	RuleOr   RuleOp = "or"
+	RuleAnd  RuleOp = "and"
+	RuleNot  RuleOp = "not"
+	RuleLeaf RuleOp = "rule"
+)
+
+// Op returns what node is, so that the tree of rules can be walked without checking each of
+// node's fields.  The nodes under an "or", "and" or "not" are its Children, and a "rule" is either
+// Rule, a GraphQL query, or RBACRule.
+func (node *RuleNode) Op() RuleOp {
+	switch {
+	case len(node.Or) > 0:
+		return RuleOr
+	case len(node.And) > 0:
+		return RuleAnd
+	case node.Not != nil:
+		return RuleNot
+	}
+	return RuleLeaf
+}
+
+// Children returns the nodes that node combines, or nil if node is a rule.
+func (node *RuleNode) Children() []*RuleNode {
+	switch node.Op() {
+	case RuleOr:
+		return node.Or
+	case RuleAnd:
+		return node.And
+	case RuleNot:
+		return []*RuleNode{node.Not}
+	}
+	return nil
+}
+
 type AuthContainer struct {
 	Query  *RuleNode
 	Add    *RuleNode
@@ -142,12 +201,19 @@ type TypeAuth struct {
 	Fields map[string]*AuthContainer
 }
 
-func authRules(s *ast.Schema) (map[string]*TypeAuth, error) {
+func authRules(ctx context.Context, s *ast.Schema) (map[string]*TypeAuth, error) {
 	//TODO: Add position in error.
 	var errResult, err error
 	authRules := make(map[string]*TypeAuth)
 
+	done := 0
 	for _, typ := range s.Types {
+		if err := generationStopped(ctx, "parsing the auth rules", done,
+			len(s.Types)); err != nil {
+			return nil, err
+		}
+		done++
+
 		name := typeName(typ)
 		authRules[name] = &TypeAuth{Fields: make(map[string]*AuthContainer)}
 		auth := typ.Directives.ForName(authDirective)
@@ -251,10 +317,11 @@ func parseAuthNode(s *ast.Schema, typ *ast.Definition, val *ast.Value) (*RuleNod
 
 	if rule := val.Children.ForName("rule"); rule != nil {
 		var err error
-		if strings.HasPrefix(rule.Raw, RBACQueryPrefix) {
-			result.RBACRule, err = rbacValidateRule(typ, rule.Raw)
+		raw := withHTTPVariables(rule.Raw)
+		if strings.HasPrefix(raw, RBACQueryPrefix) {
+			result.RBACRule, err = rbacValidateRule(typ, raw)
 		} else {
-			err = gqlValidateRule(s, typ, rule.Raw, result)
+			err = gqlValidateRule(s, typ, raw, result)
 		}
 		errResult = AppendGQLErrs(errResult, err)
 		numChildren++
@@ -268,6 +335,14 @@ func parseAuthNode(s *ast.Schema, typ *ast.Definition, val *ast.Value) (*RuleNod
 	return result, errResult
 }
 
+// withHTTPVariables renames the $http.<header> variables in rule, which hold the values of the
+// allowed header claims of the request, to the names they have among the auth variables.
+func withHTTPVariables(rule string) string {
+	return httpVariableRegex.ReplaceAllStringFunc(rule, func(v string) string {
+		return "$" + authorization.HTTPVariable(httpVariableRegex.FindStringSubmatch(v)[1])
+	})
+}
+
 func rbacValidateRule(typ *ast.Definition, rule string) (*RBACQuery, error) {
 	rbacRegex, err :=
 		regexp.Compile(`^{[\s]?(.*?)[\s]?:[\s]?{[\s]?(\w*)[\s]?:[\s]?"(.*)"[\s]?}[\s]?}$`)
@@ -361,3 +436,151 @@ func gqlValidateRule(s *ast.Schema, typ *ast.Definition, rule string, node *Rule
 	node.Variables = op.VariableDefinitions
 	return nil
 }
+
+// parseNamedAuthRules collects all the `# Dgraph.AuthRule name rule` comments in sch.  The
+// rule is either a "string" on one line, or a """block string""" that can carry on over the
+// following comment lines.
+func parseNamedAuthRules(sch string) (map[string]*namedAuthRule, gqlerror.List) {
+	var errs gqlerror.List
+	rules := make(map[string]*namedAuthRule)
+
+	lines := strings.Split(sch, "\n")
+	for _, cl := range dgraphCommentLines(sch, authRuleComment) {
+		text := cl.text
+		startLine := cl.line
+		formatErr := gqlerror.ErrorLocf("", startLine, 1, "incorrect format for specifying "+
+			"Dgraph auth rule found for comment: `%s`, it should be "+
+			"`# Dgraph.AuthRule name \"rule\"` or `# Dgraph.AuthRule name \"\"\"rule\"\"\"`", text)
+
+		parts := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(text, authRuleComment)),
+			" ", 2)
+		if len(parts) != 2 {
+			errs = append(errs, formatErr)
+			continue
+		}
+		name, val := parts[0], strings.TrimSpace(parts[1])
+
+		var rule string
+		switch {
+		case strings.HasPrefix(val, `"""`):
+			val = strings.TrimPrefix(val, `"""`)
+			// lines are numbered from 1, so the line after startLine is lines[startLine]
+			nextLine := startLine
+			var sb strings.Builder
+			closed := false
+			for {
+				if idx := strings.Index(val, `"""`); idx >= 0 {
+					closed = strings.TrimSpace(val[idx+3:]) == ""
+					x.Check2(sb.WriteString(val[:idx]))
+					break
+				}
+				x.Check2(sb.WriteString(val + "\n"))
+
+				// the block string carries on over the next comment line
+				if nextLine >= len(lines) {
+					break
+				}
+				next := strings.TrimSpace(lines[nextLine])
+				nextLine++
+				if !strings.HasPrefix(next, "#") {
+					break
+				}
+				val = strings.TrimPrefix(next, "#")
+			}
+			if !closed {
+				errs = append(errs, formatErr)
+				continue
+			}
+			rule = sb.String()
+		case strings.HasPrefix(val, `"`):
+			var err error
+			if rule, err = strconv.Unquote(val); err != nil {
+				errs = append(errs, formatErr)
+				continue
+			}
+		default:
+			errs = append(errs, formatErr)
+			continue
+		}
+
+		if prev, ok := rules[name]; ok {
+			err := gqlerror.ErrorLocf("", prev.line, 1,
+				"Dgraph.AuthRule %s is defined more than once, a rule name can only be "+
+					"defined once.", name)
+			err.Locations = append(err.Locations, gqlerror.Location{Line: startLine, Column: 1})
+			errs = append(errs, err)
+			continue
+		}
+		rules[name] = &namedAuthRule{rule: strings.TrimSpace(rule), line: startLine}
+	}
+
+	return rules, errs
+}
+
+// inlineAuthRuleRefs replaces every `{ ruleRef: "name" }` in the @auth directives of doc with
+// `{ rule: "..." }` for the named rule.  After that, the schema is exactly as if the rules had
+// been written out in full, so nothing downstream needs to know about named rules.
+func inlineAuthRuleRefs(doc *ast.SchemaDocument, rules map[string]*namedAuthRule) gqlerror.List {
+	var errs gqlerror.List
+	for _, defn := range doc.Definitions {
+		if defn.BuiltIn {
+			continue
+		}
+		if dir := defn.Directives.ForName(authDirective); dir != nil {
+			for _, arg := range dir.Arguments {
+				errs = append(errs, inlineAuthRuleRefsInValue(defn, arg.Value, rules)...)
+			}
+		}
+		for _, fld := range defn.Fields {
+			if dir := fld.Directives.ForName(authDirective); dir != nil {
+				for _, arg := range dir.Arguments {
+					errs = append(errs, inlineAuthRuleRefsInValue(defn, arg.Value, rules)...)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func inlineAuthRuleRefsInValue(
+	typ *ast.Definition,
+	val *ast.Value,
+	rules map[string]*namedAuthRule) gqlerror.List {
+
+	if val == nil {
+		return nil
+	}
+
+	var errs gqlerror.List
+	for _, child := range val.Children {
+		if val.Kind != ast.ObjectValue || child.Name != authRuleRef {
+			errs = append(errs, inlineAuthRuleRefsInValue(typ, child.Value, rules)...)
+			continue
+		}
+
+		if child.Value == nil ||
+			(child.Value.Kind != ast.StringValue && child.Value.Kind != ast.BlockValue) {
+			errs = append(errs, gqlerror.ErrorPosf(child.Position,
+				"Type %s: @auth: %s should be the name of a rule defined with %s.",
+				typ.Name, authRuleRef, authRuleComment))
+			continue
+		}
+
+		named, ok := rules[child.Value.Raw]
+		if !ok {
+			errs = append(errs, gqlerror.ErrorPosf(child.Value.Position,
+				"Type %s: @auth: %s %s isn't defined. Rules are defined with a "+
+					"`%s %s \"rule\"` comment.", typ.Name, authRuleRef, child.Value.Raw,
+				authRuleComment, child.Value.Raw))
+			continue
+		}
+
+		child.Name = "rule"
+		child.Value = &ast.Value{
+			Kind:     ast.BlockValue,
+			Raw:      named.rule,
+			Position: child.Value.Position,
+		}
+	}
+	return errs
+}
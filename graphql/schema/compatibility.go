@@ -0,0 +1,206 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"github.com/dgraph-io/dgraph/x"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// A SavedOperation is a GraphQL request that a client has made, kept so that it can be checked
+// against a proposed schema before that's deployed.
+type SavedOperation struct {
+	Name      string                 `json:"name"`
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// A BreakKind is the way that a SavedOperation breaks.
+type BreakKind string
+
+const (
+	// RemovedField is a selection of a field that the schema doesn't have.
+	RemovedField BreakKind = "REMOVED_FIELD"
+	// ArgumentChange is an argument, or the value given for it, that no longer fits the
+	// arguments of the field, e.g. because the argument was removed, its type changed, or a
+	// required argument was added.
+	ArgumentChange BreakKind = "ARGUMENT_CHANGE"
+	// InvalidOperation is any other reason the operation would be rejected.
+	InvalidOperation BreakKind = "INVALID_OPERATION"
+)
+
+// A BreakReport is one reason that a SavedOperation would be rejected by a schema.
+type BreakReport struct {
+	OperationName string    `json:"operationName"`
+	Kind          BreakKind `json:"kind"`
+	// Path is the selection that breaks, like queryPost.author.name, with the argument in
+	// parentheses if it's the value given for an argument that breaks, like
+	// queryPost(filter.title).  Selections in a named fragment start from the fragment, like
+	// ...PostFields.title.  Variables whose values no longer fit their types are like
+	// variable.filter.title.  Path is "" if the break isn't in any of those.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// argumentRules are the validation rules that catch arguments that no longer fit the schema.
+var argumentRules = map[string]bool{
+	"KnownArgumentNames":         true,
+	"KnownTypeNames":             true,
+	"ProvidedRequiredArguments":  true,
+	"ValuesOfCorrectType":        true,
+	"VariablesInAllowedPosition": true,
+}
+
+// CheckOperations returns the reasons that newSchema would reject each of operations.  They
+// are validated in the same way as Operation validates a request, but nothing is run.  An
+// operation that newSchema accepts has no reports.
+func CheckOperations(newSchema Schema, operations []SavedOperation) []BreakReport {
+	reports := make([]BreakReport, 0)
+	for _, op := range operations {
+		_, err := newSchema.Operation(&Request{
+			Query:         op.Query,
+			OperationName: op.Name,
+			Variables:     op.Variables,
+		})
+		if err == nil {
+			continue
+		}
+
+		name := op.Name
+		var paths map[gqlerror.Location]string
+		if doc, gqlErr := parser.ParseQuery(&ast.Source{Input: op.Query}); gqlErr == nil {
+			paths = selectionPaths(doc)
+			if name == "" && len(doc.Operations) == 1 {
+				name = doc.Operations[0].Name
+			}
+		}
+
+		for _, e := range operationErrors(err) {
+			report := BreakReport{
+				OperationName: name,
+				Kind:          InvalidOperation,
+				Message:       e.Message,
+			}
+			switch {
+			case e.Rule == "FieldsOnCorrectType":
+				report.Kind = RemovedField
+			case argumentRules[e.Rule]:
+				report.Kind = ArgumentChange
+			case len(e.Path) > 0 && e.Path[0] == ast.PathName("variable"):
+				// The values of the variables are checked once the operation is valid.
+				report.Kind = ArgumentChange
+			}
+			if len(e.Path) > 0 {
+				report.Path = e.Path.String()
+			}
+			for _, loc := range e.Locations {
+				if path, ok := paths[loc]; ok {
+					report.Path = path
+					break
+				}
+			}
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+// operationErrors returns the errors in err, the error Operation returned.
+func operationErrors(err error) gqlerror.List {
+	switch e := err.(type) {
+	case gqlerror.List:
+		return e
+	case *gqlerror.Error:
+		return gqlerror.List{e}
+	case *x.GqlError:
+		gqlErr := &gqlerror.Error{Message: e.Message}
+		for _, loc := range e.Locations {
+			gqlErr.Locations = append(gqlErr.Locations,
+				gqlerror.Location{Line: loc.Line, Column: loc.Column})
+		}
+		return gqlerror.List{gqlErr}
+	default:
+		return gqlerror.List{{Message: err.Error()}}
+	}
+}
+
+// selectionPaths returns the paths of the selections in doc, and of their arguments and
+// argument values, by where they are in the query.  Validation errors are located at those
+// positions.
+func selectionPaths(doc *ast.QueryDocument) map[gqlerror.Location]string {
+	paths := make(map[gqlerror.Location]string)
+	for _, op := range doc.Operations {
+		addSelectionPaths(paths, "", op.SelectionSet)
+	}
+	for _, frag := range doc.Fragments {
+		addSelectionPaths(paths, "..."+frag.Name, frag.SelectionSet)
+	}
+	return paths
+}
+
+func addSelectionPaths(paths map[gqlerror.Location]string, parent string,
+	sels ast.SelectionSet) {
+
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			path := sel.Alias
+			if parent != "" {
+				path = parent + "." + path
+			}
+			addPosition(paths, sel.Position, path)
+			for _, arg := range sel.Arguments {
+				addPosition(paths, arg.Position, path+"("+arg.Name+")")
+				addValuePaths(paths, path, arg.Name, arg.Value)
+			}
+			addSelectionPaths(paths, path, sel.SelectionSet)
+		case *ast.InlineFragment:
+			// An inline fragment selects more fields of the same node, so it's not in the path.
+			addPosition(paths, sel.Position, parent)
+			addSelectionPaths(paths, parent, sel.SelectionSet)
+		case *ast.FragmentSpread:
+			addPosition(paths, sel.Position, parent)
+		}
+	}
+}
+
+// addValuePaths adds the paths of val, the value given for the argument arg of the field at
+// path, and of the values inside it, like queryPost(filter.title.anyofterms).
+func addValuePaths(paths map[gqlerror.Location]string, path, arg string, val *ast.Value) {
+	if val == nil {
+		return
+	}
+	addPosition(paths, val.Position, path+"("+arg+")")
+	for _, child := range val.Children {
+		childArg := arg
+		if child.Name != "" {
+			// The values in a list have no names, they are at the path of the list.
+			childArg = arg + "." + child.Name
+		}
+		addPosition(paths, child.Position, path+"("+childArg+")")
+		addValuePaths(paths, path, childArg, child.Value)
+	}
+}
+
+func addPosition(paths map[gqlerror.Location]string, pos *ast.Position, path string) {
+	if pos == nil {
+		return
+	}
+	paths[gqlerror.Location{Line: pos.Line, Column: pos.Column}] = path
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOperations(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	type Post {
+		id: ID!
+		title: String! @search(by: [term])
+		author: Author
+	}
+
+	type Author {
+		id: ID!
+		name: String! @search(by: [hash])
+	}`)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	tcases := map[string]struct {
+		operation SavedOperation
+		expected  []BreakReport
+	}{
+		"operation that still works": {
+			operation: SavedOperation{
+				Name:  "Titles",
+				Query: `query Titles { queryPost { title author { name } } }`,
+			},
+		},
+		"removed field": {
+			operation: SavedOperation{
+				Name:  "Posts",
+				Query: `query Posts { queryPost { title text } }`,
+			},
+			expected: []BreakReport{{
+				OperationName: "Posts",
+				Kind:          RemovedField,
+				Path:          "queryPost.text",
+				Message:       `Cannot query field "text" on type "Post".`,
+			}},
+		},
+		"removed field in a named fragment": {
+			operation: SavedOperation{
+				Query: `query Frag { queryPost { ...PostFields } }
+				fragment PostFields on Post { title text }`,
+			},
+			expected: []BreakReport{{
+				OperationName: "Frag",
+				Kind:          RemovedField,
+				Path:          "...PostFields.text",
+				Message:       `Cannot query field "text" on type "Post".`,
+			}},
+		},
+		"filter on a removed field": {
+			operation: SavedOperation{
+				Name:  "Liked",
+				Query: `query Liked { queryPost(filter: { numLikes: { gt: 1 } }) { title } }`,
+			},
+			expected: []BreakReport{{
+				OperationName: "Liked",
+				Kind:          ArgumentChange,
+				Path:          "queryPost(filter.numLikes)",
+				Message:       `Field "numLikes" is not defined by type PostFilter.`,
+			}},
+		},
+		"variable of a type the argument no longer is": {
+			operation: SavedOperation{
+				Name: "Authors",
+				Query: `query Authors($f: PostFilter) {
+					queryAuthor(filter: $f) { name }
+				}`,
+			},
+			expected: []BreakReport{{
+				OperationName: "Authors",
+				Kind:          ArgumentChange,
+				Path:          "queryAuthor(filter)",
+				Message: `Variable "$f" of type "PostFilter" used in position expecting type ` +
+					`"AuthorFilter".`,
+			}},
+		},
+		"variable value with a removed field": {
+			operation: SavedOperation{
+				Name:      "Search",
+				Query:     `query Search($f: PostFilter) { queryPost(filter: $f) { title } }`,
+				Variables: map[string]interface{}{"f": map[string]interface{}{"numLikes": 1}},
+			},
+			expected: []BreakReport{{
+				OperationName: "Search",
+				Kind:          ArgumentChange,
+				Path:          "variable.f.numLikes",
+				Message:       "unknown field",
+			}},
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			reports := CheckOperations(sch, []SavedOperation{tcase.operation})
+			require.Len(t, reports, len(tcase.expected))
+			for i, report := range reports {
+				require.Equal(t, tcase.expected[i].OperationName, report.OperationName)
+				require.Equal(t, tcase.expected[i].Kind, report.Kind)
+				require.Equal(t, tcase.expected[i].Path, report.Path)
+				// Validation can suggest what was meant, after the reason.
+				require.Contains(t, report.Message, tcase.expected[i].Message)
+			}
+		})
+	}
+}
+
+func TestCheckOperationsLeavesServedAuthAlone(t *testing.T) {
+	authSchema := func(header string) Schema {
+		schHandler, err := NewHandler(`
+		type Post {
+			id: ID!
+			title: String!
+		}
+		# Dgraph.Authorization {"VerificationKey":"key","Header":"` + header +
+			`","Namespace":"https://xyz.io/jwt/claims","Algo":"HS256"}`)
+		require.NoError(t, err)
+		sch, err := FromHandler(context.Background(), schHandler)
+		require.NoError(t, err)
+		return sch
+	}
+
+	reg := NewRegistry()
+	reg.Set(authSchema("X-Served-Auth"))
+
+	// Building and checking against a proposed schema doesn't touch the schema being served.
+	proposed := authSchema("X-Proposed-Auth")
+	reports := CheckOperations(proposed, []SavedOperation{{Query: `query { queryPost { title } }`}})
+	require.Empty(t, reports)
+	require.Equal(t, "X-Served-Auth",
+		authorization.HeaderFrom(reg.WithAuthMeta(context.Background(), DefaultNamespace)))
+}
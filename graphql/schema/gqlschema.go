@@ -17,11 +17,16 @@
 package schema
 
 import (
+	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
+	dgtypes "github.com/dgraph-io/dgraph/types"
 	"github.com/dgraph-io/dgraph/x"
+	"github.com/pkg/errors"
 	"github.com/vektah/gqlparser/v2/ast"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 	"github.com/vektah/gqlparser/v2/parser"
@@ -33,24 +38,84 @@ const (
 
 	searchDirective = "search"
 	searchArgs      = "by"
+	searchPresence  = "presence"
+	searchPrecision = "precision"
 
 	dgraphDirective  = "dgraph"
 	dgraphTypeArg    = "type"
+	dgraphIncludeArg = "includeTypes"
 	dgraphPredArg    = "pred"
+	dgraphFacetArg   = "facet"
 	idDirective      = "id"
+	idCompositeArg   = "composite"
 	secretDirective  = "secret"
 	authDirective    = "auth"
 	customDirective  = "custom"
 	remoteDirective  = "remote" // types with this directive are not stored in Dgraph.
 	cascadeDirective = "cascade"
+	langDirective    = "lang"
+	langArg          = "lang"
+	langValueType    = "LangValue"
+	ttlDirective     = "ttl"
+	ttlFieldArg      = "field"
+	allowExpiredArg  = "allowExpired"
+
+	softDeleteDirective = "softDelete"
+	softDeleteFieldArg  = "field"
+	includeDeletedArg   = "includeDeleted"
+
+	createdByDirective = "createdBy"
+	createdByClaimArg  = "claim"
+	createdAtDirective = "createdAt"
+	updatedAtDirective = "updatedAt"
+
+	defaultDirective = "default"
+	defaultValueArg  = "value"
+
+	// generatedDirective marks the types and fields that are generated from others, and only
+	// have meaning alongside them, so that they can be told apart from those in the input.
+	generatedDirective = "generated"
+
+	enumDirective      = "enum"
+	caseInsensitiveArg = "caseInsensitive"
 
 	// custom directive args and fields
+	dql    = "dql"
 	mode   = "mode"
 	BATCH  = "BATCH"
 	SINGLE = "SINGLE"
+	// LoopbackURL as the url of a @custom graphql request makes it a loopback request, which
+	// is resolved in process by the server's own GraphQL API, rather than sent over HTTP.
+	LoopbackURL = "dgraph://self"
 
 	deprecatedDirective = "deprecated"
 	NumUid              = "numUids"
+	Msg                 = "msg"
+	PageNodes           = "nodes"
+	PageTotalCount      = "totalCount"
+	pageQueryPrefix     = "page"
+	pageResultSuffix    = "PageResult"
+
+	// A list field f of type [T] gets a sibling fAggregate of type TAggregateResult, which has
+	// the count of the nodes and fields that aggregate their values, see aggregateFuncs.
+	AggregateCount        = "count"
+	aggregateFieldSuffix  = "Aggregate"
+	aggregateResultSuffix = "AggregateResult"
+
+	// A query groupTByF groups the nodes of type T by their values of the field f, into a list
+	// of TFGroup, which has the value and the count of the nodes that have it.
+	groupQueryPrefix  = "group"
+	groupResultSuffix = "Group"
+
+	// The fields of TSubscriptionEvent, the events that subscribeT sends, and the
+	// SubscriptionEvent values for what happened to the node.
+	SubscriptionEventEnum = "SubscriptionEvent"
+	SubscriptionEvent     = "event"
+	SubscriptionChanged   = "changedFields"
+	SubscriptionNode      = "node"
+	SubscriptionAdd       = "ADD"
+	SubscriptionUpdate    = "UPDATE"
+	SubscriptionDelete    = "DELETE"
 
 	Typename = "__typename"
 
@@ -60,6 +125,8 @@ const (
 	schemaExtras = `
 scalar DateTime
 
+scalar Polygon
+
 enum DgraphIndex {
 	int
 	float
@@ -74,6 +141,7 @@ enum DgraphIndex {
 	month
 	day
 	hour
+	geo
 }
 
 input AuthRule {
@@ -104,22 +172,42 @@ input CustomHTTP {
 	mode: Mode
 	forwardHeaders: [String!]
 	secretHeaders: [String!]
+	introspectionHeaders: [String!]
 	skipIntrospection: Boolean
+	allowGetBody: Boolean
+	resultPath: String
+	strictPath: Boolean
+	errorHandling: CustomHTTPErrorHandling
+}
+
+input CustomHTTPErrorHandling {
+	nullOn: [Int!]
+	messagePath: String
+	propagateStatus: Boolean
 }
 
 directive @hasInverse(field: String!) on FIELD_DEFINITION
-directive @search(by: [DgraphIndex!]) on FIELD_DEFINITION
-directive @dgraph(type: String, pred: String) on OBJECT | INTERFACE | FIELD_DEFINITION
-directive @id on FIELD_DEFINITION
+directive @search(by: [DgraphIndex!], presence: Boolean, precision: Int) on FIELD_DEFINITION
+directive @dgraph(type: String, pred: String, facet: String, includeTypes: [String!]) on OBJECT | INTERFACE | UNION | FIELD_DEFINITION
+directive @id(composite: String) on FIELD_DEFINITION
 directive @secret(field: String!, pred: String) on OBJECT | INTERFACE
 directive @auth(
 	query: AuthRule,
 	add: AuthRule,
 	update: AuthRule,
-	delete:AuthRule) on OBJECT
-directive @custom(http: CustomHTTP) on FIELD_DEFINITION
+	delete:AuthRule) on OBJECT | FIELD_DEFINITION
+directive @custom(http: [CustomHTTP!], dql: String) on FIELD_DEFINITION
+directive @lang on FIELD_DEFINITION
 directive @remote on OBJECT | INTERFACE
 directive @cascade on FIELD
+directive @enum(caseInsensitive: Boolean) on ENUM
+directive @ttl(field: String!) on OBJECT | INTERFACE
+directive @softDelete(field: String!) on OBJECT | INTERFACE
+directive @createdBy(claim: String!) on FIELD_DEFINITION
+directive @createdAt on FIELD_DEFINITION
+directive @updatedAt on FIELD_DEFINITION
+directive @default(value: String!) on FIELD_DEFINITION
+directive @generated on OBJECT | FIELD_DEFINITION
 
 input IntFilter {
 	eq: Int
@@ -135,6 +223,12 @@ input FloatFilter {
 	lt: Float
 	ge: Float
 	gt: Float
+	between: FloatRange
+}
+
+input FloatRange {
+	min: Float!
+	max: Float!
 }
 
 input DateTimeFilter {
@@ -148,10 +242,12 @@ input DateTimeFilter {
 input StringTermFilter {
 	allofterms: String
 	anyofterms: String
+	phrase: String
 }
 
 input StringRegExpFilter {
 	regexp: String
+	anyofregexp: [String!]
 }
 
 input StringFullTextFilter {
@@ -170,6 +266,22 @@ input StringExactFilter {
 input StringHashFilter {
 	eq: String
 }
+
+input PolygonGeoFilter {
+	contains: [Float!]
+	intersects: Polygon
+	within: Polygon
+}
+
+input PresenceFilter {
+	has: Boolean
+	hasNot: Boolean
+}
+
+input LangValue {
+	value: String!
+	lang: String
+}
 `
 )
 
@@ -218,6 +330,50 @@ var supportedSearches = map[string]searchTypeIndex{
 	"month":    {"DateTime", "month"},
 	"day":      {"DateTime", "day"},
 	"hour":     {"DateTime", "hour"},
+	"geo":      {"Polygon", "geo"},
+}
+
+// custom tokenizer plugin name -> GraphQL type it applies to.  These are given to @search
+// as strings, like @search(by: ["myplugin"]), and the Dgraph index is the tokenizer name.
+var searchTokenizers = struct {
+	sync.RWMutex
+	types map[string]string
+}{types: make(map[string]string)}
+
+// RegisterSearchTokenizer makes the custom tokenizer plugin name usable in @search.  typ is
+// the Dgraph type the tokenizer applies to, as given by the tokenizer's Type().
+func RegisterSearchTokenizer(name, typ string) error {
+	if _, ok := supportedSearches[name]; ok {
+		return errors.Errorf("custom tokenizer %s has the same name as a built-in index", name)
+	}
+
+	gqlType := ""
+	for scalar, dgType := range scalarToDgraph {
+		if strings.EqualFold(dgType, typ) && scalar != IDType {
+			gqlType = scalar
+		}
+	}
+	if gqlType == "" {
+		return errors.Errorf("custom tokenizer %s is for type %s, which can't be used in GraphQL",
+			name, typ)
+	}
+
+	searchTokenizers.Lock()
+	defer searchTokenizers.Unlock()
+	searchTokenizers.types[name] = gqlType
+	return nil
+}
+
+// searchFor returns the search for arg, either built in or from a registered custom tokenizer.
+func searchFor(arg string) (searchTypeIndex, bool) {
+	if search, ok := supportedSearches[arg]; ok {
+		return search, true
+	}
+
+	searchTokenizers.RLock()
+	defer searchTokenizers.RUnlock()
+	gqlType, ok := searchTokenizers.types[arg]
+	return searchTypeIndex{gqlType, arg}, ok
 }
 
 // GraphQL scalar type -> default Dgraph index (/search)
@@ -228,6 +384,7 @@ var defaultSearches = map[string]string{
 	"Float":    "float",
 	"String":   "term",
 	"DateTime": "year",
+	"Polygon":  "geo",
 }
 
 // graphqlSpecScalars holds all the scalar types supported by the graphql spec.
@@ -254,6 +411,19 @@ var orderable = map[string]bool{
 	"DateTime": true,
 }
 
+// aggregateFuncs are the Dgraph aggregation functions that the fields of TAggregateResult are
+// computed with, along with the suffix that's added to a field of T for them, e.g. scoreAvg for
+// the average score.  Sums and averages are only there for Int and Float fields.
+var aggregateFuncs = []struct {
+	suffix, fn string
+	numeric    bool
+}{
+	{"Min", "min", false},
+	{"Max", "max", false},
+	{"Sum", "sum", true},
+	{"Avg", "avg", true},
+}
+
 var enumDirectives = map[string]bool{
 	"trigram": true,
 	"hash":    true,
@@ -276,6 +446,7 @@ var builtInFilters = map[string]string{
 	"fulltext": "StringFullTextFilter",
 	"exact":    "StringExactFilter",
 	"hash":     "StringHashFilter",
+	"geo":      "PolygonGeoFilter",
 }
 
 // GraphQL scalar -> Dgraph scalar
@@ -287,6 +458,7 @@ var scalarToDgraph = map[string]string{
 	"String":   "string",
 	"DateTime": "dateTime",
 	"Password": "password",
+	"Polygon":  "geo",
 }
 
 func ValidatorNoOp(
@@ -305,10 +477,18 @@ var directiveValidators = map[string]directiveValidator{
 	idDirective:         idValidation,
 	secretDirective:     passwordValidation,
 	customDirective:     customDirectiveValidation,
+	langDirective:       langValidation,
 	remoteDirective:     ValidatorNoOp,
 	deprecatedDirective: ValidatorNoOp,
-	// Just go get it printed into generated schema
-	authDirective: ValidatorNoOp,
+	authDirective:       authValidation,
+	enumDirective:       ValidatorNoOp,
+	ttlDirective:        ValidatorNoOp,
+	softDeleteDirective: ValidatorNoOp,
+	createdByDirective:  auditValidation,
+	createdAtDirective:  auditValidation,
+	updatedAtDirective:  auditValidation,
+	defaultDirective:    defaultValidation,
+	generatedDirective:  generatedValidation,
 }
 
 var schemaDocValidations []func(schema *ast.SchemaDocument) gqlerror.List
@@ -370,6 +550,13 @@ func expandSchema(doc *ast.SchemaDocument) {
 				if passwordDirective != nil {
 					defn.Directives = append(defn.Directives, passwordDirective)
 				}
+				// A type's own @ttl and @softDelete win over the ones it would inherit.
+				for _, name := range []string{ttlDirective, softDeleteDirective} {
+					dir := i.Directives.ForName(name)
+					if dir != nil && defn.Directives.ForName(name) == nil {
+						defn.Directives = append(defn.Directives, dir)
+					}
+				}
 			}
 		}
 	}
@@ -378,6 +565,22 @@ func expandSchema(doc *ast.SchemaDocument) {
 	doc.Directives = append(doc.Directives, docExtras.Directives...)
 }
 
+// addExtendedQueryAndMutation adds an empty Query, Mutation or Subscription definition to doc for
+// each of those that doc extends without declaring, so `extend type Query { ... }` works the same
+// whether or not the schema also has a `type Query`.
+func addExtendedQueryAndMutation(doc *ast.SchemaDocument) {
+	for _, ext := range doc.Extensions {
+		if !isQueryOrMutation(ext.Name) || doc.Definitions.ForName(ext.Name) != nil {
+			continue
+		}
+		doc.Definitions = append(doc.Definitions, &ast.Definition{
+			Kind:     ast.Object,
+			Name:     ext.Name,
+			Position: ext.Position,
+		})
+	}
+}
+
 // preGQLValidation validates schema before GraphQL validation.  Validation
 // before GraphQL validation means the schema only has allowed structures, and
 // means we can give better errors than GrqphQL validation would give if their
@@ -393,6 +596,9 @@ func preGQLValidation(schema *ast.SchemaDocument) gqlerror.List {
 		}
 		errs = append(errs, applyDefnValidations(defn, nil, defnValidations)...)
 	}
+	for _, defn := range schema.Extensions {
+		errs = append(errs, applyDefnValidations(defn, nil, defnValidations)...)
+	}
 
 	errs = append(errs, applySchemaDocValidations(schema)...)
 
@@ -402,12 +608,22 @@ func preGQLValidation(schema *ast.SchemaDocument) gqlerror.List {
 // postGQLValidation validates schema after gql validation.  Some validations
 // are easier to run once we know that the schema is GraphQL valid and that validation
 // has fleshed out the schema structure; we just need to check if it also satisfies
-// the extra rules.
-func postGQLValidation(schema *ast.Schema, definitions []string,
-	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
+// the extra rules.  It also returns the required arguments of the remote queries that the
+// @custom directives were validated against.
+func postGQLValidation(ctx context.Context, schema *ast.Schema, definitions []string,
+	secrets map[string]x.SensitiveByteSlice) (gqlerror.List, requiredRemoteArgs, error) {
 	var errs []*gqlerror.Error
+	remoteArgs := make(requiredRemoteArgs)
 
-	for _, defn := range definitions {
+	// The @hasInverse links are checked as they were declared, before the directive validators
+	// add the directives that were left out at the other end.
+	errs = append(errs, inverseConsistencyValidation(schema, definitions)...)
+
+	for i, defn := range definitions {
+		if err := generationStopped(ctx, "validating the schema", i,
+			len(definitions)); err != nil {
+			return nil, nil, err
+		}
 		typ := schema.Types[defn]
 
 		errs = append(errs, applyDefnValidations(typ, schema, typeValidations)...)
@@ -416,6 +632,11 @@ func postGQLValidation(schema *ast.Schema, definitions []string,
 			errs = append(errs, applyFieldValidations(typ, field)...)
 
 			for _, dir := range field.Directives {
+				if dir.Name == customDirective {
+					errs = append(errs, validateCustomDirective(schema, typ, field, dir, secrets,
+						remoteArgs)...)
+					continue
+				}
 				if directiveValidators[dir.Name] == nil {
 					continue
 				}
@@ -426,7 +647,7 @@ func postGQLValidation(schema *ast.Schema, definitions []string,
 
 	errs = append(errs, applySchemaValidations(schema, definitions)...)
 
-	return errs
+	return errs, remoteArgs, nil
 }
 
 func applySchemaDocValidations(schema *ast.SchemaDocument) gqlerror.List {
@@ -476,7 +697,8 @@ func applyFieldValidations(typ *ast.Definition, field *ast.FieldDefinition) gqle
 
 // completeSchema generates all the required types and fields for
 // query/mutation/update for all the types mentioned in the schema.
-func completeSchema(sch *ast.Schema, definitions []string) {
+// It stops with an error as soon as ctx is done.
+func completeSchema(ctx context.Context, sch *ast.Schema, definitions []string) error {
 	query := sch.Types["Query"]
 	if query != nil {
 		query.Kind = ast.Object
@@ -501,17 +723,33 @@ func completeSchema(sch *ast.Schema, definitions []string) {
 		}
 	}
 
-	sch.Subscription = &ast.Definition{
-		Kind:   ast.Object,
-		Name:   "Subscription",
-		Fields: make([]*ast.FieldDefinition, 0),
+	subscription := sch.Types["Subscription"]
+	if subscription != nil {
+		subscription.Kind = ast.Object
+		sch.Subscription = subscription
+	} else {
+		sch.Subscription = &ast.Definition{
+			Kind:   ast.Object,
+			Name:   "Subscription",
+			Fields: make([]*ast.FieldDefinition, 0),
+		}
 	}
 
-	for _, key := range definitions {
+	for i, key := range definitions {
+		if err := generationStopped(ctx, "completing the schema", i,
+			len(definitions)); err != nil {
+			return err
+		}
 		if isQueryOrMutation(key) {
 			continue
 		}
 		defn := sch.Types[key]
+		if defn.Kind == ast.Union {
+			// The members of a union are stored under the union's Dgraph type as well as their
+			// own, so all of them can be queried together.
+			addFilterQuery(sch, defn)
+			continue
+		}
 		if defn.Kind != ast.Interface && defn.Kind != ast.Object {
 			continue
 		}
@@ -533,6 +771,7 @@ func completeSchema(sch *ast.Schema, definitions []string) {
 		case ast.Object:
 			// types and inputs needed for mutations
 			addInputType(sch, defn)
+			addUpsertInputType(sch, defn)
 			addAddPayloadType(sch, defn)
 			addMutations(sch, defn)
 		}
@@ -543,6 +782,31 @@ func completeSchema(sch *ast.Schema, definitions []string) {
 		addFieldFilters(sch, defn)
 		addQueries(sch, defn)
 	}
+
+	// Aggregate fields are only added once everything else has been generated from the fields
+	// of the types, so that they don't end up in the inputs, filters and orders of the types.
+	for _, key := range definitions {
+		defn := sch.Types[key]
+		if isQueryOrMutation(key) || (defn.Kind != ast.Interface && defn.Kind != ast.Object) {
+			continue
+		}
+		addAggregateFields(sch, defn)
+	}
+
+	// The getTByField queries are only a convenience, so they are added once all the other
+	// queries are there, and any whose name is already taken is left out.
+	taken := make(map[string]bool, len(sch.Query.Fields))
+	for _, qry := range sch.Query.Fields {
+		taken[qry.Name] = true
+	}
+	for _, key := range definitions {
+		defn := sch.Types[key]
+		if isQueryOrMutation(key) || (defn.Kind != ast.Interface && defn.Kind != ast.Object) {
+			continue
+		}
+		addGetByFieldQueries(sch, defn, taken)
+	}
+	return nil
 }
 
 func addInputType(schema *ast.Schema, defn *ast.Definition) {
@@ -553,6 +817,33 @@ func addInputType(schema *ast.Schema, defn *ast.Definition) {
 	}
 }
 
+// addUpsertInputType adds UpsertTInput, the input of upsertT.  It has the fields of AddTInput,
+// but only the @id field is required, because when the node already exists, the other fields
+// are just the ones to update.  That a new node gets all its required fields is checked when
+// the mutation is rewritten.
+func addUpsertInputType(schema *ast.Schema, defn *ast.Definition) {
+	if !hasUpsertMutation(defn) {
+		return
+	}
+
+	flds := getFieldsWithoutIDType(schema, defn)
+	for _, fld := range flds {
+		fld.Type.NonNull = hasIDDirective(fld)
+	}
+	schema.Types["Upsert"+defn.Name+"Input"] = &ast.Definition{
+		Kind:   ast.InputObject,
+		Name:   "Upsert" + defn.Name + "Input",
+		Fields: flds,
+	}
+}
+
+// hasUpsertMutation returns true if defn gets an upsertT mutation.  That needs an @id field
+// to find the node by.  A type with @auth doesn't get one, because a node its update rules
+// hide would look like it doesn't exist, and would be added again.
+func hasUpsertMutation(defn *ast.Definition) bool {
+	return hasXID(defn) && defn.Directives.ForName(authDirective) == nil
+}
+
 func addReferenceType(schema *ast.Schema, defn *ast.Definition) {
 	var flds ast.FieldList
 	if defn.Kind == ast.Interface {
@@ -609,6 +900,12 @@ func addUpdateType(schema *ast.Schema, defn *ast.Definition) {
 				Type: &ast.Type{
 					NamedType: defn.Name + "Patch",
 				},
+			},
+			&ast.FieldDefinition{
+				Name: "deepUpdate",
+				Type: &ast.Type{
+					NamedType: "Boolean",
+				},
 			}),
 	}
 	schema.Types["Update"+defn.Name+"Input"] = updType
@@ -664,6 +961,14 @@ func addFieldFilters(schema *ast.Schema, defn *ast.Definition) {
 		// this filter) and for singletons (= only have this value in the result
 		// if it satisfies this filter)
 		addFilterArgument(schema, fld)
+		if typ := schema.Types[fld.Type.Name()]; typ != nil {
+			addIncludeDeletedArgument(fld, typ)
+		}
+
+		// Only fields stored with language tags can be asked for a language.
+		if hasLangDirective(fld) {
+			addLangArgument(fld)
+		}
 
 		// Ordering and pagination, however, only makes sense for fields of
 		// list types (not scalar lists).
@@ -690,7 +995,7 @@ func addFilterArgument(schema *ast.Schema, fld *ast.FieldDefinition) {
 
 func addOrderArgument(schema *ast.Schema, fld *ast.FieldDefinition) {
 	fldType := fld.Type.Name()
-	if hasOrderables(schema.Types[fldType]) {
+	if hasOrderables(schema, schema.Types[fldType]) {
 		fld.Arguments = append(fld.Arguments,
 			&ast.ArgumentDefinition{
 				Name: "order",
@@ -699,6 +1004,17 @@ func addOrderArgument(schema *ast.Schema, fld *ast.FieldDefinition) {
 	}
 }
 
+// addLangArgument adds `lang: [String!]` to a field with @lang.  GraphQL input
+// coercion means both `lang: "en"` and a fallback chain `lang: ["en", "fr"]`
+// are accepted.
+func addLangArgument(fld *ast.FieldDefinition) {
+	fld.Arguments = append(fld.Arguments,
+		&ast.ArgumentDefinition{
+			Name: langArg,
+			Type: &ast.Type{Elem: &ast.Type{NamedType: "String", NonNull: true}},
+		})
+}
+
 func addPaginationArguments(fld *ast.FieldDefinition) {
 	fld.Arguments = append(fld.Arguments,
 		&ast.ArgumentDefinition{Name: "first", Type: &ast.Type{NamedType: "Int"}},
@@ -709,10 +1025,14 @@ func addPaginationArguments(fld *ast.FieldDefinition) {
 // getFilterTypes converts search arguments of a field to graphql filter types.
 func getFilterTypes(schema *ast.Schema, fld *ast.FieldDefinition, filterName string) []string {
 	searchArgs := getSearchArgs(fld)
-	filterNames := make([]string, len(searchArgs))
+	filterNames := make([]string, 0, len(searchArgs))
 
-	for i, search := range searchArgs {
-		filterNames[i] = builtInFilters[search]
+	for _, search := range searchArgs {
+		// Custom tokenizers are indexed in Dgraph, but there's no GraphQL filter for them.
+		name, ok := builtInFilters[search]
+		if !ok {
+			continue
+		}
 
 		if (search == "hash" || search == "exact") && schema.Types[fld.Type.Name()].Kind == ast.Enum {
 			stringFilterName := fmt.Sprintf("String%sFilter", strings.Title(search))
@@ -726,19 +1046,55 @@ func getFilterTypes(schema *ast.Schema, fld *ast.FieldDefinition, filterName str
 					DefaultValue: i.DefaultValue,
 				})
 			}
+			// in: [Fact, Question] matches either of the values.
+			l = append(l, &ast.FieldDefinition{
+				Name: "in",
+				Type: &ast.Type{Elem: &ast.Type{NamedType: fld.Type.Name()}},
+			})
 
-			filterNames[i] = fld.Type.Name() + "_" + search
-			schema.Types[filterNames[i]] = &ast.Definition{
+			name = fld.Type.Name() + "_" + search
+			schema.Types[name] = &ast.Definition{
 				Kind:   ast.InputObject,
-				Name:   filterNames[i],
+				Name:   name,
 				Fields: l,
 			}
 		}
+		filterNames = append(filterNames, name)
+	}
+
+	if hasPresenceSearch(fld) {
+		filterNames = append(filterNames, "PresenceFilter")
 	}
 
 	return filterNames
 }
 
+// hasPresenceSearch returns true if fld has @search(presence: true), asking for filters on
+// whether or not a node has a value for fld.
+func hasPresenceSearch(fld *ast.FieldDefinition) bool {
+	search := fld.Directives.ForName(searchDirective)
+	if search == nil {
+		return false
+	}
+	presence := search.Arguments.ForName(searchPresence)
+	return presence != nil && presence.Value.Raw == "true"
+}
+
+// floatSearchIndex returns the Dgraph index for the float search of fld.  With
+// @search(precision: N) the index is bucketed by 10^-N, so it's one of the float1, float2 and
+// float3 tokenizers, otherwise it's the float index, which is bucketed by 1.
+func floatSearchIndex(fld *ast.FieldDefinition) string {
+	search := fld.Directives.ForName(searchDirective)
+	if search == nil {
+		return "float"
+	}
+	precision := search.Arguments.ForName(searchPrecision)
+	if precision == nil {
+		return "float"
+	}
+	return "float" + precision.Value.Raw
+}
+
 // mergeAndAddFilters merges multiple filterTypes into one and adds it to the schema.
 func mergeAndAddFilters(filterTypes []string, schema *ast.Schema, filterName string) {
 	if len(filterTypes) <= 1 {
@@ -807,29 +1163,119 @@ func addFilterType(schema *ast.Schema, defn *ast.Definition) {
 	}
 
 	// Not filter makes sense even if the filter has only one field. And/Or would only make sense
-	// if the filter has more than one field or if it has one non-id field.
+	// if the filter has more than one field or if it has one non-id field.  A field of the type
+	// that's already called and, or or not keeps its filter, and the logical one isn't added.
 	if (len(filter.Fields) == 1 && !isID(filter.Fields[0])) || len(filter.Fields) > 1 {
-		filter.Fields = append(filter.Fields,
-			&ast.FieldDefinition{Name: "and", Type: &ast.Type{NamedType: filterName}},
-			&ast.FieldDefinition{Name: "or", Type: &ast.Type{NamedType: filterName}},
-		)
+		addFilterField(filter, "and", filterName)
+		addFilterField(filter, "or", filterName)
 	}
+	addFilterField(filter, "not", filterName)
+	schema.Types[filterName] = filter
+}
 
+// addFilterField adds the field name, of type filterName, to filter if it doesn't have it.
+func addFilterField(filter *ast.Definition, name, filterName string) {
+	if filter.Fields.ForName(name) != nil {
+		return
+	}
 	filter.Fields = append(filter.Fields,
-		&ast.FieldDefinition{Name: "not", Type: &ast.Type{NamedType: filterName}})
-	schema.Types[filterName] = filter
+		&ast.FieldDefinition{Name: name, Type: &ast.Type{NamedType: filterName}})
 }
 
 func hasFilterable(defn *ast.Definition) bool {
 	return fieldAny(defn.Fields,
 		func(fld *ast.FieldDefinition) bool {
-			return len(getSearchArgs(fld)) != 0 || isID(fld)
+			return hasFilter(fld) || isID(fld)
 		})
 }
 
-func hasOrderables(defn *ast.Definition) bool {
+// hasFilter returns true if fld has a search that can be used in a GraphQL filter.
+func hasFilter(fld *ast.FieldDefinition) bool {
+	for _, search := range getSearchArgs(fld) {
+		if _, ok := builtInFilters[search]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOrderables(schema *ast.Schema, defn *ast.Definition) bool {
 	return fieldAny(defn.Fields,
-		func(fld *ast.FieldDefinition) bool { return orderable[fld.Type.Name()] })
+		func(fld *ast.FieldDefinition) bool { return isOrderable(schema, fld) })
+}
+
+// isOrderable returns true if results can be ordered by fld.  That's the case for single
+// values of the orderable scalars, and of enums with @search, which Dgraph indexes as strings.
+// Dgraph can't order by lists, and fields resolved by @custom aren't in Dgraph at all.
+// Inherited fields count just like the type's own, ordering by them uses whatever predicate
+// they are stored in.
+func isOrderable(schema *ast.Schema, fld *ast.FieldDefinition) bool {
+	if fld.Type.Elem != nil || hasCustomDirective(fld) || facetName(fld) != "" {
+		return false
+	}
+	if orderable[fld.Type.Name()] {
+		return true
+	}
+	typ := schema.Types[fld.Type.Name()]
+	return typ != nil && typ.Kind == ast.Enum && fld.Directives.ForName(searchDirective) != nil
+}
+
+// facetName returns the Dgraph facet that fld is stored in, given by @dgraph(facet: ...), or ""
+// if fld isn't a facet.
+func facetName(fld *ast.FieldDefinition) string {
+	dir := fld.Directives.ForName(dgraphDirective)
+	if dir == nil {
+		return ""
+	}
+	if arg := dir.Arguments.ForName(dgraphFacetArg); arg != nil {
+		return arg.Value.Raw
+	}
+	return ""
+}
+
+// auditDirective returns the @createdBy, @createdAt or @updatedAt directive of fld, or nil if
+// the server doesn't set fld.
+func auditDirective(fld *ast.FieldDefinition) *ast.Directive {
+	for _, name := range []string{createdByDirective, createdAtDirective, updatedAtDirective} {
+		if dir := fld.Directives.ForName(name); dir != nil {
+			return dir
+		}
+	}
+	return nil
+}
+
+// defaultTypes are the scalar types that a field with @default can be of.  It can also be of an
+// enum type.
+var defaultTypes = map[string]bool{
+	"Int":      true,
+	"Float":    true,
+	"Boolean":  true,
+	"String":   true,
+	"DateTime": true,
+}
+
+// defaultValue returns raw, the value of a @default, as a value of the type typName.  It returns
+// false if raw isn't a value of that type, or if typName can't have a default.
+func defaultValue(sch *ast.Schema, typName, raw string) (interface{}, bool) {
+	switch typName {
+	case "Int":
+		val, err := strconv.ParseInt(raw, 10, 32)
+		return val, err == nil
+	case "Float":
+		val, err := strconv.ParseFloat(raw, 64)
+		return val, err == nil
+	case "Boolean":
+		return raw == "true", raw == "true" || raw == "false"
+	case "String":
+		return raw, true
+	case "DateTime":
+		_, err := dgtypes.ParseTime(raw)
+		return raw, err == nil
+	}
+	if defn := sch.Types[typName]; defn != nil && defn.Kind == ast.Enum {
+		return raw, defn.EnumValues.ForName(raw) != nil
+	}
+	return nil, false
 }
 
 func hasID(defn *ast.Definition) bool {
@@ -890,11 +1336,11 @@ func getSearchArgs(fld *ast.FieldDefinition) []string {
 		// that we apply.
 		return []string{"hash"}
 	}
-	if len(search.Arguments) == 0 ||
-		len(search.Arguments.ForName(searchArgs).Value.Children) == 0 {
+	byArg := search.Arguments.ForName(searchArgs)
+	if byArg == nil || len(byArg.Value.Children) == 0 {
 		return []string{getDefaultSearchIndex(fld.Type.Name())}
 	}
-	val := search.Arguments.ForName(searchArgs).Value
+	val := byArg.Value
 	res := make([]string, len(val.Children))
 
 	for i, child := range val.Children {
@@ -927,7 +1373,7 @@ func getSearchArgs(fld *ast.FieldDefinition) []string {
 // `order: { asc: datePublished, then: { asc: title } }`.
 // a further `then` would be a third ordering, etc.
 func addTypeOrderable(schema *ast.Schema, defn *ast.Definition) {
-	if !hasOrderables(defn) {
+	if !hasOrderables(schema, defn) {
 		return
 	}
 
@@ -950,9 +1396,9 @@ func addTypeOrderable(schema *ast.Schema, defn *ast.Definition) {
 	}
 
 	for _, fld := range defn.Fields {
-		if orderable[fld.Type.Name()] {
+		if isOrderable(schema, fld) {
 			order.EnumValues = append(order.EnumValues,
-				&ast.EnumValueDefinition{Name: fld.Name})
+				&ast.EnumValueDefinition{Name: fld.Name, Directives: deprecatedDirectives(fld)})
 		}
 	}
 
@@ -1022,7 +1468,7 @@ func addDeletePayloadType(schema *ast.Schema, defn *ast.Definition) {
 		Name: "Delete" + defn.Name + "Payload",
 		Fields: []*ast.FieldDefinition{
 			{
-				Name: "msg",
+				Name: Msg,
 				Type: &ast.Type{
 					NamedType: "String",
 				},
@@ -1068,10 +1514,101 @@ func addGetQuery(schema *ast.Schema, defn *ast.Definition) {
 			},
 		})
 	}
+	addIncludeDeletedArgument(qry, defn)
 	schema.Query.Fields = append(schema.Query.Fields, qry)
 	schema.Subscription.Fields = append(schema.Subscription.Fields, qry)
 }
 
+// addGetByFieldQueries adds a getTByField query for each String field of T with a hash index,
+// e.g. getAuthorByName(name: String!): Author, so that such fields can be used as near-unique
+// keys.  The field is then treated just like an XID in the get query.  A query isn't added if
+// its name is in taken, the names of the queries that are already in the schema, like a custom
+// query, the get query of a type AuthorByName or a composite key query.
+func addGetByFieldQueries(schema *ast.Schema, defn *ast.Definition, taken map[string]bool) {
+	for _, fld := range defn.Fields {
+		if hasIDDirective(fld) || compositeKeyName(fld) != "" || fld.Type.Elem != nil ||
+			fld.Type.Name() != "String" {
+			continue
+		}
+
+		hashed := false
+		for _, index := range getSearchArgs(fld) {
+			hashed = hashed || index == "hash"
+		}
+		if !hashed {
+			continue
+		}
+
+		name := "get" + defn.Name + "By" + strings.Title(fld.Name)
+		if taken[name] {
+			continue
+		}
+		taken[name] = true
+
+		qry := &ast.FieldDefinition{
+			Name: name,
+			Type: &ast.Type{
+				NamedType: defn.Name,
+			},
+			Arguments: []*ast.ArgumentDefinition{
+				{
+					Name: fld.Name,
+					Type: &ast.Type{NamedType: "String", NonNull: true},
+				},
+			},
+		}
+		addIncludeDeletedArgument(qry, defn)
+		schema.Query.Fields = append(schema.Query.Fields, qry)
+		schema.Subscription.Fields = append(schema.Subscription.Fields, qry)
+	}
+}
+
+// addCompositeGetQueries adds a get query for each composite key of T, taking all the fields of
+// the key, e.g. getMemberByOrgKey(org: String!, key: String!): Member for the fields org and key
+// with @id(composite: "orgKey").
+func addCompositeGetQueries(schema *ast.Schema, defn *ast.Definition) {
+	keys, names := compositeKeys(defn)
+	for _, name := range names {
+		qry := &ast.FieldDefinition{
+			Name: compositeGetQueryName(defn.Name, name),
+			Type: &ast.Type{
+				NamedType: defn.Name,
+			},
+		}
+		for _, fld := range keys[name] {
+			qry.Arguments = append(qry.Arguments, &ast.ArgumentDefinition{
+				Name: fld.Name,
+				Type: &ast.Type{NamedType: "String", NonNull: true},
+			})
+		}
+		addIncludeDeletedArgument(qry, defn)
+		schema.Query.Fields = append(schema.Query.Fields, qry)
+		schema.Subscription.Fields = append(schema.Subscription.Fields, qry)
+	}
+}
+
+// compositeKeys groups the fields of defn that are part of a composite key by the key name.  It
+// also returns the key names in the order they first appear in defn.
+func compositeKeys(defn *ast.Definition) (map[string]ast.FieldList, []string) {
+	keys := make(map[string]ast.FieldList)
+	var names []string
+	for _, fld := range defn.Fields {
+		name := compositeKeyName(fld)
+		if name == "" {
+			continue
+		}
+		if _, ok := keys[name]; !ok {
+			names = append(names, name)
+		}
+		keys[name] = append(keys[name], fld)
+	}
+	return keys, names
+}
+
+func compositeGetQueryName(typeName, key string) string {
+	return "get" + typeName + "By" + strings.Title(key)
+}
+
 func addFilterQuery(schema *ast.Schema, defn *ast.Definition) {
 	qry := &ast.FieldDefinition{
 		Name: "query" + defn.Name,
@@ -1084,11 +1621,383 @@ func addFilterQuery(schema *ast.Schema, defn *ast.Definition) {
 	addFilterArgument(schema, qry)
 	addOrderArgument(schema, qry)
 	addPaginationArguments(qry)
+	addIncludeDeletedArgument(qry, defn)
 
 	schema.Query.Fields = append(schema.Query.Fields, qry)
 	schema.Subscription.Fields = append(schema.Subscription.Fields, qry)
 }
 
+// addSubscribeQuery adds subscribeT, a subscription to the nodes of type T that match a filter.
+// Rather than all the nodes each time they change, it sends what happened to them:
+//
+// type TSubscriptionEvent {
+//   event: SubscriptionEvent!
+//   changedFields: [String!]!
+//   node: T
+// }
+//
+// The nodes are told apart by their ID, or @id field, so T must have one.
+func addSubscribeQuery(schema *ast.Schema, defn *ast.Definition) {
+	if !hasID(defn) && !hasXID(defn) {
+		return
+	}
+
+	if schema.Types[SubscriptionEventEnum] == nil {
+		schema.Types[SubscriptionEventEnum] = &ast.Definition{
+			Kind: ast.Enum,
+			Name: SubscriptionEventEnum,
+			EnumValues: ast.EnumValueList{
+				{Name: SubscriptionAdd},
+				{Name: SubscriptionUpdate},
+				{Name: SubscriptionDelete},
+			},
+		}
+	}
+
+	eventName := defn.Name + "SubscriptionEvent"
+	schema.Types[eventName] = &ast.Definition{
+		Kind: ast.Object,
+		Name: eventName,
+		Fields: []*ast.FieldDefinition{
+			{
+				Name: SubscriptionEvent,
+				Type: &ast.Type{
+					NamedType: SubscriptionEventEnum,
+					NonNull:   true,
+				},
+			},
+			{
+				Name: SubscriptionChanged,
+				Type: &ast.Type{
+					Elem: &ast.Type{
+						NamedType: "String",
+						NonNull:   true,
+					},
+					NonNull: true,
+				},
+			},
+			{
+				Name: SubscriptionNode,
+				Type: &ast.Type{
+					NamedType: defn.Name,
+				},
+			},
+		},
+	}
+
+	qry := &ast.FieldDefinition{
+		Name: "subscribe" + defn.Name,
+		Type: &ast.Type{
+			Elem: &ast.Type{
+				NamedType: eventName,
+			},
+		},
+	}
+	if hasFilterable(defn) {
+		qry.Arguments = append(qry.Arguments, &ast.ArgumentDefinition{
+			Name: "filter",
+			Type: &ast.Type{NamedType: defn.Name + "Filter"},
+		})
+	}
+
+	schema.Subscription.Fields = append(schema.Subscription.Fields, qry)
+}
+
+// removeSubscriptions removes the Subscription type from sch, along with the types that only
+// its subscribeT fields use.
+func removeSubscriptions(sch *ast.Schema) {
+	if sch.Subscription == nil {
+		return
+	}
+	for _, fld := range sch.Subscription.Fields {
+		if isSubscribeQuery(sch, fld) {
+			delete(sch.Types, fld.Type.Name())
+		}
+	}
+	delete(sch.Types, SubscriptionEventEnum)
+	sch.Subscription = nil
+}
+
+// isSubscribeQuery returns true if fld is a subscribeT field that addSubscribeQuery generated,
+// that's a list of TSubscriptionEvent.  It's told by its definition, not its name, so that a
+// @custom subscription can have any name.
+func isSubscribeQuery(sch *ast.Schema, fld *ast.FieldDefinition) bool {
+	if fld == nil || fld.Type.Elem == nil || fld.Directives.ForName(customDirective) != nil {
+		return false
+	}
+	event := sch.Types[fld.Type.Name()]
+	if event == nil || event.Kind != ast.Object {
+		return false
+	}
+	eventFld := event.Fields.ForName(SubscriptionEvent)
+	return eventFld != nil && eventFld.Type.Name() == SubscriptionEventEnum &&
+		event.Fields.ForName(SubscriptionNode) != nil
+}
+
+// addPageQuery adds a query that returns a page of the results along with the total count of
+// nodes matching the filter, so that paginated UIs can get both in one request.
+func addPageQuery(schema *ast.Schema, defn *ast.Definition) {
+	pageName := defn.Name + pageResultSuffix
+	schema.Types[pageName] = &ast.Definition{
+		Kind: ast.Object,
+		Name: pageName,
+		Fields: []*ast.FieldDefinition{
+			{
+				Name: PageNodes,
+				Type: &ast.Type{
+					Elem: &ast.Type{
+						NamedType: defn.Name,
+					},
+				},
+			},
+			{
+				Name: PageTotalCount,
+				Type: &ast.Type{
+					NamedType: "Int",
+					NonNull:   true,
+				},
+			},
+		},
+	}
+
+	qry := &ast.FieldDefinition{
+		Name: pageQueryPrefix + defn.Name,
+		Type: &ast.Type{
+			NamedType: pageName,
+		},
+	}
+	addFilterArgument(schema, qry)
+	addOrderArgument(schema, qry)
+	addPaginationArguments(qry)
+	addIncludeDeletedArgument(qry, defn)
+
+	schema.Query.Fields = append(schema.Query.Fields, qry)
+}
+
+// pagedType returns the type T that defn, a generated TPageResult type, is a page of, or nil if
+// defn isn't a page type.
+func pagedType(schema *ast.Schema, defn *ast.Definition) *ast.Definition {
+	if defn == nil || defn.Kind != ast.Object || len(defn.Fields) != 2 ||
+		defn.Fields[0].Name != PageNodes || defn.Fields[0].Type.Elem == nil ||
+		defn.Fields[1].Name != PageTotalCount {
+		return nil
+	}
+	typ := schema.Types[defn.Fields[0].Type.Name()]
+	if typ == nil || typ.Name+pageResultSuffix != defn.Name {
+		return nil
+	}
+	return typ
+}
+
+// isPageQuery returns true if fld is a generated pageT query, which returns a TPageResult.
+func isPageQuery(sch *ast.Schema, fld *ast.FieldDefinition) bool {
+	return fld != nil && fld.Type.Elem == nil && fld.Directives.ForName(customDirective) == nil &&
+		pagedType(sch, sch.Types[fld.Type.Name()]) != nil
+}
+
+// addAggregateFields adds a field fAggregate right after each field f of defn that's a list of
+// nodes stored in Dgraph, so that the nodes can be counted, and their values aggregated, along
+// with or instead of being listed.  For posts: [Post] that's
+//
+// postsAggregate(filter: PostFilter): PostAggregateResult
+//
+// The filter of fAggregate is separate from the filter of f, so that one can be aggregated over
+// some of the nodes while the other lists others.
+func addAggregateFields(schema *ast.Schema, defn *ast.Definition) {
+	fields := make(ast.FieldList, 0, len(defn.Fields))
+	for _, fld := range defn.Fields {
+		fields = append(fields, fld)
+
+		typ := schema.Types[fld.Type.Name()]
+		name := fld.Name + aggregateFieldSuffix
+		if fld.Type.Elem == nil || typ == nil ||
+			(typ.Kind != ast.Object && typ.Kind != ast.Interface) ||
+			typ.Directives.ForName(remoteDirective) != nil || hasCustomDirective(fld) ||
+			defn.Fields.ForName(name) != nil {
+			continue
+		}
+
+		resultType := addAggregateResultType(schema, typ)
+		if resultType == "" {
+			continue
+		}
+		agg := &ast.FieldDefinition{
+			Name:       name,
+			Type:       &ast.Type{NamedType: resultType},
+			Directives: ast.DirectiveList{{Name: generatedDirective}},
+		}
+		addFilterArgument(schema, agg)
+		addIncludeDeletedArgument(agg, typ)
+		fields = append(fields, agg)
+	}
+	defn.Fields = fields
+}
+
+// addAggregateResultType adds TAggregateResult, for aggregating nodes of type defn, if it isn't
+// there already, and returns its name.  Along with the count of the nodes, it has the least and
+// greatest value of each field of defn that can be ordered by, and the sum and average of the
+// Int and Float ones.  It returns "" if the input has a type of that name.
+func addAggregateResultType(schema *ast.Schema, defn *ast.Definition) string {
+	name := defn.Name + aggregateResultSuffix
+	if existing := schema.Types[name]; existing != nil {
+		if !hasGeneratedDirective(existing.Directives) {
+			return ""
+		}
+		return name
+	}
+
+	res := &ast.Definition{
+		Kind:       ast.Object,
+		Name:       name,
+		Directives: ast.DirectiveList{{Name: generatedDirective}},
+		Fields:     ast.FieldList{{Name: AggregateCount, Type: &ast.Type{NamedType: "Int"}}},
+	}
+	for _, fld := range defn.Fields {
+		typName := fld.Type.Name()
+		if fld.Type.Elem != nil || hasCustomDirective(fld) || facetName(fld) != "" ||
+			!orderable[typName] {
+			continue
+		}
+		numeric := typName == "Int" || typName == "Float"
+		for _, agg := range aggregateFuncs {
+			if agg.numeric && !numeric {
+				continue
+			}
+			typ := &ast.Type{NamedType: typName}
+			if agg.fn == "avg" {
+				typ.NamedType = "Float"
+			}
+			res.Fields = append(res.Fields, &ast.FieldDefinition{
+				Name: fld.Name + agg.suffix,
+				Type: typ,
+			})
+		}
+	}
+	schema.Types[name] = res
+	return name
+}
+
+// aggregatedField returns the list field of defn that fld, a generated fAggregate field,
+// aggregates, or nil if fld isn't an aggregate field.
+func aggregatedField(defn *ast.Definition, fld *ast.FieldDefinition) *ast.FieldDefinition {
+	if defn == nil || fld == nil || !hasGeneratedDirective(fld.Directives) {
+		return nil
+	}
+	list := defn.Fields.ForName(strings.TrimSuffix(fld.Name, aggregateFieldSuffix))
+	if list == nil || list.Type.Elem == nil {
+		return nil
+	}
+	return list
+}
+
+// hasGeneratedDirective returns true if dirs are those of a generated type or field.
+func hasGeneratedDirective(dirs ast.DirectiveList) bool {
+	return dirs.ForName(generatedDirective) != nil
+}
+
+// AggregateOf returns the field of T, and the Dgraph aggregation function, that name, a field
+// of the generated TAggregateResult, is computed with, e.g. "score" and "avg" for scoreAvg.  It
+// returns "" and "count" for the count of the nodes, and "" and "" if name isn't an aggregate.
+func AggregateOf(name string) (string, string) {
+	if name == AggregateCount {
+		return "", "count"
+	}
+	for _, agg := range aggregateFuncs {
+		if fld := strings.TrimSuffix(name, agg.suffix); fld != name && fld != "" {
+			return fld, agg.fn
+		}
+	}
+	return "", ""
+}
+
+// addGroupQueries adds a query that groups the nodes of defn by the value of a field, for each
+// indexed scalar field that they can be grouped by.  For reputation: Float @search that's
+//
+// groupAuthorByReputation(filter: AuthorFilter): [AuthorReputationGroup]
+//
+// type AuthorReputationGroup {
+//   reputation: Float
+//   count: Int
+// }
+//
+// with a group for each reputation that the nodes matching the filter have.
+func addGroupQueries(schema *ast.Schema, defn *ast.Definition) {
+	for _, fld := range defn.Fields {
+		if !groupable(schema, fld) {
+			continue
+		}
+		resName := defn.Name + strings.Title(fld.Name) + groupResultSuffix
+		if schema.Types[resName] != nil {
+			// The name is taken by a type in the input schema.
+			continue
+		}
+		schema.Types[resName] = &ast.Definition{
+			Kind:       ast.Object,
+			Name:       resName,
+			Directives: ast.DirectiveList{{Name: generatedDirective}},
+			Fields: ast.FieldList{
+				{Name: fld.Name, Type: &ast.Type{NamedType: fld.Type.Name()}},
+				{Name: AggregateCount, Type: &ast.Type{NamedType: "Int"}},
+			},
+		}
+
+		qry := &ast.FieldDefinition{
+			Name: groupQueryPrefix + defn.Name + "By" + strings.Title(fld.Name),
+			Type: &ast.Type{Elem: &ast.Type{NamedType: resName}},
+		}
+		if hasFilterable(defn) {
+			qry.Arguments = append(qry.Arguments, &ast.ArgumentDefinition{
+				Name: "filter",
+				Type: &ast.Type{NamedType: defn.Name + "Filter"},
+			})
+		}
+		addIncludeDeletedArgument(qry, defn)
+		schema.Query.Fields = append(schema.Query.Fields, qry)
+	}
+}
+
+// isGroupQuery returns true if fld is a generated groupTByF query, which returns a list of the
+// generated TFGroup type.
+func isGroupQuery(sch *ast.Schema, fld *ast.FieldDefinition) bool {
+	if fld == nil || fld.Type.Elem == nil || fld.Directives.ForName(customDirective) != nil {
+		return false
+	}
+	typ, _ := groupedField(sch, sch.Types[fld.Type.Name()])
+	return typ != nil
+}
+
+// groupable returns true if nodes can be grouped by the values of fld.  That's if it's an
+// indexed scalar or enum field with a single value.  An @id field isn't, because no two nodes
+// have the same value of it, and neither is a @lang field, which has a value for each language.
+func groupable(schema *ast.Schema, fld *ast.FieldDefinition) bool {
+	typ := schema.Types[fld.Type.Name()]
+	return typ != nil && (typ.Kind == ast.Scalar || typ.Kind == ast.Enum) && !isID(fld) &&
+		fld.Type.Elem == nil && fld.Directives.ForName(searchDirective) != nil &&
+		!hasIDDirective(fld) && !hasLangDirective(fld) && !hasCustomDirective(fld) &&
+		facetName(fld) == "" && fld.Name != AggregateCount
+}
+
+// groupedField returns the type T, and its field f, that defn, a generated TFGroup type, is
+// for, or nil if defn isn't a group type.
+func groupedField(schema *ast.Schema, defn *ast.Definition) (*ast.Definition,
+	*ast.FieldDefinition) {
+
+	if defn == nil || !hasGeneratedDirective(defn.Directives) || defn.Kind != ast.Object ||
+		len(defn.Fields) != 2 || defn.Fields[1].Name != AggregateCount {
+		return nil, nil
+	}
+	name := defn.Fields[0].Name
+	typ := schema.Types[strings.TrimSuffix(defn.Name, strings.Title(name)+groupResultSuffix)]
+	if typ == nil || typ.Name == defn.Name {
+		return nil, nil
+	}
+	fld := typ.Fields.ForName(name)
+	if fld == nil || !groupable(schema, fld) {
+		return nil, nil
+	}
+	return typ, fld
+}
+
 func addPasswordQuery(schema *ast.Schema, defn *ast.Definition) {
 	hasIDField := hasID(defn)
 	hasXIDField := hasXID(defn)
@@ -1130,8 +2039,12 @@ func addPasswordQuery(schema *ast.Schema, defn *ast.Definition) {
 
 func addQueries(schema *ast.Schema, defn *ast.Definition) {
 	addGetQuery(schema, defn)
+	addCompositeGetQueries(schema, defn)
 	addPasswordQuery(schema, defn)
 	addFilterQuery(schema, defn)
+	addSubscribeQuery(schema, defn)
+	addPageQuery(schema, defn)
+	addGroupQueries(schema, defn)
 }
 
 func addAddMutation(schema *ast.Schema, defn *ast.Definition) {
@@ -1150,9 +2063,36 @@ func addAddMutation(schema *ast.Schema, defn *ast.Definition) {
 			},
 		},
 	}
+	addAllowExpiredArgument(schema, add, defn)
 	schema.Mutation.Fields = append(schema.Mutation.Fields, add)
 }
 
+// addUpsertMutation adds upsertT, which adds each input node whose @id value isn't in use yet,
+// and updates the node that has it otherwise.
+func addUpsertMutation(schema *ast.Schema, defn *ast.Definition) {
+	if !hasUpsertMutation(defn) {
+		return
+	}
+
+	upsert := &ast.FieldDefinition{
+		Name: "upsert" + defn.Name,
+		Type: &ast.Type{
+			NamedType: "Add" + defn.Name + "Payload",
+		},
+		Arguments: []*ast.ArgumentDefinition{
+			{
+				Name: "input",
+				Type: &ast.Type{
+					NamedType: "[Upsert" + defn.Name + "Input!]",
+					NonNull:   true,
+				},
+			},
+		},
+	}
+	addAllowExpiredArgument(schema, upsert, defn)
+	schema.Mutation.Fields = append(schema.Mutation.Fields, upsert)
+}
+
 func addUpdateMutation(schema *ast.Schema, defn *ast.Definition) {
 	if !hasFilterable(defn) {
 		return
@@ -1177,9 +2117,70 @@ func addUpdateMutation(schema *ast.Schema, defn *ast.Definition) {
 			},
 		},
 	}
+	addAllowExpiredArgument(schema, upd, defn)
 	schema.Mutation.Fields = append(schema.Mutation.Fields, upd)
 }
 
+// addAllowExpiredArgument lets a mutation of a type with @ttl, or of a type whose input can nest
+// new nodes of one, set the TTL field to a time that has already passed, which is refused
+// otherwise.
+func addAllowExpiredArgument(schema *ast.Schema, fld *ast.FieldDefinition, defn *ast.Definition) {
+	if !nestsTTLType(schema, defn, make(map[string]bool)) {
+		return
+	}
+	fld.Arguments = append(fld.Arguments, &ast.ArgumentDefinition{
+		Name: allowExpiredArg,
+		Type: &ast.Type{NamedType: "Boolean"},
+	})
+}
+
+// nestsTTLType returns true if defn, or a type that the input of a mutation of defn can nest
+// new nodes of, has @ttl.
+func nestsTTLType(schema *ast.Schema, defn *ast.Definition, seen map[string]bool) bool {
+	if defn == nil || seen[defn.Name] || defn.Directives.ForName(remoteDirective) != nil {
+		return false
+	}
+	seen[defn.Name] = true
+	if defn.Directives.ForName(ttlDirective) != nil {
+		return true
+	}
+
+	for _, fld := range defn.Fields {
+		if hasCustomDirective(fld) {
+			continue
+		}
+		typ := schema.Types[fld.Type.Name()]
+		if typ == nil {
+			continue
+		}
+		switch typ.Kind {
+		case ast.Object, ast.Interface:
+			if nestsTTLType(schema, typ, seen) {
+				return true
+			}
+		case ast.Union:
+			for _, member := range typ.Types {
+				if nestsTTLType(schema, schema.Types[member], seen) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// addIncludeDeletedArgument lets a query of a type with @softDelete find the nodes that have
+// been soft deleted, which are left out otherwise.
+func addIncludeDeletedArgument(fld *ast.FieldDefinition, defn *ast.Definition) {
+	if defn.Directives.ForName(softDeleteDirective) == nil {
+		return
+	}
+	fld.Arguments = append(fld.Arguments, &ast.ArgumentDefinition{
+		Name: includeDeletedArg,
+		Type: &ast.Type{NamedType: "Boolean"},
+	})
+}
+
 func addDeleteMutation(schema *ast.Schema, defn *ast.Definition) {
 	if !hasFilterable(defn) {
 		return
@@ -1195,6 +2196,11 @@ func addDeleteMutation(schema *ast.Schema, defn *ast.Definition) {
 				Name: "filter",
 				Type: &ast.Type{NamedType: defn.Name + "Filter", NonNull: true},
 			},
+			{
+				// A filter that matches every node is refused, unless allowAll is true.
+				Name: "allowAll",
+				Type: &ast.Type{NamedType: "Boolean"},
+			},
 		},
 	}
 	schema.Mutation.Fields = append(schema.Mutation.Fields, del)
@@ -1202,6 +2208,7 @@ func addDeleteMutation(schema *ast.Schema, defn *ast.Definition) {
 
 func addMutations(schema *ast.Schema, defn *ast.Definition) {
 	addAddMutation(schema, defn)
+	addUpsertMutation(schema, defn)
 	addUpdateMutation(schema, defn)
 	addDeleteMutation(schema, defn)
 }
@@ -1230,15 +2237,38 @@ func createField(schema *ast.Schema, fld *ast.FieldDefinition) *ast.FieldDefinit
 	newFld := *fld
 	newFldType := *fld.Type
 	newFld.Type = &newFldType
+	if hasLangDirective(fld) {
+		// Values of a @lang field are given as (value, lang) pairs, so one mutation can
+		// set several languages at once.
+		newFld.Type = &ast.Type{
+			Elem:    &ast.Type{NamedType: langValueType, NonNull: true},
+			NonNull: fld.Type.NonNull,
+		}
+	}
+	if fld.Directives.ForName(defaultDirective) != nil {
+		// A node that's added without a value for the field gets the default.
+		newFld.Type.NonNull = false
+	}
 	newFld.Directives = nil
 	newFld.Arguments = nil
 	return &newFld
 }
 
+// deprecatedDirectives returns the @deprecated directive of fld, if it has one, so that the
+// enum value generated from fld in the orderings of its type is deprecated too.  The input
+// fields generated from fld aren't, because @deprecated isn't allowed on input fields.
+func deprecatedDirectives(fld *ast.FieldDefinition) ast.DirectiveList {
+	if dir := fld.Directives.ForName(deprecatedDirective); dir != nil {
+		return ast.DirectiveList{dir}
+	}
+	return nil
+}
+
 func getNonIDFields(schema *ast.Schema, defn *ast.Definition) ast.FieldList {
 	fldList := make([]*ast.FieldDefinition, 0)
 	for _, fld := range defn.Fields {
-		if isIDField(defn, fld) || hasIDDirective(fld) {
+		// Like an XID, a field of a composite key identifies the node, so it isn't updated.
+		if isIDField(defn, fld) || hasIDDirective(fld) || compositeKeyName(fld) != "" {
 			continue
 		}
 
@@ -1247,6 +2277,16 @@ func getNonIDFields(schema *ast.Schema, defn *ast.Definition) ast.FieldList {
 		if custom != nil {
 			continue
 		}
+		// A facet is stored on the edge to the node, not on the node, so it can't be set with
+		// the node.
+		if facetName(fld) != "" {
+			continue
+		}
+		// An audit field is set by the server when the node is added or updated, so clients
+		// can't forge it.
+		if auditDirective(fld) != nil {
+			continue
+		}
 
 		// Remove edges which have a reverse predicate as they should only be updated through their
 		// forward edge.
@@ -1266,6 +2306,12 @@ func getNonIDFields(schema *ast.Schema, defn *ast.Definition) ast.FieldList {
 			continue
 		}
 
+		// A union could be any of its member types, so there's no way to know which type of
+		// object to create or link to.  Union edges can't be set by mutations.
+		if schema.Types[fld.Type.Name()].Kind == ast.Union {
+			continue
+		}
+
 		fldList = append(fldList, createField(schema, fld))
 	}
 
@@ -1288,12 +2334,25 @@ func getFieldsWithoutIDType(schema *ast.Schema, defn *ast.Definition) ast.FieldL
 		if custom != nil {
 			continue
 		}
+		// A facet is stored on the edge to the node, not on the node, so it can't be set with
+		// the node.
+		if facetName(fld) != "" {
+			continue
+		}
+		// An audit field is set by the server when the node is added or updated, so clients
+		// can't forge it.
+		if auditDirective(fld) != nil {
+			continue
+		}
 
 		// see also comment in getNonIDFields
 		if schema.Types[fld.Type.Name()].Kind == ast.Interface &&
 			(!hasID(schema.Types[fld.Type.Name()]) && !hasXID(schema.Types[fld.Type.Name()])) {
 			continue
 		}
+		if schema.Types[fld.Type.Name()].Kind == ast.Union {
+			continue
+		}
 
 		fldList = append(fldList, createField(schema, fld))
 	}
@@ -1435,14 +2494,15 @@ func generateInputString(typ *ast.Definition) string {
 func generateEnumString(typ *ast.Definition) string {
 	var sch strings.Builder
 
-	x.Check2(sch.WriteString(fmt.Sprintf("%senum %s {\n", generateDescription(typ.Description),
-		typ.Name)))
+	x.Check2(sch.WriteString(fmt.Sprintf("%senum %s%s {\n", generateDescription(typ.Description),
+		typ.Name, genDirectivesString(typ.Directives))))
 	for _, val := range typ.EnumValues {
 		if !strings.HasPrefix(val.Name, "__") {
 			if d := generateDescription(val.Description); d != "" {
 				x.Check2(sch.WriteString(fmt.Sprintf("\t%s", d)))
 			}
-			x.Check2(sch.WriteString(fmt.Sprintf("\t%s\n", val.Name)))
+			x.Check2(sch.WriteString(fmt.Sprintf("\t%s%s\n", val.Name,
+				genDirectivesString(val.Directives))))
 		}
 	}
 	x.Check2(sch.WriteString("}\n"))
@@ -1464,6 +2524,12 @@ func generateInterfaceString(typ *ast.Definition) string {
 		genFieldsString(typ.Fields))
 }
 
+func generateUnionString(typ *ast.Definition) string {
+	return fmt.Sprintf("%sunion %s%s = %s\n",
+		generateDescription(typ.Description), typ.Name, genDirectivesString(typ.Directives),
+		strings.Join(typ.Types, " | "))
+}
+
 func generateObjectString(typ *ast.Definition) string {
 	if len(typ.Interfaces) > 0 {
 		interfaces := strings.Join(typ.Interfaces, " & ")
@@ -1509,6 +2575,8 @@ func Stringify(schema *ast.Schema, originalTypes []string) string {
 			x.Check2(original.WriteString(generateEnumString(typ) + "\n"))
 		case ast.InputObject:
 			x.Check2(original.WriteString(generateInputString(typ) + "\n"))
+		case ast.Union:
+			x.Check2(original.WriteString(generateUnionString(typ) + "\n"))
 		}
 		printed[typName] = true
 	}
@@ -1545,10 +2613,12 @@ func Stringify(schema *ast.Schema, originalTypes []string) string {
 	sort.Strings(typeNames)
 
 	// Now consider the types generated by completeSchema, which can only be
-	// types, inputs and enums
+	// types, inputs and enums, and Relay's Node interface
 	for _, typName := range typeNames {
 		typ := schema.Types[typName]
 		switch typ.Kind {
+		case ast.Interface:
+			x.Check2(object.WriteString(generateInterfaceString(typ) + "\n"))
 		case ast.Object:
 			x.Check2(object.WriteString(generateObjectString(typ) + "\n"))
 		case ast.InputObject:
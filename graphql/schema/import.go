@@ -0,0 +1,295 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+const importComment = "# Dgraph.Import"
+
+// A schemaImport asks for types of the remote GraphQL API at URL to be added to the schema
+// as @remote types, so @custom fields can return them without the schema having to copy
+// their definitions.  It's given in a schema as
+//
+// # Dgraph.Import {"url": "https://partner/api", "types": ["Movie", "Director"]}
+type schemaImport struct {
+	URL   string   `json:"url"`
+	Types []string `json:"types"`
+}
+
+// parseImports finds the imports given by importComment in sch.
+func parseImports(sch string) ([]*schemaImport, error) {
+	var imports []*schemaImport
+	for _, cl := range dgraphCommentLines(sch, importComment) {
+		text := cl.text
+		imp := &schemaImport{}
+		err := json.Unmarshal([]byte(strings.TrimPrefix(text, importComment)), imp)
+		if err != nil || imp.URL == "" || len(imp.Types) == 0 {
+			return nil, errors.Errorf("incorrect format for specifying Dgraph import found for "+
+				"comment: `%s`, it should be `%s {\"url\": \"https://...\", "+
+				"\"types\": [\"TypeName\", ...]}`", text, importComment)
+		}
+		if err := validateUrl(imp.URL); err != nil {
+			return nil, errors.Wrapf(err, "invalid url in comment: `%s`", text)
+		}
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+// importRemoteTypes introspects the remote API of each import and adds the imported types to
+// doc as @remote types, along with the input types, enums and interfaces they depend on.
+// Nothing is cached, so applying a schema again fetches the types again.
+//
+// A type that doc already declares isn't imported.  That's only allowed if the declaration
+// matches the remote type; otherwise it's an error showing how the two differ.
+func importRemoteTypes(doc *ast.SchemaDocument, imports []*schemaImport) gqlerror.List {
+	var errs gqlerror.List
+	for _, imp := range imports {
+		remoteSchema, err := introspectRemote(imp.URL, nil)
+		if err != nil {
+			errs = append(errs, gqlerror.Errorf("couldn't import types from %s: %s", imp.URL, err))
+			continue
+		}
+
+		remoteTypes := make(map[string]*types)
+		for _, typ := range remoteSchema.Data.Schema.Types {
+			remoteTypes[typ.Name] = typ
+		}
+
+		toImport, impErrs := importedTypes(imp, remoteTypes)
+		errs = append(errs, impErrs...)
+
+		var sdl strings.Builder
+		for _, typ := range toImport {
+			if local := localDefinition(doc, typ.Name); local != nil {
+				if diff := diffRemoteType(local, typ, remoteTypes); diff != "" {
+					errs = append(errs, gqlerror.ErrorPosf(local.Position,
+						"Type %s is imported from %s, but the schema also declares it "+
+							"differently:\n%s", typ.Name, imp.URL, diff))
+				}
+				continue
+			}
+			writeRemoteType(&sdl, typ, remoteTypes)
+		}
+		if len(errs) > 0 || sdl.Len() == 0 {
+			continue
+		}
+
+		imported, gqlErr := parser.ParseSchema(&ast.Source{Name: imp.URL, Input: sdl.String()})
+		if gqlErr != nil {
+			errs = append(errs, gqlErr)
+			continue
+		}
+		doc.Definitions = append(doc.Definitions, imported.Definitions...)
+	}
+	return errs
+}
+
+// importedTypes returns the types imp asks for, followed by every type they depend on, in the
+// order they are found.  Dgraph's own scalars are left out because every schema has them.
+func importedTypes(imp *schemaImport, remoteTypes map[string]*types) ([]*types, gqlerror.List) {
+	var errs gqlerror.List
+	var found []*types
+	seen := make(map[string]bool)
+	queue := append([]string{}, imp.Types...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		typ, ok := remoteTypes[name]
+		if !ok {
+			errs = append(errs, gqlerror.Errorf("couldn't import type %s from %s, the remote "+
+				"schema doesn't have it", name, imp.URL))
+			continue
+		}
+
+		switch typ.Kind {
+		case string(ast.Scalar):
+			if _, ok := scalarToDgraph[name]; !ok {
+				errs = append(errs, gqlerror.Errorf("couldn't import type %s from %s, "+
+					"custom scalars aren't supported", name, imp.URL))
+			}
+			continue
+		case string(ast.Union):
+			errs = append(errs, gqlerror.Errorf("couldn't import type %s from %s, "+
+				"unions aren't supported", name, imp.URL))
+			continue
+		}
+
+		found = append(found, typ)
+		for _, intf := range typ.Interfaces {
+			queue = append(queue, intf.NamedType())
+		}
+		for _, fld := range typ.Fields {
+			queue = append(queue, fld.Type.NamedType())
+			for _, arg := range fld.Args {
+				queue = append(queue, arg.Type.NamedType())
+			}
+		}
+		for _, fld := range typ.InputFields {
+			queue = append(queue, fld.Type.NamedType())
+		}
+	}
+	return found, errs
+}
+
+// localDefinition returns the definition of name in doc that isn't built in, if there is one.
+func localDefinition(doc *ast.SchemaDocument, name string) *ast.Definition {
+	for _, defn := range doc.Definitions {
+		if !defn.BuiltIn && defn.Name == name {
+			return defn
+		}
+	}
+	return nil
+}
+
+// writeRemoteType writes typ to sdl as a schema definition.  Objects leave out the fields
+// they get from their interfaces, because expandSchema adds those back in.  Default values
+// aren't kept, the remote API applies its own defaults to whatever isn't sent to it.
+func writeRemoteType(sdl *strings.Builder, typ *types, remoteTypes map[string]*types) {
+	switch typ.Kind {
+	case string(ast.Enum):
+		fmt.Fprintf(sdl, "enum %s {\n", typ.Name)
+		for _, val := range typ.EnumValues {
+			fmt.Fprintf(sdl, "\t%s\n", val.Name)
+		}
+		sdl.WriteString("}\n")
+		return
+	case string(ast.InputObject):
+		fmt.Fprintf(sdl, "input %s {\n", typ.Name)
+		for _, fld := range typ.InputFields {
+			fmt.Fprintf(sdl, "\t%s: %s\n", fld.Name, fld.Type.String())
+		}
+		sdl.WriteString("}\n")
+		return
+	}
+
+	if typ.Kind == string(ast.Interface) {
+		fmt.Fprintf(sdl, "interface %s", typ.Name)
+	} else {
+		fmt.Fprintf(sdl, "type %s", typ.Name)
+		if len(typ.Interfaces) > 0 {
+			names := make([]string, 0, len(typ.Interfaces))
+			for _, intf := range typ.Interfaces {
+				names = append(names, intf.NamedType())
+			}
+			fmt.Fprintf(sdl, " implements %s", strings.Join(names, " & "))
+		}
+	}
+	sdl.WriteString(" @remote")
+
+	inherited := inheritedFields(typ, remoteTypes)
+	var fields strings.Builder
+	for _, fld := range typ.Fields {
+		if inherited[fld.Name] {
+			continue
+		}
+		fields.WriteString("\t" + fld.Name)
+		if len(fld.Args) > 0 {
+			args := make([]string, 0, len(fld.Args))
+			for _, arg := range fld.Args {
+				args = append(args, arg.Name+": "+arg.Type.String())
+			}
+			fmt.Fprintf(&fields, "(%s)", strings.Join(args, ", "))
+		}
+		fmt.Fprintf(&fields, ": %s\n", fld.Type.String())
+	}
+	if fields.Len() > 0 {
+		sdl.WriteString(" {\n" + fields.String() + "}")
+	}
+	sdl.WriteString("\n")
+}
+
+// inheritedFields returns the names of the fields typ gets from its interfaces.  There's no
+// way to tell from an introspection which fields came from an interface, so any field with
+// the same name as a field of one of the interfaces counts.
+func inheritedFields(typ *types, remoteTypes map[string]*types) map[string]bool {
+	inherited := make(map[string]bool)
+	for _, intf := range typ.Interfaces {
+		if remoteIntf, ok := remoteTypes[intf.NamedType()]; ok {
+			for _, fld := range remoteIntf.Fields {
+				inherited[fld.Name] = true
+			}
+		}
+	}
+	return inherited
+}
+
+// diffRemoteType returns how the local definition of a type differs from the remote typ, one
+// line per difference: lines starting with - are only in local, and lines starting with +
+// are only in typ.  It returns "" if they are the same.
+func diffRemoteType(local *ast.Definition, typ *types, remoteTypes map[string]*types) string {
+	localLines := []string{"kind " + string(local.Kind)}
+	for _, fld := range local.Fields {
+		localLines = append(localLines, fld.Name+": "+fld.Type.String())
+	}
+	for _, val := range local.EnumValues {
+		localLines = append(localLines, val.Name)
+	}
+
+	// Like the imported type, the local one gets its interface fields added later.
+	inherited := inheritedFields(typ, remoteTypes)
+	remoteLines := []string{"kind " + typ.Kind}
+	for _, fld := range typ.Fields {
+		if !inherited[fld.Name] {
+			remoteLines = append(remoteLines, fld.Name+": "+fld.Type.String())
+		}
+	}
+	for _, fld := range typ.InputFields {
+		remoteLines = append(remoteLines, fld.Name+": "+fld.Type.String())
+	}
+	for _, val := range typ.EnumValues {
+		remoteLines = append(remoteLines, val.Name)
+	}
+
+	inLocal := make(map[string]bool, len(localLines))
+	for _, l := range localLines {
+		inLocal[l] = true
+	}
+	inRemote := make(map[string]bool, len(remoteLines))
+	for _, l := range remoteLines {
+		inRemote[l] = true
+	}
+
+	var diff []string
+	for _, l := range localLines {
+		if !inRemote[l] {
+			diff = append(diff, "- "+l)
+		}
+	}
+	for _, l := range remoteLines {
+		if !inLocal[l] {
+			diff = append(diff, "+ "+l)
+		}
+	}
+	sort.SliceStable(diff, func(i, j int) bool { return diff[i][2:] < diff[j][2:] })
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,422 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// A MigrationPlan is what it takes to move from serving one GraphQL schema to another without
+// losing the data stored through the old one.  Renaming a type or field changes the Dgraph type
+// or predicate it's stored in, so the data stored under the old name would no longer be read.
+type MigrationPlan struct {
+	// Suggestions are the @dgraph annotations that keep the types and fields of the new schema
+	// stored where the old schema stored them.
+	Suggestions []MigrationSuggestion `json:"suggestions"`
+	// DataMigrations are the changes that no annotation can avoid, so the data in their
+	// predicates has to be migrated.
+	DataMigrations []DataMigration `json:"dataMigrations"`
+	// Ambiguities are the changes that look like renames, but that could be matched up in more
+	// than one way.  They are reported rather than guessed at.
+	Ambiguities []string `json:"ambiguities"`
+}
+
+// A MigrationSuggestion is an annotation to add to a type, or a field of it, in the new schema.
+type MigrationSuggestion struct {
+	Type       string `json:"type"`
+	Field      string `json:"field,omitempty"`
+	Annotation string `json:"annotation"`
+	Reason     string `json:"reason"`
+}
+
+// A DataMigration is a change that leaves the data in predicates as it is, but not as the new
+// schema expects it.
+type DataMigration struct {
+	Predicates []string `json:"predicates"`
+	Reason     string   `json:"reason"`
+}
+
+// A storedType is a type of a schema that's stored in Dgraph, with the fields that are.
+type storedType struct {
+	name       string
+	dgraphName string
+	fields     []*storedField
+}
+
+// A storedField is a field that's stored in the Dgraph predicate pred.  typ is the field's type
+// as it's stored, so without it being non-null.
+type storedField struct {
+	name string
+	typ  string
+	pred string
+	// scalar is set if the field's type isn't an object type.
+	scalar bool
+	// inherited is set if the field is declared in an interface that its type implements, so
+	// the interface decides its predicate.
+	inherited bool
+}
+
+// PlanMigration compares oldSchema and newSchema, two input schemas like NewHandler takes, and
+// returns what it takes to serve newSchema over the data stored through oldSchema.  A type or
+// field that's in oldSchema, but not newSchema, was renamed if there's exactly one type or
+// field added in newSchema that matches it, and it matches no other.  It's only an analysis,
+// nothing is changed.
+func PlanMigration(ctx context.Context, oldSchema, newSchema string) (*MigrationPlan, error) {
+	oldTypes, err := storedTypes(ctx, oldSchema)
+	if err != nil {
+		return nil, errors.Wrap(err, "while processing the old schema")
+	}
+	newTypes, err := storedTypes(ctx, newSchema)
+	if err != nil {
+		return nil, errors.Wrap(err, "while processing the new schema")
+	}
+
+	plan := &MigrationPlan{
+		Suggestions:    make([]MigrationSuggestion, 0),
+		DataMigrations: make([]DataMigration, 0),
+		Ambiguities:    make([]string, 0),
+	}
+
+	// Types are matched by name, and then the ones left over by the shapes of their fields.
+	newByName := make(map[string]*storedType, len(newTypes))
+	for _, typ := range newTypes {
+		newByName[typ.name] = typ
+	}
+	oldByName := make(map[string]*storedType, len(oldTypes))
+	for _, typ := range oldTypes {
+		oldByName[typ.name] = typ
+	}
+	var removed, added []*storedType
+	for _, typ := range oldTypes {
+		if newByName[typ.name] == nil {
+			removed = append(removed, typ)
+		}
+	}
+	for _, typ := range newTypes {
+		if oldByName[typ.name] == nil {
+			added = append(added, typ)
+		}
+	}
+
+	renamed := make(map[string]string)
+	renames, ambiguous := matchRenames(len(removed), len(added),
+		func(i, j int) bool { return typeShape(removed[i]) == typeShape(added[j]) })
+	for i, j := range renames {
+		renamed[removed[i].name] = added[j].name
+	}
+	for i := range removed {
+		candidates, ok := ambiguous[i]
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(candidates))
+		for _, j := range candidates {
+			names = append(names, added[j].name)
+		}
+		plan.Ambiguities = append(plan.Ambiguities, fmt.Sprintf("Type %s was removed, and "+
+			"types %s were added with fields of the same types, so it could have been renamed "+
+			"to any of them. Add @dgraph(type: %q) to the one that it is.", removed[i].name,
+			strings.Join(names, ", "), removed[i].dgraphName))
+	}
+
+	// The predicates that the new schema still stores something in.
+	newPreds := make(map[string]bool)
+	for _, typ := range newTypes {
+		for _, fld := range typ.fields {
+			newPreds[fld.pred] = true
+		}
+	}
+	orphaned := func(preds []string) []string {
+		var res []string
+		for _, pred := range preds {
+			if !newPreds[pred] {
+				res = append(res, pred)
+			}
+		}
+		return res
+	}
+
+	for _, oldTyp := range oldTypes {
+		newName, ok := renamed[oldTyp.name]
+		if !ok && newByName[oldTyp.name] != nil {
+			newName = oldTyp.name
+		}
+		newTyp := newByName[newName]
+		if newTyp == nil && isAmbiguousType(oldTyp, removed, ambiguous) {
+			continue
+		}
+		if newTyp == nil {
+			preds := make([]string, 0, len(oldTyp.fields))
+			for _, fld := range oldTyp.fields {
+				preds = append(preds, fld.pred)
+			}
+			if preds = orphaned(preds); len(preds) > 0 {
+				plan.DataMigrations = append(plan.DataMigrations, DataMigration{
+					Predicates: preds,
+					Reason: fmt.Sprintf("Type %s was removed, so nothing reads the data in "+
+						"its predicates.", oldTyp.name),
+				})
+			}
+			continue
+		}
+
+		if newTyp.dgraphName != oldTyp.dgraphName {
+			plan.Suggestions = append(plan.Suggestions, MigrationSuggestion{
+				Type:       newTyp.name,
+				Annotation: fmt.Sprintf("@dgraph(type: %q)", oldTyp.dgraphName),
+				Reason: fmt.Sprintf("Type %s is stored as the Dgraph type %s, but %s would be "+
+					"stored as %s.", oldTyp.name, oldTyp.dgraphName, newTyp.name,
+					newTyp.dgraphName),
+			})
+		}
+		planFields(plan, oldTyp, newTyp, renamed, orphaned)
+	}
+	return plan, nil
+}
+
+// planFields adds what it takes to store the fields of newTyp where the fields of oldTyp, the
+// type it was in the old schema, are stored to plan.
+func planFields(plan *MigrationPlan, oldTyp, newTyp *storedType, renamed map[string]string,
+	orphaned func([]string) []string) {
+
+	sameType := func(oldFld, newFld *storedField) bool {
+		return renamedType(oldFld.typ, renamed) == newFld.typ
+	}
+	// A field that's named after its type is stored in a predicate named after the old type, if
+	// the @dgraph(type:) that's suggested for the type is added.
+	annotatedPred := func(newFld *storedField) string {
+		if newTyp.dgraphName != oldTyp.dgraphName && newFld.pred == newTyp.dgraphName+"."+newFld.name {
+			return oldTyp.dgraphName + "." + newFld.name
+		}
+		return newFld.pred
+	}
+	keepPred := func(oldFld, newFld *storedField, reason string) {
+		if annotatedPred(newFld) == oldFld.pred || newFld.inherited {
+			// An inherited field is stored where the interface says, so it's the interface's
+			// field that needs the annotation, and that's suggested for the interface.
+			return
+		}
+		plan.Suggestions = append(plan.Suggestions, MigrationSuggestion{
+			Type:       newTyp.name,
+			Field:      newFld.name,
+			Annotation: fmt.Sprintf("@dgraph(pred: %q)", oldFld.pred),
+			Reason:     reason,
+		})
+	}
+	changedType := func(oldFld, newFld *storedField) {
+		plan.DataMigrations = append(plan.DataMigrations, DataMigration{
+			Predicates: []string{oldFld.pred},
+			Reason: fmt.Sprintf("Field %s.%s is of type %s, but %s.%s is of type %s, so its "+
+				"values have to be converted.", oldTyp.name, oldFld.name, oldFld.typ,
+				newTyp.name, newFld.name, newFld.typ),
+		})
+	}
+
+	newFields := make(map[string]*storedField, len(newTyp.fields))
+	for _, fld := range newTyp.fields {
+		newFields[fld.name] = fld
+	}
+	oldFields := make(map[string]*storedField, len(oldTyp.fields))
+	for _, fld := range oldTyp.fields {
+		oldFields[fld.name] = fld
+	}
+
+	var removed, added []*storedField
+	for _, oldFld := range oldTyp.fields {
+		newFld := newFields[oldFld.name]
+		switch {
+		case newFld == nil:
+			removed = append(removed, oldFld)
+		case !sameType(oldFld, newFld):
+			changedType(oldFld, newFld)
+		default:
+			keepPred(oldFld, newFld, fmt.Sprintf("Field %s.%s is stored in the predicate %s, "+
+				"but %s.%s would be stored in %s.", oldTyp.name, oldFld.name, oldFld.pred,
+				newTyp.name, newFld.name, annotatedPred(newFld)))
+		}
+	}
+	for _, newFld := range newTyp.fields {
+		if oldFields[newFld.name] == nil {
+			added = append(added, newFld)
+		}
+	}
+
+	renames, ambiguous := matchRenames(len(removed), len(added),
+		func(i, j int) bool { return sameType(removed[i], added[j]) })
+	for i, oldFld := range removed {
+		if j, ok := renames[i]; ok {
+			keepPred(oldFld, added[j], fmt.Sprintf("Field %s.%s looks to have been renamed to "+
+				"%s.%s, which would be stored in %s instead of %s.", oldTyp.name, oldFld.name,
+				newTyp.name, added[j].name, annotatedPred(added[j]), oldFld.pred))
+			continue
+		}
+		if candidates, ok := ambiguous[i]; ok {
+			names := make([]string, 0, len(candidates))
+			for _, j := range candidates {
+				names = append(names, added[j].name)
+			}
+			plan.Ambiguities = append(plan.Ambiguities, fmt.Sprintf("Field %s.%s was removed, "+
+				"and fields %s of the same type were added to %s, so it could have been "+
+				"renamed to any of them. Add @dgraph(pred: %q) to the one that it is.", oldTyp.name,
+				oldFld.name, strings.Join(names, ", "), newTyp.name, oldFld.pred))
+			continue
+		}
+		if preds := orphaned([]string{oldFld.pred}); len(preds) > 0 {
+			plan.DataMigrations = append(plan.DataMigrations, DataMigration{
+				Predicates: preds,
+				Reason: fmt.Sprintf("Field %s.%s was removed, so nothing reads the data in "+
+					"its predicate.", oldTyp.name, oldFld.name),
+			})
+		}
+	}
+}
+
+// isAmbiguousType returns true if typ is one of removed that ambiguous has candidates for.
+func isAmbiguousType(typ *storedType, removed []*storedType, ambiguous map[int][]int) bool {
+	for i := range ambiguous {
+		if removed[i] == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRenames matches up n removed things with m added things, where matches(i, j) says if
+// the ith removed thing could have been renamed to the jth added thing.  It returns the renames,
+// removed -> added, that are certain: those where the two only match each other.  ambiguous
+// has the candidates for each removed thing that matches more than one added thing, or matches
+// an added thing that other removed things match too.
+func matchRenames(n, m int, matches func(i, j int) bool) (renames map[int]int,
+	ambiguous map[int][]int) {
+
+	candidates := make([][]int, n)
+	matchedBy := make([]int, m)
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			if matches(i, j) {
+				candidates[i] = append(candidates[i], j)
+				matchedBy[j]++
+			}
+		}
+	}
+
+	renames = make(map[int]int)
+	ambiguous = make(map[int][]int)
+	for i, cands := range candidates {
+		switch {
+		case len(cands) == 0:
+		case len(cands) == 1 && matchedBy[cands[0]] == 1:
+			renames[i] = cands[0]
+		default:
+			ambiguous[i] = cands
+		}
+	}
+	return renames, ambiguous
+}
+
+// typeShape describes the fields of typ by their types alone, so that a type that was renamed,
+// along with its fields, still has the same shape.  Object types are left out of it, because
+// they may have been renamed too.
+func typeShape(typ *storedType) string {
+	shape := make([]string, 0, len(typ.fields))
+	for _, fld := range typ.fields {
+		shape = append(shape, fld.shape())
+	}
+	sort.Strings(shape)
+	return strings.Join(shape, ",")
+}
+
+// shape is the type of fld, but with any object type replaced by _.
+func (fld *storedField) shape() string {
+	if fld.scalar {
+		return fld.typ
+	}
+	if strings.HasPrefix(fld.typ, "[") {
+		return "[_]"
+	}
+	return "_"
+}
+
+// renamedType returns typ, a field type of the old schema, with its named type renamed as it
+// was in the new schema.
+func renamedType(typ string, renamed map[string]string) string {
+	name := strings.Trim(typ, "[]")
+	newName, ok := renamed[name]
+	if !ok {
+		return typ
+	}
+	return strings.Replace(typ, name, newName, 1)
+}
+
+// storedTypes returns the types of the input schema sch that are stored in Dgraph, in the order
+// they are defined.
+func storedTypes(ctx context.Context, sch string) ([]*storedType, error) {
+	h, err := newHandler(ctx, sch)
+	if err != nil {
+		return nil, err
+	}
+	preds, err := dgraphMapping(ctx, h.completeSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []*storedType
+	for _, name := range h.originalDefs {
+		defn := h.completeSchema.Types[name]
+		if defn == nil || (defn.Kind != ast.Object && defn.Kind != ast.Interface) ||
+			isQueryOrMutationType(defn) || defn.Directives.ForName(remoteDirective) != nil {
+			continue
+		}
+
+		typ := &storedType{name: defn.Name, dgraphName: typeName(defn)}
+		for _, fld := range defn.Fields {
+			pred := preds[defn.Name][fld.Name]
+			if pred == "" || strings.HasPrefix(pred, "~") || isID(fld) ||
+				fld.Directives.ForName(customDirective) != nil ||
+				hasGeneratedDirective(fld.Directives) {
+				continue
+			}
+			fieldType := h.completeSchema.Types[fld.Type.Name()]
+			typ.fields = append(typ.fields, &storedField{
+				name:      fld.Name,
+				typ:       predicateType(fld.Type),
+				pred:      pred,
+				scalar:    fieldType != nil && fieldType.Kind != ast.Object,
+				inherited: inheritedField(h.completeSchema, defn, fld.Name),
+			})
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+// inheritedField returns true if the field name of defn is declared in an interface that defn
+// implements.
+func inheritedField(sch *ast.Schema, defn *ast.Definition, name string) bool {
+	for _, iface := range defn.Interfaces {
+		if i := sch.Types[iface]; i != nil && i.Fields.ForName(name) != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanMigration(t *testing.T) {
+	tcases := map[string]struct {
+		oldSchema string
+		newSchema string
+		expected  *MigrationPlan
+	}{
+		"renamed field keeps its predicate": {
+			oldSchema: `type Author {
+				id: ID!
+				name: String!
+				reputation: Float
+			}`,
+			newSchema: `type Author {
+				id: ID!
+				name: String!
+				karma: Float
+			}`,
+			expected: &MigrationPlan{
+				Suggestions: []MigrationSuggestion{{
+					Type:       "Author",
+					Field:      "karma",
+					Annotation: `@dgraph(pred: "Author.reputation")`,
+					Reason: "Field Author.reputation looks to have been renamed to Author.karma, " +
+						"which would be stored in Author.karma instead of Author.reputation.",
+				}},
+				DataMigrations: []DataMigration{},
+				Ambiguities:    []string{},
+			},
+		},
+		"renamed type keeps its Dgraph type": {
+			oldSchema: `type Author {
+				id: ID!
+				name: String!
+				posts: [Post]
+			}
+			type Post {
+				id: ID!
+				title: String
+				author: Author
+			}`,
+			newSchema: `type Writer {
+				id: ID!
+				name: String!
+				posts: [Post]
+			}
+			type Post {
+				id: ID!
+				title: String
+				author: Writer
+			}`,
+			expected: &MigrationPlan{
+				Suggestions: []MigrationSuggestion{{
+					Type:       "Writer",
+					Annotation: `@dgraph(type: "Author")`,
+					Reason: "Type Author is stored as the Dgraph type Author, but Writer would be " +
+						"stored as Writer.",
+				}},
+				DataMigrations: []DataMigration{},
+				Ambiguities:    []string{},
+			},
+		},
+		"field that could be renamed to more than one is ambiguous": {
+			oldSchema: `type Author {
+				id: ID!
+				name: String!
+				reputation: Float
+			}`,
+			newSchema: `type Author {
+				id: ID!
+				name: String!
+				karma: Float
+				score: Float
+			}`,
+			expected: &MigrationPlan{
+				Suggestions:    []MigrationSuggestion{},
+				DataMigrations: []DataMigration{},
+				Ambiguities: []string{"Field Author.reputation was removed, and fields karma, " +
+					"score of the same type were added to Author, so it could have been renamed " +
+					`to any of them. Add @dgraph(pred: "Author.reputation") to the one that it is.`},
+			},
+		},
+		"changed and removed fields need their data migrated": {
+			oldSchema: `type Author {
+				id: ID!
+				name: String!
+				reputation: Float
+				bio: String
+			}`,
+			newSchema: `type Author {
+				id: ID!
+				name: String!
+				reputation: Int
+			}`,
+			expected: &MigrationPlan{
+				Suggestions: []MigrationSuggestion{},
+				DataMigrations: []DataMigration{
+					{
+						Predicates: []string{"Author.reputation"},
+						Reason: "Field Author.reputation is of type Float, but " +
+							"Author.reputation is of type Int, so its values have to be converted.",
+					},
+					{
+						Predicates: []string{"Author.bio"},
+						Reason: "Field Author.bio was removed, so nothing reads the data in its " +
+							"predicate.",
+					},
+				},
+				Ambiguities: []string{},
+			},
+		},
+		"removed type needs its data migrated": {
+			oldSchema: `type Author {
+				id: ID!
+				name: String!
+			}
+			type Tag {
+				id: ID!
+				label: String
+			}`,
+			newSchema: `type Author {
+				id: ID!
+				name: String!
+			}`,
+			expected: &MigrationPlan{
+				Suggestions: []MigrationSuggestion{},
+				DataMigrations: []DataMigration{{
+					Predicates: []string{"Tag.label"},
+					Reason:     "Type Tag was removed, so nothing reads the data in its predicates.",
+				}},
+				Ambiguities: []string{},
+			},
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			plan, err := PlanMigration(context.Background(), tcase.oldSchema, tcase.newSchema)
+			require.NoError(t, err)
+			require.Equal(t, tcase.expected, plan)
+		})
+	}
+
+	t.Run("invalid schema is an error", func(t *testing.T) {
+		_, err := PlanMigration(context.Background(), `type Author { id: ID! name: String }`,
+			`type Author {`)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "while processing the new schema")
+	})
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultNamespace is the namespace of a schema that isn't given one with InNamespace, and
+	// of a Request that doesn't name one.
+	DefaultNamespace = ""
+	// NamespaceHeader is the HTTP header that a request names its namespace in.
+	NamespaceHeader = "X-Dgraph-Namespace"
+)
+
+// A Registry holds the schema of each namespace served by one process.  Each namespace's
+// Schema is self-contained: its secrets, allowed headers and authorization are its own, so
+// setting the schema of one namespace doesn't change how the others resolve their requests.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]Schema
+}
+
+// NewRegistry returns a Registry that doesn't have a schema for any namespace yet.
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]Schema)}
+}
+
+// Set makes sch the schema of its namespace, replacing the one the namespace had.
+func (r *Registry) Set(sch Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[sch.Namespace()] = sch
+}
+
+// Delete removes the schema of namespace ns.
+func (r *Registry) Delete(ns string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.schemas, ns)
+}
+
+// Schema returns the schema of namespace ns, or nil if it doesn't have one.
+func (r *Registry) Schema(ns string) Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.schemas[ns]
+}
+
+// Operation builds the operation of req against the schema of req's namespace.
+func (r *Registry) Operation(req *Request) (Operation, error) {
+	if req == nil {
+		return nil, errors.New("no query string supplied in request")
+	}
+	sch := r.Schema(req.Namespace)
+	if sch == nil {
+		return nil, errors.Errorf("Namespace %q doesn't have a GraphQL schema.", req.Namespace)
+	}
+	return sch.Operation(req)
+}
+
+// WithAuthMeta returns a context in which requests for the namespace ns are authorized with the
+// namespace's # Dgraph.Authorization.  If the namespace's schema has no authorization, no JWT is
+// accepted, whatever authorization ctx already had.  The context is returned as it is if ns
+// doesn't have a schema.
+func (r *Registry) WithAuthMeta(ctx context.Context, ns string) context.Context {
+	sch := r.Schema(ns)
+	if sch == nil {
+		return ctx
+	}
+	meta := sch.AuthMeta()
+	if meta == nil {
+		meta = &authorization.AuthMeta{}
+	}
+	return authorization.AttachAuthMeta(ctx, meta)
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/stretchr/testify/require"
+)
+
+// namespaceSchemas are the schemas of two namespaces that both have a type Post, with different
+// fields, different secrets and different JWT headers.
+var namespaceSchemas = map[string]string{
+	"acme": `
+	type Post {
+		id: ID!
+		title: String!
+	}
+
+	type Query {
+		remotePost(id: ID!): Post @custom(http: {
+			url: "http://api.com/posts/$id",
+			method: GET,
+			secretHeaders: ["Authorization:Bearer $API_KEY"]
+		})
+	}
+	# Dgraph.Secret API_KEY "acme-key"
+	# Dgraph.Authorization X-Acme-Auth https://acme.io/jwt/claims HS256 "acme-secret"`,
+	"globex": `
+	type Post {
+		id: ID!
+		body: String!
+		likes: Int
+	}
+
+	type Query {
+		remotePost(id: ID!): Post @custom(http: {
+			url: "http://api.com/posts/$id",
+			method: GET,
+			secretHeaders: ["Authorization:Bearer $API_KEY"]
+		})
+	}
+	# Dgraph.Secret API_KEY "globex-key"
+	# Dgraph.Authorization X-Globex-Auth https://globex.io/jwt/claims HS256 "globex-secret"`,
+}
+
+// namespaceExpectations are what requests in each namespace of namespaceSchemas should see.
+var namespaceExpectations = map[string]struct {
+	field, otherField, authHeader, otherAuthHeader, apiKey string
+}{
+	"acme":   {"title", "body", "X-Acme-Auth", "X-Globex-Auth", "Bearer acme-key"},
+	"globex": {"body", "title", "X-Globex-Auth", "X-Acme-Auth", "Bearer globex-key"},
+}
+
+func loadNamespace(ns string) (Schema, error) {
+	h, err := NewHandler(namespaceSchemas[ns], InNamespace(ns))
+	if err != nil {
+		return nil, err
+	}
+	return FromHandler(context.Background(), h)
+}
+
+// checkNamespace checks that a request in namespace ns is resolved against that namespace's
+// schema, secrets and authorization, and not the other namespace's.
+func checkNamespace(reg *Registry, ns string) error {
+	want := namespaceExpectations[ns]
+
+	op, err := reg.Operation(&Request{Namespace: ns,
+		Query: fmt.Sprintf(`query { queryPost { %s } }`, want.field)})
+	if err != nil {
+		return err
+	}
+	if got := op.Schema().Namespace(); got != ns {
+		return fmt.Errorf("%s: operation is of namespace %q", ns, got)
+	}
+	if _, err := reg.Operation(&Request{Namespace: ns,
+		Query: fmt.Sprintf(`query { queryPost { %s } }`, want.otherField)}); err == nil {
+		return fmt.Errorf("%s: field %s of the other namespace's Post was accepted", ns,
+			want.otherField)
+	}
+
+	op, err = reg.Operation(&Request{Namespace: ns,
+		Query: `query { remotePost(id: "0x1") { id } }`})
+	if err != nil {
+		return err
+	}
+	confs, err := op.Queries()[0].CustomHTTPConfig(nil)
+	if err != nil {
+		return err
+	}
+	if got := confs[0].ForwardHeaders.Get("Authorization"); got != want.apiKey {
+		return fmt.Errorf("%s: custom query sent secret %q, want %q", ns, got, want.apiKey)
+	}
+
+	allowed := reg.Schema(ns).AllowedHeaders()
+	if !strings.Contains(allowed, want.authHeader) ||
+		strings.Contains(allowed, want.otherAuthHeader) {
+		return fmt.Errorf("%s: allowed headers are %q", ns, allowed)
+	}
+	if got := authorization.HeaderFrom(reg.WithAuthMeta(context.Background(), ns)); got !=
+		want.authHeader {
+		return fmt.Errorf("%s: requests are authorized with header %q", ns, got)
+	}
+	return nil
+}
+
+func TestRegistryServesNamespacesConcurrently(t *testing.T) {
+	reg := NewRegistry()
+	for ns := range namespaceSchemas {
+		sch, err := loadNamespace(ns)
+		require.NoError(t, err)
+		reg.Set(sch)
+	}
+
+	const iterations = 20
+	errs := make(chan error, 4*iterations)
+	var wg sync.WaitGroup
+	for ns := range namespaceSchemas {
+		ns := ns
+		wg.Add(2)
+		// One goroutine keeps updating the namespace's schema, while another serves it.
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				sch, err := loadNamespace(ns)
+				if err != nil {
+					errs <- err
+					return
+				}
+				reg.Set(sch)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				if err := checkNamespace(reg, ns); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Requests for a namespace that has no schema aren't authorized with any other namespace's.
+	require.Equal(t, "",
+		authorization.HeaderFrom(reg.WithAuthMeta(context.Background(), DefaultNamespace)))
+}
+
+func TestRegistryUpdateLeavesOtherNamespacesAlone(t *testing.T) {
+	reg := NewRegistry()
+	for ns := range namespaceSchemas {
+		sch, err := loadNamespace(ns)
+		require.NoError(t, err)
+		reg.Set(sch)
+	}
+
+	globex := reg.Schema("globex")
+	op, err := reg.Operation(&Request{Namespace: "globex",
+		Query: `query { remotePost(id: "0x1") { body } }`})
+	require.NoError(t, err)
+
+	h, err := NewHandler(`
+	type Post {
+		id: ID!
+		title: String!
+		subtitle: String
+	}
+	# Dgraph.Secret API_KEY "acme-key-2"`, InNamespace("acme"))
+	require.NoError(t, err)
+	acme, err := FromHandler(context.Background(), h)
+	require.NoError(t, err)
+	reg.Set(acme)
+
+	_, err = reg.Operation(&Request{Namespace: "acme",
+		Query: `query { queryPost { subtitle } }`})
+	require.NoError(t, err)
+	require.Nil(t, reg.Schema("acme").AuthMeta())
+	require.Equal(t, "", authorization.HeaderFrom(reg.WithAuthMeta(context.Background(), "acme")))
+
+	// The other namespace, and the operations already built against it, are as they were.
+	require.Equal(t, globex, reg.Schema("globex"))
+	confs, err := op.Queries()[0].CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"Authorization": {"Bearer globex-key"}}, confs[0].ForwardHeaders)
+	require.NoError(t, checkNamespace(reg, "globex"))
+
+	reg.Delete("acme")
+	_, err = reg.Operation(&Request{Namespace: "acme", Query: `query { queryPost { title } }`})
+	require.EqualError(t, err, `Namespace "acme" doesn't have a GraphQL schema.`)
+}
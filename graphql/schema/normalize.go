@@ -0,0 +1,475 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/dgraph/x"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// schemaComment is a comment in an input schema.  A trailing comment is one that follows
+// some definition on the same line.
+type schemaComment struct {
+	line     int
+	text     string
+	trailing bool
+}
+
+// schemaPrinter prints the definitions of an input schema in a canonical format.  Comments
+// from the input are printed just above the first definition, field or enum value that follows
+// them in the input, or at the end of the line if they trailed one.  The dgraphComments, which
+// set the options of the schema, are always printed at the end.
+type schemaPrinter struct {
+	sb       strings.Builder
+	comments []schemaComment
+	dgraph   []string
+	warnings []string
+}
+
+// NormalizeSchema checks that input is a valid GraphQL schema (in the same way as NewHandler)
+// and returns it printed in a canonical format.  The definitions are kept in the order they
+// were written in, but the whitespace and indentation is normalized and the arguments of
+// directives are printed in the order they are declared.  Comments are preserved.
+//
+// Normalizing doesn't change the meaning of the schema, so a handler built from the normalized
+// schema is the same as one built from input.  Any duplicate or shadowed declarations found
+// while normalizing are returned as warnings.
+func NormalizeSchema(input string) (string, []string, error) {
+	h, err := newHandler(context.Background(), input)
+	if err != nil {
+		return "", nil, err
+	}
+
+	doc, gqlErr := parser.ParseSchema(&ast.Source{Input: input})
+	if gqlErr != nil {
+		return "", nil, gqlerror.List{gqlErr}
+	}
+	normalizeSchemaDirectives(h.completeSchema, doc.Definitions)
+	normalizeSchemaDirectives(h.completeSchema, doc.Extensions)
+
+	p := &schemaPrinter{}
+	p.collectComments(input)
+	p.warnShadowed(h.completeSchema, doc.Definitions)
+
+	// Directive definitions are kept separately from the other definitions in the document, so
+	// put them back in the order they were written.
+	type printable struct {
+		pos   *ast.Position
+		print func()
+	}
+	var printables []printable
+	for _, defn := range doc.Definitions {
+		defn := defn
+		printables = append(printables, printable{defn.Position,
+			func() { p.printDefinition(defn, "") }})
+	}
+	for _, dir := range doc.Directives {
+		dir := dir
+		printables = append(printables, printable{dir.Position,
+			func() { p.printDirectiveDefinition(dir) }})
+	}
+	for _, defn := range doc.Extensions {
+		defn := defn
+		printables = append(printables, printable{defn.Position,
+			func() { p.printDefinition(defn, "extend ") }})
+	}
+	sort.SliceStable(printables, func(i, j int) bool {
+		return printables[i].pos.Line < printables[j].pos.Line
+	})
+
+	for i, pr := range printables {
+		if i > 0 {
+			x.Check2(p.sb.WriteString("\n"))
+		}
+		pr.print()
+	}
+
+	// Any comments left over came after the last definition.
+	if len(p.comments) > 0 {
+		x.Check2(p.sb.WriteString("\n"))
+		p.printCommentsBefore(nil, "")
+	}
+	if len(p.dgraph) > 0 {
+		x.Check2(p.sb.WriteString("\n"))
+		for _, c := range p.dgraph {
+			x.Check2(p.sb.WriteString(c + "\n"))
+		}
+	}
+
+	return p.sb.String(), p.warnings, nil
+}
+
+// warnShadowed warns about the definitions of the input that the schema generation replaces
+// with one it generates with the same name, like a type AuthorOrderable for an Author type.
+// Those declarations have no effect on the complete schema sch.  Generated definitions have
+// no position, as they aren't in the input.
+func (p *schemaPrinter) warnShadowed(sch *ast.Schema, definitions ast.DefinitionList) {
+	for _, defn := range definitions {
+		if gen := sch.Types[defn.Name]; gen != nil && gen.Position == nil {
+			p.warnings = append(p.warnings, fmt.Sprintf(
+				"Type %s is shadowed by the definition generated with the same name, so its "+
+					"declaration isn't used.", defn.Name))
+		}
+	}
+}
+
+// collectComments finds all the comments in the input.  Anything inside a string isn't a
+// comment, even if it has a #.
+func (p *schemaPrinter) collectComments(input string) {
+	secrets := make(map[string]bool)
+	inBlockString, inAuthRule := false, false
+	for i, line := range strings.Split(input, "\n") {
+		text := strings.TrimSpace(line)
+		if !inBlockString && !strings.HasPrefix(text, "#") {
+			if idx := trailingCommentIndex(text); idx > 0 {
+				p.comments = append(p.comments, schemaComment{
+					line:     i + 1,
+					text:     strings.TrimSpace(text[idx:]),
+					trailing: true,
+				})
+			}
+		}
+		if !inBlockString && strings.HasPrefix(text, "#") {
+			kind := dgraphCommentFor(text)
+			switch {
+			case inAuthRule || (kind != nil && kind.prefix == authRuleComment):
+				// a named auth rule can carry on over many comment lines, keep them together
+				quotes := strings.Count(text, `"""`)
+				if !inAuthRule {
+					inAuthRule = quotes == 1
+				} else if quotes%2 == 1 {
+					inAuthRule = false
+				}
+				p.dgraph = append(p.dgraph, text)
+			case kind != nil && kind.prefix == secretComment:
+				if parts := strings.Fields(text); len(parts) > 2 {
+					key := strings.Trim(parts[2], `"`)
+					if secrets[key] {
+						p.warnings = append(p.warnings, fmt.Sprintf(
+							"Dgraph.Secret %s is declared more than once, only the last "+
+								"value is used.", key))
+					}
+					secrets[key] = true
+				}
+				p.dgraph = append(p.dgraph, text)
+			case kind != nil:
+				p.dgraph = append(p.dgraph, text)
+			default:
+				p.comments = append(p.comments, schemaComment{line: i + 1, text: text})
+			}
+		}
+		isComment := !inBlockString && strings.HasPrefix(text, "#")
+		if !isComment && strings.Count(line, `"""`)%2 == 1 {
+			inBlockString = !inBlockString
+		}
+	}
+}
+
+// trailingCommentIndex returns the index at which a comment starts in line, or -1 if there's
+// no comment in line.
+func trailingCommentIndex(line string) int {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inString {
+				// skip the escaped character
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// printCommentsBefore prints all the comments that come before pos in the input.  A nil pos
+// prints all the remaining comments.
+func (p *schemaPrinter) printCommentsBefore(pos *ast.Position, indent string) {
+	printed := 0
+	for _, c := range p.comments {
+		if pos != nil && c.line >= pos.Line {
+			break
+		}
+		x.Check2(p.sb.WriteString(indent + c.text + "\n"))
+		printed++
+	}
+	p.comments = p.comments[printed:]
+}
+
+// trailingComment returns the comment that was at the end of the line at pos, if there was one.
+func (p *schemaPrinter) trailingComment(pos *ast.Position) string {
+	if pos == nil || len(p.comments) == 0 || !p.comments[0].trailing ||
+		p.comments[0].line != pos.Line {
+		return ""
+	}
+	c := p.comments[0]
+	p.comments = p.comments[1:]
+	return " " + c.text
+}
+
+func (p *schemaPrinter) printDescription(description, indent string) {
+	if description == "" {
+		return
+	}
+	x.Check2(p.sb.WriteString(indent + generateDescription(description)))
+}
+
+func (p *schemaPrinter) printDefinition(defn *ast.Definition, prefix string) {
+	p.printCommentsBefore(defn.Position, "")
+	p.printDescription(defn.Description, "")
+
+	if defn.Kind == ast.Union {
+		x.Check2(p.sb.WriteString(fmt.Sprintf("%sunion %s%s = %s%s\n", prefix, defn.Name,
+			p.directivesString(defn.Directives, "Union "+defn.Name),
+			strings.Join(defn.Types, " | "), p.trailingComment(defn.Position))))
+		return
+	}
+
+	var kind string
+	switch defn.Kind {
+	case ast.Object:
+		kind = "type"
+	case ast.Interface:
+		kind = "interface"
+	case ast.InputObject:
+		kind = "input"
+	case ast.Enum:
+		kind = "enum"
+	default:
+		// NewHandler only accepts the kinds above.
+		return
+	}
+
+	x.Check2(p.sb.WriteString(fmt.Sprintf("%s%s %s", prefix, kind, defn.Name)))
+	if len(defn.Interfaces) > 0 {
+		x.Check2(p.sb.WriteString(" implements " + strings.Join(defn.Interfaces, " & ")))
+	}
+	x.Check2(p.sb.WriteString(p.directivesString(defn.Directives, "Type "+defn.Name)))
+	x.Check2(p.sb.WriteString(" {" + p.trailingComment(defn.Position) + "\n"))
+
+	for _, fld := range defn.Fields {
+		p.printCommentsBefore(fld.Position, "\t")
+		p.printDescription(fld.Description, "\t")
+		x.Check2(p.sb.WriteString(fmt.Sprintf("\t%s%s: %s", fld.Name,
+			argumentDefinitionsString(fld.Arguments), fld.Type.String())))
+		if fld.DefaultValue != nil {
+			x.Check2(p.sb.WriteString(" = " + normalizedValueString(fld.DefaultValue)))
+		}
+		x.Check2(p.sb.WriteString(p.directivesString(fld.Directives,
+			fmt.Sprintf("Type %s; Field %s", defn.Name, fld.Name))))
+		x.Check2(p.sb.WriteString(p.trailingComment(fld.Position) + "\n"))
+	}
+
+	for _, val := range defn.EnumValues {
+		p.printCommentsBefore(val.Position, "\t")
+		p.printDescription(val.Description, "\t")
+		x.Check2(p.sb.WriteString("\t" + val.Name))
+		x.Check2(p.sb.WriteString(p.directivesString(val.Directives,
+			fmt.Sprintf("Enum %s; Value %s", defn.Name, val.Name))))
+		x.Check2(p.sb.WriteString(p.trailingComment(val.Position) + "\n"))
+	}
+
+	x.Check2(p.sb.WriteString("}\n"))
+}
+
+func (p *schemaPrinter) printDirectiveDefinition(dir *ast.DirectiveDefinition) {
+	p.printCommentsBefore(dir.Position, "")
+	p.printDescription(dir.Description, "")
+
+	locations := make([]string, len(dir.Locations))
+	for i, loc := range dir.Locations {
+		locations[i] = string(loc)
+	}
+	x.Check2(p.sb.WriteString(fmt.Sprintf("directive @%s%s on %s%s\n", dir.Name,
+		argumentDefinitionsString(dir.Arguments), strings.Join(locations, " | "),
+		p.trailingComment(dir.Position))))
+}
+
+// directivesString prints the directives in the order they were written.  A directive that's
+// repeated on the same definition is reported as a warning, because only the first one is ever
+// used.
+func (p *schemaPrinter) directivesString(dirs ast.DirectiveList, location string) string {
+	var sb strings.Builder
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		if seen[dir.Name] {
+			p.warnings = append(p.warnings, fmt.Sprintf(
+				"%s: directive @%s is declared more than once, only the first one is used.",
+				location, dir.Name))
+		}
+		seen[dir.Name] = true
+
+		x.Check2(sb.WriteString(" @" + dir.Name))
+		if len(dir.Arguments) == 0 {
+			continue
+		}
+		argStrs := make([]string, len(dir.Arguments))
+		for i, arg := range dir.Arguments {
+			argStrs[i] = fmt.Sprintf("%s: %s", arg.Name, normalizedValueString(arg.Value))
+		}
+		x.Check2(sb.WriteString(fmt.Sprintf("(%s)", strings.Join(argStrs, ", "))))
+	}
+	return sb.String()
+}
+
+func argumentDefinitionsString(args ast.ArgumentDefinitionList) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	argStrs := make([]string, len(args))
+	for i, arg := range args {
+		argStrs[i] = genArgumentDefnString(arg)
+		if arg.DefaultValue != nil {
+			argStrs[i] += " = " + normalizedValueString(arg.DefaultValue)
+		}
+	}
+	return fmt.Sprintf("(%s)", strings.Join(argStrs, ", "))
+}
+
+// normalizedValueString prints val in the same way as val.String(), but with spaces after
+// the separators so that it's easier to read.
+func normalizedValueString(val *ast.Value) string {
+	if val == nil {
+		return "<nil>"
+	}
+
+	switch val.Kind {
+	case ast.ObjectValue:
+		childStrs := make([]string, len(val.Children))
+		for i, child := range val.Children {
+			childStrs[i] = fmt.Sprintf("%s: %s", child.Name, normalizedValueString(child.Value))
+		}
+		return fmt.Sprintf("{%s}", strings.Join(childStrs, ", "))
+	case ast.ListValue:
+		childStrs := make([]string, len(val.Children))
+		for i, child := range val.Children {
+			childStrs[i] = normalizedValueString(child.Value)
+		}
+		return fmt.Sprintf("[%s]", strings.Join(childStrs, ", "))
+	default:
+		return val.String()
+	}
+}
+
+// declarationOrder maps the names of some declared things (arguments or fields) to the order
+// they were declared in.
+type declarationOrder map[string]int
+
+// less orders names by declaration.  Names that weren't declared come after all the declared
+// ones, sorted by name.
+func (o declarationOrder) less(a, b string) bool {
+	rank := func(name string) int {
+		if r, ok := o[name]; ok {
+			return r
+		}
+		return len(o)
+	}
+
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	return ra == len(o) && a < b
+}
+
+// normalizeDirectiveArguments sorts the arguments of dirs, and the fields of any input objects
+// given as argument values, in the order they are declared in sch.  That way, the same schema
+// always prints the same, no matter which order the arguments were written in.
+func normalizeDirectiveArguments(sch *ast.Schema, dirs ast.DirectiveList) {
+	for _, dir := range dirs {
+		var argDefs ast.ArgumentDefinitionList
+		if defn := sch.Directives[dir.Name]; defn != nil {
+			argDefs = defn.Arguments
+		}
+
+		order := make(declarationOrder, len(argDefs))
+		for i, argDef := range argDefs {
+			order[argDef.Name] = i
+		}
+		args := dir.Arguments
+		sort.SliceStable(args, func(i, j int) bool { return order.less(args[i].Name, args[j].Name) })
+
+		for _, arg := range args {
+			typName := ""
+			if argDef := argDefs.ForName(arg.Name); argDef != nil {
+				typName = argDef.Type.Name()
+			}
+			normalizeValue(sch, arg.Value, typName)
+		}
+	}
+}
+
+func normalizeValue(sch *ast.Schema, val *ast.Value, typName string) {
+	if val == nil {
+		return
+	}
+
+	switch val.Kind {
+	case ast.ListValue:
+		for _, child := range val.Children {
+			normalizeValue(sch, child.Value, typName)
+		}
+	case ast.ObjectValue:
+		var fields ast.FieldList
+		if typ := sch.Types[typName]; typ != nil {
+			fields = typ.Fields
+		}
+
+		order := make(declarationOrder, len(fields))
+		for i, fld := range fields {
+			order[fld.Name] = i
+		}
+		children := val.Children
+		sort.SliceStable(children, func(i, j int) bool {
+			return order.less(children[i].Name, children[j].Name)
+		})
+
+		for _, child := range children {
+			childTypName := ""
+			if fld := fields.ForName(child.Name); fld != nil {
+				childTypName = fld.Type.Name()
+			}
+			normalizeValue(sch, child.Value, childTypName)
+		}
+	}
+}
+
+// normalizeSchemaDirectives normalizes the directive arguments in all the definitions.
+func normalizeSchemaDirectives(sch *ast.Schema, definitions []*ast.Definition) {
+	for _, defn := range definitions {
+		normalizeDirectiveArguments(sch, defn.Directives)
+		for _, fld := range defn.Fields {
+			normalizeDirectiveArguments(sch, fld.Directives)
+		}
+		for _, val := range defn.EnumValues {
+			normalizeDirectiveArguments(sch, val.Directives)
+		}
+	}
+}
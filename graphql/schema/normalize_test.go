@@ -0,0 +1,144 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestNormalizeSchema_RoundTrip(t *testing.T) {
+	inputDir := "testdata/schemagen/input/"
+
+	files, err := ioutil.ReadDir(inputDir)
+	require.NoError(t, err)
+
+	for _, testFile := range files {
+		t.Run(testFile.Name(), func(t *testing.T) {
+			input, err := ioutil.ReadFile(inputDir + testFile.Name())
+			require.NoError(t, err)
+
+			normalized, _, err := NormalizeSchema(string(input))
+			require.NoError(t, err)
+
+			// normalizing is idempotent
+			again, _, err := NormalizeSchema(normalized)
+			require.NoError(t, err)
+			require.Equal(t, normalized, again)
+
+			origHandler, err := NewHandler(string(input))
+			require.NoError(t, err)
+			normHandler, err := NewHandler(normalized)
+			require.NoError(t, err)
+
+			// Directive arguments are generated in the order they are written, and normalizing
+			// puts them in the order they are declared.
+			for _, h := range []*handler{origHandler.(*handler), normHandler.(*handler)} {
+				defns := make([]*ast.Definition, 0, len(h.originalDefs))
+				for _, name := range h.originalDefs {
+					defns = append(defns, h.completeSchema.Types[name])
+				}
+				normalizeSchemaDirectives(h.completeSchema, defns)
+			}
+
+			if diff := cmp.Diff(origHandler.GQLSchema(), normHandler.GQLSchema()); diff != "" {
+				t.Errorf("GraphQL schema mismatch - diff (-want +got):\n%s", diff)
+			}
+			require.Equal(t, origHandler.DGSchema(), normHandler.DGSchema())
+
+			origSch, err := FromString(origHandler.GQLSchema())
+			require.NoError(t, err)
+			normSch, err := FromString(normHandler.GQLSchema())
+			require.NoError(t, err)
+			require.Equal(t, origSch.(*schema).dgraphPredicate, normSch.(*schema).dgraphPredicate)
+		})
+	}
+}
+
+func TestNormalizeSchema_Format(t *testing.T) {
+	input := `
+# Dgraph.Secret GITHUB_KEY "some-key"
+  type   Author @dgraph(type:"Writer") {   # trailing
+     id :ID!
+   # about name
+      name: String! @search(by:[hash,  term])
+	posts: [Post] @hasInverse( field :author)
+  }
+type Post {
+	id: ID!
+	author: Author
+	stars: [Author] @custom(http: {method: GET, url: "http://api.com/stars"})
+}`
+
+	expected := `type Author @dgraph(type: "Writer") { # trailing
+	id: ID!
+	# about name
+	name: String! @search(by: [hash, term])
+	posts: [Post] @hasInverse(field: author)
+}
+
+type Post {
+	id: ID!
+	author: Author
+	stars: [Author] @custom(http: {url: "http://api.com/stars", method: GET})
+}
+
+# Dgraph.Secret GITHUB_KEY "some-key"
+`
+
+	normalized, warnings, err := NormalizeSchema(input)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+	if diff := cmp.Diff(expected, normalized); diff != "" {
+		t.Errorf("normalized schema mismatch - diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNormalizeSchema_Warnings(t *testing.T) {
+	input := `
+type Author {
+	id: ID!
+	name: String! @search(by: [hash]) @search(by: [term])
+}
+
+enum AuthorOrderable {
+	name
+}
+
+# Dgraph.Secret KEY "first"
+# Dgraph.Secret KEY "second"
+`
+
+	_, warnings, err := NormalizeSchema(input)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"Type Author; Field name: directive @search is declared more than once, " +
+			"only the first one is used.",
+		"Type AuthorOrderable is shadowed by the definition generated with the same name, so " +
+			"its declaration isn't used.",
+		"Dgraph.Secret KEY is declared more than once, only the last value is used.",
+	}, warnings)
+}
+
+func TestNormalizeSchema_Invalid(t *testing.T) {
+	_, _, err := NormalizeSchema(`type Author { name: String @search(by: [nope]) }`)
+	require.Error(t, err)
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/dgraph/x"
+	"github.com/pkg/errors"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// A schema with relayIDsComment follows Relay's global object identification
+// (https://relay.dev/graphql/objectidentification.htm).  Every type with an ID implements
+//
+// interface Node { id: ID! }
+//
+// and any node can be fetched by its ID with
+//
+// node(id: ID!): Node
+//
+// The IDs are opaque to clients: a node is given out and taken in as base64(TypeName:uid), so
+// an ID also says which type the node is, and the same uid can't be mistaken for another type.
+const (
+	relayNodeInterface = "Node"
+	relayNodeQuery     = "node"
+	relayIDField       = "id"
+)
+
+// EncodeRelayID returns the Relay global ID of the node uid of type typName.
+func EncodeRelayID(typName, uid string) string {
+	return base64.StdEncoding.EncodeToString([]byte(typName + ":" + uid))
+}
+
+// DecodeRelayID returns the type name and uid that id, a Relay global ID, was encoded from.
+// It's an error for id to be a plain uid, rather than the uid being guessed to be of
+// whatever type is expected.
+func DecodeRelayID(id string) (string, string, error) {
+	if _, err := strconv.ParseUint(id, 0, 64); err == nil {
+		return "", "", errors.Errorf("ID %s is a uid, but the schema uses Relay global IDs, "+
+			"so it should be the ID the node was given out as", id)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return "", "", errors.Errorf("ID %s isn't a Relay global ID, it isn't base64 encoded", id)
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", errors.Errorf("ID %s isn't a Relay global ID, it doesn't encode "+
+			"TypeName:uid", id)
+	}
+	if _, err := strconv.ParseUint(parts[1], 0, 64); err != nil {
+		return "", "", errors.Errorf("ID %s isn't a Relay global ID, %s isn't a uid",
+			id, parts[1])
+	}
+	return parts[0], parts[1], nil
+}
+
+// addRelayNode adds Relay's Node interface and node query to sch, and makes each object type
+// in defns that's stored in Dgraph and has an ID implement Node.
+func addRelayNode(sch *ast.Schema, defns []string) gqlerror.List {
+	var errs gqlerror.List
+	if defn := sch.Types[relayNodeInterface]; defn != nil {
+		errs = append(errs, gqlerror.ErrorPosf(defn.Position, "Type %s; is reserved for "+
+			"Relay's Node interface by %s.", relayNodeInterface, relayIDsComment))
+	}
+	if fld := sch.Query.Fields.ForName(relayNodeQuery); fld != nil {
+		errs = append(errs, gqlerror.ErrorPosf(fld.Position, "Query %s; is reserved for "+
+			"Relay's node query by %s.", relayNodeQuery, relayIDsComment))
+	}
+
+	idType := &ast.Type{NamedType: IDType, NonNull: true}
+	node := &ast.Definition{
+		Kind:   ast.Interface,
+		Name:   relayNodeInterface,
+		Fields: ast.FieldList{{Name: relayIDField, Type: idType}},
+	}
+	for _, name := range defns {
+		defn := sch.Types[name]
+		if defn.Kind != ast.Object || isQueryOrMutationType(defn) ||
+			defn.Directives.ForName(remoteDirective) != nil {
+			continue
+		}
+		id := getIDField(defn)
+		if len(id) == 0 {
+			continue
+		}
+		if id[0].Name != relayIDField || !id[0].Type.NonNull {
+			errs = append(errs, gqlerror.ErrorPosf(id[0].Position, "Type %s; Field %s: is the "+
+				"ID of a type that implements Relay's Node interface, so it must be %s: %s.",
+				defn.Name, id[0].Name, relayIDField, idType))
+			continue
+		}
+		defn.Interfaces = append(defn.Interfaces, relayNodeInterface)
+		sch.PossibleTypes[node.Name] = append(sch.PossibleTypes[node.Name], defn)
+		sch.Implements[defn.Name] = append(sch.Implements[defn.Name], node)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	sch.Types[relayNodeInterface] = node
+	sch.Query.Fields = append(sch.Query.Fields, &ast.FieldDefinition{
+		Name:      relayNodeQuery,
+		Type:      &ast.Type{NamedType: relayNodeInterface},
+		Arguments: ast.ArgumentDefinitionList{{Name: relayIDField, Type: idType}},
+	})
+	return nil
+}
+
+// checkRelayIDs checks that the IDs in the arguments of the fields in sels, and in their
+// selection sets, are Relay global IDs of the types the arguments expect.
+func checkRelayIDs(s *schema, sels ast.SelectionSet, vars map[string]interface{}) error {
+	for _, sel := range sels {
+		fld, ok := sel.(*ast.Field)
+		if !ok || fld.Definition == nil || isCustomField(s, fld) {
+			// Whatever is under a @custom field is resolved remotely, so it has no Dgraph IDs.
+			continue
+		}
+		if _, err := relayArgs(s, fld, fld.ArgumentMap(vars)); err != nil {
+			return err
+		}
+		if err := checkRelayIDs(s, fld.SelectionSet, vars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relayArgs returns args, the arguments of fld, with the Relay global IDs in them decoded into
+// uids.  Arguments are left as they are for fields that aren't resolved by Dgraph.  args isn't
+// changed, because its values can be shared with the request's variables.
+func relayArgs(s *schema, fld *ast.Field, args map[string]interface{}) (
+	map[string]interface{}, error) {
+
+	if fld.Definition == nil || isCustomField(s, fld) ||
+		(fld.ObjectDefinition != nil &&
+			fld.ObjectDefinition.Directives.ForName(remoteDirective) != nil) {
+		return args, nil
+	}
+
+	decoded := make(map[string]interface{}, len(args))
+	for name, val := range args {
+		argDefn := fld.Definition.Arguments.ForName(name)
+		if argDefn == nil {
+			decoded[name] = val
+			continue
+		}
+		var err error
+		decoded[name], err = relayValue(s.schema, argDefn.Type, val, fld.Definition.Type.Name())
+		if err != nil {
+			return nil, x.GqlErrorf("Argument %s of %s has an invalid ID: %s", name,
+				fld.Name, err).WithLocations(x.Location{Line: fld.Position.Line,
+				Column: fld.Position.Column})
+		}
+	}
+	return decoded, nil
+}
+
+// isCustomField returns true if fld is resolved by @custom.  The schema keeps the @custom
+// directives in s.customDirectives, rather than on the field definitions.
+func isCustomField(s *schema, fld *ast.Field) bool {
+	return fld.ObjectDefinition != nil &&
+		s.customDirectives[fld.ObjectDefinition.Name][fld.Name] != nil
+}
+
+// relayValue returns val, a value of typ, with the IDs in it decoded into uids.  An ID must be
+// of a node of type expected, or of a type that's related to it through an interface.  Input
+// objects for a type, like TFilter or TRef, set what type their IDs are expected to be.
+func relayValue(sch *ast.Schema, typ *ast.Type, val interface{}, expected string) (
+	interface{}, error) {
+
+	if val == nil {
+		return nil, nil
+	}
+
+	if typ.Elem != nil {
+		vals, ok := val.([]interface{})
+		if !ok {
+			// A single value given for a list is taken as a list of one.
+			return relayValue(sch, typ.Elem, val, expected)
+		}
+		decoded := make([]interface{}, len(vals))
+		for i, v := range vals {
+			var err error
+			if decoded[i], err = relayValue(sch, typ.Elem, v, expected); err != nil {
+				return nil, err
+			}
+		}
+		return decoded, nil
+	}
+
+	if typ.Name() == IDType {
+		id, ok := val.(string)
+		if !ok {
+			return val, nil
+		}
+		typName, uid, err := DecodeRelayID(id)
+		if err != nil {
+			return nil, err
+		}
+		if sch.Types[typName] == nil {
+			return nil, errors.Errorf("ID %s is of type %s, which isn't in the schema", id,
+				typName)
+		}
+		if !relayTypeMatches(sch, typName, expected) {
+			return nil, errors.Errorf("ID %s is of type %s, but an ID of type %s is "+
+				"expected", id, typName, expected)
+		}
+		return uid, nil
+	}
+
+	defn := sch.Types[typ.Name()]
+	obj, ok := val.(map[string]interface{})
+	if defn == nil || defn.Kind != ast.InputObject || !ok {
+		return val, nil
+	}
+	if t := relayInputType(sch, defn.Name); t != "" {
+		expected = t
+	}
+	decoded := make(map[string]interface{}, len(obj))
+	for name, v := range obj {
+		fd := defn.Fields.ForName(name)
+		if fd == nil {
+			decoded[name] = v
+			continue
+		}
+		var err error
+		if decoded[name], err = relayValue(sch, fd.Type, v, expected); err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
+
+// relayInputType returns the type that the generated input type name is for, e.g. Post for
+// PostRef, PostFilter, PostPatch, AddPostInput, UpsertPostInput and UpdatePostInput.  It
+// returns "" for any other input type.
+func relayInputType(sch *ast.Schema, name string) string {
+	affixes := []struct{ prefix, suffix string }{
+		{"", "Ref"}, {"", "Filter"}, {"", "Patch"}, {"Add", "Input"}, {"Upsert", "Input"},
+		{"Update", "Input"},
+	}
+	for _, a := range affixes {
+		if !strings.HasPrefix(name, a.prefix) || !strings.HasSuffix(name, a.suffix) {
+			continue
+		}
+		typ := sch.Types[strings.TrimSuffix(strings.TrimPrefix(name, a.prefix), a.suffix)]
+		if typ != nil && (typ.Kind == ast.Object || typ.Kind == ast.Interface) {
+			return typ.Name
+		}
+	}
+	return ""
+}
+
+// relayTypeMatches returns true if a node of type typName can be given where a node of type
+// expected is.  That's if they are the same type, or one is an interface the other implements.
+func relayTypeMatches(sch *ast.Schema, typName, expected string) bool {
+	return typName == expected || implementsInterface(sch.Types[typName], expected) ||
+		implementsInterface(sch.Types[expected], typName)
+}
+
+// implementsInterface returns true if typ implements the interface iface.
+func implementsInterface(typ *ast.Definition, iface string) bool {
+	if typ == nil {
+		return false
+	}
+	for _, i := range typ.Interfaces {
+		if i == iface {
+			return true
+		}
+	}
+	return false
+}
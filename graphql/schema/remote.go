@@ -41,6 +41,11 @@ func validateUrl(rawURL string) error {
 	return nil
 }
 
+// introspectRemote fetches the introspection of the remote GraphQL API at url.  Processing a
+// schema only reaches remote APIs through it, so it can be swapped for something that doesn't
+// need the network.
+var introspectRemote = introspectRemoteSchema
+
 // introspectRemoteSchema introspectes remote schema
 func introspectRemoteSchema(url string, headers http.Header) (*introspectedSchema, error) {
 	if err := validateUrl(url); err != nil {
@@ -182,12 +187,39 @@ type remoteGraphqlMetadata struct {
 	graphqlOpDef *ast.OperationDefinition
 	// isBatch tells whether it is SINGLE/BATCH mode for resolving custom fields
 	isBatch bool
+	// hasVarsTmpl tells whether the variables for the operation are built from a body template,
+	// which is possible only in SINGLE mode
+	hasVarsTmpl bool
 	// url is the url of remote graphql endpoint
 	url string
 	// headers sent to the remote graphql endpoint for introspection
 	headers http.Header
 	// schema given by the user.
 	schema *ast.Schema
+	// requiredArgs is set by validateRemoteGraphql to the non-null arguments of the remote
+	// query or mutation.
+	requiredArgs []string
+}
+
+// requiredRemoteArgs is the mapping of typeName -> fieldName -> remote query name -> the
+// non-null arguments of that remote query or mutation, for the @custom graphql fields whose
+// remote schema was introspected when the schema was validated.
+type requiredRemoteArgs map[string]map[string]map[string][]string
+
+// add records args as the required arguments of the remote query of field in typ.  It does
+// nothing to a nil requiredRemoteArgs, as is the case when the @custom directive is validated
+// outside of postGQLValidation.
+func (r requiredRemoteArgs) add(typ, field, remoteQuery string, args []string) {
+	if r == nil {
+		return
+	}
+	if r[typ] == nil {
+		r[typ] = make(map[string]map[string][]string)
+	}
+	if r[typ][field] == nil {
+		r[typ][field] = make(map[string][]string)
+	}
+	r[typ][field][remoteQuery] = args
 }
 
 // argMatchingMetadata represents all the info needed for the purpose of matching the argument
@@ -226,7 +258,7 @@ type remoteArgMetadata struct {
 // validates the graphql given in @custom->http->graphql by introspecting remote schema.
 // It assumes that the graphql syntax is correct, only remote validation is needed.
 func validateRemoteGraphql(metadata *remoteGraphqlMetadata) error {
-	remoteIntrospection, err := introspectRemoteSchema(metadata.url, metadata.headers)
+	remoteIntrospection, err := introspectRemote(metadata.url, metadata.headers)
 	if err != nil {
 		return err
 	}
@@ -292,7 +324,16 @@ func validateRemoteGraphql(metadata *remoteGraphqlMetadata) error {
 
 	givenQryArgVals := getGivenQueryArgValsAsMap(givenQuery)
 	givenQryVarTypes := getVarTypesAsMap(metadata.parentField, metadata.parentType)
+	if metadata.hasVarsTmpl {
+		// the values for variables in the template have already been validated against the
+		// variable definitions, so the types of the variables are what get sent to remote.
+		givenQryVarTypes = make(map[string]*ast.Type)
+		for _, vd := range metadata.graphqlOpDef.VariableDefinitions {
+			givenQryVarTypes[vd.Variable] = vd.Type
+		}
+	}
 	remoteQryArgMetadata := getRemoteQueryArgMetadata(introspectedRemoteQuery)
+	metadata.requiredArgs = remoteQryArgMetadata.requiredArgs
 
 	// verify remote query arg format for BATCH mode
 	if metadata.isBatch {
@@ -666,13 +707,16 @@ type introspectionQueryType struct {
 	Name string `json:"name"`
 }
 type types struct {
-	Kind          string        `json:"kind"`
-	Name          string        `json:"name"`
-	Fields        []*gqlField   `json:"fields"`
-	InputFields   []*gqlField   `json:"inputFields"`
-	Interfaces    []interface{} `json:"interfaces"`
-	EnumValues    interface{}   `json:"enumValues"`
-	PossibleTypes interface{}   `json:"possibleTypes"`
+	Kind          string                    `json:"kind"`
+	Name          string                    `json:"name"`
+	Fields        []*gqlField               `json:"fields"`
+	InputFields   []*gqlField               `json:"inputFields"`
+	Interfaces    []*gqlType                `json:"interfaces"`
+	EnumValues    []*introspectionEnumValue `json:"enumValues"`
+	PossibleTypes interface{}               `json:"possibleTypes"`
+}
+type introspectionEnumValue struct {
+	Name string `json:"name"`
 }
 type directive struct {
 	Name      string   `json:"name"`
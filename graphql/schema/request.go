@@ -17,11 +17,16 @@
 package schema
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
 
 	"github.com/pkg/errors"
 
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 	"github.com/vektah/gqlparser/v2/parser"
 	"github.com/vektah/gqlparser/v2/validator"
 )
@@ -34,6 +39,29 @@ type Request struct {
 	Variables     map[string]interface{} `json:"variables"`
 
 	Header http.Header
+	// Lenient reports unused variables and fragments as warnings, rather than rejecting
+	// the request, for clients that can't yet fix their legacy documents.
+	Lenient bool `json:"-"`
+	// MaxDepth, if more than 0, is how deep the selection sets of the operation can be nested.
+	// The top level fields of an operation are at depth 1.
+	MaxDepth int `json:"-"`
+	// Namespace is the namespace whose schema a Registry resolves the operation against.
+	Namespace string `json:"-"`
+}
+
+const (
+	// readOnlyHeader lets a request ask for its operation to be run in a read-only
+	// transaction.  The only value accepted is bestEffortReadOnly, which doesn't need a
+	// timestamp from Zero and so can read slightly stale data.
+	readOnlyHeader     = "X-Dgraph-ReadOnly"
+	bestEffortReadOnly = "best-effort"
+)
+
+// lenientRules are the validation rules whose violations don't stop an operation from
+// being run, so a Lenient request gets them as warnings instead of errors.
+var lenientRules = map[string]bool{
+	"NoUnusedFragments": true,
+	"NoUnusedVariables": true,
 }
 
 // Operation finds the operation in req, if it is a valid request for GraphQL
@@ -50,7 +78,29 @@ func (s *schema) Operation(req *Request) (Operation, error) {
 		return nil, gqlErr
 	}
 
+	if s.caseInsensitiveEnums {
+		canonicalizeEnumLiterals(s.schema, doc)
+	}
+
+	// A deeply nested operation is rejected before it's validated, so that it doesn't cost
+	// the validation of all its fields.
+	if req.MaxDepth > 0 {
+		for _, op := range doc.Operations {
+			if req.OperationName != "" && op.Name != req.OperationName {
+				continue
+			}
+			if gqlErr := depthError(doc, op.SelectionSet, 1, req.MaxDepth,
+				make(map[fragmentDepth]bool)); gqlErr != nil {
+				return nil, gqlErr
+			}
+		}
+	}
+
 	listErr := validator.Validate(s.schema, doc)
+	var warnings gqlerror.List
+	if req.Lenient {
+		listErr, warnings = splitLenientErrors(listErr)
+	}
 	if len(listErr) != 0 {
 		return nil, listErr
 	}
@@ -66,27 +116,428 @@ func (s *schema) Operation(req *Request) (Operation, error) {
 			req.OperationName)
 	}
 
+	if gqlErr := aliasError(op.SelectionSet, s.limits.AliasLength(),
+		make(map[string]bool)); gqlErr != nil {
+		return nil, gqlErr
+	}
+
+	if s.caseInsensitiveEnums {
+		canonicalizeEnumVariables(s.schema, op, req.Variables)
+	}
+
 	vars, gqlErr := validator.VariableValues(s.schema, op, req.Variables)
 	if gqlErr != nil {
 		return nil, gqlErr
 	}
+	if gqlErr := coerceVariables(s.schema, op, vars); gqlErr != nil {
+		return nil, gqlErr
+	}
+	if gqlErr := langTagError(s.schema, doc, vars); gqlErr != nil {
+		return nil, gqlErr
+	}
+
+	readOnly := req.Header.Get(readOnlyHeader)
+	if readOnly != "" && readOnly != bestEffortReadOnly {
+		return nil, errors.Errorf("Unsupported value %s for header %s, the only supported "+
+			"value is %s.", readOnly, readOnlyHeader, bestEffortReadOnly)
+	}
+	if readOnly != "" && op.Operation == ast.Mutation {
+		return nil, errors.Errorf("Mutations can't be run in a %s read-only request.",
+			bestEffortReadOnly)
+	}
 
 	operation := &operation{op: op,
-		vars:     vars,
-		query:    req.Query,
-		header:   req.Header,
-		doc:      doc,
-		inSchema: s,
+		vars:       vars,
+		query:      req.Query,
+		header:     req.Header,
+		doc:        doc,
+		inSchema:   s,
+		warnings:   warnings,
+		bestEffort: readOnly == bestEffortReadOnly,
 	}
 
 	// recursively expand fragments in operation as selection set fields
 	for _, s := range op.SelectionSet {
-		recursivelyExpandFragmentSelections(s.(*ast.Field), operation)
+		if gqlErr := recursivelyExpandFragmentSelections(s.(*ast.Field), operation); gqlErr != nil {
+			return nil, gqlerror.List{gqlErr}
+		}
+	}
+
+	if s.relayIDs {
+		if err := checkRelayIDs(s, op.SelectionSet, vars); err != nil {
+			return nil, err
+		}
 	}
 
 	return operation, nil
 }
 
+// canonicalizeEnumLiterals replaces each enum value in doc that matches a value of an enum with
+// @enum(caseInsensitive: true) only when case is ignored, with the declared value.  It runs
+// before validation, which would otherwise reject the value.
+func canonicalizeEnumLiterals(sch *ast.Schema, doc *ast.QueryDocument) {
+	observers := &validator.Events{}
+	observers.OnValue(func(walker *validator.Walker, value *ast.Value) {
+		if value.Kind != ast.EnumValue || value.Definition == nil {
+			return
+		}
+		if ev, ok := enumValue(value.Definition, value.Raw); ok {
+			value.Raw = ev
+		}
+	})
+	validator.Walk(sch, doc, observers)
+}
+
+// canonicalizeEnumVariables is like canonicalizeEnumLiterals, but for the values given for the
+// variables of op.
+func canonicalizeEnumVariables(sch *ast.Schema, op *ast.OperationDefinition,
+	vars map[string]interface{}) {
+	for _, v := range op.VariableDefinitions {
+		if val, ok := vars[v.Variable]; ok {
+			vars[v.Variable] = canonicalizeEnumValue(sch, v.Type, val)
+		}
+	}
+}
+
+func canonicalizeEnumValue(sch *ast.Schema, typ *ast.Type, val interface{}) interface{} {
+	if typ.Elem != nil {
+		list, ok := val.([]interface{})
+		if !ok {
+			// A single value is accepted for a list, as a list of one.
+			return canonicalizeEnumValue(sch, typ.Elem, val)
+		}
+		for i, v := range list {
+			list[i] = canonicalizeEnumValue(sch, typ.Elem, v)
+		}
+		return list
+	}
+
+	def := sch.Types[typ.NamedType]
+	if def == nil {
+		return val
+	}
+	switch def.Kind {
+	case ast.Enum:
+		if str, ok := val.(string); ok {
+			if ev, ok := enumValue(def, str); ok {
+				return ev
+			}
+		}
+	case ast.InputObject:
+		if obj, ok := val.(map[string]interface{}); ok {
+			for _, fld := range def.Fields {
+				if v, ok := obj[fld.Name]; ok {
+					obj[fld.Name] = canonicalizeEnumValue(sch, fld.Type, v)
+				}
+			}
+		}
+	}
+	return val
+}
+
+// coerceVariables coerces the values given for the variables of op into the values the same
+// input would have as literals, so that the resolvers are given the same arguments either way.
+// A single value given for a list is a list of one, Ints are int64, Floats are float64 and IDs
+// are strings.  Keys of input objects that aren't fields of their type, and values of enums
+// that aren't declared, are errors.
+func coerceVariables(sch *ast.Schema, op *ast.OperationDefinition,
+	vars map[string]interface{}) *gqlerror.Error {
+	for _, v := range op.VariableDefinitions {
+		val, ok := vars[v.Variable]
+		if !ok {
+			continue
+		}
+		path := ast.Path{ast.PathName("variable"), ast.PathName(v.Variable)}
+		coerced, err := coerceInputValue(sch, v.Type, val, path)
+		if err != nil {
+			return err
+		}
+		vars[v.Variable] = coerced
+	}
+	return nil
+}
+
+func coerceInputValue(sch *ast.Schema, typ *ast.Type, val interface{}, path ast.Path) (
+	interface{}, *gqlerror.Error) {
+
+	if val == nil {
+		return nil, nil
+	}
+
+	if typ.Elem != nil {
+		list, ok := val.([]interface{})
+		if !ok {
+			// A single value is accepted for a list, as a list of one.
+			list = []interface{}{val}
+		}
+		coerced := make([]interface{}, len(list))
+		for i, v := range list {
+			var err *gqlerror.Error
+			coerced[i], err = coerceInputValue(sch, typ.Elem, v, appendPath(path, ast.PathIndex(i)))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	}
+
+	def := sch.Types[typ.NamedType]
+	if def == nil {
+		return val, nil
+	}
+	switch def.Kind {
+	case ast.Scalar:
+		return coerceScalarValue(def.Name, val, path)
+	case ast.Enum:
+		if str, ok := val.(string); !ok || def.EnumValues.ForName(str) == nil {
+			return nil, gqlerror.ErrorPathf(path, "%v is not a value of enum %s", val,
+				def.Name)
+		}
+	case ast.InputObject:
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, gqlerror.ErrorPathf(path, "%s must be an object", def.Name)
+		}
+		if def.Name == langValueType {
+			if lang, ok := obj[langArg].(string); ok && !isLangTag(lang) {
+				return nil, gqlerror.ErrorPathf(appendPath(path, ast.PathName(langArg)),
+					"%q is not a language tag", lang)
+			}
+		}
+		coerced := make(map[string]interface{}, len(obj))
+		for name, v := range obj {
+			fld := def.Fields.ForName(name)
+			if fld == nil {
+				return nil, gqlerror.ErrorPathf(appendPath(path, ast.PathName(name)),
+					"%s is not a field of %s", name, def.Name)
+			}
+			var err *gqlerror.Error
+			coerced[name], err = coerceInputValue(sch, fld.Type, v,
+				appendPath(path, ast.PathName(name)))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	}
+	return val, nil
+}
+
+// langTagRegex matches the language tags that the values of a @lang field can have, like en or
+// zh-Hant-TW.  The tags are written into the Dgraph query and mutation as they are, so nothing
+// else can be allowed.
+var langTagRegex = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// isLangTag reports whether lang is a language tag, or ".", which stands for whichever value
+// the predicate has.
+func isLangTag(lang string) bool {
+	return lang == "." || langTagRegex.MatchString(lang)
+}
+
+// langTagError returns an error for the first value in doc that isn't a language tag, given for
+// the lang argument of a @lang field or as the lang of a LangValue.  Values given in variables
+// of a LangValue type are checked as the variables are coerced.
+func langTagError(sch *ast.Schema, doc *ast.QueryDocument,
+	vars map[string]interface{}) *gqlerror.Error {
+
+	var gqlErr *gqlerror.Error
+	check := func(val interface{}, pos *ast.Position) {
+		if lang, ok := val.(string); ok && gqlErr == nil && !isLangTag(lang) {
+			gqlErr = gqlerror.ErrorPosf(pos, "%q is not a language tag", lang)
+		}
+	}
+
+	observers := &validator.Events{}
+	observers.OnField(func(walker *validator.Walker, field *ast.Field) {
+		if field.Definition == nil || !hasLangDirective(field.Definition) {
+			return
+		}
+		arg := field.Arguments.ForName(langArg)
+		if arg == nil {
+			return
+		}
+		val, _ := arg.Value.Value(vars)
+		switch langs := val.(type) {
+		case []interface{}:
+			for _, lang := range langs {
+				check(lang, arg.Position)
+			}
+		default:
+			check(langs, arg.Position)
+		}
+	})
+	observers.OnValue(func(walker *validator.Walker, value *ast.Value) {
+		if value.Kind != ast.ObjectValue || value.Definition == nil ||
+			value.Definition.Name != langValueType {
+			return
+		}
+		obj, _ := value.Value(vars)
+		if obj, ok := obj.(map[string]interface{}); ok {
+			check(obj[langArg], value.Position)
+		}
+	})
+	validator.Walk(sch, doc, observers)
+	return gqlErr
+}
+
+// coerceScalarValue coerces val, a value of the scalar typName that was decoded from JSON,
+// either as a float64 or as a json.Number, into the value a literal of typName has.
+func coerceScalarValue(typName string, val interface{}, path ast.Path) (
+	interface{}, *gqlerror.Error) {
+
+	var num string
+	switch v := val.(type) {
+	case json.Number:
+		num = v.String()
+	case float64:
+		num = strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		num = strconv.Itoa(v)
+	default:
+		return val, nil
+	}
+
+	switch typName {
+	case "Int":
+		i, err := strconv.ParseInt(num, 10, 32)
+		if err != nil {
+			return nil, gqlerror.ErrorPathf(path, "%s is not an Int", num)
+		}
+		return i, nil
+	case "Float":
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return nil, gqlerror.ErrorPathf(path, "%s is not a Float", num)
+		}
+		return f, nil
+	case IDType:
+		if _, err := strconv.ParseInt(num, 10, 64); err != nil {
+			return nil, gqlerror.ErrorPathf(path, "%s is not an ID", num)
+		}
+		return num, nil
+	}
+	return val, nil
+}
+
+// appendPath returns path with elem appended, without sharing the backing array of path, which
+// is shared by the paths of the values next to each other.
+func appendPath(path ast.Path, elem ast.PathElement) ast.Path {
+	return append(path[:len(path):len(path)], elem)
+}
+
+// A fragmentDepth is a fragment of an operation, spread where its fields are at depth.
+type fragmentDepth struct {
+	name  string
+	depth int
+}
+
+// depthError returns an error for the first field in set that's nested deeper than maxDepth,
+// where the fields of set are at depth, or nil if there's no such field.  Fragments don't make
+// an operation any deeper, only the fields in them do.
+//
+// The operation isn't validated yet, so the fragments are found by name in doc, and might not
+// exist or might spread each other in a cycle.  checked has the fragments that have been
+// checked at a depth already, so that each is walked only once however often it's spread, and
+// a cycle ends.  Validation then rejects any missing fragments and cycles.
+func depthError(doc *ast.QueryDocument, set ast.SelectionSet, depth, maxDepth int,
+	checked map[fragmentDepth]bool) *gqlerror.Error {
+
+	for _, sel := range set {
+		var err *gqlerror.Error
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if depth > maxDepth {
+				return gqlerror.ErrorPosf(sel.Position, "Field %s is at depth %d, but "+
+					"operations can only be nested %d deep.", sel.Name, depth, maxDepth)
+			}
+			err = depthError(doc, sel.SelectionSet, depth+1, maxDepth, checked)
+		case *ast.FragmentSpread:
+			frag := doc.Fragments.ForName(sel.Name)
+			key := fragmentDepth{name: sel.Name, depth: depth}
+			if frag != nil && !checked[key] {
+				checked[key] = true
+				err = depthError(doc, frag.SelectionSet, depth, maxDepth, checked)
+			}
+		case *ast.InlineFragment:
+			err = depthError(doc, sel.SelectionSet, depth, maxDepth, checked)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reservedAliases are the names that the rewriting of an operation gives to the blocks and
+// variables of its Dgraph query, so a field can't be given them as an alias.  The names that
+// rewriting makes up itself, like the TypeN variables, come from the schema and never from an
+// alias, so they can't be mistaken for one.
+var reservedAliases = map[string]bool{
+	"uid":         true,
+	"dgraph.type": true,
+	"dgraph.uid":  true,
+	"var":         true,
+	"checkPwd":    true,
+	"pwd":         true,
+}
+
+// aliasError returns an error for the first field in set that has an alias that's longer than
+// maxLength, or that's one of reservedAliases.  Each named fragment is only checked the first
+// time it's spread, visited holds the ones already checked.  It returns nil if there's no such
+// field.
+func aliasError(set ast.SelectionSet, maxLength int, visited map[string]bool) *gqlerror.Error {
+	for _, sel := range set {
+		var err *gqlerror.Error
+		switch sel := sel.(type) {
+		case *ast.Field:
+			// The parser makes the alias of a field without one its name.
+			if sel.Alias != sel.Name {
+				if err = checkAlias(sel, maxLength); err != nil {
+					return err
+				}
+			}
+			err = aliasError(sel.SelectionSet, maxLength, visited)
+		case *ast.FragmentSpread:
+			if sel.Definition != nil && !visited[sel.Name] {
+				visited[sel.Name] = true
+				err = aliasError(sel.Definition.SelectionSet, maxLength, visited)
+			}
+		case *ast.InlineFragment:
+			err = aliasError(sel.SelectionSet, maxLength, visited)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkAlias(fld *ast.Field, maxLength int) *gqlerror.Error {
+	if len(fld.Alias) > maxLength {
+		return gqlerror.ErrorPosf(fld.Position, "Alias of field %s is %d characters long, but "+
+			"aliases can only be %d characters long.", fld.Name, len(fld.Alias), maxLength)
+	}
+	if reservedAliases[fld.Alias] {
+		return gqlerror.ErrorPosf(fld.Position, "Alias %s of field %s is reserved for Dgraph's "+
+			"own use, use another alias.", fld.Alias, fld.Name)
+	}
+	return nil
+}
+
+// splitLenientErrors splits errs into those that must still fail the request and those that
+// can be reported as warnings.
+func splitLenientErrors(errs gqlerror.List) (gqlerror.List, gqlerror.List) {
+	var failures, warnings gqlerror.List
+	for _, err := range errs {
+		if lenientRules[err.Rule] {
+			warnings = append(warnings, err)
+		} else {
+			failures = append(failures, err)
+		}
+	}
+	return failures, warnings
+}
+
 // recursivelyExpandFragmentSelections puts a fragment's selection set directly inside this
 // field's selection set, and does it recursively for all the fields in this field's selection
 // set. This eventually expands all the fragment references anywhere in the hierarchy.
@@ -126,7 +577,10 @@ func (s *schema) Operation(req *Request) (Operation, error) {
 //    which are implemented by Human type should also be expanded. That means, any fragments on
 //    Human, Character and Employee will be expanded in the result of queryHuman.
 // 3. field returns a Union: process is similar to the case when field returns an interface.
-func recursivelyExpandFragmentSelections(field *ast.Field, op *operation) {
+//
+// Fields with the same response name are then merged into one, see mergeFields, so it's an
+// error for them to be different fields or to have different arguments.
+func recursivelyExpandFragmentSelections(field *ast.Field, op *operation) *gqlerror.Error {
 	// This happens in case of introspection queries, as they don't have any types in graphql schema
 	// but explicit resolvers defined. So, when the parser parses the raw request, it is not able to
 	// find a definition for such fields in the schema. Introspection queries are already handling
@@ -134,7 +588,7 @@ func recursivelyExpandFragmentSelections(field *ast.Field, op *operation) {
 	// associated types for them in graphql schema, then it needs to handle fragment expansion by
 	// itself.
 	if field.Definition == nil {
-		return
+		return nil
 	}
 
 	// Find all valid type names that this field satisfies
@@ -157,21 +611,21 @@ func recursivelyExpandFragmentSelections(field *ast.Field, op *operation) {
 		additionalTypes = op.inSchema.schema.Implements[typeName]
 	default:
 		// return, as fragment can't be present on a field which is not Interface, Union or Object
-		return
+		return nil
 	}
 	for _, typ := range additionalTypes {
 		satisfies = append(satisfies, typ.Name)
 	}
 
 	// collect all fields from any satisfying fragments into selectionSet
-	collectedFields := collectFields(&requestContext{
-		RawQuery:  op.query,
-		Variables: op.vars,
-		Doc:       op.doc,
-	}, field.SelectionSet, satisfies)
-	field.SelectionSet = make([]ast.Selection, 0, len(collectedFields))
-	for _, collectedField := range collectedFields {
-		field.SelectionSet = append(field.SelectionSet, collectedField.Field)
+	collected := collectSelections(field.SelectionSet, satisfies, op.vars, make(map[string]bool))
+	merged, gqlErr := mergeFields(op.inSchema.schema, collected, typeKind == ast.Object)
+	if gqlErr != nil {
+		return gqlErr
+	}
+	field.SelectionSet = make([]ast.Selection, 0, len(merged))
+	for _, f := range merged {
+		field.SelectionSet = append(field.SelectionSet, f)
 	}
 
 	// It helps when __typename is requested for an Object in a fragment on Interface, so we don't
@@ -202,6 +656,173 @@ func recursivelyExpandFragmentSelections(field *ast.Field, op *operation) {
 
 	// recursively run for this field's selectionSet
 	for _, f := range field.SelectionSet {
-		recursivelyExpandFragmentSelections(f.(*ast.Field), op)
+		if gqlErr := recursivelyExpandFragmentSelections(f.(*ast.Field), op); gqlErr != nil {
+			return gqlErr
+		}
+	}
+	return nil
+}
+
+// collectSelections returns the fields in sels, with the fragments on the types in satisfies
+// expanded into the fields they select, in the order they are selected.  A named fragment is
+// only expanded the first time it's spread.  What @skip or @include leave out isn't collected.
+func collectSelections(sels ast.SelectionSet, satisfies []string, vars map[string]interface{},
+	visited map[string]bool) []*ast.Field {
+
+	var flds []*ast.Field
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if includeSelection(sel.Directives, vars) {
+				flds = append(flds, sel)
+			}
+		case *ast.InlineFragment:
+			if includeSelection(sel.Directives, vars) && satisfiesType(sel.TypeCondition, satisfies) {
+				flds = append(flds, collectSelections(sel.SelectionSet, satisfies, vars, visited)...)
+			}
+		case *ast.FragmentSpread:
+			if visited[sel.Name] || sel.Definition == nil ||
+				!includeSelection(sel.Directives, vars) {
+				continue
+			}
+			visited[sel.Name] = true
+			if satisfiesType(sel.Definition.TypeCondition, satisfies) {
+				flds = append(flds,
+					collectSelections(sel.Definition.SelectionSet, satisfies, vars, visited)...)
+			}
+		}
+	}
+	return flds
+}
+
+func includeSelection(dirs ast.DirectiveList, vars map[string]interface{}) bool {
+	if skip := dirs.ForName("skip"); skip != nil && skip.ArgumentMap(vars)["if"] == true {
+		return false
+	}
+	if include := dirs.ForName("include"); include != nil {
+		return include.ArgumentMap(vars)["if"] == true
+	}
+	return true
+}
+
+func satisfiesType(typeCondition string, satisfies []string) bool {
+	for _, s := range satisfies {
+		if s == typeCondition {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeFields merges the fields in flds that have the same response name into one field, whose
+// selection set has the selections of all of them, the way GraphQL's CollectFields does.  The
+// rewriters then only see one field for each response name.  Aliased fields are only merged with
+// the fields that have the same alias.
+//
+// Fields of different object types don't both apply to any node, so when the selection set is of
+// an interface or union, fields of the same response name that are on different object types stay
+// apart.  A field on an interface or union applies to the nodes of all its types, so the fields
+// on those types are merged into it.  This means a field that's selected both on the interface
+// and in a fragment on one of its types gets the sub-selections of the fragment for every type.
+//
+// It's an error for fields that are merged to be different fields, have different arguments or
+// return different types.
+func mergeFields(sch *ast.Schema, flds []*ast.Field, onObject bool) ([]*ast.Field,
+	*gqlerror.Error) {
+
+	var names []string
+	groups := make(map[string][]*ast.Field)
+	for _, f := range flds {
+		name := responseName(f)
+		if len(groups[name]) == 0 {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], f)
+	}
+
+	isAbstract := func(f *ast.Field) bool {
+		return f.ObjectDefinition == nil || sch.Types[f.ObjectDefinition.Name].Kind != ast.Object
+	}
+
+	merged := make([]*ast.Field, 0, len(names))
+	for _, name := range names {
+		group := groups[name]
+		if len(group) == 1 {
+			merged = append(merged, group[0])
+			continue
+		}
+
+		// The fields are merged by their object type, unless any of them apply to every type.
+		var keys []string
+		byType := make(map[string][]*ast.Field)
+		allTypes := onObject
+		for _, f := range group {
+			allTypes = allTypes || isAbstract(f)
+		}
+		for _, f := range group {
+			key := ""
+			if !allTypes {
+				key = f.ObjectDefinition.Name
+			}
+			if len(byType[key]) == 0 {
+				keys = append(keys, key)
+			}
+			byType[key] = append(byType[key], f)
+		}
+
+		for _, key := range keys {
+			same := byType[key]
+			fld := *same[0]
+			fld.SelectionSet = nil
+			for _, f := range same {
+				if gqlErr := fieldConflict(name, &fld, f); gqlErr != nil {
+					return nil, gqlErr
+				}
+				if isAbstract(f) {
+					fld.ObjectDefinition = f.ObjectDefinition
+				}
+				fld.SelectionSet = append(fld.SelectionSet, f.SelectionSet...)
+			}
+			merged = append(merged, &fld)
+		}
+	}
+	return merged, nil
+}
+
+// fieldConflict returns an error if f can't be merged into fld, which has the response name.
+func fieldConflict(name string, fld, f *ast.Field) *gqlerror.Error {
+	var reason string
+	switch {
+	case fld.Name != f.Name:
+		reason = fmt.Sprintf("%s and %s are different fields", fld.Name, f.Name)
+	case !sameArguments(fld.Arguments, f.Arguments):
+		reason = "they have differing arguments"
+	case fld.Definition != nil && f.Definition != nil &&
+		fld.Definition.Type.String() != f.Definition.Type.String():
+		reason = fmt.Sprintf("they return conflicting types %s and %s", fld.Definition.Type,
+			f.Definition.Type)
+	default:
+		return nil
+	}
+	return &gqlerror.Error{
+		Message: fmt.Sprintf("Fields \"%s\" conflict because %s. Use different aliases on the "+
+			"fields to fetch both if this was intentional.", name, reason),
+		Locations: []gqlerror.Location{
+			{Line: fld.Position.Line, Column: fld.Position.Column},
+			{Line: f.Position.Line, Column: f.Position.Column},
+		},
+	}
+}
+
+func sameArguments(args1, args2 ast.ArgumentList) bool {
+	if len(args1) != len(args2) {
+		return false
+	}
+	for _, arg := range args1 {
+		other := args2.ForName(arg.Name)
+		if other == nil || other.Value.String() != arg.Value.String() {
+			return false
+		}
 	}
+	return true
 }
@@ -153,8 +153,9 @@ func (r *Response) Output() interface{} {
 
 // Extensions represents GraphQL extensions
 type Extensions struct {
-	TouchedUids uint64 `json:"touched_uids,omitempty"`
-	Tracing     *Trace `json:"tracing,omitempty"`
+	TouchedUids uint64         `json:"touched_uids,omitempty"`
+	Tracing     *Trace         `json:"tracing,omitempty"`
+	Warnings    x.GqlErrorList `json:"warnings,omitempty"`
 }
 
 // GetTouchedUids returns TouchedUids
@@ -172,6 +173,7 @@ func (e *Extensions) Merge(ext *Extensions) {
 	}
 
 	e.TouchedUids += ext.TouchedUids
+	e.Warnings = append(e.Warnings, ext.Warnings...)
 
 	if e.Tracing == nil {
 		e.Tracing = ext.Tracing
@@ -18,6 +18,7 @@ package schema
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"sort"
@@ -33,15 +34,17 @@ import (
 
 func init() {
 	schemaDocValidations = append(schemaDocValidations, inputTypeNameValidation,
-		customQueryNameValidation, customMutationNameValidation)
+		customQueryNameValidation, customMutationNameValidation, unionMemberTypeValidation)
 	defnValidations = append(defnValidations, dataTypeCheck, nameCheck)
 
-	schemaValidations = append(schemaValidations, dgraphDirectivePredicateValidation)
+	schemaValidations = append(schemaValidations, dgraphDirectivePredicateValidation,
+		nonNullCycleValidation)
 	typeValidations = append(typeValidations, idCountCheck, dgraphDirectiveTypeValidation,
 		passwordDirectiveValidation, conflictingDirectiveValidation, nonIdFieldsCheck,
-		remoteTypeValidation)
+		remoteTypeValidation, unionMemberValidation, unionFieldValidation, enumCaseValidation,
+		generatedTypeValidation, ttlDirectiveValidation, softDeleteDirectiveValidation)
 	fieldValidations = append(fieldValidations, listValidityCheck, fieldArgumentCheck,
-		fieldNameCheck, isValidFieldForList, hasAuthDirective)
+		fieldNameCheck, isValidFieldForList)
 
 	validator.AddRule("Check variable type is correct", variableTypeCheck)
 	validator.AddRule("Check for list type value", listTypeCheck)
@@ -172,6 +175,7 @@ func dgraphDirectivePredicateValidation(gqlSch *ast.Schema, definitions []string
 				checkConflictingFieldsInImplementedInterfacesError(def)
 			}
 
+			parents := parentInterfaces(gqlSch, def)
 			for _, f := range def.Fields {
 				if f.Type.Name() == "ID" {
 					continue
@@ -181,7 +185,7 @@ func dgraphDirectivePredicateValidation(gqlSch *ast.Schema, definitions []string
 				// this field could have originally been defined in an interface that this type
 				// implements. If we get a parent interface, that means this field gets validated
 				// during the validation of that interface. So, no need to validate this field here.
-				if parentInterface(gqlSch, def, f.Name) == nil {
+				if parents[f.Name] == nil {
 					if def.Kind == ast.Interface {
 						interfacePreds[def.Name][fname] = true
 					}
@@ -255,6 +259,159 @@ func dgraphDirectivePredicateValidation(gqlSch *ast.Schema, definitions []string
 	return errs
 }
 
+// nonNullCycleValidation finds cycles of non-nullable, non-list fields between types, like
+//
+//   type A { b: B! }
+//   type B { a: A! }
+//
+// Adding an A needs a B to exist, and adding a B needs an A to exist, so no data can ever be
+// added for such types.  A nullable or list field anywhere on the cycle breaks it.
+//
+// A field of interface type needs a node of one of the types implementing the interface, so
+// an interface only takes part in a cycle if none of its implementations can be added.
+func nonNullCycleValidation(gqlSch *ast.Schema, definitions []string) gqlerror.List {
+	var errs []*gqlerror.Error
+
+	order := make(map[string]int)
+	for i, def := range definitions {
+		typ := gqlSch.Types[def]
+		if (typ.Kind == ast.Object || typ.Kind == ast.Interface) && !isQueryOrMutation(def) &&
+			typ.Directives.ForName(remoteDirective) == nil {
+			order[def] = i
+		}
+	}
+
+	// requiredFields are the fields of typ that need a node to already exist to add a typ.
+	requiredFields := func(typ *ast.Definition) []*ast.FieldDefinition {
+		var flds []*ast.FieldDefinition
+		for _, fld := range typ.Fields {
+			if _, ok := order[fld.Type.Name()]; !ok || !fld.Type.NonNull || fld.Type.Elem != nil ||
+				fld.Directives.ForName(customDirective) != nil {
+				continue
+			}
+			flds = append(flds, fld)
+		}
+		return flds
+	}
+
+	// Work out which types can have data added, starting from those with no required fields,
+	// until nothing more changes.  Whatever is left is stuck on some cycle.
+	canAdd := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, def := range definitions {
+			if _, ok := order[def]; !ok || canAdd[def] {
+				continue
+			}
+			typ := gqlSch.Types[def]
+			if typ.Kind == ast.Interface {
+				for _, impl := range gqlSch.PossibleTypes[def] {
+					canAdd[def] = canAdd[def] || canAdd[impl.Name]
+				}
+			} else {
+				canAdd[def] = true
+				for _, fld := range requiredFields(typ) {
+					canAdd[def] = canAdd[def] && canAdd[fld.Type.Name()]
+				}
+			}
+			changed = changed || canAdd[def]
+		}
+	}
+
+	next := func(typ *ast.Definition) []cycleStep {
+		var steps []cycleStep
+		if typ.Kind == ast.Interface {
+			for _, impl := range gqlSch.PossibleTypes[typ.Name] {
+				if _, ok := order[impl.Name]; ok {
+					steps = append(steps, cycleStep{typ: impl})
+				}
+			}
+			return steps
+		}
+		for _, fld := range requiredFields(typ) {
+			steps = append(steps, cycleStep{typ: gqlSch.Types[fld.Type.Name()], fld: fld})
+		}
+		return steps
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []cycleStep
+	var visit func(typ *ast.Definition)
+	visit = func(typ *ast.Definition) {
+		state[typ.Name] = visiting
+		for _, nxt := range next(typ) {
+			if canAdd[nxt.typ.Name] {
+				continue
+			}
+			path = append(path, cycleStep{typ: typ, fld: nxt.fld})
+			switch state[nxt.typ.Name] {
+			case unvisited:
+				visit(nxt.typ)
+			case visiting:
+				errs = append(errs, nonNullCycleError(cycleFrom(path, nxt.typ.Name, order)))
+			}
+			path = path[:len(path)-1]
+		}
+		state[typ.Name] = visited
+	}
+
+	for _, def := range definitions {
+		if _, ok := order[def]; ok && !canAdd[def] && state[def] == unvisited {
+			visit(gqlSch.Types[def])
+		}
+	}
+
+	return errs
+}
+
+// A cycleStep is an object type on a cycle and the field that leads out of it, or an interface
+// on a cycle, which leads to its implementations.
+type cycleStep struct {
+	typ *ast.Definition
+	fld *ast.FieldDefinition
+}
+
+// cycleFrom cuts the cycle that goes back to type start out of path, and rotates it to begin
+// at its first object type in order, so the same cycle is always reported the same way.
+func cycleFrom(path []cycleStep, start string, order map[string]int) []cycleStep {
+	i := len(path) - 1
+	for path[i].typ.Name != start {
+		i--
+	}
+	cycle := path[i:]
+
+	first := -1
+	for j, s := range cycle {
+		if s.fld != nil && (first < 0 || order[s.typ.Name] < order[cycle[first].typ.Name]) {
+			first = j
+		}
+	}
+	return append(append([]cycleStep{}, cycle[first:]...), cycle[:first]...)
+}
+
+func nonNullCycleError(cycle []cycleStep) *gqlerror.Error {
+	var sb strings.Builder
+	for _, s := range cycle {
+		if s.fld != nil {
+			fmt.Fprintf(&sb, "%s.%s -> ", s.typ.Name, s.fld.Name)
+		} else {
+			fmt.Fprintf(&sb, "%s -> ", s.typ.Name)
+		}
+	}
+	sb.WriteString(cycle[0].typ.Name)
+
+	return gqlerror.ErrorPosf(cycle[0].fld.Position,
+		"Type %s; Field %s: is on a cycle of non-nullable fields (%s), so data can never be "+
+			"added for the types on the cycle, because each needs another to exist first.  "+
+			"Make one of the fields on the cycle nullable, or a list, to break the cycle.",
+		cycle[0].typ.Name, cycle[0].fld.Name, sb.String())
+}
+
 func inputTypeNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 	var errs []*gqlerror.Error
 	forbiddenInputTypeNames := map[string]bool{
@@ -266,12 +423,14 @@ func inputTypeNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 		"CustomGraphQL":        true,
 		"IntFilter":            true,
 		"FloatFilter":          true,
+		"FloatRange":           true,
 		"DateTimeFilter":       true,
 		"StringTermFilter":     true,
 		"StringRegExpFilter":   true,
 		"StringFullTextFilter": true,
 		"StringExactFilter":    true,
 		"StringHashFilter":     true,
+		"PresenceFilter":       true,
 	}
 	definedInputTypes := make([]*ast.Definition, 0)
 
@@ -303,6 +462,8 @@ func inputTypeNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 		forbiddenInputTypeNames[defName+"Filter"] = true
 		forbiddenInputTypeNames[defName+"Order"] = true
 		forbiddenInputTypeNames[defName+"Orderable"] = true
+		forbiddenInputTypeNames[defName+"PageResult"] = true
+		forbiddenInputTypeNames[defName+aggregateResultSuffix] = true
 	}
 
 	for _, inputType := range definedInputTypes {
@@ -321,12 +482,24 @@ func customQueryNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 	forbiddenNames := map[string]bool{}
 	definedQueries := make([]*ast.FieldDefinition, 0)
 
+	// The generated subscriptions have the names of the generated queries, so a custom
+	// subscription can't have those names either.
+	for _, defn := range schema.Extensions {
+		if defn.Name == "Query" || defn.Name == "Subscription" {
+			definedQueries = append(definedQueries, defn.Fields...)
+		}
+	}
+
 	for _, defn := range schema.Definitions {
 		defName := defn.Name
-		if defName == "Query" {
+		if defName == "Query" || defName == "Subscription" {
 			definedQueries = append(definedQueries, defn.Fields...)
 			continue
 		}
+		if defn.Kind == ast.Union {
+			forbiddenNames["query"+defName] = true
+			continue
+		}
 		if defn.Kind != ast.Object && defn.Kind != ast.Interface {
 			continue
 		}
@@ -335,6 +508,7 @@ func customQueryNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 		forbiddenNames["get"+defName] = true
 		forbiddenNames["check"+defName+"Password"] = true
 		forbiddenNames["query"+defName] = true
+		forbiddenNames["page"+defName] = true
 	}
 
 	for _, qry := range definedQueries {
@@ -348,11 +522,41 @@ func customQueryNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 	return errs
 }
 
+// unionMemberTypeValidation checks that all the members of each union are types defined in the
+// schema.  The GraphQL validation doesn't check the members of unions.
+func unionMemberTypeValidation(schema *ast.SchemaDocument) gqlerror.List {
+	var errs []*gqlerror.Error
+	for _, defn := range schema.Definitions {
+		if defn.Kind != ast.Union {
+			continue
+		}
+		for _, member := range defn.Types {
+			memberDefn := schema.Definitions.ForName(member)
+			switch {
+			case memberDefn == nil:
+				errs = append(errs, gqlerror.ErrorPosf(defn.Position,
+					"Union %s; member %s isn't defined in the schema.", defn.Name, member))
+			case memberDefn.Kind != ast.Object:
+				errs = append(errs, gqlerror.ErrorPosf(defn.Position,
+					"Union %s; member %s isn't a type, but the members of a union must be types.",
+					defn.Name, member))
+			}
+		}
+	}
+	return errs
+}
+
 func customMutationNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 	var errs []*gqlerror.Error
 	forbiddenNames := map[string]bool{}
 	definedMutations := make([]*ast.FieldDefinition, 0)
 
+	for _, defn := range schema.Extensions {
+		if defn.Name == "Mutation" {
+			definedMutations = append(definedMutations, defn.Fields...)
+		}
+	}
+
 	for _, defn := range schema.Definitions {
 		defName := defn.Name
 		if defName == "Mutation" {
@@ -388,13 +592,13 @@ func customMutationNameValidation(schema *ast.SchemaDocument) gqlerror.List {
 
 func dataTypeCheck(schema *ast.Schema, defn *ast.Definition) gqlerror.List {
 	if defn.Kind == ast.Object || defn.Kind == ast.Enum || defn.Kind == ast.Interface || defn.
-		Kind == ast.InputObject {
+		Kind == ast.InputObject || defn.Kind == ast.Union {
 		return nil
 	}
 	return []*gqlerror.Error{gqlerror.ErrorPosf(
 		defn.Position,
 		"You can't add %s definitions. "+
-			"Only type, interface, input and enums are allowed in initial schema.",
+			"Only type, interface, union, input and enums are allowed in initial schema.",
 		strings.ToLower(string(defn.Kind)))}
 }
 
@@ -403,20 +607,24 @@ func nameCheck(schema *ast.Schema, defn *ast.Definition) gqlerror.List {
 		var errMesg string
 
 		if isQueryOrMutationType(defn) {
+			// If we find any query or mutation field defined without a @custom directive, that
+			// is an error for us: there's nothing that could resolve it.
+			var notCustom []string
 			for _, fld := range defn.Fields {
-				// If we find any query or mutation field defined without a @custom directive, that
-				// is an error for us.
-				custom := fld.Directives.ForName(customDirective)
-				if custom == nil {
-					errMesg = "GraphQL Query and Mutation types are only allowed to have fields " +
-						"with @custom directive. Other fields are built automatically for you. " +
-						"Found " + defn.Name + " " + fld.Name + " without @custom."
-					break
+				if fld.Directives.ForName(customDirective) == nil {
+					notCustom = append(notCustom, fld.Name)
 				}
 			}
-			if errMesg == "" {
+			if len(notCustom) == 0 {
 				return nil
 			}
+			types := "Query and Mutation types are"
+			if defn.Name == "Subscription" {
+				types = "Subscription type is"
+			}
+			errMesg = "GraphQL " + types + " only allowed to have fields " +
+				"with @custom directive. Other fields are built automatically for you. " +
+				"Found " + defn.Name + " " + strings.Join(notCustom, ", ") + " without @custom."
 		} else {
 			errMesg = fmt.Sprintf(
 				"%s is a reserved word, so you can't declare a type with this name. "+
@@ -513,7 +721,29 @@ func dgraphDirectiveTypeValidation(schema *ast.Schema, typ *ast.Definition) gqle
 		return nil
 	}
 
+	includeArg := dir.Arguments.ForName(dgraphIncludeArg)
+	if includeArg != nil {
+		if typ.Kind != ast.Interface {
+			return []*gqlerror.Error{gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; includeTypes argument for @dgraph directive is only allowed on "+
+					"interfaces.", typ.Name)}
+		}
+		for _, val := range listValues(includeArg.Value) {
+			if val.Kind != ast.StringValue || val.Raw == "" {
+				return []*gqlerror.Error{gqlerror.ErrorPosf(
+					val.Position,
+					"Type %s; includeTypes argument for @dgraph directive should only have "+
+						"non-empty Dgraph type names.", typ.Name)}
+			}
+		}
+	}
+
 	typeArg := dir.Arguments.ForName(dgraphTypeArg)
+	if typeArg == nil && includeArg != nil {
+		// The interface keeps its own name as its Dgraph type.
+		return nil
+	}
 	if typeArg == nil || typeArg.Value.Raw == "" {
 		return []*gqlerror.Error{gqlerror.ErrorPosf(
 			dir.Position,
@@ -527,13 +757,94 @@ func dgraphDirectiveTypeValidation(schema *ast.Schema, typ *ast.Definition) gqle
 	return nil
 }
 
+func ttlDirectiveValidation(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
+	return dateTimeFieldValidation(typ, ttlDirective, ttlFieldArg)
+}
+
+// softDeleteDirectiveValidation checks @softDelete.  A node is soft deleted by setting the
+// field, so the nodes that aren't deleted don't have a value for it and it must be nullable.
+func softDeleteDirectiveValidation(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
+	if errs := dateTimeFieldValidation(typ, softDeleteDirective, softDeleteFieldArg); errs != nil {
+		return errs
+	}
+	dir := typ.Directives.ForName(softDeleteDirective)
+	if dir == nil {
+		return nil
+	}
+	fieldArg := dir.Arguments.ForName(softDeleteFieldArg)
+	if fld := typ.Fields.ForName(fieldArg.Value.Raw); fld.Type.NonNull {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			fieldArg.Value.Position,
+			"Type %s; Field %s: @softDelete directive needs a nullable field, the nodes that "+
+				"aren't deleted don't have a value for it.", typ.Name, fld.Name)}
+	}
+	return nil
+}
+
+// dateTimeFieldValidation checks the type directive dirName of typ, if it has one, whose
+// argument fieldArg names a DateTime field of typ that's stored in Dgraph.
+func dateTimeFieldValidation(typ *ast.Definition, dirName, fieldArgName string) gqlerror.List {
+	dir := typ.Directives.ForName(dirName)
+	if dir == nil {
+		return nil
+	}
+
+	if typ.Directives.ForName(remoteDirective) != nil {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; @%s directive can't be used on a @remote type, its nodes aren't stored "+
+				"in Dgraph.", typ.Name, dirName)}
+	}
+
+	fieldArg := dir.Arguments.ForName(fieldArgName)
+	if fieldArg == nil || fieldArg.Value == nil {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; @%s directive needs the argument %s, the name of a DateTime field of the "+
+				"type.", typ.Name, dirName, fieldArgName)}
+	}
+	fld := typ.Fields.ForName(fieldArg.Value.Raw)
+	if fld == nil {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			fieldArg.Value.Position,
+			"Type %s; field argument %s for @%s directive doesn't refer to a field of the "+
+				"type.", typ.Name, fieldArg.Value.Raw, dirName)}
+	}
+	if fld.Type.NamedType != "DateTime" {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			fieldArg.Value.Position,
+			"Type %s; Field %s: @%s directive needs a field of type DateTime, but the field "+
+				"is of type %s.", typ.Name, fld.Name, dirName, fld.Type.String())}
+	}
+	if hasCustomDirective(fld) {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			fieldArg.Value.Position,
+			"Type %s; Field %s: @%s directive can't use a field with @custom, the field must "+
+				"be stored in Dgraph.", typ.Name, fld.Name, dirName)}
+	}
+	return nil
+}
+
+// listValues returns the values of the list val, or val itself if it's a single value given
+// for a list.
+func listValues(val *ast.Value) []*ast.Value {
+	if val.Kind != ast.ListValue {
+		return []*ast.Value{val}
+	}
+	vals := make([]*ast.Value, 0, len(val.Children))
+	for _, child := range val.Children {
+		vals = append(vals, child.Value)
+	}
+	return vals
+}
+
 // A type should have other fields apart from fields of
 // 1. Type ID!
 // 2. Fields with @custom directive.
 // to be a valid type. Otherwise its not possible to add objects of that type.
 func nonIdFieldsCheck(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
 	if isQueryOrMutation(typ.Name) || typ.Kind == ast.Enum || typ.Kind == ast.Interface ||
-		typ.Kind == ast.InputObject {
+		typ.Kind == ast.InputObject || typ.Kind == ast.Union {
 		return nil
 	}
 
@@ -560,6 +871,71 @@ func nonIdFieldsCheck(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
 	return nil
 }
 
+// unionMemberValidation checks that all the members of a union are types stored in Dgraph.
+// A field of union type is stored as an edge to a node of one of the member types, and the
+// member is found from the node's dgraph.type, so the members can't be @remote types.
+func unionMemberValidation(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
+	if typ.Kind != ast.Union {
+		return nil
+	}
+
+	var errs []*gqlerror.Error
+	for _, member := range typ.Types {
+		memberDefn := schema.Types[member]
+		if memberDefn == nil || memberDefn.Directives.ForName(remoteDirective) == nil {
+			continue
+		}
+		errs = append(errs, gqlerror.ErrorPosf(typ.Position,
+			"Union %s; member %s is a @remote type, but union members must be types that are "+
+				"stored in Dgraph.", typ.Name, member))
+	}
+	return errs
+}
+
+// unionFieldValidation checks that no field of typ is a non-null union.  Mutations can't set
+// the edges of a union field, so no object of typ, or of a type that implements it, could ever
+// be added.
+func unionFieldValidation(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
+	if isQueryOrMutationType(typ) || (typ.Kind != ast.Object && typ.Kind != ast.Interface) ||
+		typ.Directives.ForName(remoteDirective) != nil {
+		return nil
+	}
+
+	var errs []*gqlerror.Error
+	for _, field := range typ.Fields {
+		if !field.Type.NonNull || schema.Types[field.Type.Name()].Kind != ast.Union ||
+			field.Directives.ForName(customDirective) != nil {
+			continue
+		}
+		errs = append(errs, gqlerror.ErrorPosf(field.Position,
+			"Type %s; Field %s: a union field can't be non-null.  Mutations can't set union "+
+				"fields, so no %s could ever be added.", typ.Name, field.Name, typ.Name))
+	}
+	return errs
+}
+
+// enumCaseValidation checks that no two values of an enum with @enum(caseInsensitive: true)
+// differ only in case, otherwise there's no telling which one a value given in another case is.
+func enumCaseValidation(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
+	if typ.Kind != ast.Enum || !isCaseInsensitiveEnum(typ) {
+		return nil
+	}
+
+	var errs []*gqlerror.Error
+	seen := make(map[string]*ast.EnumValueDefinition, len(typ.EnumValues))
+	for _, val := range typ.EnumValues {
+		folded := strings.ToLower(val.Name)
+		if prev, ok := seen[folded]; ok {
+			errs = append(errs, gqlerror.ErrorPosf(val.Position,
+				"Enum %s; values %s and %s differ only in case, but the enum has "+
+					"@enum(caseInsensitive: true).", typ.Name, prev.Name, val.Name))
+			continue
+		}
+		seen[folded] = val
+	}
+	return errs
+}
+
 func remoteTypeValidation(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
 	if isQueryOrMutation(typ.Name) {
 		return nil
@@ -626,7 +1002,7 @@ func idCountCheck(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
 		if isIDField(typ, field) {
 			idFields = append(idFields, field)
 		}
-		if d := field.Directives.ForName(idDirective); d != nil {
+		if hasIDDirective(field) {
 			idDirectiveFields = append(idDirectiveFields, field)
 		}
 	}
@@ -662,19 +1038,25 @@ func idCountCheck(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
 		})
 	}
 
-	return errs
-}
-
-func hasAuthDirective(typ *ast.Definition, field *ast.FieldDefinition) gqlerror.List {
-	for _, directive := range field.Directives {
-		if directive.Name != authDirective {
-			continue
+	keys, names := compositeKeys(typ)
+	for _, name := range names {
+		if len(keys[name]) < 2 {
+			errs = append(errs, gqlerror.ErrorPosf(
+				keys[name][0].Position,
+				"Type %s; Field %s: is the only field in composite key %s, "+
+					"a composite key needs at least two fields.",
+				typ.Name, keys[name][0].Name, name))
+		}
+		if fld := typ.Fields.ForName(name); fld != nil {
+			errs = append(errs, gqlerror.ErrorPosf(
+				fld.Position,
+				"Type %s: composite key %s has the same name as field %s, "+
+					"pick a different name for the composite key.",
+				typ.Name, name, fld.Name))
 		}
-		return []*gqlerror.Error{gqlerror.ErrorPosf(field.Position,
-			"Type %s; Field %s: @%s directive is not allowed on fields",
-			typ.Name, field.Name, authDirective)}
 	}
-	return nil
+
+	return errs
 }
 
 func isValidFieldForList(typ *ast.Definition, field *ast.FieldDefinition) gqlerror.List {
@@ -743,20 +1125,29 @@ func listValidityCheck(typ *ast.Definition, field *ast.FieldDefinition) gqlerror
 	return nil
 }
 
+// hasInverseOnNonObject returns an error if field, which has @hasInverse, isn't of an object or
+// interface type.
+func hasInverseOnNonObject(sch *ast.Schema, typ *ast.Definition,
+	field *ast.FieldDefinition) *gqlerror.Error {
+	invTypeName := field.Type.Name()
+	if sch.Types[invTypeName].Kind == ast.Object || sch.Types[invTypeName].Kind == ast.Interface {
+		return nil
+	}
+	return gqlerror.ErrorPosf(
+		field.Position,
+		"Type %s; Field %s: Field %[2]s is of type %s, but @hasInverse directive only applies"+
+			" to fields with object types.", typ.Name, field.Name, invTypeName)
+}
+
 func hasInverseValidation(sch *ast.Schema, typ *ast.Definition,
 	field *ast.FieldDefinition, dir *ast.Directive,
 	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
 	var errs []*gqlerror.Error
 
-	invTypeName := field.Type.Name()
-	if sch.Types[invTypeName].Kind != ast.Object && sch.Types[invTypeName].Kind != ast.Interface {
-		errs = append(errs,
-			gqlerror.ErrorPosf(
-				field.Position,
-				"Type %s; Field %s: Field %[2]s is of type %s, but @hasInverse directive only applies"+
-					" to fields with object types.", typ.Name, field.Name, invTypeName))
-		return errs
+	if err := hasInverseOnNonObject(sch, typ, field); err != nil {
+		return append(errs, err)
 	}
+	invTypeName := field.Type.Name()
 
 	invFieldArg := dir.Arguments.ForName("field")
 	if invFieldArg == nil {
@@ -782,7 +1173,7 @@ func hasInverseValidation(sch *ast.Schema, typ *ast.Definition,
 		return errs
 	}
 
-	if errMsg := isInverse(sch, typ.Name, field.Name, invTypeName, invField); errMsg != "" {
+	if errMsg := isInverse(sch, typ.Name, field.Name, invField); errMsg != "" {
 		errs = append(errs, gqlerror.ErrorPosf(dir.Position, errMsg))
 		return errs
 	}
@@ -834,7 +1225,10 @@ func implements(typ, intfc *ast.Definition) bool {
 	return false
 }
 
-func isInverse(sch *ast.Schema, expectedInvType, expectedInvField, typeName string,
+// isInverse returns an error message if field can't be the inverse of expectedInvType's field
+// expectedInvField because it's of another type.  Whether the two fields agree on being each
+// other's inverse is checked by inverseConsistencyValidation.
+func isInverse(sch *ast.Schema, expectedInvType, expectedInvField string,
 	field *ast.FieldDefinition) string {
 
 	// We might have copied this directive in from an interface we are implementing.
@@ -857,23 +1251,184 @@ func isInverse(sch *ast.Schema, expectedInvType, expectedInvField, typeName stri
 		)
 	}
 
-	invDirective := field.Directives.ForName(inverseDirective)
-	if invDirective == nil {
-		return ""
+	return ""
+}
+
+// An inverseEnd is one end of a @hasInverse link, a field and the type it's declared in.  A
+// field that a type gets from an interface which has @hasInverse on it is the interface's
+// field, so that the link isn't counted again for every type implementing the interface.
+type inverseEnd struct {
+	typ   *ast.Definition
+	field *ast.FieldDefinition
+}
+
+func (e inverseEnd) String() string {
+	return e.typ.Name + "." + e.field.Name
+}
+
+func inverseEndOf(sch *ast.Schema, typ *ast.Definition, field *ast.FieldDefinition) inverseEnd {
+	if parent := parentInterface(sch, typ, field.Name); parent != nil {
+		fld := parent.Fields.ForName(field.Name)
+		if fld.Directives.ForName(inverseDirective) != nil {
+			return inverseEnd{typ: parent, field: fld}
+		}
 	}
+	return inverseEnd{typ: typ, field: field}
+}
 
-	invFieldArg := invDirective.Arguments.ForName("field")
-	if invFieldArg == nil || invFieldArg.Value.Raw != expectedInvField {
-		return fmt.Sprintf(
-			"Type %s; Field %s: @hasInverse should be consistant."+
-				" %[1]s.%[2]s is the inverse of %[3]s.%[4]s, but"+
-				" %[3]s.%[4]s is the inverse of %[1]s.%[5]s.",
-			expectedInvType, expectedInvField, typeName, field.Name,
-			invFieldArg.Value.Raw,
-		)
+// inverseOf returns the field that field's @hasInverse names, or nil if field doesn't have
+// @hasInverse or it doesn't name a field.  hasInverseValidation reports the mistakes that make
+// it nil.
+func inverseOf(sch *ast.Schema, field *ast.FieldDefinition) *ast.FieldDefinition {
+	dir := field.Directives.ForName(inverseDirective)
+	if dir == nil {
+		return nil
+	}
+	arg := dir.Arguments.ForName(inverseArg)
+	invType := sch.Types[field.Type.Name()]
+	if arg == nil || (invType.Kind != ast.Object && invType.Kind != ast.Interface) {
+		return nil
 	}
+	return invType.Fields.ForName(arg.Value.Raw)
+}
 
-	return ""
+func directiveLocation(dir *ast.Directive) gqlerror.Location {
+	return gqlerror.Location{Line: dir.Position.Line, Column: dir.Position.Column}
+}
+
+func fieldLocation(field *ast.FieldDefinition) gqlerror.Location {
+	return gqlerror.Location{Line: field.Position.Line, Column: field.Position.Column}
+}
+
+// inverseConsistencyValidation checks the @hasInverse links of the schema against each other,
+// as they were declared; it runs before hasInverseValidation adds the directives that were left
+// out at the other end of the links.  It reports every mistake at once, each at both ends:
+//   - a field's inverse that has @hasInverse must name the field back,
+//   - a field can only be the inverse of one field, and
+//   - a non-null field's inverse must be a list if the field isn't.  Otherwise, linking a node
+//     to another node would take it from the node it was linked to, leaving that without one.
+func inverseConsistencyValidation(sch *ast.Schema, definitions []string) gqlerror.List {
+	var errs []*gqlerror.Error
+
+	var targets []inverseEnd
+	sources := make(map[inverseEnd][]inverseEnd)
+	seen := make(map[inverseEnd]bool)
+	for _, defn := range definitions {
+		typ := sch.Types[defn]
+		if typ.Kind != ast.Object && typ.Kind != ast.Interface {
+			continue
+		}
+		for _, field := range typ.Fields {
+			src := inverseEndOf(sch, typ, field)
+			inv := inverseOf(sch, src.field)
+			if inv == nil || seen[src] {
+				continue
+			}
+			seen[src] = true
+			tgt := inverseEndOf(sch, sch.Types[src.field.Type.Name()], inv)
+			if len(sources[tgt]) == 0 {
+				targets = append(targets, tgt)
+			}
+			sources[tgt] = append(sources[tgt], src)
+		}
+	}
+
+	single := func(e inverseEnd) bool { return e.field.Type.Elem == nil }
+
+	for _, tgt := range targets {
+		srcs := sources[tgt]
+		if len(srcs) > 1 {
+			names := make([]string, 0, len(srcs))
+			locations := make([]gqlerror.Location, 0, len(srcs)+1)
+			for _, src := range srcs {
+				names = append(names, src.String())
+				locations = append(locations,
+					directiveLocation(src.field.Directives.ForName(inverseDirective)))
+			}
+			errs = append(errs, &gqlerror.Error{
+				Message: fmt.Sprintf("Type %s; Field %s: is the inverse of %s and %s, but a "+
+					"field can only be the inverse of one field.", tgt.typ.Name, tgt.field.Name,
+					strings.Join(names[:len(names)-1], ", "), names[len(names)-1]),
+				Locations: append(locations, fieldLocation(tgt.field)),
+			})
+			continue
+		}
+
+		src := srcs[0]
+		srcDir := src.field.Directives.ForName(inverseDirective)
+		tgtDir := tgt.field.Directives.ForName(inverseDirective)
+		if tgtDir != nil {
+			if arg := tgtDir.Arguments.ForName(inverseArg); arg != nil &&
+				arg.Value.Raw != src.field.Name {
+				errs = append(errs, &gqlerror.Error{
+					Message: fmt.Sprintf("Type %s; Field %s: @hasInverse should be consistant."+
+						" %[1]s.%[2]s is the inverse of %[3]s.%[4]s, but"+
+						" %[3]s.%[4]s is the inverse of %[1]s.%[5]s.",
+						src.typ.Name, src.field.Name, tgt.typ.Name, tgt.field.Name,
+						arg.Value.Raw),
+					Locations: []gqlerror.Location{directiveLocation(srcDir),
+						directiveLocation(tgtDir)},
+				})
+				continue
+			}
+		}
+
+		// A link that's declared at both ends is checked from each of them, so only the end the
+		// link is checked from is reported, unless the other end doesn't declare the link.
+		ends := [][2]inverseEnd{{src, tgt}}
+		if tgtDir == nil {
+			ends = append(ends, [2]inverseEnd{tgt, src})
+		}
+		for _, end := range ends {
+			if !single(end[0]) || !end[0].field.Type.NonNull || !single(end[1]) {
+				continue
+			}
+			errs = append(errs, &gqlerror.Error{
+				Message: fmt.Sprintf("Type %s; Field %s: is non-null, so its inverse %s should "+
+					"be a list. Otherwise, setting %[3]s would take the %s away from the %[1]s "+
+					"it's linked to, and leave %[1]s.%[2]s empty.", end[0].typ.Name,
+					end[0].field.Name, end[1], end[0].field.Type.Name()),
+				Locations: []gqlerror.Location{fieldLocation(end[0].field),
+					fieldLocation(end[1].field)},
+			})
+		}
+	}
+
+	return errs
+}
+
+// validateSearchPrecision checks that @search(precision: N) is given for the float index of a
+// Float field, with one of the precisions that there's a bucketed float index for.
+func validateSearchPrecision(
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	precision *ast.Argument) *gqlerror.Error {
+
+	if field.Type.Name() != "Float" {
+		return gqlerror.ErrorPosf(precision.Position,
+			"Type %s; Field %s: @search(precision: ...) only applies to Float fields.",
+			typ.Name, field.Name)
+	}
+	if by := dir.Arguments.ForName(searchArgs); by != nil {
+		hasFloat := false
+		for _, child := range by.Value.Children {
+			hasFloat = hasFloat || child.Value.Raw == "float"
+		}
+		if !hasFloat {
+			return gqlerror.ErrorPosf(precision.Position,
+				"Type %s; Field %s: @search(precision: ...) is the precision of the float "+
+					"index, but the field isn't searched by float.",
+				typ.Name, field.Name)
+		}
+	}
+	if p, err := strconv.Atoi(precision.Value.Raw); err != nil || p < 1 || p > 3 {
+		return gqlerror.ErrorPosf(precision.Position,
+			"Type %s; Field %s: @search(precision: %s) isn't valid, the precision of the float "+
+				"index can be 1, 2 or 3 decimal places.",
+			typ.Name, field.Name, precision.Value.Raw)
+	}
+	return nil
 }
 
 // validateSearchArg checks that the argument for search is valid and compatible
@@ -885,14 +1440,14 @@ func validateSearchArg(searchArg string,
 	dir *ast.Directive) *gqlerror.Error {
 
 	isEnum := sch.Types[field.Type.Name()].Kind == ast.Enum
-	search, ok := supportedSearches[searchArg]
+	search, ok := searchFor(searchArg)
 	switch {
 	case !ok:
 		// This check can be removed once gqlparser bug
 		// #107(https://github.com/vektah/gqlparser/issues/107) is fixed.
 		return gqlerror.ErrorPosf(
 			dir.Position,
-			"Type %s; Field %s: the argument to @search %s isn't valid."+
+			"Type %s; Field %s: the argument to @search %s isn't valid. "+
 				"Fields of type %s %s.",
 			typ.Name, field.Name, searchArg, field.Type.Name(), searchMessage(sch, field))
 
@@ -903,7 +1458,7 @@ func validateSearchArg(searchArg string,
 				"doesn't apply to field type %s.  Search by %[3]s applies to fields of type %[5]s. "+
 				"Fields of type %[4]s %[6]s.",
 			typ.Name, field.Name, searchArg, field.Type.Name(),
-			supportedSearches[searchArg].gqlType, searchMessage(sch, field))
+			search.gqlType, searchMessage(sch, field))
 
 	case isEnum && !enumDirectives[searchArg]:
 		return gqlerror.ErrorPosf(
@@ -925,6 +1480,22 @@ func searchValidation(
 	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
 	var errs []*gqlerror.Error
 
+	// A Boolean field is filtered by a value, like isPublished: true, so there's no filter
+	// input that the presence filters could be added to.
+	if hasPresenceSearch(field) && field.Type.Name() == "Boolean" {
+		errs = append(errs, gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @search(presence: true) isn't supported on Boolean fields.",
+			typ.Name, field.Name))
+		return errs
+	}
+
+	if precision := dir.Arguments.ForName(searchPrecision); precision != nil {
+		if err := validateSearchPrecision(typ, field, dir, precision); err != nil {
+			return append(errs, err)
+		}
+	}
+
 	arg := dir.Arguments.ForName(searchArgs)
 	if arg == nil {
 		// If there's no arg, then it can be an enum or has to be a scalar that's
@@ -953,17 +1524,61 @@ func searchValidation(
 		return errs
 	}
 
-	searchArgs := getSearchArgs(field)
-	searchIndexes := make(map[string]string)
-	for _, searchArg := range searchArgs {
-		if err := validateSearchArg(searchArg, sch, typ, field, dir); err != nil {
-			errs = append(errs, err)
-			return errs
-		}
+	if len(arg.Value.Children) == 0 {
+		errs = append(errs, gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: the @search directive has an empty list of indexes, use just "+
+				"@search to get the default index, or list the indexes, like @search(by: [hash])",
+			typ.Name, field.Name))
+		return errs
+	}
+
+	// Built-in indexes are given as enum values, like @search(by: [hash]), and custom
+	// tokenizers are given by name, like @search(by: ["myplugin"]).
+	for _, child := range arg.Value.Children {
+		_, builtIn := supportedSearches[child.Value.Raw]
+		switch {
+		case child.Value.Kind == ast.StringValue && builtIn:
+			errs = append(errs, gqlerror.ErrorPosf(
+				child.Value.Position,
+				"Type %s; Field %s: the argument to @search \"%s\" is a built-in index, "+
+					"give it without quotes, like @search(by: [%[3]s])",
+				typ.Name, field.Name, child.Value.Raw))
+			return errs
+		case child.Value.Kind == ast.StringValue:
+			if _, ok := searchFor(child.Value.Raw); !ok {
+				errs = append(errs, gqlerror.ErrorPosf(
+					child.Value.Position,
+					"Type %s; Field %s: the argument to @search \"%s\" isn't a registered "+
+						"custom tokenizer.",
+					typ.Name, field.Name, child.Value.Raw))
+				return errs
+			}
+		case !builtIn:
+			errs = append(errs, gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; Field %s: the argument to @search %s isn't valid. "+
+					"Fields of type %s %s.",
+				typ.Name, field.Name, child.Value.Raw, field.Type.Name(),
+				searchMessage(sch, field)))
+			return errs
+		}
+	}
+
+	searchArgs := getSearchArgs(field)
+	searchIndexes := make(map[string]string)
+	for _, searchArg := range searchArgs {
+		if err := validateSearchArg(searchArg, sch, typ, field, dir); err != nil {
+			errs = append(errs, err)
+			return errs
+		}
 
 		// Checks that the filter indexes aren't repeated and they
 		// don't clash with each other.
-		searchIndex := builtInFilters[searchArg]
+		searchIndex, ok := builtInFilters[searchArg]
+		if !ok {
+			searchIndex = searchArg
+		}
 		if val, ok := searchIndexes[searchIndex]; ok {
 			if field.Type.Name() == "String" || sch.Types[field.Type.Name()].Kind == ast.Enum {
 				errs = append(errs, gqlerror.ErrorPosf(
@@ -1000,6 +1615,42 @@ func searchValidation(
 	return errs
 }
 
+// facetTypes are the types that a field stored in a Dgraph facet can have.
+var facetTypes = map[string]bool{
+	"Int": true, "Float": true, "String": true, "Boolean": true, "DateTime": true,
+}
+
+// facetValidation validates a field with @dgraph(facet: ...).  A facet is a scalar stored on the
+// edges to a node, so the field isn't also a predicate, and it can't have the directives that
+// need one.
+func facetValidation(typ *ast.Definition, field *ast.FieldDefinition, dir *ast.Directive,
+	facetArg *ast.Argument) gqlerror.List {
+	if facetArg.Value.Kind != ast.StringValue || facetArg.Value.Raw == "" {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(dir.Position,
+			"Type %s; Field %s: facet argument for @dgraph directive should be a non-empty "+
+				"String.", typ.Name, field.Name)}
+	}
+	if dir.Arguments.ForName(dgraphPredArg) != nil {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(dir.Position,
+			"Type %s; Field %s: @dgraph directive can't have both pred and facet arguments.",
+			typ.Name, field.Name)}
+	}
+
+	var errs []*gqlerror.Error
+	if !facetTypes[field.Type.Name()] || field.Type.Elem != nil {
+		errs = append(errs, gqlerror.ErrorPosf(field.Position,
+			"Type %s; Field %s: is a facet, so it should be of type Int, Float, String, "+
+				"Boolean or DateTime, but it is %s.", typ.Name, field.Name, field.Type.String()))
+	}
+	for _, d := range []string{searchDirective, idDirective, inverseDirective, langDirective} {
+		if field.Directives.ForName(d) != nil {
+			errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+				"Type %s; Field %s: is a facet, so it can't have @%s.", typ.Name, field.Name, d))
+		}
+	}
+	return errs
+}
+
 func dgraphDirectiveValidation(sch *ast.Schema, typ *ast.Definition, field *ast.FieldDefinition,
 	dir *ast.Directive, secrets map[string]x.SensitiveByteSlice) gqlerror.List {
 	var errs []*gqlerror.Error
@@ -1012,6 +1663,10 @@ func dgraphDirectiveValidation(sch *ast.Schema, typ *ast.Definition, field *ast.
 		return errs
 	}
 
+	if facetArg := dir.Arguments.ForName(dgraphFacetArg); facetArg != nil {
+		return facetValidation(typ, field, dir, facetArg)
+	}
+
 	predArg := dir.Arguments.ForName(dgraphPredArg)
 	if predArg == nil || predArg.Value.Raw == "" {
 		errs = append(errs, gqlerror.ErrorPosf(
@@ -1122,6 +1777,17 @@ func customDirectiveValidation(sch *ast.Schema,
 	field *ast.FieldDefinition,
 	dir *ast.Directive,
 	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
+	return validateCustomDirective(sch, typ, field, dir, secrets, nil)
+}
+
+// validateCustomDirective validates the @custom directive dir of field, and records in
+// remoteArgs the required arguments of the remote queries it introspects.
+func validateCustomDirective(sch *ast.Schema,
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	secrets map[string]x.SensitiveByteSlice,
+	remoteArgs requiredRemoteArgs) gqlerror.List {
 	var errs []*gqlerror.Error
 
 	// 1. Validating custom directive itself
@@ -1141,6 +1807,18 @@ func customDirectiveValidation(sch *ast.Schema,
 			typ.Name, field.Name))
 	}
 
+	// A field resolved by @custom isn't stored in Dgraph, so it can't also have directives that
+	// only make sense for stored fields.
+	for _, stored := range []string{idDirective, inverseDirective} {
+		if field.Directives.ForName(stored) != nil {
+			errs = append(errs, gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; Field %s; custom directive not allowed along with @%s directive, "+
+					"a field is either stored in Dgraph or resolved by @custom, pick one of "+
+					"them.", typ.Name, field.Name, stored))
+		}
+	}
+
 	defn := sch.Types[typ.Name]
 	id := getIDField(defn)
 	xid := getXIDField(defn)
@@ -1164,7 +1842,18 @@ func customDirectiveValidation(sch *ast.Schema,
 			typ.Name, field.Name, l))
 	}
 
-	// 3. Validating http argument
+	if dqlArg := dir.Arguments.ForName(dql); dqlArg != nil {
+		if dir.Arguments.ForName("http") != nil {
+			errs = append(errs, gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; Field %s: @custom directive can have either dql or http, not both.",
+				typ.Name, field.Name))
+		}
+		return append(errs, customDQLValidation(typ, field, dqlArg)...)
+	}
+
+	// 3. Validating http argument, which is either a single config or a list of configs that
+	// are tried in order.
 	httpArg := dir.Arguments.ForName("http")
 	if httpArg == nil || httpArg.Value.String() == "" {
 		errs = append(errs, gqlerror.ErrorPosf(
@@ -1173,17 +1862,39 @@ func customDirectiveValidation(sch *ast.Schema,
 			typ.Name, field.Name))
 		return errs
 	}
-	if httpArg.Value.Kind != ast.ObjectValue {
+	for _, httpVal := range listValues(httpArg.Value) {
+		errs = append(errs, customHTTPValidation(sch, typ, field, dir, httpVal, secrets,
+			remoteArgs)...)
+	}
+
+	return errs
+}
+
+// customHTTPValidation validates httpVal, one of the http configs of the @custom directive dir.
+func customHTTPValidation(sch *ast.Schema,
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	httpVal *ast.Value,
+	secrets map[string]x.SensitiveByteSlice,
+	remoteArgs requiredRemoteArgs) gqlerror.List {
+	var errs []*gqlerror.Error
+
+	if httpVal.Kind != ast.ObjectValue {
 		errs = append(errs, gqlerror.ErrorPosf(
-			httpArg.Position,
+			httpVal.Position,
 			"Type %s; Field %s: http argument for @custom directive should be of type Object.",
 			typ.Name, field.Name))
 	}
 
+	defn := sch.Types[typ.Name]
+	id := getIDField(defn)
+	xid := getXIDField(defn)
+
 	// Start validating children of http argument
 
 	// 4. Validating url
-	httpUrl := httpArg.Value.Children.ForName("url")
+	httpUrl := httpVal.Children.ForName("url")
 	if httpUrl == nil {
 		errs = append(errs, gqlerror.ErrorPosf(
 			dir.Position,
@@ -1259,7 +1970,7 @@ func customDirectiveValidation(sch *ast.Schema,
 	}
 
 	// 5. Validating method
-	method := httpArg.Value.Children.ForName("method")
+	method := httpVal.Children.ForName("method")
 	if method == nil {
 		errs = append(errs, gqlerror.ErrorPosf(
 			dir.Position,
@@ -1275,7 +1986,7 @@ func customDirectiveValidation(sch *ast.Schema,
 	}
 
 	// 6. Validating mode
-	mode := httpArg.Value.Children.ForName(mode)
+	mode := httpVal.Children.ForName(mode)
 	var isBatchMode bool
 	if mode != nil {
 		if isQueryOrMutationType(typ) {
@@ -1304,8 +2015,15 @@ func customDirectiveValidation(sch *ast.Schema,
 	}
 
 	// 7. Validating graphql combination with url params, method and body
-	body := httpArg.Value.Children.ForName("body")
-	graphql := httpArg.Value.Children.ForName("graphql")
+	body := httpVal.Children.ForName("body")
+	graphql := httpVal.Children.ForName("graphql")
+	loopback := httpUrl.Raw == LoopbackURL
+	if loopback && graphql == nil {
+		errs = append(errs, gqlerror.ErrorPosf(httpUrl.Position,
+			"Type %s; Field %s; url %s inside @custom directive is resolved by this GraphQL "+
+				"API, so it can only be given along with graphql.", typ.Name, field.Name,
+			LoopbackURL))
+	}
 	if graphql != nil {
 		if urlHasParams {
 			errs = append(errs, gqlerror.ErrorPosf(dir.Position,
@@ -1319,27 +2037,29 @@ func customDirectiveValidation(sch *ast.Schema,
 					" @custom directive, method can only be POST if graphql field is present.",
 				typ.Name, field.Name, method.Raw))
 		}
-		if !isBatchMode {
-			if body != nil {
-				errs = append(errs, gqlerror.ErrorPosf(dir.Position,
-					"Type %s; Field %s; has both body and graphql field inside @custom directive, "+
-						"they can't be present together.",
-					typ.Name, field.Name))
-			}
-		} else {
-			if body == nil {
-				errs = append(errs, gqlerror.ErrorPosf(dir.Position,
-					"Type %s; Field %s; both body and graphql field inside @custom directive "+
-						"are required if mode is BATCH.",
-					typ.Name, field.Name))
-			}
+		// In SINGLE mode, body is optional and is a template for the variables of the remote
+		// operation, it is validated along with graphql.
+		if isBatchMode && body == nil {
+			errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+				"Type %s; Field %s; both body and graphql field inside @custom directive "+
+					"are required if mode is BATCH.",
+				typ.Name, field.Name))
 		}
 	}
 
 	// 8. Validating body
 	var requiredFields map[string]bool
+	var bodyTemplate *interface{}
+	allowGetBody := httpVal.Children.ForName("allowGetBody")
+	if body != nil && method != nil && method.Raw == "GET" && allowGetBody != nil &&
+		allowGetBody.Raw == "false" {
+		errs = append(errs, gqlerror.ErrorPosf(body.Position,
+			"Type %s; Field %s; has method GET along with body inside @custom directive while "+
+				"allowGetBody is false, body can't be sent with GET unless it is allowed.",
+			typ.Name, field.Name))
+	}
 	if body != nil {
-		_, requiredFields, err = parseBodyTemplate(body.Raw)
+		bodyTemplate, requiredFields, _, err = parseBodyTemplate(body.Raw)
 		if err != nil {
 			errs = append(errs, gqlerror.ErrorPosf(body.Position,
 				"Type %s; Field %s; body template inside @custom directive could not be parsed.",
@@ -1399,7 +2119,17 @@ func customDirectiveValidation(sch *ast.Schema,
 				"Type %s; Field %s: inside graphql in @custom directive, found operation with "+
 					"name `%s`, it can't have a name.", typ.Name, field.Name, graphqlOpDef.Name))
 		}
-		if graphqlOpDef.VariableDefinitions != nil {
+		if body != nil && !isBatchMode {
+			// body is a template for the variables, so the required fields are only the ones used
+			// in the template and they have already been parsed while validating body.
+			if bodyTemplate != nil {
+				for _, msg := range variablesTemplateValidation(bodyTemplate,
+					graphqlOpDef.VariableDefinitions, getVarTypesAsMap(field, typ)) {
+					errs = append(errs, gqlerror.ErrorPosf(body.Position,
+						"Type %s; Field %s; @custom directive, %s", typ.Name, field.Name, msg))
+				}
+			}
+		} else if graphqlOpDef.VariableDefinitions != nil {
 			if isQueryOrMutationType(typ) {
 				for _, vd := range graphqlOpDef.VariableDefinitions {
 					ad := field.Arguments.ForName(vd.Variable)
@@ -1485,7 +2215,7 @@ func customDirectiveValidation(sch *ast.Schema,
 					bodyBuilder.WriteString(comma)
 				}
 				bodyBuilder.WriteString("}")
-				_, requiredVars, err := parseBodyTemplate(bodyBuilder.String())
+				_, requiredVars, _, err := parseBodyTemplate(bodyBuilder.String())
 				if err != nil {
 					errs = append(errs, gqlerror.ErrorPosf(graphql.Position,
 						"Type %s; Field %s: inside graphql in @custom directive, "+
@@ -1590,9 +2320,53 @@ func customDirectiveValidation(sch *ast.Schema,
 		}
 	}
 
+	// Validating the path of the result in the response
+	resultPath := httpVal.Children.ForName("resultPath")
+	if resultPath != nil {
+		if _, err := parseResultPath(resultPath.Raw); err != nil {
+			errs = append(errs, gqlerror.ErrorPosf(resultPath.Position,
+				"Type %s; Field %s; resultPath inside @custom directive is invalid, %s.",
+				typ.Name, field.Name, err))
+		}
+	}
+	if strictPath := httpVal.Children.ForName("strictPath"); strictPath != nil &&
+		resultPath == nil {
+		errs = append(errs, gqlerror.ErrorPosf(strictPath.Position,
+			"Type %s; Field %s; strictPath inside @custom directive can only be given "+
+				"along with resultPath.", typ.Name, field.Name))
+	}
+
+	if errorHandling := httpVal.Children.ForName("errorHandling"); errorHandling != nil {
+		if nullOn := errorHandling.Children.ForName("nullOn"); nullOn != nil {
+			for _, status := range nullOn.Children {
+				code, err := strconv.Atoi(status.Value.Raw)
+				if err != nil || code < 100 || code > 599 || (code >= 200 && code <= 299) {
+					errs = append(errs, gqlerror.ErrorPosf(status.Value.Position,
+						"Type %s; Field %s; nullOn inside @custom directive can only have "+
+							"HTTP statuses that aren't 2xx, found: `%s`.", typ.Name,
+						field.Name, status.Value.Raw))
+				}
+			}
+		}
+		if messagePath := errorHandling.Children.ForName("messagePath"); messagePath != nil {
+			if _, err := parseResultPath(messagePath.Raw); err != nil {
+				errs = append(errs, gqlerror.ErrorPosf(messagePath.Position,
+					"Type %s; Field %s; messagePath inside @custom directive is invalid, %s.",
+					typ.Name, field.Name, err))
+			}
+		}
+	}
+
+	introspectionHeaders := httpVal.Children.ForName("introspectionHeaders")
+	if introspectionHeaders != nil && graphql == nil {
+		errs = append(errs, gqlerror.ErrorPosf(introspectionHeaders.Position,
+			"Type %s; Field %s; introspectionHeaders inside @custom directive can only be "+
+				"given along with graphql.", typ.Name, field.Name))
+	}
+
 	// 12. Finally validate the given graphql operation on remote server, when all locally doable
 	// validations have finished
-	si := httpArg.Value.Children.ForName("skipIntrospection")
+	si := httpVal.Children.ForName("skipIntrospection")
 	var skip bool
 	if si != nil {
 		skip, err = strconv.ParseBool(si.Raw)
@@ -1604,7 +2378,7 @@ func customDirectiveValidation(sch *ast.Schema,
 		}
 	}
 
-	forwardHeaders := httpArg.Value.Children.ForName("forwardHeaders")
+	forwardHeaders := httpVal.Children.ForName("forwardHeaders")
 	if forwardHeaders != nil {
 		for _, h := range forwardHeaders.Children {
 			key := strings.Split(h.Value.Raw, ":")
@@ -1617,25 +2391,39 @@ func customDirectiveValidation(sch *ast.Schema,
 		}
 	}
 
-	secretHeaders := httpArg.Value.Children.ForName("secretHeaders")
-	if secretHeaders != nil {
-		for _, h := range secretHeaders.Children {
+	for _, headers := range []string{"secretHeaders", "introspectionHeaders"} {
+		hdrs := httpVal.Children.ForName(headers)
+		if hdrs == nil {
+			continue
+		}
+		for _, h := range hdrs.Children {
 			key := strings.Split(h.Value.Raw, ":")
 			if len(key) > 2 {
-				return append(errs, gqlerror.ErrorPosf(graphql.Position,
-					"Type %s; Field %s; secretHeaders in @custom directive should be of the form 'remote_headername:local_headername' or just 'headername'"+
+				return append(errs, gqlerror.ErrorPosf(h.Value.Position,
+					"Type %s; Field %s; %s in @custom directive should be of the form 'remote_headername:local_headername' or just 'headername'"+
 						", found: `%s`.",
-					typ.Name, field.Name, h.Value.Raw))
+					typ.Name, field.Name, headers, h.Value.Raw))
 			}
 		}
 	}
 
+	// Validating the variables used in the header templates
+	errs = append(errs, headerTemplatesValidation(httpVal, typ, field, dir, isBatchMode,
+		secrets)...)
+
 	if errs != nil {
 		return errs
 	}
 
-	if graphql != nil && !skip && graphqlOpDef != nil {
-		secretHeaders := httpArg.Value.Children.ForName("secretHeaders")
+	// A loopback request is made to the schema that's being validated, which can't be
+	// introspected yet.
+	if graphql != nil && !skip && !loopback && graphqlOpDef != nil {
+		secretHeaders := httpVal.Children.ForName("secretHeaders")
+		// The remote API can want other credentials for introspection than for the requests
+		// that resolve the field, those are only sent for the introspection.
+		if introspectionHeaders != nil {
+			secretHeaders = introspectionHeaders
+		}
 		headers := http.Header{}
 		if secretHeaders != nil {
 			for _, h := range secretHeaders.Children {
@@ -1643,41 +2431,518 @@ func customDirectiveValidation(sch *ast.Schema,
 				if len(key) == 1 {
 					key = []string{h.Value.Raw, h.Value.Raw}
 				}
+				// The templates can't be evaluated without the values of the variables, so
+				// such headers aren't sent, unless they only use secrets.
+				if isHeaderTemplate(key[1]) {
+					tmpl := substituteSecretsInHeader(key[1], secrets)
+					for k, v := range SubstituteVarsInHeaders(nil,
+						map[string]string{key[0]: tmpl}, nil) {
+						headers[k] = v
+					}
+					continue
+				}
 				// We try and fetch the value from the stored secrets.
 				val := secrets[key[1]]
 				headers.Add(key[0], string(val))
 			}
 		}
-		if err := validateRemoteGraphql(&remoteGraphqlMetadata{
+		remoteMd := &remoteGraphqlMetadata{
 			parentType:   typ,
 			parentField:  field,
 			graphqlOpDef: graphqlOpDef,
 			isBatch:      isBatchMode,
+			hasVarsTmpl:  body != nil && !isBatchMode,
 			url:          httpUrl.Raw,
 			headers:      headers,
 			schema:       sch,
-		}); err != nil {
+		}
+		if err := validateRemoteGraphql(remoteMd); err != nil {
 			errs = append(errs, gqlerror.ErrorPosf(graphql.Position,
 				"Type %s; Field %s: inside graphql in @custom directive, %s",
 				typ.Name, field.Name, err.Error()))
+		} else {
+			remoteArgs.add(typ.Name, field.Name,
+				graphqlOpDef.SelectionSet[0].(*ast.Field).Name, remoteMd.requiredArgs)
+		}
+	}
+
+	return errs
+}
+
+// headerTemplatesValidation validates the variables used in the header templates given in
+// secretHeaders and forwardHeaders. For queries and mutations they must be arguments of the field,
+// otherwise they must be scalar fields of the type, not resolved by @custom. Such variables can't
+// be used in BATCH mode, as a single request is made for all the parent objects.
+func headerTemplatesValidation(httpArg *ast.Value, typ *ast.Definition,
+	field *ast.FieldDefinition, dir *ast.Directive, isBatchMode bool,
+	secrets map[string]x.SensitiveByteSlice) []*gqlerror.Error {
+	var errs []*gqlerror.Error
+	for _, headers := range []string{"secretHeaders", "forwardHeaders"} {
+		hdrs := httpArg.Children.ForName(headers)
+		if hdrs == nil {
+			continue
+		}
+		for _, h := range hdrs.Children {
+			key := strings.Split(h.Value.Raw, ":")
+			if isHeaderTemplate(key[0]) {
+				errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+					"Type %s; Field %s; %s in @custom directive can only use variables in the "+
+						"value of a header, found: `%s`.", typ.Name, field.Name, headers,
+					h.Value.Raw))
+				continue
+			}
+			if len(key) == 2 && isHeaderTemplate(key[1]) {
+				for _, name := range parseHeaderVars(key[1]) {
+					if name == "" {
+						errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+							"Type %s; Field %s; %s in @custom directive has a $ without a "+
+								"variable name, use $$ for a literal $, found: `%s`.", typ.Name,
+							field.Name, headers, h.Value.Raw))
+						break
+					}
+					if headers == "secretHeaders" {
+						if err := secretHeaderVarClash(typ, field, dir, name,
+							secrets); err != nil {
+							errs = append(errs, err)
+						}
+					}
+				}
+			}
 		}
 	}
+	if errs != nil {
+		return errs
+	}
+
+	vars := headerTemplateVars(httpArg, secrets)
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 && isBatchMode {
+		return append(errs, gqlerror.ErrorPosf(dir.Position,
+			"Type %s; Field %s; has variables in headers inside @custom directive while mode "+
+				"is BATCH, headers can't contain variables if mode is BATCH.",
+			typ.Name, field.Name))
+	}
+
+	for _, name := range names {
+		if isQueryOrMutationType(typ) {
+			if field.Arguments.ForName(name) == nil {
+				errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+					"Type %s; Field %s; headers inside @custom directive use an argument %s "+
+						"that is not defined.", typ.Name, field.Name, name))
+			}
+			continue
+		}
 
+		if name == field.Name {
+			errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+				"Type %s; Field %s; @custom directive, headers can't require the field itself.",
+				typ.Name, field.Name))
+			continue
+		}
+		fd := typ.Fields.ForName(name)
+		if fd == nil {
+			errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+				"Type %s; Field %s; headers inside @custom directive use a field %s that is "+
+					"not defined.", typ.Name, field.Name, name))
+			continue
+		}
+		if !isScalar(fd.Type.Name()) {
+			errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+				"Type %s; Field %s; @custom directive, headers must use scalar fields, "+
+					"found field `%s` of type `%s`.", typ.Name, field.Name, name,
+				fd.Type.Name()))
+		}
+		if fd.Directives.ForName(customDirective) != nil {
+			errs = append(errs, gqlerror.ErrorPosf(dir.Position,
+				"Type %s; Field %s; @custom directive, headers can't use another field with "+
+					"@custom directive, found field `%s` with @custom.", typ.Name, field.Name,
+				name))
+		}
+	}
 	return errs
 }
 
+// secretHeaderVarClash returns an error if the variable name, used in secretHeaders, is a secret
+// and also an argument of field, for queries and mutations, or a field of typ otherwise.  Secrets
+// are substituted first, so the argument or field would never be used.
+func secretHeaderVarClash(typ *ast.Definition, field *ast.FieldDefinition, dir *ast.Directive,
+	name string, secrets map[string]x.SensitiveByteSlice) *gqlerror.Error {
+	if _, ok := secrets[name]; !ok {
+		return nil
+	}
+
+	clash := "a field of the type"
+	if isQueryOrMutationType(typ) {
+		if field.Arguments.ForName(name) == nil {
+			return nil
+		}
+		clash = "an argument of the field"
+	} else if typ.Fields.ForName(name) == nil {
+		return nil
+	}
+	return gqlerror.ErrorPosf(dir.Position,
+		"Type %s; Field %s; secretHeaders in @custom directive use the variable $%s, which is "+
+			"both a secret and %s, rename one of them.", typ.Name, field.Name, name, clash)
+}
+
+// variablesTemplateValidation validates the body given along with graphql in SINGLE mode, which
+// is a template for the variables of the remote operation. Every key in the template must be a
+// variable defined in the operation and every non-null variable must be given a value. A $-prefixed
+// value must refer to a field (or argument) of the same type as the variable, while a constant
+// must be a valid value for the type of the variable.
+func variablesTemplateValidation(tmpl *interface{}, varDefs ast.VariableDefinitionList,
+	givenVarTypes map[string]*ast.Type) []string {
+	vars, ok := (*tmpl).(map[string]interface{})
+	if !ok {
+		return []string{"body template must be an object of variables when used with graphql."}
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		vd := varDefs.ForName(name)
+		if vd == nil {
+			errs = append(errs, fmt.Sprintf("body template uses a variable `%s` that isn't "+
+				"defined in graphql.", name))
+			continue
+		}
+		if !templateValueMatchesType(vars[name], vd.Type, givenVarTypes) {
+			errs = append(errs, fmt.Sprintf("body template has a value for variable `%s` that "+
+				"doesn't match its type `%s`.", name, vd.Type.String()))
+		}
+	}
+	for _, vd := range varDefs {
+		if _, ok := vars[vd.Variable]; !ok && vd.Type.NonNull && vd.DefaultValue == nil {
+			errs = append(errs, fmt.Sprintf("body template doesn't have a value for the non-null "+
+				"variable `%s` defined in graphql.", vd.Variable))
+		}
+	}
+	return errs
+}
+
+// templateValueMatchesType tells whether a value from a body template can be sent for a variable
+// of the given type. Only the GraphQL spec scalars can be checked locally, values for enums,
+// custom scalars and the fields of input objects are left for the remote endpoint to validate.
+func templateValueMatchesType(val interface{}, typ *ast.Type,
+	givenVarTypes map[string]*ast.Type) bool {
+	if v, ok := val.(string); ok && strings.HasPrefix(v, "$") {
+		givenTyp, ok := givenVarTypes[v[1:]]
+		// fields (or arguments) which aren't defined are reported while validating those
+		return !ok || givenTyp.Name() == typ.Name()
+	}
+	if val == nil {
+		return !typ.NonNull
+	}
+	if typ.Elem != nil {
+		list, ok := val.([]interface{})
+		if !ok {
+			// input coercion allows a single value to be given for a list
+			return templateValueMatchesType(val, typ.Elem, givenVarTypes)
+		}
+		for _, v := range list {
+			if !templateValueMatchesType(v, typ.Elem, givenVarTypes) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch v := val.(type) {
+	case string:
+		return typ.NamedType != "Int" && typ.NamedType != "Float" && typ.NamedType != "Boolean"
+	case float64:
+		switch typ.NamedType {
+		case "Int", "ID":
+			return v == math.Trunc(v)
+		case "String", "Boolean":
+			return false
+		}
+		return true
+	case bool:
+		return typ.NamedType == "Boolean" || !graphqlSpecScalars[typ.NamedType]
+	default:
+		// objects and lists
+		return !graphqlSpecScalars[typ.NamedType]
+	}
+}
+
 func idValidation(sch *ast.Schema,
 	typ *ast.Definition,
 	field *ast.FieldDefinition,
 	dir *ast.Directive,
 	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
-	if field.Type.String() == "String!" {
+	var errs []*gqlerror.Error
+	if field.Type.String() != "String!" {
+		errs = append(errs, gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: with @id directive must be of type String!, not %s",
+			typ.Name, field.Name, field.Type.String()))
+	}
+	if arg := dir.Arguments.ForName(idCompositeArg); arg != nil &&
+		(arg.Value.Kind != ast.StringValue || strings.TrimSpace(arg.Value.Raw) == "") {
+		errs = append(errs, gqlerror.ErrorPosf(
+			arg.Position,
+			"Type %s; Field %s: composite argument for @id directive should be a "+
+				"non-empty String.", typ.Name, field.Name))
+	}
+	return errs
+}
+
+// customDQLValidation validates @custom(dql: ...), which resolves a query using the given DQL
+// query, with the arguments of the query as the DQL variables.
+func customDQLValidation(typ *ast.Definition, field *ast.FieldDefinition,
+	dqlArg *ast.Argument) gqlerror.List {
+	var errs []*gqlerror.Error
+
+	if typ.Name != "Query" {
+		errs = append(errs, gqlerror.ErrorPosf(
+			dqlArg.Value.Position,
+			"Type %s; Field %s: dql argument for @custom directive can only be used on "+
+				"fields of type Query.", typ.Name, field.Name))
+	}
+
+	if (dqlArg.Value.Kind != ast.StringValue && dqlArg.Value.Kind != ast.BlockValue) ||
+		strings.TrimSpace(dqlArg.Value.Raw) == "" {
+		return append(errs, gqlerror.ErrorPosf(
+			dqlArg.Value.Position,
+			"Type %s; Field %s: dql argument for @custom directive should be a non-empty "+
+				"String.", typ.Name, field.Name))
+	}
+
+	for _, v := range parseDQLVars(dqlArg.Value.Raw) {
+		if field.Arguments.ForName(v) == nil {
+			errs = append(errs, gqlerror.ErrorPosf(
+				dqlArg.Value.Position,
+				"Type %s; Field %s; dql inside @custom directive uses an argument %s that is "+
+					"not defined.", typ.Name, field.Name, v))
+		}
+	}
+	return errs
+}
+
+func langValidation(sch *ast.Schema,
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
+	if field.Type.Name() != "String" || field.Type.Elem != nil {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: with @lang directive must be of type String or String!, not %s",
+			typ.Name, field.Name, field.Type.String())}
+	}
+	for _, other := range []string{idDirective, customDirective} {
+		if field.Directives.ForName(other) != nil {
+			return []*gqlerror.Error{gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; Field %s: @lang directive can't be used together with @%s.",
+				typ.Name, field.Name, other)}
+		}
+	}
+	return nil
+}
+
+// auditValidation checks @createdBy, @createdAt and @updatedAt.  The server sets a field with
+// one of them, to a claim of the JWT for @createdBy, and to the time of the mutation for the
+// others, so the field must be of the type that value has and can't be set any other way.
+func auditValidation(sch *ast.Schema,
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
+	if audit := auditDirective(field); audit != dir {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @%s directive can't be used together with @%s.",
+			typ.Name, field.Name, dir.Name, audit.Name)}
+	}
+
+	want := "DateTime"
+	if dir.Name == createdByDirective {
+		want = "String"
+		claim := dir.Arguments.ForName(createdByClaimArg)
+		if claim == nil || claim.Value.Kind != ast.StringValue || claim.Value.Raw == "" {
+			return []*gqlerror.Error{gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; Field %s: claim argument for @%s directive should be a non-empty "+
+					"String.", typ.Name, field.Name, dir.Name)}
+		}
+	}
+	if field.Type.Name() != want || field.Type.Elem != nil {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: with @%s directive must be of type %s or %s!, not %s",
+			typ.Name, field.Name, dir.Name, want, want, field.Type.String())}
+	}
+
+	for _, other := range []string{idDirective, customDirective, langDirective} {
+		if field.Directives.ForName(other) != nil {
+			return []*gqlerror.Error{gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; Field %s: @%s directive can't be used together with @%s.",
+				typ.Name, field.Name, dir.Name, other)}
+		}
+	}
+	if facetName(field) != "" {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @%s directive can't be used on a facet.",
+			typ.Name, field.Name, dir.Name)}
+	}
+	return nil
+}
+
+// generatedValidation rejects @generated on the fields of the input schema.  Only schema
+// generation marks fields with it.
+func generatedValidation(sch *ast.Schema,
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
+	return []*gqlerror.Error{gqlerror.ErrorPosf(
+		dir.Position,
+		"Type %s; Field %s: @%s directive is only for the fields that Dgraph generates.",
+		typ.Name, field.Name, dir.Name)}
+}
+
+// generatedTypeValidation rejects @generated on the types of the input schema.  Only schema
+// generation marks types with it.
+func generatedTypeValidation(schema *ast.Schema, typ *ast.Definition) gqlerror.List {
+	dir := typ.Directives.ForName(generatedDirective)
+	if dir == nil {
 		return nil
 	}
 	return []*gqlerror.Error{gqlerror.ErrorPosf(
 		dir.Position,
-		"Type %s; Field %s: with @id directive must be of type String!, not %s",
-		typ.Name, field.Name, field.Type.String())}
+		"Type %s; @%s directive is only for the types that Dgraph generates.",
+		typ.Name, dir.Name)}
+}
+
+// defaultValidation checks @default.  The default is what a node that's added without a value
+// for the field gets, so it must be a value of the field's type.
+func defaultValidation(sch *ast.Schema,
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
+	if err := defaultValueError(sch, typ, field); err != nil {
+		return []*gqlerror.Error{err}
+	}
+
+	for _, other := range []string{idDirective, customDirective, langDirective} {
+		if field.Directives.ForName(other) != nil {
+			return []*gqlerror.Error{gqlerror.ErrorPosf(
+				dir.Position,
+				"Type %s; Field %s: @%s directive can't be used together with @%s.",
+				typ.Name, field.Name, dir.Name, other)}
+		}
+	}
+	if audit := auditDirective(field); audit != nil {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @%s directive can't be used together with @%s.",
+			typ.Name, field.Name, dir.Name, audit.Name)}
+	}
+	if facetName(field) != "" {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @%s directive can't be used on a facet.",
+			typ.Name, field.Name, dir.Name)}
+	}
+	return nil
+}
+
+// defaultValueError returns an error if field, which has @default, isn't a scalar or enum field
+// that the default value is a value of.
+func defaultValueError(sch *ast.Schema, typ *ast.Definition,
+	field *ast.FieldDefinition) *gqlerror.Error {
+	dir := field.Directives.ForName(defaultDirective)
+	arg := dir.Arguments.ForName(defaultValueArg)
+	if arg == nil || arg.Value.Kind != ast.StringValue {
+		return gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: value argument for @%s directive should be a String.",
+			typ.Name, field.Name, dir.Name)
+	}
+
+	typName := field.Type.Name()
+	if field.Type.Elem != nil || (!defaultTypes[typName] && sch.Types[typName].Kind != ast.Enum) {
+		return gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @%s directive can't be used on a field of type %s.",
+			typ.Name, field.Name, dir.Name, field.Type.String())
+	}
+	if _, ok := defaultValue(sch, typName, arg.Value.Raw); !ok {
+		return gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @%s value \"%s\" isn't a value of type %s.",
+			typ.Name, field.Name, dir.Name, arg.Value.Raw, typName)
+	}
+	return nil
+}
+
+// authValidation checks @auth on a field.  A field can only have query rules made of RBAC
+// rules, because those are decided from the JWT alone and the field can then be left out of the
+// Dgraph query.
+func authValidation(sch *ast.Schema,
+	typ *ast.Definition,
+	field *ast.FieldDefinition,
+	dir *ast.Directive,
+	secrets map[string]x.SensitiveByteSlice) gqlerror.List {
+	if hasCustomDirective(field) {
+		return []*gqlerror.Error{gqlerror.ErrorPosf(
+			dir.Position,
+			"Type %s; Field %s: @auth directive can't be used together with @%s.",
+			typ.Name, field.Name, customDirective)}
+	}
+
+	var errs []*gqlerror.Error
+	for _, arg := range dir.Arguments {
+		if arg.Name != "query" {
+			errs = append(errs, gqlerror.ErrorPosf(
+				arg.Position,
+				"Type %s; Field %s: @auth on a field only supports query rules, %s rules "+
+					"are not yet supported on fields.",
+				typ.Name, field.Name, arg.Name))
+			continue
+		}
+		if hasGraphAuthRule(arg.Value) {
+			errs = append(errs, gqlerror.ErrorPosf(
+				arg.Position,
+				"Type %s; Field %s: @auth on a field only supports RBAC rules, like "+
+					"{$ROLE: {eq: \"ADMIN\"}}, graph rules are not yet supported on fields.",
+				typ.Name, field.Name))
+		}
+	}
+	return errs
+}
+
+// hasGraphAuthRule returns true if the @auth rule in val, or any rule nested in it with and,
+// or and not, is a graph rule rather than an RBAC rule.
+func hasGraphAuthRule(val *ast.Value) bool {
+	if val == nil {
+		return false
+	}
+	for _, child := range val.Children {
+		if val.Kind == ast.ObjectValue && child.Name == "rule" && child.Value != nil &&
+			!strings.HasPrefix(strings.TrimSpace(child.Value.Raw), RBACQueryPrefix) {
+			return true
+		}
+		if hasGraphAuthRule(child.Value) {
+			return true
+		}
+	}
+	return false
 }
 
 func searchMessage(sch *ast.Schema, field *ast.FieldDefinition) string {
@@ -1727,6 +2992,9 @@ func isQueryOrMutationType(typ *ast.Definition) bool {
 	return isQueryOrMutation(typ.Name)
 }
 
+// isQueryOrMutation reports whether name is one of the root types, whose fields are generated
+// or declared with @custom.  A Subscription is a root type too, its generated fields mirror the
+// queries.
 func isQueryOrMutation(name string) bool {
-	return name == "Query" || name == "Mutation"
+	return name == "Query" || name == "Mutation" || name == "Subscription"
 }
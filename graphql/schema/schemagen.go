@@ -17,11 +17,14 @@
 package schema
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/dgraph-io/dgraph/graphql/authorization"
 	"github.com/dgraph-io/dgraph/x"
@@ -38,6 +41,7 @@ type Handler interface {
 	DGSchema() string
 	GQLSchema() string
 	DisableSubscription()
+	Secrets() map[string]string
 }
 
 type handler struct {
@@ -45,11 +49,55 @@ type handler struct {
 	originalDefs   []string
 	completeSchema *ast.Schema
 	dgraphSchema   string
+
+	// allowedHeaders, schemaSecrets and authMeta are only used by requests once FromHandler
+	// builds a Schema from the handler.
+	allowedHeaders string
+	schemaSecrets  map[string]x.SensitiveByteSlice
+	authMeta       *authorization.AuthMeta
+	// remoteArgs are the required arguments of the remote queries of the @custom graphql
+	// fields, as introspected while validating the schema.
+	remoteArgs requiredRemoteArgs
+	// namespace is the namespace the schema is for, set with InNamespace.
+	namespace string
+
+	// emptyListsAsNull is set if the input schema opted out of completing missing lists as [].
+	emptyListsAsNull bool
+	// noTracePropagation is set if the input schema opted out of sending trace headers to
+	// remote endpoints.
+	noTracePropagation bool
+	// strictFieldAuth is set if the input schema opted in to errors for fields hidden by @auth.
+	strictFieldAuth bool
+	// relayIDs is set if the input schema opted in to Relay's global object identification.
+	relayIDs bool
+	// limits are the limits on mutations set by the input schema.
+	limits Limits
 }
 
+const (
+	// emptyListsAsNullComment in a schema makes list fields that have no value in Dgraph
+	// complete as null, rather than the default of [].
+	emptyListsAsNullComment = "# Dgraph.EmptyListsAsNull"
+	// noTracePropagationComment in a schema stops the W3C traceparent and tracestate headers
+	// being sent to remote endpoints, for endpoints that don't cope with unknown headers.
+	noTracePropagationComment = "# Dgraph.NoTracePropagation"
+	// strictFieldAuthComment in a schema makes a field whose @auth rule is false for the JWT
+	// complete with an error, rather than the default of just null.
+	strictFieldAuthComment = "# Dgraph.StrictFieldAuth"
+	// relayIDsComment in a schema makes it follow Relay's global object identification: the
+	// types with an ID implement the Node interface, there's a node query, and IDs are given
+	// out and taken in as base64(TypeName:uid) rather than as uids.
+	relayIDsComment = "# Dgraph.RelayIDs"
+)
+
 // FromString builds a GraphQL Schema from input string, or returns any parsing
 // or validation errors.
 func FromString(schema string) (Schema, error) {
+	return FromStringCtx(context.Background(), schema)
+}
+
+// FromStringCtx is like FromString, but stops building the schema as soon as ctx is done.
+func FromStringCtx(ctx context.Context, schema string) (Schema, error) {
 	// validator.Prelude includes a bunch of predefined types which help with schema introspection
 	// queries, hence we include it as part of the schema.
 	doc, gqlErr := parser.ParseSchemas(validator.Prelude, &ast.Source{Input: schema})
@@ -62,11 +110,74 @@ func FromString(schema string) (Schema, error) {
 		return nil, errors.Wrap(gqlErr, "while validating GraphQL schema")
 	}
 
-	return AsSchema(gqlSchema)
+	sch, err := asSchema(ctx, gqlSchema)
+	if err != nil {
+		return nil, err
+	}
+	sch.emptyListsAsNull = hasSchemaComment(schema, emptyListsAsNullComment)
+	sch.noTracePropagation = hasSchemaComment(schema, noTracePropagationComment)
+	sch.strictFieldAuth = hasSchemaComment(schema, strictFieldAuthComment)
+	sch.relayIDs = hasSchemaComment(schema, relayIDsComment)
+	if sch.limits, err = ParseLimits(schema); err != nil {
+		return nil, err
+	}
+	defns := make([]string, 0, len(gqlSchema.Types))
+	for name, defn := range gqlSchema.Types {
+		if !defn.BuiltIn {
+			defns = append(defns, name)
+		}
+	}
+	sch.allowedHeaders = getAllowedHeaders(gqlSchema, defns, nil)
+
+	return sch, nil
+}
+
+// FromHandler builds the GraphQL Schema of h, a handler returned by NewHandler.  Unlike a
+// schema built by FromString from h.GQLSchema(), it has everything of h that isn't in the
+// generated schema: its namespace, secrets and authorization.
+func FromHandler(ctx context.Context, h Handler) (Schema, error) {
+	hdlr, ok := h.(*handler)
+	if !ok {
+		return nil, errors.Errorf("FromHandler can only build the schema of a handler " +
+			"returned by NewHandler")
+	}
+	sch, err := FromStringCtx(ctx, hdlr.GQLSchema())
+	if err != nil {
+		return nil, err
+	}
+	s := sch.(*schema)
+	s.namespace = hdlr.namespace
+	s.secrets = hdlr.schemaSecrets
+	s.allowedHeaders = hdlr.allowedHeaders
+	s.authMeta = hdlr.authMeta
+	s.remoteArgs = hdlr.remoteArgs
+	return s, nil
 }
 
 func (s *handler) GQLSchema() string {
-	return Stringify(s.completeSchema, s.originalDefs)
+	// The generated schema doesn't keep the input's comments, so carry the opt-outs over
+	// for FromString to find.
+	var opts strings.Builder
+	if s.emptyListsAsNull {
+		opts.WriteString(emptyListsAsNullComment + "\n")
+	}
+	if s.noTracePropagation {
+		opts.WriteString(noTracePropagationComment + "\n")
+	}
+	if s.strictFieldAuth {
+		opts.WriteString(strictFieldAuthComment + "\n")
+	}
+	if s.relayIDs {
+		opts.WriteString(relayIDsComment + "\n")
+	}
+	if s.limits != (Limits{}) {
+		b, _ := json.Marshal(s.limits)
+		opts.WriteString(limitsComment + " " + string(b) + "\n")
+	}
+	if opts.Len() > 0 {
+		opts.WriteString("\n")
+	}
+	return opts.String() + Stringify(s.completeSchema, s.originalDefs)
 }
 
 func (s *handler) DGSchema() string {
@@ -74,37 +185,412 @@ func (s *handler) DGSchema() string {
 }
 
 func (s *handler) DisableSubscription() {
-	s.completeSchema.Subscription = nil
+	removeSubscriptions(s.completeSchema)
 }
 
-func parseSecrets(sch string) (map[string]string, error) {
-	m := make(map[string]string)
-	scanner := bufio.NewScanner(strings.NewReader(sch))
-	authSecret := ""
-	for scanner.Scan() {
-		text := strings.TrimSpace(scanner.Text())
+// Secrets returns the secrets given in the schema with # Dgraph.Secret.  The map is a copy, so
+// changing it doesn't change the secrets that custom resolvers use.
+func (s *handler) Secrets() map[string]string {
+	secrets := make(map[string]string, len(s.schemaSecrets))
+	for k, v := range s.schemaSecrets {
+		secrets[k] = string(v)
+	}
+	return secrets
+}
+
+// generateComment in a schema turns off parts of the schema generation for the whole schema,
+// e.g. `# Dgraph.Generate subscription=false`.
+const generateComment = "# Dgraph.Generate"
+
+// generateOptions are the parts of the schema generation that a schema can turn off.
+type generateOptions struct {
+	subscription bool
+}
+
+// parseGenerateOptions finds the generate options set by the generateComment in sch.
+// Everything is generated if there's no such comment.
+func parseGenerateOptions(sch string) (generateOptions, error) {
+	opts := generateOptions{subscription: true}
+	for _, cl := range dgraphCommentLines(sch, generateComment) {
+		text := cl.text
+		parts := strings.Fields(strings.TrimPrefix(text, generateComment))
+		if len(parts) == 0 {
+			return opts, errors.Errorf("incorrect format for specifying Dgraph generate "+
+				"options found for comment: `%s`, it should be `%s subscription=false`",
+				text, generateComment)
+		}
+		for _, part := range parts {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 || kv[0] != "subscription" {
+				return opts, errors.Errorf("unsupported Dgraph generate option `%s` found for "+
+					"comment: `%s`, the only supported option is subscription", part, text)
+			}
+			val, err := strconv.ParseBool(kv[1])
+			if err != nil {
+				return opts, errors.Errorf("incorrect value `%s` for Dgraph generate option "+
+					"subscription found for comment: `%s`, it should be true or false",
+					kv[1], text)
+			}
+			opts.subscription = val
+		}
+	}
+	return opts, nil
+}
+
+// predicateNamingComment in a schema sets how the predicates of the fields that don't have
+// @dgraph(pred: ...) are named.  The default, `# Dgraph.PredicateNaming typed`, names them
+// TypeName.fieldName, and `# Dgraph.PredicateNaming flat` names them just fieldName, for schemas
+// over data whose predicates aren't prefixed with their type.
+const predicateNamingComment = "# Dgraph.PredicateNaming"
+
+// parsePredicateNaming returns true if sch names predicates flat with predicateNamingComment.
+func parsePredicateNaming(sch string) (bool, error) {
+	flat := false
+	for _, cl := range dgraphCommentLines(sch, predicateNamingComment) {
+		text := cl.text
+		switch naming := strings.TrimSpace(strings.TrimPrefix(text,
+			predicateNamingComment)); naming {
+		case "typed":
+			flat = false
+		case "flat":
+			flat = true
+		default:
+			return false, errors.Errorf("incorrect value `%s` for predicate naming found for "+
+				"comment: `%s`, it should be typed or flat", naming, text)
+		}
+	}
+	return flat, nil
+}
+
+// baseURLComment gives the URL that relative @custom URLs are resolved against, e.g.
+// `# Dgraph.BaseURL "http://movies.internal:8080"` makes `url: "/v1/movies/$id"` the URL
+// http://movies.internal:8080/v1/movies/$id.
+const baseURLComment = "# Dgraph.BaseURL"
+
+// parseBaseURL returns the URL given in sch with baseURLComment, or "" if sch doesn't have one.
+func parseBaseURL(sch string) (string, error) {
+	base := ""
+	for _, cl := range dgraphCommentLines(sch, baseURLComment) {
+		text := cl.text
+		if base != "" {
+			return "", errors.Errorf("Dgraph.BaseURL should only be specified once in "+
+				"a schema, found second mention: %v", text)
+		}
+
+		val := strings.TrimSpace(strings.TrimPrefix(text, baseURLComment))
+		if len(val) < 2 || strings.Count(val, `"`) != 2 || val[0] != '"' ||
+			val[len(val)-1] != '"' {
+			return "", errors.Errorf("incorrect format for specifying base URL found for "+
+				"comment: `%s`, it should be `# Dgraph.BaseURL \"url\"`", text)
+		}
+		base = strings.Trim(val, `"`)
+		u, err := url.Parse(base)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "", errors.Errorf("incorrect base URL `%s` found for comment: `%s`, it "+
+				"should be like http://host/path", base, text)
+		}
+	}
+	return base, nil
+}
+
+// resolveCustomURLs makes the relative URLs, like /v1/movies/$id, of the @custom directives
+// in doc absolute by appending them to base.  After that, the schema is exactly as if the full
+// URLs had been written out, so the URL variables are substituted into the full URL.
+func resolveCustomURLs(doc *ast.SchemaDocument, base string) gqlerror.List {
+	var errs gqlerror.List
+	for _, defn := range append(doc.Definitions, doc.Extensions...) {
+		if defn.BuiltIn {
+			continue
+		}
+		for _, fld := range defn.Fields {
+			dir := fld.Directives.ForName(customDirective)
+			if dir == nil {
+				continue
+			}
+			httpArg := dir.Arguments.ForName("http")
+			if httpArg == nil || httpArg.Value == nil {
+				continue
+			}
+			for _, httpVal := range listValues(httpArg.Value) {
+				urlVal := httpVal.Children.ForName("url")
+				if urlVal == nil || !strings.HasPrefix(urlVal.Raw, "/") {
+					continue
+				}
+				if base == "" {
+					errs = append(errs, gqlerror.ErrorPosf(urlVal.Position,
+						"Type %s; Field %s; url %s inside @custom directive is relative, but "+
+							"the schema has no %s to resolve it against.", defn.Name, fld.Name,
+						urlVal.Raw, baseURLComment))
+					continue
+				}
+				urlVal.Raw = strings.TrimSuffix(base, "/") + urlVal.Raw
+			}
+		}
+	}
+	return errs
+}
 
-		if strings.HasPrefix(text, "# Dgraph.Authorization") {
-			if authSecret != "" {
-				return nil, errors.Errorf("Dgraph.Authorization should be only be specified once in "+
-					"a schema, found second mention: %v", text)
+// limitsComment in a schema sets the limits on requests, e.g.
+// # Dgraph.Limits {"maxMutationNodes": 10000, "maxRequestBytes": 4194304}
+const limitsComment = "# Dgraph.Limits"
+
+// Limits are the limits on requests that a schema sets with limitsComment.  A limit that's 0
+// isn't enforced, apart from MaxLoopbackDepth and MaxAliasLength, which then have defaults.
+type Limits struct {
+	// MaxMutationNodes is the most nodes that a mutation can add or link to, counting those in
+	// nested objects and lists.
+	MaxMutationNodes int `json:"maxMutationNodes,omitempty"`
+	// MaxRequestBytes is the most bytes of mutation JSON that a mutation can send to Dgraph.
+	MaxRequestBytes int `json:"maxRequestBytes,omitempty"`
+	// MaxLoopbackDepth is how deep @custom requests to LoopbackURL can be nested, when the
+	// request that one makes has a field that makes another.
+	MaxLoopbackDepth int `json:"maxLoopbackDepth,omitempty"`
+	// MaxAliasLength is the most characters that the alias of a field in an operation can have.
+	MaxAliasLength int `json:"maxAliasLength,omitempty"`
+}
+
+// DefaultMaxAliasLength is the most characters that an alias can have, if the schema's limits
+// don't say.
+const DefaultMaxAliasLength = 256
+
+// AliasLength returns the most characters that the alias of a field in an operation can have.
+func (l Limits) AliasLength() int {
+	if l.MaxAliasLength == 0 {
+		return DefaultMaxAliasLength
+	}
+	return l.MaxAliasLength
+}
+
+// ParseLimits returns the limits set by the limitsComment in sch.  Nothing is limited if
+// there's no such comment.
+func ParseLimits(sch string) (Limits, error) {
+	var limits Limits
+	found := false
+	for _, cl := range dgraphCommentLines(sch, limitsComment) {
+		text := cl.text
+		if found {
+			return limits, errors.Errorf("%s is given more than once, the limits should all "+
+				"be in one comment", limitsComment)
+		}
+		found = true
+
+		dec := json.NewDecoder(bytes.NewBufferString(strings.TrimPrefix(text, limitsComment)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&limits); err != nil {
+			return limits, errors.Errorf("incorrect format for specifying Dgraph limits found "+
+				"for comment: `%s`, it should be `%s {\"maxMutationNodes\": 10000, "+
+				"\"maxRequestBytes\": 4194304}`: %s", text, limitsComment, err)
+		}
+		if limits.MaxMutationNodes < 0 || limits.MaxRequestBytes < 0 ||
+			limits.MaxLoopbackDepth < 0 || limits.MaxAliasLength < 0 {
+			return limits, errors.Errorf("Dgraph limits found for comment: `%s` can't be "+
+				"negative", text)
+		}
+	}
+	return limits, nil
+}
+
+// hasSchemaComment reports whether sch has comment, one of the dgraphComments that's all there
+// is to its option, on a line of its own.
+func hasSchemaComment(sch, comment string) bool {
+	for _, cl := range dgraphCommentLines(sch, comment) {
+		if cl.text == comment {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// secretComment gives a secret that @custom directives can send in headers, e.g.
+	// `# Dgraph.Secret GITHUB_API_TOKEN "token"`.
+	secretComment = "# Dgraph.Secret"
+	// authorizationComment gives how the JWTs of requests are verified and where the claims
+	// are in them.  See authorization.AuthMeta.
+	authorizationComment = "# Dgraph.Authorization"
+)
+
+// A dgraphComment is a kind of `# Dgraph.X` comment, which sets an option of the whole schema
+// rather than being just a comment.
+type dgraphComment struct {
+	// prefix is what the comments of this kind start with, like # Dgraph.Limits.
+	prefix string
+	// oneFile is true if the comment can only be in one of the files of a schema made of
+	// several files.
+	oneFile bool
+}
+
+// dgraphComments are all the kinds of `# Dgraph.X` comment that set the options of a schema.
+// Each option is parsed from the lines that dgraphCommentLines finds for it, and
+// NormalizeSchema keeps them all together at the end of the schema.  The fileComment isn't one
+// of them: it marks where a file starts, so it has to stay where it is.
+var dgraphComments = []dgraphComment{
+	{prefix: secretComment, oneFile: true},
+	{prefix: authorizationComment, oneFile: true},
+	{prefix: authRuleComment},
+	{prefix: importComment},
+	{prefix: generateComment},
+	{prefix: limitsComment},
+	{prefix: predicateNamingComment},
+	{prefix: baseURLComment},
+	{prefix: emptyListsAsNullComment},
+	{prefix: noTracePropagationComment},
+	{prefix: strictFieldAuthComment},
+	{prefix: relayIDsComment},
+}
+
+// dgraphCommentFor returns the kind of `# Dgraph.X` comment that text, a trimmed line of a
+// schema, is, or nil if it isn't one of the dgraphComments.
+func dgraphCommentFor(text string) *dgraphComment {
+	for i := range dgraphComments {
+		if strings.HasPrefix(text, dgraphComments[i].prefix) {
+			return &dgraphComments[i]
+		}
+	}
+	return nil
+}
+
+// A commentLine is a line of a schema, trimmed of the space around it.  Lines are numbered
+// from 1.
+type commentLine struct {
+	line int
+	text string
+}
+
+// dgraphCommentLines returns the lines of sch that are a comment starting with prefix, the
+// prefix of one of the dgraphComments, in the order they are in sch.
+func dgraphCommentLines(sch, prefix string) []commentLine {
+	var lines []commentLine
+	for i, line := range strings.Split(sch, "\n") {
+		text := strings.TrimSpace(line)
+		if kind := dgraphCommentFor(text); kind != nil && kind.prefix == prefix {
+			lines = append(lines, commentLine{line: i + 1, text: text})
+		}
+	}
+	return lines
+}
+
+// fileComment starts a new file in a schema made of several files, e.g.
+// `# Dgraph.File users.graphql`.  Errors in the schema then give the file and the line in it.
+const fileComment = "# Dgraph.File"
+
+// splitSchemaFiles splits sch at the fileComment lines into a source for each file.  Anything
+// before the first fileComment becomes a source without a name, as does all of sch if it has no
+// fileComment.
+func splitSchemaFiles(sch string) ([]*ast.Source, error) {
+	var sources []*ast.Source
+	current := &ast.Source{}
+	var text strings.Builder
+	nextFile := func() {
+		current.Input = text.String()
+		if current.Name != "" || strings.TrimSpace(current.Input) != "" {
+			sources = append(sources, current)
+		}
+		text.Reset()
+	}
+
+	files := make(map[string]bool)
+	for _, line := range strings.SplitAfter(sch, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != fileComment && !strings.HasPrefix(trimmed, fileComment+" ") {
+			text.WriteString(line)
+			continue
+		}
+
+		nextFile()
+		name := strings.TrimSpace(strings.TrimPrefix(trimmed, fileComment))
+		if name == "" {
+			return nil, errors.Errorf("incorrect format for specifying Dgraph file found for "+
+				"comment: `%s`, it should be `%s name`", trimmed, fileComment)
+		}
+		if files[name] {
+			return nil, errors.Errorf("file %s is given more than once in the schema", name)
+		}
+		files[name] = true
+		current = &ast.Source{Name: name}
+	}
+	nextFile()
+
+	if len(files) == 0 {
+		return []*ast.Source{{Input: sch}}, nil
+	}
+
+	for _, comment := range dgraphComments {
+		if !comment.oneFile {
+			continue
+		}
+		var in []string
+		for _, src := range sources {
+			if len(dgraphCommentLines(src.Input, comment.prefix)) > 0 {
+				in = append(in, fileName(src))
 			}
-			authSecret = text
+		}
+		if len(in) > 1 {
+			return nil, errors.Errorf("%s is given in files %s, it can only be given in one "+
+				"file of the schema", comment.prefix, strings.Join(in, " and "))
+		}
+	}
+	return sources, nil
+}
+
+// fileName is the name of src in errors.
+func fileName(src *ast.Source) string {
+	if src.Name == "" {
+		return "input"
+	}
+	return src.Name
+}
+
+// definedInOneFile checks that no type of doc is defined in more than one file of the schema.
+// Definitions can be added to from other files with `extend type`.
+func definedInOneFile(doc *ast.SchemaDocument) gqlerror.List {
+	var errs gqlerror.List
+	defined := make(map[string]*ast.Definition)
+	for _, defn := range doc.Definitions {
+		if defn.BuiltIn {
 			continue
 		}
-		if !strings.HasPrefix(text, "# Dgraph.Secret") {
+		prev, ok := defined[defn.Name]
+		if !ok {
+			defined[defn.Name] = defn
 			continue
 		}
+		// A type defined twice in the same file is reported by GraphQL validation.
+		if prev.Position.Src != defn.Position.Src {
+			errs = append(errs, gqlerror.ErrorPosf(defn.Position,
+				"Type %s is defined in both %s and %s, a type can only be defined in one file "+
+					"of the schema, other files can use extend type to add to it.", defn.Name,
+				fileName(prev.Position.Src), fileName(defn.Position.Src)))
+		}
+	}
+	return errs
+}
+
+// parseSecrets returns the # Dgraph.Secret values in sch, and its # Dgraph.Authorization, which
+// is nil if sch doesn't have one.
+func parseSecrets(sch string) (map[string]string, *authorization.AuthMeta, error) {
+	m := make(map[string]string)
+	authSecret := ""
+	for _, cl := range dgraphCommentLines(sch, authorizationComment) {
+		if authSecret != "" {
+			return nil, nil, errors.Errorf("Dgraph.Authorization should be only be specified once in "+
+				"a schema, found second mention: %v", cl.text)
+		}
+		authSecret = cl.text
+	}
+
+	for _, cl := range dgraphCommentLines(sch, secretComment) {
+		text := cl.text
 		parts := strings.Fields(text)
 		const doubleQuotesCode = 34
 
 		if len(parts) < 4 {
-			return nil, errors.Errorf("incorrect format for specifying Dgraph secret found for "+
+			return nil, nil, errors.Errorf("incorrect format for specifying Dgraph secret found for "+
 				"comment: `%s`, it should be `# Dgraph.Secret key value`", text)
 		}
 		val := strings.Join(parts[3:], " ")
 		if strings.Count(val, `"`) != 2 || val[0] != doubleQuotesCode || val[len(val)-1] != doubleQuotesCode {
-			return nil, errors.Errorf("incorrect format for specifying Dgraph secret found for "+
+			return nil, nil, errors.Errorf("incorrect format for specifying Dgraph secret found for "+
 				"comment: `%s`, it should be `# Dgraph.Secret key value`", text)
 		}
 
@@ -113,24 +599,94 @@ func parseSecrets(sch string) (map[string]string, error) {
 		m[key] = val
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, errors.Wrapf(err, "while trying to parse secrets from schema file")
-	}
 	if authSecret == "" {
-		return m, nil
+		return m, nil, nil
+	}
+	meta, err := authorization.NewAuthMeta(authSecret)
+	return m, meta, err
+}
+
+// A HandlerOption changes how NewHandler processes the input schema.
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	// predicateName, if set, names the Dgraph predicates of the fields that aren't given one
+	// with @dgraph(pred: ...).
+	predicateName func(typeName, fieldName string) string
+	// namespace is the namespace the schema is for.
+	namespace string
+}
+
+// InNamespace makes the schema the one for namespace ns.  Its authorization only applies to
+// the requests for ns, which are resolved through the Registry the schema is set in.
+func InNamespace(ns string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.namespace = ns
+	}
+}
+
+// WithPredicateNames makes fn name the Dgraph predicate of each field that's stored in Dgraph
+// and doesn't have @dgraph(pred: ...), rather than it being TypeName.fieldName.  fn gets the
+// type's Dgraph name, which @dgraph(type: ...) can change, and the field's name.  A field a
+// type inherits from an interface is named for the interface.  If fn returns "", the field
+// keeps the default name.
+//
+// The names are written into the generated schema as @dgraph(pred: ...), so a schema built from
+// GQLSchema() maps to the same predicates without fn.
+func WithPredicateNames(fn func(typeName, fieldName string) string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.predicateName = fn
 	}
-	err := authorization.ParseAuthMeta(authSecret)
-	return m, err
 }
 
 // NewHandler processes the input schema. If there are no errors, it returns
 // a valid Handler, otherwise it returns nil and an error.
-func NewHandler(input string) (Handler, error) {
+func NewHandler(input string, opts ...HandlerOption) (Handler, error) {
+	return NewHandlerCtx(context.Background(), input, opts...)
+}
+
+// NewHandlerCtx is like NewHandler, but stops processing the schema as soon as ctx is done.
+// The error returned then is ctx.Err(), wrapped with how far the schema generation got.
+func NewHandlerCtx(ctx context.Context, input string, opts ...HandlerOption) (Handler, error) {
+	h, err := newHandler(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// newHandler does all the processing for NewHandler.
+func newHandler(ctx context.Context, input string, opts ...HandlerOption) (*handler, error) {
 	if input == "" {
 		return nil, gqlerror.Errorf("No schema specified")
 	}
 
-	secrets, err := parseSecrets(input)
+	var options handlerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	secrets, authMeta, err := parseSecrets(input)
+	if err != nil {
+		return nil, err
+	}
+	genOpts, err := parseGenerateOptions(input)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := ParseLimits(input)
+	if err != nil {
+		return nil, err
+	}
+	imports, err := parseImports(input)
+	if err != nil {
+		return nil, err
+	}
+	flatPredicates, err := parsePredicateNaming(input)
+	if err != nil {
+		return nil, err
+	}
+	baseURL, err := parseBaseURL(input)
 	if err != nil {
 		return nil, err
 	}
@@ -168,12 +724,52 @@ func NewHandler(input string) (Handler, error) {
 	// Then we can complete the process by adding in queries and mutations etc. to
 	// make the final full GraphQL schema.
 
-	doc, gqlErr := parser.ParseSchemas(validator.Prelude, &ast.Source{Input: input})
+	namedAuthRules, gqlErrList := parseNamedAuthRules(input)
+	if gqlErrList != nil {
+		return nil, gqlErrList
+	}
+
+	files, err := splitSchemaFiles(input)
+	if err != nil {
+		return nil, err
+	}
+	doc, gqlErr := parser.ParseSchemas(append([]*ast.Source{validator.Prelude}, files...)...)
 	if gqlErr != nil {
 		return nil, gqlerror.List{gqlErr}
 	}
 
-	gqlErrList := preGQLValidation(doc)
+	gqlErrList = definedInOneFile(doc)
+	if gqlErrList != nil {
+		return nil, gqlErrList
+	}
+
+	gqlErrList = importRemoteTypes(doc, imports)
+	if gqlErrList != nil {
+		return nil, gqlErrList
+	}
+
+	gqlErrList = inlineAuthRuleRefs(doc, namedAuthRules)
+	if gqlErrList != nil {
+		return nil, gqlErrList
+	}
+
+	gqlErrList = resolveCustomURLs(doc, baseURL)
+	if gqlErrList != nil {
+		return nil, gqlErrList
+	}
+
+	if options.predicateName == nil && flatPredicates {
+		if gqlErrList = flatPredicateConflicts(doc); gqlErrList != nil {
+			return nil, gqlErrList
+		}
+		options.predicateName = flatPredicateName
+	}
+	if options.predicateName != nil {
+		namePredicates(doc, options.predicateName)
+	}
+
+	addExtendedQueryAndMutation(doc)
+	gqlErrList = preGQLValidation(doc)
 	if gqlErrList != nil {
 		return nil, gqlErrList
 	}
@@ -201,48 +797,60 @@ func NewHandler(input string) (Handler, error) {
 		return nil, gqlerror.List{gqlErr}
 	}
 
-	gqlErrList = postGQLValidation(sch, defns, schemaSecrets)
+	gqlErrList, remoteArgs, err := postGQLValidation(ctx, sch, defns, schemaSecrets)
+	if err != nil {
+		return nil, err
+	}
 	if gqlErrList != nil {
 		return nil, gqlErrList
 	}
 
-	headers := getAllowedHeaders(sch, defns)
-	dgSchema := genDgSchema(sch, typesToComplete)
-	completeSchema(sch, typesToComplete)
+	headers := getAllowedHeaders(sch, defns, authMeta)
+	dgSchema, err := genDgSchema(ctx, sch, typesToComplete)
+	if err != nil {
+		return nil, err
+	}
+	if err = completeSchema(ctx, sch, typesToComplete); err != nil {
+		return nil, err
+	}
+	relayIDs := hasSchemaComment(input, relayIDsComment)
+	if relayIDs {
+		// Node is added after the Dgraph schema is generated because it isn't stored in Dgraph.
+		if errs := addRelayNode(sch, defns); errs != nil {
+			return nil, errs
+		}
+	}
+	if !genOpts.subscription {
+		removeSubscriptions(sch)
+	}
 
 	if len(sch.Query.Fields) == 0 && len(sch.Mutation.Fields) == 0 {
 		return nil, gqlerror.Errorf("No query or mutation found in the generated schema")
 	}
 
-	hc.Lock()
-	hc.allowed = headers
-	hc.secrets = schemaSecrets
-	hc.Unlock()
-
 	return &handler{
-		input:          input,
-		dgraphSchema:   dgSchema,
-		completeSchema: sch,
-		originalDefs:   defns,
+		input:              input,
+		dgraphSchema:       dgSchema,
+		completeSchema:     sch,
+		originalDefs:       defns,
+		allowedHeaders:     headers,
+		schemaSecrets:      schemaSecrets,
+		authMeta:           authMeta,
+		remoteArgs:         remoteArgs,
+		namespace:          options.namespace,
+		emptyListsAsNull:   hasSchemaComment(input, emptyListsAsNullComment),
+		noTracePropagation: hasSchemaComment(input, noTracePropagationComment),
+		strictFieldAuth:    hasSchemaComment(input, strictFieldAuthComment),
+		relayIDs:           relayIDs,
+		limits:             limits,
 	}, nil
 }
 
-type headersConfig struct {
-	// comma separated list of allowed headers. These are parsed from the forwardHeaders specified
-	// in the @custom directive. They are returned to the client as part of
-	// Access-Control-Allow-Headers.
-	allowed string
-	// secrets are key value pairs stored in the GraphQL schema which can be added as headers
-	// to requests which resolve custom queries/mutations.
-	secrets map[string]x.SensitiveByteSlice
-	sync.RWMutex
-}
-
-var hc = headersConfig{
-	allowed: x.AccessControlAllowedHeaders,
-}
-
-func getAllowedHeaders(sch *ast.Schema, definitions []string) string {
+// getAllowedHeaders returns the headers that clients can send for the schema sch: the forwarded
+// headers of its @custom directives, and the JWT header and allowed header claims of authMeta,
+// on top of the ones that are always allowed.
+func getAllowedHeaders(sch *ast.Schema, definitions []string,
+	authMeta *authorization.AuthMeta) string {
 	headers := make(map[string]struct{})
 
 	setHeaders := func(dir *ast.Directive) {
@@ -254,16 +862,18 @@ func getAllowedHeaders(sch *ast.Schema, definitions []string) string {
 		if httpArg == nil {
 			return
 		}
-		forwardHeaders := httpArg.Value.Children.ForName("forwardHeaders")
-		if forwardHeaders == nil {
-			return
-		}
-		for _, h := range forwardHeaders.Children {
-			key := strings.Split(h.Value.Raw, ":")
-			if len(key) == 1 {
-				key = []string{h.Value.Raw, h.Value.Raw}
+		for _, httpVal := range listValues(httpArg.Value) {
+			forwardHeaders := httpVal.Children.ForName("forwardHeaders")
+			if forwardHeaders == nil {
+				continue
+			}
+			for _, h := range forwardHeaders.Children {
+				key := strings.Split(h.Value.Raw, ":")
+				if len(key) == 1 {
+					key = []string{h.Value.Raw, h.Value.Raw}
+				}
+				headers[key[1]] = struct{}{}
 			}
-			headers[key[1]] = struct{}{}
 		}
 	}
 
@@ -282,9 +892,13 @@ func getAllowedHeaders(sch *ast.Schema, definitions []string) string {
 		finalHeaders = append(finalHeaders, h)
 	}
 
-	// Add Auth Header to allowed headers list
-	if authorization.GetHeader() != "" {
-		finalHeaders = append(finalHeaders, authorization.GetHeader())
+	if authMeta != nil {
+		// Add Auth Header to allowed headers list
+		if authMeta.Header != "" {
+			finalHeaders = append(finalHeaders, authMeta.Header)
+		}
+		// So browsers can send the headers that auth rules use
+		finalHeaders = append(finalHeaders, authMeta.AllowedHeaderClaims...)
 	}
 
 	allowed := x.AccessControlAllowedHeaders
@@ -296,17 +910,12 @@ func getAllowedHeaders(sch *ast.Schema, definitions []string) string {
 	return allowed
 }
 
-func AllowedHeaders() string {
-	hc.RLock()
-	defer hc.RUnlock()
-	return hc.allowed
-}
-
 func getAllSearchIndexes(val *ast.Value) []string {
 	res := make([]string, len(val.Children))
 
 	for i, child := range val.Children {
-		res[i] = supportedSearches[child.Value.Raw].dgIndex
+		search, _ := searchFor(child.Value.Raw)
+		res[i] = search.dgIndex
 	}
 
 	return res
@@ -325,6 +934,138 @@ func typeName(def *ast.Definition) string {
 	return typeArg.Value.Raw
 }
 
+// A typeField is a field of a type, along with the type.
+type typeField struct {
+	defn *ast.Definition
+	fld  *ast.FieldDefinition
+}
+
+// defaultPredicateFields returns the fields of the types in doc that are stored in Dgraph, but
+// don't have @dgraph(pred: ...), so their predicates get the default names.
+func defaultPredicateFields(doc *ast.SchemaDocument) []typeField {
+	var flds []typeField
+	for _, defn := range doc.Definitions {
+		if defn.BuiltIn || isQueryOrMutationType(defn) ||
+			(defn.Kind != ast.Object && defn.Kind != ast.Interface) ||
+			defn.Directives.ForName(remoteDirective) != nil {
+			continue
+		}
+		for _, fld := range defn.Fields {
+			if isID(fld) || hasCustomDirective(fld) || facetName(fld) != "" ||
+				getDgraphDirPredArg(fld) != nil {
+				continue
+			}
+			flds = append(flds, typeField{defn: defn, fld: fld})
+		}
+	}
+	return flds
+}
+
+// namePredicates gives each field of the types in doc that's stored in Dgraph, and that doesn't
+// have @dgraph(pred: ...), the predicate fn names, as if it had been written with
+// @dgraph(pred: ...).  The fields a type inherits from an interface aren't copied into the type
+// yet, so they get the interface's name for them.
+func namePredicates(doc *ast.SchemaDocument, fn func(typeName, fieldName string) string) {
+	for _, tf := range defaultPredicateFields(doc) {
+		fld := tf.fld
+		pred := fn(typeName(tf.defn), fld.Name)
+		if pred == "" {
+			continue
+		}
+		arg := &ast.Argument{
+			Name:     dgraphPredArg,
+			Value:    &ast.Value{Kind: ast.StringValue, Raw: pred, Position: fld.Position},
+			Position: fld.Position,
+		}
+		if dir := fld.Directives.ForName(dgraphDirective); dir != nil {
+			dir.Arguments = append(dir.Arguments, arg)
+			continue
+		}
+		fld.Directives = append(fld.Directives, &ast.Directive{
+			Name:      dgraphDirective,
+			Arguments: ast.ArgumentList{arg},
+			Position:  fld.Position,
+		})
+	}
+}
+
+// flatPredicateName names the predicate of a field just by the field's name, for
+// `# Dgraph.PredicateNaming flat`.
+func flatPredicateName(typeName, fieldName string) string {
+	return fieldName
+}
+
+// flatPredicateConflicts returns an error for each field of the types in doc that would be
+// stored in the same flat named predicate as a field of another type, but has a different
+// GraphQL type or different indexes than it.  Both fields would then need different Dgraph
+// schemas for the one predicate.  The error is at both fields.
+func flatPredicateConflicts(doc *ast.SchemaDocument) gqlerror.List {
+	var errs gqlerror.List
+	first := make(map[string]typeField)
+	for _, tf := range defaultPredicateFields(doc) {
+		prev, ok := first[tf.fld.Name]
+		if !ok {
+			first[tf.fld.Name] = tf
+			continue
+		}
+
+		var what, this, that string
+		switch {
+		case predicateType(tf.fld.Type) != predicateType(prev.fld.Type):
+			what = "type"
+			this, that = predicateType(tf.fld.Type), predicateType(prev.fld.Type)
+		case searchIndexes(tf.fld) != searchIndexes(prev.fld):
+			what = "indexes"
+			this, that = searchIndexes(tf.fld), searchIndexes(prev.fld)
+		default:
+			continue
+		}
+		err := gqlerror.ErrorPosf(tf.fld.Position, "Type %s; Field %s: has %s %s, which is "+
+			"different to type %s; field %s, which has %s %s, but both are stored in the "+
+			"predicate %s because of %s flat. These fields must have the same %s, or use "+
+			"different Dgraph predicates with @dgraph(pred: ...).", tf.defn.Name, tf.fld.Name,
+			what, this, prev.defn.Name, prev.fld.Name, what, that, tf.fld.Name,
+			predicateNamingComment, what)
+		err.Locations = append(err.Locations, gqlerror.Location{
+			Line:   prev.fld.Position.Line,
+			Column: prev.fld.Position.Column,
+		})
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// predicateType returns typ as it's stored in a predicate, so without it being non-null.
+func predicateType(typ *ast.Type) string {
+	if typ.Elem != nil {
+		return "[" + typ.Name() + "]"
+	}
+	return typ.Name()
+}
+
+// searchIndexes returns the arguments of @search on fld in a canonical form, so the same
+// indexes always give the same string, or "no @search" if fld isn't searchable.
+func searchIndexes(fld *ast.FieldDefinition) string {
+	search := fld.Directives.ForName(searchDirective)
+	if search == nil {
+		return "no @search"
+	}
+	args := make([]string, 0, len(search.Arguments))
+	for _, arg := range search.Arguments {
+		vals := []string{arg.Value.Raw}
+		if len(arg.Value.Children) > 0 {
+			vals = vals[:0]
+			for _, child := range arg.Value.Children {
+				vals = append(vals, child.Value.Raw)
+			}
+		}
+		sort.Strings(vals)
+		args = append(args, arg.Name+": ["+strings.Join(vals, ", ")+"]")
+	}
+	sort.Strings(args)
+	return "@search(" + strings.Join(args, ", ") + ")"
+}
+
 // fieldName returns the dgraph predicate corresponding to a field.
 // If the field had a dgraph directive, then it returns the value of the pred arg otherwise
 // it returns typeName + "." + fieldName.
@@ -345,8 +1086,19 @@ func getDgraphDirPredArg(def *ast.FieldDefinition) *ast.Argument {
 	return predArg
 }
 
+// generationStopped returns nil if ctx isn't done yet.  Otherwise, it returns the error for ctx
+// wrapped with the pass of schema generation that was stopped and how many of the total types
+// that pass had finished.
+func generationStopped(ctx context.Context, pass string, done, total int) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return errors.Wrapf(ctx.Err(), "schema generation stopped while %s, after %d of %d types",
+		pass, done, total)
+}
+
 // genDgSchema generates Dgraph schema from a valid graphql schema.
-func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
+func genDgSchema(ctx context.Context, gqlSch *ast.Schema, definitions []string) (string, error) {
 	var typeStrings []string
 
 	type dgPred struct {
@@ -354,6 +1106,7 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 		indexes map[string]bool
 		upsert  string
 		reverse string
+		lang    string
 	}
 
 	type field struct {
@@ -386,7 +1139,11 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 		return pred
 	}
 
-	for _, key := range definitions {
+	for i, key := range definitions {
+		if err := generationStopped(ctx, "generating the Dgraph schema", i,
+			len(definitions)); err != nil {
+			return "", err
+		}
 		if isQueryOrMutation(key) {
 			continue
 		}
@@ -397,9 +1154,11 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 
 			typ := dgType{name: typName}
 			pwdField := getPasswordField(def)
+			parents := parentInterfaces(gqlSch, def)
 
 			for _, f := range def.Fields {
-				if f.Type.Name() == "ID" {
+				// A facet isn't a predicate, it's stored on the edges to the nodes of def.
+				if f.Type.Name() == "ID" || hasCustomDirective(f) || facetName(f) != "" {
 					continue
 				}
 
@@ -407,7 +1166,7 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 				// This field could have originally been defined in an interface that this type
 				// implements. If we get a parent interface, then we should prefix the field name
 				// with it instead of def.Name.
-				parentInt := parentInterface(gqlSch, def, f.Name)
+				parentInt := parents[f.Name]
 				if parentInt != nil {
 					typName = typeName(parentInt)
 				}
@@ -421,7 +1180,7 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 
 				var typStr string
 				switch gqlSch.Types[f.Type.Name()].Kind {
-				case ast.Object:
+				case ast.Object, ast.Union:
 					typStr = fmt.Sprintf("%suid%s", prefix, suffix)
 
 					if parentInt == nil {
@@ -461,9 +1220,18 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 							indexes = append(indexes, defaultSearches[f.Type.Name()])
 						}
 					}
+					for i, index := range indexes {
+						if index == "float" {
+							indexes[i] = floatSearchIndex(f)
+						}
+					}
 
 					if parentInt == nil {
-						dgPreds[fname] = getUpdatedPred(fname, typStr, upsertStr, indexes)
+						pred := getUpdatedPred(fname, typStr, upsertStr, indexes)
+						if hasLangDirective(f) {
+							pred.lang = "@lang "
+						}
+						dgPreds[fname] = pred
 					}
 					typ.fields = append(typ.fields, field{fname, parentInt != nil})
 				case ast.Enum:
@@ -520,8 +1288,8 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 					sort.Strings(indexes)
 					indexStr = fmt.Sprintf(" @index(%s)", strings.Join(indexes, ", "))
 				}
-				fmt.Fprintf(&preds, "%s: %s%s %s%s.\n", fld.name, f.typ, indexStr, f.upsert,
-					f.reverse)
+				fmt.Fprintf(&preds, "%s: %s%s %s%s%s.\n", fld.name, f.typ, indexStr, f.upsert,
+					f.reverse, f.lang)
 				predWritten[fld.name] = true
 			}
 		}
@@ -532,5 +1300,5 @@ func genDgSchema(gqlSch *ast.Schema, definitions []string) string {
 		)
 	}
 
-	return strings.Join(typeStrings, "")
+	return strings.Join(typeStrings, ""), nil
 }
@@ -17,13 +17,18 @@
 package schema
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"strings"
 	"testing"
 
 	dschema "github.com/dgraph-io/dgraph/schema"
 	"github.com/dgraph-io/dgraph/x"
 	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 	_ "github.com/vektah/gqlparser/v2/validator/rules"
@@ -308,3 +313,704 @@ func TestOnlyCorrectSearchArgsWork(t *testing.T) {
 		})
 	}
 }
+
+func TestSchemaFiles(t *testing.T) {
+	schHandler, err := NewHandler(`
+# Dgraph.File authors.graphql
+type Author {
+	id: ID!
+	name: String! @search(by: [hash])
+}
+
+# Dgraph.File posts.graphql
+type Post {
+	id: ID!
+	title: String!
+	author: Author
+}
+
+extend type Author {
+	posts: [Post]
+}`)
+	require.NoError(t, err)
+	author := schHandler.(*handler).completeSchema.Types["Author"]
+	require.NotNil(t, author.Fields.ForName("name"))
+	require.NotNil(t, author.Fields.ForName("posts"))
+	require.Contains(t, schHandler.DGSchema(), "Author.posts")
+
+	tcases := []struct {
+		name    string
+		schema  string
+		file    string
+		line    int
+		message string
+	}{
+		{
+			name: "errors give the file and the line in it",
+			schema: `
+# Dgraph.File authors.graphql
+type Author {
+	id: ID!
+	name: String
+}
+
+# Dgraph.File posts.graphql
+type Post {
+	id: ID!
+	author: Writer
+	title: String
+}`,
+			file:    "posts.graphql",
+			line:    3,
+			message: "Undefined type Writer.",
+		},
+		{
+			name: "a type can't be defined in two files",
+			schema: `
+# Dgraph.File authors.graphql
+type Author {
+	id: ID!
+}
+
+# Dgraph.File more-authors.graphql
+type Author {
+	id: ID!
+}`,
+			file: "more-authors.graphql",
+			line: 1,
+			message: "Type Author is defined in both authors.graphql and more-authors.graphql, a " +
+				"type can only be defined in one file of the schema, other files can use extend " +
+				"type to add to it.",
+		},
+	}
+	for _, tcase := range tcases {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := NewHandler(tcase.schema)
+			require.Error(t, err)
+			errs, ok := err.(gqlerror.List)
+			require.True(t, ok, err)
+			require.Len(t, errs, 1)
+			require.Equal(t, tcase.message, errs[0].Message)
+			require.Equal(t, tcase.file, errs[0].Extensions["file"])
+			require.Equal(t, tcase.line, errs[0].Locations[0].Line)
+		})
+	}
+
+	_, err = NewHandler(`
+# Dgraph.File authors.graphql
+type Author {
+	id: ID!
+}
+# Dgraph.Secret GITHUB_API_TOKEN "some-super-secret-token"
+
+# Dgraph.File posts.graphql
+type Post {
+	id: ID!
+}
+# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"`)
+	require.EqualError(t, err, "# Dgraph.Secret is given in files authors.graphql and "+
+		"posts.graphql, it can only be given in one file of the schema")
+
+	_, err = NewHandler(`
+# Dgraph.File
+type Author {
+	id: ID!
+}`)
+	require.EqualError(t, err, "incorrect format for specifying Dgraph file found for comment: "+
+		"`# Dgraph.File`, it should be `# Dgraph.File name`")
+}
+
+func TestHandlerSecrets(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+	}
+	# Dgraph.Secret GITHUB_API_TOKEN "some-super-secret-token"
+	# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"`
+	schHandler, err := NewHandler(sch)
+	require.NoError(t, err)
+
+	parsed, _, err := parseSecrets(sch)
+	require.NoError(t, err)
+	secrets := schHandler.Secrets()
+	require.Equal(t, parsed, secrets)
+
+	secrets["GITHUB_API_TOKEN"] = "changed"
+	secrets["NEW_SECRET"] = "new"
+	delete(secrets, "STRIPE_API_KEY")
+	require.Equal(t, parsed, schHandler.Secrets())
+	require.Equal(t, "some-super-secret-token",
+		string(schHandler.(*handler).schemaSecrets["GITHUB_API_TOKEN"]))
+}
+
+func TestSearchByCustomTokenizer(t *testing.T) {
+	require.NoError(t, RegisterSearchTokenizer("anagram", "string"))
+	defer func() {
+		searchTokenizers.Lock()
+		delete(searchTokenizers.types, "anagram")
+		searchTokenizers.Unlock()
+	}()
+	require.Error(t, RegisterSearchTokenizer("hash", "string"))
+	require.Error(t, RegisterSearchTokenizer("node", "uid"))
+
+	schHandler, err := NewHandler(`
+		type Word {
+			id: ID!
+			text: String! @search(by: [hash, "anagram"])
+			spelling: String @search(by: ["anagram"])
+		}`)
+	require.NoError(t, err)
+	require.Contains(t, schHandler.DGSchema(), "Word.text: string @index(anagram, hash) .")
+	require.Contains(t, schHandler.DGSchema(), "Word.spelling: string @index(anagram) .")
+
+	sch := schHandler.(*handler).completeSchema
+	spelling := &fieldDefinition{fieldDef: sch.Types["Word"].Fields.ForName("spelling")}
+	require.Equal(t, []string{"anagram"}, spelling.Searchable())
+	require.Nil(t, sch.Types["WordFilter"].Fields.ForName("spelling"))
+	require.Equal(t, "StringHashFilter",
+		sch.Types["WordFilter"].Fields.ForName("text").Type.Name())
+
+	tcases := map[string]struct {
+		schema  string
+		message string
+	}{
+		"a tokenizer must be registered": {
+			schema: `
+				type Word {
+					id: ID!
+					text: String @search(by: ["palindrome"])
+				}`,
+			message: "Type Word; Field text: the argument to @search \"palindrome\" " +
+				"isn't a registered custom tokenizer.",
+		},
+		"a tokenizer is given by name": {
+			schema: `
+				type Word {
+					id: ID!
+					text: String @search(by: [anagram])
+				}`,
+			message: "Type Word; Field text: the argument to @search anagram isn't " +
+				"valid. Fields of type String can have @search by exact, fulltext, hash, " +
+				"regexp, term and trigram.",
+		},
+		"a built-in index isn't given by name": {
+			schema: `
+				type Word {
+					id: ID!
+					text: String @search(by: ["hash"])
+				}`,
+			message: "Type Word; Field text: the argument to @search \"hash\" is a " +
+				"built-in index, give it without quotes, like @search(by: [hash])",
+		},
+		"a tokenizer only applies to its type": {
+			schema: `
+				type Word {
+					id: ID!
+					length: Int @search(by: ["anagram"])
+				}`,
+			message: "Type Word; Field length: has the @search directive but the " +
+				"argument anagram doesn't apply to field type Int.  Search by anagram applies " +
+				"to fields of type String. Fields of type Int are searchable by just @search.",
+		},
+	}
+	for name, tc := range tcases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewHandler(tc.schema)
+			require.Error(t, err)
+			errs, ok := err.(gqlerror.List)
+			require.True(t, ok, err)
+			require.Len(t, errs, 1)
+			require.Equal(t, tc.message, errs[0].Message)
+			require.Equal(t, 4, errs[0].Locations[0].Line)
+		})
+	}
+}
+
+func TestNamedAuthRulesAreInlined(t *testing.T) {
+	schHandler, err := NewHandler(`
+		# Dgraph.AuthRule isUser """
+		#   query($usr: String!) {
+		#     queryX(filter: { username: { eq: $usr } }) { __typename }
+		#   }"""
+		type X @auth(query: { ruleRef: "isUser" }, delete: { not: { ruleRef: "isUser" } }) {
+			username: String! @id
+		}`)
+	require.NoError(t, err)
+	require.NotContains(t, schHandler.GQLSchema(), "ruleRef")
+
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	rules := sch.(*schema).authRules["X"].Rules
+	require.NotNil(t, rules.Query.Rule)
+	require.Equal(t, "usr", rules.Query.Variables[0].Variable)
+	require.NotNil(t, rules.Delete.Not.Rule)
+	require.Equal(t, "usr", rules.Delete.Not.Variables[0].Variable)
+}
+
+func TestEmptyListsAsNullIsKeptInGeneratedSchema(t *testing.T) {
+	for input, want := range map[string]bool{
+		`type X { id: ID! }`: false,
+		`# Dgraph.EmptyListsAsNull
+		type X { id: ID! }`: true,
+	} {
+		schHandler, err := NewHandler(input)
+		require.NoError(t, err)
+
+		sch, err := FromString(schHandler.GQLSchema())
+		require.NoError(t, err)
+		require.Equal(t, want, sch.EmptyListsAsNull())
+	}
+}
+
+func TestRelayIDsAddNodeInterface(t *testing.T) {
+	sch := `
+		type Author {
+			id: ID!
+			name: String!
+		}
+		type Country @remote {
+			id: ID!
+			name: String!
+		}`
+
+	schHandler, err := NewHandler(sch)
+	require.NoError(t, err)
+	require.NotContains(t, schHandler.GQLSchema(), "interface Node")
+
+	schHandler, err = NewHandler("# Dgraph.RelayIDs\n" + sch)
+	require.NoError(t, err)
+	gql := schHandler.GQLSchema()
+	require.Contains(t, gql, "interface Node {\n\tid: ID!\n}")
+	require.Contains(t, gql, "type Author implements Node {")
+	require.Contains(t, gql, "type Country @remote {")
+	require.Contains(t, gql, "node(id: ID!): Node")
+	// Node isn't stored in Dgraph
+	require.NotContains(t, schHandler.DGSchema(), "Node")
+
+	gqlSchema, err := FromString(gql)
+	require.NoError(t, err)
+	require.True(t, gqlSchema.RelayIDs())
+
+	_, err = NewHandler(`# Dgraph.RelayIDs
+		type Author {
+			authorID: ID!
+		}`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Type Author; Field authorID: is the ID of a type that "+
+		"implements Relay's Node interface, so it must be id: ID!.")
+}
+
+func TestLimitsAreKeptInGeneratedSchema(t *testing.T) {
+	sch := `
+		type Author {
+			id: ID!
+			name: String!
+		}`
+
+	schHandler, err := NewHandler(sch)
+	require.NoError(t, err)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	require.Equal(t, Limits{}, gqlSchema.Limits())
+
+	schHandler, err = NewHandler(
+		`# Dgraph.Limits {"maxMutationNodes": 10000, "maxRequestBytes": 4194304}` + sch)
+	require.NoError(t, err)
+	gqlSchema, err = FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	require.Equal(t, Limits{MaxMutationNodes: 10000, MaxRequestBytes: 4194304},
+		gqlSchema.Limits())
+
+	for _, bad := range []string{
+		`# Dgraph.Limits {"maxNodes": 10}`,
+		`# Dgraph.Limits {"maxMutationNodes": -1}`,
+		`# Dgraph.Limits maxMutationNodes=10`,
+		"# Dgraph.Limits {\"maxMutationNodes\": 10}\n# Dgraph.Limits {\"maxRequestBytes\": 10}",
+	} {
+		_, err = NewHandler(bad + sch)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestGenerateCommentDisablesSubscriptions(t *testing.T) {
+	sch := `
+		type Author {
+			id: ID!
+			name: String! @search(by: [hash])
+		}`
+
+	schHandler, err := NewHandler(sch)
+	require.NoError(t, err)
+	require.NotNil(t, schHandler.(*handler).completeSchema.Subscription)
+	require.Contains(t, schHandler.GQLSchema(), "type Subscription")
+
+	schHandler, err = NewHandler("# Dgraph.Generate subscription=false\n" + sch)
+	require.NoError(t, err)
+	require.Nil(t, schHandler.(*handler).completeSchema.Subscription)
+	require.NotContains(t, schHandler.GQLSchema(), "type Subscription")
+	require.NotContains(t, schHandler.GQLSchema(), "SubscriptionEvent")
+	require.NotNil(t, schHandler.(*handler).completeSchema.Query.Fields.ForName("getAuthor"))
+
+	for comment, msg := range map[string]string{
+		"# Dgraph.Generate":                  "it should be `# Dgraph.Generate subscription=false`",
+		"# Dgraph.Generate query=false":      "the only supported option is subscription",
+		"# Dgraph.Generate subscription=off": "it should be true or false",
+	} {
+		_, err = NewHandler(comment + "\n" + sch)
+		require.Error(t, err, comment)
+		require.Contains(t, err.Error(), msg, comment)
+	}
+}
+
+func TestNewHandlerCtx(t *testing.T) {
+	input := syntheticSchema(10)
+
+	h, err := NewHandlerCtx(context.Background(), input)
+	require.NoError(t, err)
+	sch, err := FromStringCtx(context.Background(), h.GQLSchema())
+	require.NoError(t, err)
+	require.NotNil(t, sch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = NewHandlerCtx(ctx, input)
+	require.Error(t, err)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	require.Contains(t, err.Error(), "schema generation stopped while validating the schema, "+
+		"after 0 of 11 types")
+
+	_, err = FromStringCtx(ctx, h.GQLSchema())
+	require.Error(t, err)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+// syntheticSchema returns a schema with numTypes types implementing a common interface, each
+// with searchable fields and an edge to the next type.
+func syntheticSchema(numTypes int) string {
+	var sb strings.Builder
+	sb.WriteString(`
+	interface Node {
+		id: ID!
+		createdBy: String! @search(by: [hash])
+	}
+	`)
+	for i := 0; i < numTypes; i++ {
+		fmt.Fprintf(&sb, `
+	type T%d implements Node @auth(query: { rule: "{$role: { eq: \"ADMIN\" } }" }) {
+		xid: String! @id
+		name: String @search(by: [term, exact])
+		score: Int @search
+		tags: [String] @search(by: [hash])
+		next: T%d @hasInverse(field: prev)
+		prev: T%d
+	}
+	`, i, (i+1)%numTypes, (i+numTypes-1)%numTypes)
+	}
+	return sb.String()
+}
+
+func BenchmarkNewHandler(b *testing.B) {
+	input := syntheticSchema(600)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h, err := NewHandler(input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := FromString(h.GQLSchema()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTTLAddsAllowExpiredArgument(t *testing.T) {
+	schHandler, err := NewHandler(`
+		interface Expiring @ttl(field: "expiresAt") {
+			id: ID!
+			expiresAt: DateTime!
+		}
+
+		type Session implements Expiring {
+			token: String!
+		}
+
+		type Device {
+			id: ID!
+			name: String!
+		}
+
+		type Account {
+			id: ID!
+			sessions: [Session]
+		}`)
+	require.NoError(t, err)
+	sch := schHandler.(*handler).completeSchema
+
+	// Account's mutations can add new Sessions in sessions, so they can be allowed to add
+	// expired ones too.
+	for _, mut := range []string{"addSession", "updateSession", "updateExpiring", "addAccount",
+		"updateAccount"} {
+		fld := sch.Mutation.Fields.ForName(mut)
+		require.NotNil(t, fld, mut)
+		arg := fld.Arguments.ForName("allowExpired")
+		require.NotNil(t, arg, mut)
+		require.Equal(t, "Boolean", arg.Type.String())
+	}
+	for _, mut := range []string{"deleteSession", "addDevice", "updateDevice"} {
+		require.Nil(t, sch.Mutation.Fields.ForName(mut).Arguments.ForName("allowExpired"), mut)
+	}
+
+	gqlSch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	ttlTypes := gqlSch.TTLTypes()
+	require.Len(t, ttlTypes, 1)
+	require.Equal(t, "Session", ttlTypes[0].Name())
+	require.Equal(t, "expiresAt", ttlTypes[0].TTLField().Name())
+}
+
+func TestIDTypesGetUpsertMutation(t *testing.T) {
+	schHandler, err := NewHandler(`
+		type User {
+			username: String! @id
+			name: String!
+			friends: [User!]!
+		}
+
+		type Post {
+			id: ID!
+			title: String!
+		}`)
+	require.NoError(t, err)
+	sch := schHandler.(*handler).completeSchema
+
+	upsert := sch.Mutation.Fields.ForName("upsertUser")
+	require.NotNil(t, upsert)
+	require.Equal(t, "AddUserPayload", upsert.Type.String())
+	require.Equal(t, "[UpsertUserInput!]!", upsert.Arguments.ForName("input").Type.String())
+	require.Nil(t, sch.Mutation.Fields.ForName("upsertPost"))
+
+	// Only the @id is required, the rest may be left out when the user already exists.
+	input := sch.Types["UpsertUserInput"]
+	require.NotNil(t, input)
+	require.Equal(t, "String!", input.Fields.ForName("username").Type.String())
+	require.Equal(t, "String", input.Fields.ForName("name").Type.String())
+	require.Equal(t, "[UserRef!]", input.Fields.ForName("friends").Type.String())
+	require.Equal(t, "String!",
+		sch.Types["AddUserInput"].Fields.ForName("name").Type.String())
+
+	gqlSch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	require.Equal(t, []string{"upsertUser"}, gqlSch.Mutations(UpsertMutation))
+}
+
+func TestPredicateNamesHook(t *testing.T) {
+	schHandler, err := NewHandler(`
+		interface Named {
+			id: ID!
+			name: String! @search(by: [hash])
+		}
+
+		type Author implements Named {
+			bio: String
+			posts: [Post] @dgraph(pred: "wrote")
+		}
+
+		type Post @dgraph(type: "Article") {
+			title: String
+		}`, WithPredicateNames(func(typeName, fieldName string) string {
+		return strings.ToUpper(typeName + "_" + fieldName)
+	}))
+	require.NoError(t, err)
+
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"name": "NAMED_NAME"},
+		sch.(*schema).dgraphPredicate["Named"])
+	require.Equal(t, map[string]string{
+		"name":  "NAMED_NAME",
+		"bio":   "AUTHOR_BIO",
+		"posts": "wrote",
+	}, sch.(*schema).dgraphPredicate["Author"])
+	require.Equal(t, map[string]string{"title": "ARTICLE_TITLE"},
+		sch.(*schema).dgraphPredicate["Post"])
+
+	require.Contains(t, schHandler.DGSchema(), "NAMED_NAME: string @index(hash) .")
+	require.Contains(t, schHandler.DGSchema(), "AUTHOR_BIO: string .")
+}
+
+func TestImportAddsRemoteTypes(t *testing.T) {
+	movieFields := `
+		{"name": "id", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}},
+		{"name": "title", "type": {"kind": "SCALAR", "name": "String"}},
+		{"name": "genre", "type": {"kind": "ENUM", "name": "Genre"}},
+		{"name": "director", "type": {"kind": "OBJECT", "name": "Director"}},
+		{"name": "reviews",
+		 "args": [{"name": "filter", "type": {"kind": "INPUT_OBJECT", "name": "ReviewFilter"}}],
+		 "type": {"kind": "LIST", "ofType": {"kind": "SCALAR", "name": "String"}}}`
+	remote := func(extraMovieFields string) *introspectedSchema {
+		result := &introspectedSchema{}
+		require.NoError(t, json.Unmarshal([]byte(`{"data": {"__schema": {"types": [
+			{"kind": "OBJECT", "name": "Movie", "fields": [`+movieFields+extraMovieFields+`]},
+			{"kind": "OBJECT", "name": "Director", "fields": [
+				{"name": "name", "type": {"kind": "NON_NULL",
+					"ofType": {"kind": "SCALAR", "name": "String"}}}]},
+			{"kind": "ENUM", "name": "Genre", "enumValues": [{"name": "DRAMA"}, {"name": "COMEDY"}]},
+			{"kind": "INPUT_OBJECT", "name": "ReviewFilter", "inputFields": [
+				{"name": "minStars", "type": {"kind": "SCALAR", "name": "Int"}}]},
+			{"kind": "SCALAR", "name": "ID"},
+			{"kind": "SCALAR", "name": "String"},
+			{"kind": "SCALAR", "name": "Int"}
+		]}}}`), result))
+		return result
+	}
+
+	var introspections int
+	introspected := remote("")
+	defer func(f func(string, http.Header) (*introspectedSchema, error)) {
+		introspectRemote = f
+	}(introspectRemote)
+	introspectRemote = func(url string, headers http.Header) (*introspectedSchema, error) {
+		require.Equal(t, "https://partner.com/api", url)
+		introspections++
+		return introspected, nil
+	}
+
+	sch := `
+		# Dgraph.Import {"url": "https://partner.com/api", "types": ["Movie"]}
+		type Query {
+			movies: [Movie] @custom(http: {url: "http://partner.com/movies", method: "GET"})
+		}`
+
+	schHandler, err := NewHandler(sch)
+	require.NoError(t, err)
+	require.Equal(t, 1, introspections)
+	gqlSchema := schHandler.GQLSchema()
+	require.Contains(t, gqlSchema, "type Movie @remote {\n\tid: ID!\n\ttitle: String\n\t"+
+		"genre: Genre\n\tdirector: Director\n\treviews(filter: ReviewFilter): [String]\n}")
+	require.Contains(t, gqlSchema, "type Director @remote {\n\tname: String!\n}")
+	require.Contains(t, gqlSchema, "enum Genre {\n\tDRAMA\n\tCOMEDY\n}")
+	require.Contains(t, gqlSchema, "input ReviewFilter {\n\tminStars: Int\n}")
+
+	// Applying the schema again picks up changes to the remote types.
+	introspected = remote(`, {"name": "year", "type": {"kind": "SCALAR", "name": "Int"}}`)
+	schHandler, err = NewHandler(sch)
+	require.NoError(t, err)
+	require.Equal(t, 2, introspections)
+	require.Contains(t, schHandler.GQLSchema(), "\treviews(filter: ReviewFilter): [String]\n"+
+		"\tyear: Int\n}")
+
+	// A local type can only have the name of an imported type if it's the same type.
+	_, err = NewHandler(sch + `
+		type Director @remote {
+			name: String!
+		}`)
+	require.NoError(t, err)
+
+	_, err = NewHandler(sch + `
+		type Director @remote {
+			name: Int
+			born: DateTime
+		}`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Type Director is imported from "+
+		"https://partner.com/api, but the schema also declares it differently:\n"+
+		"- born: DateTime\n- name: Int\n+ name: String!")
+}
+
+func TestGroupQueriesForIndexedFields(t *testing.T) {
+	schHandler, err := NewHandler(`
+		type Author {
+			id: ID!
+			handle: String! @id
+			name: String! @search(by: [hash])
+			reputation: Float @search
+			karma: Int
+			tags: [String] @search(by: [exact])
+			bio: String @lang @search(by: [term])
+			posts: [Post]
+		}
+
+		type Post {
+			id: ID!
+			title: String
+		}`)
+	require.NoError(t, err)
+	sch := schHandler.(*handler).completeSchema
+
+	qry := sch.Query.Fields.ForName("groupAuthorByReputation")
+	require.NotNil(t, qry)
+	require.Equal(t, "[AuthorReputationGroup]", qry.Type.String())
+	require.Len(t, qry.Arguments, 1)
+	require.Equal(t, "AuthorFilter", qry.Arguments.ForName("filter").Type.String())
+
+	group := sch.Types["AuthorReputationGroup"]
+	require.NotNil(t, group)
+	require.Len(t, group.Fields, 2)
+	require.Equal(t, "Float", group.Fields.ForName("reputation").Type.String())
+	require.Equal(t, "Int", group.Fields.ForName("count").Type.String())
+
+	require.NotNil(t, sch.Query.Fields.ForName("groupAuthorByName"))
+	// Fields that aren't indexed, are lists, @id or @lang aren't grouped by.
+	for _, name := range []string{"groupAuthorByKarma", "groupAuthorByTags",
+		"groupAuthorByHandle", "groupAuthorByBio", "groupAuthorByPosts", "groupPostByTitle"} {
+		require.Nil(t, sch.Query.Fields.ForName(name), name)
+	}
+
+	gqlSch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	require.Equal(t, []string{"groupAuthorByName", "groupAuthorByReputation"},
+		gqlSch.Queries(GroupByQuery))
+	// The groups are computed from the nodes, so they aren't stored in any predicates.
+	require.Nil(t, gqlSch.(*schema).dgraphPredicate["AuthorReputationGroup"])
+}
+
+func TestGetByFieldQueryNameClashes(t *testing.T) {
+	tcases := map[string]string{
+		"custom query": `
+			type Author {
+				id: ID!
+				name: String! @search(by: [hash])
+			}
+			type Query {
+				getAuthorByName(name: String!): Author @custom(http: {
+					url: "http://api.com/authors",
+					method: GET
+				})
+			}`,
+		"get query of another type": `
+			type Author {
+				id: ID!
+				name: String! @search(by: [hash])
+			}
+			type AuthorByName {
+				id: ID!
+				title: String
+			}`,
+		"fields whose names only differ in case": `
+			type Author {
+				id: ID!
+				name: String! @search(by: [hash])
+				Name: String @search(by: [hash])
+			}`,
+	}
+
+	for name, sch := range tcases {
+		t.Run(name, func(t *testing.T) {
+			schHandler, err := NewHandler(sch)
+			require.NoError(t, err)
+			gqlSch, err := FromString(schHandler.GQLSchema())
+			require.NoError(t, err)
+
+			count := 0
+			for _, qry := range gqlSch.AST().Query.Fields {
+				if qry.Name == "getAuthorByName" {
+					count++
+				}
+			}
+			require.Equal(t, 1, count)
+		})
+	}
+}
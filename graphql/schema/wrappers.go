@@ -18,6 +18,7 @@ package schema
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -30,9 +31,13 @@ import (
 
 	"github.com/vektah/gqlparser/v2/parser"
 
+	"github.com/dgraph-io/dgraph/graphql/authorization"
 	"github.com/dgraph-io/dgraph/x"
 	"github.com/pkg/errors"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
 )
 
 // Wrap the github.com/vektah/gqlparser/ast defintions so that the bulk of the GraphQL
@@ -49,22 +54,53 @@ type QueryType string
 // MutationType is currently supported mutations
 type MutationType string
 
+// AuditKind is the value that the server sets an audit field to, when a node is added or
+// updated, rather than the field being given in the mutation.
+type AuditKind string
+
 // FieldHTTPConfig contains the config needed to resolve a field using a remote HTTP endpoint
 // which could a GraphQL or a REST endpoint.
 type FieldHTTPConfig struct {
-	URL    string
-	Method string
+	// URL has the variables substituted in for queries and mutations, URLTemplate is always the
+	// url exactly as given in @custom
+	URL         string
+	URLTemplate string
+	Method      string
+	// ContentType is the Content-Type header sent with the body, would be empty if there is no
+	// body
+	ContentType string
 	// would be nil if there is no body
 	Template       *interface{}
 	Mode           string
 	ForwardHeaders http.Header
+	// HeaderTemplates has the headers whose value is a template using variables, like
+	// "Bearer $token". Any secrets used in the template have already been substituted. For
+	// queries and mutations the variables are also substituted in ForwardHeaders, otherwise they
+	// have to be substituted using SubstituteVarsInHeaders with the values of the parent fields.
+	HeaderTemplates map[string]string
 	// would be empty for non-GraphQL requests
 	RemoteGqlQueryName string
 	RemoteGqlQuery     string
+	// Loopback is set if the GraphQL request is made to LoopbackURL, so it's resolved by the
+	// server's own GraphQL API rather than sent over HTTP.
+	Loopback bool
+	// ResultPath, if given, is where the result is in the response, see ApplyResultPath.  With
+	// StrictPath, a response that has nothing at the path is an error, instead of giving null.
+	ResultPath string
+	StrictPath bool
+	// ErrorHandling, if given, is how responses whose status isn't 2xx are resolved.
+	ErrorHandling *HTTPErrorHandling
+	// For GraphQL requests in SINGLE mode, the body (if given) is a template for the variables
+	// sent along with the remote query, it would be nil otherwise.
+	// for e.g. { owner: $id, source: "dgraph", page: { size: 10 } }
+	VariablesTemplate *interface{}
 
 	// args required by the HTTP/GraphQL request. These should be present in the parent type
 	// in the case of resolving a field or in the parent field in case of a query/mutation
 	RequiredArgs map[string]bool
+	// claims of the JWT used by the body, like sub for $claims.sub. These aren't arguments, they
+	// come from the JWT sent along with the request.
+	RequiredClaims map[string]bool
 
 	// For the following request
 	// graphql: "query($sinput: [SchoolInput]) { schoolNames(schools: $sinput) }"
@@ -73,20 +109,50 @@ type FieldHTTPConfig struct {
 	GraphqlBatchModeArgument string
 }
 
+// HTTPErrorHandling is the errorHandling of a @custom directive.  A response with a status in
+// NullOn resolves the field to null without an error.  Any other status that isn't 2xx is an
+// error whose message is at MessagePath in the response, or else the status text.  With
+// PropagateStatus, the status is also given in the error's extensions.
+type HTTPErrorHandling struct {
+	NullOn          []int
+	MessagePath     string
+	PropagateStatus bool
+}
+
+// FieldDQLConfig contains the config needed to resolve a query using the DQL query given in
+// @custom(dql: ...).
+type FieldDQLConfig struct {
+	// Query is the DQL query exactly as given in @custom.
+	Query string
+	// Vars are the DQL variables used in Query, in the order they first appear.  Each of them
+	// is an argument of the GraphQL query, whose value is sent as the value of the variable.
+	Vars []string
+}
+
 // Query/Mutation types and arg names
 const (
 	GetQuery             QueryType    = "get"
 	FilterQuery          QueryType    = "query"
 	SchemaQuery          QueryType    = "schema"
 	PasswordQuery        QueryType    = "checkPassword"
+	PageQuery            QueryType    = "page"
+	NodeQuery            QueryType    = "node"
+	SubscribeQuery       QueryType    = "subscribe"
+	GroupByQuery         QueryType    = "group"
 	HTTPQuery            QueryType    = "http"
+	DQLQuery             QueryType    = "dql"
 	NotSupportedQuery    QueryType    = "notsupported"
 	AddMutation          MutationType = "add"
+	UpsertMutation       MutationType = "upsert"
 	UpdateMutation       MutationType = "update"
 	DeleteMutation       MutationType = "delete"
 	HTTPMutation         MutationType = "http"
 	NotSupportedMutation MutationType = "notsupported"
+	CreatedBy            AuditKind    = createdByDirective
+	CreatedAt            AuditKind    = createdAtDirective
+	UpdatedAt            AuditKind    = updatedAtDirective
 	IDType                            = "ID"
+	PolygonType                       = "Polygon"
 	IDArgName                         = "id"
 	InputArgName                      = "input"
 	FilterArgName                     = "filter"
@@ -97,6 +163,52 @@ type Schema interface {
 	Operation(r *Request) (Operation, error)
 	Queries(t QueryType) []string
 	Mutations(t MutationType) []string
+	CustomFields() []FieldRef
+	// PredicateFields returns the fields of the types and interfaces that are stored in the
+	// Dgraph predicate pred, it's the inverse of DgraphPredicate.
+	PredicateFields(pred string) []FieldRef
+	EmptyListsAsNull() bool
+	NoTracePropagation() bool
+	StrictFieldAuth() bool
+	// RelayIDs returns true if IDs are given out and taken in as Relay global IDs.
+	RelayIDs() bool
+	// Limits returns the limits on mutations that the schema sets.
+	Limits() Limits
+	// TTLTypes returns the object types with @ttl, whose nodes expire.
+	TTLTypes() []Type
+	// AST returns the schema as it's parsed and validated, after it's been completed with the
+	// generated types, queries and mutations.  Until the schema is frozen, it's shared with the
+	// schema, so it's read-only: callers can walk it, but mustn't change it.
+	AST() *ast.Schema
+	// Namespace returns the namespace the schema is served in.
+	Namespace() string
+	// AllowedHeaders returns the comma separated list of headers that clients of the schema
+	// can send, for Access-Control-Allow-Headers.
+	AllowedHeaders() string
+	// AuthMeta returns the # Dgraph.Authorization of the schema, or nil if it doesn't have
+	// one.  Requests for the schema are authorized with it once it's attached to their context
+	// with authorization.AttachAuthMeta.
+	AuthMeta() *authorization.AuthMeta
+	// DgraphPredicates returns the mapping of field name -> Dgraph predicate of the type or
+	// interface typName, or nil if it isn't stored in Dgraph.
+	DgraphPredicates(typName string) map[string]string
+	// SearchIndexes returns the Dgraph indexes that the @search of the field fieldName of
+	// typeName declares, sorted, e.g. [hash trigram] for @search(by: [hash, trigram]).  It's
+	// nil if the field isn't indexed, or isn't in the schema.
+	SearchIndexes(typeName, fieldName string) []string
+	// Freeze makes the schema immutable to its callers.  From then on, the accessors that would
+	// return the AST, maps and structs that the schema looks things up in return copies of
+	// them, so changing what they return doesn't change the schema.  Copying the AST means
+	// printing and parsing it again, so AST is costly once the schema is frozen.  Freeze must
+	// be called before the schema is shared between goroutines, like the schema the server
+	// serves is.
+	Freeze()
+}
+
+// FieldRef identifies a field by the name of the type it is defined in and its own name.
+type FieldRef struct {
+	TypeName  string
+	FieldName string
 }
 
 // An Operation is a single valid GraphQL operation.  It contains either
@@ -108,6 +220,11 @@ type Operation interface {
 	IsQuery() bool
 	IsMutation() bool
 	IsSubscription() bool
+	Validate(sch Schema) gqlerror.List
+	Warnings() gqlerror.List
+	ReadOnly() bool
+	BestEffort() bool
+	OperationName() string
 }
 
 // A Field is one field from an Operation.
@@ -129,14 +246,40 @@ type Field interface {
 	Location() x.Location
 	DgraphPredicate() string
 	Operation() Operation
-	// InterfaceType tells us whether this field represents a GraphQL Interface.
+	// InterfaceType tells us whether this field represents a GraphQL Interface (or Union), and
+	// so could be any of a number of object types.
 	InterfaceType() bool
 	IncludeInterfaceField(types []interface{}) bool
 	TypeName(dgraphTypes []interface{}) string
 	GetObjectName() string
 	IsAuthQuery() bool
-	CustomHTTPConfig() (FieldHTTPConfig, error)
+	// AuthRules returns the rules of the @auth directive on the definition of the field, or
+	// nil if it doesn't have one.  An aggregate field has the rules of the list field it
+	// aggregates.
+	AuthRules() *AuthContainer
+	// CustomHTTPConfig returns the configs for the remote requests of a field with @custom(http:
+	// ...), in the order they should be tried.
+	CustomHTTPConfig(claims map[string]interface{}) ([]FieldHTTPConfig, error)
+	// CustomHTTPUsesClaims returns whether the body of any of the remote requests of a field
+	// with @custom(http: ...) refers to the claims of the JWT, like $claims.email.  The claims
+	// only need to be given to CustomHTTPConfig if it does.
+	CustomHTTPUsesClaims() bool
 	EnumValues() []string
+	// EnumValue returns the value of the field's enum type that val is, and true, or false if
+	// val isn't a value of the enum.  If the enum has @enum(caseInsensitive: true), val
+	// matches a value that differs only in case, and the declared value is returned.
+	EnumValue(val string) (string, bool)
+	// RelayID returns the ID that the uid value of the field is given out as.  That's the
+	// Relay global ID of the node if the schema has # Dgraph.RelayIDs and the field is the ID
+	// of a type stored in Dgraph, and just uid otherwise.
+	RelayID(uid string, dgraphTypes []interface{}) string
+	// AggregatedField returns the name of the list field that the field aggregates, if it's a
+	// generated fAggregate field, and "" otherwise.
+	AggregatedField() string
+	// ObjectType returns the type that the field is selected on.  For a field in a fragment,
+	// like `... on Human { totalCredits }` in a field of an interface type, that's Human, so
+	// the facets, aggregates and predicates of fields that only Human has are found in it.
+	ObjectType() Type
 }
 
 // A Mutation is a field (from the schema's Mutation type) from an Operation
@@ -146,6 +289,9 @@ type Mutation interface {
 	MutatedType() Type
 	QueryField() Field
 	NumUidsField() Field
+	// SelectsOnlyMutationMetadata returns true if the mutation's selection set only asks for
+	// numUids, msg or __typename, and so doesn't need the mutated nodes to be queried.
+	SelectsOnlyMutationMetadata() bool
 }
 
 // A Query is a field (from the schema's Query type) from an Operation
@@ -154,6 +300,27 @@ type Query interface {
 	QueryType() QueryType
 	Rename(newName string)
 	AuthFor(typ Type, jwtVars map[string]interface{}) Query
+	// NodesQuery is for page queries (pageX), it returns the filter query (queryX) that finds
+	// the nodes of the page.  That query has the arguments of the page query and the
+	// selection set and directives of its nodes field.
+	NodesQuery() Query
+	// NodeGetQuery is for Relay's node query, it returns the get query (getT) of the type
+	// that the id argument is an ID of.  That query has the alias of the node query and the
+	// fields of its selection set that T has.
+	NodeGetQuery() (Query, error)
+	// SubscribedQuery is for subscriptions to events (subscribeT), it returns the filter query
+	// (queryT) that finds the nodes.  That query has the arguments of the subscription and the
+	// selection set and directives of its node field, along with T's ID fields.
+	SubscribedQuery() Query
+	// GroupedQuery is for group queries (groupTByF), it returns the filter query (queryT) that
+	// finds the nodes to group, with the arguments of the group query, and the field f of T
+	// that they are grouped by.  It returns nil and nil for any other query.
+	GroupedQuery() (Query, FieldDefinition)
+	// CustomDQLConfig returns the config of a DQLQuery, it returns false for any other query.
+	CustomDQLConfig() (FieldDQLConfig, bool)
+	// CompositeKey returns the fields of the composite key that a get query by composite key
+	// (getTByKey) looks up, it returns nil for any other query.
+	CompositeKey() []FieldDefinition
 }
 
 // A Type is a GraphQL type like: Float, T, T! and [T!]!.  If it's not a list, then
@@ -168,13 +335,35 @@ type Type interface {
 	PasswordField() FieldDefinition
 	Name() string
 	DgraphName() string
+	// DgraphTypes returns the Dgraph types that a node can have to be found by a query for the
+	// type.  That's DgraphName(), along with the includeTypes of an interface's @dgraph.
+	DgraphTypes() []string
 	DgraphPredicate(fld string) string
+	// DgraphFacet returns the Dgraph facet that the field fld is stored in, or "" if fld isn't
+	// a facet.
+	DgraphFacet(fld string) string
 	Nullable() bool
 	ListType() Type
 	Interfaces() []string
+	// Unions returns the Dgraph types of the unions that the type is a member of.  Nodes of the
+	// type are stored with those types too, so that a union's query finds all its members.
+	Unions() []string
 	EnsureNonNulls(map[string]interface{}, string) error
 	FieldOriginatedFrom(fieldName string) string
 	AuthRules() *TypeAuth
+	// CompositeKeys returns the fields of each composite key of the type, by key name.
+	CompositeKeys() map[string][]FieldDefinition
+	// TTLField returns the DateTime field after which a node of the type has expired, or nil
+	// if the type doesn't have @ttl.
+	TTLField() FieldDefinition
+	// SoftDeleteField returns the DateTime field that's set when a node of the type is soft
+	// deleted, or nil if the type doesn't have @softDelete.
+	SoftDeleteField() FieldDefinition
+	// AuditFields returns the fields of the type that the server sets, those with @createdBy,
+	// @createdAt or @updatedAt.
+	AuditFields() []FieldDefinition
+	// DefaultFields returns the fields of the type that have @default.
+	DefaultFields() []FieldDefinition
 	fmt.Stringer
 }
 
@@ -185,9 +374,19 @@ type FieldDefinition interface {
 	Name() string
 	Type() Type
 	IsID() bool
+	HasLangDirective() bool
+	Searchable() []string
+	OriginatedFrom() string
 	Inverse() FieldDefinition
+	HasInverse() (Type, FieldDefinition, bool)
 	// TODO - It might be possible to get rid of ForwardEdge and just use Inverse() always.
 	ForwardEdge() FieldDefinition
+	// Audit returns the value the server sets the field to, and for CreatedBy the JWT claim
+	// it's set from.  It returns "" if the field isn't an audit field.
+	Audit() (AuditKind, string)
+	// Default returns the value that a node added without a value for the field gets, or nil
+	// if the field doesn't have @default.
+	Default() interface{}
 }
 
 type astType struct {
@@ -216,8 +415,46 @@ type schema struct {
 	// something like field.Directives.ForName("custom"), which results in iterating over all the
 	// directives of the field.
 	customDirectives map[string]map[string]*ast.Directive
+	// facets stores the mapping of typeName -> fieldName -> Dgraph facet, for the fields with
+	// @dgraph(facet: ...).  Those fields have no Dgraph predicate, they are facets of the edges
+	// to nodes of the type.
+	facets map[string]map[string]string
 	// Map from typename to auth rules
 	authRules map[string]*TypeAuth
+	// emptyListsAsNull is true if the schema opted out of completing missing lists as [].
+	emptyListsAsNull bool
+	// noTracePropagation is true if the schema opted out of sending trace headers to remote
+	// endpoints.
+	noTracePropagation bool
+	// strictFieldAuth is true if the schema opted in to errors for fields hidden by @auth.
+	strictFieldAuth bool
+	// relayIDs is true if the schema opted in to Relay's global object identification.
+	relayIDs bool
+	// limits are the limits on mutations that the schema sets.
+	limits Limits
+	// compositeKeys stores the mapping of typeName -> composite key name -> names of the fields
+	// in the key, in the order they are defined.
+	// The outer map will contain typeName key only if the type has a composite key.
+	compositeKeys map[string]map[string][]string
+	// caseInsensitiveEnums is true if any enum has @enum(caseInsensitive: true), so requests
+	// have enum values to canonicalize.
+	caseInsensitiveEnums bool
+	// namespace is the namespace the schema is served in.
+	namespace string
+	// secrets are the # Dgraph.Secret values of the schema that custom resolvers can add as
+	// headers.  A schema built by FromString has none, only one built by FromHandler does.
+	secrets map[string]x.SensitiveByteSlice
+	// allowedHeaders is the comma separated list of headers returned to clients in
+	// Access-Control-Allow-Headers.
+	allowedHeaders string
+	// authMeta is the # Dgraph.Authorization of the schema, or nil if it doesn't have one.
+	authMeta *authorization.AuthMeta
+	// remoteArgs are the required arguments of the remote queries of the @custom graphql
+	// fields.  A schema built by FromString has none, as the remote schemas are only
+	// introspected by NewHandler.
+	remoteArgs requiredRemoteArgs
+	// frozen is true once Freeze has been called, so accessors return copies.
+	frozen bool
 }
 
 type operation struct {
@@ -229,6 +466,11 @@ type operation struct {
 	query    string
 	doc      *ast.QueryDocument
 	inSchema *schema
+
+	// warnings are the validation errors that were let through for a lenient request.
+	warnings gqlerror.List
+	// bestEffort is set if the request asked for a best-effort read-only transaction.
+	bestEffort bool
 }
 
 type field struct {
@@ -244,6 +486,8 @@ type fieldDefinition struct {
 	fieldDef        *ast.FieldDefinition
 	inSchema        *schema
 	dgraphPredicate map[string]map[string]string
+	// parentType is the name of the type the field was looked up in, if it's known.
+	parentType string
 }
 
 type mutation field
@@ -255,10 +499,18 @@ func (s *schema) Queries(t QueryType) []string {
 	}
 	var result []string
 	for _, q := range s.schema.Query.Fields {
-		if queryType(q.Name, s.customDirectives["Query"][q.Name]) == t {
+		if queryType(s.schema, q, s.customDirectives["Query"][q.Name]) == t {
 			result = append(result, q.Name)
 		}
 	}
+	if t == SubscribeQuery && s.schema.Subscription != nil {
+		// subscribeT fields are only in the Subscription type.
+		for _, q := range s.schema.Subscription.Fields {
+			if isSubscribeQuery(s.schema, q) {
+				result = append(result, q.Name)
+			}
+		}
+	}
 	return result
 }
 
@@ -275,6 +527,185 @@ func (s *schema) Mutations(t MutationType) []string {
 	return result
 }
 
+// CustomFields returns all the fields that are resolved through @custom, sorted by type name
+// and then by field name.
+func (s *schema) CustomFields() []FieldRef {
+	var result []FieldRef
+	for typName, fields := range s.customDirectives {
+		for fldName := range fields {
+			result = append(result, FieldRef{TypeName: typName, FieldName: fldName})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TypeName != result[j].TypeName {
+			return result[i].TypeName < result[j].TypeName
+		}
+		return result[i].FieldName < result[j].FieldName
+	})
+	return result
+}
+
+func (s *schema) PredicateFields(pred string) []FieldRef {
+	var result []FieldRef
+	for typName, fields := range s.dgraphPredicate {
+		if s.isGeneratedMutationType(typName) {
+			continue
+		}
+		for fldName, fldPred := range fields {
+			if fldPred == pred {
+				result = append(result, FieldRef{TypeName: typName, FieldName: fldName})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TypeName != result[j].TypeName {
+			return result[i].TypeName < result[j].TypeName
+		}
+		return result[i].FieldName < result[j].FieldName
+	})
+	return result
+}
+
+// isGeneratedMutationType returns true if typName is one of the input or payload types generated
+// for the mutations of a type, which share the Dgraph predicates of the type.
+func (s *schema) isGeneratedMutationType(typName string) bool {
+	for _, affixes := range [][2]string{{"Add", "Input"}, {"Update", "Payload"},
+		{"Delete", "Payload"}} {
+		if strings.HasPrefix(typName, affixes[0]) && strings.HasSuffix(typName, affixes[1]) {
+			name := strings.TrimSuffix(strings.TrimPrefix(typName, affixes[0]), affixes[1])
+			if _, ok := s.dgraphPredicate[name]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *schema) TTLTypes() []Type {
+	dgraphPredicate := s.dgraphPredicate
+	if s.frozen {
+		dgraphPredicate = make(map[string]map[string]string, len(s.dgraphPredicate))
+		for typName := range s.dgraphPredicate {
+			dgraphPredicate[typName] = s.DgraphPredicates(typName)
+		}
+	}
+	var result []Type
+	for _, typ := range s.schema.Types {
+		if typ.Kind == ast.Object && typ.Directives.ForName(ttlDirective) != nil {
+			result = append(result, &astType{
+				typ:             &ast.Type{NamedType: typ.Name},
+				inSchema:        s,
+				dgraphPredicate: dgraphPredicate,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result
+}
+
+// EmptyListsAsNull returns true if list fields with no value in the Dgraph result should
+// complete as null, rather than [].
+func (s *schema) EmptyListsAsNull() bool {
+	return s.emptyListsAsNull
+}
+
+// NoTracePropagation returns true if calls to remote endpoints shouldn't carry the W3C trace
+// context headers.
+func (s *schema) NoTracePropagation() bool {
+	return s.noTracePropagation
+}
+
+// StrictFieldAuth returns true if a field whose @auth rule is false for the JWT should complete
+// with an error, rather than just null.
+func (s *schema) StrictFieldAuth() bool {
+	return s.strictFieldAuth
+}
+
+// RelayIDs returns true if the schema has # Dgraph.RelayIDs, so IDs are given out and taken in
+// as Relay global IDs rather than as uids.
+func (s *schema) RelayIDs() bool {
+	return s.relayIDs
+}
+
+func (s *schema) Limits() Limits {
+	return s.limits
+}
+
+func (s *schema) AST() *ast.Schema {
+	if !s.frozen {
+		return s.schema
+	}
+	// The schema was validated when it was built, so it parses and validates again once printed.
+	var buf bytes.Buffer
+	formatter.NewFormatter(&buf).FormatSchema(s.schema)
+	doc, gqlErr := parser.ParseSchemas(validator.Prelude, &ast.Source{Input: buf.String()})
+	if gqlErr != nil {
+		return nil
+	}
+	copied, gqlErr := validator.ValidateSchemaDocument(doc)
+	if gqlErr != nil {
+		return nil
+	}
+	return copied
+}
+
+func (s *schema) Namespace() string {
+	return s.namespace
+}
+
+func (s *schema) AllowedHeaders() string {
+	return s.allowedHeaders
+}
+
+func (s *schema) AuthMeta() *authorization.AuthMeta {
+	if !s.frozen || s.authMeta == nil {
+		return s.authMeta
+	}
+	meta := *s.authMeta
+	meta.AllowedHeaderClaims = append([]string(nil), s.authMeta.AllowedHeaderClaims...)
+	return &meta
+}
+
+func (s *schema) DgraphPredicates(typName string) map[string]string {
+	preds, ok := s.dgraphPredicate[typName]
+	if !s.frozen || !ok {
+		return preds
+	}
+	return copyPredicates(preds)
+}
+
+// copyPredicates returns a copy of preds, a mapping of field name -> dgraph predicate.
+func copyPredicates(preds map[string]string) map[string]string {
+	copied := make(map[string]string, len(preds))
+	for fld, pred := range preds {
+		copied[fld] = pred
+	}
+	return copied
+}
+
+func (s *schema) SearchIndexes(typeName, fieldName string) []string {
+	defn := s.schema.Types[typeName]
+	if defn == nil {
+		return nil
+	}
+	fld := defn.Fields.ForName(fieldName)
+	if fld == nil {
+		return nil
+	}
+	return (&fieldDefinition{
+		fieldDef:        fld,
+		inSchema:        s,
+		dgraphPredicate: s.dgraphPredicate,
+		parentType:      typeName,
+	}).Searchable()
+}
+
+func (s *schema) Freeze() {
+	s.frozen = true
+}
+
 func (o *operation) IsQuery() bool {
 	return o.op.Operation == ast.Query
 }
@@ -291,6 +722,48 @@ func (o *operation) Schema() Schema {
 	return o.inSchema
 }
 
+// OperationName returns the name of the operation, which is the one the request's
+// operationName selected if the request has more than one.  It's "" for an anonymous operation.
+func (o *operation) OperationName() string {
+	return o.op.Name
+}
+
+// Warnings returns the validation errors that didn't fail the operation because the
+// request was lenient.
+func (o *operation) Warnings() gqlerror.List {
+	return o.warnings
+}
+
+// ReadOnly returns true if the operation was requested to run in a read-only transaction.
+// Such an operation never contains mutations.
+func (o *operation) ReadOnly() bool {
+	return o.bestEffort
+}
+
+// BestEffort returns true if the operation's reads don't need to be linearizable, so Dgraph
+// can serve them without getting a timestamp from Zero.
+func (o *operation) BestEffort() bool {
+	return o.bestEffort
+}
+
+// Validate returns the errors that sch would find in the operation, e.g. unknown fields, wrong
+// argument types and missing required arguments, along with where they are in the request.
+// The operation is validated in the same way as Operation validates a request, so it's only
+// useful for a schema other than the one the operation was built for, like the schema that's
+// about to replace it.
+func (o *operation) Validate(sch Schema) gqlerror.List {
+	_, err := sch.Operation(&Request{
+		Query:         o.query,
+		OperationName: o.op.Name,
+		Variables:     o.vars,
+		Header:        o.header,
+	})
+	if err == nil {
+		return nil
+	}
+	return operationErrors(err)
+}
+
 func (o *operation) Queries() (qs []Query) {
 	if o.IsMutation() {
 		return
@@ -349,6 +822,26 @@ func parentInterface(sch *ast.Schema, typDef *ast.Definition, fieldName string)
 	return nil
 }
 
+// parentInterfaces returns the interface that each field of typDef was inherited from, as
+// found by parentInterface.  It walks the interfaces just once, so use it instead of
+// parentInterface when looking up all the fields of a type.
+func parentInterfaces(sch *ast.Schema, typDef *ast.Definition) map[string]*ast.Definition {
+	if len(typDef.Interfaces) == 0 {
+		return nil
+	}
+
+	parents := make(map[string]*ast.Definition)
+	for _, iface := range typDef.Interfaces {
+		interfaceDef := sch.Types[iface]
+		for _, interfaceField := range interfaceDef.Fields {
+			if _, ok := parents[interfaceField.Name]; !ok {
+				parents[interfaceField.Name] = interfaceDef
+			}
+		}
+	}
+	return parents
+}
+
 func parentInterfaceForPwdField(sch *ast.Schema, typDef *ast.Definition,
 	fieldName string) *ast.Definition {
 	if len(typDef.Interfaces) == 0 {
@@ -402,30 +895,58 @@ func convertPasswordDirective(dir *ast.Directive) *ast.FieldDefinition {
 	return fd
 }
 
-func dgraphMapping(sch *ast.Schema) map[string]map[string]string {
+func dgraphMapping(ctx context.Context,
+	sch *ast.Schema) (map[string]map[string]string, error) {
 	const (
-		add     = "Add"
-		update  = "Update"
-		del     = "Delete"
+		add        = "Add"
+		update     = "Update"
+		del        = "Delete"
 		payload = "Payload"
+		input   = "Input"
 	)
 
 	dgraphPredicate := make(map[string]map[string]string)
+	// The mapping for AddTypeInput, UpdateTypePayload and DeleteTypePayload is the same as that
+	// for Type, so it's only built once for each type.  Each of them gets its own copy, so that
+	// changing the mapping of one doesn't change the others.
+	mappings := make(map[string]map[string]string)
+	done := 0
 	for _, inputTyp := range sch.Types {
+		if err := generationStopped(ctx, "mapping the Dgraph predicates", done,
+			len(sch.Types)); err != nil {
+			return nil, err
+		}
+		done++
+
+		originalTyp := inputTyp
+		inputTypeName := inputTyp.Name
+
+		// AddTypeInput is mapped too, so that the predicates written by add mutations can be
+		// found in the mapping along with those that are read.
+		if inputTyp.Kind == ast.InputObject && strings.HasPrefix(inputTypeName, add) &&
+			strings.HasSuffix(inputTypeName, input) {
+			typ := sch.Types[strings.TrimSuffix(strings.TrimPrefix(inputTypeName, add), input)]
+			if typ == nil || typ.Kind != ast.Object {
+				continue
+			}
+			inputTyp = typ
+		}
+
 		// We only want to consider input types (object and interface) defined by the user as part
 		// of the schema hence we ignore BuiltIn, query and mutation types.
-		if inputTyp.BuiltIn || isQueryOrMutationType(inputTyp) || inputTyp.Name == "Subscription" ||
+		if inputTyp.BuiltIn || isQueryOrMutationType(inputTyp) ||
 			(inputTyp.Kind != ast.Object && inputTyp.Kind != ast.Interface) {
 			continue
 		}
-
-		originalTyp := inputTyp
-		inputTypeName := inputTyp.Name
 		if strings.HasPrefix(inputTypeName, add) && strings.HasSuffix(inputTypeName, payload) {
 			continue
 		}
 
-		dgraphPredicate[originalTyp.Name] = make(map[string]string)
+		// TypePageResult only wraps the nodes and their count, it isn't stored in Dgraph, and
+		// neither are TypeAggregateResult and TypeFieldGroup, which are computed from the nodes.
+		if pagedType(sch, inputTyp) != nil || hasGeneratedDirective(inputTyp.Directives) {
+			continue
+		}
 
 		if (strings.HasPrefix(inputTypeName, update) || strings.HasPrefix(inputTypeName, del)) &&
 			strings.HasSuffix(inputTypeName, payload) {
@@ -439,49 +960,89 @@ func dgraphMapping(sch *ast.Schema) map[string]map[string]string {
 			inputTyp = sch.Types[inputTypeName]
 		}
 
-		// We add password field to the cached type information to be used while opening
-		// resolving and rewriting queries to be sent to dgraph. Otherwise, rewriter won't
-		// know what the password field in AddInputType/ TypePatch/ TypeRef is.
-		var fields ast.FieldList
-		fields = append(fields, inputTyp.Fields...)
-		for _, directive := range inputTyp.Directives {
-			fd := convertPasswordDirective(directive)
-			if fd == nil {
-				continue
+		mapping, ok := mappings[inputTyp.Name]
+		if !ok {
+			var err error
+			if mapping, err = predicateMapping(sch, inputTyp); err != nil {
+				return nil, err
 			}
-			fields = append(fields, fd)
+			mappings[inputTyp.Name] = mapping
+		}
+		dgraphPredicate[originalTyp.Name] = copyPredicates(mapping)
+	}
+	return dgraphPredicate, nil
+}
+
+// predicateMapping returns the mapping of fieldName -> dgraph predicate for the fields of typ.
+// A field that typ inherits from an interface must map to the same predicate as it does in the
+// interface, otherwise reading it through the interface wouldn't find what was written through
+// typ, so that's an error.
+func predicateMapping(sch *ast.Schema, typ *ast.Definition) (map[string]string, error) {
+	mapping := make(map[string]string)
+
+	// We add password field to the cached type information to be used while opening
+	// resolving and rewriting queries to be sent to dgraph. Otherwise, rewriter won't
+	// know what the password field in AddInputType/ TypePatch/ TypeRef is.
+	var fields ast.FieldList
+	fields = append(fields, typ.Fields...)
+	for _, directive := range typ.Directives {
+		fd := convertPasswordDirective(directive)
+		if fd == nil {
+			continue
 		}
+		fields = append(fields, fd)
+	}
 
-		for _, fld := range fields {
-			if isID(fld) {
-				// We don't need a mapping for the field, as we the dgraph predicate for them is
-				// fixed i.e. uid.
-				continue
-			}
-			typName := typeName(inputTyp)
-			parentInt := parentInterface(sch, inputTyp, fld.Name)
-			if parentInt != nil {
-				typName = typeName(parentInt)
+	parents := parentInterfaces(sch, typ)
+	for _, fld := range fields {
+		if isID(fld) {
+			// We don't need a mapping for the field, as we the dgraph predicate for them is
+			// fixed i.e. uid.
+			continue
+		}
+		if hasCustomDirective(fld) {
+			// The field is resolved by @custom, so there's no Dgraph predicate for it.
+			continue
+		}
+		if facetName(fld) != "" {
+			// The field is a facet of the edges to the node, which facetMappings records.
+			continue
+		}
+		if aggregatedField(typ, fld) != nil {
+			// The field is computed from the nodes of the list field it aggregates.
+			continue
+		}
+		typName := typeName(typ)
+		parentInt := parents[fld.Name]
+		if parentInt != nil {
+			typName = typeName(parentInt)
+		}
+		// 1. For fields that have @dgraph(pred: xxxName) directive, field name would be
+		//    xxxName.
+		// 2. For fields where the type (or underlying interface) has a @dgraph(type: xxxName)
+		//    directive, field name would be xxxName.fldName.
+		//
+		// The cases below cover the cases where neither the type or field have @dgraph
+		// directive.
+		// 3. For types which don't inherit from an interface the keys, value would be.
+		//    typName,fldName => typName.fldName
+		// 4. For types which inherit fields from an interface
+		//    typName,fldName => interfaceName.fldName
+		// 5. For DeleteTypePayload type
+		//    DeleteTypePayload,fldName => typName.fldName
+
+		fname := fieldName(fld, typName)
+		if parentInt != nil {
+			if ifaceFname := fieldName(parentInt.Fields.ForName(fld.Name),
+				typName); ifaceFname != fname {
+				return nil, errors.Errorf("Type %s; Field %s: maps to the Dgraph predicate %s, "+
+					"but it maps to %s in the interface %s it implements, these must be the same.",
+					typ.Name, fld.Name, fname, ifaceFname, parentInt.Name)
 			}
-			// 1. For fields that have @dgraph(pred: xxxName) directive, field name would be
-			//    xxxName.
-			// 2. For fields where the type (or underlying interface) has a @dgraph(type: xxxName)
-			//    directive, field name would be xxxName.fldName.
-			//
-			// The cases below cover the cases where neither the type or field have @dgraph
-			// directive.
-			// 3. For types which don't inherit from an interface the keys, value would be.
-			//    typName,fldName => typName.fldName
-			// 4. For types which inherit fields from an interface
-			//    typName,fldName => interfaceName.fldName
-			// 5. For DeleteTypePayload type
-			//    DeleteTypePayload,fldName => typName.fldName
-
-			fname := fieldName(fld, typName)
-			dgraphPredicate[originalTyp.Name][fld.Name] = fname
 		}
+		mapping[fld.Name] = fname
 	}
-	return dgraphPredicate
+	return mapping, nil
 }
 
 func mutatedTypeMapping(s *schema,
@@ -496,6 +1057,8 @@ func mutatedTypeMapping(s *schema,
 		switch {
 		case strings.HasPrefix(field.Name, "add"):
 			mutatedTypeName = strings.TrimPrefix(field.Name, "add")
+		case strings.HasPrefix(field.Name, "upsert"):
+			mutatedTypeName = strings.TrimPrefix(field.Name, "upsert")
 		case strings.HasPrefix(field.Name, "update"):
 			mutatedTypeName = strings.TrimPrefix(field.Name, "update")
 		case strings.HasPrefix(field.Name, "delete"):
@@ -566,29 +1129,192 @@ func customMappings(s *ast.Schema) map[string]map[string]*ast.Directive {
 	return customDirectives
 }
 
+func facetMappings(s *ast.Schema) map[string]map[string]string {
+	facets := make(map[string]map[string]string)
+	for _, typ := range s.Types {
+		if typ.Kind != ast.Object && typ.Kind != ast.Interface {
+			continue
+		}
+		for _, fld := range typ.Fields {
+			facet := facetName(fld)
+			if facet == "" {
+				continue
+			}
+			if facets[typ.Name] == nil {
+				facets[typ.Name] = make(map[string]string)
+			}
+			facets[typ.Name][fld.Name] = facet
+		}
+	}
+	return facets
+}
+
+func compositeKeyMappings(s *ast.Schema) map[string]map[string][]string {
+	compositeKeyMap := make(map[string]map[string][]string)
+
+	for _, typ := range s.Types {
+		if typ.Kind != ast.Object && typ.Kind != ast.Interface {
+			continue
+		}
+		keys, names := compositeKeys(typ)
+		if len(names) == 0 {
+			continue
+		}
+		keyMap := make(map[string][]string, len(names))
+		for _, name := range names {
+			for _, fld := range keys[name] {
+				keyMap[name] = append(keyMap[name], fld.Name)
+			}
+		}
+		compositeKeyMap[typ.Name] = keyMap
+	}
+
+	return compositeKeyMap
+}
+
 // AsSchema wraps a github.com/vektah/gqlparser/ast.Schema.
 func AsSchema(s *ast.Schema) (Schema, error) {
+	sch, err := asSchema(context.Background(), s)
+	if err != nil {
+		return nil, err
+	}
+	return sch, nil
+}
+
+func asSchema(ctx context.Context, s *ast.Schema) (*schema, error) {
+
+	// A schema that didn't come from schema generation can have @hasInverse on a scalar field,
+	// which would have no inverse field to look up.
+	if errs := inverseFieldErrors(s); len(errs) > 0 {
+		return nil, errs
+	}
+	// Likewise, its @default values haven't been checked against the types of their fields.
+	if errs := defaultValueErrors(s); len(errs) > 0 {
+		return nil, errs
+	}
+	// Nor have the types of the fields that share a predicate with @dgraph(pred: ...).
+	if errs := predicateTypeErrors(s); len(errs) > 0 {
+		return nil, errs
+	}
 
 	// Auth rules can't be effectively validated as part of the normal rules -
 	// because they need the fully generated schema to be checked against.
-	authRules, err := authRules(s)
+	authRules, err := authRules(ctx, s)
 	if err != nil {
 		return nil, err
 	}
 
-	dgraphPredicate := dgraphMapping(s)
+	dgraphPredicate, err := dgraphMapping(ctx, s)
+	if err != nil {
+		return nil, err
+	}
 	sch := &schema{
 		schema:           s,
 		dgraphPredicate:  dgraphPredicate,
 		typeNameAst:      typeMappings(s),
 		customDirectives: customMappings(s),
+		facets:           facetMappings(s),
 		authRules:        authRules,
+		compositeKeys:    compositeKeyMappings(s),
 	}
 	sch.mutatedType = mutatedTypeMapping(sch, dgraphPredicate)
+	for _, typ := range s.Types {
+		if typ.Kind == ast.Enum && isCaseInsensitiveEnum(typ) {
+			sch.caseInsensitiveEnums = true
+			break
+		}
+	}
 
 	return sch, nil
 }
 
+func inverseFieldErrors(s *ast.Schema) gqlerror.List {
+	var errs gqlerror.List
+	for _, typ := range s.Types {
+		if typ.Kind != ast.Object && typ.Kind != ast.Interface {
+			continue
+		}
+		for _, field := range typ.Fields {
+			if field.Directives.ForName(inverseDirective) == nil {
+				continue
+			}
+			if err := hasInverseOnNonObject(s, typ, field); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+func defaultValueErrors(s *ast.Schema) gqlerror.List {
+	var errs gqlerror.List
+	for _, typ := range s.Types {
+		if typ.Kind != ast.Object && typ.Kind != ast.Interface {
+			continue
+		}
+		for _, field := range typ.Fields {
+			if field.Directives.ForName(defaultDirective) == nil {
+				continue
+			}
+			if err := defaultValueError(s, typ, field); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// predicateTypeErrors returns an error for each scalar field of s that's stored with
+// @dgraph(pred: ...) in the same predicate as a scalar field of another type, if they are of
+// different types.  Writing one of them would corrupt the values of the other.  Each error
+// gives the locations of both fields.
+func predicateTypeErrors(s *ast.Schema) gqlerror.List {
+	names := make([]string, 0, len(s.Types))
+	for name, typ := range s.Types {
+		if !typ.BuiltIn && (typ.Kind == ast.Object || typ.Kind == ast.Interface) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs gqlerror.List
+	first := make(map[string]typeField)
+	for _, name := range names {
+		typ := s.Types[name]
+		for _, fld := range typ.Fields {
+			dir := fld.Directives.ForName(dgraphDirective)
+			if dir == nil || dir.Arguments.ForName(dgraphPredArg) == nil {
+				continue
+			}
+			if fldTyp := s.Types[fld.Type.Name()]; fldTyp == nil || fldTyp.Kind != ast.Scalar {
+				continue
+			}
+			pred := dir.Arguments.ForName(dgraphPredArg).Value.Raw
+			prev, ok := first[pred]
+			if !ok {
+				first[pred] = typeField{defn: typ, fld: fld}
+				continue
+			}
+			if predicateType(fld.Type) == predicateType(prev.fld.Type) {
+				continue
+			}
+
+			err := gqlerror.ErrorPosf(fld.Position, "Type %s; Field %s: has type %s, which is "+
+				"different to type %s; field %s, which has type %s, but both are stored in the "+
+				"predicate %s with @dgraph(pred: ...). These fields must have the same type, or "+
+				"use different Dgraph predicates.", typ.Name, fld.Name,
+				predicateType(fld.Type), prev.defn.Name, prev.fld.Name,
+				predicateType(prev.fld.Type), pred)
+			err.Locations = append(err.Locations, gqlerror.Location{
+				Line:   prev.fld.Position.Line,
+				Column: prev.fld.Position.Column,
+			})
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
 func responseName(f *ast.Field) string {
 	if f.Alias == "" {
 		return f.Name
@@ -626,10 +1352,32 @@ func (f *field) IsAuthQuery() bool {
 	return f.field.Arguments.ForName("dgraph.uid") != nil
 }
 
+func (f *field) AuthRules() *AuthContainer {
+	if f.field.ObjectDefinition == nil {
+		return nil
+	}
+	auth := f.op.inSchema.authRules[typeName(f.field.ObjectDefinition)]
+	if auth == nil {
+		return nil
+	}
+	if list := f.AggregatedField(); list != "" {
+		// Only those who can see the nodes of a list can see what they aggregate to.
+		return auth.Fields[list]
+	}
+	return auth.Fields[f.Name()]
+}
+
 func (f *field) ArgValue(name string) interface{} {
 	if f.arguments == nil {
 		// Compute and cache the map first time this function is called for a field.
 		f.arguments = f.field.ArgumentMap(f.op.vars)
+		if f.op.inSchema.relayIDs {
+			// The operation's IDs were checked when it was built, so this only fails for
+			// fields built later, such as auth queries, whose IDs are left as they are.
+			if args, err := relayArgs(f.op.inSchema, f.field, f.arguments); err == nil {
+				f.arguments = args
+			}
+		}
 	}
 	return f.arguments[name]
 }
@@ -673,19 +1421,43 @@ func (f *field) HasCustomDirective() (bool, map[string]bool) {
 		return false, nil
 	}
 
-	var rf map[string]bool
 	httpArg := custom.Arguments.ForName("http")
+	if httpArg == nil {
+		// @custom(dql: ...) only needs the arguments of the query.
+		return true, make(map[string]bool)
+	}
 
-	bodyArg := httpArg.Value.Children.ForName("body")
+	// Any of the configs in a fallback chain could end up making the request, so the fields that
+	// any of them need are required.
+	rf := make(map[string]bool)
+	for _, httpVal := range listValues(httpArg.Value) {
+		required := requiredArgsFromHTTP(httpVal, f.op.inSchema.secrets)
+		if required == nil {
+			return true, nil
+		}
+		for name := range required {
+			rf[name] = true
+		}
+	}
+	return true, rf
+}
+
+// requiredArgsFromHTTP returns the variables that the http config httpVal of @custom uses, or nil
+// if they couldn't be worked out.  Header templates can use the schema's secrets, which aren't
+// variables.
+func requiredArgsFromHTTP(httpVal *ast.Value,
+	secrets map[string]x.SensitiveByteSlice) map[string]bool {
+	var rf map[string]bool
+	bodyArg := httpVal.Children.ForName("body")
 	if bodyArg != nil {
 		bodyTemplate := bodyArg.Raw
-		_, rf, _ = parseBodyTemplate(bodyTemplate)
+		_, rf, _, _ = parseBodyTemplate(bodyTemplate)
 	}
 
 	if rf == nil {
 		rf = make(map[string]bool)
 	}
-	rawURL := httpArg.Value.Children.ForName("url").Raw
+	rawURL := httpVal.Children.ForName("url").Raw
 	// Error here should be nil as we should have parsed and validated the URL
 	// already.
 	u, _ := url.Parse(rawURL)
@@ -703,27 +1475,39 @@ func (f *field) HasCustomDirective() (bool, map[string]bool) {
 		}
 	}
 
-	graphqlArg := httpArg.Value.Children.ForName("graphql")
+	graphqlArg := httpVal.Children.ForName("graphql")
 	if graphqlArg == nil {
-		return true, rf
+		addRequiredArgsFromHeaders(rf, httpVal, secrets)
+		return rf
 	}
 	modeVal := ""
-	modeArg := httpArg.Value.Children.ForName(mode)
+	modeArg := httpVal.Children.ForName(mode)
 	if modeArg != nil {
 		modeVal = modeArg.Raw
 	}
 
-	if modeVal == SINGLE {
-		// For BATCH mode, required args would have been parsed from the body above.
+	if modeVal == SINGLE && bodyArg == nil {
+		// For BATCH mode, or when the body is a template for the variables in SINGLE mode,
+		// required args would have been parsed from the body above.
 		var err error
 		rf, err = parseRequiredArgsFromGQLRequest(graphqlArg.Raw)
 		// This should not be returning an error since we should have validated this during schema
 		// update.
 		if err != nil {
-			return true, nil
+			return nil
 		}
 	}
-	return true, rf
+	addRequiredArgsFromHeaders(rf, httpVal, secrets)
+	return rf
+}
+
+// addRequiredArgsFromHeaders adds the variables used in the header templates given in the http
+// argument of @custom to rf.
+func addRequiredArgsFromHeaders(rf map[string]bool, httpArg *ast.Value,
+	secrets map[string]x.SensitiveByteSlice) {
+	for name := range headerTemplateVars(httpArg, secrets) {
+		rf[name] = true
+	}
 }
 
 func (f *field) XIDArg() string {
@@ -799,47 +1583,95 @@ func (f *field) Type() Type {
 }
 
 func (f *field) InterfaceType() bool {
-	return f.op.inSchema.schema.Types[f.field.Definition.Type.Name()].Kind == ast.Interface
+	kind := f.op.inSchema.schema.Types[f.field.Definition.Type.Name()].Kind
+	return kind == ast.Interface || kind == ast.Union
 }
 
 func (f *field) GetObjectName() string {
 	return f.field.ObjectDefinition.Name
 }
 
-func getCustomHTTPConfig(f *field, isQueryOrMutation bool) (FieldHTTPConfig, error) {
+// getCustomHTTPConfig returns the configs of the http argument of the @custom directive of f, in
+// the order they should be tried.  That's a list of just one config, unless the http argument is
+// a fallback chain, like @custom(http: [{...}, {...}]).
+func getCustomHTTPConfig(f *field, isQueryOrMutation bool,
+	claims map[string]interface{}) ([]FieldHTTPConfig, error) {
 	custom := f.op.inSchema.customDirectives[f.GetObjectName()][f.Name()]
 	httpArg := custom.Arguments.ForName("http")
+
+	httpVals := listValues(httpArg.Value)
+	fconfs := make([]FieldHTTPConfig, 0, len(httpVals))
+	for _, httpVal := range httpVals {
+		fconf, err := httpConfig(f, httpVal, isQueryOrMutation, claims)
+		if err != nil {
+			return nil, err
+		}
+		fconfs = append(fconfs, fconf)
+	}
+	return fconfs, nil
+}
+
+// httpConfig returns the config for the remote request given by httpVal, one of the http configs
+// of the @custom directive of f.
+func httpConfig(f *field, httpVal *ast.Value, isQueryOrMutation bool,
+	claims map[string]interface{}) (FieldHTTPConfig, error) {
+	rawURL := httpVal.Children.ForName("url").Raw
 	fconf := FieldHTTPConfig{
-		URL:    httpArg.Value.Children.ForName("url").Raw,
-		Method: httpArg.Value.Children.ForName("method").Raw,
+		URL:         rawURL,
+		URLTemplate: rawURL,
+		Method:      httpVal.Children.ForName("method").Raw,
+		Loopback:    rawURL == LoopbackURL,
 	}
 
 	fconf.Mode = SINGLE
-	op := httpArg.Value.Children.ForName(mode)
+	op := httpVal.Children.ForName(mode)
 	if op != nil {
 		fconf.Mode = op.Raw
 	}
 
-	// both body and graphql can't be present together
-	bodyArg := httpArg.Value.Children.ForName("body")
-	graphqlArg := httpArg.Value.Children.ForName("graphql")
+	if resultPath := httpVal.Children.ForName("resultPath"); resultPath != nil {
+		fconf.ResultPath = resultPath.Raw
+	}
+	if strictPath := httpVal.Children.ForName("strictPath"); strictPath != nil {
+		fconf.StrictPath = strictPath.Raw == "true"
+	}
+	if errorHandling := httpVal.Children.ForName("errorHandling"); errorHandling != nil {
+		fconf.ErrorHandling = httpErrorHandling(errorHandling)
+	}
+
+	bodyArg := httpVal.Children.ForName("body")
+	graphqlArg := httpVal.Children.ForName("graphql")
+	// For GraphQL in SINGLE mode, the body is a template for the variables and not for the
+	// whole request.
+	hasVarsTemplate := graphqlArg != nil && bodyArg != nil && fconf.Mode == SINGLE
 	var bodyTemplate string
-	if bodyArg != nil {
+	if bodyArg != nil && !hasVarsTemplate {
 		bodyTemplate = bodyArg.Raw
 	} else if graphqlArg != nil {
 		bodyTemplate = `{ query: $query, variables: $variables }`
 	}
 	// bodyTemplate will be empty if there was no body or graphql, like the case of a simple GET req
 	if bodyTemplate != "" {
-		bt, rf, err := parseBodyTemplate(bodyTemplate)
+		bt, rf, rc, err := parseBodyTemplate(bodyTemplate)
 		if err != nil {
 			return fconf, err
 		}
 		fconf.Template = bt
 		fconf.RequiredArgs = rf
+		fconf.RequiredClaims = rc
+		// both body and graphql are always sent as JSON
+		fconf.ContentType = "application/json"
 	}
 
-	if !isQueryOrMutation && graphqlArg != nil && fconf.Mode == SINGLE {
+	if hasVarsTemplate {
+		vt, rf, rc, err := parseBodyTemplate(bodyArg.Raw)
+		if err != nil {
+			return fconf, err
+		}
+		fconf.VariablesTemplate = vt
+		fconf.RequiredArgs = rf
+		fconf.RequiredClaims = rc
+	} else if !isQueryOrMutation && graphqlArg != nil && fconf.Mode == SINGLE {
 		// For BATCH mode, required args would have been parsed from the body above.
 		// Safe to ignore the error here since we should already have validated that we can parse
 		// the required args from the GraphQL request during schema update.
@@ -847,21 +1679,25 @@ func getCustomHTTPConfig(f *field, isQueryOrMutation bool) (FieldHTTPConfig, err
 	}
 
 	fconf.ForwardHeaders = http.Header{}
-	secretHeaders := httpArg.Value.Children.ForName("secretHeaders")
+	fconf.HeaderTemplates = make(map[string]string)
+	secrets := f.op.inSchema.secrets
+	secretHeaders := httpVal.Children.ForName("secretHeaders")
 	if secretHeaders != nil {
-		hc.RLock()
 		for _, h := range secretHeaders.Children {
 			key := strings.Split(h.Value.Raw, ":")
 			if len(key) == 1 {
 				key = []string{h.Value.Raw, h.Value.Raw}
 			}
-			val := string(hc.secrets[key[1]])
-			fconf.ForwardHeaders.Set(key[0], val)
+			if isHeaderTemplate(key[1]) {
+				fconf.setHeaderTemplate(key[0], substituteSecretsInHeader(key[1], secrets))
+				continue
+			}
+			val := string(secrets[key[1]])
+			fconf.setHeader(key[0], val)
 		}
-		hc.RUnlock()
 	}
 
-	forwardHeaders := httpArg.Value.Children.ForName("forwardHeaders")
+	forwardHeaders := httpVal.Children.ForName("forwardHeaders")
 	if forwardHeaders != nil {
 		for _, h := range forwardHeaders.Children {
 			// We would override the header if it was also specified as part of secretHeaders.
@@ -869,22 +1705,30 @@ func getCustomHTTPConfig(f *field, isQueryOrMutation bool) (FieldHTTPConfig, err
 			if len(key) == 1 {
 				key = []string{h.Value.Raw, h.Value.Raw}
 			}
-			reqHeaderVal := f.op.header.Get(key[1])
-			fconf.ForwardHeaders.Set(key[0], reqHeaderVal)
+			if isHeaderTemplate(key[1]) {
+				fconf.setHeaderTemplate(key[0], key[1])
+				continue
+			}
+			reqHeaderVal := f.op.header.Get(key[1])
+			fconf.setHeader(key[0], reqHeaderVal)
 		}
 	}
 
+	var remoteOp *ast.OperationDefinition
+	var remoteRequired []string
 	if graphqlArg != nil {
 		queryDoc, gqlErr := parser.ParseQuery(&ast.Source{Input: graphqlArg.Raw})
 		if gqlErr != nil {
 			return fconf, gqlErr
 		}
 		// queryDoc will always have only one operation with only one field
-		qfield := queryDoc.Operations[0].SelectionSet[0].(*ast.Field)
+		remoteOp = queryDoc.Operations[0]
+		qfield := remoteOp.SelectionSet[0].(*ast.Field)
 		if fconf.Mode == BATCH {
 			fconf.GraphqlBatchModeArgument = queryDoc.Operations[0].VariableDefinitions[0].Variable
 		}
 		fconf.RemoteGqlQueryName = qfield.Name
+		remoteRequired = f.op.inSchema.remoteArgs[f.GetObjectName()][f.Name()][qfield.Name]
 		buf := &bytes.Buffer{}
 		buildGraphqlRequestFields(buf, f.field)
 		remoteQuery := graphqlArg.Raw
@@ -909,18 +1753,143 @@ func getCustomHTTPConfig(f *field, isQueryOrMutation bool) (FieldHTTPConfig, err
 			bodyVars = make(map[string]interface{})
 			bodyVars["query"] = fconf.RemoteGqlQuery
 			bodyVars["variables"] = argMap
+			if fconf.VariablesTemplate != nil {
+				bodyVars["variables"], err = ApplyTemplate(*fconf.VariablesTemplate, argMap, claims)
+				if err != nil {
+					return fconf, errors.Wrapf(err, "while substituting vars in variables")
+				}
+			}
+			if err = checkRequiredRemoteArgs(remoteOp, bodyVars["variables"],
+				remoteRequired); err != nil {
+				return fconf, err
+			}
 		}
 		if fconf.Template != nil {
-			if err = SubstituteVarsInBody(fconf.Template, bodyVars); err != nil {
+			body, err := ApplyTemplate(*fconf.Template, bodyVars, claims)
+			if err != nil {
 				return fconf, errors.Wrapf(err, "while substituting vars in Body")
 			}
+			fconf.Template = &body
 		}
+		fconf.ForwardHeaders = fconf.ResolvedHeaders(argMap)
 	}
 	return fconf, nil
 }
 
-func (f *field) CustomHTTPConfig() (FieldHTTPConfig, error) {
-	return getCustomHTTPConfig(f, false)
+// httpErrorHandling returns the HTTPErrorHandling given by val, the errorHandling of a @custom
+// directive.  It's already been validated, so the statuses in nullOn are ints.
+func httpErrorHandling(val *ast.Value) *HTTPErrorHandling {
+	eh := &HTTPErrorHandling{}
+	if nullOn := val.Children.ForName("nullOn"); nullOn != nil {
+		for _, status := range nullOn.Children {
+			code, _ := strconv.Atoi(status.Value.Raw)
+			eh.NullOn = append(eh.NullOn, code)
+		}
+	}
+	if messagePath := val.Children.ForName("messagePath"); messagePath != nil {
+		eh.MessagePath = messagePath.Raw
+	}
+	if propagateStatus := val.Children.ForName("propagateStatus"); propagateStatus != nil {
+		eh.PropagateStatus = propagateStatus.Raw == "true"
+	}
+	return eh
+}
+
+// setHeader sets the header to the given value, overriding any template given for it earlier.
+func (fconf *FieldHTTPConfig) setHeader(key, val string) {
+	fconf.ForwardHeaders.Set(key, val)
+	delete(fconf.HeaderTemplates, http.CanonicalHeaderKey(key))
+}
+
+// setHeaderTemplate sets the template for the value of the header, overriding any value given
+// for it earlier.
+func (fconf *FieldHTTPConfig) setHeaderTemplate(key, tmpl string) {
+	fconf.ForwardHeaders.Del(key)
+	fconf.HeaderTemplates[http.CanonicalHeaderKey(key)] = tmpl
+}
+
+// checkRequiredRemoteArgs returns an error if op, the remote query or mutation of a @custom
+// graphql, doesn't give a value for a required argument of the remote query, so that the
+// request is failed here, rather than being sent only for the remote to reject it.  required
+// are the non-null arguments of the remote query, as introspected when the schema was
+// validated.  Each must be given in op, and if it's given by a variable, vars, the variables
+// sent along with op, must have a value for it.  Without introspection, the required arguments
+// are taken to be those given by a non-null variable without a default.
+func checkRequiredRemoteArgs(op *ast.OperationDefinition, vars interface{},
+	required []string) error {
+	varVals, ok := vars.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	qfield := op.SelectionSet[0].(*ast.Field)
+	missingErr := func(argName string) error {
+		return errors.Errorf("argument `%s` of remote %s `%s` is required, but no value "+
+			"is given for it.", argName, op.Operation, qfield.Name)
+	}
+
+	for _, argName := range required {
+		arg := qfield.Arguments.ForName(argName)
+		if arg == nil {
+			return missingErr(argName)
+		}
+		if arg.Value.Kind == ast.Variable && varVals[arg.Value.Raw] == nil {
+			if vd := op.VariableDefinitions.ForName(arg.Value.Raw); vd == nil ||
+				vd.DefaultValue == nil {
+				return missingErr(argName)
+			}
+		}
+	}
+
+	for _, vd := range op.VariableDefinitions {
+		if !vd.Type.NonNull || vd.DefaultValue != nil || varVals[vd.Variable] != nil {
+			continue
+		}
+		argName := "$" + vd.Variable
+		for _, arg := range qfield.Arguments {
+			if arg.Value.Kind == ast.Variable && arg.Value.Raw == vd.Variable {
+				argName = arg.Name
+				break
+			}
+		}
+		return missingErr(argName)
+	}
+	return nil
+}
+
+// ResolvedHeaders returns the headers to send in the HTTP request, that is ForwardHeaders along
+// with HeaderTemplates resolved using vars. See SubstituteVarsInHeaders.
+func (fconf *FieldHTTPConfig) ResolvedHeaders(vars map[string]interface{}) http.Header {
+	return SubstituteVarsInHeaders(fconf.ForwardHeaders, fconf.HeaderTemplates, vars)
+}
+
+// CustomHTTPConfig returns the configs for the remote requests of the @custom field f.  The body
+// of a field is a template that's filled in for every value the field is resolved for, so unlike
+// for queries and mutations, claims aren't substituted into it here.
+func (f *field) CustomHTTPConfig(claims map[string]interface{}) ([]FieldHTTPConfig, error) {
+	return getCustomHTTPConfig(f, false, claims)
+}
+
+func (f *field) CustomHTTPUsesClaims() bool {
+	custom := f.op.inSchema.customDirectives[f.GetObjectName()][f.Name()]
+	if custom == nil {
+		return false
+	}
+	httpArg := custom.Arguments.ForName("http")
+	if httpArg == nil {
+		return false
+	}
+	for _, httpVal := range listValues(httpArg.Value) {
+		bodyArg := httpVal.Children.ForName("body")
+		if bodyArg == nil {
+			continue
+		}
+		// The body has been validated along with the schema, so it parses.
+		if _, _, rc, _ := parseBodyTemplate(bodyArg.Raw); len(rc) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (f *field) EnumValues() []string {
@@ -933,6 +1902,38 @@ func (f *field) EnumValues() []string {
 	return res
 }
 
+func (f *field) EnumValue(val string) (string, bool) {
+	return enumValue(f.op.inSchema.schema.Types[f.Type().Name()], val)
+}
+
+// enumValue returns the value of enum def that val is, see Field.EnumValue.
+func enumValue(def *ast.Definition, val string) (string, bool) {
+	if def == nil || def.Kind != ast.Enum {
+		return "", false
+	}
+	if ev := def.EnumValues.ForName(val); ev != nil {
+		return ev.Name, true
+	}
+	if !isCaseInsensitiveEnum(def) {
+		return "", false
+	}
+	for _, ev := range def.EnumValues {
+		if strings.EqualFold(ev.Name, val) {
+			return ev.Name, true
+		}
+	}
+	return "", false
+}
+
+func isCaseInsensitiveEnum(def *ast.Definition) bool {
+	dir := def.Directives.ForName(enumDirective)
+	if dir == nil {
+		return false
+	}
+	arg := dir.Arguments.ForName(caseInsensitiveArg)
+	return arg != nil && arg.Value != nil && arg.Value.Raw == "true"
+}
+
 func (f *field) SelectionSet() (flds []Field) {
 	for _, s := range f.field.SelectionSet {
 		if fld, ok := s.(*ast.Field); ok {
@@ -978,6 +1979,38 @@ func (f *field) TypeName(dgraphTypes []interface{}) string {
 	return ""
 }
 
+func (f *field) RelayID(uid string, dgraphTypes []interface{}) string {
+	if !f.op.inSchema.relayIDs || f.field.Definition == nil || !isID(f.field.Definition) ||
+		f.field.ObjectDefinition == nil ||
+		f.field.ObjectDefinition.Directives.ForName(remoteDirective) != nil {
+		return uid
+	}
+	if custom, _ := f.HasCustomDirective(); custom {
+		return uid
+	}
+
+	typName := f.GetObjectName()
+	if len(dgraphTypes) > 0 {
+		typName = f.TypeName(dgraphTypes)
+	}
+	return EncodeRelayID(typName, uid)
+}
+
+func (f *field) AggregatedField() string {
+	if list := aggregatedField(f.field.ObjectDefinition, f.field.Definition); list != nil {
+		return list.Name
+	}
+	return ""
+}
+
+func (f *field) ObjectType() Type {
+	return &astType{
+		typ:             &ast.Type{NamedType: f.field.ObjectDefinition.Name},
+		inSchema:        f.op.inSchema,
+		dgraphPredicate: f.op.inSchema.dgraphPredicate,
+	}
+}
+
 func (f *field) IncludeInterfaceField(dgraphTypes []interface{}) bool {
 	// As ID maps to uid in dgraph, so it is not stored as an edge, hence does not appear in
 	// f.op.inSchema.dgraphPredicate map. So, always include the queried field if it is of ID type.
@@ -1008,6 +2041,10 @@ func (q *query) IsAuthQuery() bool {
 	return (*field)(q).field.Arguments.ForName("dgraph.uid") != nil
 }
 
+func (q *query) AuthRules() *AuthContainer {
+	return (*field)(q).AuthRules()
+}
+
 func (q *query) AuthFor(typ Type, jwtVars map[string]interface{}) Query {
 	// copy the template, so that multiple queries can run rewriting for the rule.
 	return &query{
@@ -1021,6 +2058,144 @@ func (q *query) AuthFor(typ Type, jwtVars map[string]interface{}) Query {
 		sel: q.sel}
 }
 
+func (q *query) NodesQuery() Query {
+	typName := q.Type().Field(PageNodes).Type().Name()
+	qryName := "query" + typName
+	nodes := &ast.Field{
+		Alias:            qryName,
+		Name:             qryName,
+		Arguments:        q.field.Arguments,
+		Definition:       q.op.inSchema.schema.Query.Fields.ForName(qryName),
+		ObjectDefinition: q.op.inSchema.schema.Query,
+		Position:         q.field.Position,
+	}
+	// If nodes is asked for more than once (with different aliases), the selection sets are
+	// merged so that a single Dgraph block has everything needed to complete all of them.
+	for _, s := range q.field.SelectionSet {
+		if fld, ok := s.(*ast.Field); ok && fld.Name == PageNodes {
+			nodes.SelectionSet = append(nodes.SelectionSet, fld.SelectionSet...)
+			nodes.Directives = append(nodes.Directives, fld.Directives...)
+		}
+	}
+	return &query{field: nodes, op: q.op, sel: nodes}
+}
+
+func (q *query) SubscribedQuery() Query {
+	typ := q.Type().Field(SubscriptionNode).Type()
+	qryName := "query" + typ.Name()
+	nodes := &ast.Field{
+		Alias:            qryName,
+		Name:             qryName,
+		Arguments:        q.field.Arguments,
+		Definition:       q.op.inSchema.schema.Query.Fields.ForName(qryName),
+		ObjectDefinition: q.op.inSchema.schema.Query,
+		Position:         q.field.Position,
+	}
+	for _, s := range q.field.SelectionSet {
+		if fld, ok := s.(*ast.Field); ok && fld.Name == SubscriptionNode {
+			nodes.SelectionSet = append(nodes.SelectionSet, fld.SelectionSet...)
+			nodes.Directives = append(nodes.Directives, fld.Directives...)
+		}
+	}
+
+	// The nodes are told apart by their ID fields, so those are queried even if the node field
+	// doesn't ask for them.
+	defn := q.op.inSchema.schema.Types[typ.Name()]
+	for _, id := range []FieldDefinition{typ.IDField(), typ.XIDField()} {
+		if id == nil || selectsField(nodes.SelectionSet, id.Name()) {
+			continue
+		}
+		nodes.SelectionSet = append(nodes.SelectionSet, &ast.Field{
+			Alias:            id.Name(),
+			Name:             id.Name(),
+			Definition:       defn.Fields.ForName(id.Name()),
+			ObjectDefinition: defn,
+			Position:         q.field.Position,
+		})
+	}
+	return &query{field: nodes, op: q.op, sel: nodes}
+}
+
+func (q *query) GroupedQuery() (Query, FieldDefinition) {
+	sch := q.op.inSchema.schema
+	typ, fld := groupedField(sch, sch.Types[q.Type().Name()])
+	if typ == nil {
+		return nil, nil
+	}
+	qryName := "query" + typ.Name
+	nodes := &ast.Field{
+		Alias:            qryName,
+		Name:             qryName,
+		Arguments:        q.field.Arguments,
+		Definition:       sch.Query.Fields.ForName(qryName),
+		ObjectDefinition: sch.Query,
+		Position:         q.field.Position,
+	}
+	nodesQry := &query{field: nodes, op: q.op, sel: nodes}
+	return nodesQry, nodesQry.Type().Field(fld.Name)
+}
+
+// selectsField returns true if sels has the field name, under any alias.
+func selectsField(sels ast.SelectionSet, name string) bool {
+	for _, s := range sels {
+		if fld, ok := s.(*ast.Field); ok && fld.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *query) NodeGetQuery() (Query, error) {
+	// The id was checked when the operation was built, so it decodes.
+	id, _ := q.field.ArgumentMap(q.op.vars)[relayIDField].(string)
+	typName, _, err := DecodeRelayID(id)
+	if err != nil {
+		return nil, x.GqlErrorf("%s", err).WithLocations(q.Location())
+	}
+
+	sch := q.op.inSchema.schema
+	typ := sch.Types[typName]
+	getName := "get" + typName
+	getDefn := sch.Query.Fields.ForName(getName)
+	if typ == nil || getDefn == nil {
+		return nil, x.GqlErrorf("%s can't find node %s, the schema has no %s query.",
+			relayNodeQuery, id, getName).WithLocations(q.Location())
+	}
+
+	get := &ast.Field{
+		Alias: q.ResponseName(),
+		Name:  getName,
+		Arguments: ast.ArgumentList{{
+			Name:     relayIDField,
+			Value:    &ast.Value{Kind: ast.StringValue, Raw: id},
+			Position: q.field.Position,
+		}},
+		Directives:       q.field.Directives,
+		Definition:       getDefn,
+		ObjectDefinition: sch.Query,
+		Position:         q.field.Position,
+	}
+	// The selection set has the fields of all the fragments in the query, only the ones on
+	// typ, or on an interface typ implements, are asked of typ.
+	for _, s := range q.field.SelectionSet {
+		fld, ok := s.(*ast.Field)
+		if !ok || fld.ObjectDefinition == nil {
+			continue
+		}
+		if fld.ObjectDefinition.Name != typName &&
+			!implementsInterface(typ, fld.ObjectDefinition.Name) {
+			continue
+		}
+		typFld := *fld
+		typFld.ObjectDefinition = typ
+		if fd := typ.Fields.ForName(fld.Name); fd != nil {
+			typFld.Definition = fd
+		}
+		get.SelectionSet = append(get.SelectionSet, &typFld)
+	}
+	return &query{field: get, op: q.op, sel: get}, nil
+}
+
 func (q *query) Rename(newName string) {
 	q.field.Name = newName
 }
@@ -1089,22 +2264,72 @@ func (q *query) GetObjectName() string {
 	return q.field.ObjectDefinition.Name
 }
 
-func (q *query) CustomHTTPConfig() (FieldHTTPConfig, error) {
-	return getCustomHTTPConfig((*field)(q), true)
+func (q *query) CustomHTTPConfig(claims map[string]interface{}) ([]FieldHTTPConfig, error) {
+	return getCustomHTTPConfig((*field)(q), true, claims)
+}
+
+func (q *query) CustomHTTPUsesClaims() bool {
+	return (*field)(q).CustomHTTPUsesClaims()
+}
+
+func (q *query) CustomDQLConfig() (FieldDQLConfig, bool) {
+	custom := q.op.inSchema.customDirectives[q.GetObjectName()][q.Name()]
+	if custom == nil {
+		return FieldDQLConfig{}, false
+	}
+	dqlArg := custom.Arguments.ForName(dql)
+	if dqlArg == nil {
+		return FieldDQLConfig{}, false
+	}
+	return FieldDQLConfig{
+		Query: dqlArg.Value.Raw,
+		Vars:  parseDQLVars(dqlArg.Value.Raw),
+	}, true
+}
+
+func (q *query) CompositeKey() []FieldDefinition {
+	typ := q.Type()
+	for name, fields := range q.op.inSchema.compositeKeys[typ.Name()] {
+		if compositeGetQueryName(typ.Name(), name) != q.Name() {
+			continue
+		}
+		key := make([]FieldDefinition, 0, len(fields))
+		for _, fld := range fields {
+			key = append(key, typ.Field(fld))
+		}
+		return key
+	}
+	return nil
 }
 
 func (q *query) EnumValues() []string {
 	return nil
 }
 
+func (q *query) EnumValue(val string) (string, bool) {
+	return "", false
+}
+
 func (q *query) QueryType() QueryType {
-	return queryType(q.Name(), q.op.inSchema.customDirectives["Query"][q.Name()])
+	if isSubscribeQuery(q.op.inSchema.schema, q.field.Definition) {
+		return SubscribeQuery
+	}
+	return queryType(q.op.inSchema.schema, q.field.Definition,
+		q.op.inSchema.customDirectives[q.GetObjectName()][q.Name()])
 }
 
-func queryType(name string, custom *ast.Directive) QueryType {
+func queryType(sch *ast.Schema, fld *ast.FieldDefinition, custom *ast.Directive) QueryType {
+	if fld == nil {
+		return NotSupportedQuery
+	}
+	name := fld.Name
 	switch {
+	case custom != nil && custom.Arguments.ForName(dql) != nil:
+		return DQLQuery
 	case custom != nil:
 		return HTTPQuery
+	case isPageQuery(sch, fld):
+		return PageQuery
 	case strings.HasPrefix(name, "get"):
 		return GetQuery
 	case name == "__schema" || name == "__type":
@@ -1113,6 +2338,10 @@ func queryType(name string, custom *ast.Directive) QueryType {
 		return FilterQuery
 	case strings.HasPrefix(name, "check"):
 		return PasswordQuery
+	case name == relayNodeQuery:
+		return NodeQuery
+	case isGroupQuery(sch, fld):
+		return GroupByQuery
 	default:
 		return NotSupportedQuery
 	}
@@ -1138,6 +2367,18 @@ func (q *query) IncludeInterfaceField(dgraphTypes []interface{}) bool {
 	return (*field)(q).IncludeInterfaceField(dgraphTypes)
 }
 
+func (q *query) RelayID(uid string, dgraphTypes []interface{}) string {
+	return (*field)(q).RelayID(uid, dgraphTypes)
+}
+
+func (q *query) AggregatedField() string {
+	return ""
+}
+
+func (q *query) ObjectType() Type {
+	return (*field)(q).ObjectType()
+}
+
 func (m *mutation) Name() string {
 	return (*field)(m).Name()
 }
@@ -1219,6 +2460,15 @@ func (m *mutation) NumUidsField() Field {
 	return nil
 }
 
+func (m *mutation) SelectsOnlyMutationMetadata() bool {
+	for _, f := range m.SelectionSet() {
+		if f.Name() != NumUid && f.Name() != Msg && f.Name() != Typename {
+			return false
+		}
+	}
+	return true
+}
+
 func (m *mutation) Location() x.Location {
 	return (*field)(m).Location()
 }
@@ -1237,14 +2487,22 @@ func (m *mutation) MutatedType() Type {
 	return m.op.inSchema.mutatedType[m.Name()]
 }
 
-func (m *mutation) CustomHTTPConfig() (FieldHTTPConfig, error) {
-	return getCustomHTTPConfig((*field)(m), true)
+func (m *mutation) CustomHTTPConfig(claims map[string]interface{}) ([]FieldHTTPConfig, error) {
+	return getCustomHTTPConfig((*field)(m), true, claims)
+}
+
+func (m *mutation) CustomHTTPUsesClaims() bool {
+	return (*field)(m).CustomHTTPUsesClaims()
 }
 
 func (m *mutation) EnumValues() []string {
 	return nil
 }
 
+func (m *mutation) EnumValue(val string) (string, bool) {
+	return "", false
+}
+
 func (m *mutation) GetObjectName() string {
 	return m.field.ObjectDefinition.Name
 }
@@ -1259,6 +2517,8 @@ func mutationType(name string, custom *ast.Directive) MutationType {
 		return HTTPMutation
 	case strings.HasPrefix(name, "add"):
 		return AddMutation
+	case strings.HasPrefix(name, "upsert"):
+		return UpsertMutation
 	case strings.HasPrefix(name, "update"):
 		return UpdateMutation
 	case strings.HasPrefix(name, "delete"):
@@ -1284,10 +2544,26 @@ func (m *mutation) IncludeInterfaceField(dgraphTypes []interface{}) bool {
 	return (*field)(m).IncludeInterfaceField(dgraphTypes)
 }
 
+func (m *mutation) RelayID(uid string, dgraphTypes []interface{}) string {
+	return (*field)(m).RelayID(uid, dgraphTypes)
+}
+
+func (m *mutation) AggregatedField() string {
+	return ""
+}
+
+func (m *mutation) ObjectType() Type {
+	return (*field)(m).ObjectType()
+}
+
 func (m *mutation) IsAuthQuery() bool {
 	return (*field)(m).field.Arguments.ForName("dgraph.uid") != nil
 }
 
+func (m *mutation) AuthRules() *AuthContainer {
+	return (*field)(m).AuthRules()
+}
+
 func (t *astType) AuthRules() *TypeAuth {
 	return t.inSchema.authRules[t.DgraphName()]
 }
@@ -1298,9 +2574,12 @@ func (t *astType) Field(name string) FieldDefinition {
 		fieldDef:        t.inSchema.schema.Types[t.Name()].Fields.ForName(name),
 		inSchema:        t.inSchema,
 		dgraphPredicate: t.dgraphPredicate,
+		parentType:      t.Name(),
 	}
 }
 
+// Fields returns all the fields of t, including those inherited from the interfaces t
+// implements.  OriginatedFrom tells where each field was defined.
 func (t *astType) Fields() []FieldDefinition {
 	var result []FieldDefinition
 
@@ -1310,6 +2589,7 @@ func (t *astType) Fields() []FieldDefinition {
 				fieldDef:        fld,
 				inSchema:        t.inSchema,
 				dgraphPredicate: t.dgraphPredicate,
+				parentType:      t.Name(),
 			})
 	}
 
@@ -1324,9 +2604,103 @@ func (fd *fieldDefinition) IsID() bool {
 	return isID(fd.fieldDef)
 }
 
+// hasIDDirective returns true if fd is the XID of its type, i.e. it has @id and isn't part of a
+// composite key.
 func hasIDDirective(fd *ast.FieldDefinition) bool {
 	id := fd.Directives.ForName("id")
-	return id != nil
+	return id != nil && id.Arguments.ForName(idCompositeArg) == nil
+}
+
+// compositeKeyName returns the name of the composite key fd is part of, or "" if fd isn't part
+// of one.
+func compositeKeyName(fd *ast.FieldDefinition) string {
+	id := fd.Directives.ForName(idDirective)
+	if id == nil {
+		return ""
+	}
+	arg := id.Arguments.ForName(idCompositeArg)
+	if arg == nil || arg.Value == nil {
+		return ""
+	}
+	return arg.Value.Raw
+}
+
+func (fd *fieldDefinition) HasLangDirective() bool {
+	return hasLangDirective(fd.fieldDef)
+}
+
+// Searchable returns the names of the Dgraph indexes on the field, sorted, or nil if the field
+// isn't indexed.
+func (fd *fieldDefinition) Searchable() []string {
+	args := getSearchArgs(fd.fieldDef)
+	if len(args) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(args))
+	indexes := make([]string, 0, len(args))
+	for _, arg := range args {
+		index := arg
+		if search, ok := searchFor(arg); ok {
+			index = search.dgIndex
+		}
+		if !seen[index] {
+			seen[index] = true
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Strings(indexes)
+	return indexes
+}
+
+// OriginatedFrom returns the name of the interface the field was inherited from, or the name
+// of the type the field was looked up in if it wasn't inherited.  It's empty if the field
+// wasn't looked up through a Type.
+func (fd *fieldDefinition) OriginatedFrom() string {
+	if fd.parentType == "" {
+		return ""
+	}
+	parent := &astType{
+		typ:             &ast.Type{NamedType: fd.parentType},
+		inSchema:        fd.inSchema,
+		dgraphPredicate: fd.dgraphPredicate,
+	}
+	return parent.FieldOriginatedFrom(fd.Name())
+}
+
+func (fd *fieldDefinition) Audit() (AuditKind, string) {
+	dir := auditDirective(fd.fieldDef)
+	if dir == nil {
+		return "", ""
+	}
+	claim := ""
+	if arg := dir.Arguments.ForName(createdByClaimArg); arg != nil {
+		claim = arg.Value.Raw
+	}
+	return AuditKind(dir.Name), claim
+}
+
+func (fd *fieldDefinition) Default() interface{} {
+	dir := fd.fieldDef.Directives.ForName(defaultDirective)
+	if dir == nil {
+		return nil
+	}
+	arg := dir.Arguments.ForName(defaultValueArg)
+	if arg == nil {
+		return nil
+	}
+	val, _ := defaultValue(fd.inSchema.schema, fd.fieldDef.Type.Name(), arg.Value.Raw)
+	return val
+}
+
+func hasLangDirective(fd *ast.FieldDefinition) bool {
+	return fd.Directives.ForName(langDirective) != nil
+}
+
+// hasCustomDirective returns true if fd is resolved by @custom, such fields aren't stored in
+// Dgraph and so have no Dgraph predicate.
+func hasCustomDirective(fd *ast.FieldDefinition) bool {
+	return fd.Directives.ForName(customDirective) != nil
 }
 
 func isID(fd *ast.FieldDefinition) bool {
@@ -1362,7 +2736,24 @@ func (fd *fieldDefinition) Inverse() FieldDefinition {
 	return &fieldDefinition{
 		fieldDef:        fld,
 		inSchema:        fd.inSchema,
-		dgraphPredicate: fd.dgraphPredicate}
+		dgraphPredicate: fd.dgraphPredicate,
+		parentType:      typ.Name}
+}
+
+// HasInverse returns the type and field that are the inverse of this field through
+// @hasInverse, and true, or false if the field has no inverse.
+func (fd *fieldDefinition) HasInverse() (Type, FieldDefinition, bool) {
+	inv := fd.Inverse()
+	if inv == nil {
+		return nil, nil, false
+	}
+
+	typ := &astType{
+		typ:             &ast.Type{NamedType: fd.Type().Name()},
+		inSchema:        fd.inSchema,
+		dgraphPredicate: fd.dgraphPredicate,
+	}
+	return typ, inv, true
 }
 
 // ForwardEdge gets the field definition for a forward edge if this field is a reverse edge
@@ -1428,6 +2819,22 @@ func (t *astType) DgraphName() string {
 	return t.Name()
 }
 
+func (t *astType) DgraphTypes() []string {
+	types := []string{t.DgraphName()}
+	dir := t.inSchema.schema.Types[t.typ.Name()].Directives.ForName(dgraphDirective)
+	if dir == nil {
+		return types
+	}
+	if includeArg := dir.Arguments.ForName(dgraphIncludeArg); includeArg != nil {
+		for _, val := range listValues(includeArg.Value) {
+			if val.Raw != types[0] {
+				types = append(types, val.Raw)
+			}
+		}
+	}
+	return types
+}
+
 func (t *astType) Nullable() bool {
 	return !t.typ.NonNull
 }
@@ -1448,6 +2855,10 @@ func (t *astType) DgraphPredicate(fld string) string {
 	return t.dgraphPredicate[t.Name()][fld]
 }
 
+func (t *astType) DgraphFacet(fld string) string {
+	return t.inSchema.facets[t.Name()][fld]
+}
+
 func (t *astType) String() string {
 	if t == nil {
 		return ""
@@ -1511,6 +2922,77 @@ func (t *astType) PasswordField() FieldDefinition {
 	}
 }
 
+func (t *astType) TTLField() FieldDefinition {
+	def := t.inSchema.schema.Types[t.Name()]
+	if def.Kind != ast.Object && def.Kind != ast.Interface {
+		return nil
+	}
+
+	dir := def.Directives.ForName(ttlDirective)
+	if dir == nil {
+		return nil
+	}
+	return t.Field(dir.Arguments.ForName(ttlFieldArg).Value.Raw)
+}
+
+func (t *astType) SoftDeleteField() FieldDefinition {
+	def := t.inSchema.schema.Types[t.Name()]
+	if def.Kind != ast.Object && def.Kind != ast.Interface {
+		return nil
+	}
+
+	dir := def.Directives.ForName(softDeleteDirective)
+	if dir == nil {
+		return nil
+	}
+	return t.Field(dir.Arguments.ForName(softDeleteFieldArg).Value.Raw)
+}
+
+func (t *astType) AuditFields() []FieldDefinition {
+	def := t.inSchema.schema.Types[t.Name()]
+	if def.Kind != ast.Object && def.Kind != ast.Interface {
+		return nil
+	}
+
+	var result []FieldDefinition
+	for _, fld := range def.Fields {
+		if auditDirective(fld) != nil {
+			result = append(result, t.Field(fld.Name))
+		}
+	}
+	return result
+}
+
+func (t *astType) DefaultFields() []FieldDefinition {
+	def := t.inSchema.schema.Types[t.Name()]
+	if def.Kind != ast.Object && def.Kind != ast.Interface {
+		return nil
+	}
+
+	var result []FieldDefinition
+	for _, fld := range def.Fields {
+		if fld.Directives.ForName(defaultDirective) != nil {
+			result = append(result, t.Field(fld.Name))
+		}
+	}
+	return result
+}
+
+func (t *astType) CompositeKeys() map[string][]FieldDefinition {
+	keyMap := t.inSchema.compositeKeys[t.Name()]
+	if len(keyMap) == 0 {
+		return nil
+	}
+
+	keys := make(map[string][]FieldDefinition, len(keyMap))
+	for name, fields := range keyMap {
+		for _, fld := range fields {
+			keys[name] = append(keys[name], t.Field(fld))
+		}
+	}
+	return keys
+}
+
 func (t *astType) XIDField() FieldDefinition {
 	def := t.inSchema.schema.Types[t.Name()]
 	if def.Kind != ast.Object && def.Kind != ast.Interface {
@@ -1529,11 +3011,12 @@ func (t *astType) XIDField() FieldDefinition {
 	return nil
 }
 
-// InterfaceImplHasAuthRules checks if an interface's implementation has auth rules.
+// InterfaceImplHasAuthRules checks if an interface's implementation, or a union's member, has
+// auth rules.
 func (t *astType) InterfaceImplHasAuthRules() bool {
 	schema := t.inSchema.schema
 	types := schema.Types
-	if typ, ok := types[t.Name()]; !ok || typ.Kind != ast.Interface {
+	if typ, ok := types[t.Name()]; !ok || (typ.Kind != ast.Interface && typ.Kind != ast.Union) {
 		return false
 	}
 
@@ -1560,6 +3043,10 @@ func (t *astType) Interfaces() []string {
 	// overwritten using @dgraph(type: ...)
 	names := make([]string, 0, len(interfaces))
 	for _, intr := range interfaces {
+		if t.inSchema.relayIDs && intr == relayNodeInterface {
+			// Relay's Node interface isn't stored in Dgraph.
+			continue
+		}
 		i := t.inSchema.schema.Types[intr]
 		name := intr
 		if n := typeName(i); n != "" {
@@ -1570,6 +3057,16 @@ func (t *astType) Interfaces() []string {
 	return names
 }
 
+func (t *astType) Unions() []string {
+	var names []string
+	for _, defn := range t.inSchema.schema.Implements[t.Name()] {
+		if defn.Kind == ast.Union {
+			names = append(names, typeName(defn))
+		}
+	}
+	return names
+}
+
 // CheckNonNulls checks that any non nullables in t are present in obj.
 // Fields of type ID are not checked, nor is any exclusion.
 //
@@ -1605,17 +3102,100 @@ func (t *astType) Interfaces() []string {
 //
 // and then check ourselves that either there's an ID, or there's all the bits to
 // satisfy a valid post.
+//
+// The new objects nested in obj are checked in the same way, so the error lists every missing
+// field, not just the first one.  Nested objects that reference an existing node by ID or XID
+// aren't checked, the mutation rewriting works out which of those are new.
 func (t *astType) EnsureNonNulls(obj map[string]interface{}, exclusion string) error {
+	var missing []string
+	t.ensureNonNulls(obj, exclusion, "", make(map[uintptr]bool), &missing)
+	if len(missing) > 0 {
+		return errors.New(strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+func (t *astType) ensureNonNulls(
+	obj map[string]interface{},
+	exclusion, path string,
+	seen map[uintptr]bool,
+	missing *[]string) {
+
+	// Input that's built in code, rather than decoded from JSON, can refer back to an object
+	// that's already being checked.  Checking it again would never end.
+	ptr := reflect.ValueOf(obj).Pointer()
+	if seen[ptr] {
+		return
+	}
+	seen[ptr] = true
+
 	for _, fld := range t.inSchema.schema.Types[t.Name()].Fields {
-		if fld.Type.NonNull && !isID(fld) && !(fld.Name == exclusion) {
-			if val, ok := obj[fld.Name]; !ok || val == nil {
-				return errors.Errorf(
-					"type %s requires a value for field %s, but no value present",
-					t.Name(), fld.Name)
+		val, ok := obj[fld.Name]
+		if !ok || val == nil {
+			// The server sets an audit field, or a field with a default, so it's not given
+			// in the mutation.
+			if fld.Type.NonNull && !isID(fld) && auditDirective(fld) == nil &&
+				fld.Directives.ForName(defaultDirective) == nil && fld.Name != exclusion {
+				at := ""
+				if path != "" {
+					at = " at " + path
+				}
+				*missing = append(*missing, fmt.Sprintf(
+					"type %s requires a value for field %s%s, but no value present",
+					t.Name(), fld.Name, at))
+			}
+			continue
+		}
+
+		def := t.inSchema.schema.Types[fld.Type.Name()]
+		if def.Kind != ast.Object && def.Kind != ast.Interface {
+			continue
+		}
+		nested := &astType{
+			typ:             &ast.Type{NamedType: def.Name},
+			inSchema:        t.inSchema,
+			dgraphPredicate: t.dgraphPredicate,
+		}
+		// The inverse of the field is filled in by the mutation, so it isn't required.
+		inverse := ""
+		if inv := t.Field(fld.Name).Inverse(); inv != nil {
+			inverse = inv.Name()
+		}
+
+		fldPath := fld.Name
+		if path != "" {
+			fldPath = path + "." + fld.Name
+		}
+		switch val := val.(type) {
+		case map[string]interface{}:
+			if !isReferenceOrEmpty(def, val) {
+				nested.ensureNonNulls(val, inverse, fldPath, seen, missing)
+			}
+		case []interface{}:
+			for i, elem := range val {
+				elem, ok := elem.(map[string]interface{})
+				if ok && !isReferenceOrEmpty(def, elem) {
+					nested.ensureNonNulls(elem, inverse, fmt.Sprintf("%s[%d]", fldPath, i),
+						seen, missing)
+				}
 			}
 		}
 	}
-	return nil
+}
+
+// isReferenceOrEmpty returns true if obj has a value for the ID or an @id field of def, so it
+// refers to an existing node, or might do.  An empty obj is reported as empty when the mutation
+// is rewritten, so it's not checked either.
+func isReferenceOrEmpty(def *ast.Definition, obj map[string]interface{}) bool {
+	if len(obj) == 0 {
+		return true
+	}
+	for _, fld := range def.Fields {
+		if (isID(fld) || hasIDDirective(fld)) && obj[fld.Name] != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // convertSliceToStringSlice converts any slice passed as argument to a slice of string
@@ -1625,11 +3205,33 @@ func convertSliceToStringSlice(slice interface{}) []string {
 	size := val.Len()
 	list := make([]string, size)
 	for i := 0; i < size; i++ {
-		list[i] = fmt.Sprintf("%v", val.Index(i))
+		list[i] = paramValueString(val.Index(i).Interface())
 	}
 	return list
 }
 
+// paramValueString returns val, a scalar, as it's written in a URL parameter.  Numbers are
+// written the canonical way: floats without an exponent or trailing zeros, like 3.14 and
+// 1000000, and so whole numbers, like Int values decoded from JSON, without a decimal point.
+func paramValueString(val interface{}) string {
+	switch v := val.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		if f, err := v.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
 func getAsPathParamValue(val interface{}) string {
 	switch v := val.(type) {
 	case string:
@@ -1644,7 +3246,7 @@ func getAsPathParamValue(val interface{}) string {
 	case map[string]interface{}:
 		return getAsMapInPath(v)
 	default:
-		return fmt.Sprintf("%v", val)
+		return paramValueString(val)
 	}
 }
 
@@ -1696,7 +3298,7 @@ func setQueryParamValue(queryParams url.Values, key string, val interface{}) {
 	case map[string]interface{}:
 		setMapInQuery(queryParams, key, v)
 	default:
-		queryParams.Add(key, fmt.Sprintf("%v", val))
+		queryParams.Add(key, paramValueString(val))
 	}
 }
 
@@ -1707,18 +3309,37 @@ func setInterfaceSliceInQuery(queryParams url.Values, key string, slice []interf
 }
 
 func setMapInQuery(queryParams url.Values, key string, object map[string]interface{}) {
-	for k, v := range object {
-		k = fmt.Sprintf("%s[%s]", key, k)
-		setQueryParamValue(queryParams, k, v)
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	// ensure fixed order in output, url.Values.Encode() sorts by key but keeps the order
+	// of the values for a key
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		setQueryParamValue(queryParams, fmt.Sprintf("%s[%s]", key, k), object[k])
 	}
 }
 
+// SubstituteVarsInURL returns rawURL with its variables, like $id in
+// http://myapi.com/favMovies/$id?num=$num, replaced by their values in vars.  rawURL must be
+// an absolute URL with a host; anything else is an error rather than a request to some
+// unintended URL.
 func SubstituteVarsInURL(rawURL string, vars map[string]interface{}) (string,
 	error) {
 	u, err := url.Parse(rawURL)
 	if err != nil {
 		return "", err
 	}
+	if u.Scheme == "" {
+		return "", errors.Errorf("url %s has no scheme, it should be like http://host/path",
+			rawURL)
+	}
+	if u.Hostname() == "" {
+		return "", errors.Errorf("url %s has no host, it should be like http://host/path",
+			rawURL)
+	}
 
 	// Parse variables from path params.
 	elems := strings.Split(u.Path, "/")
@@ -1762,6 +3383,165 @@ func SubstituteVarsInURL(rawURL string, vars map[string]interface{}) (string,
 	return u.String(), nil
 }
 
+// isHeaderTemplate returns true if the value given for a header in secretHeaders or
+// forwardHeaders is a template using variables rather than the name of a secret or a header.
+func isHeaderTemplate(val string) bool {
+	return strings.Contains(val, "$")
+}
+
+// scanHeaderTemplate walks over the given header template and replaces each variable in it
+// with the value returned by substitute for the name of the variable. A variable is a $ followed
+// by a name made up of letters, digits and underscores, while $$ stands for a literal $. If
+// keepEscapes is true, $$ is kept as it is in the result, so that the result is still a template.
+// It returns false as soon as substitute returns false for a variable.
+func scanHeaderTemplate(tmpl string, keepEscapes bool,
+	substitute func(name string) (string, bool)) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '$' {
+			b.WriteByte(tmpl[i])
+			continue
+		}
+		if i+1 < len(tmpl) && tmpl[i+1] == '$' {
+			if keepEscapes {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte('$')
+			}
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(tmpl) && isHeaderVarChar(tmpl[j]) {
+			j++
+		}
+		val, ok := substitute(tmpl[i+1 : j])
+		if !ok {
+			return "", false
+		}
+		b.WriteString(val)
+		i = j - 1
+	}
+	return b.String(), true
+}
+
+func isHeaderVarChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// parseDQLVars returns the names of the variables, e.g. $name, used in the given DQL query, in
+// the order they first appear and without repeats.  Anything inside a string isn't a variable.
+func parseDQLVars(query string) []string {
+	var vars []string
+	seen := make(map[string]bool)
+	inString := false
+	for i := 0; i < len(query); i++ {
+		switch {
+		case inString && query[i] == '\\':
+			i++
+		case query[i] == '"':
+			inString = !inString
+		case !inString && query[i] == '$':
+			j := i + 1
+			for j < len(query) && isHeaderVarChar(query[j]) {
+				j++
+			}
+			if name := query[i+1 : j]; name != "" && !seen[name] {
+				seen[name] = true
+				vars = append(vars, name)
+			}
+			i = j - 1
+		}
+	}
+	return vars
+}
+
+// parseHeaderVars returns the names of the variables used in the given header template.
+func parseHeaderVars(tmpl string) []string {
+	var vars []string
+	scanHeaderTemplate(tmpl, true, func(name string) (string, bool) {
+		vars = append(vars, name)
+		return "", true
+	})
+	return vars
+}
+
+// headerTemplateVars returns the variables used in the header templates given in secretHeaders
+// and forwardHeaders of the http argument of @custom. These are the arguments of the field for
+// queries and mutations, and the fields of the parent type otherwise. In secretHeaders, a
+// variable which is the name of a secret refers to that secret and so isn't returned.
+func headerTemplateVars(httpArg *ast.Value,
+	secrets map[string]x.SensitiveByteSlice) map[string]bool {
+	vars := make(map[string]bool)
+	for _, headers := range []string{"secretHeaders", "forwardHeaders"} {
+		hdrs := httpArg.Children.ForName(headers)
+		if hdrs == nil {
+			continue
+		}
+		for _, h := range hdrs.Children {
+			key := strings.Split(h.Value.Raw, ":")
+			if len(key) != 2 || !isHeaderTemplate(key[1]) {
+				continue
+			}
+			for _, name := range parseHeaderVars(key[1]) {
+				if _, ok := secrets[name]; ok && headers == "secretHeaders" {
+					continue
+				}
+				vars[name] = true
+			}
+		}
+	}
+	return vars
+}
+
+// substituteSecretsInHeader substitutes the secrets used in a header template given in
+// secretHeaders, leaving the other variables as they are. Any $ in the value of a secret is
+// escaped, so that it isn't mistaken for a variable later.
+func substituteSecretsInHeader(tmpl string, secrets map[string]x.SensitiveByteSlice) string {
+	res, _ := scanHeaderTemplate(tmpl, true, func(name string) (string, bool) {
+		if val, ok := secrets[name]; ok {
+			return strings.ReplaceAll(string(val), "$", "$$"), true
+		}
+		return "$" + name, true
+	})
+	return res
+}
+
+// SubstituteVarsInHeaders returns a copy of headers, with the values for the headers in
+// templates built by substituting the variables using vars. Like for the query params in
+// SubstituteVarsInURL, if a variable used in a template isn't present in vars (or is null), then
+// that header is omitted.
+// for e.g.
+// { "X-Partner-Id": "$partner", "Authorization": "Bearer $token" } with { "token": "abc" }
+// would only add the header Authorization: Bearer abc
+func SubstituteVarsInHeaders(headers http.Header, templates map[string]string,
+	vars map[string]interface{}) http.Header {
+	res := make(http.Header, len(headers)+len(templates))
+	for k, v := range headers {
+		res[k] = append([]string(nil), v...)
+	}
+	for key, tmpl := range templates {
+		val, ok := scanHeaderTemplate(tmpl, false, func(name string) (string, bool) {
+			v, ok := vars[name]
+			if !ok || v == nil {
+				return "", false
+			}
+			return getAsPathParamValue(v), true
+		})
+		if ok {
+			res.Set(key, val)
+		}
+	}
+	return res
+}
+
+// claimsVar is the variable in body templates whose fields are the claims of the JWT sent with
+// the request, like $claims.email.  claimsPrefix is what the claims look like in parsed templates.
+const (
+	claimsVar    = "claims"
+	claimsPrefix = "$" + claimsVar + "."
+)
+
 func isName(s string) bool {
 	for _, r := range s {
 		switch {
@@ -1783,63 +3563,142 @@ func isName(s string) bool {
 // { author: $id, post: { id: $postID }}
 // would return
 // { "author" : "$id", "post": { "id": "$postID" }} and { "id": true, "postID": true}
+// Apart from variables, values can also be constants (strings, numbers, true, false and null).
+// { owner: $id, source: "dgraph", page: { size: 10 } }
+// would return
+// { "owner": "$id", "source": "dgraph", "page": { "size": 10 }} and { "id": true }
+// Values can also be claims of the JWT sent with the request, these are returned separately from
+// the required fields as they don't come from the arguments.
+// { author: $id, email: $claims.email }
+// would return
+// { "author": "$id", "email": "$claims.email" }, { "id": true } and { "email": true }
 // If the final result is not a valid JSON, then an error is returned.
-func parseBodyTemplate(body string) (*interface{}, map[string]bool, error) {
+func parseBodyTemplate(body string) (*interface{}, map[string]bool, map[string]bool, error) {
 	var s scanner.Scanner
 	s.Init(strings.NewReader(body))
 
 	result := new(bytes.Buffer)
 	parsingVariable := false
 	depth := 0
+	// open objects and lists, used to know if a token is at the position of a key or a value
+	var containers []string
+	prev := ""
 	requiredFields := make(map[string]bool)
+	requiredClaims := make(map[string]bool)
 	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
 		text := s.TokenText()
+		inList := len(containers) > 0 && containers[len(containers)-1] == "["
+		isValue := prev == "" || prev == ":" || prev == "-" ||
+			(inList && (prev == "[" || prev == ","))
 		switch {
-		case text == "{":
+		case text == "{" || text == "[":
 			result.WriteString(text)
-			depth++
-		case text == "}":
-			depth--
+			containers = append(containers, text)
+			if text == "{" {
+				depth++
+			}
+		case text == "}" || text == "]":
 			result.WriteString(text)
-		case text == ":" || text == "," || text == "[" || text == "]":
+			if len(containers) > 0 {
+				containers = containers[:len(containers)-1]
+			}
+			if text == "}" {
+				depth--
+			}
+		case text == ":" || text == ",":
 			result.WriteString(text)
 		case text == "$":
 			parsingVariable = true
+		case isValue && tok == scanner.String:
+			str, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, nil, nil, errors.Errorf("invalid string: %s while parsing body template",
+					text)
+			}
+			if strings.HasPrefix(str, "$") {
+				return nil, nil, nil, errors.Errorf("string constant: %s can't start with $ while "+
+					"parsing body template", text)
+			}
+			b, _ := json.Marshal(str)
+			result.Write(b)
+		case isValue && (tok == scanner.Int || tok == scanner.Float || text == "-"):
+			result.WriteString(text)
+		case isValue && !parsingVariable && (text == "true" || text == "false" || text == "null"):
+			result.WriteString(text)
 		case isName(text):
 			// Name could either be a key or be part of a variable after dollar.
 			if !parsingVariable {
 				result.WriteString(fmt.Sprintf(`"%s"`, text))
-				continue
+				break
 			}
-			requiredFields[text] = true
 			variable := "$" + text
+			if text == claimsVar && s.Peek() == '.' {
+				s.Scan()
+				if s.Scan() == scanner.EOF || !isName(s.TokenText()) {
+					return nil, nil, nil, errors.Errorf("expected the name of a claim after "+
+						"%s. while parsing body template", variable)
+				}
+				requiredClaims[s.TokenText()] = true
+				variable += "." + s.TokenText()
+			} else {
+				requiredFields[text] = true
+			}
 			fmt.Fprintf(result, `"%s"`, variable)
 			parsingVariable = false
 
 		default:
-			return nil, nil, errors.Errorf("invalid character: %s while parsing body template",
+			return nil, nil, nil, errors.Errorf("invalid character: %s while parsing body template",
 				text)
 		}
+		prev = text
 	}
 	if depth != 0 {
-		return nil, nil, errors.New("found unmatched curly braces while parsing body template")
+		return nil, nil, nil, errors.New("found unmatched curly braces while parsing body template")
 	}
 
 	if result.Len() == 0 {
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	}
 
 	var m interface{}
 	if err := json.Unmarshal(result.Bytes(), &m); err != nil {
-		return nil, nil, errors.Errorf("couldn't unmarshal HTTP body: %s as JSON", result.Bytes())
+		if serr, ok := err.(*json.SyntaxError); ok {
+			return nil, nil, nil, errors.Errorf("couldn't unmarshal HTTP body: %s as JSON, "+
+				"error at offset %d: %s", bodyExcerpt(result.Bytes(), serr.Offset), serr.Offset,
+				serr.Error())
+		}
+		return nil, nil, nil, errors.Errorf("couldn't unmarshal HTTP body: %s as JSON", result.Bytes())
 	}
-	return &m, requiredFields, nil
+	return &m, requiredFields, requiredClaims, nil
 }
 
-func getVar(key string, variables map[string]interface{}) (interface{}, error) {
+// bodyExcerpt returns the part of body around offset, so that errors for large bodies only show
+// the part which is relevant. Bodies which are short enough are returned as they are.
+func bodyExcerpt(body []byte, offset int64) string {
+	const window = 32
+	start, end := offset-window, offset+window
+	prefix, suffix := "...", "..."
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= int64(len(body)) {
+		end, suffix = int64(len(body)), ""
+	}
+	return prefix + string(body[start:end]) + suffix
+}
+
+func getVar(key string, variables, claims map[string]interface{}) (interface{}, error) {
 	if !strings.HasPrefix(key, "$") {
 		return nil, errors.Errorf("expected a variable to start with $. Found: %s", key)
 	}
+	if strings.HasPrefix(key, claimsPrefix) {
+		val, ok := claims[key[len(claimsPrefix):]]
+		if !ok {
+			return nil, errors.Errorf("couldn't find claim: %s in the JWT claims",
+				key[len(claimsPrefix):])
+		}
+		return val, nil
+	}
 	val, ok := variables[key[1:]]
 	if !ok {
 		return nil, errors.Errorf("couldn't find variable: %s in variables map", key)
@@ -1849,9 +3708,9 @@ func getVar(key string, variables map[string]interface{}) (interface{}, error) {
 }
 
 func substituteSingleVarInBody(key string, valPtr *interface{},
-	variables map[string]interface{}) error {
+	variables, claims map[string]interface{}) error {
 	// Look it up in the map and replace.
-	val, err := getVar(key, variables)
+	val, err := getVar(key, variables, claims)
 	if err != nil {
 		return err
 	}
@@ -1859,23 +3718,29 @@ func substituteSingleVarInBody(key string, valPtr *interface{},
 	return nil
 }
 
-func substituteVarInMapInBody(object, variables map[string]interface{}) error {
+func substituteVarInMapInBody(object, variables, claims map[string]interface{}) error {
 	for k, v := range object {
 		switch val := v.(type) {
 		case string:
-			vval, err := getVar(val, variables)
+			if !strings.HasPrefix(val, "$") {
+				// not a variable, but a string constant
+				continue
+			}
+			vval, err := getVar(val, variables, claims)
 			if err != nil {
 				return err
 			}
 			object[k] = vval
 		case map[string]interface{}:
-			if err := substituteVarInMapInBody(val, variables); err != nil {
+			if err := substituteVarInMapInBody(val, variables, claims); err != nil {
 				return err
 			}
 		case []interface{}:
-			if err := substituteVarInSliceInBody(val, variables); err != nil {
+			if err := substituteVarInSliceInBody(val, variables, claims); err != nil {
 				return err
 			}
+		case float64, bool, nil:
+			// constants, nothing to substitute
 		default:
 			return errors.Errorf("got unexpected type value in map: %+v", v)
 		}
@@ -1883,23 +3748,30 @@ func substituteVarInMapInBody(object, variables map[string]interface{}) error {
 	return nil
 }
 
-func substituteVarInSliceInBody(slice []interface{}, variables map[string]interface{}) error {
+func substituteVarInSliceInBody(slice []interface{},
+	variables, claims map[string]interface{}) error {
 	for k, v := range slice {
 		switch val := v.(type) {
 		case string:
-			vval, err := getVar(val, variables)
+			if !strings.HasPrefix(val, "$") {
+				// not a variable, but a string constant
+				continue
+			}
+			vval, err := getVar(val, variables, claims)
 			if err != nil {
 				return err
 			}
 			slice[k] = vval
 		case map[string]interface{}:
-			if err := substituteVarInMapInBody(val, variables); err != nil {
+			if err := substituteVarInMapInBody(val, variables, claims); err != nil {
 				return err
 			}
 		case []interface{}:
-			if err := substituteVarInSliceInBody(val, variables); err != nil {
+			if err := substituteVarInSliceInBody(val, variables, claims); err != nil {
 				return err
 			}
+		case float64, bool, nil:
+			// constants, nothing to substitute
 		default:
 			return errors.Errorf("got unexpected type value in array: %+v", v)
 		}
@@ -1912,23 +3784,189 @@ func substituteVarInSliceInBody(slice []interface{}, variables map[string]interf
 // for e.g.
 // { "author" : "$id", "post": { "id": "$postID" }} with variables {"id": "0x3", postID: "0x9"}
 // should return { "author" : "0x3", "post": { "id": "0x9" }}
-func SubstituteVarsInBody(jsonTemplate *interface{}, variables map[string]interface{}) error {
+// References to claims, like "$claims.email", are substituted from claims.
+//
+// Deprecated: SubstituteVarsInBody substitutes into jsonTemplate in place, so the template can't
+// be used again with other variables. Use ApplyTemplate, which leaves the template untouched.
+func SubstituteVarsInBody(jsonTemplate *interface{}, variables,
+	claims map[string]interface{}) error {
 	if jsonTemplate == nil {
 		return nil
 	}
 
 	switch val := (*jsonTemplate).(type) {
 	case string:
-		return substituteSingleVarInBody(val, jsonTemplate, variables)
+		return substituteSingleVarInBody(val, jsonTemplate, variables, claims)
 	case map[string]interface{}:
-		return substituteVarInMapInBody(val, variables)
+		return substituteVarInMapInBody(val, variables, claims)
 	case []interface{}:
-		return substituteVarInSliceInBody(val, variables)
+		return substituteVarInSliceInBody(val, variables, claims)
 	default:
 		return errors.Errorf("got unexpected type value in jsonTemplate: %+v", val)
 	}
 }
 
+// ApplyTemplate returns a copy of the JSON template for a body with the variables, and the claims
+// referred to like "$claims.email", substituted in.  Maps and slices in template are copied, so
+// template is left as it was and can be applied again.  Numbers are kept as they are in
+// template, whether they are float64 or json.Number.
+func ApplyTemplate(template interface{}, variables,
+	claims map[string]interface{}) (interface{}, error) {
+	switch val := template.(type) {
+	case string:
+		if !strings.HasPrefix(val, "$") {
+			// not a variable, but a string constant
+			return val, nil
+		}
+		return getVar(val, variables, claims)
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			vval, err := ApplyTemplate(v, variables, claims)
+			if err != nil {
+				return nil, err
+			}
+			object[k] = vval
+		}
+		return object, nil
+	case []interface{}:
+		slice := make([]interface{}, len(val))
+		for i, v := range val {
+			vval, err := ApplyTemplate(v, variables, claims)
+			if err != nil {
+				return nil, err
+			}
+			slice[i] = vval
+		}
+		return slice, nil
+	case float64, json.Number, bool, nil:
+		// constants, nothing to substitute
+		return val, nil
+	default:
+		return nil, errors.Errorf("got unexpected type value in template: %+v", val)
+	}
+}
+
+// A resultPathSegment is one step of the resultPath of @custom: the value of a key of an object,
+// the element at an index of a list, or, for a wildcard, each element of a list.
+type resultPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseResultPath parses a resultPath like "data.items[0]" or "data.items[*].name", which is
+// keys separated by dots, where any key can be followed by list indexes, [n], or wildcards, [*].
+func parseResultPath(path string) ([]resultPathSegment, error) {
+	if path == "" {
+		return nil, errors.New("it is empty")
+	}
+
+	var segs []resultPathSegment
+	afterDot := false
+	for i := 0; i < len(path); {
+		switch c := path[i]; {
+		case c == '[' && !afterDot:
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, errors.Errorf("the [ at position %d isn't closed", i)
+			}
+			inner := path[i+1 : i+end]
+			if inner == "*" {
+				segs = append(segs, resultPathSegment{wildcard: true})
+			} else {
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, errors.Errorf("[%s] at position %d should be an index, "+
+						"like [0], or [*]", inner, i)
+				}
+				segs = append(segs, resultPathSegment{index: n, isIndex: true})
+			}
+			i += end + 1
+		case c == '.' && !afterDot && len(segs) > 0:
+			afterDot = true
+			i++
+			continue
+		case c == '.' || c == '[' || c == ']' || (len(segs) > 0 && !afterDot):
+			return nil, errors.Errorf("unexpected %q at position %d", c, i)
+		default:
+			end := strings.IndexAny(path[i:], ".[]")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segs = append(segs, resultPathSegment{key: path[i : i+end]})
+			i += end
+		}
+		afterDot = false
+	}
+	if afterDot {
+		return nil, errors.New("it ends with a .")
+	}
+	return segs, nil
+}
+
+// ApplyResultPath returns the part of the remote response val that's at the resultPath path of
+// @custom, or val itself if there's no path.  Anything missing along the path is null in the
+// result, and is reported in the returned error.
+func ApplyResultPath(path string, val interface{}) (interface{}, error) {
+	if path == "" {
+		return val, nil
+	}
+	segs, err := parseResultPath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while parsing resultPath %s", path)
+	}
+
+	var missing []string
+	res := applyResultPath(val, segs, "", &missing)
+	if len(missing) > 0 {
+		return res, errors.Errorf("resultPath %s has nothing at %s", path,
+			strings.Join(missing, ", "))
+	}
+	return res, nil
+}
+
+func applyResultPath(val interface{}, segs []resultPathSegment, at string,
+	missing *[]string) interface{} {
+	for i, seg := range segs {
+		switch {
+		case seg.wildcard:
+			list, ok := val.([]interface{})
+			if !ok {
+				*missing = append(*missing, at+"[*]")
+				return nil
+			}
+			res := make([]interface{}, len(list))
+			for j, elem := range list {
+				res[j] = applyResultPath(elem, segs[i+1:], fmt.Sprintf("%s[%d]", at, j), missing)
+			}
+			return res
+		case seg.isIndex:
+			at = fmt.Sprintf("%s[%d]", at, seg.index)
+			list, ok := val.([]interface{})
+			if !ok || seg.index >= len(list) {
+				*missing = append(*missing, at)
+				return nil
+			}
+			val = list[seg.index]
+		default:
+			if at != "" {
+				at += "."
+			}
+			at += seg.key
+			obj, _ := val.(map[string]interface{})
+			v, ok := obj[seg.key]
+			if !ok {
+				*missing = append(*missing, at)
+				return nil
+			}
+			val = v
+		}
+	}
+	return val
+}
+
 // FieldOriginatedFrom returns the name of the interface from which given field was inherited.
 // If the field wasn't inherited, but belonged to this type, this type's name is returned.
 // Otherwise, empty string is returned.
@@ -2006,6 +4044,6 @@ func parseRequiredArgsFromGQLRequest(req string) (map[string]bool, error) {
 	bracket := strings.Index(req, "{")
 	req = req[bracket:]
 	args := req[strings.Index(req, "(")+1 : strings.LastIndex(req, ")")]
-	_, rf, err := parseBodyTemplate("{" + args + "}")
+	_, rf, _, err := parseBodyTemplate("{" + args + "}")
 	return rf, err
 }
@@ -17,16 +17,21 @@
 package schema
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"regexp"
 	"strings"
 	"testing"
 
-	"github.com/dgraph-io/dgraph/graphql/authorization"
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
 	"gopkg.in/yaml.v2"
 )
 
@@ -125,9 +130,11 @@ type Starship {
 
 	expected := map[string]map[string]string{
 		"Author":              author,
+		"AddAuthorInput":      author,
 		"UpdateAuthorPayload": author,
 		"DeleteAuthorPayload": author,
 		"Post":                post,
+		"AddPostInput":        post,
 		"UpdatePostPayload":   post,
 		"DeletePostPayload":   post,
 		"Employee": map[string]string{
@@ -137,12 +144,15 @@ type Starship {
 		"UpdateCharacterPayload": character,
 		"DeleteCharacterPayload": character,
 		"Human":                  human,
+		"AddHumanInput":          human,
 		"UpdateHumanPayload":     human,
 		"DeleteHumanPayload":     human,
 		"Droid":                  droid,
+		"AddDroidInput":          droid,
 		"UpdateDroidPayload":     droid,
 		"DeleteDroidPayload":     droid,
 		"Starship":               starship,
+		"AddStarshipInput":       starship,
 		"UpdateStarshipPayload":  starship,
 		"DeleteStarshipPayload":  starship,
 	}
@@ -150,10 +160,28 @@ type Starship {
 	if diff := cmp.Diff(expected, s.dgraphPredicate); diff != "" {
 		t.Errorf("dgraph predicate map mismatch (-want +got):\n%s", diff)
 	}
+
+	// The types that map the same predicates don't share a map.
+	s.dgraphPredicate["UpdateAuthorPayload"]["name"] = "changed"
+	require.Equal(t, "Author.name", s.dgraphPredicate["Author"]["name"])
+	require.Equal(t, "Author.name", s.dgraphPredicate["DeleteAuthorPayload"]["name"])
+
+	// Searchable enums can be filtered by a list of values.
+	postTypeFilter := s.schema.Types[s.schema.Types["PostFilter"].Fields.ForName("postType").
+		Type.Name()]
+	require.NotNil(t, postTypeFilter.Fields.ForName("in"))
+	require.Equal(t, "[PostType]", postTypeFilter.Fields.ForName("in").Type.String())
+
+	// The indexes of a field are those its @search declares.
+	require.Equal(t, []string{"hash", "trigram"}, sch.SearchIndexes("Author", "name"))
+	require.Equal(t, []string{"year"}, sch.SearchIndexes("Author", "dob"))
+	require.Nil(t, sch.SearchIndexes("Author", "posts"))
+	require.Nil(t, sch.SearchIndexes("Author", "nonExistent"))
+	require.Nil(t, sch.SearchIndexes("NonExistent", "name"))
 }
 
-func TestDgraphMapping_WithDirectives(t *testing.T) {
-	schemaStr := `
+// directivesSchema uses most of the directives that change how types and fields map to Dgraph.
+const directivesSchema = `
 	type Author @dgraph(type: "dgraph.author") {
 			id: ID!
 
@@ -206,7 +234,8 @@ func TestDgraphMapping_WithDirectives(t *testing.T) {
 			length: Float
 	}`
 
-	schHandler, errs := NewHandler(schemaStr)
+func TestDgraphMapping_WithDirectives(t *testing.T) {
+	schHandler, errs := NewHandler(directivesSchema)
 	require.NoError(t, errs)
 	sch, err := FromString(schHandler.GQLSchema())
 	require.NoError(t, err)
@@ -247,9 +276,11 @@ func TestDgraphMapping_WithDirectives(t *testing.T) {
 
 	expected := map[string]map[string]string{
 		"Author":              author,
+		"AddAuthorInput":      author,
 		"UpdateAuthorPayload": author,
 		"DeleteAuthorPayload": author,
 		"Post":                post,
+		"AddPostInput":        post,
 		"UpdatePostPayload":   post,
 		"DeletePostPayload":   post,
 		"Employee": map[string]string{
@@ -259,12 +290,478 @@ func TestDgraphMapping_WithDirectives(t *testing.T) {
 		"UpdateCharacterPayload": character,
 		"DeleteCharacterPayload": character,
 		"Human":                  human,
+		"AddHumanInput":          human,
+		"UpdateHumanPayload":     human,
+		"DeleteHumanPayload":     human,
+		"Droid":                  droid,
+		"AddDroidInput":          droid,
+		"UpdateDroidPayload":     droid,
+		"DeleteDroidPayload":     droid,
+		"Starship":               starship,
+		"AddStarshipInput":       starship,
+		"UpdateStarshipPayload":  starship,
+		"DeleteStarshipPayload":  starship,
+	}
+
+	if diff := cmp.Diff(expected, s.dgraphPredicate); diff != "" {
+		t.Errorf("dgraph predicate map mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPredicateFields_WithDirectives(t *testing.T) {
+	schHandler, errs := NewHandler(directivesSchema)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	require.Equal(t, []FieldRef{
+		{TypeName: "Character", FieldName: "appearsIn"},
+		{TypeName: "Droid", FieldName: "appearsIn"},
+		{TypeName: "Human", FieldName: "appearsIn"},
+	}, sch.PredicateFields("appears_in"))
+	require.Equal(t, []FieldRef{{TypeName: "Post", FieldName: "postType"}},
+		sch.PredicateFields("dgraph.post_type"))
+	require.Equal(t, []FieldRef{{TypeName: "Author", FieldName: "name"}},
+		sch.PredicateFields("dgraph.author.name"))
+	require.Empty(t, sch.PredicateFields("Post.postType"))
+}
+
+func TestFreezeReturnsCopies(t *testing.T) {
+	schHandler, errs := NewHandler(directivesSchema)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	// Before Freeze, the schema's own mapping is returned.
+	preds := sch.DgraphPredicates("Author")
+	require.Equal(t, "dgraph.author.name", preds["name"])
+	require.Nil(t, sch.DgraphPredicates("NotAType"))
+
+	sch.Freeze()
+	preds = sch.DgraphPredicates("Author")
+	require.Equal(t, "dgraph.author.name", preds["name"])
+	preds["name"] = "changed"
+	delete(preds, "dob")
+
+	require.Equal(t, "dgraph.author.name", sch.DgraphPredicates("Author")["name"])
+	require.Contains(t, sch.DgraphPredicates("Author"), "dob")
+	require.Equal(t, []FieldRef{{TypeName: "Author", FieldName: "name"}},
+		sch.PredicateFields("dgraph.author.name"))
+	require.Empty(t, sch.PredicateFields("changed"))
+	require.Nil(t, sch.DgraphPredicates("NotAType"))
+
+	doc := sch.AST()
+	require.NotNil(t, doc.Types["Author"].Fields.ForName("name"))
+	delete(doc.Types, "Author")
+	doc.Query.Fields = nil
+
+	doc = sch.AST()
+	require.NotNil(t, doc.Types["Author"].Fields.ForName("name"))
+	require.NotNil(t, doc.Query.Fields.ForName("queryAuthor"))
+	require.Contains(t, sch.Queries(FilterQuery), "queryAuthor")
+}
+
+func TestFieldDefinitionMetadata(t *testing.T) {
+	schHandler, errs := NewHandler(directivesSchema)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	s, ok := sch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+	typ := func(name string) Type {
+		return &astType{
+			typ:             &ast.Type{NamedType: name},
+			inSchema:        s,
+			dgraphPredicate: s.dgraphPredicate,
+		}
+	}
+
+	searchable := map[string]map[string][]string{
+		"Author": {
+			"name":       {"hash", "trigram"},
+			"dob":        {"year"},
+			"reputation": {"float"},
+		},
+		"Post":     {"postType": {"hash"}},
+		"Human":    {"name": {"exact"}, "appearsIn": {"hash"}},
+		"Starship": {"name": {"term"}},
+	}
+	for typName, fields := range searchable {
+		for _, fld := range typ(typName).Fields() {
+			require.Equal(t, fields[fld.Name()], fld.Searchable(), "%s.%s", typName, fld.Name())
+		}
+	}
+
+	require.True(t, typ("Author").Field("id").IsID())
+	require.False(t, typ("Author").Field("name").IsID())
+
+	origins := make(map[string]string)
+	for _, fld := range typ("Human").Fields() {
+		origins[fld.Name()] = fld.OriginatedFrom()
+	}
+	require.Equal(t, map[string]string{
+		"id":           "Character",
+		"name":         "Character",
+		"appearsIn":    "Character",
+		"ename":        "Employee",
+		"starships":    "Human",
+		"totalCredits": "Human",
+	}, origins)
+
+	invTyp, invFld, ok := typ("Author").Field("posts").HasInverse()
+	require.True(t, ok)
+	require.Equal(t, "Post", invTyp.Name())
+	require.Equal(t, "author", invFld.Name())
+	require.Equal(t, "Post", invFld.OriginatedFrom())
+
+	invTyp, invFld, ok = typ("Post").Field("author").HasInverse()
+	require.True(t, ok)
+	require.Equal(t, "Author", invTyp.Name())
+	require.Equal(t, "posts", invFld.Name())
+
+	_, _, ok = typ("Author").Field("name").HasInverse()
+	require.False(t, ok)
+}
+
+func TestDgraphMapping_WithReversePredicate(t *testing.T) {
+	schemaStr := `
+	type Movie {
+			id: ID!
+			name: String!
+			director: [MovieDirector] @dgraph(pred: "~directed.movies")
+	}
+
+	type MovieDirector {
+			id: ID!
+			name: String!
+			directed: [Movie] @dgraph(pred: "directed.movies")
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	s, ok := sch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+
+	// The reverse edge is traversed as ~directed.movies, without needing @hasInverse.
+	movie := map[string]string{
+		"name":     "Movie.name",
+		"director": "~directed.movies",
+	}
+	director := map[string]string{
+		"name":     "MovieDirector.name",
+		"directed": "directed.movies",
+	}
+
+	expected := map[string]map[string]string{
+		"Movie":                      movie,
+		"AddMovieInput":              movie,
+		"UpdateMoviePayload":         movie,
+		"DeleteMoviePayload":         movie,
+		"MovieDirector":              director,
+		"AddMovieDirectorInput":      director,
+		"UpdateMovieDirectorPayload": director,
+		"DeleteMovieDirectorPayload": director,
+	}
+
+	if diff := cmp.Diff(expected, s.dgraphPredicate); diff != "" {
+		t.Errorf("dgraph predicate map mismatch (-want +got):\n%s", diff)
+	}
+
+	fwd := (&fieldDefinition{
+		fieldDef: s.schema.Types["Movie"].Fields.ForName("director"),
+		inSchema: s,
+	}).ForwardEdge()
+	require.NotNil(t, fwd)
+	require.Equal(t, "directed", fwd.Name())
+}
+
+func TestDgraphMapping_FlatPredicateNames(t *testing.T) {
+	schemaStr := `
+	# Dgraph.PredicateNaming flat
+
+	interface Character {
+			id: ID!
+			name: String! @search(by: [hash])
+			appearsIn: [String]
+	}
+
+	type Human implements Character {
+			starships: [Starship]
+			credits: Float @dgraph(pred: "Human.credits")
+	}
+
+	type Droid implements Character {
+			primaryFunction: String
+	}
+
+	type Starship {
+			id: ID!
+			name: String! @search(by: [hash])
+			length: Float
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	s, ok := sch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+
+	// The fields that Human and Droid inherit are stored in the predicates of Character, which
+	// Starship shares its name with, and an explicit @dgraph(pred: ...) still wins.
+	require.Equal(t, map[string]string{
+		"name":      "name",
+		"appearsIn": "appearsIn",
+	}, s.dgraphPredicate["Character"])
+	require.Equal(t, map[string]string{
+		"name":      "name",
+		"appearsIn": "appearsIn",
+		"starships": "starships",
+		"credits":   "Human.credits",
+	}, s.dgraphPredicate["Human"])
+	require.Equal(t, map[string]string{
+		"name":            "name",
+		"appearsIn":       "appearsIn",
+		"primaryFunction": "primaryFunction",
+	}, s.dgraphPredicate["Droid"])
+	require.Equal(t, map[string]string{
+		"name":   "name",
+		"length": "length",
+	}, s.dgraphPredicate["Starship"])
+
+	require.Len(t, regexp.MustCompile(`(?m)^name: string @index\(hash\) \.$`).
+		FindAllString(schHandler.DGSchema(), -1), 1)
+	require.Contains(t, schHandler.DGSchema(),
+		"type Droid {\n  name\n  appearsIn\n  primaryFunction\n}")
+
+	_, err = NewHandler(`
+	# Dgraph.PredicateNaming flat
+	type Author {
+			id: ID!
+			name: String! @search(by: [hash])
+	}
+
+	type Starship {
+			id: ID!
+			name: String! @search(by: [term])
+	}`)
+	require.Error(t, err)
+	gqlErrs, ok := err.(gqlerror.List)
+	require.True(t, ok)
+	require.Len(t, gqlErrs, 1)
+	require.Equal(t, "Type Starship; Field name: has indexes @search(by: [term]), which is "+
+		"different to type Author; field name, which has indexes @search(by: [hash]), but "+
+		"both are stored in the predicate name because of # Dgraph.PredicateNaming flat. "+
+		"These fields must have the same indexes, or use different Dgraph predicates with "+
+		"@dgraph(pred: ...).", gqlErrs[0].Message)
+	require.Equal(t, []gqlerror.Location{{Line: 10, Column: 4}, {Line: 5, Column: 4}},
+		gqlErrs[0].Locations)
+}
+
+func TestDgraphMapping_ConflictingInterfacePredicate(t *testing.T) {
+	schemaStr := `
+	interface Character {
+			id: ID!
+			appearsIn: [String] @dgraph(pred: "appears_in")
+	}
+
+	type Human implements Character {
+			totalCredits: Float
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	gqlSchema := schHandler.GQLSchema()
+
+	// The generated schema repeats the interface fields in Human, along with their directives.
+	// Map Human's copy of appearsIn to some other predicate.
+	humanAt := strings.Index(gqlSchema, "type Human implements Character")
+	require.NotEqual(t, -1, humanAt)
+	conflicting := gqlSchema[:humanAt] + strings.Replace(gqlSchema[humanAt:],
+		`@dgraph(pred: "appears_in")`, `@dgraph(pred: "human_appears_in")`, 1)
+	require.NotEqual(t, gqlSchema, conflicting)
+
+	_, err := FromString(conflicting)
+	require.EqualError(t, err, "Type Human; Field appearsIn: maps to the Dgraph predicate "+
+		"human_appears_in, but it maps to appears_in in the interface Character it implements, "+
+		"these must be the same.")
+}
+
+func TestDgraphMapping_ConflictingPredicateTypes(t *testing.T) {
+	schemaStr := `
+	type Author {
+		id: ID!
+		name: String @dgraph(pred: "shared")
+	}
+
+	type Post {
+		id: ID!
+		likes: Int @dgraph(pred: "post_likes")
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	gqlSchema := schHandler.GQLSchema()
+
+	// Schema generation rejects fields of different types in the same predicate, but a schema
+	// given straight to FromString can still have them.
+	conflicting := strings.Replace(gqlSchema, `@dgraph(pred: "post_likes")`,
+		`@dgraph(pred: "shared")`, 1)
+	require.NotEqual(t, gqlSchema, conflicting)
+
+	_, err := FromString(conflicting)
+	require.Error(t, err)
+	gqlErrs, ok := err.(gqlerror.List)
+	require.True(t, ok)
+	require.Len(t, gqlErrs, 1)
+	require.Equal(t, "Type Post; Field likes: has type Int, which is different to type "+
+		"Author; field name, which has type String, but both are stored in the predicate "+
+		"shared with @dgraph(pred: ...). These fields must have the same type, or use "+
+		"different Dgraph predicates.", gqlErrs[0].Message)
+	require.Len(t, gqlErrs[0].Locations, 2)
+}
+
+func TestHasInverseOnScalarField(t *testing.T) {
+	schemaStr := `
+	type Author {
+		id: ID!
+		name: String
+		posts: [Post] @hasInverse(field: author)
+	}
+
+	type Post {
+		id: ID!
+		author: Author
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	gqlSchema := schHandler.GQLSchema()
+
+	// Schema generation rejects @hasInverse on a scalar field, but a schema given straight to
+	// FromString can still have it.
+	authorAt := strings.Index(gqlSchema, "type Author")
+	require.NotEqual(t, -1, authorAt)
+	mistake := gqlSchema[:authorAt] + strings.Replace(gqlSchema[authorAt:],
+		"name: String", "name: String @hasInverse(field: author)", 1)
+	require.NotEqual(t, gqlSchema, mistake)
+
+	_, err := FromString(mistake)
+	require.Error(t, err)
+	gqlErrs, ok := err.(gqlerror.List)
+	require.True(t, ok)
+	require.Len(t, gqlErrs, 1)
+	require.Equal(t, "Type Author; Field name: Field name is of type String, but @hasInverse "+
+		"directive only applies to fields with object types.", gqlErrs[0].Message)
+}
+
+func TestDefaultValueTypes(t *testing.T) {
+	schemaStr := `
+	type Author {
+		id: ID!
+		name: String
+		rating: Int @default(value: "42")
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	gqlSchema := schHandler.GQLSchema()
+
+	sch, err := FromString(gqlSchema)
+	require.NoError(t, err)
+	s, ok := sch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+	typ := &astType{
+		typ:             &ast.Type{NamedType: "Author"},
+		inSchema:        s,
+		dgraphPredicate: s.dgraphPredicate,
+	}
+	require.Equal(t, int64(42), typ.Field("rating").Default())
+	require.Nil(t, typ.Field("name").Default())
+
+	// Schema generation checks the default too, but a schema given straight to FromString
+	// hasn't been through it.
+	mistake := strings.Replace(gqlSchema, `@default(value: "42")`, `@default(value: "abc")`, 1)
+	require.NotEqual(t, gqlSchema, mistake)
+
+	_, err = FromString(mistake)
+	require.Error(t, err)
+	gqlErrs, ok := err.(gqlerror.List)
+	require.True(t, ok)
+	require.Len(t, gqlErrs, 1)
+	require.Equal(t, "Type Author; Field rating: @default value \"abc\" isn't a value of type Int.",
+		gqlErrs[0].Message)
+}
+
+func TestDgraphMapping_WithUnion(t *testing.T) {
+	schemaStr := `
+	interface Character {
+			id: ID!
+			name: String! @search(by: [exact])
+	}
+
+	type Human implements Character {
+			totalCredits: Float
+	}
+
+	type Droid implements Character {
+			primaryFunction: String
+	}
+
+	union HumanOrDroid @dgraph(type: "Crew") = Human | Droid
+
+	type Starship {
+			id: ID!
+			name: String!
+			pilot: HumanOrDroid
+			crew: [HumanOrDroid]
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	s, ok := sch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+
+	character := map[string]string{
+		"name": "Character.name",
+	}
+	human := map[string]string{
+		"name":         "Character.name",
+		"totalCredits": "Human.totalCredits",
+	}
+	droid := map[string]string{
+		"name":            "Character.name",
+		"primaryFunction": "Droid.primaryFunction",
+	}
+	starship := map[string]string{
+		"name":  "Starship.name",
+		"pilot": "Starship.pilot",
+		"crew":  "Starship.crew",
+	}
+
+	// The union itself has no predicates, its members are mapped just like any other type.
+	expected := map[string]map[string]string{
+		"Character":              character,
+		"UpdateCharacterPayload": character,
+		"DeleteCharacterPayload": character,
+		"Human":                  human,
+		"AddHumanInput":          human,
 		"UpdateHumanPayload":     human,
 		"DeleteHumanPayload":     human,
 		"Droid":                  droid,
+		"AddDroidInput":          droid,
 		"UpdateDroidPayload":     droid,
 		"DeleteDroidPayload":     droid,
 		"Starship":               starship,
+		"AddStarshipInput":       starship,
 		"UpdateStarshipPayload":  starship,
 		"DeleteStarshipPayload":  starship,
 	}
@@ -272,6 +769,143 @@ func TestDgraphMapping_WithDirectives(t *testing.T) {
 	if diff := cmp.Diff(expected, s.dgraphPredicate); diff != "" {
 		t.Errorf("dgraph predicate map mismatch (-want +got):\n%s", diff)
 	}
+
+	require.Contains(t, schHandler.DGSchema(), "Starship.pilot: uid .")
+	require.Contains(t, schHandler.DGSchema(), "Starship.crew: [uid] .")
+
+	// The members are stored under the union's Dgraph type too, and the union's query finds
+	// all of them by it.
+	typ := func(name string) Type {
+		return &astType{
+			typ:             &ast.Type{NamedType: name},
+			inSchema:        s,
+			dgraphPredicate: s.dgraphPredicate,
+		}
+	}
+	require.Equal(t, []string{"Crew"}, typ("Human").Unions())
+	require.Equal(t, []string{"Crew"}, typ("Droid").Unions())
+	require.Empty(t, typ("Starship").Unions())
+
+	op, err := sch.Operation(&Request{
+		Query: `query { queryHumanOrDroid { ... on Human { name } ... on Droid { name } } }`})
+	require.NoError(t, err)
+	require.Equal(t, FilterQuery, op.Queries()[0].QueryType())
+	require.Equal(t, "Crew", op.Queries()[0].Type().DgraphName())
+	require.True(t, op.Queries()[0].InterfaceType())
+}
+
+func TestDgraphMapping_WithCustomFields(t *testing.T) {
+	schemaStr := `
+	interface Person {
+		id: ID!
+		name: String!
+		nickName: String @custom(http: {
+			url: "http://mock:8888/nickNames",
+			method: "GET",
+			body: "{ uid: $id }"
+		})
+	}
+
+	type User implements Person {
+		age: Int
+		friends: [User] @custom(http: {
+			url: "http://mock:8888/friends",
+			method: "GET",
+			body: "{ uid: $id }"
+		})
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	s, ok := sch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+
+	// Fields resolved by @custom aren't stored in Dgraph, so they have no predicate.
+	person := map[string]string{
+		"name": "Person.name",
+	}
+	user := map[string]string{
+		"name": "Person.name",
+		"age":  "User.age",
+	}
+	expected := map[string]map[string]string{
+		"Person":              person,
+		"UpdatePersonPayload": person,
+		"DeletePersonPayload": person,
+		"User":                user,
+		"AddUserInput":        user,
+		"UpdateUserPayload":   user,
+		"DeleteUserPayload":   user,
+	}
+
+	if diff := cmp.Diff(expected, s.dgraphPredicate); diff != "" {
+		t.Errorf("dgraph predicate map mismatch (-want +got):\n%s", diff)
+	}
+
+	require.NotContains(t, schHandler.DGSchema(), "nickName")
+	require.NotContains(t, schHandler.DGSchema(), "friends")
+
+	// Nor can they be set in mutations or used for ordering.
+	for _, typ := range []string{"AddUserInput", "UserPatch", "UserRef"} {
+		require.Nil(t, s.schema.Types[typ].Fields.ForName("nickName"), typ)
+		require.Nil(t, s.schema.Types[typ].Fields.ForName("friends"), typ)
+	}
+	for _, typ := range []string{"PersonOrderable", "UserOrderable"} {
+		require.NotNil(t, s.schema.Types[typ].EnumValues.ForName("name"), typ)
+		require.Nil(t, s.schema.Types[typ].EnumValues.ForName("nickName"), typ)
+	}
+}
+
+func TestDgraphMapping_WithFacets(t *testing.T) {
+	schemaStr := `
+	type Person {
+		id: ID!
+		name: String!
+		friends: [Person]
+		since: DateTime @dgraph(facet: "since")
+	}`
+
+	schHandler, errs := NewHandler(schemaStr)
+	require.NoError(t, errs)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	s, ok := sch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+
+	// A facet is stored on the edges to a Person, so it isn't a predicate of Person.
+	person := map[string]string{
+		"name":    "Person.name",
+		"friends": "Person.friends",
+	}
+	expected := map[string]map[string]string{
+		"Person":              person,
+		"AddPersonInput":      person,
+		"UpdatePersonPayload": person,
+		"DeletePersonPayload": person,
+	}
+	if diff := cmp.Diff(expected, s.dgraphPredicate); diff != "" {
+		t.Errorf("dgraph predicate map mismatch (-want +got):\n%s", diff)
+	}
+	require.Equal(t, map[string]map[string]string{"Person": {"since": "since"}}, s.facets)
+
+	typ := &astType{
+		typ:             &ast.Type{NamedType: "Person"},
+		inSchema:        s,
+		dgraphPredicate: s.dgraphPredicate,
+	}
+	require.Equal(t, "since", typ.DgraphFacet("since"))
+	require.Equal(t, "", typ.DgraphFacet("name"))
+	require.Equal(t, "", typ.DgraphPredicate("since"))
+	require.NotContains(t, schHandler.DGSchema(), "Person.since")
+
+	// Nor can it be set in mutations.
+	for _, typ := range []string{"AddPersonInput", "PersonPatch", "PersonRef"} {
+		require.Nil(t, s.schema.Types[typ].Fields.ForName("since"), typ)
+	}
 }
 
 func TestCheckNonNulls(t *testing.T) {
@@ -303,7 +937,8 @@ func TestCheckNonNulls(t *testing.T) {
 		},
 		"missing all non-null": {
 			obj: map[string]interface{}{"notReq": "here"},
-			err: errors.Errorf("type T requires a value for field req, but no value present"),
+			err: errors.Errorf("type T requires a value for field req, but no value present; " +
+				"type T requires a value for field alsoReq, but no value present"),
 		},
 		"with exclusion": {
 			obj: map[string]interface{}{"req": "here", "notReq": "here"},
@@ -329,13 +964,60 @@ func TestCheckNonNulls(t *testing.T) {
 	}
 }
 
-func TestSubstituteVarsInBody(t *testing.T) {
-	tcases := []struct {
-		name        string
-		variables   map[string]interface{}
-		template    interface{}
-		expected    interface{}
-		expectedErr error
+func TestCheckNonNullsOfRecursiveInput(t *testing.T) {
+	gqlSchema, err := FromString(`
+	type A {
+		id: ID!
+		x: String!
+		b: B
+	}
+
+	type B {
+		id: ID!
+		y: String!
+		a: A!
+		bs: [B]
+	}`)
+	require.NoError(t, err)
+
+	typA := &astType{
+		typ:      &ast.Type{NamedType: "A"},
+		inSchema: (gqlSchema.(*schema)),
+	}
+
+	// a -> b -> a
+	a := map[string]interface{}{}
+	b := map[string]interface{}{"a": a}
+	a["b"] = b
+	require.EqualError(t, typA.EnsureNonNulls(a, ""),
+		"type A requires a value for field x, but no value present; "+
+			"type B requires a value for field y at b, but no value present")
+
+	// b -> [b, b2, existing], b2 -> b
+	b2 := map[string]interface{}{
+		"y":  "b2",
+		"a":  map[string]interface{}{"x": "a2"},
+		"bs": []interface{}{b},
+	}
+	b["bs"] = []interface{}{b, b2, map[string]interface{}{"id": "0x1"}}
+	require.EqualError(t, typA.EnsureNonNulls(a, ""),
+		"type A requires a value for field x, but no value present; "+
+			"type B requires a value for field y at b, but no value present")
+
+	a["x"] = "a"
+	b["y"] = "b"
+	delete(b2, "a")
+	require.EqualError(t, typA.EnsureNonNulls(a, ""),
+		"type B requires a value for field a at b.bs[1], but no value present")
+}
+
+func TestSubstituteVarsInBody(t *testing.T) {
+	tcases := []struct {
+		name        string
+		variables   map[string]interface{}
+		template    interface{}
+		expected    interface{}
+		expectedErr error
 	}{
 		{
 			"handle nil template correctly",
@@ -423,6 +1105,17 @@ func TestSubstituteVarsInBody(t *testing.T) {
 				map[string]interface{}{"id": 2, "name": "Jerry"}},
 			nil,
 		},
+		{
+			"keeps constants in template as they are",
+			map[string]interface{}{"id": "0x3", "tag": "graphql"},
+			map[string]interface{}{"owner": "$id", "source": "dgraph",
+				"page": map[string]interface{}{"size": float64(10)},
+				"tags": []interface{}{"a", "$tag", 2.5, true, nil}, "cursor": nil},
+			map[string]interface{}{"owner": "0x3", "source": "dgraph",
+				"page": map[string]interface{}{"size": float64(10)},
+				"tags": []interface{}{"a", "graphql", 2.5, true, nil}, "cursor": nil},
+			nil,
+		},
 		{
 			"variable not found error",
 			map[string]interface{}{"postID": "0x9"},
@@ -440,7 +1133,7 @@ func TestSubstituteVarsInBody(t *testing.T) {
 			} else {
 				templatePtr = &test.template
 			}
-			err := SubstituteVarsInBody(templatePtr, test.variables)
+			err := SubstituteVarsInBody(templatePtr, test.variables, nil)
 			if test.expectedErr == nil {
 				require.NoError(t, err)
 				require.Equal(t, test.expected, test.template)
@@ -451,6 +1144,57 @@ func TestSubstituteVarsInBody(t *testing.T) {
 	}
 }
 
+func TestApplyTemplateLeavesTemplateUntouched(t *testing.T) {
+	tmpl, _, _, err := parseBodyTemplate(
+		`{ author: $id, post: { id: $postID, tags: [$tag, "fixed"] }, limit: 10 }`)
+	require.NoError(t, err)
+	require.NotNil(t, tmpl)
+	template := *tmpl
+	template.(map[string]interface{})["offset"] = json.Number("9007199254740993")
+
+	pristine := map[string]interface{}{
+		"author": "$id",
+		"post": map[string]interface{}{
+			"id":   "$postID",
+			"tags": []interface{}{"$tag", "fixed"},
+		},
+		"limit":  template.(map[string]interface{})["limit"],
+		"offset": json.Number("9007199254740993"),
+	}
+	require.Equal(t, pristine, template)
+
+	first, err := ApplyTemplate(template,
+		map[string]interface{}{"id": "0x1", "postID": "0x2", "tag": "go"}, nil)
+	require.NoError(t, err)
+	second, err := ApplyTemplate(template,
+		map[string]interface{}{"id": "0x3", "postID": "0x4", "tag": "graphql"}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]interface{}{
+		"author": "0x1",
+		"post": map[string]interface{}{
+			"id":   "0x2",
+			"tags": []interface{}{"go", "fixed"},
+		},
+		"limit":  pristine["limit"],
+		"offset": json.Number("9007199254740993"),
+	}, first)
+	require.Equal(t, map[string]interface{}{
+		"author": "0x3",
+		"post": map[string]interface{}{
+			"id":   "0x4",
+			"tags": []interface{}{"graphql", "fixed"},
+		},
+		"limit":  pristine["limit"],
+		"offset": json.Number("9007199254740993"),
+	}, second)
+	require.Equal(t, pristine, template)
+
+	_, err = ApplyTemplate(template, map[string]interface{}{"id": "0x1", "tag": "go"}, nil)
+	require.EqualError(t, err, "couldn't find variable: $postID in variables map")
+	require.Equal(t, pristine, template)
+}
+
 func TestParseBodyTemplate(t *testing.T) {
 	tcases := []struct {
 		name           string
@@ -514,13 +1258,41 @@ func TestParseBodyTemplate(t *testing.T) {
 			map[string]bool{"authors": true},
 			nil,
 		},
+		{
+			"parses body template with constants correctly",
+			`{ owner: $id, source: "dgraph", page: { size: 10, offset: -2.5 }, tags: ["a", $tag],
+			   published: true, deleted: false, cursor: null }`,
+			map[string]interface{}{"owner": "$id", "source": "dgraph",
+				"page": map[string]interface{}{"size": float64(10), "offset": -2.5},
+				"tags": []interface{}{"a", "$tag"}, "published": true, "deleted": false,
+				"cursor": nil},
+			map[string]bool{"id": true, "tag": true},
+			nil,
+		},
+		{
+			"string constant starting with $ error",
+			`{ owner: "$id" }`,
+			nil,
+			nil,
+			errors.New(`string constant: "$id" can't start with $ while parsing body template`),
+		},
 		{
 			"json unmarshal error",
 			`{ author: $id, post: { id $postID }}`,
 			nil,
 			nil,
 			errors.New("couldn't unmarshal HTTP body: {\"author\":\"$id\",\"post\":{\"id\"\"$postID\"}}" +
-				" as JSON"),
+				" as JSON, error at offset 29: invalid character '\"' after object key"),
+		},
+		{
+			"json unmarshal error for a large body template",
+			`{ author: $id, name: $name, age: $age, country: $country, post: { id $postID },
+			   city: $city, zip: $zip, phone: $phone }`,
+			nil,
+			nil,
+			errors.New("couldn't unmarshal HTTP body: ...ountry\":\"$country\",\"post\":" +
+				"{\"id\"\"$postID\"},\"city\":\"$city\",\"zip\":\"... as JSON, error at offset 78: " +
+				"invalid character '\"' after object key"),
 		},
 		{
 			"unmatched brackets error",
@@ -540,7 +1312,7 @@ func TestParseBodyTemplate(t *testing.T) {
 
 	for _, test := range tcases {
 		t.Run(test.name, func(t *testing.T) {
-			b, requiredFields, err := parseBodyTemplate(test.template)
+			b, requiredFields, _, err := parseBodyTemplate(test.template)
 			if test.expectedErr == nil {
 				require.NoError(t, err)
 				require.Equal(t, test.requiredFields, requiredFields)
@@ -556,6 +1328,107 @@ func TestParseBodyTemplate(t *testing.T) {
 	}
 }
 
+func TestClaimsInBodyTemplate(t *testing.T) {
+	tcases := []struct {
+		name           string
+		template       string
+		variables      map[string]interface{}
+		claims         map[string]interface{}
+		expected       interface{}
+		requiredFields map[string]bool
+		requiredClaims map[string]bool
+		expectedErr    string
+	}{
+		{
+			name:      "substitutes claims along with variables",
+			template:  `{ author: $id, owner: { id: $claims.sub, email: $claims.email } }`,
+			variables: map[string]interface{}{"id": "0x3"},
+			claims: map[string]interface{}{"sub": "user1", "email": "user1@dgraph.io",
+				"role": "ADMIN"},
+			expected: map[string]interface{}{"author": "0x3",
+				"owner": map[string]interface{}{"id": "user1", "email": "user1@dgraph.io"}},
+			requiredFields: map[string]bool{"id": true},
+			requiredClaims: map[string]bool{"sub": true, "email": true},
+		},
+		{
+			name:           "substitutes claims in lists",
+			template:       `{ ids: [$claims.sub, $id] }`,
+			variables:      map[string]interface{}{"id": "0x3"},
+			claims:         map[string]interface{}{"sub": "user1"},
+			expected:       map[string]interface{}{"ids": []interface{}{"user1", "0x3"}},
+			requiredFields: map[string]bool{"id": true},
+			requiredClaims: map[string]bool{"sub": true},
+		},
+		{
+			name:           "claims without a claim name is an argument",
+			template:       `{ claims: $claims }`,
+			variables:      map[string]interface{}{"claims": "all"},
+			expected:       map[string]interface{}{"claims": "all"},
+			requiredFields: map[string]bool{"claims": true},
+			requiredClaims: map[string]bool{},
+		},
+		{
+			name:           "claim not found error",
+			template:       `{ id: $claims.sub }`,
+			claims:         map[string]interface{}{"email": "user1@dgraph.io"},
+			requiredFields: map[string]bool{},
+			requiredClaims: map[string]bool{"sub": true},
+			expectedErr:    "couldn't find claim: sub in the JWT claims",
+		},
+	}
+
+	for _, test := range tcases {
+		t.Run(test.name, func(t *testing.T) {
+			b, requiredFields, requiredClaims, err := parseBodyTemplate(test.template)
+			require.NoError(t, err)
+			require.Equal(t, test.requiredFields, requiredFields)
+			require.Equal(t, test.requiredClaims, requiredClaims)
+
+			err = SubstituteVarsInBody(b, test.variables, test.claims)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+				require.Equal(t, test.expected, *b)
+			} else {
+				require.EqualError(t, err, test.expectedErr)
+			}
+		})
+	}
+
+	_, _, _, err := parseBodyTemplate(`{ id: $claims. }`)
+	require.EqualError(t, err,
+		"expected the name of a claim after $claims. while parsing body template")
+}
+
+func TestCustomHTTPUsesClaims(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	type Author {
+		id: ID!
+		name: String!
+	}
+
+	type Query {
+		myAuthor(id: ID!): Author @custom(http: {
+			url: "http://api.com/authors",
+			method: POST,
+			body: "{ id: $id, email: $claims.email }"
+		})
+		favAuthor(id: ID!): Author @custom(http: {
+			url: "http://api.com/authors",
+			method: POST,
+			body: "{ id: $id }"
+		})
+	}`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { myAuthor(id: "0x1") { name } favAuthor(id: "0x1") { name } }`})
+	require.NoError(t, err)
+	require.True(t, op.Queries()[0].CustomHTTPUsesClaims())
+	require.False(t, op.Queries()[1].CustomHTTPUsesClaims())
+}
+
 func TestSubstituteVarsInURL(t *testing.T) {
 	tcases := []struct {
 		name        string
@@ -603,6 +1476,40 @@ func TestSubstituteVarsInURL(t *testing.T) {
 				"&author%5Bname%5D=Jerry",
 			nil,
 		},
+		{
+			"Substitute query params for array of object value with many keys in a stable order",
+			map[string]interface{}{"data": []interface{}{
+				map[string]interface{}{"name": "George", "id": 1, "age": 40,
+					"book": map[string]interface{}{"title": "B1", "year": 2001}},
+				map[string]interface{}{"name": "Jerry", "id": 2, "age": 35,
+					"book": map[string]interface{}{"year": 2002, "title": "B2"}},
+			}},
+			"http://myapi.com/favMovies?author=$data&num=10",
+			"http://myapi.com/favMovies?author%5Bage%5D=40&author%5Bage%5D=35" +
+				"&author%5Bbook%5D%5Btitle%5D=B1&author%5Bbook%5D%5Btitle%5D=B2" +
+				"&author%5Bbook%5D%5Byear%5D=2001&author%5Bbook%5D%5Byear%5D=2002" +
+				"&author%5Bid%5D=1&author%5Bid%5D=2" +
+				"&author%5Bname%5D=George&author%5Bname%5D=Jerry&num=10",
+			nil,
+		},
+		{
+			"Substitute query params for numbers in their canonical form",
+			map[string]interface{}{"pi": 3.140000, "whole": float64(10), "big": 1e21,
+				"small": 0.0000001, "num": 42, "json": json.Number("2.50")},
+			"http://myapi.com/favMovies?pi=$pi&whole=$whole&big=$big&small=$small&num=$num" +
+				"&json=$json",
+			"http://myapi.com/favMovies?big=1000000000000000000000&json=2.5&num=42&pi=3.14" +
+				"&small=0.0000001&whole=10",
+			nil,
+		},
+		{
+			"Substitute path params and lists of numbers in their canonical form",
+			map[string]interface{}{"id": float64(7), "scores": []float64{1.50, 2, 1e-7},
+				"ratings": []interface{}{4.0, 3.25}},
+			"http://myapi.com/favMovies/$id/$ratings?score=$scores",
+			"http://myapi.com/favMovies/7/4%2C3.25?score=1.5&score=2&score=0.0000001",
+			nil,
+		},
 		{
 			"Substitute query params for a variable value that is null as empty",
 			map[string]interface{}{"id": "0x9", "name": nil, "num": 10},
@@ -647,6 +1554,30 @@ func TestSubstituteVarsInURL(t *testing.T) {
 			"http://myapi.com/favMovies/id%2C1%2Cname%2CGeorge%2F%2Cid%2C2%2Cname%2CJerry",
 			nil,
 		},
+		{
+			"Return an error for a url without a scheme",
+			map[string]interface{}{"id": "0x9"},
+			"myapi.com/favMovies/$id",
+			"",
+			errors.New("url myapi.com/favMovies/$id has no scheme, it should be like " +
+				"http://host/path"),
+		},
+		{
+			"Return an error for a url without a host",
+			map[string]interface{}{"id": "0x9"},
+			"http:///favMovies/$id",
+			"",
+			errors.New("url http:///favMovies/$id has no host, it should be like " +
+				"http://host/path"),
+		},
+		{
+			"Return an error for a url with only a port for its host",
+			nil,
+			"http://:8080/favMovies",
+			"",
+			errors.New("url http://:8080/favMovies has no host, it should be like " +
+				"http://host/path"),
+		},
 	}
 
 	for _, test := range tcases {
@@ -662,6 +1593,48 @@ func TestSubstituteVarsInURL(t *testing.T) {
 	}
 }
 
+func TestSubstituteVarsInHeaders(t *testing.T) {
+	tcases := []struct {
+		name      string
+		variables map[string]interface{}
+		templates map[string]string
+		expected  http.Header
+	}{
+		{
+			"Substitute variables in header values",
+			map[string]interface{}{"partner": "p1", "token": "abc", "num": 10},
+			map[string]string{"X-Partner-Id": "$partner", "Authorization": "Bearer $token",
+				"X-Page": "$num-$partner"},
+			http.Header{"X-Partner-Id": {"p1"}, "Authorization": {"Bearer abc"},
+				"X-Page": {"10-p1"}, "Content-Type": {"application/json"}},
+		},
+		{
+			"Omit headers corresponding to variables that are missing or null",
+			map[string]interface{}{"token": "abc", "partner": nil},
+			map[string]string{"X-Partner-Id": "$partner", "Authorization": "Bearer $token",
+				"X-Region": "$token/$region"},
+			http.Header{"Authorization": {"Bearer abc"}, "Content-Type": {"application/json"}},
+		},
+		{
+			"Substitute variables with array value and keep escaped $",
+			map[string]interface{}{"ids": []interface{}{1, "two"}},
+			map[string]string{"X-Ids": "$ids", "X-Price": "$$5_$ids"},
+			http.Header{"X-Ids": {"1,two"}, "X-Price": {"$5_1,two"},
+				"Content-Type": {"application/json"}},
+		},
+	}
+
+	for _, test := range tcases {
+		t.Run(test.name, func(t *testing.T) {
+			headers := http.Header{"Content-Type": {"application/json"}}
+			res := SubstituteVarsInHeaders(headers, test.templates, test.variables)
+			require.Equal(t, test.expected, res)
+			// the given headers are left as they are
+			require.Equal(t, http.Header{"Content-Type": {"application/json"}}, headers)
+		})
+	}
+}
+
 func TestParseRequiredArgsFromGQLRequest(t *testing.T) {
 	tcases := []struct {
 		name         string
@@ -709,8 +1682,40 @@ type CustomHTTPConfigCase struct {
 	// remote query and variables which are built as part of the HTTP config and checked.
 	RemoteQuery     string
 	RemoteVariables string
+	// the template for variables given as body along with graphql, and the fields it requires.
+	VariablesTemplate string
+	RequiredArgs      []string
 	// remote schema against which the RemoteQuery and RemoteVariables are validated.
 	RemoteSchema string
+	// the headers the remote schema is introspected with, if the schema is validated by
+	// introspecting RemoteSchema.
+	IntrospectionHeaders map[string]string
+
+	// for REST requests, which have no RemoteSchema, the method, url and body that are built
+	// as part of the HTTP config and checked.
+	Method string
+	URL    string
+	Body   string
+
+	// the error that building the HTTP config fails with, if it's expected to fail.
+	Error string
+}
+
+// introspect returns the introspection of the schema sch, as a remote GraphQL API would.
+func introspect(t *testing.T, sch string) *introspectedSchema {
+	schHandler, err := NewHandler(sch)
+	require.NoError(t, err)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{Query: introspectionQuery})
+	require.NoError(t, err)
+	data, err := Introspect(op.Queries()[0])
+	require.NoError(t, err)
+
+	result := &introspectedSchema{}
+	require.NoError(t, json.Unmarshal([]byte(`{"data": `+string(data)+`}`), result))
+	return result
 }
 
 func TestGraphQLQueryInCustomHTTPConfig(t *testing.T) {
@@ -723,11 +1728,31 @@ func TestGraphQLQueryInCustomHTTPConfig(t *testing.T) {
 
 	for _, tcase := range tests {
 		t.Run(tcase.Name, func(t *testing.T) {
+			var introspectionHeaders http.Header
+			if tcase.IntrospectionHeaders != nil {
+				defer func(f func(string, http.Header) (*introspectedSchema, error)) {
+					introspectRemote = f
+				}(introspectRemote)
+				introspectRemote = func(url string, headers http.Header) (
+					*introspectedSchema, error) {
+					introspectionHeaders = headers
+					return introspect(t, tcase.RemoteSchema), nil
+				}
+			}
+
 			schHandler, errs := NewHandler(tcase.GQLSchema)
 			require.NoError(t, errs)
-			sch, err := FromString(schHandler.GQLSchema())
+			sch, err := FromHandler(context.Background(), schHandler)
 			require.NoError(t, err)
 
+			if tcase.IntrospectionHeaders != nil {
+				want := http.Header{}
+				for k, v := range tcase.IntrospectionHeaders {
+					want.Set(k, v)
+				}
+				require.Equal(t, want, introspectionHeaders)
+			}
+
 			var vars map[string]interface{}
 			if tcase.GQLVariables != "" {
 				err = json.Unmarshal([]byte(tcase.GQLVariables), &vars)
@@ -760,8 +1785,26 @@ func TestGraphQLQueryInCustomHTTPConfig(t *testing.T) {
 				field = q.SelectionSet()[0]
 			}
 
-			c, err := field.CustomHTTPConfig()
+			confs, err := field.CustomHTTPConfig(nil)
+			if tcase.Error != "" {
+				require.EqualError(t, err, tcase.Error)
+				return
+			}
 			require.NoError(t, err)
+			require.Len(t, confs, 1)
+			c := confs[0]
+
+			if tcase.RemoteSchema == "" {
+				require.Equal(t, tcase.Method, c.Method)
+				require.Equal(t, tcase.URL, c.URL)
+				require.Equal(t, tcase.Body != "", c.Template != nil)
+				if tcase.Body != "" {
+					var body interface{}
+					require.NoError(t, json.Unmarshal([]byte(tcase.Body), &body))
+					require.Equal(t, body, *c.Template)
+				}
+				return
+			}
 
 			remoteSchemaHandler, errs := NewHandler(tcase.RemoteSchema)
 			require.NoError(t, errs)
@@ -781,6 +1824,20 @@ func TestGraphQLQueryInCustomHTTPConfig(t *testing.T) {
 			}
 			require.Equal(t, rv, v)
 
+			if tcase.VariablesTemplate != "" {
+				var vt interface{}
+				require.NoError(t, json.Unmarshal([]byte(tcase.VariablesTemplate), &vt))
+				require.NotNil(t, c.VariablesTemplate)
+				require.Equal(t, vt, *c.VariablesTemplate)
+			}
+			if tcase.RequiredArgs != nil {
+				requiredArgs := make(map[string]bool)
+				for _, arg := range tcase.RequiredArgs {
+					requiredArgs[arg] = true
+				}
+				require.Equal(t, requiredArgs, c.RequiredArgs)
+			}
+
 			if tcase.InputVariables != "" {
 				require.NoError(t, json.Unmarshal([]byte(tcase.InputVariables), &v))
 			}
@@ -795,117 +1852,1186 @@ func TestGraphQLQueryInCustomHTTPConfig(t *testing.T) {
 	}
 }
 
-func TestAllowedHeadersList(t *testing.T) {
-	// TODO Add Custom logic forward headers tests
-	tcases := []struct {
-		name      string
-		schemaStr string
-		expected  string
+func TestCheckRequiredRemoteArgs(t *testing.T) {
+	tcases := map[string]struct {
+		graphql  string
+		vars     map[string]interface{}
+		required []string
+		err      string
 	}{
-		{
-			"auth header present in allowed headers list",
-			`
-	 type X @auth(
-        query: {rule: """
-          query {
-            queryX(filter: { userRole: { eq: "ADMIN" } }) {
-              __typename
-            }
-          }"""
-        }
-      ) {
-        username: String! @id
-        userRole: String @search(by: [hash])
-	  }
-	  # Dgraph.Authorization X-Test-Dgraph https://dgraph.io/jwt/claims RS256 "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAsppQMzPRyYP9KcIAg4CG\nUV3NGCIRdi2PqkFAWzlyo0mpZlHf5Hxzqb7KMaXBt8Yh+1fbi9jcBbB4CYgbvgV0\n7pAZY/HE4ET9LqnjeF2sjmYiGVxLARv8MHXpNLcw7NGcL0FgSX7+B2PB2WjBPnJY\ndvaJ5tsT+AuZbySaJNS1Ha77lW6gy/dmBDybZ1UU+ixRjDWEqPmtD71g2Fpk8fgr\nReNm2h/ZQsJ19onFaGPQN6L6uJR+hfYN0xmOdTC21rXRMUJT8Pw9Xsi6wSt+tI4T\nKxDfMTxKksfjv93dnnof5zJtIcMFQlSKLOrgDC0WP07gVTR2b85tFod80ykevvgu\nAQIDAQAB\n-----END PUBLIC KEY-----"
-	`,
-			"X-Test-Dgraph",
+		"required argument given by a variable": {
+			graphql:  `query($id: ID) { country(code: $id) }`,
+			vars:     map[string]interface{}{"id": "0x1"},
+			required: []string{"code"},
+		},
+		"required argument left out": {
+			graphql:  `query($id: ID) { country(name: $id) }`,
+			vars:     map[string]interface{}{"id": "0x1"},
+			required: []string{"code"},
+			err: "argument `code` of remote query `country` is required, but no value is " +
+				"given for it.",
+		},
+		"required argument given by a variable without a value": {
+			graphql:  `query($id: ID) { country(code: $id) }`,
+			vars:     map[string]interface{}{},
+			required: []string{"code"},
+			err: "argument `code` of remote query `country` is required, but no value is " +
+				"given for it.",
+		},
+		"required argument given by a variable with a default": {
+			graphql:  `query($id: ID = "0x1") { country(code: $id) }`,
+			vars:     map[string]interface{}{},
+			required: []string{"code"},
+		},
+		"non-null variable without a value and no introspection": {
+			graphql: `query($id: ID!) { country(code: $id) }`,
+			vars:    map[string]interface{}{},
+			err: "argument `code` of remote query `country` is required, but no value is " +
+				"given for it.",
 		},
 	}
-	for _, test := range tcases {
-		t.Run(test.name, func(t *testing.T) {
-			schHandler, errs := NewHandler(test.schemaStr)
-			require.NoError(t, errs)
-			_, err := FromString(schHandler.GQLSchema())
-			require.NoError(t, err)
-			require.True(t, strings.Contains(hc.allowed, test.expected))
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			doc, gqlErr := parser.ParseQuery(&ast.Source{Input: tcase.graphql})
+			require.Nil(t, gqlErr)
+			err := checkRequiredRemoteArgs(doc.Operations[0], tcase.vars, tcase.required)
+			if tcase.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tcase.err)
+			}
 		})
 	}
 }
 
-func TestParseSecrets(t *testing.T) {
-	tcases := []struct {
-		name               string
-		schemaStr          string
-		expectedSecrets    map[string]string
-		expectedAuthHeader string
-		err                error
-	}{
-		{"should be able to parse secrets",
-			`
-			type User {
-				id: ID!
-				name: String!
-			}
+func TestRequiredRemoteArgsFromIntrospection(t *testing.T) {
+	defer func(f func(string, http.Header) (*introspectedSchema, error)) {
+		introspectRemote = f
+	}(introspectRemote)
+	introspectRemote = func(url string, headers http.Header) (*introspectedSchema, error) {
+		return introspect(t, `
+		type Country @remote {
+			code: String
+			name: String
+		}
 
-			 # Dgraph.Secret  GITHUB_API_TOKEN   "some-super-secret-token"
-			# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"
-			`,
-			map[string]string{"GITHUB_API_TOKEN": "some-super-secret-token",
-				"STRIPE_API_KEY": "stripe-api-key-value"},
-			"",
-			nil,
-		},
-		{"should be able to parse secret where schema also has other comments.",
-			`
-		# Dgraph.Secret  GITHUB_API_TOKEN   "some-super-secret-token"
+		type Query {
+			country(code: ID!, name: String): Country! @custom(http: {
+				url: "http://google.com/validcountry",
+				method: "POST"
+			})
+		}`), nil
+	}
 
-		type User {
-			id: ID!
-			name: String!
-		}
+	schHandler, errs := NewHandler(`
+	type Country @remote {
+		code: String
+		name: String
+	}
 
-		# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"
-		# random comment
-		`,
-			map[string]string{"GITHUB_API_TOKEN": "some-super-secret-token",
-				"STRIPE_API_KEY": "stripe-api-key-value"},
-			"",
-			nil,
-		},
-		{
-			"should throw an error if the secret is not in the correct format",
-			`
-			type User {
-				id: ID!
-				name: String!
-			}
+	type Query {
+		getCountry(id: ID!): Country! @custom(http: {
+			url: "http://google.com/validcountry",
+			method: "POST",
+			graphql: "query($id: ID!) { country(code: $id) }"
+		})
+	}`)
+	require.NoError(t, errs)
+	sch, err := FromHandler(context.Background(), schHandler)
+	require.NoError(t, err)
+	require.Equal(t, []string{"code"},
+		sch.(*schema).remoteArgs["Query"]["getCountry"]["country"])
+}
 
-			# Dgraph.Secret RANDOM_TOKEN
-			`,
-			nil,
-			"",
-			errors.New("incorrect format for specifying Dgraph secret found for " +
-				"comment: `# Dgraph.Secret RANDOM_TOKEN`, it should " +
-				"be `# Dgraph.Secret key value`"),
-		},
-		{
-			"should work along with authorization",
-			`
-			type User {
-				id: ID!
-				name: String!
-			}
+func TestRESTCustomHTTPConfig(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+	}
 
-			# Dgraph.Secret  "GITHUB_API_TOKEN"   "some-super-secret-token"
-			# Dgraph.Authorization X-Test-Dgraph https://dgraph.io/jwt/claims HS256 "key"
-			# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"
-			`,
-			map[string]string{"GITHUB_API_TOKEN": "some-super-secret-token",
-				"STRIPE_API_KEY": "stripe-api-key-value"},
-			"X-Test-Dgraph",
+	type Query {
+		favAuthor(id: ID!, name: String!): Author @custom(http: {
+			url: "http://api.com/authors/$id?name=$name",
+			method: POST,
+			body: "{ author: { name: $name } }"
+		})
+		myAuthor(id: ID!): Author @custom(http: {
+			url: "http://api.com/authors/$id",
+			method: GET
+		})
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { favAuthor(id: "0x1", name: "Alice") { name } }`})
+	require.NoError(t, err)
+	confs, err := op.Queries()[0].CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Len(t, confs, 1)
+	c := confs[0]
+
+	require.Equal(t, "POST", c.Method)
+	require.Equal(t, "http://api.com/authors/0x1?name=Alice", c.URL)
+	require.Equal(t, "http://api.com/authors/$id?name=$name", c.URLTemplate)
+	require.Equal(t, "application/json", c.ContentType)
+
+	op, err = gqlSchema.Operation(&Request{Query: `query { myAuthor(id: "0x1") { name } }`})
+	require.NoError(t, err)
+	confs, err = op.Queries()[0].CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Len(t, confs, 1)
+	c = confs[0]
+
+	require.Equal(t, "GET", c.Method)
+	require.Equal(t, "http://api.com/authors/0x1", c.URL)
+	require.Equal(t, "http://api.com/authors/$id", c.URLTemplate)
+	require.Empty(t, c.ContentType)
+}
+
+func TestRelativeCustomHTTPURL(t *testing.T) {
+	sch := `
+	type Movie {
+		id: ID!
+		name: String!
+	}
+
+	type Query {
+		movie(id: ID!): Movie @custom(http: {
+			url: "/v1/movies/$id",
+			method: GET
+		})
+	}`
+
+	schHandler, errs := NewHandler(sch + `
+	# Dgraph.BaseURL "http://movies.internal:8080/"`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{Query: `query { movie(id: "0x1") { name } }`})
+	require.NoError(t, err)
+	confs, err := op.Queries()[0].CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Len(t, confs, 1)
+	require.Equal(t, "http://movies.internal:8080/v1/movies/0x1", confs[0].URL)
+	require.Equal(t, "http://movies.internal:8080/v1/movies/$id", confs[0].URLTemplate)
+
+	_, errs = NewHandler(sch)
+	require.Error(t, errs)
+	gqlErrs, ok := errs.(gqlerror.List)
+	require.True(t, ok)
+	require.Len(t, gqlErrs, 1)
+	require.Equal(t, "Type Query; Field movie; url /v1/movies/$id inside @custom directive is "+
+		"relative, but the schema has no # Dgraph.BaseURL to resolve it against.",
+		gqlErrs[0].Message)
+	require.Equal(t, []gqlerror.Location{{Line: 9, Column: 9}}, gqlErrs[0].Locations)
+
+	_, errs = NewHandler(sch + `
+	# Dgraph.BaseURL "movies.internal"`)
+	require.EqualError(t, errs, "incorrect base URL `movies.internal` found for comment: "+
+		"`# Dgraph.BaseURL \"movies.internal\"`, it should be like http://host/path")
+}
+
+func TestCustomHTTPConfigFallbackChain(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+	}
+
+	type Query {
+		favAuthor(id: ID!, name: String!): Author @custom(http: [{
+			url: "http://api.com/authors/$id?name=$name",
+			method: POST,
+			body: "{ author: { name: $name } }"
+		}, {
+			url: "http://backup.api.com/authors/$id",
+			method: GET
+		}])
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { favAuthor(id: "0x1", name: "Alice") { name } }`})
+	require.NoError(t, err)
+	confs, err := op.Queries()[0].CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Len(t, confs, 2)
+
+	require.Equal(t, "POST", confs[0].Method)
+	require.Equal(t, "http://api.com/authors/0x1?name=Alice", confs[0].URL)
+	require.NotNil(t, confs[0].Template)
+	require.Equal(t, "GET", confs[1].Method)
+	require.Equal(t, "http://backup.api.com/authors/0x1", confs[1].URL)
+	require.Nil(t, confs[1].Template)
+
+	_, rf := op.Queries()[0].HasCustomDirective()
+	require.Equal(t, map[string]bool{"id": true, "name": true}, rf)
+}
+
+func TestOperationValidate(t *testing.T) {
+	schHandler, err := NewHandler(`
+	type Author {
+		id: ID!
+		name: String!
+		publisher: String
+	}`)
+	require.NoError(t, err)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	newHandler, err := NewHandler(`
+	type Author {
+		id: ID!
+		name: String!
+	}`)
+	require.NoError(t, err)
+	newSchema, err := FromString(newHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{Query: `query {
+  queryAuthor {
+    name
+    publisher
+  }
+}`})
+	require.NoError(t, err)
+	require.Empty(t, op.Validate(gqlSchema))
+
+	gqlErrs := op.Validate(newSchema)
+	require.Len(t, gqlErrs, 1)
+	require.Equal(t, `Cannot query field "publisher" on type "Author".`, gqlErrs[0].Message)
+	require.Equal(t, []gqlerror.Location{{Line: 4, Column: 5}}, gqlErrs[0].Locations)
+}
+
+func TestOperationName(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	query := `query authors { queryAuthor { name } }
+mutation addAuthors { addAuthor(input: [{ name: "A. N. Author" }]) { numUids } }`
+
+	op, err := gqlSchema.Operation(&Request{Query: query, OperationName: "addAuthors"})
+	require.NoError(t, err)
+	require.Equal(t, "addAuthors", op.OperationName())
+	require.True(t, op.IsMutation())
+	require.Len(t, op.Mutations(), 1)
+
+	op, err = gqlSchema.Operation(&Request{Query: query, OperationName: "authors"})
+	require.NoError(t, err)
+	require.Equal(t, "authors", op.OperationName())
+	require.True(t, op.IsQuery())
+
+	_, err = gqlSchema.Operation(&Request{Query: query})
+	require.EqualError(t, err,
+		"Operation name must by supplied when query has more than 1 operation.")
+
+	_, err = gqlSchema.Operation(&Request{Query: query, OperationName: "authorz"})
+	require.EqualError(t, err, "Supplied operation name authorz isn't present in the request.")
+
+	op, err = gqlSchema.Operation(&Request{Query: `query { queryAuthor { name } }`})
+	require.NoError(t, err)
+	require.Equal(t, "", op.OperationName())
+}
+
+func TestOperationMaxDepth(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+		posts: [Post] @hasInverse(field: author)
+	}
+
+	type Post {
+		id: ID!
+		title: String!
+		author: Author
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	// queryAuthor is at depth 1, so title is at depth 3 and the second name at depth 4.
+	query := `query {
+  queryAuthor {
+    posts {
+      title
+      ...postAuthor
+    }
+  }
+}
+fragment postAuthor on Post {
+  author {
+    name
+  }
+}`
+
+	_, err = gqlSchema.Operation(&Request{Query: query, MaxDepth: 4})
+	require.NoError(t, err)
+
+	_, err = gqlSchema.Operation(&Request{Query: query})
+	require.NoError(t, err)
+
+	_, err = gqlSchema.Operation(&Request{Query: query, MaxDepth: 3})
+	require.Error(t, err)
+	gqlErr, ok := err.(*gqlerror.Error)
+	require.True(t, ok, "expected a *gqlerror.Error, got %T", err)
+	require.Equal(t, "Field name is at depth 4, but operations can only be nested 3 deep.",
+		gqlErr.Message)
+	require.Equal(t, []gqlerror.Location{{Line: 11, Column: 5}}, gqlErr.Locations)
+
+	// The depth is checked before the operation is validated, so a deep operation is
+	// rejected for its depth even if it's also invalid.
+	_, err = gqlSchema.Operation(&Request{
+		Query:    `query { queryAuthor { posts { author { posts { nope } } } } }`,
+		MaxDepth: 3,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Field posts is at depth 4")
+
+	// Fragments that spread the next one twice are only walked once at each depth.
+	var frags strings.Builder
+	frags.WriteString("query { queryAuthor { ...f0 } }\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&frags, "fragment f%d on Author { ...f%d ...f%d }\n", i, i+1, i+1)
+	}
+	frags.WriteString("fragment f40 on Author { posts { author { name } } }\n")
+	_, err = gqlSchema.Operation(&Request{Query: frags.String(), MaxDepth: 3})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Field name is at depth 4")
+}
+
+func TestOperationAliases(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+		posts: [Post] @hasInverse(field: author)
+	}
+
+	type Post {
+		id: ID!
+		title: String!
+		author: Author
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	limited, err := FromString("# Dgraph.Limits {\"maxAliasLength\": 8}\n" +
+		schHandler.GQLSchema())
+	require.NoError(t, err)
+	require.Equal(t, DefaultMaxAliasLength, gqlSchema.Limits().AliasLength())
+	require.Equal(t, 8, limited.Limits().AliasLength())
+
+	tcases := map[string]struct {
+		schema Schema
+		query  string
+		err    string
+	}{
+		"ordinary aliases": {
+			schema: gqlSchema,
+			query:  `query { a: queryAuthor { n: name p: posts { t: title } } }`,
+		},
+		"a type name is an ordinary alias": {
+			schema: gqlSchema,
+			query:  `query { Post: queryPost { title } }`,
+		},
+		"alias over the default length": {
+			schema: gqlSchema,
+			query: `query { queryAuthor { ` + strings.Repeat("a", 10000) +
+				`: name } }`,
+			err: "Alias of field name is 10000 characters long, but aliases can only be 256 " +
+				"characters long.",
+		},
+		"alias over the schema's limit": {
+			schema: limited,
+			query:  `query { queryAuthor { nineChars: name } }`,
+			err: "Alias of field name is 9 characters long, but aliases can only be 8 " +
+				"characters long.",
+		},
+		"uid": {
+			schema: gqlSchema,
+			query:  `query { queryAuthor { uid: name } }`,
+			err:    "Alias uid of field name is reserved for Dgraph's own use, use another alias.",
+		},
+		"var block": {
+			schema: gqlSchema,
+			query:  `query { var: queryAuthor { name } }`,
+			err: "Alias var of field queryAuthor is reserved for Dgraph's own use, use " +
+				"another alias.",
+		},
+		"password check": {
+			schema: gqlSchema,
+			query:  `query { queryAuthor { checkPwd: name } }`,
+			err: "Alias checkPwd of field name is reserved for Dgraph's own use, use " +
+				"another alias.",
+		},
+		"the name of a query variable is an ordinary alias": {
+			schema: gqlSchema,
+			query: `query { queryAuthor { ...f } }
+			fragment f on Author { posts { Post1: title } }`,
+		},
+		"reserved alias in a fragment": {
+			schema: gqlSchema,
+			query: `query { queryAuthor { ...f } }
+			fragment f on Author { posts { pwd: title } }`,
+			err: "Alias pwd of field title is reserved for Dgraph's own use, use another alias.",
+		},
+		"fragment spread many times": {
+			schema: gqlSchema,
+			query: `query { queryAuthor { ...f posts { author { ...f posts { author { ...f } } } } } }
+			fragment f on Author { name posts { ...g } }
+			fragment g on Post { title author { name } }`,
+		},
+		"dgraph.type isn't even a name": {
+			schema: gqlSchema,
+			query:  `query { queryAuthor { dgraph.type: name } }`,
+			err:    `"."`,
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			_, err := tcase.schema.Operation(&Request{Query: tcase.query})
+			if tcase.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			gqlErr, ok := err.(*gqlerror.Error)
+			require.True(t, ok, "expected a *gqlerror.Error, got %T", err)
+			require.Contains(t, gqlErr.Message, tcase.err)
+		})
+	}
+}
+
+func TestOperationLangTags(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	type Product {
+		productID: ID!
+		name: String @lang
+	}`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	const injection = "en) { uid } x(func: has(a"
+	tcases := map[string]struct {
+		query     string
+		variables map[string]interface{}
+		err       string
+	}{
+		"tags and fallback chain": {
+			query: `query { queryProduct { name(lang: ["zh-Hant-TW", "en", "."]) } }`,
+		},
+		"lang argument": {
+			query: `query { queryProduct { name(lang: "` + injection + `") } }`,
+			err:   `"en) { uid } x(func: has(a" is not a language tag`,
+		},
+		"lang argument in a fallback chain": {
+			query: `query { queryProduct { name(lang: ["fr", "` + injection + `"]) } }`,
+			err:   `"en) { uid } x(func: has(a" is not a language tag`,
+		},
+		"lang argument in a variable": {
+			query:     `query ($l: [String!]) { queryProduct { name(lang: $l) } }`,
+			variables: map[string]interface{}{"l": injection},
+			err:       `"en) { uid } x(func: has(a" is not a language tag`,
+		},
+		"lang of a value": {
+			query: `mutation {
+				addProduct(input: [{name: [{value: "Cheese", lang: "` + injection + `"}]}]) {
+					numUids
+				}
+			}`,
+			err: `"en) { uid } x(func: has(a" is not a language tag`,
+		},
+		"lang of a value in a variable": {
+			query: `mutation ($p: AddProductInput!) { addProduct(input: [$p]) { numUids } }`,
+			variables: map[string]interface{}{"p": map[string]interface{}{
+				"name": []interface{}{map[string]interface{}{"value": "Cheese", "lang": injection}},
+			}},
+			err: `"en) { uid } x(func: has(a" is not a language tag`,
+		},
+	}
+
+	for name, tcase := range tcases {
+		t.Run(name, func(t *testing.T) {
+			_, err := gqlSchema.Operation(&Request{Query: tcase.query, Variables: tcase.variables})
+			if tcase.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tcase.err)
+		})
+	}
+}
+
+func TestOperationReportsAllUnusedAndUndefined(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String! @search(by: [hash])
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	located := func(err error) []string {
+		gqlErrs, ok := err.(gqlerror.List)
+		require.True(t, ok, "expected a gqlerror.List, got %T", err)
+		var msgs []string
+		for _, e := range gqlErrs {
+			require.NotEmpty(t, e.Locations, e.Message)
+			msgs = append(msgs, fmt.Sprintf("%d: %s", e.Locations[0].Line, e.Message))
+		}
+		return msgs
+	}
+
+	query := `query q($filter: AuthorFilter, $unused: String) {
+  queryAuthor(filter: $filter, first: $first) {
+    ...authorName
+    ...typo
+  }
+}
+fragment authorName on Author { name }
+fragment unusedFrag on Author { name }`
+
+	expected := []string{
+		`1: Variable "$unused" is never used in operation "q".`,
+		`2: Variable "$first" is not defined by operation "q".`,
+		`4: Unknown fragment "typo".`,
+		`8: Fragment "unusedFrag" is never used.`,
+	}
+
+	_, err = gqlSchema.Operation(&Request{Query: query})
+	require.ElementsMatch(t, expected, located(err))
+
+	// A lenient request still can't use what isn't defined.
+	_, err = gqlSchema.Operation(&Request{Query: query, Lenient: true})
+	require.ElementsMatch(t, expected[1:3], located(err))
+
+	// But what's unused is only a warning.
+	lenientQuery := `query q($filter: AuthorFilter, $unused: String) {
+  queryAuthor(filter: $filter) {
+    ...authorName
+    # ...typo
+  }
+}
+fragment authorName on Author { name }
+fragment unusedFrag on Author { name }`
+
+	op, err := gqlSchema.Operation(&Request{Query: lenientQuery, Lenient: true})
+	require.NoError(t, err)
+	require.Len(t, op.Queries(), 1)
+	require.ElementsMatch(t, []string{expected[0], expected[3]}, located(op.Warnings()))
+
+	_, err = gqlSchema.Operation(&Request{Query: lenientQuery})
+	require.ElementsMatch(t, []string{expected[0], expected[3]}, located(err))
+}
+
+func TestOperationMergesFieldsByResponseName(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	interface Character {
+		id: ID!
+		name: String! @search(by: [exact])
+		friends: [Character]
+	}
+
+	type Human implements Character {
+		height: Float
+	}
+
+	type Droid implements Character {
+		primaryFunction: String
+	}`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	responseNames := func(flds []Field) []string {
+		var names []string
+		for _, f := range flds {
+			names = append(names, f.ResponseName())
+		}
+		return names
+	}
+
+	op, err := gqlSchema.Operation(&Request{Query: `query {
+  queryCharacter {
+    name
+    friends { name }
+    ... on Human {
+      name
+      height
+      friends { id }
+    }
+    ...characterFriends
+    __typename
+    ... on Droid { __typename }
+    n1: name
+    n2: name
+  }
+}
+fragment characterFriends on Character {
+  friends { __typename }
+}`})
+	require.NoError(t, err)
+	require.Len(t, op.Queries(), 1)
+
+	// The fields selected directly and through the fragments are merged, but the aliased ones
+	// aren't merged with each other or with name.
+	sels := op.Queries()[0].SelectionSet()
+	require.Equal(t, []string{"name", "friends", "height", "__typename", "n1", "n2"},
+		responseNames(sels))
+	require.Equal(t, "Character", sels[0].GetObjectName())
+	require.Equal(t, []string{"name", "id", "__typename"}, responseNames(sels[1].SelectionSet()))
+
+	_, err = gqlSchema.Operation(&Request{Query: `query {
+  queryCharacter {
+    friends(first: 1) { name }
+    ... on Human {
+      friends(first: 2) { id }
+    }
+  }
+}`})
+	require.Error(t, err)
+	gqlErrs, ok := err.(gqlerror.List)
+	require.True(t, ok, "expected a gqlerror.List, got %T", err)
+	require.Len(t, gqlErrs, 1)
+	require.Contains(t, gqlErrs[0].Message,
+		`Fields "friends" conflict because they have differing arguments.`)
+	require.ElementsMatch(t, []gqlerror.Location{{Line: 3, Column: 5}, {Line: 5, Column: 7}},
+		gqlErrs[0].Locations)
+}
+
+func TestOperationBestEffortReadOnly(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	type Author {
+		id: ID!
+		name: String!
+	}`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	query := `query { queryAuthor { name } }`
+	mutation := `mutation { addAuthor(input: [{ name: "A.N. Author" }]) { numUids } }`
+	bestEffort := http.Header{}
+	bestEffort.Set("X-Dgraph-ReadOnly", "best-effort")
+
+	op, err := gqlSchema.Operation(&Request{Query: query})
+	require.NoError(t, err)
+	require.False(t, op.ReadOnly())
+	require.False(t, op.BestEffort())
+
+	op, err = gqlSchema.Operation(&Request{Query: query, Header: bestEffort})
+	require.NoError(t, err)
+	require.True(t, op.ReadOnly())
+	require.True(t, op.BestEffort())
+
+	op, err = gqlSchema.Operation(&Request{Query: mutation})
+	require.NoError(t, err)
+	require.False(t, op.BestEffort())
+
+	_, err = gqlSchema.Operation(&Request{Query: mutation, Header: bestEffort})
+	require.EqualError(t, err, "Mutations can't be run in a best-effort read-only request.")
+}
+
+func TestPageQueries(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	type Page {
+		id: ID!
+		title: String! @search(by: [hash])
+	}
+
+	type Query {
+		pageViews(id: ID!): Int @custom(http: {url: "http://views.com/$id", method: GET})
+	}`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"pagePage"}, gqlSchema.Queries(PageQuery))
+	// The page type of Page isn't stored in Dgraph, but Page is.
+	require.NotEmpty(t, gqlSchema.(*schema).dgraphPredicate["Page"])
+	require.Empty(t, gqlSchema.(*schema).dgraphPredicate["PagePageResult"])
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { pagePage { totalCount } queryPage { title } pageViews(id: "0x1") }`})
+	require.NoError(t, err)
+	require.Equal(t, PageQuery, op.Queries()[0].QueryType())
+	require.Equal(t, FilterQuery, op.Queries()[1].QueryType())
+	require.Equal(t, HTTPQuery, op.Queries()[2].QueryType())
+}
+
+func TestAggregateFields(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	type Post {
+		id: ID!
+		title: String!
+	}
+
+	type Comment {
+		id: ID!
+		text: String!
+	}
+
+	type PostAggregateResult {
+		count: Int
+	}
+
+	type Author {
+		id: ID!
+		posts: [Post]
+		postsAggregate: PostAggregateResult
+		comments: [Comment]
+	}`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	// Only the aggregate that was generated is computed from its list, the field that's named
+	// like one is stored in Dgraph, just like any other.
+	require.Equal(t, "Author.postsAggregate",
+		gqlSchema.(*schema).dgraphPredicate["Author"]["postsAggregate"])
+	require.Empty(t, gqlSchema.(*schema).dgraphPredicate["CommentAggregateResult"])
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { queryAuthor { postsAggregate { count } commentsAggregate { count } } }`})
+	require.NoError(t, err)
+	sels := op.Queries()[0].SelectionSet()
+	require.Equal(t, "", sels[0].AggregatedField())
+	require.Equal(t, "comments", sels[1].AggregatedField())
+}
+
+func TestGroupQueries(t *testing.T) {
+	schHandler, errs := NewHandler(`
+	type Author {
+		id: ID!
+		name: String! @search(by: [hash])
+		reputation: Float @search
+	}
+
+	type AuthorNameGroup {
+		name: String
+		count: Int
+	}`)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	// AuthorNameGroup is a type of the input, so it's stored like any other and Author can't be
+	// grouped by name.
+	require.Equal(t, []string{"groupAuthorByReputation"}, gqlSchema.Queries(GroupByQuery))
+	require.Equal(t, map[string]string{"name": "AuthorNameGroup.name",
+		"count": "AuthorNameGroup.count"}, gqlSchema.(*schema).dgraphPredicate["AuthorNameGroup"])
+	require.Empty(t, gqlSchema.(*schema).dgraphPredicate["AuthorReputationGroup"])
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { groupAuthorByReputation { reputation count } queryAuthor { name } }`})
+	require.NoError(t, err)
+	nodes, by := op.Queries()[0].GroupedQuery()
+	require.Equal(t, "queryAuthor", nodes.Name())
+	require.Equal(t, "reputation", by.Name())
+	nodes, by = op.Queries()[1].GroupedQuery()
+	require.Nil(t, nodes)
+	require.Nil(t, by)
+}
+
+func TestCustomDQLConfig(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String! @search(by: [hash])
+		reputation: Float
+	}
+
+	type Query {
+		authorsByName(name: String!, minRep: Float): [Author] @custom(dql: """
+		query q($name: string, $minRep: float) {
+			authorsByName(func: eq(Author.name, $name)) @filter(ge(Author.reputation, $minRep)
+				AND NOT eq(Author.name, "$name")) {
+				name: Author.name
+			}
+		}""")
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { authorsByName(name: "Alice") { name } }`})
+	require.NoError(t, err)
+	q := op.Queries()[0]
+	require.Equal(t, DQLQuery, q.QueryType())
+
+	c, ok := q.CustomDQLConfig()
+	require.True(t, ok)
+	require.Contains(t, c.Query, "authorsByName(func: eq(Author.name, $name))")
+	// $name inside the string isn't a variable, and $name is only listed once.
+	require.Equal(t, []string{"name", "minRep"}, c.Vars)
+
+	op, err = gqlSchema.Operation(&Request{Query: `query { getAuthor(id: "0x1") { name } }`})
+	require.NoError(t, err)
+	_, ok = op.Queries()[0].CustomDQLConfig()
+	require.False(t, ok)
+}
+
+func TestCompositeKey(t *testing.T) {
+	sch := `
+	type Member {
+		id: ID!
+		org: String! @id(composite: "orgKey")
+		username: String! @id(composite: "orgKey")
+		name: String
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { getMemberByOrgKey(org: "dgraph", username: "alice") { name } }`})
+	require.NoError(t, err)
+	q := op.Queries()[0]
+	require.Equal(t, GetQuery, q.QueryType())
+
+	keys := q.Type().CompositeKeys()
+	require.Len(t, keys, 1)
+	require.Len(t, keys["orgKey"], 2)
+	require.Equal(t, "org", keys["orgKey"][0].Name())
+	require.Equal(t, "username", keys["orgKey"][1].Name())
+
+	key := q.CompositeKey()
+	require.Len(t, key, 2)
+	require.Equal(t, "org", key[0].Name())
+	require.Equal(t, "username", key[1].Name())
+
+	// The fields of a composite key aren't XIDs on their own.
+	require.Nil(t, q.Type().XIDField())
+
+	op, err = gqlSchema.Operation(&Request{Query: `query { getMember(id: "0x1") { name } }`})
+	require.NoError(t, err)
+	require.Nil(t, op.Queries()[0].CompositeKey())
+
+	// Like XIDs, the fields of a composite key are given when adding and can't be updated.
+	addInput := schHandler.(*handler).completeSchema.Types["AddMemberInput"]
+	require.NotNil(t, addInput.Fields.ForName("org"))
+	require.NotNil(t, addInput.Fields.ForName("username"))
+	patch := schHandler.(*handler).completeSchema.Types["MemberPatch"]
+	require.Nil(t, patch.Fields.ForName("org"))
+	require.Nil(t, patch.Fields.ForName("username"))
+	require.NotNil(t, patch.Fields.ForName("name"))
+}
+
+func TestHeaderTemplatesInCustomHTTPConfig(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+		partner: String
+		books: [String] @custom(http: {
+			url: "http://api.com/books",
+			method: GET,
+			secretHeaders: ["Authorization:Bearer $API_KEY", "X-Partner-Id:$partner"]
+		})
+	}
+
+	type Query {
+		favAuthor(id: ID!, partner: String): Author @custom(http: {
+			url: "http://api.com/authors/$id",
+			method: GET,
+			secretHeaders: ["Authorization:Bearer $API_KEY"],
+			forwardHeaders: ["X-Partner-Id:$partner"]
+		})
+	}
+	# Dgraph.Secret API_KEY "key$1"`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromHandler(context.Background(), schHandler)
+	require.NoError(t, err)
+
+	op, err := gqlSchema.Operation(&Request{
+		Query: `query { favAuthor(id: "0x1", partner: "p1") { name } }`})
+	require.NoError(t, err)
+	confs, err := op.Queries()[0].CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Len(t, confs, 1)
+	c := confs[0]
+	require.Equal(t, http.Header{"Authorization": {"Bearer key$1"}, "X-Partner-Id": {"p1"}},
+		c.ForwardHeaders)
+
+	op, err = gqlSchema.Operation(&Request{Query: `query { favAuthor(id: "0x1") { name } }`})
+	require.NoError(t, err)
+	confs, err = op.Queries()[0].CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Len(t, confs, 1)
+	c = confs[0]
+	require.Equal(t, http.Header{"Authorization": {"Bearer key$1"}}, c.ForwardHeaders)
+
+	op, err = gqlSchema.Operation(&Request{
+		Query: `query { favAuthor(id: "0x1") { books } }`})
+	require.NoError(t, err)
+	books := op.Queries()[0].SelectionSet()[0]
+	hasCustom, rf := books.HasCustomDirective()
+	require.True(t, hasCustom)
+	require.Equal(t, map[string]bool{"partner": true}, rf)
+	confs, err = books.CustomHTTPConfig(nil)
+	require.NoError(t, err)
+	require.Len(t, confs, 1)
+	c = confs[0]
+	require.Empty(t, c.ForwardHeaders)
+	require.Equal(t, map[string]string{"Authorization": "Bearer key$$1",
+		"X-Partner-Id": "$partner"}, c.HeaderTemplates)
+	require.Equal(t, http.Header{"Authorization": {"Bearer key$1"}, "X-Partner-Id": {"p1"}},
+		c.ResolvedHeaders(map[string]interface{}{"id": "0x1", "partner": "p1"}))
+	// Without the values of the variables, only the templates that use just secrets resolve.
+	require.Equal(t, http.Header{"Authorization": {"Bearer key$1"}}, c.ResolvedHeaders(nil))
+}
+
+func TestCustomFields(t *testing.T) {
+	sch := `
+	type Author {
+		id: ID!
+		name: String!
+		bio: String @custom(http: {
+			url: "http://api.com/bios/$id",
+			method: GET
+		})
+	}
+
+	type Query {
+		favAuthor(id: ID!): Author @custom(http: {
+			url: "http://api.com/authors/$id",
+			method: GET
+		})
+	}`
+
+	schHandler, errs := NewHandler(sch)
+	require.NoError(t, errs)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	require.Equal(t, []FieldRef{
+		{TypeName: "Author", FieldName: "bio"},
+		{TypeName: "Query", FieldName: "favAuthor"},
+	}, gqlSchema.CustomFields())
+}
+
+func TestAllowedHeadersList(t *testing.T) {
+	// TODO Add Custom logic forward headers tests
+	tcases := []struct {
+		name      string
+		schemaStr string
+		expected  string
+	}{
+		{
+			"auth header present in allowed headers list",
+			`
+	 type X @auth(
+        query: {rule: """
+          query {
+            queryX(filter: { userRole: { eq: "ADMIN" } }) {
+              __typename
+            }
+          }"""
+        }
+      ) {
+        username: String! @id
+        userRole: String @search(by: [hash])
+	  }
+	  # Dgraph.Authorization X-Test-Dgraph https://dgraph.io/jwt/claims RS256 "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAsppQMzPRyYP9KcIAg4CG\nUV3NGCIRdi2PqkFAWzlyo0mpZlHf5Hxzqb7KMaXBt8Yh+1fbi9jcBbB4CYgbvgV0\n7pAZY/HE4ET9LqnjeF2sjmYiGVxLARv8MHXpNLcw7NGcL0FgSX7+B2PB2WjBPnJY\ndvaJ5tsT+AuZbySaJNS1Ha77lW6gy/dmBDybZ1UU+ixRjDWEqPmtD71g2Fpk8fgr\nReNm2h/ZQsJ19onFaGPQN6L6uJR+hfYN0xmOdTC21rXRMUJT8Pw9Xsi6wSt+tI4T\nKxDfMTxKksfjv93dnnof5zJtIcMFQlSKLOrgDC0WP07gVTR2b85tFod80ykevvgu\nAQIDAQAB\n-----END PUBLIC KEY-----"
+	`,
+			"X-Test-Dgraph",
+		},
+	}
+	for _, test := range tcases {
+		t.Run(test.name, func(t *testing.T) {
+			schHandler, errs := NewHandler(test.schemaStr)
+			require.NoError(t, errs)
+			sch, err := FromHandler(context.Background(), schHandler)
+			require.NoError(t, err)
+			require.True(t, strings.Contains(sch.AllowedHeaders(), test.expected))
+		})
+	}
+}
+
+func TestAuthRuleTree(t *testing.T) {
+	schHandler, err := NewHandler(`
+	type X @auth(
+		query: { or: [
+			{ rule: "{$ROLE: { eq: \"ADMIN\" } }" },
+			{ and: [
+				{ rule: """query($USER: String!) {
+					queryX(filter: { username: { eq: $USER } }) { __typename }
+				}""" },
+				{ not: { rule: "{$ROLE: { eq: \"GUEST\" } }" } }
+			] }
+		] }
+	) {
+		username: String! @id
+	}
+	# Dgraph.Authorization X-Test-Dgraph https://dgraph.io/jwt/claims HS256 "key"
+	`)
+	require.NoError(t, err)
+	sch, err := FromHandler(context.Background(), schHandler)
+	require.NoError(t, err)
+
+	query := sch.(*schema).authRules["X"].Rules.Query
+	require.Equal(t, RuleOr, query.Op())
+	require.Len(t, query.Children(), 2)
+
+	admin := query.Children()[0]
+	require.Equal(t, RuleLeaf, admin.Op())
+	require.Nil(t, admin.Children())
+	require.Equal(t, &RBACQuery{Variable: "ROLE", Operator: "eq", Operand: "ADMIN"},
+		admin.RBACRule)
+
+	and := query.Children()[1]
+	require.Equal(t, RuleAnd, and.Op())
+	require.Len(t, and.Children(), 2)
+	require.Equal(t, RuleLeaf, and.Children()[0].Op())
+	require.NotNil(t, and.Children()[0].Rule)
+	require.Equal(t, "USER", and.Children()[0].Variables[0].Variable)
+
+	not := and.Children()[1]
+	require.Equal(t, RuleNot, not.Op())
+	require.Equal(t, []*RuleNode{not.Not}, not.Children())
+	require.Equal(t, "GUEST", not.Not.RBACRule.Operand)
+}
+
+func TestParseSecrets(t *testing.T) {
+	tcases := []struct {
+		name               string
+		schemaStr          string
+		expectedSecrets    map[string]string
+		expectedAuthHeader string
+		err                error
+	}{
+		{"should be able to parse secrets",
+			`
+			type User {
+				id: ID!
+				name: String!
+			}
+
+			 # Dgraph.Secret  GITHUB_API_TOKEN   "some-super-secret-token"
+			# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"
+			`,
+			map[string]string{"GITHUB_API_TOKEN": "some-super-secret-token",
+				"STRIPE_API_KEY": "stripe-api-key-value"},
+			"",
+			nil,
+		},
+		{"should be able to parse secret where schema also has other comments.",
+			`
+		# Dgraph.Secret  GITHUB_API_TOKEN   "some-super-secret-token"
+
+		type User {
+			id: ID!
+			name: String!
+		}
+
+		# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"
+		# random comment
+		`,
+			map[string]string{"GITHUB_API_TOKEN": "some-super-secret-token",
+				"STRIPE_API_KEY": "stripe-api-key-value"},
+			"",
 			nil,
 		},
+		{
+			"should throw an error if the secret is not in the correct format",
+			`
+			type User {
+				id: ID!
+				name: String!
+			}
+
+			# Dgraph.Secret RANDOM_TOKEN
+			`,
+			nil,
+			"",
+			errors.New("incorrect format for specifying Dgraph secret found for " +
+				"comment: `# Dgraph.Secret RANDOM_TOKEN`, it should " +
+				"be `# Dgraph.Secret key value`"),
+		},
+		{
+			"should work along with authorization",
+			`
+			type User {
+				id: ID!
+				name: String!
+			}
+
+			# Dgraph.Secret  "GITHUB_API_TOKEN"   "some-super-secret-token"
+			# Dgraph.Authorization X-Test-Dgraph https://dgraph.io/jwt/claims HS256 "key"
+			# Dgraph.Secret STRIPE_API_KEY "stripe-api-key-value"
+			`,
+			map[string]string{"GITHUB_API_TOKEN": "some-super-secret-token",
+				"STRIPE_API_KEY": "stripe-api-key-value"},
+			"X-Test-Dgraph",
+			nil,
+		},
+		{
+			"should work with authorization as JSON",
+			`
+			type User {
+				id: ID!
+				name: String!
+			}
+
+			# Dgraph.Authorization {"VerificationKey":"key","Header":"X-Test-Dgraph","Namespace":"https://dgraph.io/jwt/claims","Algo":"HS256","allowedHeaderClaims":["X-Org-Id"]}
+			`,
+			map[string]string{},
+			"X-Test-Dgraph",
+			nil,
+		},
+		{
+			"should throw an error if an allowed header claim isn't a header name",
+			`
+			type User {
+				id: ID!
+				name: String!
+			}
+
+			# Dgraph.Authorization {"VerificationKey":"key","Header":"X-Test-Dgraph","Namespace":"https://dgraph.io/jwt/claims","Algo":"HS256","allowedHeaderClaims":["X_Org_Id"]}
+			`,
+			nil,
+			"",
+			errors.New("error while parsing jwt authorization info: `X_Org_Id` in " +
+				"allowedHeaderClaims isn't a valid header name, it can only have letters, " +
+				"digits and '-'"),
+		},
 		{
 			"should throw an error if multiple authorization values are specified",
 			`
@@ -926,7 +3052,7 @@ func TestParseSecrets(t *testing.T) {
 	}
 	for _, test := range tcases {
 		t.Run(test.name, func(t *testing.T) {
-			s, err := parseSecrets(test.schemaStr)
+			s, authMeta, err := parseSecrets(test.schemaStr)
 			if test.err != nil || err != nil {
 				require.EqualError(t, err, test.err.Error())
 				return
@@ -934,8 +3060,238 @@ func TestParseSecrets(t *testing.T) {
 
 			require.Equal(t, test.expectedSecrets, s)
 			if test.expectedAuthHeader != "" {
-				require.Equal(t, test.expectedAuthHeader, authorization.GetHeader())
+				require.Equal(t, test.expectedAuthHeader, authMeta.Header)
 			}
 		})
 	}
 }
+
+func TestApplyResultPath(t *testing.T) {
+	tcases := []struct {
+		name     string
+		path     string
+		response string
+		expected string
+		err      string
+	}{
+		{
+			name:     "picks out a nested object",
+			path:     "data.items",
+			response: `{"data": {"items": [{"name": "a"}, {"name": "b"}]}}`,
+			expected: `[{"name": "a"}, {"name": "b"}]`,
+		},
+		{
+			name:     "picks out an element of a list",
+			path:     "data.items[1].name",
+			response: `{"data": {"items": [{"name": "a"}, {"name": "b"}]}}`,
+			expected: `"b"`,
+		},
+		{
+			name:     "picks out a field from every element of a list",
+			path:     "items[*].name",
+			response: `{"items": [{"name": "a"}, {"name": "b"}]}`,
+			expected: `["a", "b"]`,
+		},
+		{
+			name:     "picks out from a top level list",
+			path:     "[0]",
+			response: `[{"name": "a"}]`,
+			expected: `{"name": "a"}`,
+		},
+		{
+			name:     "reports the missing elements of a list",
+			path:     "items[*].name",
+			response: `{"items": [{"name": "a"}, {"id": "b"}]}`,
+			expected: `["a", null]`,
+			err:      "resultPath items[*].name has nothing at items[1].name",
+		},
+		{
+			name:     "reports a missing key",
+			path:     "data.items",
+			response: `{"data": {}}`,
+			expected: `null`,
+			err:      "resultPath data.items has nothing at data.items",
+		},
+		{
+			name:     "reports an index out of range",
+			path:     "data[2]",
+			response: `{"data": [1, 2]}`,
+			expected: `null`,
+			err:      "resultPath data[2] has nothing at data[2]",
+		},
+		{
+			name:     "rejects an index that isn't a number",
+			path:     "data[x]",
+			response: `{}`,
+			expected: `null`,
+			err: "while parsing resultPath data[x]: [x] at position 4 should be an index, " +
+				"like [0], or [*]",
+		},
+		{
+			name:     "rejects a path ending with a dot",
+			path:     "data.",
+			response: `{}`,
+			expected: `null`,
+			err:      "while parsing resultPath data.: it ends with a .",
+		},
+	}
+	for _, test := range tcases {
+		t.Run(test.name, func(t *testing.T) {
+			var response interface{}
+			require.NoError(t, json.Unmarshal([]byte(test.response), &response))
+
+			res, err := ApplyResultPath(test.path, response)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			b, err := json.Marshal(res)
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, string(b))
+		})
+	}
+}
+
+func TestRelayIDArguments(t *testing.T) {
+	schHandler, err := NewHandler(`# Dgraph.RelayIDs
+		type Author {
+			id: ID!
+			name: String!
+			posts: [Post] @hasInverse(field: author)
+		}
+		type Post {
+			id: ID!
+			title: String!
+			author: Author
+		}`)
+	require.NoError(t, err)
+	gqlSchema, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	postID := EncodeRelayID("Post", "0x2")
+	authorID := EncodeRelayID("Author", "0x1")
+	op, err := gqlSchema.Operation(&Request{
+		Query: `mutation($posts: [ID!]) {
+			updateAuthor(input: {filter: {id: $posts}, set: {name: "A"}}) {
+				numUids
+			}
+			addPost(input: [{title: "A Post", author: {id: "` + authorID + `"}}]) {
+				numUids
+			}
+		}`,
+		Variables: map[string]interface{}{"posts": []interface{}{postID}},
+	})
+	require.Nil(t, op)
+	require.Contains(t, err.Error(), "Argument input of updateAuthor has an invalid ID: ID "+
+		postID+" is of type Post, but an ID of type Author is expected")
+
+	vars := map[string]interface{}{"authors": []interface{}{authorID}}
+	op, err = gqlSchema.Operation(&Request{
+		Query: `mutation($authors: [ID!]) {
+			updateAuthor(input: {filter: {id: $authors}, set: {name: "A"}}) {
+				numUids
+			}
+			addPost(input: [{title: "A Post", author: {id: "` + authorID + `"}}]) {
+				numUids
+			}
+		}`,
+		Variables: vars,
+	})
+	require.NoError(t, err)
+	update := op.Mutations()[0].ArgValue("input").(map[string]interface{})
+	require.Equal(t, []interface{}{"0x1"}, update["filter"].(map[string]interface{})["id"])
+	add := op.Mutations()[1].ArgValue("input").([]interface{})
+	require.Equal(t, map[string]interface{}{"id": "0x1"},
+		add[0].(map[string]interface{})["author"])
+	// the request's variables keep the IDs it was sent with
+	require.Equal(t, []interface{}{authorID}, vars["authors"])
+
+	for id, msg := range map[string]string{
+		"0x1":                       "ID 0x1 is a uid, but the schema uses Relay global IDs",
+		"not an ID":                 "ID not an ID isn't a Relay global ID, it isn't base64 encoded",
+		EncodeRelayID("Post", "x"):  "isn't a Relay global ID, x isn't a uid",
+		EncodeRelayID("Tag", "0x1"): "is of type Tag, which isn't in the schema",
+	} {
+		_, err := gqlSchema.Operation(&Request{
+			Query: `query { getPost(id: "` + id + `") { title } }`})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestSoftDeleteAddsIncludeDeletedArgument(t *testing.T) {
+	schHandler, err := NewHandler(`
+		type Post @softDelete(field: "deletedAt") {
+			id: ID!
+			title: String! @search(by: [hash])
+			deletedAt: DateTime
+		}
+
+		type Author {
+			id: ID!
+			name: String!
+			posts: [Post]
+		}`)
+	require.NoError(t, err)
+	sch := schHandler.(*handler).completeSchema
+
+	for _, fld := range []string{"posts", "postsAggregate"} {
+		require.NotNil(t, sch.Types["Author"].Fields.ForName(fld).Arguments.ForName("includeDeleted"),
+			fld)
+	}
+	for _, qry := range []string{"getPost", "queryPost"} {
+		fld := sch.Query.Fields.ForName(qry)
+		require.NotNil(t, fld, qry)
+		arg := fld.Arguments.ForName("includeDeleted")
+		require.NotNil(t, arg, qry)
+		require.Equal(t, "Boolean", arg.Type.String())
+	}
+	for _, qry := range []string{"getAuthor", "queryAuthor"} {
+		require.Nil(t, sch.Query.Fields.ForName(qry).Arguments.ForName("includeDeleted"), qry)
+	}
+
+	gqlSch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+	s, ok := gqlSch.(*schema)
+	require.True(t, ok, "expected to be able to convert sch to internal schema type")
+	typ := func(name string) Type {
+		return &astType{
+			typ:             &ast.Type{NamedType: name},
+			inSchema:        s,
+			dgraphPredicate: s.dgraphPredicate,
+		}
+	}
+	require.NotNil(t, typ("Post").SoftDeleteField())
+	require.Equal(t, "deletedAt", typ("Post").SoftDeleteField().Name())
+	require.Nil(t, typ("Author").SoftDeleteField())
+}
+
+func TestSchemaAST(t *testing.T) {
+	schHandler, err := NewHandler(`
+		type Author {
+			id: ID!
+			name: String! @search(by: [hash])
+			posts: [Post] @hasInverse(field: author)
+		}
+
+		type Post {
+			id: ID!
+			title: String!
+			author: Author
+		}`)
+	require.NoError(t, err)
+	sch, err := FromString(schHandler.GQLSchema())
+	require.NoError(t, err)
+
+	doc := sch.AST()
+	require.NotNil(t, doc)
+	payload := doc.Types["UpdateAuthorPayload"]
+	require.NotNil(t, payload)
+	require.Equal(t, ast.Object, payload.Kind)
+	require.NotNil(t, payload.Fields.ForName("author"))
+	require.NotNil(t, payload.Fields.ForName("numUids"))
+	require.NotNil(t, doc.Mutation.Fields.ForName("updateAuthor"))
+	require.NotNil(t, doc.Types["Author"].Fields.ForName("posts").Directives.ForName(inverseDirective))
+}
@@ -20,10 +20,13 @@ import (
 	"context"
 	"encoding/json"
 	"math"
+	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/dgraph-io/dgraph/graphql/authorization"
 	"github.com/dgraph-io/dgraph/graphql/resolve"
 	"github.com/dgraph-io/dgraph/graphql/schema"
 	"github.com/dgraph-io/dgraph/x"
@@ -58,7 +61,11 @@ type SubscriberResponse struct {
 
 // AddSubscriber tries to add subscription into the existing polling goroutine if it exists.
 // If it doesn't exist, then it creates a new polling goroutine for the given request.
-func (p *Poller) AddSubscriber(req *schema.Request) (*SubscriberResponse, error) {
+// The request is resolved with the authorization, the JWT authorization data and the allowed
+// header claims in ctx, if any, so subscribers with different JWTs or header claims never share a
+// polling goroutine.
+func (p *Poller) AddSubscriber(ctx context.Context,
+	req *schema.Request) (*SubscriberResponse, error) {
 	localEpoch := atomic.LoadUint64(p.globalEpoch)
 
 	err := p.resolver.ValidateSubscription(req)
@@ -69,11 +76,17 @@ func (p *Poller) AddSubscriber(req *schema.Request) (*SubscriberResponse, error)
 	buf, err := json.Marshal(req)
 	x.Check(err)
 
-	bucketID := farm.Fingerprint64(buf)
+	authMeta := authorization.GetAuthMeta(ctx)
+	jwt := authorization.GetJwt(ctx)
+	headers := authorization.GetAllowedHeaders(ctx)
+	headerBuf, err := json.Marshal(headers)
+	x.Check(err)
+	bucketID := farm.Fingerprint64(append(append(buf, jwt...), headerBuf...))
 	p.Lock()
 	defer p.Unlock()
 
-	res := p.resolver.Resolve(context.TODO(), req)
+	state := resolve.NewSubscriptionState()
+	res := p.resolver.Resolve(resolve.WithSubscriptionState(authContext(authMeta, jwt, headers), state), req)
 	if len(res.Errors) != 0 {
 		return nil, res.Errors
 	}
@@ -86,6 +99,12 @@ func (p *Poller) AddSubscriber(req *schema.Request) (*SubscriberResponse, error)
 	subscriptionID := p.subscriptionID
 	// Increment ID for next subscription.
 	p.subscriptionID++
+	if state.HasEvents() {
+		// The events are what changed since the subscriber was last sent the nodes, and each
+		// subscriber was sent them at a different time, so a subscription to events has a
+		// polling goroutine of its own, with its own state.
+		bucketID = farm.Fingerprint64(append(buf, strconv.FormatUint(subscriptionID, 10)...))
+	}
 	subscriptions, ok := p.pollRegistry[bucketID]
 	if !ok {
 		subscriptions = make(map[uint64]chan interface{})
@@ -111,6 +130,10 @@ func (p *Poller) AddSubscriber(req *schema.Request) (*SubscriberResponse, error)
 		bucketID:   bucketID,
 		prevHash:   prevHash,
 		graphqlReq: req,
+		authMeta:   authMeta,
+		jwt:        jwt,
+		headers:    headers,
+		state:      state,
 		localEpoch: localEpoch,
 	}
 	go p.poll(pollR)
@@ -125,10 +148,26 @@ func (p *Poller) AddSubscriber(req *schema.Request) (*SubscriberResponse, error)
 type pollRequest struct {
 	prevHash   uint64
 	graphqlReq *schema.Request
+	// authMeta, jwt and headers are the authorization of the namespace, the JWT authorization
+	// data and the allowed header claims the request is resolved with.
+	authMeta *authorization.AuthMeta
+	jwt      string
+	headers  http.Header
+	// state is what the subscription remembers between polls, so that subscribeT fields send
+	// the events since the last poll.
+	state      *resolve.SubscriptionState
 	bucketID   uint64
 	localEpoch uint64
 }
 
+// authContext returns a context with the authorization meta, the JWT authorization data jwt and
+// the allowed header claims headers, that a subscription is resolved with.  The header claims are
+// only kept if meta allows them, so meta has to be attached first.
+func authContext(meta *authorization.AuthMeta, jwt string, headers http.Header) context.Context {
+	ctx := authorization.AttachAuthMeta(context.TODO(), meta)
+	return authorization.AttachAllowedHeaders(authorization.AttachJwt(ctx, jwt), headers)
+}
+
 func (p *Poller) poll(req *pollRequest) {
 	resolver := p.resolver
 	pollID := uint64(0)
@@ -145,11 +184,17 @@ func (p *Poller) poll(req *pollRequest) {
 			return
 		}
 
-		res := resolver.Resolve(context.TODO(), req.graphqlReq)
+		res := resolver.Resolve(resolve.WithSubscriptionState(
+			authContext(req.authMeta, req.jwt, req.headers), req.state), req.graphqlReq)
 
 		currentHash := farm.Fingerprint64(res.Data.Bytes())
 
-		if req.prevHash == currentHash {
+		unchanged := req.prevHash == currentHash
+		if req.state.HasEvents() {
+			// The result is the events since the last poll, so it's sent if there are any.
+			unchanged = req.state.Events() == 0
+		}
+		if unchanged {
 			if pollID%30 != 0 {
 				// Don't update if there is no change in response.
 				continue
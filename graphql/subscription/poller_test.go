@@ -0,0 +1,68 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package subscription
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/dgraph-io/dgraph/graphql/dgraph"
+	"github.com/dgraph-io/dgraph/graphql/resolve"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/dgraph-io/dgraph/graphql/test"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that a subscription is polled with the allowed header claims of its subscriber, so auth
+// rules see them as $http variables, as they do for queries.
+func TestAuthContextKeepsHeaderClaims(t *testing.T) {
+	gqlSchema := test.LoadSchemaFromString(t, `
+	type Project @auth(query: { rule: """
+		query($http.X-Org-Id: String!) {
+			queryProject(filter: { org: { eq: $http.X-Org-Id } }) { __typename }
+		}""" }) {
+		id: ID!
+		name: String!
+		org: String! @search(by: [hash])
+	}
+
+	# Dgraph.Authorization {"VerificationKey":"secretkey","Header":"X-Test-Auth","Namespace":"https://xyz.io/jwt/claims","Algo":"HS256","allowedHeaderClaims":["X-Org-Id"]}
+	`)
+
+	// The subscriber's context is built like the websocket handlers build it.
+	r := &http.Request{Header: http.Header{"X-Org-Id": []string{"acme"}}}
+	subCtx := authorization.AttachAuthorizationJwt(
+		authorization.AttachAuthMeta(context.Background(), gqlSchema.AuthMeta()), r)
+
+	ctx := authContext(authorization.GetAuthMeta(subCtx), authorization.GetJwt(subCtx),
+		authorization.GetAllowedHeaders(subCtx))
+
+	op, err := gqlSchema.Operation(&schema.Request{Query: `query { queryProject { name } }`})
+	require.NoError(t, err)
+	dgQuery, err := resolve.NewQueryRewriter().Rewrite(ctx, test.GetQuery(t, op))
+	require.NoError(t, err)
+	require.Equal(t, `query {
+  queryProject(func: uid(Project1)) @filter(uid(Project2)) {
+    name : Project.name
+    dgraph.uid : uid
+  }
+  Project1 as var(func: type(Project))
+  Project2 as var(func: uid(Project1)) @filter(eq(Project.org, "acme")) @cascade
+}`, dgraph.AsString(dgQuery))
+}
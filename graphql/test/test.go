@@ -17,6 +17,7 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"testing"
@@ -59,7 +60,10 @@ func LoadSchemaFromString(t *testing.T, sch string) schema.Schema {
 	handler, err := schema.NewHandler(string(sch))
 	requireNoGQLErrors(t, err)
 
-	return LoadSchema(t, handler.GQLSchema())
+	// Like the schema the server serves, it keeps the secrets and authorization of the input.
+	gqlSchema, err := schema.FromHandler(context.Background(), handler)
+	requireNoGQLErrors(t, err)
+	return gqlSchema
 }
 
 // GetMutation gets a single schema.Mutation from a schema.Operation.
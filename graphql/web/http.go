@@ -17,6 +17,7 @@
 package web
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
@@ -27,6 +28,7 @@ import (
 	"mime"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/dgraph-io/dgraph/graphql/api"
 	"github.com/dgraph-io/dgraph/graphql/authorization"
@@ -35,7 +37,6 @@ import (
 	"github.com/dgraph-io/dgraph/graphql/subscription"
 	"github.com/dgraph-io/dgraph/x"
 	"github.com/golang/glog"
-	"github.com/graph-gophers/graphql-transport-ws/graphqlws"
 	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
 )
@@ -55,19 +56,29 @@ type IServeGraphQL interface {
 	Resolve(ctx context.Context, gqlReq *schema.Request) *schema.Response
 }
 
+// graphqlHandler serves the schema of each namespace.  A request is resolved against the
+// schema of the namespace it names in the NamespaceHeader, or of the default namespace if it
+// doesn't name one.
 type graphqlHandler struct {
-	resolver *resolve.RequestResolver
-	handler  http.Handler
-	poller   *subscription.Poller
+	schemaEpoch *uint64
+	schemas     *schema.Registry
+	handler     http.Handler
+
+	sync.RWMutex
+	resolvers map[string]*resolve.RequestResolver
+	pollers   map[string]*subscription.Poller
 }
 
 // NewServer returns a new IServeGraphQL that can serve the given resolvers
 func NewServer(schemaEpoch *uint64, resolver *resolve.RequestResolver) IServeGraphQL {
 	gh := &graphqlHandler{
-		resolver: resolver,
-		poller:   subscription.NewPoller(schemaEpoch, resolver),
+		schemaEpoch: schemaEpoch,
+		schemas:     schema.NewRegistry(),
+		resolvers:   make(map[string]*resolve.RequestResolver),
+		pollers:     make(map[string]*subscription.Poller),
 	}
-	gh.handler = recoveryHandler(commonHeaders(gh.Handler()))
+	gh.ServeGQL(resolver)
+	gh.handler = recoveryHandler(commonHeaders(gh, gh.Handler()))
 	return gh
 }
 
@@ -75,23 +86,99 @@ func (gh *graphqlHandler) HTTPHandler() http.Handler {
 	return gh.handler
 }
 
+// ServeGQL serves resolver for the namespace of its schema.  The other namespaces keep the
+// resolvers they have.
 func (gh *graphqlHandler) ServeGQL(resolver *resolve.RequestResolver) {
-	gh.poller.UpdateResolver(resolver)
-	gh.resolver = resolver
+	ns := schema.DefaultNamespace
+	if sch := resolver.Schema(); sch != nil {
+		ns = sch.Namespace()
+		gh.schemas.Set(sch)
+	} else {
+		gh.schemas.Delete(ns)
+	}
+
+	gh.Lock()
+	defer gh.Unlock()
+	gh.resolvers[ns] = resolver
+	if poller, ok := gh.pollers[ns]; ok {
+		poller.UpdateResolver(resolver)
+	} else {
+		gh.pollers[ns] = subscription.NewPoller(gh.schemaEpoch, resolver)
+	}
 }
 
 func (gh *graphqlHandler) Resolve(ctx context.Context, gqlReq *schema.Request) *schema.Response {
-	return gh.resolver.Resolve(ctx, gqlReq)
+	resolver, _, err := gh.servedFor(gqlReq.Namespace)
+	if err != nil {
+		return schema.ErrorResponse(err)
+	}
+	return resolver.Resolve(ctx, gqlReq)
+}
+
+// servedFor returns the resolver and the poller of namespace ns.
+func (gh *graphqlHandler) servedFor(ns string) (
+	*resolve.RequestResolver, *subscription.Poller, error) {
+
+	gh.RLock()
+	defer gh.RUnlock()
+	resolver, ok := gh.resolvers[ns]
+	if !ok {
+		return nil, nil, errors.Errorf("Namespace %q doesn't have a GraphQL schema.", ns)
+	}
+	return resolver, gh.pollers[ns], nil
 }
 
 // write chooses between the http response writer and gzip writer
 // and sends the schema response using that.
 func write(w http.ResponseWriter, rr *schema.Response, acceptGzip bool) {
-	var out io.Writer = w
-
 	// set TouchedUids header
 	w.Header().Set(touchedUidsHeader, strconv.FormatUint(rr.GetExtensions().GetTouchedUids(), 10))
 
+	writeBody(w, acceptGzip, rr.WriteTo)
+}
+
+// writeBatch sends the responses to a batch of requests as a JSON array, in the order of the
+// requests.  The TouchedUids header is the total of all the responses.
+func writeBatch(w http.ResponseWriter, rrs []*schema.Response, acceptGzip bool) {
+	var touchedUids uint64
+	for _, rr := range rrs {
+		touchedUids += rr.GetExtensions().GetTouchedUids()
+	}
+	w.Header().Set(touchedUidsHeader, strconv.FormatUint(touchedUids, 10))
+
+	writeBody(w, acceptGzip, func(out io.Writer) (int64, error) {
+		var total int64
+		for i, rr := range rrs {
+			sep := ","
+			if i == 0 {
+				sep = "["
+			}
+			n, err := io.WriteString(out, sep)
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+			m, err := rr.WriteTo(out)
+			total += m
+			if err != nil {
+				return total, err
+			}
+		}
+		end := "]"
+		if len(rrs) == 0 {
+			end = "[]"
+		}
+		n, err := io.WriteString(out, end)
+		return total + int64(n), err
+	})
+}
+
+// writeBody writes the response body with writeTo, gzipped if the receiver accepts it.
+func writeBody(w http.ResponseWriter, acceptGzip bool,
+	writeTo func(out io.Writer) (int64, error)) {
+
+	var out io.Writer = w
+
 	// If the receiver accepts gzip, then we would update the writer
 	// and send gzipped content instead.
 	if acceptGzip {
@@ -101,13 +188,15 @@ func write(w http.ResponseWriter, rr *schema.Response, acceptGzip bool) {
 		out = gzw
 	}
 
-	if _, err := rr.WriteTo(out); err != nil {
+	if _, err := writeTo(out); err != nil {
 		glog.Error(err)
 	}
 }
 
 type graphqlSubscription struct {
 	graphqlHandler *graphqlHandler
+	// namespace is the namespace the subscriptions are resolved in.
+	namespace string
 }
 
 func (gs *graphqlSubscription) Subscribe(
@@ -120,8 +209,14 @@ func (gs *graphqlSubscription) Subscribe(
 		OperationName: operationName,
 		Query:         document,
 		Variables:     variableValues,
+		MaxDepth:      x.Config.GraphqlMaxDepth,
+		Namespace:     gs.namespace,
+	}
+	_, poller, err := gs.graphqlHandler.servedFor(gs.namespace)
+	if err != nil {
+		return nil, err
 	}
-	res, err := gs.graphqlHandler.poller.AddSubscriber(req)
+	res, err := poller.AddSubscriber(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -130,15 +225,24 @@ func (gs *graphqlSubscription) Subscribe(
 		// Context is cancelled when a client disconnects, so delete subscription after client
 		// disconnects.
 		<-ctx.Done()
-		gs.graphqlHandler.poller.TerminateSubscription(res.BucketID, res.SubscriptionID)
+		poller.TerminateSubscription(res.BucketID, res.SubscriptionID)
 	}()
 	return res.UpdateCh, ctx.Err()
 }
 
+// Handler returns the http.Handler that serves queries, mutations and subscriptions.  Requests
+// are authorized with the # Dgraph.Authorization of the schema of their namespace.
 func (gh *graphqlHandler) Handler() http.Handler {
-	return graphqlws.NewHandlerFunc(&graphqlSubscription{
-		graphqlHandler: gh,
+	subscriptions := subscriptionHandler(func(r *http.Request) subscriptionService {
+		return &graphqlSubscription{
+			graphqlHandler: gh,
+			namespace:      r.Header.Get(schema.NamespaceHeader),
+		}
 	}, gh)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := gh.schemas.WithAuthMeta(r.Context(), r.Header.Get(schema.NamespaceHeader))
+		subscriptions.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 // ServeHTTP handles GraphQL queries and mutations that get resolved
@@ -156,27 +260,49 @@ func (gh *graphqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		x.Panic(errors.New("graphqlHandler not initialised"))
 	}
 
+	acceptGzip := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	ns := r.Header.Get(schema.NamespaceHeader)
+	resolver, _, err := gh.servedFor(ns)
+	if err != nil {
+		write(w, schema.ErrorResponse(err), acceptGzip)
+		return
+	}
+
+	// Handler has attached the authorization of the namespace's schema, so the JWT is read from
+	// the header that schema names.
 	ctx = authorization.AttachAuthorizationJwt(ctx, r)
 	ctx = x.AttachAccessJwt(ctx, r)
 	// Add remote addr as peer info so that the remote address can be logged
 	// inside Server.Login
 	ctx = x.AttachRemoteIP(ctx, r)
 
-	var res *schema.Response
-	gqlReq, err := getRequest(ctx, r)
-
+	gqlReqs, batch, err := getRequests(ctx, r)
 	if err != nil {
-		res = schema.ErrorResponse(err)
-	} else {
+		write(w, schema.ErrorResponse(err), acceptGzip)
+		return
+	}
+	for _, gqlReq := range gqlReqs {
 		gqlReq.Header = r.Header
-		res = gh.resolver.Resolve(ctx, gqlReq)
+		gqlReq.Namespace = ns
+	}
+	if batch {
+		writeBatch(w, resolver.ResolveBatch(ctx, gqlReqs), acceptGzip)
+	} else {
+		write(w, resolver.Resolve(ctx, gqlReqs[0]), acceptGzip)
 	}
-
-	write(w, res, strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"))
 }
 
 func (gh *graphqlHandler) isValid() bool {
-	return !(gh == nil || gh.resolver == nil)
+	return !(gh == nil || gh.resolvers == nil)
+}
+
+// allowedHeaders returns the headers that clients of the schema of namespace ns can send.
+func (gh *graphqlHandler) allowedHeaders(ns string) string {
+	allowed := x.AccessControlAllowedHeaders
+	if sch := gh.schemas.Schema(ns); sch != nil {
+		allowed = sch.AllowedHeaders()
+	}
+	return allowed + ", " + schema.NamespaceHeader
 }
 
 type gzreadCloser struct {
@@ -192,13 +318,18 @@ func (gz gzreadCloser) Close() error {
 	return gz.Closer.Close()
 }
 
-func getRequest(ctx context.Context, r *http.Request) (*schema.Request, error) {
+// getRequests returns the GraphQL requests in r.  That's one request, unless r's body is a JSON
+// array of requests, like Apollo's batch link sends, and then batch is true.
+func getRequests(ctx context.Context, r *http.Request) (
+	gqlReqs []*schema.Request, batch bool, err error) {
+
 	gqlReq := &schema.Request{}
+	gqlReqs = []*schema.Request{gqlReq}
 
 	if r.Header.Get("Content-Encoding") == "gzip" {
 		zr, err := gzip.NewReader(r.Body)
 		if err != nil {
-			return nil, errors.Wrap(err, "Unable to parse gzip")
+			return nil, false, errors.Wrap(err, "Unable to parse gzip")
 		}
 		r.Body = gzreadCloser{zr, r.Body}
 	}
@@ -214,49 +345,69 @@ func getRequest(ctx context.Context, r *http.Request) (*schema.Request, error) {
 			d.UseNumber()
 
 			if err := d.Decode(&gqlReq.Variables); err != nil {
-				return nil, errors.Wrap(err, "Not a valid GraphQL request body")
+				return nil, false, errors.Wrap(err, "Not a valid GraphQL request body")
 			}
 		}
 	case http.MethodPost:
 		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 		if err != nil {
-			return nil, errors.Wrap(err, "unable to parse media type")
+			return nil, false, errors.Wrap(err, "unable to parse media type")
 		}
 
 		switch mediaType {
 		case "application/json":
-			d := json.NewDecoder(r.Body)
+			var body json.RawMessage
+			if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+				return nil, false, errors.Wrap(err, "Not a valid GraphQL request body")
+			}
+			batch = bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+
+			d := json.NewDecoder(bytes.NewReader(body))
 			d.UseNumber()
-			if err = d.Decode(&gqlReq); err != nil {
-				return nil, errors.Wrap(err, "Not a valid GraphQL request body")
+			if batch {
+				err = d.Decode(&gqlReqs)
+			} else {
+				err = d.Decode(&gqlReq)
+			}
+			if err != nil {
+				return nil, false, errors.Wrap(err, "Not a valid GraphQL request body")
 			}
 		case "application/graphql":
 			bytes, err := ioutil.ReadAll(r.Body)
 			if err != nil {
-				return nil, errors.Wrap(err, "Could not read GraphQL request body")
+				return nil, false, errors.Wrap(err, "Could not read GraphQL request body")
 			}
 			gqlReq.Query = string(bytes)
 		default:
 			// https://graphql.org/learn/serving-over-http/#post-request says:
 			// "A standard GraphQL POST request should use the application/json
 			// content type ..."
-			return nil, errors.New(
+			return nil, false, errors.New(
 				"Unrecognised Content-Type.  Please use application/json or application/graphql for GraphQL requests")
 		}
 	default:
-		return nil,
+		return nil, false,
 			errors.New("Unrecognised request method.  Please use GET or POST for GraphQL requests")
 	}
+	for i, gqlReq := range gqlReqs {
+		if gqlReq == nil {
+			return nil, false, errors.Errorf("Not a valid GraphQL request body: request %d "+
+				"of the batch is null", i)
+		}
+		gqlReq.Lenient = r.URL.Query().Get("lenient") == "true"
+		gqlReq.MaxDepth = x.Config.GraphqlMaxDepth
+	}
 
-	return gqlReq, nil
+	return gqlReqs, batch, nil
 }
 
-func commonHeaders(next http.Handler) http.Handler {
+func commonHeaders(gh *graphqlHandler, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		x.AddCorsHeaders(w)
 		// Overwrite the allowed headers after also including headers which are part of
 		// forwardHeaders.
-		w.Header().Set("Access-Control-Allow-Headers", schema.AllowedHeaders())
+		w.Header().Set("Access-Control-Allow-Headers",
+			gh.allowedHeaders(r.Header.Get(schema.NamespaceHeader)))
 
 		w.Header().Set("Content-Type", "application/json")
 
@@ -0,0 +1,371 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/dgraph-io/dgraph/graphql/schema"
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-transport-ws/graphqlws"
+)
+
+// Reference: https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const (
+	// protocolGraphQLTransportWS is the subprotocol of the graphql-ws library.  The legacy
+	// subscriptions-transport-ws protocol, served by graphqlws, is confusingly named graphql-ws.
+	protocolGraphQLTransportWS = "graphql-transport-ws"
+
+	connectionInitMsg = "connection_init"
+	connectionAckMsg  = "connection_ack"
+	pingMsg           = "ping"
+	pongMsg           = "pong"
+	subscribeMsg      = "subscribe"
+	nextMsg           = "next"
+	errorMsg          = "error"
+	completeMsg       = "complete"
+
+	// Close codes that the protocol defines for the ways a client can misbehave.
+	closeBadRequest       = 4400
+	closeUnauthorized     = 4401
+	closeForbidden        = 4403
+	closeInitTimeout      = 4408
+	closeSubscriberExists = 4409
+	closeTooManyInits     = 4429
+)
+
+var (
+	// connectionInitWait is how long a client has to send connection_init after connecting.
+	connectionInitWait = 10 * time.Second
+	// keepAlivePeriod is how often the server pings a graphql-transport-ws client.
+	keepAlivePeriod = 30 * time.Second
+)
+
+// A subscriptionService starts subscriptions for both websocket protocols.  It's implemented by
+// graphqlSubscription, so both protocols share the poller of the request's namespace.
+type subscriptionService interface {
+	Subscribe(ctx context.Context, document string, operationName string,
+		variableValues map[string]interface{}) (payloads <-chan interface{}, err error)
+}
+
+// subscriptionHandler serves subscriptions over websockets with whichever of the
+// graphql-transport-ws or the legacy graphql-ws protocol the client asks for in
+// Sec-WebSocket-Protocol.  graphql-transport-ws wins if the client asks for both.  Any other
+// request is served by next.  The subscriptions of a request are started by the service that
+// serviceFor returns for it.
+func subscriptionHandler(serviceFor func(r *http.Request) subscriptionService,
+	next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc := serviceFor(r)
+		if websocket.IsWebSocketUpgrade(r) && asksForProtocol(r, protocolGraphQLTransportWS) {
+			serveTransportWS(w, r, svc)
+			return
+		}
+		graphqlws.NewHandlerFunc(svc, next).ServeHTTP(w, r)
+	})
+}
+
+func asksForProtocol(r *http.Request, protocol string) bool {
+	for _, p := range websocket.Subprotocols(r) {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+var transportWSUpgrader = websocket.Upgrader{
+	Subprotocols: []string{protocolGraphQLTransportWS},
+	// CORS is allowed for all origins on the GraphQL endpoint, so it is for websockets too.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type transportWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// transportWSConn is a websocket connection speaking graphql-transport-ws.
+type transportWSConn struct {
+	ws  *websocket.Conn
+	svc subscriptionService
+	req *http.Request
+
+	// writeLock serialises writes to ws, which doesn't allow concurrent writers.
+	writeLock sync.Mutex
+
+	sync.Mutex
+	// ctx carries the JWT from connection_init, once the connection is acknowledged.
+	ctx           context.Context
+	initialised   bool
+	acknowledged  bool
+	subscriptions map[string]context.CancelFunc
+}
+
+// serveTransportWS upgrades r to a websocket and serves graphql-transport-ws on it until the
+// connection is closed.
+func serveTransportWS(w http.ResponseWriter, r *http.Request, svc subscriptionService) {
+	ws, err := transportWSUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client with an HTTP error.
+		glog.V(2).Infof("unable to upgrade to a %s websocket: %v",
+			protocolGraphQLTransportWS, err)
+		return
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	c := &transportWSConn{
+		ws:            ws,
+		svc:           svc,
+		req:           r,
+		ctx:           ctx,
+		subscriptions: make(map[string]context.CancelFunc),
+	}
+
+	initTimer := time.AfterFunc(connectionInitWait, func() {
+		c.Lock()
+		acknowledged := c.acknowledged
+		c.Unlock()
+		if !acknowledged {
+			c.close(closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	go c.keepAlive(ctx)
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			// The client went away, or we closed the connection.  Either way, cancelling ctx
+			// ends all the subscriptions of the connection.
+			return
+		}
+
+		var msg transportWSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.close(closeBadRequest, "Invalid message received")
+			return
+		}
+		if !c.handle(msg) {
+			return
+		}
+	}
+}
+
+// handle acts on a message from the client.  It returns false if the message closed the
+// connection.
+func (c *transportWSConn) handle(msg transportWSMessage) bool {
+	switch msg.Type {
+	case connectionInitMsg:
+		return c.init(msg)
+	case pingMsg:
+		c.write(transportWSMessage{Type: pongMsg, Payload: msg.Payload})
+	case pongMsg:
+		// Nothing to do, the client is just answering our ping or keeping the connection alive.
+	case subscribeMsg:
+		return c.subscribe(msg)
+	case completeMsg:
+		c.Lock()
+		if cancel, ok := c.subscriptions[msg.ID]; ok {
+			cancel()
+			delete(c.subscriptions, msg.ID)
+		}
+		c.Unlock()
+	default:
+		c.close(closeBadRequest, fmt.Sprintf("Invalid message type %q received", msg.Type))
+		return false
+	}
+	return true
+}
+
+// init handles connection_init.  The JWT can be given in the payload, keyed by the header name
+// from Dgraph.Authorization, as browsers can't set headers on websockets.  Otherwise, the
+// header of the upgrade request is used, if it has one.
+func (c *transportWSConn) init(msg transportWSMessage) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.initialised {
+		c.closeLocked(closeTooManyInits, "Too many initialisation requests")
+		return false
+	}
+	c.initialised = true
+
+	var payload map[string]interface{}
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			c.closeLocked(closeBadRequest, "Invalid connection_init payload")
+			return false
+		}
+	}
+
+	header := authorization.HeaderFrom(c.ctx)
+	jwt, _ := payload[header].(string)
+	if header == "" || jwt == "" {
+		c.ctx = authorization.AttachAuthorizationJwt(c.ctx, c.req)
+	} else {
+		c.ctx = authorization.AttachAllowedHeaders(authorization.AttachJwt(c.ctx, jwt),
+			c.req.Header)
+	}
+	if authorization.GetJwt(c.ctx) != "" {
+		if _, err := authorization.ExtractAuthVariables(c.ctx); err != nil {
+			c.closeLocked(closeForbidden, "Forbidden")
+			return false
+		}
+	}
+
+	c.acknowledged = true
+	c.write(transportWSMessage{Type: connectionAckMsg})
+	return true
+}
+
+func (c *transportWSConn) subscribe(msg transportWSMessage) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.acknowledged {
+		c.closeLocked(closeUnauthorized, "Unauthorized")
+		return false
+	}
+	if msg.ID == "" {
+		c.closeLocked(closeBadRequest, "Subscribe message without an id")
+		return false
+	}
+	if _, ok := c.subscriptions[msg.ID]; ok {
+		c.closeLocked(closeSubscriberExists,
+			fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+		return false
+	}
+
+	req := &schema.Request{}
+	d := json.NewDecoder(bytes.NewReader(msg.Payload))
+	d.UseNumber()
+	if err := d.Decode(req); err != nil {
+		c.closeLocked(closeBadRequest, "Invalid subscribe payload")
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.subscriptions[msg.ID] = cancel
+	go c.run(ctx, msg.ID, req)
+	return true
+}
+
+// run sends the results of subscription id to the client until either the client completes the
+// subscription, or the subscription ends.
+func (c *transportWSConn) run(ctx context.Context, id string, req *schema.Request) {
+	payloads, err := c.svc.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		if c.remove(id) {
+			c.writePayload(errorMsg, id, schema.AsGQLErrors(err))
+		}
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload, ok := <-payloads:
+			if !ok {
+				if c.remove(id) {
+					c.write(transportWSMessage{ID: id, Type: completeMsg})
+				}
+				return
+			}
+			c.writePayload(nextMsg, id, payload)
+		}
+	}
+}
+
+// remove removes subscription id from the connection.  It returns false if the client has
+// already completed the subscription.
+func (c *transportWSConn) remove(id string) bool {
+	c.Lock()
+	defer c.Unlock()
+	cancel, ok := c.subscriptions[id]
+	if ok {
+		cancel()
+		delete(c.subscriptions, id)
+	}
+	return ok
+}
+
+func (c *transportWSConn) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(keepAlivePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.write(transportWSMessage{Type: pingMsg})
+		}
+	}
+}
+
+func (c *transportWSConn) writePayload(typ, id string, payload interface{}) {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		glog.Errorf("unable to marshal %s payload for subscription %s: %v", typ, id, err)
+		return
+	}
+	c.write(transportWSMessage{ID: id, Type: typ, Payload: buf})
+}
+
+func (c *transportWSConn) write(msg transportWSMessage) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if err := c.ws.WriteJSON(msg); err != nil {
+		glog.V(2).Infof("unable to write %s message to websocket: %v", msg.Type, err)
+	}
+}
+
+func (c *transportWSConn) close(code int, reason string) {
+	c.Lock()
+	defer c.Unlock()
+	c.closeLocked(code, reason)
+}
+
+// closeLocked closes the connection with code and reason.  c must be locked.
+func (c *transportWSConn) closeLocked(code int, reason string) {
+	for id, cancel := range c.subscriptions {
+		cancel()
+		delete(c.subscriptions, id)
+	}
+
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := c.ws.WriteControl(websocket.CloseMessage, msg,
+		time.Now().Add(time.Second)); err != nil {
+		glog.V(2).Infof("unable to write close message to websocket: %v", err)
+	}
+	c.ws.Close()
+}
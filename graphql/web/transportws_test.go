@@ -0,0 +1,313 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/dgraph/graphql/authorization"
+	"github.com/dgraph-io/dgraph/testutil"
+	"github.com/dgraph-io/dgraph/x"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	goodSubscription = `subscription { queryUser { name } }`
+	badSubscription  = `subscription { queryUser { nope } }`
+)
+
+// fakeSubscriptions answers every good subscription with the USER from its JWT, and then ends
+// the subscription.
+type fakeSubscriptions struct{}
+
+func (fakeSubscriptions) Subscribe(
+	ctx context.Context,
+	document string,
+	operationName string,
+	variableValues map[string]interface{}) (<-chan interface{}, error) {
+
+	if document != goodSubscription {
+		return nil, x.GqlErrorList{x.GqlErrorf("Cannot query field \"nope\" on type \"User\".")}
+	}
+
+	user := "anonymous"
+	if authVars, err := authorization.ExtractAuthVariables(ctx); err == nil && authVars != nil {
+		user, _ = authVars["USER"].(string)
+	}
+
+	payloads := make(chan interface{}, 1)
+	payloads <- map[string]interface{}{
+		"data": map[string]interface{}{"queryUser": []interface{}{
+			map[string]interface{}{"name": user}}},
+	}
+	close(payloads)
+	return payloads, nil
+}
+
+// headerSubscriptions answers every subscription with the value of the X-Org-Id header claim
+// that it's given, which is what auth rules see as $http.X-Org-Id, and then ends the
+// subscription.
+type headerSubscriptions struct{}
+
+func (headerSubscriptions) Subscribe(
+	ctx context.Context,
+	document string,
+	operationName string,
+	variableValues map[string]interface{}) (<-chan interface{}, error) {
+
+	payloads := make(chan interface{}, 1)
+	payloads <- map[string]interface{}{
+		"data": map[string]interface{}{"queryOrg": []interface{}{
+			map[string]interface{}{"id": authorization.GetAllowedHeaders(ctx).Get("X-Org-Id")}}},
+	}
+	close(payloads)
+	return payloads, nil
+}
+
+func subscriptionServer() (*httptest.Server, string) {
+	return authSubscriptionServer(nil)
+}
+
+// authSubscriptionServer serves fakeSubscriptions with the authorization meta, like the
+// GraphQL handler does with the authorization of the schema of the request's namespace.
+func authSubscriptionServer(meta *authorization.AuthMeta) (*httptest.Server, string) {
+	return serveSubscriptions(meta, fakeSubscriptions{})
+}
+
+func serveSubscriptions(meta *authorization.AuthMeta,
+	svc subscriptionService) (*httptest.Server, string) {
+	handler := subscriptionHandler(func(r *http.Request) subscriptionService {
+		return svc
+	}, http.NotFoundHandler())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(authorization.AttachAuthMeta(r.Context(), meta)))
+	}))
+	return srv, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string, protocol string) *websocket.Conn {
+	conn, resp, err := websocket.DefaultDialer.Dial(url,
+		http.Header{"Sec-WebSocket-Protocol": []string{protocol}})
+	require.NoError(t, err)
+	if protocol == protocolGraphQLTransportWS {
+		require.Equal(t, protocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, typ, id, payload string) {
+	msg := transportWSMessage{ID: id, Type: typ}
+	if payload != "" {
+		msg.Payload = json.RawMessage(payload)
+	}
+	require.NoError(t, conn.WriteJSON(msg))
+}
+
+func recv(t *testing.T, conn *websocket.Conn) transportWSMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg transportWSMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func requireClosedWith(t *testing.T, conn *websocket.Conn, code int) {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err := conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, code), "expected close %d, got %v", code, err)
+}
+
+func TestTransportWSSubscription(t *testing.T) {
+	srv, url := subscriptionServer()
+	defer srv.Close()
+
+	conn := dial(t, url, protocolGraphQLTransportWS)
+	defer conn.Close()
+
+	send(t, conn, connectionInitMsg, "", `{}`)
+	require.Equal(t, connectionAckMsg, recv(t, conn).Type)
+
+	send(t, conn, pingMsg, "", `{"hello":"there"}`)
+	pong := recv(t, conn)
+	require.Equal(t, pongMsg, pong.Type)
+	require.JSONEq(t, `{"hello":"there"}`, string(pong.Payload))
+
+	send(t, conn, subscribeMsg, "1", `{"query": "`+goodSubscription+`"}`)
+	next := recv(t, conn)
+	require.Equal(t, nextMsg, next.Type)
+	require.Equal(t, "1", next.ID)
+	require.JSONEq(t, `{"data":{"queryUser":[{"name":"anonymous"}]}}`, string(next.Payload))
+
+	complete := recv(t, conn)
+	require.Equal(t, completeMsg, complete.Type)
+	require.Equal(t, "1", complete.ID)
+
+	send(t, conn, subscribeMsg, "2", `{"query": "`+badSubscription+`"}`)
+	errMsg := recv(t, conn)
+	require.Equal(t, errorMsg, errMsg.Type)
+	require.Equal(t, "2", errMsg.ID)
+	require.JSONEq(t, `[{"message":"Cannot query field \"nope\" on type \"User\"."}]`,
+		string(errMsg.Payload))
+}
+
+func TestTransportWSConnectionInitAuth(t *testing.T) {
+	meta, err := authorization.NewAuthMeta(
+		`# Dgraph.Authorization X-Test-Auth https://xyz.io/jwt/claims HS256 "secretkey"`)
+	require.NoError(t, err)
+
+	srv, url := authSubscriptionServer(meta)
+	defer srv.Close()
+
+	authMeta := &testutil.AuthMeta{
+		PublicKey: "secretkey",
+		Namespace: "https://xyz.io/jwt/claims",
+		Algo:      "HS256",
+		AuthVars:  map[string]interface{}{"USER": "alice"},
+	}
+	token, err := authMeta.GetSignedToken("")
+	require.NoError(t, err)
+
+	t.Run("valid JWT", func(t *testing.T) {
+		conn := dial(t, url, protocolGraphQLTransportWS)
+		defer conn.Close()
+
+		send(t, conn, connectionInitMsg, "", `{"X-Test-Auth": "`+token+`"}`)
+		require.Equal(t, connectionAckMsg, recv(t, conn).Type)
+
+		send(t, conn, subscribeMsg, "1", `{"query": "`+goodSubscription+`"}`)
+		next := recv(t, conn)
+		require.Equal(t, nextMsg, next.Type)
+		require.JSONEq(t, `{"data":{"queryUser":[{"name":"alice"}]}}`, string(next.Payload))
+	})
+
+	t.Run("invalid JWT", func(t *testing.T) {
+		conn := dial(t, url, protocolGraphQLTransportWS)
+		defer conn.Close()
+
+		send(t, conn, connectionInitMsg, "", `{"X-Test-Auth": "not-a-jwt"}`)
+		requireClosedWith(t, conn, closeForbidden)
+	})
+}
+
+func TestTransportWSHeaderClaims(t *testing.T) {
+	meta, err := authorization.NewAuthMeta(`# Dgraph.Authorization ` +
+		`{"VerificationKey":"secretkey","Header":"X-Test-Auth",` +
+		`"Namespace":"https://xyz.io/jwt/claims","Algo":"HS256",` +
+		`"allowedHeaderClaims":["X-Org-Id"]}`)
+	require.NoError(t, err)
+
+	srv, url := serveSubscriptions(meta, headerSubscriptions{})
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{
+		"Sec-WebSocket-Protocol": []string{protocolGraphQLTransportWS},
+		"X-Org-Id":               []string{"acme"},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	send(t, conn, connectionInitMsg, "", `{}`)
+	require.Equal(t, connectionAckMsg, recv(t, conn).Type)
+
+	send(t, conn, subscribeMsg, "1", `{"query": "subscription { queryOrg { id } }"}`)
+	next := recv(t, conn)
+	require.Equal(t, nextMsg, next.Type)
+	require.JSONEq(t, `{"data":{"queryOrg":[{"id":"acme"}]}}`, string(next.Payload))
+}
+
+func TestTransportWSProtocolErrors(t *testing.T) {
+	srv, url := subscriptionServer()
+	defer srv.Close()
+
+	t.Run("subscribe before connection_init", func(t *testing.T) {
+		conn := dial(t, url, protocolGraphQLTransportWS)
+		defer conn.Close()
+
+		send(t, conn, subscribeMsg, "1", `{"query": "`+goodSubscription+`"}`)
+		requireClosedWith(t, conn, closeUnauthorized)
+	})
+
+	t.Run("second connection_init", func(t *testing.T) {
+		conn := dial(t, url, protocolGraphQLTransportWS)
+		defer conn.Close()
+
+		send(t, conn, connectionInitMsg, "", "")
+		require.Equal(t, connectionAckMsg, recv(t, conn).Type)
+		send(t, conn, connectionInitMsg, "", "")
+		requireClosedWith(t, conn, closeTooManyInits)
+	})
+
+	t.Run("unknown message type", func(t *testing.T) {
+		conn := dial(t, url, protocolGraphQLTransportWS)
+		defer conn.Close()
+
+		send(t, conn, "start", "1", `{"query": "`+goodSubscription+`"}`)
+		requireClosedWith(t, conn, closeBadRequest)
+	})
+
+	t.Run("no connection_init", func(t *testing.T) {
+		defer func(wait time.Duration) { connectionInitWait = wait }(connectionInitWait)
+		connectionInitWait = 50 * time.Millisecond
+
+		conn := dial(t, url, protocolGraphQLTransportWS)
+		defer conn.Close()
+
+		requireClosedWith(t, conn, closeInitTimeout)
+	})
+}
+
+func TestTransportWSKeepAlive(t *testing.T) {
+	defer func(period time.Duration) { keepAlivePeriod = period }(keepAlivePeriod)
+	keepAlivePeriod = 50 * time.Millisecond
+
+	srv, url := subscriptionServer()
+	defer srv.Close()
+
+	conn := dial(t, url, protocolGraphQLTransportWS)
+	defer conn.Close()
+
+	send(t, conn, connectionInitMsg, "", `{}`)
+	require.Equal(t, connectionAckMsg, recv(t, conn).Type)
+	require.Equal(t, pingMsg, recv(t, conn).Type)
+	send(t, conn, pongMsg, "", "")
+}
+
+func TestLegacyGraphQLWSSubscription(t *testing.T) {
+	srv, url := subscriptionServer()
+	defer srv.Close()
+
+	conn := dial(t, url, "graphql-ws")
+	defer conn.Close()
+
+	send(t, conn, connectionInitMsg, "", `{}`)
+	require.Equal(t, connectionAckMsg, recv(t, conn).Type)
+
+	send(t, conn, "start", "1", `{"query": "`+goodSubscription+`"}`)
+	var data transportWSMessage
+	for data.Type != "data" {
+		// The legacy protocol may send keep alive (ka) messages before the data.
+		data = recv(t, conn)
+	}
+	require.Equal(t, "1", data.ID)
+	require.JSONEq(t, `{"data":{"queryUser":[{"name":"anonymous"}]}}`, string(data.Payload))
+}
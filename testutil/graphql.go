@@ -150,6 +150,8 @@ type AuthMeta struct {
 	Algo      string
 	Header    string
 	AuthVars  map[string]interface{}
+	// Subject is the sub claim of the token, it's left out if it's empty.
+	Subject string
 }
 
 func (a *AuthMeta) GetSignedToken(privateKeyFile string) (string, error) {
@@ -159,6 +161,7 @@ func (a *AuthMeta) GetSignedToken(privateKeyFile string) (string, error) {
 		jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(time.Minute).Unix(),
 			Issuer:    "test",
+			Subject:   a.Subject,
 		},
 	}
 
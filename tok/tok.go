@@ -18,6 +18,8 @@ package tok
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math"
 	"plugin"
 	"time"
 
@@ -47,6 +49,9 @@ const (
 	IdentGeo       = 0x5
 	IdentInt       = 0x6
 	IdentFloat     = 0x7
+	IdentFloat1    = 0x71
+	IdentFloat2    = 0x72
+	IdentFloat3    = 0x73
 	IdentFullText  = 0x8
 	IdentBool      = 0x9
 	IdentTrigram   = 0xA
@@ -88,6 +93,9 @@ func init() {
 	registerTokenizer(GeoTokenizer{})
 	registerTokenizer(IntTokenizer{})
 	registerTokenizer(FloatTokenizer{})
+	registerTokenizer(FloatBucketTokenizer{Precision: 1})
+	registerTokenizer(FloatBucketTokenizer{Precision: 2})
+	registerTokenizer(FloatBucketTokenizer{Precision: 3})
 	registerTokenizer(YearTokenizer{})
 	registerTokenizer(HourTokenizer{})
 	registerTokenizer(MonthTokenizer{})
@@ -115,8 +123,8 @@ func BuildTokens(val interface{}, t Tokenizer) ([]string, error) {
 	return tokens, nil
 }
 
-// LoadCustomTokenizer reads and loads a custom tokenizer from the given file.
-func LoadCustomTokenizer(soFile string) {
+// LoadCustomTokenizer reads and loads a custom tokenizer from the given file and returns it.
+func LoadCustomTokenizer(soFile string) Tokenizer {
 	glog.Infof("Loading custom tokenizer from %q", soFile)
 	pl, err := plugin.Open(soFile)
 	x.Checkf(err, "could not open custom tokenizer plugin file")
@@ -131,7 +139,9 @@ func LoadCustomTokenizer(soFile string) {
 	id := tokenizer.Identifier()
 	x.AssertTruef(id >= IdentCustom,
 		"custom tokenizer identifier byte must be >= 0x80, but was %#x", id)
-	registerTokenizer(CustomTokenizer{PluginTokenizer: tokenizer})
+	custom := CustomTokenizer{PluginTokenizer: tokenizer}
+	registerTokenizer(custom)
+	return custom
 }
 
 // GetTokenizerByID tries to find a tokenizer by id in the registered list.
@@ -208,6 +218,31 @@ func (t FloatTokenizer) Identifier() byte { return IdentFloat }
 func (t FloatTokenizer) IsSortable() bool { return true }
 func (t FloatTokenizer) IsLossy() bool    { return true }
 
+// FloatBucketTokenizer generates tokens from floating-point data, like FloatTokenizer, but
+// with buckets of 10^-Precision instead of 1, so that a range of values that are close
+// together is answered from fewer values.  The tokenizers are called float1, float2 and float3.
+type FloatBucketTokenizer struct {
+	Precision int
+}
+
+func (t FloatBucketTokenizer) Name() string { return fmt.Sprintf("float%d", t.Precision) }
+func (t FloatBucketTokenizer) Type() string { return "float" }
+func (t FloatBucketTokenizer) Tokens(v interface{}) ([]string, error) {
+	bucket := math.Trunc(v.(float64) * math.Pow10(t.Precision))
+	// Values too big for a bucket share the first or the last one, which keeps the tokens
+	// in the same order as the values.
+	switch {
+	case bucket >= math.MaxInt64:
+		return []string{encodeInt(math.MaxInt64)}, nil
+	case bucket <= math.MinInt64:
+		return []string{encodeInt(math.MinInt64)}, nil
+	}
+	return []string{encodeInt(int64(bucket))}, nil
+}
+func (t FloatBucketTokenizer) Identifier() byte { return IdentFloat1 + byte(t.Precision-1) }
+func (t FloatBucketTokenizer) IsSortable() bool { return true }
+func (t FloatBucketTokenizer) IsLossy() bool    { return true }
+
 // YearTokenizer generates year tokens from datetime data.
 type YearTokenizer struct{}
 
@@ -73,6 +73,25 @@ func TestFullTextTokenizer(t *testing.T) {
 	require.Equal(t, []string{encodeToken("stem", id), encodeToken("work", id)}, tokens)
 }
 
+func TestFloatBucketTokenizer(t *testing.T) {
+	tokenizer, has := GetTokenizer("float2")
+	require.True(t, has)
+	require.NotNil(t, tokenizer)
+
+	// 2.501 and 2.509 are in the same bucket, 2.52 is in a later one.
+	vals := []float64{math.Inf(-1), -2.5, 0, 2.501, 2.509, 2.52, 1e300}
+	var tokens []string
+	for _, val := range vals {
+		toks, err := BuildTokens(val, tokenizer)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(toks))
+		tokens = append(tokens, toks[0])
+	}
+	require.Equal(t, tokens[3], tokens[4])
+	require.True(t, sort.StringsAreSorted(tokens))
+	require.Less(t, tokens[4], tokens[5])
+}
+
 func TestHourTokenizer(t *testing.T) {
 	var err error
 	tokenizer, has := GetTokenizer("hour")
@@ -34,6 +34,12 @@ type Options struct {
 	PollInterval time.Duration
 	//GraphqlExtension wiil be set to see extensions in graphql results
 	GraphqlExtension bool
+	// GraphqlMaxDepth is how deep the selection sets of a GraphQL operation can be nested, or 0
+	// for no limit.
+	GraphqlMaxDepth int
+	// GraphqlBatchParallelism is how many requests of a batch of GraphQL requests are worked on
+	// at a time, or 0 for no limit.
+	GraphqlBatchParallelism int
 }
 
 // Config stores the global instance of this package's options.
@@ -51,6 +51,9 @@ var (
 	// LatencyMs is the latency of the various Dgraph operations.
 	LatencyMs = stats.Float64("latency",
 		"Latency of the various methods", stats.UnitMilliseconds)
+	// GraphqlBatchSize is the number of requests in each batch of GraphQL requests.
+	GraphqlBatchSize = stats.Int64("graphql_batch_size",
+		"Number of requests in a batch of GraphQL requests", stats.UnitDimensionless)
 
 	// Point-in-time metrics.
 
@@ -105,6 +108,8 @@ var (
 		20, 25, 30, 40, 50, 65, 80, 100, 130, 160, 200, 250, 300, 400, 500,
 		650, 800, 1000, 2000, 5000, 10000, 20000, 50000, 100000)
 
+	defaultBatchSizeDistribution = view.Distribution(1, 2, 4, 8, 16, 32, 64, 128, 256)
+
 	// Use this tag for the metric view if it needs status or method granularity.
 	// Metrics would be viewed separately for different tag values.
 	allTagKeys = []tag.Key{
@@ -133,6 +138,13 @@ var (
 			Aggregation: view.Count(),
 			TagKeys:     allTagKeys,
 		},
+		{
+			Name:        GraphqlBatchSize.Name(),
+			Measure:     GraphqlBatchSize,
+			Description: GraphqlBatchSize.Description(),
+			Aggregation: defaultBatchSizeDistribution,
+			TagKeys:     nil,
+		},
 		{
 			Name:        RaftAppliedIndex.Name(),
 			Measure:     RaftAppliedIndex,